@@ -0,0 +1,550 @@
+// Package cassette records requests, their responses and the timing of each
+// phase to a file, and replays them as an http.RoundTripper, optionally with
+// injected faults.
+package cassette
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Mode determines whether a Recorder captures live traffic or plays back a
+// previously captured cassette.
+type Mode int
+
+const (
+	ModeRecord Mode = iota
+	ModeReplay
+)
+
+// Names of the httptrace callbacks captured in a cassette.
+const (
+	EventGetConn              = "GetConn"
+	EventDNSStart             = "DNSStart"
+	EventDNSDone              = "DNSDone"
+	EventConnectStart         = "ConnectStart"
+	EventConnectDone          = "ConnectDone"
+	EventTLSHandshakeStart    = "TLSHandshakeStart"
+	EventTLSHandshakeDone     = "TLSHandshakeDone"
+	EventGotConn              = "GotConn"
+	EventWroteRequest         = "WroteRequest"
+	EventGotFirstResponseByte = "GotFirstResponseByte"
+	EventBodyDone             = "BodyDone"
+)
+
+// ErrNoInteraction is returned when replaying a request that has no matching
+// interaction left in the cassette.
+var ErrNoInteraction = errors.New("no matching interaction in cassette")
+
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+	Events   []Event  `json:"events"`
+	Fault    *Fault   `json:"fault,omitempty"`
+}
+
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body,omitempty"`
+}
+
+type Response struct {
+	Status     string      `json:"status"`
+	StatusCode int         `json:"status_code"`
+	Proto      string      `json:"proto"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body,omitempty"`
+}
+
+// Event is a single httptrace callback, with its offset from the start of the
+// round trip.
+type Event struct {
+	Name    string        `json:"name"`
+	Offset  time.Duration `json:"offset"`
+	Network string        `json:"network,omitempty"`
+	Addr    string        `json:"addr,omitempty"`
+	Reused  bool          `json:"reused,omitempty"`
+}
+
+// Matcher reports whether a recorded request can be used to answer req.
+type Matcher func(req *http.Request, recorded Request) bool
+
+// DefaultMatcher matches requests on method and URL.
+func DefaultMatcher(req *http.Request, recorded Request) bool {
+	return req.Method == recorded.Method && req.URL.String() == recorded.URL
+}
+
+// Redactor masks secrets in the URLs and header values of what is recorded,
+// such as a *report.Redactor.
+type Redactor interface {
+	Redact(text string) string
+	HeaderValue(name, value string) string
+}
+
+// Recorder is a http.RoundTripper which either records the interactions made
+// through an underlying transport, or replays them from a cassette file.
+//
+// When replaying, the recorded httptrace callbacks are fired against the
+// request's ClientTrace at their original offsets according to the Recorder's
+// clock. Passing the Recorder to trace.Trace.SetClock makes the resulting
+// timings identical to the recorded ones.
+type Recorder struct {
+	mode      Mode
+	path      string
+	cassette  *Cassette
+	transport http.RoundTripper
+	matcher   Matcher
+	fault     Fault
+	redactor  Redactor
+
+	mu      sync.Mutex
+	used    map[int]bool
+	now     time.Time
+	elapsed time.Duration
+}
+
+// New creates a Recorder for the cassette at path. In ModeReplay the cassette
+// is loaded immediately; in ModeRecord requests are sent using transport, or
+// http.DefaultTransport if it is nil.
+func New(path string, mode Mode, transport http.RoundTripper) (*Recorder, error) {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	r := &Recorder{
+		mode:      mode,
+		path:      path,
+		cassette:  &Cassette{},
+		transport: transport,
+		matcher:   DefaultMatcher,
+		used:      map[int]bool{},
+		now:       time.Unix(0, 0),
+	}
+
+	if mode == ModeReplay {
+		c, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		r.cassette = c
+	}
+
+	return r, nil
+}
+
+// Load reads a cassette from a file.
+func Load(path string) (*Cassette, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading cassette: %w", err)
+	}
+
+	c := &Cassette{}
+	err = json.Unmarshal(raw, c)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing cassette: %w", err)
+	}
+
+	return c, nil
+}
+
+// SetMatcher replaces the function used to find the interaction to replay.
+func (r *Recorder) SetMatcher(m Matcher) {
+	r.matcher = m
+}
+
+// SetFault injects a fault into every replayed interaction. Faults stored in
+// the cassette itself are applied on top of it.
+func (r *Recorder) SetFault(f Fault) {
+	r.fault = f
+}
+
+// SetRedactor masks the secrets redactor finds in the URLs and headers of
+// the requests and responses recorded, so the cassette can be shared. The
+// requests are still sent with the real values. When replaying, requests are
+// matched with their URL redacted the same way, as it was recorded.
+func (r *Recorder) SetRedactor(redactor Redactor) {
+	r.redactor = redactor
+}
+
+// Cassette returns the interactions recorded or loaded so far.
+func (r *Recorder) Cassette() *Cassette {
+	return r.cassette
+}
+
+// Save writes the recorded interactions to the cassette file.
+func (r *Recorder) Save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	raw, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding cassette: %w", err)
+	}
+
+	err = ioutil.WriteFile(r.path, raw, 0644)
+	if err != nil {
+		return fmt.Errorf("error writing cassette: %w", err)
+	}
+
+	return nil
+}
+
+// Now implements trace.Clock. While recording it is the wall clock; while
+// replaying it only advances as recorded events are played back.
+func (r *Recorder) Now() time.Time {
+	if r.mode == ModeRecord {
+		return time.Now()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.now.Add(r.elapsed)
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	if r.mode == ModeReplay {
+		return r.replay(req)
+	}
+	return r.record(req)
+}
+
+func (r *Recorder) record(req *http.Request) (*http.Response, error) {
+	recordedReq := Request{
+		Method: req.Method,
+		URL:    r.redactURL(req.URL.String()),
+		Header: r.redactHeader(req.Header),
+	}
+
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, fmt.Errorf("error reading request body: %w", err)
+		}
+		req.Body.Close()
+		recordedReq.Body = body
+
+		req = req.Clone(req.Context())
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	var eventsMu sync.Mutex
+	events := []Event{}
+	start := time.Now()
+	addEvent := func(e Event) {
+		eventsMu.Lock()
+		defer eventsMu.Unlock()
+		e.Offset = time.Since(start)
+		events = append(events, e)
+	}
+
+	hooks := &httptrace.ClientTrace{
+		GetConn: func(h string) {
+			addEvent(Event{Name: EventGetConn})
+		},
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			addEvent(Event{Name: EventDNSStart})
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			addEvent(Event{Name: EventDNSDone})
+		},
+		ConnectStart: func(network, addr string) {
+			addEvent(Event{Name: EventConnectStart, Network: network, Addr: addr})
+		},
+		ConnectDone: func(network, addr string, err error) {
+			addEvent(Event{Name: EventConnectDone, Network: network, Addr: addr})
+		},
+		TLSHandshakeStart: func() {
+			addEvent(Event{Name: EventTLSHandshakeStart})
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			addEvent(Event{Name: EventTLSHandshakeDone})
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			addEvent(Event{Name: EventGotConn, Reused: info.Reused})
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			addEvent(Event{Name: EventWroteRequest})
+		},
+		GotFirstResponseByte: func() {
+			addEvent(Event{Name: EventGotFirstResponseByte})
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), hooks))
+
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	interaction := &Interaction{
+		Request: recordedReq,
+		Response: Response{
+			Status:     resp.Status,
+			StatusCode: resp.StatusCode,
+			Proto:      resp.Proto,
+			Header:     r.redactHeader(resp.Header),
+		},
+	}
+
+	resp.Body = &recordingBody{
+		ReadCloser: resp.Body,
+		buf:        &bytes.Buffer{},
+		done: func(body []byte) {
+			addEvent(Event{Name: EventBodyDone})
+
+			eventsMu.Lock()
+			interaction.Events = events
+			eventsMu.Unlock()
+			interaction.Response.Body = body
+
+			r.mu.Lock()
+			r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+			r.mu.Unlock()
+		},
+	}
+
+	return resp, nil
+}
+
+func (r *Recorder) replay(req *http.Request) (*http.Response, error) {
+	matched := req
+	if r.redactor != nil {
+		u, err := url.Parse(r.redactURL(req.URL.String()))
+		if err == nil {
+			matched = req.WithContext(req.Context())
+			matched.URL = u
+		}
+	}
+
+	r.mu.Lock()
+	var interaction *Interaction
+	for i, candidate := range r.cassette.Interactions {
+		if r.used[i] || !r.matcher(matched, candidate.Request) {
+			continue
+		}
+		r.used[i] = true
+		interaction = candidate
+		break
+	}
+	base := r.elapsed
+	r.mu.Unlock()
+
+	if interaction == nil {
+		return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, req.Method, req.URL)
+	}
+
+	if req.Body != nil {
+		_, _ = io.Copy(ioutil.Discard, req.Body)
+		req.Body.Close()
+	}
+
+	hooks := httptrace.ContextClientTrace(req.Context())
+	if hooks == nil {
+		hooks = &httptrace.ClientTrace{}
+	}
+
+	fault := r.fault
+	if interaction.Fault != nil {
+		fault = fault.Merge(*interaction.Fault)
+	}
+	timeoutEvent := phaseStarts[fault.TimeoutPhase]
+
+	var bodyDone time.Duration
+	timedOut := false
+	for _, e := range interaction.Events {
+		if e.Name == EventBodyDone {
+			bodyDone = e.Offset
+			continue
+		}
+		r.advance(base + e.Offset)
+		fire(hooks, req, e)
+
+		if e.Name == timeoutEvent {
+			timedOut = true
+			break
+		}
+	}
+
+	if fault.TimeoutPhase != "" && !timedOut {
+		return nil, fmt.Errorf("cannot inject timeout: %s phase did not occur in the recorded interaction", fault.TimeoutPhase)
+	}
+	if timedOut && fault.TimeoutPhase != PhaseBody {
+		return nil, &TimeoutError{Phase: fault.TimeoutPhase}
+	}
+	if fault.MalformedHeader {
+		return nil, textproto.ProtocolError("malformed MIME header line: injected fault")
+	}
+
+	body := interaction.Response.Body
+	resp := &http.Response{
+		Status:        interaction.Response.Status,
+		StatusCode:    interaction.Response.StatusCode,
+		Proto:         interaction.Response.Proto,
+		Header:        interaction.Response.Header.Clone(),
+		ContentLength: int64(len(body)),
+		Request:       req,
+		Body: &replayBody{
+			Reader: bytes.NewReader(body),
+			done: func() {
+				r.advance(base + bodyDone)
+			},
+		},
+	}
+	if resp.Header == nil {
+		resp.Header = http.Header{}
+	}
+	resp.ProtoMajor, resp.ProtoMinor, _ = http.ParseHTTPVersion(resp.Proto)
+
+	if timedOut {
+		resp.Body = &faultyBody{ReadCloser: resp.Body, remaining: 0, err: &TimeoutError{Phase: PhaseBody}}
+	} else if fault.TruncateBody != nil {
+		resp.Body = &faultyBody{ReadCloser: resp.Body, remaining: *fault.TruncateBody, err: io.ErrUnexpectedEOF}
+	}
+
+	return resp, nil
+}
+
+// redactURL returns rawURL with the secrets of the Redactor masked, if any.
+func (r *Recorder) redactURL(rawURL string) string {
+	if r.redactor == nil {
+		return rawURL
+	}
+	return r.redactor.Redact(rawURL)
+}
+
+// redactHeader returns a copy of header with the secrets of the Redactor
+// masked, if any.
+func (r *Recorder) redactHeader(header http.Header) http.Header {
+	header = header.Clone()
+	if r.redactor == nil {
+		return header
+	}
+	for name, values := range header {
+		for i, v := range values {
+			values[i] = r.redactor.HeaderValue(name, v)
+		}
+	}
+	return header
+}
+
+// advance moves the replay clock forward to offset, never backwards.
+func (r *Recorder) advance(offset time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if offset > r.elapsed {
+		r.elapsed = offset
+	}
+}
+
+func fire(hooks *httptrace.ClientTrace, req *http.Request, e Event) {
+	switch e.Name {
+	case EventGetConn:
+		if hooks.GetConn != nil {
+			hooks.GetConn(req.URL.Host)
+		}
+	case EventDNSStart:
+		if hooks.DNSStart != nil {
+			hooks.DNSStart(httptrace.DNSStartInfo{Host: req.URL.Hostname()})
+		}
+	case EventDNSDone:
+		if hooks.DNSDone != nil {
+			hooks.DNSDone(httptrace.DNSDoneInfo{})
+		}
+	case EventConnectStart:
+		if hooks.ConnectStart != nil {
+			hooks.ConnectStart(e.Network, e.Addr)
+		}
+	case EventConnectDone:
+		if hooks.ConnectDone != nil {
+			hooks.ConnectDone(e.Network, e.Addr, nil)
+		}
+	case EventTLSHandshakeStart:
+		if hooks.TLSHandshakeStart != nil {
+			hooks.TLSHandshakeStart()
+		}
+	case EventTLSHandshakeDone:
+		if hooks.TLSHandshakeDone != nil {
+			hooks.TLSHandshakeDone(tls.ConnectionState{}, nil)
+		}
+	case EventGotConn:
+		if hooks.GotConn != nil {
+			hooks.GotConn(httptrace.GotConnInfo{Reused: e.Reused})
+		}
+	case EventWroteRequest:
+		if hooks.WroteRequest != nil {
+			hooks.WroteRequest(httptrace.WroteRequestInfo{})
+		}
+	case EventGotFirstResponseByte:
+		if hooks.GotFirstResponseByte != nil {
+			hooks.GotFirstResponseByte()
+		}
+	}
+}
+
+// recordingBody captures a response body as it is read, calling done once the
+// body has been fully consumed or closed.
+type recordingBody struct {
+	io.ReadCloser
+	buf  *bytes.Buffer
+	once sync.Once
+	done func(body []byte)
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	b.finish()
+	return b.ReadCloser.Close()
+}
+
+func (b *recordingBody) finish() {
+	b.once.Do(func() {
+		b.done(b.buf.Bytes())
+	})
+}
+
+// replayBody serves a recorded body, advancing the replay clock to the end of
+// the recorded read once it has been consumed.
+type replayBody struct {
+	*bytes.Reader
+	once sync.Once
+	done func()
+}
+
+func (b *replayBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	if err == io.EOF {
+		b.once.Do(b.done)
+	}
+	return n, err
+}
+
+func (b *replayBody) Close() error {
+	b.once.Do(b.done)
+	return nil
+}
@@ -0,0 +1,430 @@
+package cassette
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/berndhartzer/http-trace/report"
+	"github.com/berndhartzer/http-trace/trace"
+)
+
+func writeCassette(t *testing.T, c *Cassette) string {
+	t.Helper()
+
+	raw, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("Error encoding cassette: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	err = ioutil.WriteFile(path, raw, 0644)
+	if err != nil {
+		t.Fatalf("Error writing cassette: %v", err)
+	}
+
+	return path
+}
+
+type testReplay struct {
+	events   []Event
+	expected trace.Timings
+}
+
+func TestReplay(t *testing.T) {
+	ms := time.Millisecond
+
+	tests := map[string]testReplay{
+		"will reproduce the recorded timings of a new connection": {
+			events: []Event{
+				{Name: EventGetConn, Offset: 0},
+				{Name: EventDNSStart, Offset: 1 * ms},
+				{Name: EventDNSDone, Offset: 4 * ms},
+				{Name: EventConnectStart, Offset: 4 * ms, Network: "tcp", Addr: "10.0.0.1:443"},
+				{Name: EventConnectDone, Offset: 14 * ms, Network: "tcp", Addr: "10.0.0.1:443"},
+				{Name: EventTLSHandshakeStart, Offset: 14 * ms},
+				{Name: EventTLSHandshakeDone, Offset: 44 * ms},
+				{Name: EventGotConn, Offset: 45 * ms},
+				{Name: EventWroteRequest, Offset: 46 * ms},
+				{Name: EventGotFirstResponseByte, Offset: 146 * ms},
+				{Name: EventBodyDone, Offset: 150 * ms},
+			},
+			expected: trace.Timings{
+				DNSDuration:             3 * ms,
+				ConnectionDialDuration:  10 * ms,
+				TLSDuration:             30 * ms,
+				TotalConnectionDuration: 45 * ms,
+				RequestWriteDuration:    1 * ms,
+				ResponseDelayDuration:   100 * ms,
+				ResponseReadDuration:    4 * ms,
+				TotalRequestDuration:    150 * ms,
+			},
+		},
+		"will reproduce the recorded timings of a reused connection": {
+			events: []Event{
+				{Name: EventGetConn, Offset: 0},
+				{Name: EventGotConn, Offset: 0, Reused: true},
+				{Name: EventWroteRequest, Offset: 2 * ms},
+				{Name: EventGotFirstResponseByte, Offset: 52 * ms},
+				{Name: EventBodyDone, Offset: 60 * ms},
+			},
+			expected: trace.Timings{
+				RequestWriteDuration:  2 * ms,
+				ResponseDelayDuration: 50 * ms,
+				ResponseReadDuration:  8 * ms,
+				TotalRequestDuration:  60 * ms,
+			},
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			path := writeCassette(t, &Cassette{
+				Interactions: []*Interaction{
+					{
+						Request: Request{Method: http.MethodGet, URL: "https://thing.com/path"},
+						Response: Response{
+							Status:     "200 OK",
+							StatusCode: http.StatusOK,
+							Proto:      "HTTP/1.1",
+							Header:     http.Header{"Content-Type": {"text/plain"}},
+							Body:       []byte("hello"),
+						},
+						Events: cfg.events,
+					},
+				},
+			})
+
+			recorder, err := New(path, ModeReplay, nil)
+			if err != nil {
+				t.Fatalf("Error creating recorder: %v", err)
+			}
+
+			request, err := http.NewRequest(http.MethodGet, "https://thing.com/path", nil)
+			if err != nil {
+				t.Fatalf("Error creating http request: %v", err)
+			}
+
+			tracedRequest := trace.New(&http.Client{Transport: recorder}, request)
+			tracedRequest.SetClock(recorder)
+			err = tracedRequest.Execute()
+			if err != nil {
+				t.Fatalf("Error doing traced request: %v", err)
+			}
+
+			if tracedRequest.GetResponse().StatusCode != http.StatusOK {
+				t.Errorf("Unexpected http response status code: got %v, want %v", tracedRequest.GetResponse().StatusCode, http.StatusOK)
+			}
+
+			if tracedRequest.GetResponseBody() != "hello" {
+				t.Errorf("Unexpected http response body: got %v, want hello", tracedRequest.GetResponseBody())
+			}
+
+			got := tracedRequest.GetTimings()
+			checks := map[string][2]time.Duration{
+				"DNSDuration":             {got.DNSDuration, cfg.expected.DNSDuration},
+				"ConnectionDialDuration":  {got.ConnectionDialDuration, cfg.expected.ConnectionDialDuration},
+				"TLSDuration":             {got.TLSDuration, cfg.expected.TLSDuration},
+				"TotalConnectionDuration": {got.TotalConnectionDuration, cfg.expected.TotalConnectionDuration},
+				"RequestWriteDuration":    {got.RequestWriteDuration, cfg.expected.RequestWriteDuration},
+				"ResponseDelayDuration":   {got.ResponseDelayDuration, cfg.expected.ResponseDelayDuration},
+				"ResponseReadDuration":    {got.ResponseReadDuration, cfg.expected.ResponseReadDuration},
+				"TotalRequestDuration":    {got.TotalRequestDuration, cfg.expected.TotalRequestDuration},
+			}
+			for field, values := range checks {
+				if values[0] != values[1] {
+					t.Errorf("%s incorrect: got %v, want %v", field, values[0], values[1])
+				}
+			}
+		})
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.Header().Set("X-Recorded", "yes")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"created": true}`))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	recorder, err := New(path, ModeRecord, nil)
+	if err != nil {
+		t.Fatalf("Error creating recorder: %v", err)
+	}
+
+	request, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("name=thing"))
+	if err != nil {
+		t.Fatalf("Error creating http request: %v", err)
+	}
+
+	recorded := trace.New(&http.Client{Transport: recorder}, request)
+	err = recorded.Execute()
+	if err != nil {
+		t.Fatalf("Error doing traced request: %v", err)
+	}
+
+	err = recorder.Save()
+	if err != nil {
+		t.Fatalf("Error saving cassette: %v", err)
+	}
+
+	c, err := Load(path)
+	if err != nil {
+		t.Fatalf("Error loading cassette: %v", err)
+	}
+	if len(c.Interactions) != 1 {
+		t.Fatalf("Unexpected number of interactions: got %v, want 1", len(c.Interactions))
+	}
+	if string(c.Interactions[0].Request.Body) != "name=thing" {
+		t.Errorf("Unexpected recorded request body: got %v, want name=thing", string(c.Interactions[0].Request.Body))
+	}
+
+	replayTimings := []*trace.Timings{}
+	for i := 0; i < 2; i++ {
+		player, err := New(path, ModeReplay, nil)
+		if err != nil {
+			t.Fatalf("Error creating recorder: %v", err)
+		}
+
+		request, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("name=thing"))
+		if err != nil {
+			t.Fatalf("Error creating http request: %v", err)
+		}
+
+		replayed := trace.New(&http.Client{Transport: player}, request)
+		replayed.SetClock(player)
+		err = replayed.Execute()
+		if err != nil {
+			t.Fatalf("Error doing replayed request: %v", err)
+		}
+
+		if replayed.GetResponse().StatusCode != http.StatusCreated {
+			t.Errorf("Unexpected http response status code: got %v, want %v", replayed.GetResponse().StatusCode, http.StatusCreated)
+		}
+		if replayed.GetResponse().Header.Get("X-Recorded") != "yes" {
+			t.Errorf("Missing recorded response header")
+		}
+		if replayed.GetResponseBody() != recorded.GetResponseBody() {
+			t.Errorf("Unexpected http response body: got %v, want %v", replayed.GetResponseBody(), recorded.GetResponseBody())
+		}
+
+		replayTimings = append(replayTimings, replayed.GetTimings())
+	}
+
+	if *replayTimings[0] != *replayTimings[1] {
+		t.Errorf("Replayed timings are not deterministic: got %+v and %+v", replayTimings[0], replayTimings[1])
+	}
+
+	if replayTimings[0].ResponseDelayDuration < 50*time.Millisecond {
+		t.Errorf("Replayed ResponseDelayDuration too low: got %v, want at least 50ms", replayTimings[0].ResponseDelayDuration)
+	}
+}
+
+func TestRecordWithRedactor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=secret; Path=/")
+		w.Header().Set("Location", "/next?token=secret")
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	redactor := report.NewRedactor([]string{"token"}, []string{"Authorization", "Set-Cookie"})
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	recorder, err := New(path, ModeRecord, nil)
+	if err != nil {
+		t.Fatalf("Error creating recorder: %v", err)
+	}
+	recorder.SetRedactor(redactor)
+
+	request, err := http.NewRequest(http.MethodGet, server.URL+"/path?token=secret&page=2", nil)
+	if err != nil {
+		t.Fatalf("Error creating http request: %v", err)
+	}
+	request.Header.Set("Authorization", "Bearer secret")
+
+	resp, err := recorder.RoundTrip(request)
+	if err != nil {
+		t.Fatalf("Error doing http request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("Set-Cookie") != "session=secret; Path=/" {
+		t.Errorf("Unexpected live response header: got %v, want session=secret; Path=/", resp.Header.Get("Set-Cookie"))
+	}
+
+	err = recorder.Save()
+	if err != nil {
+		t.Fatalf("Error saving cassette: %v", err)
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Error reading cassette: %v", err)
+	}
+	if strings.Contains(string(raw), "secret") {
+		t.Errorf("Unexpected secret in cassette: %s", raw)
+	}
+
+	c, err := Load(path)
+	if err != nil {
+		t.Fatalf("Error loading cassette: %v", err)
+	}
+	recorded := c.Interactions[0]
+	if want := server.URL + "/path?token=REDACTED&page=2"; recorded.Request.URL != want {
+		t.Errorf("Unexpected recorded url: got %v, want %v", recorded.Request.URL, want)
+	}
+	if got := recorded.Request.Header.Get("Authorization"); got != "Bearer REDACTED" {
+		t.Errorf("Unexpected recorded request header: got %v, want Bearer REDACTED", got)
+	}
+	if got := recorded.Response.Header.Get("Set-Cookie"); got != "session=REDACTED; Path=/" {
+		t.Errorf("Unexpected recorded response header: got %v, want session=REDACTED; Path=/", got)
+	}
+	if got := recorded.Response.Header.Get("Location"); got != "/next?token=REDACTED" {
+		t.Errorf("Unexpected recorded response header: got %v, want /next?token=REDACTED", got)
+	}
+
+	player, err := New(path, ModeReplay, nil)
+	if err != nil {
+		t.Fatalf("Error creating recorder: %v", err)
+	}
+	player.SetRedactor(redactor)
+
+	replayed, err := player.RoundTrip(request)
+	if err != nil {
+		t.Fatalf("Error replaying redacted request: %v", err)
+	}
+	replayed.Body.Close()
+	if request.URL.Query().Get("token") != "secret" {
+		t.Errorf("Unexpected change to the replayed request: got %v", request.URL)
+	}
+}
+
+func TestReplayWithoutMatchingInteraction(t *testing.T) {
+	path := writeCassette(t, &Cassette{})
+
+	player, err := New(path, ModeReplay, nil)
+	if err != nil {
+		t.Fatalf("Error creating recorder: %v", err)
+	}
+
+	request, err := http.NewRequest(http.MethodGet, "https://thing.com", nil)
+	if err != nil {
+		t.Fatalf("Error creating http request: %v", err)
+	}
+
+	_, err = player.RoundTrip(request)
+	if !errors.Is(err, ErrNoInteraction) {
+		t.Errorf("Unexpected error: got %v, want %v", err, ErrNoInteraction)
+	}
+}
+
+type testReplayFault struct {
+	fault                string
+	expectedRequestError string
+	expectedBodyError    string
+	expectedBody         string
+}
+
+func TestReplayWithFault(t *testing.T) {
+	ms := time.Millisecond
+	events := []Event{
+		{Name: EventGetConn, Offset: 0},
+		{Name: EventDNSStart, Offset: 1 * ms},
+		{Name: EventDNSDone, Offset: 4 * ms},
+		{Name: EventConnectStart, Offset: 4 * ms},
+		{Name: EventConnectDone, Offset: 14 * ms},
+		{Name: EventGotConn, Offset: 15 * ms},
+		{Name: EventWroteRequest, Offset: 16 * ms},
+		{Name: EventGotFirstResponseByte, Offset: 116 * ms},
+		{Name: EventBodyDone, Offset: 120 * ms},
+	}
+
+	tests := map[string]testReplayFault{
+		"will time out during connect": {
+			fault:                "timeout:connect",
+			expectedRequestError: "injected timeout during connect phase",
+		},
+		"will time out while waiting for the response": {
+			fault:                "timeout:response",
+			expectedRequestError: "injected timeout during response phase",
+		},
+		"will time out while reading the body": {
+			fault:             "timeout:body",
+			expectedBodyError: "error reading response body after 0 bytes: injected timeout during body phase",
+		},
+		"will fail when the phase was not recorded": {
+			fault:                "timeout:tls",
+			expectedRequestError: "cannot inject timeout: tls phase did not occur in the recorded interaction",
+		},
+		"will truncate the body": {
+			fault:             "truncate-body:3",
+			expectedBodyError: "error reading response body after 3 bytes: unexpected EOF",
+			expectedBody:      "hel",
+		},
+		"will fail on a malformed header": {
+			fault:                "malformed-header",
+			expectedRequestError: "malformed MIME header line",
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			path := writeCassette(t, &Cassette{
+				Interactions: []*Interaction{
+					{
+						Request:  Request{Method: http.MethodGet, URL: "https://thing.com"},
+						Response: Response{Status: "200 OK", StatusCode: http.StatusOK, Proto: "HTTP/1.1", Body: []byte("hello")},
+						Events:   events,
+					},
+				},
+			})
+
+			fault, err := ParseFault(cfg.fault)
+			if err != nil {
+				t.Fatalf("Error parsing fault: %v", err)
+			}
+
+			player, err := New(path, ModeReplay, nil)
+			if err != nil {
+				t.Fatalf("Error creating recorder: %v", err)
+			}
+			player.SetFault(fault)
+
+			request, err := http.NewRequest(http.MethodGet, "https://thing.com", nil)
+			if err != nil {
+				t.Fatalf("Error creating http request: %v", err)
+			}
+
+			tracedRequest := trace.New(&http.Client{Transport: player}, request)
+			tracedRequest.SetClock(player)
+			err = tracedRequest.Execute()
+
+			if cfg.expectedRequestError != "" {
+				if err == nil || !strings.Contains(err.Error(), cfg.expectedRequestError) {
+					t.Errorf("Unexpected request error: got %v, want %v", err, cfg.expectedRequestError)
+				}
+				return
+			}
+			var bodyErr *trace.BodyReadError
+			if !errors.As(err, &bodyErr) || bodyErr.Error() != cfg.expectedBodyError {
+				t.Fatalf("Unexpected body error: got %v, want %v", err, cfg.expectedBodyError)
+			}
+
+			if tracedRequest.GetResponse() == nil || tracedRequest.GetResponseBody() != cfg.expectedBody {
+				t.Errorf("Unexpected http response body: got %q, want %q", tracedRequest.GetResponseBody(), cfg.expectedBody)
+			}
+		})
+	}
+}
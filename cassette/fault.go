@@ -0,0 +1,119 @@
+package cassette
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Phases of a request in which a timeout can be injected.
+const (
+	PhaseDNS      = "dns"
+	PhaseConnect  = "connect"
+	PhaseTLS      = "tls"
+	PhaseWrite    = "write"
+	PhaseResponse = "response"
+	PhaseBody     = "body"
+)
+
+// phaseStarts maps each phase to the event which begins it.
+var phaseStarts = map[string]string{
+	PhaseDNS:      EventDNSStart,
+	PhaseConnect:  EventConnectStart,
+	PhaseTLS:      EventTLSHandshakeStart,
+	PhaseWrite:    EventGotConn,
+	PhaseResponse: EventWroteRequest,
+	PhaseBody:     EventGotFirstResponseByte,
+}
+
+// Fault describes a synthetic failure to inject while replaying an
+// interaction, so failure handling can be exercised without a failing server.
+type Fault struct {
+	TimeoutPhase    string `json:"timeout_phase,omitempty"`    // Phase in which the request times out
+	TruncateBody    *int64 `json:"truncate_body,omitempty"`    // Number of body bytes served before the body ends unexpectedly
+	MalformedHeader bool   `json:"malformed_header,omitempty"` // Fail as if a malformed response header was received
+}
+
+// ParseFault parses a fault specification, one of "timeout:<phase>",
+// "truncate-body:<bytes>" or "malformed-header".
+func ParseFault(spec string) (Fault, error) {
+	name, value := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		name, value = spec[:i], spec[i+1:]
+	}
+
+	switch name {
+	case "timeout":
+		if _, ok := phaseStarts[value]; !ok {
+			return Fault{}, fmt.Errorf("unknown fault phase %q, expected one of dns, connect, tls, write, response or body", value)
+		}
+		return Fault{TimeoutPhase: value}, nil
+	case "truncate-body":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 {
+			return Fault{}, fmt.Errorf("invalid truncate-body size %q", value)
+		}
+		return Fault{TruncateBody: &n}, nil
+	case "malformed-header":
+		return Fault{MalformedHeader: true}, nil
+	}
+
+	return Fault{}, fmt.Errorf("unknown fault %q", spec)
+}
+
+// Merge returns f with any fields set in other applied on top.
+func (f Fault) Merge(other Fault) Fault {
+	if other.TimeoutPhase != "" {
+		f.TimeoutPhase = other.TimeoutPhase
+	}
+	if other.TruncateBody != nil {
+		f.TruncateBody = other.TruncateBody
+	}
+	if other.MalformedHeader {
+		f.MalformedHeader = true
+	}
+	return f
+}
+
+// TimeoutError is returned when a timeout fault is injected. Like the errors
+// returned by net/http on a real timeout it implements net.Error.
+type TimeoutError struct {
+	Phase string
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("injected timeout during %s phase", e.Phase)
+}
+
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+func (e *TimeoutError) Temporary() bool {
+	return true
+}
+
+// faultyBody ends a replayed body early, either with a timeout or an
+// unexpected EOF.
+type faultyBody struct {
+	io.ReadCloser
+	remaining int64
+	err       error
+}
+
+func (b *faultyBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, b.err
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if err == io.EOF {
+		err = b.err
+	}
+	return n, err
+}
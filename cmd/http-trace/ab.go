@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/berndhartzer/http-trace/report"
+)
+
+// abTest alternates a request header between two values to compare how the
+// server performs with each.
+type abTest struct {
+	header string
+	a, b   *report.Variant
+}
+
+// parseABHeader parses an -ab-header value such as "X-Feature: on|off".
+func parseABHeader(spec string) (*abTest, error) {
+	split := strings.SplitN(spec, ":", 2)
+	if len(split) != 2 {
+		return nil, fmt.Errorf("invalid -ab-header %q, expected 'Header: a|b'", spec)
+	}
+
+	header := strings.TrimSpace(split[0])
+	values := strings.Split(split[1], "|")
+	if header == "" || len(values) != 2 {
+		return nil, fmt.Errorf("invalid -ab-header %q, expected 'Header: a|b'", spec)
+	}
+
+	return &abTest{
+		header: header,
+		a:      &report.Variant{Value: strings.TrimSpace(values[0])},
+		b:      &report.Variant{Value: strings.TrimSpace(values[1])},
+	}, nil
+}
+
+// pair returns the variants in the order to send them for the i-th pair of
+// requests. The order alternates so neither variant consistently benefits
+// from going first, such as by finding a warm connection or cache.
+func (ab *abTest) pair(i int) []*report.Variant {
+	if i%2 == 1 {
+		return []*report.Variant{ab.b, ab.a}
+	}
+	return []*report.Variant{ab.a, ab.b}
+}
+
+// headers returns base with the header under test set to the variant's value.
+func (ab *abTest) headers(base []string, v *report.Variant) []string {
+	return append(append([]string{}, base...), ab.header+": "+v.Value)
+}
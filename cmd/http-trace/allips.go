@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/berndhartzer/http-trace/report"
+)
+
+// resolveAllIPs resolves host with resolver, or the default one if it is
+// nil, and returns a client for each of its addresses, connecting only to
+// that address with a transport of its own cloned from transport. The url of
+// a request is left as it is, so the Host header and TLS server name are
+// those of the host, as with -connect-to. The addresses are listed on out,
+// with the time resolving took in format.
+func resolveAllIPs(host string, client *http.Client, transport *http.Transport, resolver *net.Resolver, format report.TimeFormat, out io.Writer) ([]*http.Client, []string, error) {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	ctx := context.Background()
+	if client.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, client.Timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error resolving %s for -all-ips: %w", host, err)
+	}
+	fmt.Fprintf(out, "%d addresses of %s, resolved in %s:\n", len(addrs), host, format.Duration(time.Since(start)))
+
+	clients := []*http.Client{}
+	ips := []string{}
+	for _, addr := range addrs {
+		ip := addr.String()
+		fmt.Fprintf(out, "  %s\n", ip)
+
+		// A transport of its own, so no connection to another address is
+		// taken from the pool
+		pinned := transport.Clone()
+		pinned.DialContext = dialConnectTo([]connectRule{{host: host, toHost: ip}}, transport.DialContext)
+		pinnedClient := *client
+		pinnedClient.Transport = pinned
+		clients = append(clients, &pinnedClient)
+		ips = append(ips, ip)
+	}
+	return clients, ips, nil
+}
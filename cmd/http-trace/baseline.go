@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/berndhartzer/http-trace/report"
+)
+
+// saveBaseline writes the timings of a run to path as JSON lines, to be
+// compared against later with -compare-baseline. Bodies, headers and events
+// are left out as only the timings are compared.
+func saveBaseline(path string, target *report.Target) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating baseline: %w", err)
+	}
+	defer f.Close()
+
+	for _, result := range target.Results {
+		saved := *result
+		saved.Body = ""
+		saved.BodyEncoding = ""
+		saved.BodyTruncated = 0
+		saved.ResponseHeaders = nil
+		saved.Events = nil
+		saved.Mirror = nil
+		saved.PipedTo = nil
+		err = report.WriteJSONLine(f, &saved)
+		if err != nil {
+			return fmt.Errorf("error writing baseline: %w", err)
+		}
+	}
+
+	return f.Close()
+}
+
+// compareBaseline writes how the timings of current compare against those
+// saved to path with -save-baseline, and returns the exit code of the
+// comparison: exitFailed if any phase is more than threshold slower, or 0.
+func compareBaseline(w io.Writer, path string, current *report.Target, threshold float64, pres *report.Presentation) (int, error) {
+	base, err := loadTarget(path)
+	if err != nil {
+		return 0, err
+	}
+
+	regressed, err := report.WriteDiff(w, base, current, threshold, pres)
+	if err != nil {
+		return 0, err
+	}
+	if regressed {
+		return exitFailed, nil
+	}
+	return 0, nil
+}
+
+// parseRegressionThreshold parses a -regression-threshold percentage such as
+// 10%.
+func parseRegressionThreshold(spec string) (float64, error) {
+	threshold, err := strconv.ParseFloat(strings.TrimSuffix(spec, "%"), 64)
+	if err != nil || threshold < 0 {
+		return 0, fmt.Errorf("invalid -regression-threshold %q, expected a percentage such as 10%%", spec)
+	}
+	return threshold / 100, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/berndhartzer/http-trace/report"
+)
+
+func baselineTarget(total float64) *report.Target {
+	target := &report.Target{URL: "https://thing.com"}
+	for i := 0; i < 3; i++ {
+		target.Results = append(target.Results, &report.Result{
+			URL:             "https://thing.com",
+			Method:          http.MethodGet,
+			Status:          http.StatusOK,
+			Body:            "hello",
+			ResponseHeaders: http.Header{"Content-Type": {"text/plain"}},
+			Events:          []report.Event{{Name: "GotConn"}},
+			Timings:         map[string]float64{"dns": 0.01, "connect": 0.02, "total": total},
+		})
+	}
+	return target
+}
+
+func TestSaveBaseline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "baseline.jsonl")
+	target := baselineTarget(0.2)
+
+	err := saveBaseline(path, target)
+	if err != nil {
+		t.Fatalf("Error saving baseline: %v", err)
+	}
+
+	saved, err := loadTarget(path)
+	if err != nil {
+		t.Fatalf("Error loading baseline: %v", err)
+	}
+	if len(saved.Results) != len(target.Results) {
+		t.Fatalf("Unexpected number of results: got %d, want %d", len(saved.Results), len(target.Results))
+	}
+	for i, result := range saved.Results {
+		if !reflect.DeepEqual(result.Timings, target.Results[i].Timings) {
+			t.Errorf("Unexpected timings: got %v, want %v", result.Timings, target.Results[i].Timings)
+		}
+		if result.Status != http.StatusOK || result.URL != "https://thing.com" {
+			t.Errorf("Unexpected result: got %d %s, want %d https://thing.com", result.Status, result.URL, http.StatusOK)
+		}
+		if result.Body != "" || result.ResponseHeaders != nil || result.Events != nil {
+			t.Errorf("Unexpected body, headers or events saved: got %q %v %v", result.Body, result.ResponseHeaders, result.Events)
+		}
+	}
+	if target.Results[0].Body != "hello" {
+		t.Errorf("Unexpected change to the results of the run: got body %q, want hello", target.Results[0].Body)
+	}
+}
+
+func TestCompareBaseline(t *testing.T) {
+	type testCompareBaseline struct {
+		total         float64
+		expectedExit  int
+		expectedLines []string
+	}
+
+	tests := map[string]testCompareBaseline{
+		"will exit with an error for a regression": {
+			total:         0.3,
+			expectedExit:  exitFailed,
+			expectedLines: []string{"! regression", "! B regressed by more than 10% in at least one phase"},
+		},
+		"will not fail for a change within the threshold": {
+			total:        0.21,
+			expectedExit: 0,
+		},
+		"will not fail for an improvement": {
+			total:        0.1,
+			expectedExit: 0,
+		},
+	}
+
+	path := filepath.Join(t.TempDir(), "baseline.jsonl")
+	err := saveBaseline(path, baselineTarget(0.2))
+	if err != nil {
+		t.Fatalf("Error saving baseline: %v", err)
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			exit, err := compareBaseline(out, path, baselineTarget(cfg.total), 0.1, nil)
+			if err != nil {
+				t.Fatalf("Error comparing baseline: %v", err)
+			}
+			if exit != cfg.expectedExit {
+				t.Errorf("Unexpected exit code: got %d, want %d", exit, cfg.expectedExit)
+			}
+			for _, line := range cfg.expectedLines {
+				if !strings.Contains(out.String(), line) {
+					t.Errorf("Missing %q in comparison:\n%s", line, out.String())
+				}
+			}
+			if cfg.expectedExit == 0 && strings.Contains(out.String(), "regress") {
+				t.Errorf("Unexpected regression in comparison:\n%s", out.String())
+			}
+		})
+	}
+}
+
+func TestCompareBaselineWithoutBaseline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.jsonl")
+	_, err := compareBaseline(&bytes.Buffer{}, path, baselineTarget(0.2), 0.1, nil)
+	if err == nil || !strings.HasPrefix(err.Error(), "error opening results: ") {
+		t.Errorf("Unexpected error: got %v, want an error opening the baseline", err)
+	}
+}
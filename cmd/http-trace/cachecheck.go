@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/berndhartzer/http-trace/report"
+	"github.com/berndhartzer/http-trace/trace"
+)
+
+// checkCache checks cache validation: it sends target, then sends it again
+// conditionally with If-None-Match and If-Modified-Since taken from the ETag
+// and Last-Modified of the response, as a cache revalidating it would, and
+// reports whether the server answered with 304 Not Modified and how much
+// faster that was.
+func checkCache(transport *http.Transport, timeout time.Duration, target request, redact *report.Redactor, format report.TimeFormat, out io.Writer) error {
+	client := &http.Client{Timeout: timeout, Transport: transport}
+
+	send := func(headers []string) (*report.CacheResponse, error) {
+		req, err := http.NewRequest(target.method, target.url, strings.NewReader(target.body))
+		if err != nil {
+			return nil, err
+		}
+		tracedRequest := trace.New(client, req)
+		err = tracedRequest.SetHeaders(headers)
+		if err != nil {
+			return nil, err
+		}
+		tracedRequest.SetMaxBodyCapture(0)
+		err = tracedRequest.Execute()
+		if err != nil {
+			return nil, err
+		}
+		return &report.CacheResponse{
+			Response: tracedRequest.GetResponse(),
+			Timings:  tracedRequest.GetTimings(),
+			BodySize: tracedRequest.GetResponseBodySize(),
+		}, nil
+	}
+
+	check := &report.CacheCheck{URL: redact.Redact(target.url)}
+	var err error
+	check.Initial, err = send(target.headers)
+	if err != nil {
+		return err
+	}
+	if check.Initial.Response.StatusCode != http.StatusOK {
+		return fmt.Errorf("cache validation needs a 200 OK response to revalidate, %s was answered with %s", check.URL, check.Initial.Response.Status)
+	}
+
+	check.Validators = conditionalHeaders(check.Initial.Response.Header)
+	if len(check.Validators) > 0 {
+		check.Conditional, err = send(append(append([]string{}, target.headers...), check.Validators...))
+		if err != nil {
+			return err
+		}
+	}
+	return report.WriteCacheCheck(out, check, &report.Presentation{TimeFormat: format})
+}
+
+// conditionalHeaders returns the headers revalidating a response with the
+// validators of header: If-None-Match with its ETag and If-Modified-Since with
+// its Last-Modified.
+func conditionalHeaders(header http.Header) []string {
+	validators := []string{}
+	if etag := header.Get("ETag"); etag != "" {
+		validators = append(validators, "If-None-Match: "+etag)
+	}
+	if lastModified := header.Get("Last-Modified"); lastModified != "" {
+		validators = append(validators, "If-Modified-Since: "+lastModified)
+	}
+	return validators
+}
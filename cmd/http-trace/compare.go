@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/berndhartzer/http-trace/report"
+)
+
+// isResultFile reports whether arg to compare names an existing file of
+// saved results rather than a URL to request.
+func isResultFile(arg string) bool {
+	info, err := os.Stat(arg)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// loadTarget reads the results saved with -output json or jsonl in path.
+func loadTarget(path string) (*report.Target, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening results: %w", err)
+	}
+	defer f.Close()
+
+	results, err := report.ReadResults(f)
+	if err != nil {
+		return nil, fmt.Errorf("error in %s: %w", path, err)
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("no results in %s", path)
+	}
+	return &report.Target{URL: path, Results: results}, nil
+}
+
+// compareResultFiles compares two saved runs and writes the differences to
+// stdout, flagging phases more than threshold slower in the second.
+func compareResultFiles(pathA, pathB string, threshold float64, pres *report.Presentation) error {
+	a, err := loadTarget(pathA)
+	if err != nil {
+		return err
+	}
+	b, err := loadTarget(pathB)
+	if err != nil {
+		return err
+	}
+
+	_, err = report.WriteDiff(os.Stdout, a, b, threshold, pres)
+	return err
+}
+
+// compareRunFiles tests two saved runs for regressions and writes the outcome
+// to stdout, returning an error if the second regressed significantly.
+func compareRunFiles(pathA, pathB string, threshold float64, pres *report.Presentation) error {
+	a, err := loadTarget(pathA)
+	if err != nil {
+		return err
+	}
+	b, err := loadTarget(pathB)
+	if err != nil {
+		return err
+	}
+
+	regressed, err := report.WriteRunComparison(os.Stdout, a, b, threshold, pres)
+	if err != nil {
+		return err
+	}
+	if regressed {
+		return fmt.Errorf("%s regressed against %s", pathB, pathA)
+	}
+	return nil
+}
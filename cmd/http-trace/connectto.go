@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// connectRule is a -connect-to rule, which sends connections for host and
+// port to toHost and toPort instead, as curl's --connect-to does. The URL is
+// left as it is, so the Host header and TLS server name are those of the
+// original host. An empty host or port matches any, and an empty toHost or
+// toPort keeps that of the URL.
+type connectRule struct {
+	spec   string
+	host   string
+	port   string
+	toHost string
+	toPort string
+}
+
+// parseConnectRule parses a rule in the form HOST1:PORT1:HOST2:PORT2, where
+// IPv6 addresses are in brackets, such as example.com:443:[::1]:8443.
+func parseConnectRule(spec string) (connectRule, error) {
+	fields := splitConnectRule(spec)
+	if len(fields) != 4 {
+		return connectRule{}, fmt.Errorf("invalid -connect-to %q, expected host:port:target:port", spec)
+	}
+	for i, field := range fields {
+		fields[i] = strings.TrimSuffix(strings.TrimPrefix(field, "["), "]")
+	}
+	return connectRule{spec: spec, host: fields[0], port: fields[1], toHost: fields[2], toPort: fields[3]}, nil
+}
+
+// splitConnectRule splits spec on the colons which are not within brackets.
+func splitConnectRule(spec string) []string {
+	fields := []string{}
+	start := 0
+	inBrackets := false
+	for i, r := range spec {
+		switch {
+		case r == '[':
+			inBrackets = true
+		case r == ']':
+			inBrackets = false
+		case r == ':' && !inBrackets:
+			fields = append(fields, spec[start:i])
+			start = i + 1
+		}
+	}
+	return append(fields, spec[start:])
+}
+
+// target returns the address to connect to instead of host and port, and
+// whether the rule applies to them.
+func (c connectRule) target(host, port string) (string, bool) {
+	if (c.host != "" && !strings.EqualFold(c.host, host)) || (c.port != "" && c.port != port) {
+		return "", false
+	}
+
+	toHost, toPort := c.toHost, c.toPort
+	if toHost == "" {
+		toHost = host
+	}
+	if toPort == "" {
+		toPort = port
+	}
+	return net.JoinHostPort(toHost, toPort), true
+}
+
+// dialConnectTo wraps dial so connections are made to the target of the first
+// of rules which applies to the address.
+func dialConnectTo(rules []connectRule, dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return dial(ctx, network, addr)
+		}
+
+		for _, rule := range rules {
+			if target, ok := rule.target(host, port); ok {
+				return dial(ctx, network, target)
+			}
+		}
+		return dial(ctx, network, addr)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseConnectRule(t *testing.T) {
+	type testConnectRule struct {
+		spec          string
+		expected      connectRule
+		expectedError string
+	}
+
+	tests := map[string]testConnectRule{
+		"will parse a rule": {
+			spec:     "thing.com:443:127.0.0.1:8443",
+			expected: connectRule{host: "thing.com", port: "443", toHost: "127.0.0.1", toPort: "8443"},
+		},
+		"will parse empty parts": {
+			spec:     "::backend.internal:",
+			expected: connectRule{toHost: "backend.internal"},
+		},
+		"will parse IPv6 addresses in brackets": {
+			spec:     "[2001:db8::1]:443:[::1]:8443",
+			expected: connectRule{host: "2001:db8::1", port: "443", toHost: "::1", toPort: "8443"},
+		},
+		"will fail for too few parts": {
+			spec:          "thing.com:443:127.0.0.1",
+			expectedError: `invalid -connect-to "thing.com:443:127.0.0.1", expected host:port:target:port`,
+		},
+		"will fail for too many parts": {
+			spec:          "thing.com:443:127.0.0.1:8443:1",
+			expectedError: `invalid -connect-to "thing.com:443:127.0.0.1:8443:1", expected host:port:target:port`,
+		},
+		"will fail for an IPv6 address without brackets": {
+			spec:          "thing.com:443:::1:8443",
+			expectedError: `invalid -connect-to "thing.com:443:::1:8443", expected host:port:target:port`,
+		},
+		"will fail for an empty rule": {
+			spec:          "",
+			expectedError: `invalid -connect-to "", expected host:port:target:port`,
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			rule, err := parseConnectRule(cfg.spec)
+			if cfg.expectedError != "" {
+				if err == nil || err.Error() != cfg.expectedError {
+					t.Errorf("Unexpected error: got %v, want %q", err, cfg.expectedError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Error parsing rule: %v", err)
+			}
+			cfg.expected.spec = cfg.spec
+			if rule != cfg.expected {
+				t.Errorf("Unexpected rule: got %+v, want %+v", rule, cfg.expected)
+			}
+		})
+	}
+}
+
+func TestConnectRuleTarget(t *testing.T) {
+	type testTarget struct {
+		spec     string
+		host     string
+		port     string
+		expected string
+	}
+
+	tests := map[string]testTarget{
+		"will connect to the target": {
+			spec:     "thing.com:443:127.0.0.1:8443",
+			host:     "thing.com",
+			port:     "443",
+			expected: "127.0.0.1:8443",
+		},
+		"will match the host regardless of case": {
+			spec:     "Thing.com:443:127.0.0.1:8443",
+			host:     "thing.COM",
+			port:     "443",
+			expected: "127.0.0.1:8443",
+		},
+		"will keep the host and port of the URL for empty parts": {
+			spec:     "::[::1]:",
+			host:     "thing.com",
+			port:     "80",
+			expected: "[::1]:80",
+		},
+		"will not apply to another host": {
+			spec: "thing.com:443:127.0.0.1:8443",
+			host: "other.com",
+			port: "443",
+		},
+		"will not apply to another port": {
+			spec: "thing.com:443:127.0.0.1:8443",
+			host: "thing.com",
+			port: "80",
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			rule, err := parseConnectRule(cfg.spec)
+			if err != nil {
+				t.Fatalf("Error parsing rule: %v", err)
+			}
+			target, ok := rule.target(cfg.host, cfg.port)
+			if ok != (cfg.expected != "") || target != cfg.expected {
+				t.Errorf("Unexpected target: got %q, %v, want %q", target, ok, cfg.expected)
+			}
+		})
+	}
+}
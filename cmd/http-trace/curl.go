@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/berndhartzer/http-trace/report"
+)
+
+// curlCommand builds the curl command sending the same request as target
+// does through a transport configured with cfg, with the same timeout. The
+// parameters of the url and the values of the headers redacted by redact are
+// masked, and a body read from a file is sent from the file rather than
+// inline.
+func curlCommand(target request, cfg *transportConfig, timeout int, redact *report.Redactor) string {
+	args := []string{"curl"}
+
+	keyLogFile := cfg.keyLogFile
+	if keyLogFile == "" {
+		keyLogFile = os.Getenv("SSLKEYLOGFILE")
+	}
+	if keyLogFile != "" {
+		args = append([]string{"SSLKEYLOGFILE=" + shellQuote(keyLogFile)}, args...)
+	}
+
+	switch {
+	case target.method == http.MethodHead:
+		args = append(args, "--head")
+	case target.method != http.MethodGet && !(target.method == http.MethodPost && target.body != ""):
+		args = append(args, "-X", shellQuote(target.method))
+	}
+
+	for _, h := range target.headers {
+		split := strings.SplitN(h, ":", 2)
+		name := strings.TrimSpace(split[0])
+		args = append(args, "-H", shellQuote(name+": "+redact.HeaderValue(name, strings.TrimSpace(split[1]))))
+	}
+	if !hasHeader(target.headers, "Accept") {
+		// curl would otherwise send Accept: */*, which Go doesn't
+		args = append(args, "-H", shellQuote("Accept:"))
+	}
+	if !hasHeader(target.headers, "Accept-Encoding") {
+		// Go asks for gzip and decodes it, unless the header is set
+		args = append(args, "-H", shellQuote("Accept-Encoding: gzip"), "--compressed")
+	}
+	if target.body != "" {
+		if !hasHeader(target.headers, "Content-Type") {
+			// curl would otherwise send a form Content-Type, which Go doesn't
+			args = append(args, "-H", shellQuote("Content-Type:"))
+		}
+		if target.file != "" {
+			args = append(args, "--data-binary", shellQuote("@"+target.file))
+		} else {
+			args = append(args, "--data-raw", shellQuote(target.body))
+		}
+	}
+
+	if cfg.unixSocket != "" {
+		args = append(args, "--unix-socket", shellQuote(cfg.unixSocket))
+	}
+	for _, rule := range cfg.connectTo {
+		args = append(args, "--connect-to", shellQuote(rule.spec))
+	}
+	if cfg.maxIdleConns == 0 {
+		args = append(args, "-H", shellQuote("Connection: close"))
+	}
+	args = append(args, "--max-time", strconv.Itoa(timeout))
+
+	return strings.Join(append(args, shellQuote(redact.Redact(target.url))), " ")
+}
+
+// shellQuote quotes s for a POSIX shell, unless it is made only of
+// characters which don't need quoting.
+func shellQuote(s string) string {
+	safe := s != ""
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_./:=@,+%", c)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/berndhartzer/http-trace/report"
+)
+
+func TestShellQuote(t *testing.T) {
+	type testShellQuote struct {
+		s        string
+		expected string
+	}
+
+	tests := map[string]testShellQuote{
+		"will leave safe characters": {
+			s:        "user@thing.com:8080/a_b-c/d,e+f%20=g",
+			expected: "user@thing.com:8080/a_b-c/d,e+f%20=g",
+		},
+		"will quote spaces": {
+			s:        "Accept-Encoding: gzip",
+			expected: "'Accept-Encoding: gzip'",
+		},
+		"will quote glob characters": {
+			s:        "https://thing.com/?a=1",
+			expected: "'https://thing.com/?a=1'",
+		},
+		"will quote shell characters": {
+			s:        "a&b;$(c)",
+			expected: "'a&b;$(c)'",
+		},
+		"will escape single quotes": {
+			s:        "it's",
+			expected: `'it'\''s'`,
+		},
+		"will quote an empty string": {
+			s:        "",
+			expected: "''",
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			got := shellQuote(cfg.s)
+			if got != cfg.expected {
+				t.Errorf("Unexpected quoting: got %s, want %s", got, cfg.expected)
+			}
+		})
+	}
+}
+
+func TestCurlCommand(t *testing.T) {
+	type testCurlCommand struct {
+		target   request
+		cfg      *transportConfig
+		expected string
+	}
+
+	const defaults = "-H Accept: -H 'Accept-Encoding: gzip' --compressed"
+
+	tests := map[string]testCurlCommand{
+		"will send a GET without a method": {
+			target:   request{method: http.MethodGet, url: "https://thing.com/path"},
+			expected: "curl " + defaults + " --max-time 10 https://thing.com/path",
+		},
+		"will send a POST with a body without a method": {
+			target:   request{method: http.MethodPost, url: "https://thing.com/", headers: []string{"Content-Type: application/json"}, body: `{"name": "it's"}`},
+			expected: "curl -H 'Content-Type: application/json' " + defaults + ` --data-raw '{"name": "it'\''s"}' --max-time 10 https://thing.com/`,
+		},
+		"will clear the Content-Type curl would add to a body": {
+			target:   request{method: http.MethodPost, url: "https://thing.com/", body: "a=1"},
+			expected: "curl " + defaults + " -H Content-Type: --data-raw a=1 --max-time 10 https://thing.com/",
+		},
+		"will set the method of a POST without a body": {
+			target:   request{method: http.MethodPost, url: "https://thing.com/"},
+			expected: "curl -X POST " + defaults + " --max-time 10 https://thing.com/",
+		},
+		"will set another method": {
+			target:   request{method: http.MethodPut, url: "https://thing.com/", body: "a=1"},
+			expected: "curl -X PUT " + defaults + " -H Content-Type: --data-raw a=1 --max-time 10 https://thing.com/",
+		},
+		"will send a HEAD with --head": {
+			target:   request{method: http.MethodHead, url: "https://thing.com/"},
+			expected: "curl --head " + defaults + " --max-time 10 https://thing.com/",
+		},
+		"will send a -data-binary file from the file": {
+			target:   request{method: http.MethodPost, url: "https://thing.com/upload", headers: []string{"Content-Type: image/png"}, body: "\x89PNG\r\n", binary: true, file: "my image.png"},
+			expected: "curl -H 'Content-Type: image/png' " + defaults + " --data-binary '@my image.png' --max-time 10 https://thing.com/upload",
+		},
+		"will send -data-binary from stdin": {
+			target:   request{method: http.MethodPost, url: "https://thing.com/upload", headers: []string{"Content-Type: text/plain"}, body: "hello", binary: true, file: "-"},
+			expected: "curl -H 'Content-Type: text/plain' " + defaults + " --data-binary @- --max-time 10 https://thing.com/upload",
+		},
+		"will mask redacted headers": {
+			target:   request{method: http.MethodGet, url: "https://thing.com/", headers: []string{"Authorization: Bearer secret", "X-Trace: on"}},
+			expected: "curl -H 'Authorization: Bearer REDACTED' -H 'X-Trace: on' " + defaults + " --max-time 10 https://thing.com/",
+		},
+		"will redact the url": {
+			target:   request{method: http.MethodGet, url: "https://thing.com/?token=secret&page=2"},
+			expected: "curl " + defaults + " --max-time 10 'https://thing.com/?token=REDACTED&page=2'",
+		},
+		"will keep the connection options": {
+			target:   request{method: http.MethodGet, url: "http://thing.com/"},
+			cfg:      &transportConfig{unixSocket: "/run/thing.sock", keyLogFile: "/tmp/keys", connectTo: []connectRule{{spec: "thing.com:80:127.0.0.1:8080"}}},
+			expected: "SSLKEYLOGFILE=/tmp/keys curl " + defaults + " --unix-socket /run/thing.sock --connect-to thing.com:80:127.0.0.1:8080 -H 'Connection: close' --max-time 10 http://thing.com/",
+		},
+	}
+
+	if previous, ok := os.LookupEnv("SSLKEYLOGFILE"); ok {
+		defer os.Setenv("SSLKEYLOGFILE", previous)
+	}
+	os.Unsetenv("SSLKEYLOGFILE")
+	redact := report.NewRedactor([]string{"token"}, []string{"Authorization"})
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			transportCfg := cfg.cfg
+			if transportCfg == nil {
+				// As with the defaults of the flags
+				transportCfg = &transportConfig{maxIdleConns: 100}
+			}
+			got := curlCommand(cfg.target, transportCfg, 10, redact)
+			if got != cfg.expected {
+				t.Errorf("Unexpected command:\ngot  %s\nwant %s", got, cfg.expected)
+			}
+		})
+	}
+}
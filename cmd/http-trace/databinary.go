@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// loadDataBinary returns the request body given with -data-binary, the bytes
+// of a file for @file (or of stdin for @-) or else the data itself, sent as
+// they are without stripping newlines, and headers with the Content-Type
+// inferred for it added, unless one is given already: from the extension of
+// the file, or else by sniffing its first bytes.
+func loadDataBinary(data string, headers []string) (string, []string, error) {
+	if !strings.HasPrefix(data, "@") {
+		return data, withContentType(headers, http.DetectContentType([]byte(data))), nil
+	}
+
+	var raw []byte
+	var err error
+	path := data[1:]
+	if path == "-" {
+		raw, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		raw, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("error reading -data-binary: %w", err)
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		contentType = http.DetectContentType(raw)
+	}
+	return string(raw), withContentType(headers, contentType), nil
+}
+
+// withContentType returns headers with a Content-Type header of contentType
+// added, unless they have one already.
+func withContentType(headers []string, contentType string) []string {
+	if hasHeader(headers, "Content-Type") {
+		return headers
+	}
+	return append(headers, "Content-Type: "+contentType)
+}
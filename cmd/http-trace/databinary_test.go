@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadDataBinary(t *testing.T) {
+	type testLoadDataBinary struct {
+		data            string
+		files           map[string]string
+		stdin           string
+		headers         []string
+		expectedBody    string
+		expectedHeaders []string
+		expectedError   string
+	}
+
+	dir := t.TempDir()
+
+	tests := map[string]testLoadDataBinary{
+		"will send the data as it is": {
+			data:            "name=thing\n",
+			expectedBody:    "name=thing\n",
+			expectedHeaders: []string{"Content-Type: text/plain; charset=utf-8"},
+		},
+		"will infer the type from the extension of the file": {
+			data:            "@" + filepath.Join(dir, "thing.json"),
+			files:           map[string]string{"thing.json": "[1, 2]\n"},
+			expectedBody:    "[1, 2]\n",
+			expectedHeaders: []string{"Content-Type: application/json"},
+		},
+		"will sniff the type of a file without an extension": {
+			data:            "@" + filepath.Join(dir, "image"),
+			files:           map[string]string{"image": "\x89PNG\r\n\x1a\n\x00\x00"},
+			expectedBody:    "\x89PNG\r\n\x1a\n\x00\x00",
+			expectedHeaders: []string{"Content-Type: image/png"},
+		},
+		"will keep a Content-Type given with -H": {
+			data:            "@" + filepath.Join(dir, "upload.json"),
+			files:           map[string]string{"upload.json": "{}"},
+			headers:         []string{"Accept: */*", "content-type: application/vnd.thing+json"},
+			expectedBody:    "{}",
+			expectedHeaders: []string{"Accept: */*", "content-type: application/vnd.thing+json"},
+		},
+		"will read stdin": {
+			data:            "@-",
+			stdin:           "<html><body>hello</body></html>",
+			headers:         []string{"Accept: */*"},
+			expectedBody:    "<html><body>hello</body></html>",
+			expectedHeaders: []string{"Accept: */*", "Content-Type: text/html; charset=utf-8"},
+		},
+		"will fail for a file which doesn't exist": {
+			data:          "@" + filepath.Join(dir, "missing"),
+			expectedError: "error reading -data-binary: open " + filepath.Join(dir, "missing") + ": no such file or directory",
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			for file, content := range cfg.files {
+				err := ioutil.WriteFile(filepath.Join(dir, file), []byte(content), 0644)
+				if err != nil {
+					t.Fatalf("Error writing file: %v", err)
+				}
+			}
+			if cfg.stdin != "" {
+				stdin := filepath.Join(t.TempDir(), "stdin")
+				err := ioutil.WriteFile(stdin, []byte(cfg.stdin), 0644)
+				if err != nil {
+					t.Fatalf("Error writing stdin: %v", err)
+				}
+				f, err := os.Open(stdin)
+				if err != nil {
+					t.Fatalf("Error opening stdin: %v", err)
+				}
+				defer f.Close()
+				previous := os.Stdin
+				os.Stdin = f
+				defer func() { os.Stdin = previous }()
+			}
+
+			body, headers, err := loadDataBinary(cfg.data, cfg.headers)
+			if cfg.expectedError != "" {
+				if err == nil || err.Error() != cfg.expectedError {
+					t.Errorf("Unexpected error: got %v, want %q", err, cfg.expectedError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Error loading -data-binary: %v", err)
+			}
+			if body != cfg.expectedBody {
+				t.Errorf("Unexpected body: got %q, want %q", body, cfg.expectedBody)
+			}
+			if !reflect.DeepEqual(headers, cfg.expectedHeaders) {
+				t.Errorf("Unexpected headers: got %q, want %q", headers, cfg.expectedHeaders)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/berndhartzer/http-trace/report"
+	"github.com/berndhartzer/http-trace/trace"
+)
+
+// diffResponses sends target twice, or once when a file of saved results is
+// given to compare the response with, keeping up to maxBody bytes of each
+// body, and writes the differences between the
+// two responses and their timings, to catch flapping backends or load
+// balanced instances which answer differently. It returns whether the
+// responses differ.
+func diffResponses(transport *http.Transport, timeout time.Duration, target request, savedPath string, maxBody int64, redact *report.Redactor, format report.TimeFormat, out io.Writer) (bool, error) {
+	client := &http.Client{Timeout: timeout, Transport: transport}
+	pres := &report.Presentation{Format: report.FormatJSON, Redactor: redact, TimeFormat: format}
+
+	send := func() (*report.Result, error) {
+		req, err := http.NewRequest(target.method, target.url, strings.NewReader(target.body))
+		if err != nil {
+			return nil, err
+		}
+		tracedRequest := trace.New(client, req)
+		err = tracedRequest.SetHeaders(target.headers)
+		if err != nil {
+			return nil, err
+		}
+		tracedRequest.SetMaxBodyCapture(maxBody)
+		err = tracedRequest.Execute()
+		if err != nil {
+			return redact.RedactResult(report.ErrorResult(req, err)), nil
+		}
+
+		output := report.New(req, tracedRequest.GetResponse(), tracedRequest.GetResponseBody(), tracedRequest.GetTimings(), pres)
+		output.SetResponseBodySize(tracedRequest.GetResponseBodySize())
+		err = output.Build()
+		if err != nil {
+			return nil, err
+		}
+		return output.Result(), nil
+	}
+
+	var a *report.Result
+	labelA := ""
+	if savedPath != "" {
+		saved, err := loadTarget(savedPath)
+		if err != nil {
+			return false, err
+		}
+		a, labelA = saved.Results[0], fmt.Sprintf("%s, saved in %s", saved.Results[0].URL, savedPath)
+	} else {
+		var err error
+		a, err = send()
+		if err != nil {
+			return false, err
+		}
+		labelA = a.URL + ", first request"
+	}
+	b, err := send()
+	if err != nil {
+		return false, err
+	}
+	labelB := b.URL + ", second request"
+	if savedPath != "" {
+		labelB = b.URL + ", now"
+	}
+
+	return report.WriteResponseDiff(out, a, b, labelA, labelB, pres)
+}
+
+// diffResultFiles writes the differences between the first responses saved
+// in two files of results with the timings in format, returning whether they
+// differ.
+func diffResultFiles(pathA, pathB string, format report.TimeFormat, out io.Writer) (bool, error) {
+	a, err := loadTarget(pathA)
+	if err != nil {
+		return false, err
+	}
+	b, err := loadTarget(pathB)
+	if err != nil {
+		return false, err
+	}
+	return report.WriteResponseDiff(out, a.Results[0], b.Results[0], fmt.Sprintf("%s, saved in %s", a.Results[0].URL, pathA), fmt.Sprintf("%s, saved in %s", b.Results[0].URL, pathB), &report.Presentation{TimeFormat: format})
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// instance is a host and port a service was discovered at.
+type instance struct {
+	host string
+	port int
+}
+
+func (i instance) String() string {
+	return net.JoinHostPort(i.host, strconv.Itoa(i.port))
+}
+
+// discover looks up the healthy instances of a service registered in Consul,
+// as consul://service, or etcd, as etcd://service. Consul is reached at
+// $CONSUL_HTTP_ADDR with the token in $CONSUL_HTTP_TOKEN, and etcd at the
+// first of $ETCD_ENDPOINTS, each defaulting to the local agent.
+func discover(spec string, client *http.Client) ([]instance, error) {
+	u, err := url.Parse(spec)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid -discover %q, expected consul://service or etcd://service", spec)
+	}
+
+	var instances []instance
+	switch u.Scheme {
+	case "consul":
+		instances, err = discoverConsul(client, u.Host, u.Query())
+	case "etcd":
+		instances, err = discoverEtcd(client, u.Host)
+	default:
+		return nil, fmt.Errorf("unsupported -discover %q, expected consul:// or etcd://", spec)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("no healthy instances of %s found in %s", u.Host, u.Scheme)
+	}
+	return instances, nil
+}
+
+// discoverConsul asks the Consul health API for the instances of service
+// passing their health checks. Query parameters such as tag and dc are passed
+// on.
+func discoverConsul(client *http.Client, service string, query url.Values) ([]instance, error) {
+	addr := os.Getenv("CONSUL_HTTP_ADDR")
+	if addr == "" {
+		addr = "127.0.0.1:8500"
+	}
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	query.Set("passing", "true")
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(addr, "/")+"/v1/health/service/"+url.PathEscape(service)+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if token := os.Getenv("CONSUL_HTTP_TOKEN"); token != "" {
+		req.Header.Set("X-Consul-Token", token)
+	}
+
+	var entries []struct {
+		Node struct {
+			Address string
+		}
+		Service struct {
+			Address string
+			Port    int
+		}
+	}
+	err = getDiscoveryJSON(client, req, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("error discovering %s in consul: %w", service, err)
+	}
+
+	instances := []instance{}
+	for _, e := range entries {
+		host := e.Service.Address
+		if host == "" {
+			host = e.Node.Address
+		}
+		instances = append(instances, instance{host: host, port: e.Service.Port})
+	}
+	return instances, nil
+}
+
+// discoverEtcd reads the instances of service registered in etcd, through
+// its JSON gateway, under the "service/" prefix as the etcd endpoints
+// manager does. Values are either JSON with an Addr, or a plain host:port.
+// As entries are removed when their lease expires, they are all taken to be
+// healthy.
+func discoverEtcd(client *http.Client, service string) ([]instance, error) {
+	endpoint := strings.SplitN(os.Getenv("ETCD_ENDPOINTS"), ",", 2)[0]
+	if endpoint == "" {
+		endpoint = "http://127.0.0.1:2379"
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+
+	prefix := []byte(service + "/")
+	rangeEnd := append([]byte{}, prefix...)
+	rangeEnd[len(rangeEnd)-1]++
+	body, _ := json.Marshal(map[string]string{
+		"key":       base64.StdEncoding.EncodeToString(prefix),
+		"range_end": base64.StdEncoding.EncodeToString(rangeEnd),
+	})
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(endpoint, "/")+"/v3/kv/range", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var resp struct {
+		KVs []struct {
+			Value string `json:"value"`
+		} `json:"kvs"`
+	}
+	err = getDiscoveryJSON(client, req, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("error discovering %s in etcd: %w", service, err)
+	}
+
+	instances := []instance{}
+	for _, kv := range resp.KVs {
+		raw, err := base64.StdEncoding.DecodeString(kv.Value)
+		if err != nil {
+			return nil, fmt.Errorf("error discovering %s in etcd: %w", service, err)
+		}
+
+		addr := strings.TrimSpace(string(raw))
+		var endpoint struct {
+			Addr string
+		}
+		if json.Unmarshal(raw, &endpoint) == nil && endpoint.Addr != "" {
+			addr = endpoint.Addr
+		}
+
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("error discovering %s in etcd: invalid address %q", service, addr)
+		}
+		portNumber, _ := strconv.Atoi(port)
+		instances = append(instances, instance{host: host, port: portNumber})
+	}
+	return instances, nil
+}
+
+func getDiscoveryJSON(client *http.Client, req *http.Request, v interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("server responded %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// pickInstance chooses one of the instances at random, to spread the load of
+// tracing like a client of the service would.
+func pickInstance(instances []instance) instance {
+	return instances[rand.Intn(len(instances))]
+}
+
+// instanceURL is rawURL with its host and port replaced by host and port, or
+// if rawURL is empty, the root of host over HTTPS for port 443 and HTTP for
+// any other.
+func instanceURL(rawURL, host string, port int) (string, error) {
+	hostPort := net.JoinHostPort(host, strconv.Itoa(port))
+	if rawURL == "" {
+		scheme := "http"
+		if port == 443 {
+			scheme = "https"
+		}
+		return scheme + "://" + hostPort + "/", nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	u.Host = hostPort
+	return u.String(), nil
+}
+
+// resolveDiscover finds the instances of the service in spec, describing them
+// to out, and returns the URL to send the request to for one picked at random,
+// or for each of them if all is set. The scheme, path and query are taken from
+// rawURL as with -srv.
+func resolveDiscover(spec, rawURL string, all bool, client *http.Client, out io.Writer) ([]string, error) {
+	instances, err := discover(spec, client)
+	if err != nil {
+		return nil, err
+	}
+
+	chosen := pickInstance(instances)
+	fmt.Fprintf(out, "%d healthy instances of %s:\n", len(instances), spec)
+	for _, i := range instances {
+		marker := " "
+		if all || i == chosen {
+			marker = "*"
+		}
+		fmt.Fprintf(out, "%s %s\n", marker, i)
+	}
+
+	if !all {
+		instances = []instance{chosen}
+	}
+	urls := []string{}
+	for _, i := range instances {
+		u, err := instanceURL(rawURL, i.host, i.port)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, u)
+	}
+	return urls, nil
+}
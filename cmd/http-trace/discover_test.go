@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiscover(t *testing.T) {
+	type testDiscover struct {
+		spec            string
+		token           string
+		status          int
+		response        string
+		expectedRequest string
+		expected        []instance
+		expectedError   string
+	}
+
+	tests := map[string]testDiscover{
+		"will find the instances passing in consul": {
+			spec:  "consul://web?tag=v2",
+			token: "secret",
+			response: `[
+				{"Node": {"Address": "10.0.0.1"}, "Service": {"Address": "10.0.1.1", "Port": 8080}},
+				{"Node": {"Address": "10.0.0.2"}, "Service": {"Address": "", "Port": 9090}}
+			]`,
+			expectedRequest: "GET /v1/health/service/web?passing=true&tag=v2 token=secret",
+			expected:        []instance{{host: "10.0.1.1", port: 8080}, {host: "10.0.0.2", port: 9090}},
+		},
+		"will fail for an error from consul": {
+			spec:          "consul://web",
+			status:        http.StatusForbidden,
+			response:      "ACL not found\n",
+			expectedError: "error discovering web in consul: server responded 403 Forbidden: ACL not found",
+		},
+		"will fail for an invalid response from consul": {
+			spec:          "consul://web",
+			response:      `{"Node": {}}`,
+			expectedError: "error discovering web in consul: json: cannot unmarshal object into Go value of type []struct",
+		},
+		"will fail without instances in consul": {
+			spec:          "consul://web",
+			response:      `[]`,
+			expectedError: "no healthy instances of web found in consul",
+		},
+		"will find the instances in etcd": {
+			spec:            "etcd://web",
+			response:        `{"kvs": [{"value": "eyJBZGRyIjoiMTAuMC4wLjE6ODA4MCJ9"}, {"value": "MTAuMC4wLjI6OTA5MA=="}]}`,
+			expectedRequest: `POST /v3/kv/range {"key":"d2ViLw==","range_end":"d2ViMA=="}`,
+			expected:        []instance{{host: "10.0.0.1", port: 8080}, {host: "10.0.0.2", port: 9090}},
+		},
+		"will fail for an error from etcd": {
+			spec:          "etcd://web",
+			status:        http.StatusServiceUnavailable,
+			response:      `{"error": "etcdserver: no leader"}`,
+			expectedError: `error discovering web in etcd: server responded 503 Service Unavailable: {"error": "etcdserver: no leader"}`,
+		},
+		"will fail for an invalid address in etcd": {
+			spec:          "etcd://web",
+			response:      `{"kvs": [{"value": "bm9ob3N0"}]}`,
+			expectedError: `error discovering web in etcd: invalid address "nohost"`,
+		},
+		"will fail for a value which isn't base64 in etcd": {
+			spec:          "etcd://web",
+			response:      `{"kvs": [{"value": "!!!"}]}`,
+			expectedError: "error discovering web in etcd: illegal base64 data",
+		},
+		"will fail without instances in etcd": {
+			spec:          "etcd://web",
+			response:      `{}`,
+			expectedError: "no healthy instances of web found in etcd",
+		},
+		"will fail for another registry": {
+			spec:          "zookeeper://web",
+			expectedError: `unsupported -discover "zookeeper://web", expected consul:// or etcd://`,
+		},
+		"will fail without a service": {
+			spec:          "consul://",
+			expectedError: `invalid -discover "consul://", expected consul://service or etcd://service`,
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			var received string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				received = strings.TrimSpace(fmt.Sprintf("%s %s %s", r.Method, r.URL.RequestURI(), body))
+				if token := r.Header.Get("X-Consul-Token"); token != "" {
+					received += " token=" + token
+				}
+				if cfg.status != 0 {
+					w.WriteHeader(cfg.status)
+				}
+				fmt.Fprint(w, cfg.response)
+			}))
+			defer server.Close()
+			os.Setenv("CONSUL_HTTP_ADDR", server.URL)
+			defer os.Unsetenv("CONSUL_HTTP_ADDR")
+			os.Setenv("CONSUL_HTTP_TOKEN", cfg.token)
+			defer os.Unsetenv("CONSUL_HTTP_TOKEN")
+			os.Setenv("ETCD_ENDPOINTS", strings.TrimPrefix(server.URL, "http://")+",127.0.0.1:1")
+			defer os.Unsetenv("ETCD_ENDPOINTS")
+
+			instances, err := discover(cfg.spec, server.Client())
+			if cfg.expectedError != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), cfg.expectedError) {
+					t.Errorf("Unexpected error: got %v, want %q", err, cfg.expectedError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Error discovering: %v", err)
+			}
+			if received != cfg.expectedRequest {
+				t.Errorf("Unexpected request: got %q, want %q", received, cfg.expectedRequest)
+			}
+			if !reflect.DeepEqual(instances, cfg.expected) {
+				t.Errorf("Unexpected instances: got %v, want %v", instances, cfg.expected)
+			}
+		})
+	}
+}
+
+func TestResolveDiscover(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"Service": {"Address": "10.0.1.1", "Port": 8080}},
+			{"Service": {"Address": "10.0.1.2", "Port": 443}}
+		]`)
+	}))
+	defer server.Close()
+	os.Setenv("CONSUL_HTTP_ADDR", server.URL)
+	defer os.Unsetenv("CONSUL_HTTP_ADDR")
+
+	var out bytes.Buffer
+	urls, err := resolveDiscover("consul://web", "https://web.internal/health?full=1", true, server.Client(), &out)
+	if err != nil {
+		t.Fatalf("Error resolving: %v", err)
+	}
+	expected := []string{"https://10.0.1.1:8080/health?full=1", "https://10.0.1.2:443/health?full=1"}
+	if !reflect.DeepEqual(urls, expected) {
+		t.Errorf("Unexpected urls: got %v, want %v", urls, expected)
+	}
+	expectedOut := "2 healthy instances of consul://web:\n* 10.0.1.1:8080\n* 10.0.1.2:443\n"
+	if out.String() != expectedOut {
+		t.Errorf("Unexpected description: got %q, want %q", out.String(), expectedOut)
+	}
+
+	urls, err = resolveDiscover("consul://web", "", false, server.Client(), ioutil.Discard)
+	if err != nil {
+		t.Fatalf("Error resolving: %v", err)
+	}
+	if len(urls) != 1 || (urls[0] != "http://10.0.1.1:8080/" && urls[0] != "https://10.0.1.2:443/") {
+		t.Errorf("Unexpected urls for one instance picked: got %v", urls)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/berndhartzer/http-trace/trace"
+)
+
+// dnsRcodes are the names of the DNS response codes.
+var dnsRcodes = map[byte]string{
+	0: "NOERROR",
+	1: "FORMERR",
+	2: "SERVFAIL",
+	3: "NXDOMAIN",
+	4: "NOTIMP",
+	5: "REFUSED",
+}
+
+// dnsTypes are the names of the DNS record types resolvers commonly query.
+var dnsTypes = map[uint16]string{
+	dnsTypeA:     "A",
+	dnsTypeCNAME: "CNAME",
+	16:           "TXT",
+	dnsTypeAAAA:  "AAAA",
+	33:           "SRV",
+}
+
+// queryResolver returns a resolver which sends the queries itself over the
+// connections made with dial, rather than leaving them to the system, and
+// reports each of them and its answer to the trace of the request with
+// trace.StartDNSQuery. Search domains appended to the name, NXDOMAIN and
+// SERVFAIL answers and servers which don't answer then each show up as
+// queries of their own.
+func queryResolver(dial func(ctx context.Context, network, server string) (net.Conn, error)) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, server string) (net.Conn, error) {
+			conn, err := dial(ctx, network, server)
+			if err != nil {
+				return nil, err
+			}
+
+			recorded := &dnsQueryConn{
+				Conn:    conn,
+				ctx:     ctx,
+				server:  server,
+				pending: map[uint16]func(trace.DNSAnswer){},
+			}
+			if resolver, ok := conn.(resolverConn); ok {
+				recorded.server = resolver.resolverName()
+			}
+			if packet, ok := conn.(net.PacketConn); ok {
+				// The resolver frames the messages by whether it is given a
+				// PacketConn
+				return &dnsPacketConn{dnsQueryConn: recorded, packet: packet}, nil
+			}
+			recorded.stream = true
+			return recorded, nil
+		},
+	}
+}
+
+// resolverConn is a connection to a resolver other than that of the address
+// it was dialed with, such as an encrypted one.
+type resolverConn interface {
+	// resolverName returns the name of the resolver the queries are shown
+	// as sent to.
+	resolverName() string
+	// setup returns the times of connecting and the TLS handshake, if a new
+	// connection was made for the last query, which are then reset.
+	setup() (connect, handshake time.Duration)
+}
+
+// dnsQueryConn reads the DNS messages the resolver exchanges with a server,
+// to record the queries. Over TCP each message is prefixed by its length.
+type dnsQueryConn struct {
+	net.Conn
+	ctx     context.Context
+	server  string
+	stream  bool
+	mu      sync.Mutex
+	pending map[uint16]func(answer trace.DNSAnswer)
+	read    []byte // Of a stream, until a whole message has been read
+}
+
+func (c *dnsQueryConn) Write(p []byte) (int, error) {
+	msg := p
+	if c.stream && len(msg) >= 2 {
+		msg = msg[2:]
+	}
+	c.sent(msg)
+	n, err := c.Conn.Write(p)
+	if err != nil {
+		// As of an encrypted resolver which couldn't be queried
+		c.finish(fmt.Sprintf("error: %v", err))
+	}
+	return n, err
+}
+
+func (c *dnsQueryConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.received(p[:n])
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		c.finish("timeout")
+	}
+	return n, err
+}
+
+func (c *dnsQueryConn) Close() error {
+	c.finish("no answer")
+	return c.Conn.Close()
+}
+
+// sent records the query msg.
+func (c *dnsQueryConn) sent(msg []byte) {
+	if len(msg) < 12 || binary.BigEndian.Uint16(msg[4:]) == 0 {
+		return
+	}
+	name, next, ok := readDNSName(msg, 12)
+	if !ok || next+2 > len(msg) {
+		return
+	}
+	qtype := binary.BigEndian.Uint16(msg[next:])
+	typeName, ok := dnsTypes[qtype]
+	if !ok {
+		typeName = fmt.Sprintf("TYPE%d", qtype)
+	}
+
+	done := trace.StartDNSQuery(c.ctx, c.server, name, typeName)
+	c.mu.Lock()
+	c.pending[binary.BigEndian.Uint16(msg)] = done
+	c.mu.Unlock()
+}
+
+// received records the answers in data, which for a stream may be part of a
+// message.
+func (c *dnsQueryConn) received(data []byte) {
+	if !c.stream {
+		c.answered(data)
+		return
+	}
+
+	c.read = append(c.read, data...)
+	for len(c.read) >= 2 {
+		length := int(binary.BigEndian.Uint16(c.read))
+		if len(c.read) < 2+length {
+			return
+		}
+		c.answered(c.read[2 : 2+length])
+		c.read = c.read[2+length:]
+	}
+}
+
+// answered records the outcome of the query msg answers.
+func (c *dnsQueryConn) answered(msg []byte) {
+	if len(msg) < 12 || msg[2]&0x80 == 0 {
+		return
+	}
+	id := binary.BigEndian.Uint16(msg)
+	c.mu.Lock()
+	done, ok := c.pending[id]
+	delete(c.pending, id)
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	rcode := msg[3] & 0x0f
+	outcome, ok := dnsRcodes[rcode]
+	if !ok {
+		outcome = fmt.Sprintf("RCODE%d", rcode)
+	}
+	answer := trace.DNSAnswer{Outcome: outcome, Answers: int(binary.BigEndian.Uint16(msg[6:])), CNAMEs: countCNAMEs(msg)}
+	answer.Connect, answer.TLSHandshake = c.setup()
+	done(answer)
+}
+
+// setup returns the times of a connection made for the query just answered.
+func (c *dnsQueryConn) setup() (time.Duration, time.Duration) {
+	if resolver, ok := c.Conn.(resolverConn); ok {
+		return resolver.setup()
+	}
+	return 0, 0
+}
+
+// countCNAMEs returns the number of CNAME records in the answer section of
+// msg, each a hop from one name to another on the way to the records queried.
+func countCNAMEs(msg []byte) int {
+	questions := int(binary.BigEndian.Uint16(msg[4:]))
+	answers := int(binary.BigEndian.Uint16(msg[6:]))
+	offset := 12
+	for i := 0; i < questions; i++ {
+		_, next, ok := readDNSName(msg, offset)
+		if !ok || next+4 > len(msg) {
+			return 0
+		}
+		offset = next + 4
+	}
+
+	cnames := 0
+	for i := 0; i < answers; i++ {
+		_, next, ok := readDNSName(msg, offset)
+		if !ok || next+10 > len(msg) {
+			break
+		}
+		if binary.BigEndian.Uint16(msg[next:]) == dnsTypeCNAME {
+			cnames++
+		}
+		offset = next + 10 + int(binary.BigEndian.Uint16(msg[next+8:]))
+	}
+	return cnames
+}
+
+// finish records the queries still waiting for an answer with outcome.
+func (c *dnsQueryConn) finish(outcome string) {
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = map[uint16]func(trace.DNSAnswer){}
+	c.mu.Unlock()
+	for _, done := range pending {
+		answer := trace.DNSAnswer{Outcome: outcome}
+		answer.Connect, answer.TLSHandshake = c.setup()
+		done(answer)
+	}
+}
+
+// dnsPacketConn is a dnsQueryConn over UDP.
+type dnsPacketConn struct {
+	*dnsQueryConn
+	packet net.PacketConn
+}
+
+func (c *dnsPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	return c.packet.ReadFrom(p)
+}
+
+func (c *dnsPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	return c.packet.WriteTo(p, addr)
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/berndhartzer/http-trace/report"
+)
+
+const (
+	// doctorTimeout is how long each network check of doctor waits.
+	doctorTimeout = 2 * time.Second
+	// doctorNTPServer is the NTP server the clock is compared with.
+	doctorNTPServer = "pool.ntp.org:123"
+	// doctorMaxSkew is how far the clock can be off before doctor warns.
+	doctorMaxSkew = time.Second
+
+	resolvConf = "/etc/resolv.conf"
+)
+
+// Statuses of a doctor finding.
+const (
+	doctorOK   = "ok"
+	doctorWarn = "warn"
+	doctorFail = "fail"
+)
+
+// doctorFinding is the outcome of one check of the environment.
+type doctorFinding struct {
+	status string
+	check  string
+	detail string
+}
+
+// runDoctor checks the environment requests are traced from for problems
+// which would make the results misleading, such as an unreachable DNS server,
+// a proxy in the way, a skewed clock or an unreadable CA store. The findings
+// are written to out, with durations in format, and false is returned if any
+// check failed.
+func runDoctor(out io.Writer, format report.TimeFormat) bool {
+	findings := []doctorFinding{}
+	findings = append(findings, checkDNSServers(format)...)
+	findings = append(findings, checkProxyEnv()...)
+	findings = append(findings, checkClock())
+	findings = append(findings, checkIPv6())
+	findings = append(findings, checkCAStore())
+	return writeDoctorFindings(out, findings)
+}
+
+// writeDoctorFindings writes a line for each of findings to out, returning
+// false if any of them failed. Warnings don't fail doctor.
+func writeDoctorFindings(out io.Writer, findings []doctorFinding) bool {
+	ok := true
+	for _, f := range findings {
+		fmt.Fprintf(out, "%-4s  %-12s %s\n", f.status, f.check+":", f.detail)
+		if f.status == doctorFail {
+			ok = false
+		}
+	}
+	return ok
+}
+
+// checkDNSServers sends a query to each nameserver in /etc/resolv.conf, as
+// Go's resolver would, with the time each took to answer in format.
+func checkDNSServers(format report.TimeFormat) []doctorFinding {
+	f, err := os.Open(resolvConf)
+	if err != nil {
+		return []doctorFinding{{doctorWarn, "DNS", fmt.Sprintf("can't read %s: %v", resolvConf, err)}}
+	}
+	defer f.Close()
+
+	servers := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			servers = append(servers, net.JoinHostPort(fields[1], "53"))
+		}
+	}
+	if len(servers) == 0 {
+		return []doctorFinding{{doctorWarn, "DNS", fmt.Sprintf("no nameservers in %s, so 127.0.0.1:53 and [::1]:53 are used", resolvConf)}}
+	}
+
+	findings := []doctorFinding{}
+	reachable := 0
+	for _, server := range servers {
+		elapsed, err := queryDNSServer(server)
+		if err != nil {
+			findings = append(findings, doctorFinding{doctorWarn, "DNS", fmt.Sprintf("%s did not answer: %v, so lookups wait for it to time out before trying the next server", server, err)})
+			continue
+		}
+		reachable++
+		findings = append(findings, doctorFinding{doctorOK, "DNS", fmt.Sprintf("%s answered in %s", server, format.Duration(elapsed))})
+	}
+	if reachable == 0 {
+		findings = append(findings, doctorFinding{doctorFail, "DNS", "no nameserver answered, so names can't be resolved"})
+	}
+	return findings
+}
+
+// queryDNSServer times a query to server for the A record of example.com.
+// Any answer counts, even an error, as the server was reached.
+func queryDNSServer(server string) (time.Duration, error) {
+	id := uint16(rand.Intn(1 << 16))
+	query, err := dnsQuery(id, "example.com.", dnsTypeA)
+	if err != nil {
+		return 0, err
+	}
+	query[2] |= 0x01 // Recursion desired
+
+	conn, err := net.DialTimeout("udp", server, doctorTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	conn.SetDeadline(start.Add(doctorTimeout))
+	_, err = conn.Write(query)
+	if err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, 512)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return 0, err
+		}
+		if n >= 12 && binary.BigEndian.Uint16(buf) == id {
+			return time.Since(start), nil
+		}
+	}
+}
+
+// checkProxyEnv looks for proxy environment variables which are invalid, or
+// which send requests through a proxy, so the timings are to the proxy.
+func checkProxyEnv() []doctorFinding {
+	findings := []doctorFinding{}
+	for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY"} {
+		upper, lower := os.Getenv(name), os.Getenv(strings.ToLower(name))
+		value := upper
+		if value == "" {
+			value = lower
+		}
+		if upper != "" && lower != "" && upper != lower {
+			findings = append(findings, doctorFinding{doctorWarn, "Proxy", fmt.Sprintf("%s and %s differ, %s=%s is used", name, strings.ToLower(name), name, upper)})
+		}
+		if value == "" {
+			continue
+		}
+
+		// Go takes a proxy without a scheme to be an HTTP proxy
+		raw := value
+		if !strings.Contains(raw, "://") {
+			raw = "http://" + raw
+		}
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			findings = append(findings, doctorFinding{doctorFail, "Proxy", fmt.Sprintf("%s=%s is not a valid proxy URL, so requests fail", name, value)})
+			continue
+		}
+		if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5" {
+			findings = append(findings, doctorFinding{doctorFail, "Proxy", fmt.Sprintf("%s=%s has unsupported scheme %q, expected http, https or socks5", name, u.Redacted(), u.Scheme)})
+			continue
+		}
+		findings = append(findings, doctorFinding{doctorWarn, "Proxy", fmt.Sprintf("%s requests go through %s, so the connection timings are to the proxy rather than the server", strings.TrimSuffix(name, "_PROXY"), u.Redacted())})
+	}
+
+	if len(findings) == 0 {
+		return []doctorFinding{{doctorOK, "Proxy", "no proxy set in the environment"}}
+	}
+	if noProxy := os.Getenv("NO_PROXY") + os.Getenv("no_proxy"); noProxy != "" {
+		findings = append(findings, doctorFinding{doctorOK, "Proxy", "hosts matching NO_PROXY are requested directly"})
+	}
+	return findings
+}
+
+// checkClock compares the clock with an NTP server. A skewed clock doesn't
+// affect the timings, which use the monotonic clock, but does certificate
+// validity checks and anything compared with Date headers.
+func checkClock() doctorFinding {
+	offset, err := ntpOffset(doctorNTPServer)
+	if err != nil {
+		return doctorFinding{doctorWarn, "Clock", fmt.Sprintf("can't compare the clock with %s: %v", doctorNTPServer, err)}
+	}
+
+	skew := offset
+	direction := "behind"
+	if skew < 0 {
+		skew = -skew
+		direction = "ahead of"
+	}
+	detail := fmt.Sprintf("%s %s %s", skew.Round(time.Millisecond), direction, doctorNTPServer)
+	if skew > doctorMaxSkew {
+		return doctorFinding{doctorWarn, "Clock", detail + ", so certificates may be taken as not yet or no longer valid, and Date headers look off"}
+	}
+	return doctorFinding{doctorOK, "Clock", detail}
+}
+
+// ntpOffset returns how far the local clock is behind server, with a single
+// SNTP request (RFC 4330).
+func ntpOffset(server string) (time.Duration, error) {
+	conn, err := net.DialTimeout("udp", server, doctorTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(doctorTimeout))
+
+	req := make([]byte, 48)
+	req[0] = 0x23 // Version 4, client mode
+	sent := time.Now()
+	_, err = conn.Write(req)
+	if err != nil {
+		return 0, err
+	}
+
+	resp := make([]byte, 48)
+	n, err := conn.Read(resp)
+	if err != nil {
+		return 0, err
+	}
+	received := time.Now()
+	if n < 48 {
+		return 0, fmt.Errorf("short NTP response")
+	}
+
+	serverReceived := ntpTime(resp[32:])
+	serverSent := ntpTime(resp[40:])
+	return (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2, nil
+}
+
+// ntpTime decodes an NTP timestamp, seconds and fractions of a second since
+// 1900.
+func ntpTime(b []byte) time.Time {
+	const unixOffset = 2208988800
+	seconds := int64(binary.BigEndian.Uint32(b)) - unixOffset
+	fraction := int64(binary.BigEndian.Uint32(b[4:]))
+	return time.Unix(seconds, fraction*1e9>>32)
+}
+
+// checkIPv6 finds out which IP versions there is a route for. Dialing UDP
+// sends nothing, but fails without a route.
+func checkIPv6() doctorFinding {
+	ipv4 := canRoute("udp4", "192.0.2.1:9")
+	ipv6 := canRoute("udp6", "[2001:db8::1]:9")
+
+	switch {
+	case ipv4 && ipv6:
+		return doctorFinding{doctorOK, "IPv6", "IPv4 and IPv6 are both routed, servers with both are connected to over either"}
+	case ipv4:
+		return doctorFinding{doctorOK, "IPv6", "not available, servers are connected to over IPv4"}
+	case ipv6:
+		return doctorFinding{doctorWarn, "IPv6", "IPv6 only, servers with only IPv4 addresses are reached through NAT64, which adds to the connect and response timings"}
+	}
+	return doctorFinding{doctorFail, "IPv6", "neither IPv4 nor IPv6 is routed"}
+}
+
+func canRoute(network, addr string) bool {
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// checkCAStore loads the system CA certificates HTTPS servers are verified
+// against.
+func checkCAStore() doctorFinding {
+	for _, name := range []string{"SSL_CERT_FILE", "SSL_CERT_DIR"} {
+		if path := os.Getenv(name); path != "" {
+			if _, err := os.Stat(path); err != nil {
+				return doctorFinding{doctorFail, "CA store", fmt.Sprintf("%s=%s can't be read: %v", name, path, err)}
+			}
+		}
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		return doctorFinding{doctorFail, "CA store", fmt.Sprintf("can't load the system CA certificates: %v", err)}
+	}
+	count := len(pool.Subjects())
+	if count == 0 {
+		return doctorFinding{doctorFail, "CA store", "no system CA certificates found, so no HTTPS server can be verified"}
+	}
+	return doctorFinding{doctorOK, "CA store", fmt.Sprintf("%d system CA certificates loaded", count)}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteDoctorFindings(t *testing.T) {
+	type testFindings struct {
+		findings       []doctorFinding
+		expected       bool
+		expectedOutput string
+	}
+
+	tests := map[string]testFindings{
+		"will pass when every check is ok": {
+			findings: []doctorFinding{
+				{doctorOK, "DNS", "10.0.0.53:53 answered in 1.20ms"},
+				{doctorOK, "Proxy", "no proxy set in the environment"},
+			},
+			expected:       true,
+			expectedOutput: "ok    DNS:         10.0.0.53:53 answered in 1.20ms\nok    Proxy:       no proxy set in the environment\n",
+		},
+		"will pass with warnings": {
+			findings: []doctorFinding{
+				{doctorWarn, "Clock", "2s behind pool.ntp.org:123"},
+			},
+			expected:       true,
+			expectedOutput: "warn  Clock:       2s behind pool.ntp.org:123\n",
+		},
+		"will fail when a check failed": {
+			findings: []doctorFinding{
+				{doctorOK, "IPv6", "not available, servers are connected to over IPv4"},
+				{doctorFail, "CA store", "no system CA certificates found"},
+			},
+			expected:       false,
+			expectedOutput: "ok    IPv6:        not available, servers are connected to over IPv4\nfail  CA store:    no system CA certificates found\n",
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			ok := writeDoctorFindings(&out, cfg.findings)
+			if ok != cfg.expected {
+				t.Errorf("Unexpected result: got %v, want %v", ok, cfg.expected)
+			}
+			if out.String() != cfg.expectedOutput {
+				t.Errorf("Unexpected output: got %q, want %q", out.String(), cfg.expectedOutput)
+			}
+		})
+	}
+}
+
+func TestCheckProxyEnv(t *testing.T) {
+	type testProxyEnv struct {
+		env      map[string]string
+		expected []doctorFinding
+	}
+
+	proxy := httptest.NewServer(http.NotFoundHandler())
+	defer proxy.Close()
+
+	tests := map[string]testProxyEnv{
+		"will pass without a proxy": {
+			expected: []doctorFinding{{doctorOK, "Proxy", "no proxy set in the environment"}},
+		},
+		"will warn about a proxy": {
+			env: map[string]string{"HTTP_PROXY": proxy.URL},
+			expected: []doctorFinding{
+				{doctorWarn, "Proxy", "HTTP requests go through " + proxy.URL + ", so the connection timings are to the proxy rather than the server"},
+			},
+		},
+		"will take a proxy without a scheme to be an http proxy, hiding its password": {
+			env: map[string]string{"https_proxy": "user:pass@" + strings.TrimPrefix(proxy.URL, "http://"), "NO_PROXY": "localhost"},
+			expected: []doctorFinding{
+				{doctorWarn, "Proxy", "HTTPS requests go through http://user:xxxxx@" + strings.TrimPrefix(proxy.URL, "http://") + ", so the connection timings are to the proxy rather than the server"},
+				{doctorOK, "Proxy", "hosts matching NO_PROXY are requested directly"},
+			},
+		},
+		"will warn about differing variables": {
+			env: map[string]string{"HTTP_PROXY": proxy.URL, "http_proxy": "http://other.internal:3128"},
+			expected: []doctorFinding{
+				{doctorWarn, "Proxy", "HTTP_PROXY and http_proxy differ, HTTP_PROXY=" + proxy.URL + " is used"},
+				{doctorWarn, "Proxy", "HTTP requests go through " + proxy.URL + ", so the connection timings are to the proxy rather than the server"},
+			},
+		},
+		"will fail for an invalid proxy": {
+			env:      map[string]string{"HTTP_PROXY": "http://"},
+			expected: []doctorFinding{{doctorFail, "Proxy", "HTTP_PROXY=http:// is not a valid proxy URL, so requests fail"}},
+		},
+		"will fail for an unsupported scheme": {
+			env:      map[string]string{"HTTPS_PROXY": "ftp://proxy.internal:21"},
+			expected: []doctorFinding{{doctorFail, "Proxy", `HTTPS_PROXY=ftp://proxy.internal:21 has unsupported scheme "ftp", expected http, https or socks5`}},
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			for _, key := range []string{"HTTP_PROXY", "http_proxy", "HTTPS_PROXY", "https_proxy", "NO_PROXY", "no_proxy"} {
+				if previous, ok := os.LookupEnv(key); ok {
+					defer os.Setenv(key, previous)
+				} else {
+					defer os.Unsetenv(key)
+				}
+				os.Setenv(key, cfg.env[key])
+			}
+
+			findings := checkProxyEnv()
+			if !reflect.DeepEqual(findings, cfg.expected) {
+				t.Errorf("Unexpected findings: got %v, want %v", findings, cfg.expected)
+			}
+		})
+	}
+}
+
+// listenUDP answers each packet received on a local UDP port with the packets
+// returned by answer, returning the address it listens on.
+func listenUDP(t *testing.T, answer func(packet []byte) [][]byte) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			for _, p := range answer(append([]byte{}, buf[:n]...)) {
+				conn.WriteTo(p, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// closedUDPAddr returns a local address nothing listens on.
+func closedUDPAddr(t *testing.T) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	addr := conn.LocalAddr().String()
+	conn.Close()
+	return addr
+}
+
+func TestQueryDNSServer(t *testing.T) {
+	recursive := make(chan bool, 1)
+	server := listenUDP(t, func(query []byte) [][]byte {
+		recursive <- query[2]&0x01 != 0
+		other := append([]byte{}, query[:12]...)
+		other[0]++
+		answer := append([]byte{}, query...)
+		answer[2] |= 0x80
+		// An answer to another query is skipped
+		return [][]byte{other, answer}
+	})
+
+	_, err := queryDNSServer(server)
+	if err != nil {
+		t.Errorf("Error querying DNS server: %v", err)
+	}
+	if !<-recursive {
+		t.Errorf("Expected recursion to be desired")
+	}
+
+	_, err = queryDNSServer(closedUDPAddr(t))
+	if err == nil {
+		t.Errorf("Expected an error for a DNS server which isn't running")
+	}
+}
+
+func TestNTPOffset(t *testing.T) {
+	type testNTP struct {
+		skew          time.Duration
+		short         bool
+		expectedError string
+	}
+
+	tests := map[string]testNTP{
+		"will find a clock which is behind": {
+			skew: 5 * time.Second,
+		},
+		"will find a clock which is ahead": {
+			skew: -3 * time.Second,
+		},
+		"will fail for a short response": {
+			short:         true,
+			expectedError: "short NTP response",
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			server := listenUDP(t, func(req []byte) [][]byte {
+				if cfg.short {
+					return [][]byte{make([]byte, 12)}
+				}
+				resp := make([]byte, 48)
+				resp[0] = 0x24 // Version 4, server mode
+				putNTPTime(resp[32:], time.Now().Add(cfg.skew))
+				putNTPTime(resp[40:], time.Now().Add(cfg.skew))
+				return [][]byte{resp}
+			})
+
+			offset, err := ntpOffset(server)
+			if cfg.expectedError != "" {
+				if err == nil || err.Error() != cfg.expectedError {
+					t.Errorf("Unexpected error: got %v, want %q", err, cfg.expectedError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Error comparing the clock: %v", err)
+			}
+			if diff := offset - cfg.skew; diff > 500*time.Millisecond || diff < -500*time.Millisecond {
+				t.Errorf("Unexpected offset: got %v, want about %v", offset, cfg.skew)
+			}
+		})
+	}
+
+	_, err := ntpOffset(closedUDPAddr(t))
+	if err == nil {
+		t.Errorf("Expected an error for an NTP server which isn't running")
+	}
+}
+
+// putNTPTime encodes t as an NTP timestamp in b.
+func putNTPTime(b []byte, t time.Time) {
+	binary.BigEndian.PutUint32(b, uint32(t.Unix()+2208988800))
+	binary.BigEndian.PutUint32(b[4:], uint32((int64(t.Nanosecond())<<32)/1e9))
+}
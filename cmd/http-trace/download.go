@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/berndhartzer/http-trace/report"
+	"github.com/berndhartzer/http-trace/trace"
+)
+
+// downloadProgressInterval is how often the progress of a download is drawn.
+const downloadProgressInterval = 200 * time.Millisecond
+
+// downloadProgressMin is the size of body from which its progress is drawn,
+// as smaller bodies are read too quickly for it to be worth it.
+const downloadProgressMin = 1 << 20
+
+// downloadProgress draws how much of a large response body has been read on
+// a line of the terminal, redrawing it each time, so a long download doesn't
+// look hung. The line is cleared once the body has been read, before the
+// report is printed.
+type downloadProgress struct {
+	f     *os.File
+	drawn bool
+}
+
+func (d *downloadProgress) update(p trace.Progress) {
+	if p.BodyBytes < downloadProgressMin && p.BodyTotal < downloadProgressMin {
+		return
+	}
+	width := reportWidth(d.f)
+	if width > 0 {
+		// The last column is left free, so the line doesn't wrap
+		width--
+	}
+	fmt.Fprintf(d.f, "\r\x1b[K%s", report.FormatProgress(p, width))
+	d.drawn = true
+}
+
+// clear removes the progress line, if it was drawn.
+func (d *downloadProgress) clear() {
+	if d.drawn {
+		fmt.Fprint(d.f, "\r\x1b[K")
+		d.drawn = false
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/berndhartzer/http-trace/trace"
+)
+
+// dumpWire saves the bytes t sends and receives on the wire to files in dir,
+// numbered by request, such as 1-sent.raw and 1-received.raw, so they can be
+// archived and inspected later. The returned function closes the files once
+// the request is done.
+func (r *runner) dumpWire(dir string, t *trace.Trace) (func(), error) {
+	r.mu.Lock()
+	r.dumped++
+	n := r.dumped
+	r.mu.Unlock()
+	sent, err := os.Create(filepath.Join(dir, fmt.Sprintf("%d-sent.raw", n)))
+	if err != nil {
+		return nil, fmt.Errorf("error creating wire dump: %w", err)
+	}
+	received, err := os.Create(filepath.Join(dir, fmt.Sprintf("%d-received.raw", n)))
+	if err != nil {
+		sent.Close()
+		return nil, fmt.Errorf("error creating wire dump: %w", err)
+	}
+
+	t.SetWireDump(sent, received)
+	return func() {
+		sent.Close()
+		received.Close()
+	}, nil
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// dotPort is the port of DNS over TLS (RFC 7858).
+	dotPort = "853"
+	// dohMessageType is the media type of DNS messages sent over HTTPS (RFC
+	// 8484).
+	dohMessageType = "application/dns-message"
+)
+
+// dotAddr returns the address of a DNS over TLS resolver given as a host with
+// an optional port, which defaults to 853.
+func dotAddr(host string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(host, dotPort)
+}
+
+// dialDoT returns a dial function for queryResolver which sends the queries
+// to the DNS over TLS resolver at addr, whatever server they are for. Each
+// connection is a new one, timed as the query it is made for.
+func dialDoT(addr string) func(ctx context.Context, network, server string) (net.Conn, error) {
+	host, _, _ := net.SplitHostPort(addr)
+	config := &tls.Config{ServerName: host}
+	dialer := &net.Dialer{}
+
+	return func(ctx context.Context, network, server string) (net.Conn, error) {
+		start := time.Now()
+		raw, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("error connecting to DNS over TLS resolver %s: %w", addr, err)
+		}
+		connect := time.Since(start)
+
+		start = time.Now()
+		if deadline, ok := ctx.Deadline(); ok {
+			raw.SetDeadline(deadline)
+		}
+		conn := tls.Client(raw, config)
+		if err := conn.Handshake(); err != nil {
+			raw.Close()
+			return nil, fmt.Errorf("error in TLS handshake with DNS over TLS resolver %s: %w", addr, err)
+		}
+		raw.SetDeadline(time.Time{})
+
+		return &dotConn{Conn: conn, name: "tls://" + addr, connect: connect, handshake: time.Since(start)}, nil
+	}
+}
+
+// dotConn is a connection to a DNS over TLS resolver.
+type dotConn struct {
+	net.Conn
+	name      string
+	mu        sync.Mutex
+	connect   time.Duration
+	handshake time.Duration
+}
+
+func (c *dotConn) resolverName() string {
+	return c.name
+}
+
+func (c *dotConn) setup() (time.Duration, time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	connect, handshake := c.connect, c.handshake
+	c.connect, c.handshake = 0, 0
+	return connect, handshake
+}
+
+// parseDoHURL checks the URL of a DNS over HTTPS resolver.
+func parseDoHURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid -doh url: %w", err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return "", fmt.Errorf("-doh needs an https url, such as https://1.1.1.1/dns-query, not %s", rawURL)
+	}
+	return u.String(), nil
+}
+
+// dialDoH returns a dial function for queryResolver which POSTs the queries
+// to the DNS over HTTPS resolver at dohURL with client, whatever server they
+// are for. The client keeps its connection to the resolver between lookups,
+// so only a query which had to make one is given its connect and TLS times.
+func dialDoH(client *http.Client, dohURL string) func(ctx context.Context, network, server string) (net.Conn, error) {
+	return func(ctx context.Context, network, server string) (net.Conn, error) {
+		return &dohConn{client: client, url: dohURL}, nil
+	}
+}
+
+// dohConn exchanges DNS messages with a DNS over HTTPS resolver. It frames
+// them as over TCP, each prefixed by its length, so the resolver doesn't
+// limit the size of answers as over UDP.
+type dohConn struct {
+	client    *http.Client
+	url       string
+	mu        sync.Mutex
+	deadline  time.Time
+	written   []byte       // Until a whole query has been written
+	answers   bytes.Buffer // Not yet read
+	connect   time.Duration
+	handshake time.Duration
+}
+
+func (c *dohConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	c.written = append(c.written, p...)
+	c.mu.Unlock()
+
+	for {
+		c.mu.Lock()
+		if len(c.written) < 2 || len(c.written) < 2+int(binary.BigEndian.Uint16(c.written)) {
+			c.mu.Unlock()
+			return len(p), nil
+		}
+		length := int(binary.BigEndian.Uint16(c.written))
+		query := c.written[2 : 2+length]
+		c.written = c.written[2+length:]
+		c.mu.Unlock()
+
+		if err := c.exchange(query); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// exchange POSTs query to the resolver and buffers its answer to be read.
+func (c *dohConn) exchange(query []byte) error {
+	ctx := context.Background()
+	c.mu.Lock()
+	deadline := c.deadline
+	c.mu.Unlock()
+	if !deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	var connectStart, tlsStart time.Time
+	var connect, handshake time.Duration
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		ConnectStart: func(network, addr string) {
+			if connectStart.IsZero() {
+				connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err == nil && connect == 0 {
+				connect = time.Since(connectStart)
+			}
+		},
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			handshake = time.Since(tlsStart)
+		},
+	})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(query))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", dohMessageType)
+	req.Header.Set("Accept", dohMessageType)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error querying DNS over HTTPS resolver %s: %w", c.url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error querying DNS over HTTPS resolver %s: %s", c.url, resp.Status)
+	}
+	answer, err := ioutil.ReadAll(io.LimitReader(resp.Body, 0xffff))
+	if err != nil {
+		return fmt.Errorf("error reading answer of DNS over HTTPS resolver %s: %w", c.url, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var length [2]byte
+	binary.BigEndian.PutUint16(length[:], uint16(len(answer)))
+	c.answers.Write(length[:])
+	c.answers.Write(answer)
+	c.connect, c.handshake = connect, handshake
+	return nil
+}
+
+func (c *dohConn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.answers.Len() == 0 {
+		// Every query is answered as it is written, so there is nothing more
+		// to wait for
+		return 0, dohTimeout{}
+	}
+	return c.answers.Read(p)
+}
+
+func (c *dohConn) resolverName() string {
+	return c.url
+}
+
+func (c *dohConn) setup() (time.Duration, time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	connect, handshake := c.connect, c.handshake
+	c.connect, c.handshake = 0, 0
+	return connect, handshake
+}
+
+func (c *dohConn) Close() error                       { return nil }
+func (c *dohConn) LocalAddr() net.Addr                { return dohAddr("local") }
+func (c *dohConn) RemoteAddr() net.Addr               { return dohAddr(c.url) }
+func (c *dohConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *dohConn) SetWriteDeadline(t time.Time) error { return c.SetDeadline(t) }
+
+func (c *dohConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.deadline = t
+	c.mu.Unlock()
+	return nil
+}
+
+// dohAddr is the address of either end of a dohConn.
+type dohAddr string
+
+func (a dohAddr) Network() string { return "https" }
+func (a dohAddr) String() string  { return string(a) }
+
+// dohTimeout is the error of reading from a dohConn with no answer to read.
+type dohTimeout struct{}
+
+func (dohTimeout) Error() string   { return "no answer from DNS over HTTPS resolver" }
+func (dohTimeout) Timeout() bool   { return true }
+func (dohTimeout) Temporary() bool { return true }
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/berndhartzer/http-trace/trace"
+)
+
+// The exit codes of http-trace, so scripts can tell what went wrong without
+// parsing its output. A request which failed before its response exits with
+// exitNetworkError or exitTimeout plus the offset of the phase it failed in.
+const (
+	exitFailed       = 1  // Any other failure, such as an assertion which didn't hold
+	exitClientError  = 4  // A 4xx response, with -fail
+	exitServerError  = 5  // A 5xx response, with -fail
+	exitNetworkError = 10 // 10 resolving the host, 11 connecting, 12 the TLS handshake, 13 sending the request or waiting for the response
+	exitTimeout      = 20 // 20 to 23, in the same phases
+)
+
+// phaseExitOffsets are added to exitNetworkError and exitTimeout for the
+// phase a request failed in. The other phases, writing the request and
+// waiting for the response, have the offset 3.
+var phaseExitOffsets = map[string]int{
+	"dns":        0,
+	"connection": 1,
+	"connect":    1,
+	"tls":        2,
+}
+
+// statusError is the error of a request whose response had a 4xx or 5xx
+// status, with -fail.
+type statusError struct {
+	status string
+	code   int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("the server answered %s", e.status)
+}
+
+// exitCode returns the exit code for the error of a request.
+func exitCode(err error) int {
+	var status *statusError
+	if errors.As(err, &status) {
+		if status.code >= 500 {
+			return exitServerError
+		}
+		return exitClientError
+	}
+
+	var send *trace.SendError
+	if errors.As(err, &send) {
+		offset, ok := phaseExitOffsets[send.Phase]
+		if !ok {
+			offset = 3
+		}
+		if send.Timeout() {
+			return exitTimeout + offset
+		}
+		return exitNetworkError + offset
+	}
+	return exitFailed
+}
+
+// worseExit returns the code to exit with after failures with the codes a
+// and b: the higher, so a failure to connect outweighs an error status.
+func worseExit(a, b int) int {
+	if b > a {
+		return b
+	}
+	return a
+}
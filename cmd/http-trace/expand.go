@@ -0,0 +1,177 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// envReference matches a ${NAME} reference to an environment variable.
+	envReference = regexp.MustCompile(`\${([A-Za-z_][A-Za-z0-9_]*)}`)
+	// placeholder matches one of the built in {{name}} placeholders, with
+	// its arguments, such as {{randInt 1 100}}.
+	placeholder = regexp.MustCompile(`{{\s*(uuid|now|timestamp|timestampMs|randomInt|randInt|randString|randHex)((?:\s+[^\s{}]+)*)\s*}}`)
+)
+
+// placeholders generate the value of each built in placeholder from its
+// arguments, which is different for every request.
+var placeholders = map[string]func(args []string) (string, error){
+	"uuid": noArgs(newUUID),
+	"now": noArgs(func() string {
+		return time.Now().UTC().Format(time.RFC3339)
+	}),
+	"timestamp": noArgs(func() string {
+		return strconv.FormatInt(time.Now().Unix(), 10)
+	}),
+	"timestampMs": noArgs(func() string {
+		return strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+	}),
+	"randomInt": noArgs(func() string {
+		n, _ := rand.Int(rand.Reader, big.NewInt(1000000))
+		return n.String()
+	}),
+	"randInt":    randInt,
+	"randString": randomText("0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"),
+	"randHex":    randomText("0123456789abcdef"),
+}
+
+// noArgs makes a placeholder of generate, which takes no arguments.
+func noArgs(generate func() string) func(args []string) (string, error) {
+	return func(args []string) (string, error) {
+		if len(args) > 0 {
+			return "", fmt.Errorf("expected no arguments")
+		}
+		return generate(), nil
+	}
+}
+
+// randInt generates a random number from the first argument to the second,
+// inclusive.
+func randInt(args []string) (string, error) {
+	if len(args) != 2 {
+		return "", fmt.Errorf("expected a minimum and maximum, such as {{randInt 1 100}}")
+	}
+	min, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid minimum %q", args[0])
+	}
+	max, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || max < min {
+		return "", fmt.Errorf("invalid maximum %q, expected a number of at least %d", args[1], min)
+	}
+	n, err := rand.Int(rand.Reader, new(big.Int).Add(new(big.Int).Sub(big.NewInt(max), big.NewInt(min)), big.NewInt(1)))
+	if err != nil {
+		return "", err
+	}
+	return new(big.Int).Add(n, big.NewInt(min)).String(), nil
+}
+
+// randomText makes a placeholder generating as many random characters from
+// alphabet as its argument.
+func randomText(alphabet string) func(args []string) (string, error) {
+	return func(args []string) (string, error) {
+		if len(args) != 1 {
+			return "", fmt.Errorf("expected a length, such as 16")
+		}
+		length, err := strconv.Atoi(args[0])
+		if err != nil || length < 0 || length > maxRandomLength {
+			return "", fmt.Errorf("invalid length %q, expected a number from 0 to %d", args[0], maxRandomLength)
+		}
+		b := make([]byte, length)
+		for i := range b {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+			if err != nil {
+				return "", err
+			}
+			b[i] = alphabet[n.Int64()]
+		}
+		return string(b), nil
+	}
+}
+
+// maxRandomLength is the longest text {{randString}} and {{randHex}}
+// generate, to keep a typo from making a huge body.
+const maxRandomLength = 1 << 20
+
+// expand replaces ${NAME} with the value of the environment variable, which
+// must be set, and the built in placeholders with new values.
+func expand(s string) (string, error) {
+	var missing string
+	s = envReference.ReplaceAllStringFunc(s, func(ref string) string {
+		name := envReference.FindStringSubmatch(ref)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok && missing == "" {
+			missing = name
+		}
+		return value
+	})
+	if missing != "" {
+		return "", fmt.Errorf("environment variable %s is not set", missing)
+	}
+
+	var invalid error
+	s = placeholder.ReplaceAllStringFunc(s, func(ref string) string {
+		m := placeholder.FindStringSubmatch(ref)
+		value, err := placeholders[m[1]](strings.Fields(m[2]))
+		if err != nil && invalid == nil {
+			invalid = fmt.Errorf("invalid placeholder %s: %v", ref, err)
+		}
+		return value
+	})
+	if invalid != nil {
+		return "", invalid
+	}
+	return s, nil
+}
+
+// expandRequest expands the URL, headers and body, unless it is binary, of
+// target, and adds the expanded -url-query parameters to the URL.
+func expandRequest(target request) (request, error) {
+	expanded := request{method: target.method, binary: target.binary, proxied: target.proxied, client: target.client, response: target.response}
+
+	var err error
+	expanded.url, err = expand(target.url)
+	if err != nil {
+		return target, fmt.Errorf("error expanding url: %w", err)
+	}
+	for _, h := range target.headers {
+		value, err := expand(h)
+		if err != nil {
+			return target, fmt.Errorf("error expanding header: %w", err)
+		}
+		expanded.headers = append(expanded.headers, value)
+	}
+	expanded.body = target.body
+	if !target.binary {
+		expanded.body, err = expand(target.body)
+		if err != nil {
+			return target, fmt.Errorf("error expanding body: %w", err)
+		}
+	}
+	params := []string{}
+	for _, p := range target.query {
+		value, err := expand(p)
+		if err != nil {
+			return target, fmt.Errorf("error expanding -url-query: %w", err)
+		}
+		params = append(params, value)
+	}
+	expanded.url = addURLQuery(expanded.url, params)
+
+	return expanded, nil
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
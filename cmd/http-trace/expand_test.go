@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	type testExpand struct {
+		raw           string
+		env           map[string]string
+		expected      string // A regular expression, as the placeholders are random
+		expectedError string
+	}
+
+	tests := map[string]testExpand{
+		"will leave text without placeholders": {
+			raw:      `{"name": "{{thing}}"}`,
+			expected: `^\{"name": "\{\{thing\}\}"\}$`,
+		},
+		"will substitute environment variables": {
+			raw:      "https://${HTTP_TRACE_TEST_HOST}/things?token=${HTTP_TRACE_TEST_TOKEN}&empty=${HTTP_TRACE_TEST_EMPTY}",
+			env:      map[string]string{"HTTP_TRACE_TEST_HOST": "thing.com", "HTTP_TRACE_TEST_TOKEN": "abc", "HTTP_TRACE_TEST_EMPTY": ""},
+			expected: `^https://thing\.com/things\?token=abc&empty=$`,
+		},
+		"will leave references which aren't variables": {
+			raw:      "$HTTP_TRACE_TEST_HOST ${1} ${}",
+			env:      map[string]string{"HTTP_TRACE_TEST_HOST": "thing.com"},
+			expected: `^\$HTTP_TRACE_TEST_HOST \$\{1\} \$\{\}$`,
+		},
+		"will substitute variables along with placeholders": {
+			raw:      "${HTTP_TRACE_TEST_HOST}/{{randInt 7 7}}",
+			env:      map[string]string{"HTTP_TRACE_TEST_HOST": "thing.com"},
+			expected: `^thing\.com/7$`,
+		},
+		"will fail for a variable which isn't set": {
+			raw:           "${HTTP_TRACE_TEST_HOST}/${HTTP_TRACE_TEST_UNSET}",
+			env:           map[string]string{"HTTP_TRACE_TEST_HOST": "thing.com"},
+			expectedError: "environment variable HTTP_TRACE_TEST_UNSET is not set",
+		},
+		"will generate a uuid": {
+			raw:      "id={{uuid}}",
+			expected: `^id=[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`,
+		},
+		"will generate the time": {
+			raw:      "{{now}} {{timestamp}} {{timestampMs}} {{randomInt}}",
+			expected: `^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\dZ \d{10} \d{13} \d{1,6}$`,
+		},
+		"will generate a number in a range": {
+			raw:      "{{randInt 5 5}} {{ randInt -3 -3 }}",
+			expected: `^5 -3$`,
+		},
+		"will generate random text": {
+			raw:      "{{randString 12}}/{{randHex 8}}/{{randHex 0}}",
+			expected: `^[0-9A-Za-z]{12}/[0-9a-f]{8}/$`,
+		},
+		"will fail for arguments to a placeholder without any": {
+			raw:           "{{uuid 4}}",
+			expectedError: "invalid placeholder {{uuid 4}}: expected no arguments",
+		},
+		"will fail for a range without a maximum": {
+			raw:           "{{randInt 1}}",
+			expectedError: "invalid placeholder {{randInt 1}}: expected a minimum and maximum, such as {{randInt 1 100}}",
+		},
+		"will fail for a minimum which isn't a number": {
+			raw:           "{{randInt one 100}}",
+			expectedError: `invalid placeholder {{randInt one 100}}: invalid minimum "one"`,
+		},
+		"will fail for a reversed range": {
+			raw:           "{{randInt 10 1}}",
+			expectedError: `invalid placeholder {{randInt 10 1}}: invalid maximum "1", expected a number of at least 10`,
+		},
+		"will fail for text without a length": {
+			raw:           "{{randString}}",
+			expectedError: "invalid placeholder {{randString}}: expected a length, such as 16",
+		},
+		"will fail for a length which isn't a number": {
+			raw:           "{{randHex many}}",
+			expectedError: `invalid placeholder {{randHex many}}: invalid length "many", expected a number from 0 to 1048576`,
+		},
+		"will fail for a negative length": {
+			raw:           "{{randString -1}}",
+			expectedError: `invalid placeholder {{randString -1}}: invalid length "-1", expected a number from 0 to 1048576`,
+		},
+		"will fail for a length which is too long": {
+			raw:           "{{randString 1048577}}",
+			expectedError: `invalid placeholder {{randString 1048577}}: invalid length "1048577", expected a number from 0 to 1048576`,
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			for key, value := range cfg.env {
+				os.Setenv(key, value)
+				defer os.Unsetenv(key)
+			}
+
+			got, err := expand(cfg.raw)
+			if cfg.expectedError != "" {
+				if err == nil || err.Error() != cfg.expectedError {
+					t.Errorf("Unexpected error: got %v, want %q", err, cfg.expectedError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Error expanding: %v", err)
+			}
+			if !regexp.MustCompile(cfg.expected).MatchString(got) {
+				t.Errorf("Unexpected expansion: got %q, want a match of %s", got, cfg.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// formContentType is the Content-Type of a body built from several -d flags,
+// or with -data-urlencode.
+const formContentType = "application/x-www-form-urlencoded"
+
+// formField is a field of a request body, given with -d to be sent as it is
+// or with -data-urlencode to be URL-encoded.
+type formField struct {
+	data   string
+	encode bool
+}
+
+// formFields are the -d and -data-urlencode fields, in the order given.
+type formFields []formField
+
+// isForm reports whether the fields make a form: more than one, or any to
+// URL-encode.
+func (f formFields) isForm() bool {
+	for _, field := range f {
+		if field.encode {
+			return true
+		}
+	}
+	return len(f) > 1
+}
+
+// formFlag is the flag.Value of -d or -data-urlencode, adding each value to
+// the same fields so their order is kept.
+type formFlag struct {
+	fields *formFields
+	encode bool
+}
+
+func (f formFlag) String() string {
+	return ""
+}
+
+func (f formFlag) Set(value string) error {
+	*f.fields = append(*f.fields, formField{data: value, encode: f.encode})
+	return nil
+}
+
+// dataBody returns the request body given with -d and -data-urlencode: the
+// fields joined with & like curl joins them, each -d as it is and each
+// -data-urlencode URL-encoded.
+func dataBody(fields formFields) string {
+	data := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if !field.encode {
+			data = append(data, field.data)
+			continue
+		}
+		data = append(data, urlEncodeField(field.data))
+	}
+	return strings.Join(data, "&")
+}
+
+// urlEncodeField URL-encodes a -data-urlencode field like curl: content is
+// encoded as a whole, =content is encoded without the =, and name=content
+// keeps the name as it is and encodes the content. Spaces are encoded as %20
+// as curl does, rather than +.
+func urlEncodeField(field string) string {
+	split := strings.SplitN(field, "=", 2)
+	if len(split) == 1 {
+		return escapeFormValue(field)
+	}
+	if split[0] == "" {
+		return escapeFormValue(split[1])
+	}
+	return split[0] + "=" + escapeFormValue(split[1])
+}
+
+// escapeFormValue escapes all but the unreserved characters of s.
+func escapeFormValue(s string) string {
+	// QueryEscape encodes a + as %2B, so those left were spaces
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
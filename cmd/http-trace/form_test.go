@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDataBody(t *testing.T) {
+	type testDataBody struct {
+		fields         formFields
+		expected       string
+		expectedIsForm bool
+	}
+
+	tests := map[string]testDataBody{
+		"will send nothing without data": {
+			expected: "",
+		},
+		"will send a single -d as it is": {
+			fields:   formFields{{data: `{"name": "Jane Doe"}`}},
+			expected: `{"name": "Jane Doe"}`,
+		},
+		"will join several -d as they are": {
+			fields:         formFields{{data: "name=Jane Doe"}, {data: "note=fish%20%26%20chips"}},
+			expected:       "name=Jane Doe&note=fish%20%26%20chips",
+			expectedIsForm: true,
+		},
+		"will encode the content of a name": {
+			fields:         formFields{{data: "note=fish & chips=1+1", encode: true}},
+			expected:       "note=fish%20%26%20chips%3D1%2B1",
+			expectedIsForm: true,
+		},
+		"will encode content without a name": {
+			fields:         formFields{{data: "=a b", encode: true}, {data: "a&b", encode: true}},
+			expected:       "a%20b&a%26b",
+			expectedIsForm: true,
+		},
+		"will keep the unreserved characters": {
+			fields:         formFields{{data: "AZaz09-._~", encode: true}},
+			expected:       "AZaz09-._~",
+			expectedIsForm: true,
+		},
+		"will join -d and -data-urlencode in order": {
+			fields:         formFields{{data: "plan=basic"}, {data: "name=Jane Doe", encode: true}, {data: "a=1"}},
+			expected:       "plan=basic&name=Jane%20Doe&a=1",
+			expectedIsForm: true,
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			got := dataBody(cfg.fields)
+			if got != cfg.expected {
+				t.Errorf("Unexpected body: got %q, want %q", got, cfg.expected)
+			}
+			if cfg.fields.isForm() != cfg.expectedIsForm {
+				t.Errorf("Unexpected form: got %v, want %v", cfg.fields.isForm(), cfg.expectedIsForm)
+			}
+		})
+	}
+}
+
+func TestFormFlag(t *testing.T) {
+	var fields formFields
+	data := formFlag{fields: &fields}
+	urlencode := formFlag{fields: &fields, encode: true}
+
+	data.Set("a=1")
+	urlencode.Set("b=2 3")
+	data.Set("c")
+
+	expected := "a=1&b=2%203&c"
+	if got := dataBody(fields); got != expected {
+		t.Errorf("Unexpected body: got %q, want %q", got, expected)
+	}
+}
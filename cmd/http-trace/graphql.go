@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// graphQLBody returns the JSON body of a GraphQL request sending query, which
+// is read from a file when it starts with @ (or from stdin for @-), with
+// variables, a JSON object which may be empty.
+func graphQLBody(query, variables string) (string, error) {
+	if strings.HasPrefix(query, "@") {
+		var raw []byte
+		var err error
+		if query == "@-" {
+			raw, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			raw, err = ioutil.ReadFile(query[1:])
+		}
+		if err != nil {
+			return "", fmt.Errorf("error reading GraphQL query: %w", err)
+		}
+		query = string(raw)
+	}
+	if strings.TrimSpace(query) == "" {
+		return "", fmt.Errorf("the GraphQL query is empty")
+	}
+
+	body := struct {
+		Query     string                 `json:"query"`
+		Variables map[string]interface{} `json:"variables,omitempty"`
+	}{Query: query}
+	if strings.TrimSpace(variables) != "" {
+		err := json.Unmarshal([]byte(variables), &body.Variables)
+		if err != nil {
+			return "", fmt.Errorf("error parsing -variables as a JSON object: %w", err)
+		}
+	}
+
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return "", fmt.Errorf("error encoding GraphQL request: %w", err)
+	}
+	return string(raw), nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// headerField matches a "Name: value" header, the space after the colon
+// being optional.
+var headerField = regexp.MustCompile(`^[A-Za-z0-9!#$%&'*+.^_|~-]+:`)
+
+// loadHeaders returns the -H headers with each @file replaced by the headers
+// read from the file (or from stdin for @-), so large or secret headers can
+// be kept out of the command line. A header file has a "Name: value" header
+// per line, and blank lines and lines starting with # are ignored.
+func loadHeaders(headers []string) ([]string, error) {
+	loaded := []string{}
+	for _, h := range headers {
+		if !strings.HasPrefix(h, "@") {
+			if !headerField.MatchString(strings.TrimSpace(h)) {
+				return nil, fmt.Errorf("invalid -H %q, expected 'Name: value' or @file", h)
+			}
+			loaded = append(loaded, h)
+			continue
+		}
+
+		var raw []byte
+		var err error
+		if h == "@-" {
+			raw, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			raw, err = ioutil.ReadFile(h[1:])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading header file: %w", err)
+		}
+		for i, line := range strings.Split(string(raw), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			// The line isn't shown, as header files are meant for secrets
+			if !headerField.MatchString(line) {
+				return nil, fmt.Errorf("error in header file %s line %d: expected 'Name: value'", h[1:], i+1)
+			}
+			loaded = append(loaded, line)
+		}
+	}
+	return loaded, nil
+}
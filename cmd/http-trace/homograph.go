@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// hostScripts are the scripts told apart in the labels of a host, to notice
+// labels mixing them.
+var hostScripts = []struct {
+	name  string
+	table *unicode.RangeTable
+}{
+	{"Latin", unicode.Latin},
+	{"Greek", unicode.Greek},
+	{"Cyrillic", unicode.Cyrillic},
+	{"Armenian", unicode.Armenian},
+	{"Hebrew", unicode.Hebrew},
+	{"Arabic", unicode.Arabic},
+	{"Devanagari", unicode.Devanagari},
+	{"Thai", unicode.Thai},
+	{"Georgian", unicode.Georgian},
+	{"Cherokee", unicode.Cherokee},
+	{"Hangul", unicode.Hangul},
+	{"Hiragana", unicode.Hiragana},
+	{"Katakana", unicode.Katakana},
+	{"Bopomofo", unicode.Bopomofo},
+	{"Han", unicode.Han},
+}
+
+// cjkScripts are the mixes of scripts a name is commonly written in, as for
+// Japanese, Chinese and Korean, which aren't taken as a sign of a lookalike.
+var cjkScripts = [][]string{
+	{"Latin", "Han", "Hiragana", "Katakana"},
+	{"Latin", "Han", "Bopomofo"},
+	{"Latin", "Han", "Hangul"},
+}
+
+// latinLookalikes are Cyrillic and Greek letters which look like Latin ones.
+var latinLookalikes = map[rune]rune{
+	'а': 'a', 'с': 'c', 'ԁ': 'd', 'е': 'e', 'һ': 'h', 'і': 'i', 'ј': 'j', 'ӏ': 'l',
+	'о': 'o', 'р': 'p', 'ԛ': 'q', 'ѕ': 's', 'у': 'y', 'ү': 'y', 'х': 'x', 'ԝ': 'w',
+	'α': 'a', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'υ': 'u', 'χ': 'x',
+}
+
+// homographWarning returns a warning if a label of host, in its Unicode form,
+// mixes scripts or is made up of letters which look like Latin ones, as a
+// lookalike of another name would be, such as pаypal with a Cyrillic а.
+func homographWarning(host string) string {
+	for _, label := range strings.Split(host, ".") {
+		scripts := labelScripts(label)
+		if len(scripts) > 1 && !commonScriptMix(scripts) {
+			return fmt.Sprintf("host %s mixes %s characters in %q, which may make it a lookalike of %q", host, strings.Join(scripts, " and "), label, latinSkeleton(label))
+		}
+		if len(scripts) == 1 && scripts[0] != "Latin" {
+			if skeleton := latinSkeleton(label); isASCII(skeleton) {
+				return fmt.Sprintf("host %s is written in %s characters in %q which look like the Latin %q", host, scripts[0], label, skeleton)
+			}
+		}
+	}
+	return ""
+}
+
+// labelScripts returns the scripts of the letters of label, in the order
+// they first appear.
+func labelScripts(label string) []string {
+	scripts := []string{}
+	seen := map[string]bool{}
+	for _, r := range label {
+		for _, s := range hostScripts {
+			if unicode.Is(s.table, r) {
+				if !seen[s.name] {
+					seen[s.name] = true
+					scripts = append(scripts, s.name)
+				}
+				break
+			}
+		}
+	}
+	return scripts
+}
+
+func commonScriptMix(scripts []string) bool {
+	for _, mix := range cjkScripts {
+		inMix := true
+		for _, s := range scripts {
+			if !containsString(mix, s) {
+				inMix = false
+				break
+			}
+		}
+		if inMix {
+			return true
+		}
+	}
+	return false
+}
+
+// latinSkeleton returns label with its letters which look like Latin ones
+// replaced by them.
+func latinSkeleton(label string) string {
+	return strings.Map(func(r rune) rune {
+		if latin, ok := latinLookalikes[r]; ok {
+			return latin
+		}
+		return r
+	}, label)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
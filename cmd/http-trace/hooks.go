@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/berndhartzer/http-trace/report"
+)
+
+// hookRunner runs external commands with a result as JSON on stdin. Hooks run
+// in the background one at a time, so hooks triggered by concurrent requests
+// never overlap, and each is killed if it runs longer than timeout.
+type hookRunner struct {
+	onComplete string
+	onFailure  string
+	timeout    time.Duration
+
+	mu sync.Mutex
+	wg sync.WaitGroup
+}
+
+// Run starts the hook for a result: onFailure when failed is true, otherwise
+// onComplete.
+func (h *hookRunner) Run(result *report.Result, failed bool) {
+	command := h.onComplete
+	if failed {
+		command = h.onFailure
+	}
+	if command == "" {
+		return
+	}
+
+	input, err := json.Marshal(result)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error encoding hook input: %v\n", err)
+		return
+	}
+
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		err := runHook(command, input, h.timeout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error running hook %q: %v\n", command, err)
+		}
+	}()
+}
+
+// Wait blocks until all started hooks have finished.
+func (h *hookRunner) Wait() {
+	h.wg.Wait()
+}
+
+func runHook(command string, input []byte, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %v", timeout)
+	}
+	return err
+}
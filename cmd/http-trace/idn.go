@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Parameters of the Punycode encoding of internationalized domain names (RFC
+// 3492 section 5).
+const (
+	punyBase        = 36
+	punyTMin        = 1
+	punyTMax        = 26
+	punySkew        = 38
+	punyDamp        = 700
+	punyInitialBias = 72
+	punyInitialN    = 128
+	punyPrefix      = "xn--"
+)
+
+// idnDots are the characters other than "." which separate the labels of an
+// internationalized domain name.
+var idnDots = strings.NewReplacer("。", ".", "．", ".", "｡", ".")
+
+// asciiURL returns rawURL with an internationalized host converted to its
+// ASCII form, so the name that is resolved, sent in the Host header and
+// matched by -connect-to is the same one shown in the report. URLs which
+// don't parse are returned as they are, to fail when they are sent.
+func asciiURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || isASCII(u.Host) {
+		return rawURL, nil
+	}
+
+	host, err := idnToASCII(u.Hostname())
+	if err != nil {
+		return "", err
+	}
+	if port := u.Port(); port != "" {
+		host = net.JoinHostPort(host, port)
+	}
+	u.Host = host
+	return u.String(), nil
+}
+
+// idnToASCII converts host to the ASCII form used by DNS, with each label
+// which isn't ASCII Punycode encoded after a prefix of xn--.
+func idnToASCII(host string) (string, error) {
+	host = norm.NFC.String(strings.ToLower(idnDots.Replace(host)))
+	labels := strings.Split(host, ".")
+	for i, label := range labels {
+		if isASCII(label) {
+			continue
+		}
+		encoded, err := punycodeEncode(label)
+		if err != nil {
+			return "", fmt.Errorf("invalid internationalized host %q: %w", host, err)
+		}
+		labels[i] = punyPrefix + encoded
+		if len(labels[i]) > 63 {
+			return "", fmt.Errorf("invalid internationalized host %q: label %q is longer than 63 characters", host, label)
+		}
+	}
+	return strings.Join(labels, "."), nil
+}
+
+// idnToUnicode returns the Unicode form of host, decoding each label with a
+// prefix of xn--. Labels which aren't valid Punycode are left as they are.
+func idnToUnicode(host string) string {
+	labels := strings.Split(host, ".")
+	for i, label := range labels {
+		if !strings.HasPrefix(strings.ToLower(label), punyPrefix) {
+			continue
+		}
+		decoded, err := punycodeDecode(label[len(punyPrefix):])
+		if err == nil {
+			labels[i] = decoded
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+// isIDN reports whether host has a Punycode encoded label.
+func isIDN(host string) bool {
+	for _, label := range strings.Split(host, ".") {
+		if strings.HasPrefix(strings.ToLower(label), punyPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// punyAdapt is the bias adaptation function of RFC 3492 section 6.1.
+func punyAdapt(delta, points int, first bool) int {
+	if first {
+		delta /= punyDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / points
+	k := 0
+	for delta > ((punyBase-punyTMin)*punyTMax)/2 {
+		delta /= punyBase - punyTMin
+		k += punyBase
+	}
+	return k + (punyBase-punyTMin+1)*delta/(delta+punySkew)
+}
+
+// punyThreshold returns the threshold of the digit at position k.
+func punyThreshold(k, bias int) int {
+	switch {
+	case k <= bias:
+		return punyTMin
+	case k >= bias+punyTMax:
+		return punyTMax
+	}
+	return k - bias
+}
+
+func punyDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+// punycodeEncode encodes label with Punycode (RFC 3492 section 6.3), without
+// the xn-- prefix.
+func punycodeEncode(label string) (string, error) {
+	runes := []rune(label)
+	out := []byte{}
+	for _, r := range runes {
+		if r < utf8.RuneSelf {
+			out = append(out, byte(r))
+		}
+	}
+	basic := len(out)
+	if basic > 0 {
+		out = append(out, '-')
+	}
+
+	n, delta, bias := punyInitialN, 0, punyInitialBias
+	for handled := basic; handled < len(runes); {
+		// The smallest code point not yet handled
+		m := int(unicode.MaxRune) + 1
+		for _, r := range runes {
+			if int(r) >= n && int(r) < m {
+				m = int(r)
+			}
+		}
+		if (m-n)*(handled+1) < 0 {
+			return "", fmt.Errorf("label %q is too long to encode", label)
+		}
+		delta += (m - n) * (handled + 1)
+		n = m
+
+		for _, r := range runes {
+			if int(r) < n {
+				delta++
+			}
+			if int(r) != n {
+				continue
+			}
+			q := delta
+			for k := punyBase; ; k += punyBase {
+				t := punyThreshold(k, bias)
+				if q < t {
+					break
+				}
+				out = append(out, punyDigit(t+(q-t)%(punyBase-t)))
+				q = (q - t) / (punyBase - t)
+			}
+			out = append(out, punyDigit(q))
+			bias = punyAdapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+		delta++
+		n++
+	}
+	return string(out), nil
+}
+
+// punycodeDecode decodes a label encoded with Punycode (RFC 3492 section
+// 6.2), without the xn-- prefix.
+func punycodeDecode(encoded string) (string, error) {
+	var out []rune
+	rest := encoded
+	if i := strings.LastIndex(encoded, "-"); i >= 0 {
+		for _, r := range encoded[:i] {
+			if r >= utf8.RuneSelf {
+				return "", fmt.Errorf("invalid Punycode %q", encoded)
+			}
+			out = append(out, r)
+		}
+		rest = encoded[i+1:]
+	}
+
+	n, i, bias := punyInitialN, 0, punyInitialBias
+	for pos := 0; pos < len(rest); {
+		oldI, w := i, 1
+		for k := punyBase; ; k += punyBase {
+			if pos >= len(rest) {
+				return "", fmt.Errorf("invalid Punycode %q", encoded)
+			}
+			c := rest[pos]
+			pos++
+			var digit int
+			switch {
+			case c >= 'a' && c <= 'z':
+				digit = int(c - 'a')
+			case c >= 'A' && c <= 'Z':
+				digit = int(c - 'A')
+			case c >= '0' && c <= '9':
+				digit = int(c-'0') + 26
+			default:
+				return "", fmt.Errorf("invalid Punycode %q", encoded)
+			}
+			i += digit * w
+			t := punyThreshold(k, bias)
+			if digit < t {
+				break
+			}
+			w *= punyBase - t
+			if i < 0 || w <= 0 {
+				return "", fmt.Errorf("invalid Punycode %q", encoded)
+			}
+		}
+		bias = punyAdapt(i-oldI, len(out)+1, oldI == 0)
+		n += i / (len(out) + 1)
+		i %= len(out) + 1
+		if n > unicode.MaxRune {
+			return "", fmt.Errorf("invalid Punycode %q", encoded)
+		}
+		out = append(out[:i], append([]rune{rune(n)}, out[i:]...)...)
+		i++
+	}
+	return string(out), nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/berndhartzer/http-trace/sink"
+)
+
+// integration is an optional subsystem, such as publishing results to a
+// cloud provider or message broker, which is only compiled in with its build
+// tag (or full) so the default binary stays small. Each registers itself
+// from the init function of a file built with its tag.
+type integration struct {
+	tag         string
+	defineFlags func()
+	// sinks creates the sinks for the flags given, each request with a timeout
+	sinks func(timeout time.Duration) ([]sink.Sink, error)
+}
+
+// optionalIntegrations are the build tags of the optional integrations, with
+// their flags, which builds without them reject naming the tag needed.
+var optionalIntegrations = []struct {
+	tag   string
+	flags []string
+}{
+	{"cloud", []string{"cloudwatch", "cloudwatch-region", "gcp-monitoring", "label"}},
+	{"publish", []string{"publish", "publish-batch", "publish-interval"}},
+}
+
+var integrations = map[string]*integration{}
+
+func registerIntegration(i *integration) {
+	integrations[i.tag] = i
+}
+
+// defineIntegrationFlags defines the flags of the integrations compiled in,
+// and for the others flags which fail naming the build tag they need.
+func defineIntegrationFlags() {
+	for _, o := range optionalIntegrations {
+		if i, ok := integrations[o.tag]; ok {
+			i.defineFlags()
+			continue
+		}
+
+		tag := o.tag
+		for _, name := range o.flags {
+			name := name
+			flag.Func(name, fmt.Sprintf("Not built in, needs a build with -tags %s or full", tag), func(string) error {
+				return fmt.Errorf("-%s is not built in, build http-trace with -tags %s or full", name, tag)
+			})
+		}
+	}
+}
+
+// integrationSinks creates the sinks of the integrations compiled in, in the
+// order of optionalIntegrations.
+func integrationSinks(timeout time.Duration) ([]sink.Sink, error) {
+	sinks := []sink.Sink{}
+	for _, o := range optionalIntegrations {
+		i, ok := integrations[o.tag]
+		if !ok {
+			continue
+		}
+		s, err := i.sinks(timeout)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s...)
+	}
+	return sinks, nil
+}
@@ -0,0 +1,74 @@
+//go:build cloud || full
+// +build cloud full
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/berndhartzer/http-trace/sink"
+)
+
+func init() {
+	var cloudWatchNamespace, cloudWatchRegion string
+	var gcpProject string
+	var labels stringSlice
+
+	registerIntegration(&integration{
+		tag: "cloud",
+		defineFlags: func() {
+			flag.StringVar(&cloudWatchNamespace, "cloudwatch", "", "Publish the timings as custom metrics to CloudWatch in this namespace")
+			flag.StringVar(&cloudWatchRegion, "cloudwatch-region", "", "AWS region to publish -cloudwatch metrics to (defaults to $AWS_REGION)")
+			flag.StringVar(&gcpProject, "gcp-monitoring", "", "Publish the timings as custom metrics to Google Cloud Monitoring in this project")
+			flag.Var(&labels, "label", "Dimension added to -cloudwatch and -gcp-monitoring metrics, such as 'probe=sydney'")
+		},
+		sinks: func(timeout time.Duration) ([]sink.Sink, error) {
+			if len(labels) > 0 && cloudWatchNamespace == "" && gcpProject == "" {
+				return nil, fmt.Errorf("-label requires -cloudwatch or -gcp-monitoring")
+			}
+			metricLabels, err := parseLabels(labels)
+			if err != nil {
+				return nil, err
+			}
+
+			sinks := []sink.Sink{}
+			if cloudWatchNamespace != "" {
+				if cloudWatchRegion == "" {
+					cloudWatchRegion = os.Getenv("AWS_REGION")
+				}
+				if cloudWatchRegion == "" {
+					cloudWatchRegion = os.Getenv("AWS_DEFAULT_REGION")
+				}
+				if cloudWatchRegion == "" {
+					return nil, fmt.Errorf("-cloudwatch needs a region, set with -cloudwatch-region or $AWS_REGION")
+				}
+				cloudClient := &http.Client{Timeout: timeout}
+				sinks = append(sinks, sink.NewCloudWatch(cloudWatchRegion, cloudWatchNamespace, metricLabels, cloudClient))
+			}
+			if gcpProject != "" {
+				cloudClient := &http.Client{Timeout: timeout}
+				sinks = append(sinks, sink.NewGCM(gcpProject, "http_trace", metricLabels, cloudClient))
+			}
+			return sinks, nil
+		},
+	})
+}
+
+// parseLabels parses -label name=value pairs.
+func parseLabels(specs []string) ([][2]string, error) {
+	labels := [][2]string{}
+	for _, spec := range specs {
+		split := strings.SplitN(spec, "=", 2)
+		name := strings.TrimSpace(split[0])
+		if len(split) != 2 || name == "" {
+			return nil, fmt.Errorf("invalid -label %q, expected name=value", spec)
+		}
+		labels = append(labels, [2]string{name, strings.TrimSpace(split[1])})
+	}
+	return labels, nil
+}
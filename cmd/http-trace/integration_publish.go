@@ -0,0 +1,47 @@
+//go:build publish || full
+// +build publish full
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/berndhartzer/http-trace/sink"
+)
+
+func init() {
+	var publishURLs stringSlice
+	var publishBatch int
+	var publishInterval time.Duration
+
+	registerIntegration(&integration{
+		tag: "publish",
+		defineFlags: func() {
+			flag.Var(&publishURLs, "publish", "Publish each result as JSON to kafka://broker[,broker]/topic or nats://[user:password@]host/subject")
+			flag.IntVar(&publishBatch, "publish-batch", sink.DefaultPublishBatch, "Number of results to -publish together")
+			flag.DurationVar(&publishInterval, "publish-interval", sink.DefaultPublishInterval, "Longest a result waits to be published in a partial batch")
+		},
+		sinks: func(timeout time.Duration) ([]sink.Sink, error) {
+			if publishBatch < 1 || publishInterval <= 0 {
+				return nil, fmt.Errorf("-publish-batch and -publish-interval must be positive")
+			}
+
+			sinks := []sink.Sink{}
+			for _, u := range publishURLs {
+				publisher, err := sink.NewPublisher(u, timeout)
+				if err != nil {
+					return nil, err
+				}
+				publisher.SetBatch(publishBatch, publishInterval)
+				publisher.SetErrorHandler(func(err error) {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				})
+				sinks = append(sinks, publisher)
+			}
+			return sinks, nil
+		},
+	})
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"net"
+)
+
+// localAddr returns the address to make connections from for -interface,
+// which is either an IP address or the name of a network interface. Of the
+// addresses of an interface, the first IPv4 one is used if there is one, as
+// connections can only be made to servers of the same IP version.
+func localAddr(spec string) (*net.TCPAddr, error) {
+	if ip := net.ParseIP(spec); ip != nil {
+		return &net.TCPAddr{IP: ip}, nil
+	}
+
+	iface, err := net.InterfaceByName(spec)
+	if err != nil {
+		return nil, fmt.Errorf("error finding interface %q: %w", spec, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("error finding the addresses of interface %q: %w", spec, err)
+	}
+
+	var v6 net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if ipNet.IP.To4() != nil {
+			return &net.TCPAddr{IP: ipNet.IP}, nil
+		}
+		if v6 == nil {
+			v6 = ipNet.IP
+		}
+	}
+	if v6 == nil {
+		return nil, fmt.Errorf("interface %q has no addresses to connect from", spec)
+	}
+	return &net.TCPAddr{IP: v6}, nil
+}
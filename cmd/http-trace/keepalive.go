@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/berndhartzer/http-trace/report"
+	"github.com/berndhartzer/http-trace/trace"
+)
+
+// keepAliveFirstWait is the first idle period tried by -probe-keepalive,
+// which doubles until the connection is closed.
+const keepAliveFirstWait = time.Second
+
+// probeKeepAlive finds out how long the server, or something in between, keeps
+// an idle connection open. It sends target, then sends it again after longer
+// and longer idle periods, up to limit, checking whether the connection was
+// reused. Once one is closed, the timeout is narrowed down between the longest
+// idle period the connection survived and the shortest it didn't.
+func probeKeepAlive(transport *http.Transport, timeout time.Duration, target request, limit time.Duration, redact *report.Redactor, format report.TimeFormat, out io.Writer) error {
+	// The probe's own side mustn't close the connection first
+	probeTransport := transport.Clone()
+	probeTransport.IdleConnTimeout = 0
+	probeTransport.MaxIdleConnsPerHost = 1
+	probeTransport.DisableKeepAlives = false
+	client := &http.Client{Timeout: timeout, Transport: probeTransport}
+	defer probeTransport.CloseIdleConnections()
+
+	send := func() (*trace.Trace, error) {
+		req, err := http.NewRequest(target.method, target.url, strings.NewReader(target.body))
+		if err != nil {
+			return nil, err
+		}
+		tracedRequest := trace.New(client, req)
+		err = tracedRequest.SetHeaders(target.headers)
+		if err != nil {
+			return nil, err
+		}
+		tracedRequest.SetMaxBodyCapture(0)
+		return tracedRequest, tracedRequest.Execute()
+	}
+
+	fmt.Fprintf(out, "Probing how long an idle connection to %s is kept open, for up to %s\n", redact.Redact(target.url), limit)
+	first, err := send()
+	if err != nil {
+		return err
+	}
+	if first.GetResponse().Close {
+		fmt.Fprintf(out, "\nThe server asked for the connection to be closed after the response (Connection: close), so it is never reused\n")
+		return nil
+	}
+
+	var kept, closed time.Duration
+	wait := keepAliveFirstWait
+	for {
+		time.Sleep(wait)
+		tracedRequest, err := send()
+		switch {
+		case err != nil:
+			fmt.Fprintf(out, "  after %8s idle: error: %v\n", wait, redact.Error(err))
+			closed = wait
+		case tracedRequest.GetConnectionReused():
+			fmt.Fprintf(out, "  after %8s idle: reused connection, %s\n", wait, format.Duration(tracedRequest.GetTimings().TotalRequestDuration))
+			kept = wait
+		default:
+			fmt.Fprintf(out, "  after %8s idle: new connection, %s\n", wait, format.Duration(tracedRequest.GetTimings().TotalRequestDuration))
+			closed = wait
+		}
+
+		if closed == 0 {
+			if wait >= limit {
+				break
+			}
+			wait *= 2
+			if wait > limit {
+				wait = limit
+			}
+			continue
+		}
+
+		// Narrow the timeout down to within a second, or a tenth for long ones
+		precision := kept / 10
+		if precision < time.Second {
+			precision = time.Second
+		}
+		if closed-kept <= precision {
+			break
+		}
+		wait = ((kept + closed) / 2).Round(100 * time.Millisecond)
+	}
+
+	fmt.Fprintln(out)
+	switch {
+	case closed == 0:
+		fmt.Fprintf(out, "The connection was reused after every idle period, so it is kept open for longer than %s\n", limit)
+	case kept == 0:
+		fmt.Fprintf(out, "The connection was never reused, it was closed after less than %s idle\n", closed)
+	default:
+		fmt.Fprintf(out, "Idle timeout: between %s and %s\n", kept, closed)
+	}
+	return nil
+}
@@ -0,0 +1,1635 @@
+// Command http-trace sends HTTP requests and reports the time spent in each
+// phase of them, from resolving the host to reading the response body.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/berndhartzer/http-trace/cassette"
+	"github.com/berndhartzer/http-trace/expr"
+	"github.com/berndhartzer/http-trace/jsonbody"
+	"github.com/berndhartzer/http-trace/report"
+	"github.com/berndhartzer/http-trace/scenario"
+	"github.com/berndhartzer/http-trace/schedule"
+	"github.com/berndhartzer/http-trace/sink"
+)
+
+func main() {
+	var method string
+	var requestHeaders stringSlice
+	var urlQuery stringSlice
+	var requestTrailers stringSlice
+	var connectTo stringSlice
+	var iface string
+	var dohURL, dotHost string
+	var redactQuery string
+	var redactHeaders string
+	var redactSecrets bool
+	var ocspCheck bool
+	var requestBody string
+	var requestData formFields
+	var dataBinary string
+	var jsonFields stringSlice
+	var graphQL, graphQLPretty bool
+	var auditSecurity bool
+	var graphQLQuery, graphQLVariables string
+	var timeout int
+	var count, concurrency int
+	var watch time.Duration
+	var rate float64
+	var delay time.Duration
+	var align bool
+	var jitter time.Duration
+	var cronExpr string
+	var summarise, autoN bool
+	var ci string
+	var outputFormat string
+	var pushgateway string
+	var mirror string
+	var pipeTo string
+	var abHeader string
+	var writeOut string
+	var noColor bool
+	var noProgress bool
+	var width int
+	var verbose, events bool
+	var progressJSON bool
+	var explore bool
+	var headOnly bool
+	var longPoll bool
+	var stallTimeout time.Duration
+	var wireDumpDir string
+	var expectContinue bool
+	var printCurl bool
+	var listenAddr string
+	var probeResumptionMode bool
+	var cacheCheck bool
+	var probeKeepAliveLimit time.Duration
+	var keepAlive bool
+	var statusInterval time.Duration
+	var warmup int
+	var expandEnv bool
+	var urlFile string
+	var requestFile string
+	var srvName string
+	var discoverSpec string
+	var discoverAll bool
+	var allIPs bool
+	var colorThresholds string
+	var showSections string
+	var suppressResponseHeaders, suppressResponseBody bool
+	var headerOrder string
+	var keepBody string
+	var groupHeaders bool
+	var noTranscode bool
+	var lineNumbers bool
+	var hexDump bool
+	var bodyGrep string
+	var bodyGrepContext int
+	var metricDefinitions stringSlice
+	var metricsFile string
+	var assertions stringSlice
+	var bodyContains stringSlice
+	var headerAssertions stringSlice
+	var jsonAssertions stringSlice
+	var maxBodyDisplay byteSize = 1 << 20
+	var bodyBudget byteSize
+	var byteRange string
+	var continueAt byteSize
+	var failOverBudget bool
+	var failStatus bool
+	var bodyFile string
+	var reportFile string
+	var appendReport bool
+	var saveBaselinePath, compareBaselinePath string
+	var regressionThreshold string
+	var compareRuns bool
+	var cassettePath string
+	var record, replay bool
+	var faults stringSlice
+	hooks := &hookRunner{}
+	var statsdAddr, statsdPrefix string
+	var statsdTags bool
+	var influxURL, influxToken string
+	var syslogAddr string
+	var notifyURL, notifyTemplate, notifyOn string
+	var notifyRepeat time.Duration
+	transportCfg := &transportConfig{}
+
+	flag.StringVar(&method, "m", "GET", "The HTTP method to use")
+	flag.Var(&urlQuery, "url-query", "Query parameter key=value to URL-encode and add to the url, can be given more than once")
+	flag.Var(&requestHeaders, "H", "HTTP headers to send with the request, or @file to read them from a file with one per line")
+	flag.Var(&requestTrailers, "trailer", "HTTP trailers to send after the request body, such as 'Checksum: abc', which send the body chunked")
+	flag.Var(formFlag{fields: &requestData}, "d", "The HTTP request body data, or given more than once fields of a form joined with & as they are")
+	flag.Var(formFlag{fields: &requestData, encode: true}, "data-urlencode", "A field of a form body to URL-encode, as content, =content or name=content to only encode the content, joined with & with any other -d or -data-urlencode")
+	flag.StringVar(&dataBinary, "data-binary", "", "The HTTP request body, sent exactly as given, or @file to send the bytes of a file, with a Content-Type inferred from it unless one is given with -H")
+	flag.Var(&jsonFields, "json", "Set a field in a JSON request body, such as 'user.name=thing' for a string or 'count:=5' for raw JSON")
+	flag.BoolVar(&graphQL, "graphql", false, "Send a GraphQL request, POSTing the -query and -variables as a JSON body")
+	flag.StringVar(&graphQLQuery, "query", "", "The GraphQL query to send with -graphql, or @file to read it from a file")
+	flag.StringVar(&graphQLVariables, "variables", "", "The variables of the GraphQL query as a JSON object, such as '{\"id\":1}'")
+	flag.BoolVar(&expandEnv, "expand-env", false, "Expand ${VAR} environment variables, and placeholders such as {{uuid}}, {{timestamp}} and {{randInt 1 100}} with new values for each request, in the url, headers and body")
+	flag.BoolVar(&verbose, "v", false, "Write the request and response head as sent over the wire, and each trace event, to stderr")
+	flag.DurationVar(&statusInterval, "status-interval", 0, "Write a status line to stderr at this interval while a request is in progress, such as 5s for long downloads, and show the progression in the report")
+	flag.BoolVar(&events, "events", false, "Write each trace event to stderr as it happens, to see where a request hangs")
+	flag.BoolVar(&headOnly, "I", false, "Stop each request once the response headers are received, without downloading the body (for any method)")
+	flag.BoolVar(&headOnly, "head-only", false, "Same as -I")
+	flag.BoolVar(&longPoll, "long-poll", false, "Expect the server to hold the response open, as for a long poll or hanging GET, so timing out while reading the body is not a failure, and measure the hold and the keep-alive bytes")
+	flag.StringVar(&wireDumpDir, "dump-wire", "", "Save the exact bytes each request sends and receives on the wire to numbered files in this directory, such as 1-sent.raw and 1-received.raw")
+	flag.DurationVar(&stallTimeout, "stall-timeout", 0, "Abort reading the response body if no bytes of it arrive for this long, such as 5s, telling a server which stalls mid-body apart from a body which is just large")
+	flag.BoolVar(&expectContinue, "expect-100", false, "Send request bodies with Expect: 100-continue, and time how long the server takes to approve them")
+	flag.BoolVar(&progressJSON, "progress-json", false, "Write structured progress events, such as phases starting and completing and redirects followed, to stderr as JSON lines")
+	flag.BoolVar(&explore, "explore", false, "Page through a JSON response body, expanding, collapsing and searching it, with the timings kept at the top")
+	flag.BoolVar(&printCurl, "print-curl", false, "Print the curl command sending the same request, instead of sending it")
+	flag.StringVar(&listenAddr, "listen", "localhost:8080", "Address for serve to accept the requests to trace on, as a HTTP proxy")
+	flag.BoolVar(&probeResumptionMode, "probe-resumption", false, "Check whether the server resumes TLS sessions, by comparing a full handshake with one on a second connection offering the session ticket from the first")
+	flag.BoolVar(&cacheCheck, "cache-check", false, "Check cache validation, by sending the request again with If-None-Match and If-Modified-Since from the response, and summarise its caching headers")
+	flag.BoolVar(&keepAlive, "keepalive", false, "Send the -n requests one after another on a single persistent connection, and compare the first, cold, request with the warm ones reusing the connection")
+	flag.DurationVar(&probeKeepAliveLimit, "probe-keepalive", 0, "Find out how long an idle connection is kept open, by reusing it after longer and longer idle periods up to this limit, such as 2m")
+	flag.IntVar(&timeout, "t", 5, "Timeout for the HTTP request in seconds")
+	flag.StringVar(&abHeader, "ab-header", "", "Alternate a header between two values, such as 'X-Feature: on|off', and compare the timings of each (-n sets the number of pairs)")
+	flag.StringVar(&writeOut, "w", "", "Write out a curl style format such as '%{http_code} %{time_total}\\n' instead of the report, or @file to read it from a file")
+	flag.StringVar(&mirror, "mirror", "", "Send a copy of the request to this URL at the same time and compare the responses and timings")
+	flag.StringVar(&pipeTo, "pipe-to", "", "POST the response body to this URL and report both requests and their combined duration")
+	flag.StringVar(&urlFile, "url-file", "", "Trace each of the requests listed in this file, a URL per line optionally preceded by a method and followed by header lines")
+	flag.StringVar(&requestFile, "request-file", "", "Trace the raw HTTP requests in this .http file, sent to the host in the file or to the scheme and host of the url given")
+	flag.StringVar(&srvName, "srv", "", "Send the request to the target of this DNS SRV name, such as _http._tcp.example.com, with the scheme and path of the url if given")
+	flag.StringVar(&discoverSpec, "discover", "", "Send the request to a healthy instance of a service registered in Consul or etcd, such as consul://api or etcd://api, with the scheme and path of the url if given")
+	flag.BoolVar(&allIPs, "all-ips", false, "Resolve the host and send the request to each of its addresses, keeping the Host header and TLS server name, and compare them")
+	flag.BoolVar(&discoverAll, "discover-all", false, "Send the request to every healthy instance found with -discover and compare them")
+	flag.IntVar(&count, "n", 1, "Number of times to send the request (with -watch, 0 for no limit)")
+	flag.IntVar(&warmup, "warmup", 0, "Send the request this many times before the run without recording it, to fill connection pools, TLS session and DNS caches so the statistics reflect the steady state")
+	flag.IntVar(&concurrency, "c", 1, "Number of requests to send concurrently when using -n or -watch")
+	flag.BoolVar(&summarise, "aggregate", false, "Show a summary of the timings of all the requests instead of a report for each")
+	flag.StringVar(&ci, "ci", "95:5%", "Confidence level and precision wanted for the percentiles in the -aggregate summary")
+	flag.BoolVar(&autoN, "auto-n", false, "Send more than -n requests if needed to reach the -ci precision, up to 10000 (implies -aggregate)")
+	flag.Float64Var(&rate, "rate", 0, "Start at most this many requests a second with -n or -watch, such as 0.5 for one every 2 seconds, however many are sent at once with -c")
+	flag.DurationVar(&delay, "delay", 0, "Wait this long after each request before sending the next with -n or -watch, for each of the -c requests sent at once")
+	flag.DurationVar(&watch, "watch", 0, "Send the request repeatedly at this interval until interrupted, or -n requests have been sent")
+	flag.BoolVar(&align, "align", false, "Send the -watch requests at multiples of the interval on the clock, such as at the start of each minute with -watch 1m, to line up with dashboard buckets")
+	flag.DurationVar(&jitter, "jitter", 0, "Delay each -watch or -cron request by a random duration of up to this, so many probes started together don't all send at once")
+	flag.StringVar(&cronExpr, "cron", "", "Send the request at the times of this cron expression, such as '*/5 * * * *', until interrupted, or -n requests have been sent")
+	flag.StringVar(&outputFormat, "output", report.FormatText, "Output format: text, json, jsonl, prom, csv or html")
+	flag.StringVar(&pushgateway, "pushgateway", "", "Push the timings in Prometheus format to this Pushgateway URL")
+	flag.StringVar(&showSections, "show", "", "Sections of the report to show, such as request,trace, out of request, status, headers, body, trace, connection and chunks (default all of them)")
+	flag.StringVar(&headerOrder, "sort-headers", report.HeaderOrderName, "Order to show the response headers in: name, or size for the largest first")
+	flag.BoolVar(&groupHeaders, "group-headers", false, "Show the custom X- response headers after the standard ones")
+	flag.StringVar(&keepBody, "keep-body", "", "What JSON output, sinks and hooks keep of the response body: full, truncated:N for the first N bytes, hash-only for its SHA-256 or none (default full, without recording the policy)")
+	flag.BoolVar(&suppressResponseHeaders, "suppress-headers", false, "Suppress the response headers in the output")
+	flag.BoolVar(&suppressResponseBody, "suppress-body", false, "Suppress the response body in the output")
+	flag.BoolVar(&noTranscode, "no-transcode", false, "Show the response body in its original charset instead of decoding it to UTF-8")
+	flag.BoolVar(&noColor, "no-color", false, "Don't color the report, which is otherwise done when writing to a terminal")
+	flag.BoolVar(&noProgress, "no-progress", false, "Don't draw the progress of reading large response bodies, which is otherwise done when stderr is a terminal")
+	flag.IntVar(&width, "width", 0, "Wrap header values and shorten URLs in the report to fit this many columns (defaults to the width of the terminal, with no limit otherwise)")
+	flag.StringVar(&colorThresholds, "color-thresholds", "100ms,500ms", "Durations from which timings are colored yellow and red")
+	// Set as they are parsed, so the reports of the subcommands returning
+	// early use them too
+	var timeFormat report.TimeFormat
+	timeUnit, timePrecision := report.TimeUnitMillis, report.DefaultTimePrecision
+	flag.Func("time-unit", "Unit to show durations in: us, ms or s (default ms)", func(value string) error {
+		var err error
+		timeUnit = value
+		timeFormat, err = report.NewTimeFormat(timeUnit, timePrecision)
+		return err
+	})
+	flag.Func("precision", "Number of decimals to show durations with (default 2)", func(value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("expected a number of decimals")
+		}
+		timePrecision = n
+		timeFormat, err = report.NewTimeFormat(timeUnit, timePrecision)
+		return err
+	})
+	flag.BoolVar(&graphQLPretty, "graphql-pretty", false, "Show the data of a GraphQL response body indented and its errors listed, warning about errors")
+	flag.BoolVar(&auditSecurity, "audit-security", false, "Grade the security headers of the response, such as HSTS, CSP and the flags of its cookies, in a section of the report")
+	flag.BoolVar(&lineNumbers, "line-numbers", false, "Prefix each line of the response body with its line number")
+	flag.BoolVar(&hexDump, "hex", false, "Show the whole response body as a hex and ASCII dump, as is done for the start of a binary body")
+	flag.StringVar(&bodyGrep, "body-grep", "", "Only show the lines of the response body matching this regular expression")
+	flag.IntVar(&bodyGrepContext, "body-grep-context", 0, "Number of lines of context to show around each -body-grep match")
+	flag.Var(&metricDefinitions, "metric", "Composite metric computed from the timings, such as 'backend = response_delay - rtt'")
+	flag.StringVar(&metricsFile, "metrics-file", "", "File of composite metric definitions, one per line")
+	flag.Var(&assertions, "assert", "Comparison of the timings, metrics and Server-Timing durations which must hold, such as 'timing.ttfb - server_timing.app < 50ms'")
+	flag.Var(&bodyContains, "assert-body-contains", "Text the response body must contain")
+	flag.Var(&headerAssertions, "assert-header", "Response header which must be sent, such as 'X-Cache' or with its value 'X-Cache: HIT'")
+	flag.Var(&jsonAssertions, "assert-json", "Comparison of a value of the JSON response body which must hold, such as '.status == \"ok\"' or '.items[0].count > 3'")
+	flag.Var(&maxBodyDisplay, "max-body-display", "Maximum size of the response body to display, the full body is still read (-1 for no limit)")
+	flag.Var(&maxBodyDisplay, "max-body", "Short for -max-body-display")
+	flag.StringVar(&byteRange, "range", "", "Only request these bytes of the body, such as bytes=0-1023, and report whether the server sent just them")
+	flag.Var(&continueAt, "continue-at", "Only request the body from this offset on, such as 10MB, to trace resuming a download")
+	flag.Var(&bodyBudget, "max-body-budget", "Warn when the response body is larger than this size, such as 500KB")
+	flag.BoolVar(&failStatus, "fail", false, "Exit with an error when the response status is 4xx or 5xx, with exit code 4 or 5")
+	flag.BoolVar(&failOverBudget, "fail-over-budget", false, "Exit with an error when the response body is over the -max-body-budget")
+	flag.StringVar(&bodyFile, "body-file", "", "Write the full response body of a single request to a file")
+	flag.StringVar(&reportFile, "report-file", "", "Write the report to this file, after a header with the time, instead of to stdout")
+	flag.BoolVar(&appendReport, "append", false, "Append to the -report-file instead of replacing it")
+	flag.StringVar(&saveBaselinePath, "save-baseline", "", "Save the timings of the run to this file, to compare later runs against with -compare-baseline")
+	flag.StringVar(&compareBaselinePath, "compare-baseline", "", "Compare the timings of the run against those saved with -save-baseline, exiting with an error if any phase regressed")
+	flag.BoolVar(&compareRuns, "compare-runs", false, "Test two files of results, such as of two releases, for statistically significant regressions in each phase, exiting with an error if there are any")
+	flag.StringVar(&regressionThreshold, "regression-threshold", "10%", "How much slower a phase can be than the baseline, or the first target of compare, before it is a regression")
+	flag.StringVar(&cassettePath, "cassette", "", "Cassette file to record the request to or replay it from")
+	flag.BoolVar(&record, "record", false, "Record the request and response to the cassette file")
+	flag.BoolVar(&replay, "replay", false, "Replay the response and timings from the cassette file instead of sending the request")
+	flag.StringVar(&redactQuery, "redact-query", "", "Redact the values of these comma separated query parameters, such as token,sig, from the URLs shown in reports, results, metric labels, progress events and errors")
+	flag.StringVar(&redactHeaders, "redact", "", "Mask the values of these comma separated request and response headers, such as Authorization,Cookie,X-Api-Key, in the report in every format, results, hooks and -print-curl")
+	flag.BoolVar(&redactSecrets, "redact-secrets", false, "Mask the values of the headers which commonly carry credentials, such as Authorization, Cookie, Set-Cookie and X-Api-Key, as well as those given with -redact")
+	flag.Var(&connectTo, "connect-to", "Connect to another address than that of the url, as host:port:target:port, keeping the url for the Host header and TLS server name (either host or port can be empty to match any)")
+	flag.BoolVar(&ocspCheck, "ocsp-check", false, "Check whether the certificate of the server was revoked, with its OCSP responder or else its CRL, timed separately from the request, and warn if no OCSP staple was sent")
+	flag.StringVar(&iface, "interface", "", "Send requests from this network interface or local IP address, such as eth1 or 10.8.0.2")
+	flag.StringVar(&transportCfg.unixSocket, "unix-socket", "", "Connect to the server through a unix domain socket")
+	flag.IntVar(&transportCfg.maxIdleConns, "max-idle-conns", http.DefaultMaxIdleConnsPerHost, "Maximum number of idle connections to keep open to the server for reuse")
+	flag.BoolVar(&transportCfg.noKeepAlive, "no-keepalive", false, "Close each connection after its request, so every request sets up a new one (as -max-idle-conns 0)")
+	flag.BoolVar(&transportCfg.noKeepAlive, "disable-http-keepalives", false, "Same as -no-keepalive")
+	flag.IntVar(&transportCfg.maxConnsPerHost, "max-conns-per-host", 0, "Maximum number of connections to the server at once, requests wait for one to be free (0 for no limit)")
+	flag.DurationVar(&transportCfg.idleConnTimeout, "idle-conn-timeout", 90*time.Second, "How long an idle connection is kept open for reuse (0 for no limit)")
+	flag.BoolVar(&transportCfg.dnsQueries, "dns-queries", false, "Resolve hosts with Go's own resolver and show each DNS query it sends, with its answer and time, such as for names tried with search domains")
+	flag.StringVar(&dohURL, "doh", "", "Resolve hosts over HTTPS with the DNS over HTTPS resolver at this url, such as https://1.1.1.1/dns-query, showing each query and its connection timed separately from the request")
+	flag.StringVar(&dotHost, "dot", "", "Resolve hosts over TLS with the DNS over TLS resolver at this host, with an optional port (853 by default), showing each query and its connection timed separately from the request")
+	flag.BoolVar(&transportCfg.noMDNS, "no-mdns", false, "Resolve .local names with the system resolver instead of sending mDNS queries")
+	flag.StringVar(&transportCfg.keyLogFile, "keylog", "", "Append TLS session keys to this file in NSS key log format (defaults to $SSLKEYLOGFILE)")
+	flag.StringVar(&hooks.onComplete, "on-complete", "", "Command to run with the result as JSON on stdin after a successful request")
+	flag.StringVar(&hooks.onFailure, "on-failure", "", "Command to run with the result as JSON on stdin after a failed request")
+	flag.DurationVar(&hooks.timeout, "hook-timeout", 10*time.Second, "Maximum time to let an -on-complete or -on-failure command run")
+	flag.StringVar(&statsdAddr, "statsd", "", "Send the timings as StatsD metrics to this host:port over UDP")
+	flag.StringVar(&statsdPrefix, "statsd-prefix", "http_trace", "Prefix for StatsD metric names")
+	flag.BoolVar(&statsdTags, "statsd-tags", false, "Add host, method and status tags to StatsD metrics (DogStatsD format)")
+	flag.StringVar(&influxURL, "influx", "", "Write the timings as InfluxDB line protocol to this HTTP write URL or udp://host:port")
+	flag.StringVar(&influxToken, "influx-token", "", "API token for writing to InfluxDB 2")
+	flag.StringVar(&syslogAddr, "syslog", "", "Send each result to syslog: local for the local daemon, or udp://host:port or tcp://host:port")
+	defineIntegrationFlags()
+	flag.StringVar(&notifyURL, "notify-url", "", "POST results to this webhook URL, such as the incoming webhook of Slack or Teams")
+	flag.StringVar(&notifyTemplate, "notify-template", "json", "Payload posted to -notify-url: json, slack, teams, pagerduty, or a Go template over the result, or @file to read one from a file")
+	flag.StringVar(&notifyOn, "notify-on", "failure", "Which results to post to -notify-url: failure, all, or incident to post only when consecutive failures of the same kind open an incident, while it stays open and when it is resolved")
+	flag.DurationVar(&notifyRepeat, "notify-repeat", time.Hour, "How often to post an update of an open incident with -notify-on incident, 0 for never")
+	flag.Var(&faults, "fault", "Fault to inject when replaying: timeout:<phase>, truncate-body:<bytes> or malformed-header")
+
+	// "http-trace doctor" checks the environment for problems which would make
+	// traces misleading
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		flag.CommandLine.Parse(os.Args[2:])
+		if flag.NArg() > 0 {
+			exitWithError(fmt.Errorf("doctor takes no arguments"))
+		}
+		if !runDoctor(os.Stdout, timeFormat) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// "http-trace compare a b" compares two URLs, or two saved runs
+	compare := len(os.Args) > 1 && os.Args[1] == "compare"
+	// "http-trace diff url [file]" diffs two responses to the request, or the
+	// response with one saved
+	diff := len(os.Args) > 1 && os.Args[1] == "diff"
+	// "http-trace serve" runs a HTTP proxy, tracing each request sent through
+	// it
+	serve := len(os.Args) > 1 && os.Args[1] == "serve"
+	// "http-trace run scenario.yaml" traces the steps of a scenario one after
+	// another
+	var scn *scenario.Scenario
+	// "http-trace dns|tcp|tls host" times making a connection to the host up
+	// to that phase, without sending a request
+	probePhase := ""
+	if len(os.Args) > 1 {
+		probePhase = probeCommands[os.Args[1]]
+	}
+	diffFile := ""
+	if probePhase != "" {
+		flag.CommandLine.Parse(os.Args[2:])
+		if flag.NArg() != 1 || urlFile != "" || requestFile != "" || srvName != "" || discoverSpec != "" {
+			exitWithError(fmt.Errorf("%s takes a host, host:port or url", os.Args[1]))
+		}
+	} else if len(os.Args) > 1 && os.Args[1] == "run" {
+		flag.CommandLine.Parse(os.Args[2:])
+		if flag.NArg() != 1 || urlFile != "" || requestFile != "" || srvName != "" || discoverSpec != "" {
+			exitWithError(fmt.Errorf("run takes a scenario file, with the urls of its steps"))
+		}
+		var err error
+		scn, err = scenario.Load(flag.Arg(0))
+		if err != nil {
+			exitWithError(err)
+		}
+	} else if serve {
+		flag.CommandLine.Parse(os.Args[2:])
+		if flag.NArg() > 0 || urlFile != "" || requestFile != "" || srvName != "" || discoverSpec != "" {
+			exitWithError(fmt.Errorf("serve takes no urls, it traces the requests sent through it"))
+		}
+	} else if diff {
+		flag.CommandLine.Parse(os.Args[2:])
+		if flag.NArg() < 1 || flag.NArg() > 2 || urlFile != "" || requestFile != "" {
+			exitWithError(fmt.Errorf("diff takes a URL, a URL and a file of results saved with -output json or jsonl, or two such files"))
+		}
+		if flag.NArg() == 2 && isResultFile(flag.Arg(0)) && isResultFile(flag.Arg(1)) {
+			differ, err := diffResultFiles(flag.Arg(0), flag.Arg(1), timeFormat, os.Stdout)
+			if err != nil {
+				exitWithError(err)
+			}
+			if differ {
+				exitWithError(fmt.Errorf("the responses differ"))
+			}
+			return
+		}
+		if flag.NArg() == 2 {
+			if !isResultFile(flag.Arg(1)) {
+				exitWithError(fmt.Errorf("diff compares a URL with a file of results, %s is not a file", flag.Arg(1)))
+			}
+			diffFile = flag.Arg(1)
+		}
+	} else if compare {
+		flag.CommandLine.Parse(os.Args[2:])
+		if flag.NArg() != 2 || urlFile != "" || requestFile != "" {
+			exitWithError(fmt.Errorf("compare takes two URLs, or two files of results saved with -output json or jsonl"))
+		}
+		if isResultFile(flag.Arg(0)) && isResultFile(flag.Arg(1)) {
+			threshold, err := parseRegressionThreshold(regressionThreshold)
+			if err != nil {
+				exitWithError(err)
+			}
+			err = compareResultFiles(flag.Arg(0), flag.Arg(1), threshold, &report.Presentation{Color: !noColor && useColor(os.Stdout), TimeFormat: timeFormat})
+			if err != nil {
+				exitWithError(err)
+			}
+			return
+		}
+	} else {
+		flag.Parse()
+	}
+	requestBody = dataBody(requestData)
+	// "http-trace -compare-runs a b" tests two saved runs for regressions
+	if compareRuns {
+		if flag.NArg() != 2 || !isResultFile(flag.Arg(0)) || !isResultFile(flag.Arg(1)) {
+			exitWithError(fmt.Errorf("-compare-runs takes two files of results saved with -output json or jsonl"))
+		}
+		threshold, err := parseRegressionThreshold(regressionThreshold)
+		if err != nil {
+			exitWithError(err)
+		}
+		err = compareRunFiles(flag.Arg(0), flag.Arg(1), threshold, &report.Presentation{Color: !noColor && useColor(os.Stdout), TimeFormat: timeFormat})
+		if err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+	headerNames := strings.Split(redactHeaders, ",")
+	if redactSecrets {
+		headerNames = append(headerNames, report.SecretHeaders...)
+	}
+	redactor := report.NewRedactor(strings.Split(redactQuery, ","), headerNames)
+	if flagSet("listen") && !serve {
+		exitWithError(fmt.Errorf("-listen is only used by serve"))
+	}
+	if flag.NArg() < 1 && urlFile == "" && requestFile == "" && srvName == "" && discoverSpec == "" && !serve && scn == nil && probePhase == "" {
+		exitWithError(fmt.Errorf("no url specified"))
+	}
+	if flag.NArg() > 0 && urlFile != "" {
+		exitWithError(fmt.Errorf("urls can not be given both on the command line and with -url-file"))
+	}
+	if requestFile != "" && (flag.NArg() > 1 || urlFile != "" || flagSet("m") || requestBody != "" || dataBinary != "" || len(jsonFields) > 0 || graphQL) {
+		exitWithError(fmt.Errorf("-request-file takes at most one url to send the requests to, and can not be used with -url-file, -m, -d, -data-binary, -json or -graphql"))
+	}
+	urls := flag.Args()
+	if scn != nil || probePhase != "" {
+		urls = nil
+	}
+	if diffFile != "" {
+		urls = urls[:1]
+	}
+	if srvName != "" {
+		if flag.NArg() > 1 || urlFile != "" || requestFile != "" || compare {
+			exitWithError(fmt.Errorf("-srv takes at most one url, and can not be used with -url-file, -request-file or compare"))
+		}
+		u, err := resolveSRV(srvName, flag.Arg(0), timeFormat, os.Stderr)
+		if err != nil {
+			exitWithError(err)
+		}
+		urls = []string{u}
+	}
+	if discoverSpec != "" {
+		if flag.NArg() > 1 || urlFile != "" || requestFile != "" || srvName != "" || compare {
+			exitWithError(fmt.Errorf("-discover takes at most one url, and can not be used with -url-file, -request-file, -srv or compare"))
+		}
+		var err error
+		urls, err = resolveDiscover(discoverSpec, flag.Arg(0), discoverAll, &http.Client{Timeout: time.Duration(timeout) * time.Second}, os.Stderr)
+		if err != nil {
+			exitWithError(err)
+		}
+	} else if discoverAll {
+		exitWithError(fmt.Errorf("-discover-all requires -discover"))
+	}
+	var cron *schedule.Cron
+	if cronExpr != "" {
+		if watch > 0 || rate > 0 {
+			exitWithError(fmt.Errorf("-cron sets when requests are sent, so it can not be used with -watch or -rate"))
+		}
+		var err error
+		cron, err = schedule.ParseCron(cronExpr)
+		if err != nil {
+			exitWithError(err)
+		}
+	}
+	if (watch > 0 || cron != nil) && !flagSet("n") {
+		count = 0
+	}
+	if count < 0 || (count == 0 && watch <= 0 && cron == nil) {
+		exitWithError(fmt.Errorf("-n must be at least 1"))
+	}
+	if concurrency < 1 {
+		exitWithError(fmt.Errorf("-c must be at least 1"))
+	}
+	if rate < 0 || delay < 0 {
+		exitWithError(fmt.Errorf("-rate and -delay can not be negative"))
+	}
+	if rate > 0 && watch > 0 {
+		exitWithError(fmt.Errorf("-rate and -watch both set the interval between requests, so only one of them can be used"))
+	}
+	var sched *schedule.Schedule
+	switch {
+	case cron != nil:
+		sched = schedule.At(cron)
+	case watch > 0:
+		sched = schedule.Every(watch)
+	case rate > 0:
+		sched = schedule.Every(time.Duration(float64(time.Second) / rate))
+	}
+	if align && watch <= 0 {
+		exitWithError(fmt.Errorf("-align requires -watch"))
+	}
+	if jitter < 0 {
+		exitWithError(fmt.Errorf("-jitter can not be negative"))
+	}
+	if jitter > 0 && watch <= 0 && cron == nil {
+		exitWithError(fmt.Errorf("-jitter requires -watch or -cron"))
+	}
+	if sched != nil {
+		sched.SetAlign(align)
+		sched.SetJitter(jitter, rand.New(rand.NewSource(time.Now().UnixNano())))
+	}
+	if transportCfg.maxIdleConns < 0 || transportCfg.maxConnsPerHost < 0 || transportCfg.idleConnTimeout < 0 {
+		exitWithError(fmt.Errorf("-max-idle-conns, -max-conns-per-host and -idle-conn-timeout can not be negative"))
+	}
+	for _, spec := range connectTo {
+		rule, err := parseConnectRule(spec)
+		if err != nil {
+			exitWithError(err)
+		}
+		transportCfg.connectTo = append(transportCfg.connectTo, rule)
+	}
+	if len(connectTo) > 0 && transportCfg.unixSocket != "" {
+		exitWithError(fmt.Errorf("-connect-to can not be used with -unix-socket, which connects to the socket whatever the address"))
+	}
+	if iface != "" {
+		if transportCfg.unixSocket != "" {
+			exitWithError(fmt.Errorf("-interface can not be used with -unix-socket"))
+		}
+		var err error
+		transportCfg.localAddr, err = localAddr(iface)
+		if err != nil {
+			exitWithError(err)
+		}
+	}
+	if dohURL != "" && dotHost != "" {
+		exitWithError(fmt.Errorf("-doh and -dot can not be used together"))
+	}
+	if (dohURL != "" || dotHost != "") && transportCfg.unixSocket != "" {
+		exitWithError(fmt.Errorf("-doh and -dot can not be used with -unix-socket, which resolves no host"))
+	}
+	if dohURL != "" {
+		var err error
+		transportCfg.doh, err = parseDoHURL(dohURL)
+		if err != nil {
+			exitWithError(err)
+		}
+	}
+	if dotHost != "" {
+		transportCfg.dot = dotAddr(dotHost)
+	}
+	if appendReport && reportFile == "" {
+		exitWithError(fmt.Errorf("-append requires a -report-file"))
+	}
+	threshold, err := parseRegressionThreshold(regressionThreshold)
+	if err != nil {
+		exitWithError(err)
+	}
+	if explore && (count != 1 || watch > 0 || abHeader != "" || autoN || (outputFormat != "" && outputFormat != report.FormatText)) {
+		exitWithError(fmt.Errorf("-explore is for a single request with text output and can not be used with -n, -watch, -ab-header, -auto-n or -output"))
+	}
+	if progressJSON && (events || verbose || statusInterval > 0) {
+		exitWithError(fmt.Errorf("-progress-json can not be used with -events, -v or -status-interval, which also write to stderr"))
+	}
+	for _, t := range requestTrailers {
+		if !strings.Contains(t, ":") {
+			exitWithError(fmt.Errorf("invalid -trailer %q, expected 'Name: value'", t))
+		}
+	}
+	err = checkURLQuery(urlQuery)
+	if err != nil {
+		exitWithError(err)
+	}
+	requestHeaders, err = loadHeaders(requestHeaders)
+	if err != nil {
+		exitWithError(err)
+	}
+	if headOnly && (explore || pipeTo != "" || bodyFile != "" || cassettePath != "" || longPoll || stallTimeout > 0) {
+		exitWithError(fmt.Errorf("-head-only does not download the body, so it can not be used with -explore, -pipe-to, -body-file, -cassette, -long-poll or -stall-timeout"))
+	}
+	if wireDumpDir != "" {
+		if cassettePath != "" || transportCfg.unixSocket != "" {
+			exitWithError(fmt.Errorf("-dump-wire saves the bytes of TCP connections, so it can not be used with -cassette or -unix-socket"))
+		}
+		err = os.MkdirAll(wireDumpDir, 0755)
+		if err != nil {
+			exitWithError(fmt.Errorf("error creating -dump-wire directory: %w", err))
+		}
+	}
+	if stallTimeout < 0 {
+		exitWithError(fmt.Errorf("-stall-timeout can not be negative"))
+	}
+	if outputFormat == report.FormatHTML && (count != 1 || watch > 0 || abHeader != "" || autoN) {
+		exitWithError(fmt.Errorf("-output html is a page for a single request and can not be used with -n, -watch, -ab-header or -auto-n"))
+	}
+
+	if !graphQL && (graphQLQuery != "" || graphQLVariables != "") {
+		exitWithError(fmt.Errorf("-query and -variables can only be used with -graphql"))
+	}
+	if graphQL {
+		if graphQLQuery == "" {
+			exitWithError(fmt.Errorf("-graphql requires a -query"))
+		}
+		if requestBody != "" || len(jsonFields) > 0 {
+			exitWithError(fmt.Errorf("-graphql composes the request body, so it can not be used with -d or -json"))
+		}
+		var err error
+		requestBody, err = graphQLBody(graphQLQuery, graphQLVariables)
+		if err != nil {
+			exitWithError(err)
+		}
+		if !hasHeader(requestHeaders, "Content-Type") {
+			requestHeaders = append(requestHeaders, "Content-Type: application/json")
+		}
+		if !flagSet("m") {
+			method = http.MethodPost
+		}
+	}
+
+	if dataBinary != "" {
+		if len(requestData) > 0 || len(jsonFields) > 0 || graphQL {
+			exitWithError(fmt.Errorf("-data-binary sends the body as it is, so it can not be used with -d, -json or -graphql"))
+		}
+		requestBody, requestHeaders, err = loadDataBinary(dataBinary, requestHeaders)
+		if err != nil {
+			exitWithError(err)
+		}
+		if !flagSet("m") {
+			method = http.MethodPost
+		}
+	}
+
+	if requestData.isForm() {
+		if len(jsonFields) > 0 {
+			exitWithError(fmt.Errorf("-d given more than once or -data-urlencode builds a form, so it can not be used with -json"))
+		}
+		if !hasHeader(requestHeaders, "Content-Type") {
+			requestHeaders = append(requestHeaders, "Content-Type: "+formContentType)
+		}
+		if !flagSet("m") {
+			method = http.MethodPost
+		}
+	}
+
+	if len(jsonFields) > 0 {
+		var err error
+		requestBody, err = jsonbody.Apply(requestBody, jsonFields)
+		if err != nil {
+			exitWithError(err)
+		}
+		if !hasHeader(requestHeaders, "Content-Type") {
+			requestHeaders = append(requestHeaders, "Content-Type: application/json")
+		}
+		if !flagSet("m") {
+			method = http.MethodPost
+		}
+	}
+
+	rangeField, err := rangeHeader(byteRange, int64(continueAt))
+	if err != nil {
+		exitWithError(err)
+	}
+	if rangeField != "" {
+		if hasHeader(requestHeaders, "Range") {
+			exitWithError(fmt.Errorf("-range and -continue-at can not be used with a Range header"))
+		}
+		requestHeaders = append(requestHeaders, rangeField)
+	}
+
+	dataFile := ""
+	if strings.HasPrefix(dataBinary, "@") {
+		dataFile = dataBinary[1:]
+	}
+	requests := []request{}
+	for _, u := range urls {
+		requests = append(requests, request{method: method, url: u, headers: requestHeaders, body: requestBody, binary: dataBinary != "", file: dataFile})
+	}
+	if urlFile != "" || requestFile != "" {
+		if urlFile != "" {
+			requests, err = loadURLFile(urlFile, method, requestHeaders)
+			for i := range requests {
+				requests[i].body, requests[i].binary, requests[i].file = requestBody, dataBinary != "", dataFile
+			}
+		} else {
+			requests, err = loadRequestFile(requestFile, flag.Arg(0), requestHeaders)
+		}
+		if err != nil {
+			exitWithError(err)
+		}
+		urls = nil
+		for _, req := range requests {
+			urls = append(urls, req.url)
+		}
+	}
+	if scn != nil {
+		for _, step := range scn.Steps {
+			requests = append(requests, request{method: step.Method, url: step.URL, headers: append(append([]string{}, requestHeaders...), step.Headers...), body: step.Body})
+			urls = append(urls, step.URL)
+		}
+	}
+	for i := range requests {
+		requests[i].url, err = asciiURL(requests[i].url)
+		if err != nil {
+			exitWithError(err)
+		}
+		// With -expand-env the parameters are added once they are expanded,
+		// so their values are encoded too
+		if expandEnv {
+			requests[i].query = urlQuery
+		} else {
+			requests[i].url = addURLQuery(requests[i].url, urlQuery)
+		}
+	}
+	if scn != nil && (flagSet("n") || watch > 0 || cron != nil || concurrency > 1 || abHeader != "" || summarise || autoN || warmup > 0 || keepAlive || saveBaselinePath != "" || compareBaselinePath != "" || explore || mirror != "" || cassettePath != "" || pipeTo != "" || outputFormat == report.FormatHTML || cacheCheck || probeResumptionMode || probeKeepAliveLimit > 0) {
+		exitWithError(fmt.Errorf("run traces each step of the scenario once, in order, so it can not be used with -n, -watch, -cron, -c, -ab-header, -aggregate, -auto-n, -warmup, -keepalive, -save-baseline, -compare-baseline, -explore, -mirror, -cassette, -pipe-to, -output html, -cache-check or the probes"))
+	}
+	if scn != nil && (flagSet("m") || requestBody != "" || dataBinary != "" || len(jsonFields) > 0 || graphQL) {
+		exitWithError(fmt.Errorf("the steps of a scenario set their own method and body, so run can not be used with -m, -d, -data-binary, -json or -graphql"))
+	}
+	if probePhase != "" && (watch > 0 || cron != nil || concurrency > 1 || abHeader != "" || summarise || autoN || warmup > 0 || keepAlive || saveBaselinePath != "" || compareBaselinePath != "" || explore || mirror != "" || cassettePath != "" || transportCfg.unixSocket != "" || outputFormat != report.FormatText || cacheCheck || probeResumptionMode || probeKeepAliveLimit > 0) {
+		exitWithError(fmt.Errorf("%s probes a phase -n times, so can not be used with -watch, -cron, -c, -ab-header, -aggregate, -auto-n, -warmup, -keepalive, -save-baseline, -compare-baseline, -explore, -mirror, -cassette, -unix-socket, -output, -cache-check, -probe-resumption or -probe-keepalive", os.Args[1]))
+	}
+	several := (len(requests) > 1 || urlFile != "") && scn == nil
+	if several && (watch > 0 || cron != nil || abHeader != "" || summarise || autoN || mirror != "" || cassettePath != "" || outputFormat == report.FormatHTML || explore) {
+		exitWithError(fmt.Errorf("several URLs can not be used with -watch, -cron, -ab-header, -aggregate, -auto-n, -mirror, -cassette, -output html or -explore"))
+	}
+	if bodyFile != "" && (several || scn != nil || probePhase != "" || count != 1 || concurrency > 1 || watch > 0 || cron != nil || abHeader != "" || autoN || keepAlive || allIPs || discoverAll) {
+		exitWithError(fmt.Errorf("-body-file writes the body of a single request, so it can not be used with several URLs, run, the probes, -n, -c, -watch, -cron, -ab-header, -auto-n, -keepalive, -all-ips or -discover-all"))
+	}
+	baseline := saveBaselinePath != "" || compareBaselinePath != ""
+	if allIPs && (several || scn != nil || probePhase != "" || compare || diff || serve || discoverAll || len(connectTo) > 0 || transportCfg.unixSocket != "" || watch > 0 || cron != nil || abHeader != "" || summarise || autoN || keepAlive || baseline || mirror != "" || cassettePath != "" || outputFormat == report.FormatHTML || explore || printCurl || cacheCheck || probeResumptionMode || probeKeepAliveLimit > 0) {
+		exitWithError(fmt.Errorf("-all-ips compares the addresses of the host of a single URL, so can not be used with several URLs, run, the probes, compare, diff, serve, -discover-all, -connect-to, -unix-socket, -watch, -cron, -ab-header, -aggregate, -auto-n, -keepalive, -save-baseline, -compare-baseline, -mirror, -cassette, -output html, -explore, -print-curl, -cache-check or -probe-resumption"))
+	}
+	if baseline && (several || abHeader != "" || compare) {
+		exitWithError(fmt.Errorf("-save-baseline and -compare-baseline are for a single URL and can not be used with several URLs, -ab-header or compare"))
+	}
+	if serve && (flagSet("n") || watch > 0 || cron != nil || abHeader != "" || summarise || autoN || warmup > 0 || keepAlive || baseline || explore || mirror != "" || cassettePath != "" || pipeTo != "" || bodyFile != "" || headOnly || expandEnv || printCurl || outputFormat == report.FormatHTML) {
+		exitWithError(fmt.Errorf("serve traces each request sent through it once, so it can not be used with -n, -watch, -cron, -ab-header, -aggregate, -auto-n, -warmup, -keepalive, -save-baseline, -compare-baseline, -explore, -mirror, -cassette, -pipe-to, -body-file, -head-only, -expand-env, -print-curl or -output html"))
+	}
+	if serve && (flagSet("m") || requestBody != "" || dataBinary != "" || len(jsonFields) > 0 || graphQL || len(urlQuery) > 0 || cacheCheck || probeResumptionMode || probeKeepAliveLimit > 0) {
+		exitWithError(fmt.Errorf("serve sends each request on as it was received, so it can not be used with -m, -d, -data-binary, -json, -graphql, -url-query, -cache-check or the probes"))
+	}
+	if warmup < 0 {
+		exitWithError(fmt.Errorf("-warmup can not be negative"))
+	}
+	if warmup > 0 && (keepAlive || cassettePath != "") {
+		exitWithError(fmt.Errorf("-warmup can not be used with -keepalive, whose first request is to be cold, or -cassette"))
+	}
+	if keepAlive {
+		if several || abHeader != "" || compare || concurrency > 1 || count < 2 {
+			exitWithError(fmt.Errorf("-keepalive sends -n requests to a single URL one after another, so needs -n of at least 2 and can not be used with several URLs, -c, -ab-header or compare"))
+		}
+		if transportCfg.maxIdleConns == 0 || transportCfg.noKeepAlive {
+			exitWithError(fmt.Errorf("-keepalive needs the connection to be kept, so can not be used with -no-keepalive or -max-idle-conns 0"))
+		}
+		// Every request is to wait for the one connection rather than set up
+		// another
+		transportCfg.maxConnsPerHost = 1
+	}
+
+	if expandEnv {
+		// Check the environment variables are set before sending anything,
+		// apart from the variables a scenario captures as it runs
+		captured := map[string]string{}
+		if scn != nil {
+			for _, step := range scn.Steps {
+				for _, c := range step.Captures {
+					captured[c.Name] = ""
+				}
+			}
+		}
+		for _, req := range requests {
+			_, err := expandRequest(expandVariables(req, captured))
+			if err != nil {
+				exitWithError(err)
+			}
+		}
+	}
+
+	if printCurl {
+		for _, req := range requests {
+			if expandEnv {
+				req, _ = expandRequest(req)
+			}
+			fmt.Println(curlCommand(req, transportCfg, timeout, redactor))
+		}
+		return
+	}
+
+	metrics, err := loadMetrics(metricDefinitions, metricsFile)
+	if err != nil {
+		exitWithError(err)
+	}
+	checks, err := parseAssertions(assertions)
+	if err != nil {
+		exitWithError(err)
+	}
+	contentChecks, err := parseContentAssertions(bodyContains, headerAssertions, jsonAssertions)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	transport, err := newTransport(transportCfg)
+	if err != nil {
+		exitWithError(err)
+	}
+	if (count != 1 || watch > 0 || concurrency > 1) && probePhase == "" {
+		fmt.Fprintln(os.Stderr, describePool(transport))
+		if !transport.DisableKeepAlives && concurrency > transport.MaxIdleConnsPerHost {
+			fmt.Fprintf(os.Stderr, "! -c %d is more than the %d idle connections kept, so some requests will set up new connections\n", concurrency, transport.MaxIdleConnsPerHost)
+		}
+	}
+	httpClient := &http.Client{
+		Timeout:   time.Duration(timeout) * time.Second,
+		Transport: transport,
+	}
+	if scn != nil {
+		// Cookies set by a step, such as the session of a login, are sent by
+		// the steps after it
+		httpClient.Jar, err = cookiejar.New(nil)
+		if err != nil {
+			exitWithError(err)
+		}
+	}
+	// With -all-ips the request is sent to each address of the host, with a
+	// client connecting only to that address
+	var addresses []string
+	allIPsHost := ""
+	if allIPs {
+		target := requests[0]
+		if expandEnv {
+			target, _ = expandRequest(target)
+		}
+		u, err := url.Parse(target.url)
+		if err != nil {
+			exitWithError(err)
+		}
+		allIPsHost = u.Hostname()
+		clients, ips, err := resolveAllIPs(allIPsHost, httpClient, transport, hostResolver(transportCfg), timeFormat, os.Stderr)
+		if err != nil {
+			exitWithError(err)
+		}
+		pinned := []request{}
+		for _, client := range clients {
+			req := requests[0]
+			req.client = client
+			pinned = append(pinned, req)
+		}
+		requests, addresses = pinned, ips
+	}
+	if serve {
+		// Redirects are passed on, for the client of the proxy to follow
+		httpClient.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+
+	if probePhase != "" {
+		exit, err := runProbes(transport, hostResolver(transportCfg), httpClient.Timeout, probePhase, flag.Arg(0), count, delay, timeFormat, os.Stdout)
+		if err != nil {
+			exitWithError(err)
+		}
+		os.Exit(exit)
+	}
+
+	if probeKeepAliveLimit > 0 {
+		if several || transport.DisableKeepAlives {
+			exitWithError(fmt.Errorf("-probe-keepalive is for a single URL and needs idle connections to be kept, so can not be used with -no-keepalive or -max-idle-conns 0"))
+		}
+		target := requests[0]
+		if expandEnv {
+			target, _ = expandRequest(target)
+		}
+		err = probeKeepAlive(transport, httpClient.Timeout, target, probeKeepAliveLimit, redactor, timeFormat, os.Stdout)
+		if err != nil {
+			exitWithError(redactor.Error(err))
+		}
+		return
+	}
+
+	if diff {
+		target := requests[0]
+		if expandEnv {
+			target, _ = expandRequest(target)
+		}
+		differ, err := diffResponses(transport, httpClient.Timeout, target, diffFile, int64(maxBodyDisplay), redactor, timeFormat, os.Stdout)
+		if err != nil {
+			exitWithError(redactor.Error(err))
+		}
+		if differ {
+			exitWithError(fmt.Errorf("the responses differ"))
+		}
+		return
+	}
+
+	if cacheCheck {
+		if several {
+			exitWithError(fmt.Errorf("-cache-check is for a single URL"))
+		}
+		target := requests[0]
+		if expandEnv {
+			target, _ = expandRequest(target)
+		}
+		err = checkCache(transport, httpClient.Timeout, target, redactor, timeFormat, os.Stdout)
+		if err != nil {
+			exitWithError(redactor.Error(err))
+		}
+		return
+	}
+
+	if probeResumptionMode {
+		if several {
+			exitWithError(fmt.Errorf("-probe-resumption is for a single URL"))
+		}
+		target := requests[0]
+		if expandEnv {
+			target, _ = expandRequest(target)
+		}
+		err = probeResumption(transport, httpClient.Timeout, target, redactor, timeFormat, os.Stdout)
+		if err != nil {
+			exitWithError(redactor.Error(err))
+		}
+		return
+	}
+
+	var recorder *cassette.Recorder
+	if cassettePath != "" {
+		if record == replay {
+			exitWithError(fmt.Errorf("exactly one of -record or -replay must be used with -cassette"))
+		}
+
+		mode := cassette.ModeRecord
+		if replay {
+			mode = cassette.ModeReplay
+		}
+
+		recorder, err = cassette.New(cassettePath, mode, transport)
+		if err != nil {
+			exitWithError(err)
+		}
+		httpClient.Transport = recorder
+		if redactor != nil {
+			recorder.SetRedactor(redactor)
+		}
+
+		fault := cassette.Fault{}
+		for _, spec := range faults {
+			f, err := cassette.ParseFault(spec)
+			if err != nil {
+				exitWithError(err)
+			}
+			fault = fault.Merge(f)
+		}
+		if len(faults) > 0 && !replay {
+			exitWithError(fmt.Errorf("-fault can only be used with -replay"))
+		}
+		recorder.SetFault(fault)
+		if mirror != "" {
+			exitWithError(fmt.Errorf("-mirror can not be used with -cassette"))
+		}
+		if pipeTo != "" {
+			exitWithError(fmt.Errorf("-pipe-to can not be used with -cassette"))
+		}
+		if concurrency > 1 {
+			exitWithError(fmt.Errorf("-c can not be used with -cassette"))
+		}
+	} else if record || replay || len(faults) > 0 {
+		exitWithError(fmt.Errorf("-record, -replay and -fault require a -cassette file"))
+	}
+
+	presentation := &report.Presentation{
+		Format:            outputFormat,
+		NoTranscode:       noTranscode,
+		LineNumbers:       lineNumbers,
+		HexDump:           hexDump,
+		BodyGrepContext:   bodyGrepContext,
+		Metrics:           metrics,
+		Assertions:        checks,
+		ContentAssertions: contentChecks,
+		Redactor:          redactor,
+		GraphQL:           graphQLPretty,
+		AuditSecurity:     auditSecurity,
+		TimeFormat:        timeFormat,
+	}
+	if showSections != "" {
+		presentation.Sections, err = report.ParseSections(showSections)
+		if err != nil {
+			exitWithError(err)
+		}
+	}
+	presentation.HeaderOrder, err = report.ParseHeaderOrder(headerOrder)
+	if err != nil {
+		exitWithError(err)
+	}
+	presentation.GroupHeaders = groupHeaders
+	if keepBody != "" {
+		presentation.KeepBody, err = report.ParseBodyPolicy(keepBody)
+		if err != nil {
+			exitWithError(err)
+		}
+	}
+	if suppressResponseHeaders {
+		presentation.Sections = presentation.Sections.Hide(report.SectionHeaders)
+	}
+	if suppressResponseBody {
+		presentation.Sections = presentation.Sections.Hide(report.SectionBody)
+	}
+	if bodyGrep != "" {
+		presentation.BodyGrep, err = regexp.Compile(bodyGrep)
+		if err != nil {
+			exitWithError(fmt.Errorf("invalid -body-grep pattern: %w", err))
+		}
+	}
+	if _, ok := report.LookupFormatter(outputFormat); !ok {
+		exitWithError(fmt.Errorf("invalid -output %q, expected one of %s", outputFormat, strings.Join(report.Formatters(), ", ")))
+	}
+	presentation.Color = !noColor && reportFile == "" && useColor(os.Stdout)
+	if width < 0 {
+		exitWithError(fmt.Errorf("invalid -width %d, expected a number of columns", width))
+	}
+	presentation.Width = width
+	if width == 0 && reportFile == "" {
+		presentation.Width = reportWidth(os.Stdout)
+	}
+	presentation.SlowThreshold, presentation.VerySlowThreshold, err = parseColorThresholds(colorThresholds)
+	if err != nil {
+		exitWithError(err)
+	}
+	if writeOut != "" {
+		presentation.WriteOut, err = loadWriteOut(writeOut)
+		if err != nil {
+			exitWithError(err)
+		}
+	}
+
+	sinks := []sink.Sink{}
+	if statsdAddr != "" {
+		sinks = append(sinks, sink.NewStatsD(statsdAddr, statsdPrefix, statsdTags))
+	}
+	if influxURL != "" {
+		influxClient := &http.Client{Timeout: time.Duration(timeout) * time.Second}
+		sinks = append(sinks, sink.NewInflux(influxURL, influxToken, "http_trace", influxClient))
+	}
+	if syslogAddr != "" {
+		sinks = append(sinks, sink.NewSyslog(syslogAddr, "http-trace"))
+	}
+	optional, err := integrationSinks(time.Duration(timeout) * time.Second)
+	if err != nil {
+		exitWithError(err)
+	}
+	sinks = append(sinks, optional...)
+	if notifyURL != "" {
+		webhook, err := loadWebhook(notifyURL, notifyTemplate, notifyOn, time.Duration(timeout)*time.Second)
+		if err != nil {
+			exitWithError(err)
+		}
+		if notifyRepeat < 0 {
+			exitWithError(fmt.Errorf("-notify-repeat can not be negative"))
+		}
+		if notifyOn == "incident" {
+			incidents := sink.NewIncidents(notifyRepeat)
+			incidents.SetLog(os.Stderr)
+			webhook.SetIncidents(incidents)
+		} else if flagSet("notify-repeat") {
+			exitWithError(fmt.Errorf("-notify-repeat requires -notify-on incident"))
+		}
+		sinks = append(sinks, webhook)
+	} else if flagSet("notify-template") || flagSet("notify-on") || flagSet("notify-repeat") {
+		exitWithError(fmt.Errorf("-notify-template, -notify-on and -notify-repeat require -notify-url"))
+	}
+
+	r := &runner{
+		client:         httpClient,
+		mirror:         mirror,
+		mirrorClient:   &http.Client{Timeout: time.Duration(timeout) * time.Second, Transport: transport},
+		pipeTo:         pipeTo,
+		verbose:        verbose,
+		events:         events,
+		statusInterval: statusInterval,
+		showDownload:   !noProgress && !serve && concurrency == 1 && !progressJSON && !verbose && !events && statusInterval == 0 && isTerminal(os.Stderr),
+		explore:        explore,
+		headOnly:       headOnly,
+		longPoll:       longPoll,
+		stallTimeout:   stallTimeout,
+		wireDumpDir:    wireDumpDir,
+		expectContinue: expectContinue,
+		trailers:       requestTrailers,
+		showLocalAddr:  iface != "",
+		ocspCheck:      ocspCheck,
+		expandEnv:      expandEnv,
+		nat64:          newNAT64Detector(),
+		maxBodyDisplay: int64(maxBodyDisplay),
+		bodyFile:       bodyFile,
+		recorder:       recorder,
+		presentation:   presentation,
+		bodyBudget:     int64(bodyBudget),
+		failOverBudget: failOverBudget,
+		failStatus:     failStatus,
+		sinks:          sinks,
+		hooks:          hooks,
+		pushgateway:    pushgateway,
+		pushClient:     &http.Client{Timeout: time.Duration(timeout) * time.Second},
+		out:            os.Stdout,
+	}
+	if reportFile != "" {
+		f, err := openReportFile(reportFile, appendReport, method, redactor.Redact(strings.Join(urls, " ")))
+		if err != nil {
+			exitWithError(err)
+		}
+		defer f.Close()
+		r.out = f
+	}
+	if outputFormat == report.FormatCSV {
+		r.csv = report.NewCSVWriter(r.out, metrics, presentation.TimeFormat)
+	}
+	if progressJSON {
+		r.progress = newProgressWriter(os.Stderr, redactor)
+	}
+	if scn != nil {
+		exit := runSteps(r, scn, requests, redactor)
+		hooks.Wait()
+		closeSinks(sinks)
+		if exit != 0 {
+			os.Exit(exit)
+		}
+		return
+	}
+	if serve {
+		failed, err := serveProxy(r, listenAddr, requestHeaders, redactor, httpClient.Timeout)
+		hooks.Wait()
+		closeSinks(sinks)
+		if err != nil {
+			exitWithError(err)
+		}
+		if failed {
+			os.Exit(1)
+		}
+		return
+	}
+
+	var ab *abTest
+	if abHeader != "" {
+		ab, err = parseABHeader(abHeader)
+		if err != nil {
+			exitWithError(err)
+		}
+	}
+
+	var aggregate *report.Aggregate
+	if summarise || autoN {
+		confidence, precision, err := parseCI(ci)
+		if err != nil {
+			exitWithError(err)
+		}
+		aggregate = report.NewAggregate(confidence, precision)
+		r.quiet = outputFormat == "" || outputFormat == report.FormatText
+	}
+	if compare || keepAlive {
+		// Only the comparison is wanted, not a report for each request
+		r.quiet = outputFormat == "" || outputFormat == report.FormatText
+	}
+	if autoN && count == 0 {
+		exitWithError(fmt.Errorf("-auto-n needs a limit on the number of requests, set with -n"))
+	}
+
+	var mu sync.Mutex
+	exit := 0
+	runOnce := func(target request) *report.Result {
+		result, err := r.run(target)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", redactor.Error(err))
+			mu.Lock()
+			exit = worseExit(exit, exitCode(err))
+			mu.Unlock()
+		}
+		if result != nil && aggregate != nil {
+			aggregate.Add(result)
+		}
+		return result
+	}
+
+	// With several URLs each is requested count times, and the results are
+	// collected for each to be compared
+	var targets []*report.Target
+	perTarget := count
+	if len(requests) > 1 {
+		for i, req := range requests {
+			label := redactor.Redact(req.url)
+			if addresses != nil {
+				label = addresses[i]
+			}
+			targets = append(targets, &report.Target{URL: label})
+		}
+	}
+
+	// The results of the run are kept to save as or compare with a baseline
+	var current *report.Target
+	if baseline || keepAlive {
+		current = &report.Target{URL: redactor.Redact(requests[0].url)}
+	}
+
+	if warmup > 0 {
+		failedWarmUps := r.warmUp(requests, warmup, concurrency)
+		describeWarmUp(warmup*len(requests), failedWarmUps)
+	}
+
+	stop := notifyInterrupt()
+	runBatch := func(start, count int) {
+		iterations := make(chan int)
+		go dispatch(iterations, start, count, sched, stop)
+
+		var workers sync.WaitGroup
+		for w := 0; w < concurrency; w++ {
+			workers.Add(1)
+			go func() {
+				defer workers.Done()
+				first := true
+				for i := range iterations {
+					if !first && !pause(delay, stop) {
+						return
+					}
+					first = false
+					switch {
+					case targets != nil:
+						n := i / perTarget
+						result := runOnce(requests[n])
+						if result != nil {
+							mu.Lock()
+							targets[n].Results = append(targets[n].Results, result)
+							mu.Unlock()
+						}
+					case ab != nil:
+						for _, v := range ab.pair(i) {
+							variant := requests[0]
+							variant.headers = ab.headers(variant.headers, v)
+							result := runOnce(variant)
+							if result != nil {
+								mu.Lock()
+								v.Results = append(v.Results, result)
+								mu.Unlock()
+							}
+						}
+					default:
+						result := runOnce(requests[0])
+						if result != nil && current != nil {
+							mu.Lock()
+							current.Results = append(current.Results, result)
+							mu.Unlock()
+						}
+					}
+				}
+			}()
+		}
+		workers.Wait()
+	}
+
+	if targets != nil {
+		runBatch(0, count*len(requests))
+	} else {
+		runBatch(0, count)
+	}
+	if autoN {
+		// Keep sending requests until there are enough for the confidence
+		// intervals, or the limit is reached.
+		sent := count
+		for sent < maxAutoN {
+			needed, _ := aggregate.SamplesNeeded()
+			successful := aggregate.Successful()
+			if needed <= successful || interrupted(stop) {
+				break
+			}
+			more := needed - successful
+			if sent+more > maxAutoN {
+				more = maxAutoN - sent
+			}
+			runBatch(sent, more)
+			sent += more
+		}
+	}
+	hooks.Wait()
+	closeSinks(sinks)
+
+	if ab != nil {
+		err = r.printSummary(func(w io.Writer) error {
+			return report.WriteABComparison(w, ab.header, ab.a, ab.b, presentation)
+		})
+		if err != nil {
+			exitWithError(err)
+		}
+	}
+	if targets != nil {
+		err = r.printSummary(func(w io.Writer) error {
+			if compare {
+				_, err := report.WriteDiff(w, targets[0], targets[1], threshold, presentation)
+				return err
+			}
+			if addresses != nil {
+				return report.WriteAddressComparison(w, allIPsHost, targets, presentation)
+			}
+			if urlFile != "" || requestFile != "" {
+				return report.WriteURLSummary(w, targets, presentation)
+			}
+			return report.WriteURLComparison(w, targets, presentation)
+		})
+		if err != nil {
+			exitWithError(err)
+		}
+	}
+	if aggregate != nil {
+		err = r.printSummary(func(w io.Writer) error {
+			return aggregate.Write(w, presentation)
+		})
+		if err != nil {
+			exitWithError(err)
+		}
+	}
+
+	if keepAlive {
+		err = r.printSummary(func(w io.Writer) error {
+			return report.WriteKeepAlive(w, current.Results, presentation)
+		})
+		if err != nil {
+			exitWithError(err)
+		}
+	}
+	if compareBaselinePath != "" {
+		compared := 0
+		err = r.printSummary(func(w io.Writer) error {
+			var err error
+			compared, err = compareBaseline(w, compareBaselinePath, current, threshold, presentation)
+			return err
+		})
+		if err != nil {
+			exitWithError(err)
+		}
+		exit = worseExit(exit, compared)
+	}
+	if saveBaselinePath != "" {
+		err = saveBaseline(saveBaselinePath, current)
+		if err != nil {
+			exitWithError(err)
+		}
+	}
+
+	if record {
+		err = recorder.Save()
+		if err != nil {
+			exitWithError(err)
+		}
+	}
+
+	if exit != 0 {
+		os.Exit(exit)
+	}
+}
+
+// loadMetrics parses composite metric definitions from flags and from a file
+// with one definition per line. Blank lines and lines starting with # are
+// ignored.
+func loadMetrics(definitions []string, file string) ([]*expr.Definition, error) {
+	if file != "" {
+		raw, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading metrics file: %w", err)
+		}
+		for _, line := range strings.Split(string(raw), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				definitions = append(definitions, line)
+			}
+		}
+	}
+
+	metrics := []*expr.Definition{}
+	for _, d := range definitions {
+		parsed, err := expr.ParseDefinition(d)
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, parsed)
+	}
+
+	return metrics, nil
+}
+
+// parseAssertions parses the -assert comparisons.
+func parseAssertions(assertions []string) ([]*expr.Assertion, error) {
+	parsed := []*expr.Assertion{}
+	for _, a := range assertions {
+		assertion, err := expr.ParseAssertion(a)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, assertion)
+	}
+	return parsed, nil
+}
+
+// parseContentAssertions parses the -assert-body-contains, -assert-header and
+// -assert-json checks of the response.
+func parseContentAssertions(bodyContains, headers, jsonChecks []string) ([]*report.ContentAssertion, error) {
+	parsed := []*report.ContentAssertion{}
+	for _, text := range bodyContains {
+		parsed = append(parsed, report.BodyContains(text))
+	}
+	for _, h := range headers {
+		assertion, err := report.ParseHeaderAssertion(h)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, assertion)
+	}
+	for _, j := range jsonChecks {
+		assertion, err := report.ParseJSONAssertion(j)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, assertion)
+	}
+	return parsed, nil
+}
+
+// dispatch sends the index of each iteration to run on iterations, starting
+// from start, count times or forever when count is 0. With a schedule, that
+// of -watch, -rate or -cron, each iteration is started when it is due. It
+// stops early when stop is closed, letting the iterations already running
+// finish.
+func dispatch(iterations chan<- int, start, count int, sched *schedule.Schedule, stop <-chan struct{}) {
+	defer close(iterations)
+
+	var due time.Time
+	for i := start; count == 0 || i < start+count; i++ {
+		if sched != nil {
+			if i == start {
+				due = sched.First(time.Now())
+			} else {
+				due = sched.Next(due, time.Now())
+			}
+			if due.IsZero() || !pause(time.Until(due)+sched.Jitter(), stop) {
+				return
+			}
+		}
+
+		select {
+		case iterations <- i:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// notifyInterrupt returns a channel which is closed when the process is
+// interrupted, such as with Ctrl-C.
+func notifyInterrupt() <-chan struct{} {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+
+	stop := make(chan struct{})
+	go func() {
+		<-signals
+		signal.Stop(signals)
+		close(stop)
+	}()
+	return stop
+}
+
+// pause waits for d, returning false if stop is closed in the meantime.
+func pause(d time.Duration, stop <-chan struct{}) bool {
+	if d <= 0 {
+		return !interrupted(stop)
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// interrupted reports whether stop has been closed.
+func interrupted(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// loadWriteOut parses a -w format, reading it from a file when it starts with
+// @ (or from stdin for @-) like curl does.
+func loadWriteOut(format string) (*report.WriteOut, error) {
+	if strings.HasPrefix(format, "@") {
+		var raw []byte
+		var err error
+		if format == "@-" {
+			raw, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			raw, err = ioutil.ReadFile(format[1:])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading write-out format: %w", err)
+		}
+		format = string(raw)
+	}
+
+	return report.ParseWriteOut(format)
+}
+
+// loadWebhook creates the -notify-url sink, reading its payload template from
+// a file when it starts with @.
+func loadWebhook(webhookURL, payload, on string, timeout time.Duration) (*sink.Webhook, error) {
+	if on != "failure" && on != "all" && on != "incident" {
+		return nil, fmt.Errorf("invalid -notify-on %q, expected failure, all or incident", on)
+	}
+	if strings.HasPrefix(payload, "@") {
+		raw, err := ioutil.ReadFile(payload[1:])
+		if err != nil {
+			return nil, fmt.Errorf("error reading webhook template: %w", err)
+		}
+		payload = string(raw)
+	}
+
+	tmpl, err := sink.ParseWebhookTemplate(payload)
+	if err != nil {
+		return nil, err
+	}
+	return sink.NewWebhook(webhookURL, tmpl, on == "failure", &http.Client{Timeout: timeout}), nil
+}
+
+// openReportFile creates or truncates the -report-file, or opens it for
+// appending, and writes a header giving the time of the run and the request.
+func openReportFile(path string, appendTo bool, method, url string) (*os.File, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appendTo {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening report file: %w", err)
+	}
+
+	_, err = fmt.Fprintf(f, "# %s %s %s\n", time.Now().Format(time.RFC3339), method, url)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("error writing report file: %w", err)
+	}
+
+	return f, nil
+}
+
+// useColor reports whether f is a terminal which should show colors, unless
+// disabled by setting NO_COLOR or TERM=dumb.
+func useColor(f *os.File) bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+
+	return isTerminal(f)
+}
+
+// isTerminal reports whether f is a terminal rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// reportWidth returns the number of columns to fit the report into when
+// writing it to f, taken from $COLUMNS if set or else from the terminal, and
+// 0 for no limit if f is not a terminal.
+func reportWidth(f *os.File) int {
+	if !isTerminal(f) {
+		return 0
+	}
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	return terminalWidth(f)
+}
+
+// parseColorThresholds parses a -color-thresholds value such as
+// "100ms,500ms".
+func parseColorThresholds(spec string) (time.Duration, time.Duration, error) {
+	split := strings.Split(spec, ",")
+	if len(split) != 2 {
+		return 0, 0, fmt.Errorf("invalid -color-thresholds %q, expected slow,very slow such as 100ms,500ms", spec)
+	}
+
+	slow, err := time.ParseDuration(strings.TrimSpace(split[0]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid -color-thresholds: %w", err)
+	}
+	verySlow, err := time.ParseDuration(strings.TrimSpace(split[1]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid -color-thresholds: %w", err)
+	}
+	if verySlow < slow {
+		return 0, 0, fmt.Errorf("invalid -color-thresholds %q, the very slow threshold is less than the slow one", spec)
+	}
+
+	return slow, verySlow, nil
+}
+
+// maxAutoN caps the number of requests sent with -auto-n.
+const maxAutoN = 10000
+
+// parseCI parses a -ci value such as "95:5%" into a confidence level and a
+// relative precision, such as 0.95 and 0.05.
+func parseCI(spec string) (float64, float64, error) {
+	split := strings.SplitN(spec, ":", 2)
+	if len(split) != 2 {
+		return 0, 0, fmt.Errorf("invalid -ci %q, expected confidence:precision such as 95:5%%", spec)
+	}
+
+	confidence, err := strconv.ParseFloat(strings.TrimSuffix(split[0], "%"), 64)
+	if err != nil || confidence <= 0 || confidence >= 100 {
+		return 0, 0, fmt.Errorf("invalid -ci confidence level %q, expected a percentage such as 95", split[0])
+	}
+	precision, err := strconv.ParseFloat(strings.TrimSuffix(split[1], "%"), 64)
+	if err != nil || precision <= 0 {
+		return 0, 0, fmt.Errorf("invalid -ci precision %q, expected a percentage such as 5%%", split[1])
+	}
+
+	return confidence / 100, precision / 100, nil
+}
+
+// hasHeader reports whether a header is set in a list of -H values.
+func hasHeader(headers []string, name string) bool {
+	for _, h := range headers {
+		if strings.EqualFold(strings.TrimSpace(strings.SplitN(h, ":", 2)[0]), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// flagSet reports whether a flag was given on the command line.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+type stringSlice []string
+
+func (h *stringSlice) String() string {
+	return fmt.Sprintf("%s", *h)
+}
+
+func (h *stringSlice) Set(value string) error {
+	*h = append(*h, value)
+	return nil
+}
+
+func exitWithError(err error) {
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err.Error())
+	os.Exit(1)
+}
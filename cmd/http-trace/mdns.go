@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptrace"
+	"strings"
+	"time"
+)
+
+const (
+	// mdnsTimeout is how long to wait for an answer to an mDNS query, which
+	// is sent again every mdnsResend until then.
+	mdnsTimeout = 2 * time.Second
+	mdnsResend  = 500 * time.Millisecond
+
+	dnsTypeA     = 1
+	dnsTypeCNAME = 5
+	dnsTypeAAAA  = 28
+	dnsClassIN   = 1
+)
+
+// mdnsGroup is the multicast group mDNS queries are sent to (RFC 6762).
+var mdnsGroup = "224.0.0.251:5353"
+
+// isMDNSName reports whether host is a name in the .local domain, which is
+// resolved with multicast DNS rather than by a DNS server.
+func isMDNSName(host string) bool {
+	return strings.HasSuffix(strings.ToLower(strings.TrimSuffix(host, ".")), ".local")
+}
+
+// lookupMDNS resolves host by multicast DNS. The query is sent from an
+// ephemeral port, so responders answer it directly (RFC 6762 section 6.7)
+// and no mDNS daemon is needed. IPv4 addresses come first, and link-local
+// IPv6 ones are left out as the interface they are on isn't known.
+func lookupMDNS(ctx context.Context, host string) ([]net.IPAddr, error) {
+	name := strings.TrimSuffix(host, ".") + "."
+	query, err := dnsQuery(0, name, dnsTypeA, dnsTypeAAAA)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return nil, fmt.Errorf("error sending mDNS query: %w", err)
+	}
+	defer conn.Close()
+	group, err := net.ResolveUDPAddr("udp4", mdnsGroup)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(mdnsTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	buf := make([]byte, 9000)
+	for time.Now().Before(deadline) {
+		_, err = conn.WriteTo(query, group)
+		if err != nil {
+			return nil, fmt.Errorf("error sending mDNS query: %w", err)
+		}
+
+		resend := time.Now().Add(mdnsResend)
+		if resend.After(deadline) {
+			resend = deadline
+		}
+		conn.SetReadDeadline(resend)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					break
+				}
+				return nil, fmt.Errorf("error reading mDNS answer: %w", err)
+			}
+			addrs := parseMDNSAnswer(buf[:n], name)
+			if len(addrs) > 0 {
+				return addrs, nil
+			}
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+
+	return nil, &net.DNSError{Err: "no mDNS answer", Name: host, IsTimeout: true, IsNotFound: true}
+}
+
+// dnsQuery builds a DNS query with id for the records of name of each of
+// qtypes.
+func dnsQuery(id uint16, name string, qtypes ...uint16) ([]byte, error) {
+	msg := make([]byte, 12, 64)
+	binary.BigEndian.PutUint16(msg, id)
+	binary.BigEndian.PutUint16(msg[4:], uint16(len(qtypes))) // Questions
+
+	encoded := []byte{}
+	if name = strings.TrimSuffix(name, "."); name != "" {
+		for _, label := range strings.Split(name, ".") {
+			if len(label) == 0 || len(label) > 63 {
+				return nil, fmt.Errorf("invalid DNS name %q", name)
+			}
+			encoded = append(encoded, byte(len(label)))
+			encoded = append(encoded, label...)
+		}
+	}
+	encoded = append(encoded, 0)
+
+	for _, qtype := range qtypes {
+		msg = append(msg, encoded...)
+		msg = append(msg, byte(qtype>>8), byte(qtype), 0, dnsClassIN)
+	}
+	return msg, nil
+}
+
+// parseMDNSAnswer returns the addresses of name in a DNS response, ignoring
+// any it can't parse.
+func parseMDNSAnswer(msg []byte, name string) []net.IPAddr {
+	if len(msg) < 12 || msg[2]&0x80 == 0 {
+		return nil
+	}
+	questions := int(binary.BigEndian.Uint16(msg[4:]))
+	records := int(binary.BigEndian.Uint16(msg[6:])) + int(binary.BigEndian.Uint16(msg[8:])) + int(binary.BigEndian.Uint16(msg[10:]))
+
+	offset := 12
+	for i := 0; i < questions; i++ {
+		_, next, ok := readDNSName(msg, offset)
+		if !ok || next+4 > len(msg) {
+			return nil
+		}
+		offset = next + 4
+	}
+
+	var v4, v6 []net.IPAddr
+	for i := 0; i < records; i++ {
+		owner, next, ok := readDNSName(msg, offset)
+		if !ok || next+10 > len(msg) {
+			break
+		}
+		rrType := binary.BigEndian.Uint16(msg[next:])
+		class := binary.BigEndian.Uint16(msg[next+2:]) &^ 0x8000 // Without the cache-flush bit
+		length := int(binary.BigEndian.Uint16(msg[next+8:]))
+		data := next + 10
+		if data+length > len(msg) {
+			break
+		}
+		offset = data + length
+
+		if class != dnsClassIN || !strings.EqualFold(owner, name) {
+			continue
+		}
+		switch {
+		case rrType == dnsTypeA && length == net.IPv4len:
+			v4 = append(v4, net.IPAddr{IP: net.IP(append([]byte{}, msg[data:data+length]...))})
+		case rrType == dnsTypeAAAA && length == net.IPv6len:
+			ip := net.IP(append([]byte{}, msg[data:data+length]...))
+			if !ip.IsLinkLocalUnicast() {
+				v6 = append(v6, net.IPAddr{IP: ip})
+			}
+		}
+	}
+
+	return append(v4, v6...)
+}
+
+// readDNSName reads the possibly compressed name at offset in msg, returning
+// it with a trailing dot and the offset following it.
+func readDNSName(msg []byte, offset int) (string, int, bool) {
+	labels := []string{}
+	next := -1
+	for jumps := 0; jumps < 16; {
+		if offset >= len(msg) {
+			return "", 0, false
+		}
+		length := int(msg[offset])
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = offset + 1
+			}
+			return strings.Join(labels, ".") + ".", next, true
+		case length&0xc0 == 0xc0:
+			if offset+1 >= len(msg) {
+				return "", 0, false
+			}
+			if next < 0 {
+				next = offset + 2
+			}
+			offset = int(binary.BigEndian.Uint16(msg[offset:]) & 0x3fff)
+			jumps++
+		default:
+			if offset+1+length > len(msg) {
+				return "", 0, false
+			}
+			labels = append(labels, string(msg[offset+1:offset+1+length]))
+			offset += 1 + length
+		}
+	}
+	return "", 0, false
+}
+
+// dialMDNS wraps dial so .local hosts are resolved with lookupMDNS. The
+// lookup is reported to the httptrace hooks of the request, so its time is
+// the DNS phase, as for any other name.
+func dialMDNS(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || !isMDNSName(host) {
+			return dial(ctx, network, addr)
+		}
+
+		clientTrace := httptrace.ContextClientTrace(ctx)
+		if clientTrace != nil && clientTrace.DNSStart != nil {
+			clientTrace.DNSStart(httptrace.DNSStartInfo{Host: host})
+		}
+		addrs, err := lookupMDNS(ctx, host)
+		if clientTrace != nil && clientTrace.DNSDone != nil {
+			clientTrace.DNSDone(httptrace.DNSDoneInfo{Addrs: addrs, Err: err})
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, a := range addrs {
+			var conn net.Conn
+			conn, err = dial(ctx, network, net.JoinHostPort(a.IP.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+		}
+		return nil, err
+	}
+}
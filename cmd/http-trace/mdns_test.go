@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+const (
+	// printerName is printer.local. encoded as in a DNS message.
+	printerName = "\x07printer\x05local\x00"
+	// responseHeader starts a response without questions, followed by the
+	// number of answers and additional records.
+	responseHeader = "\x00\x00\x84\x00\x00\x00"
+
+	recordA       = "\x00\x01\x80\x01\x00\x00\x00\x78\x00\x04" // IN with the cache-flush bit, a TTL of 120
+	recordAAAA    = "\x00\x1c\x80\x01\x00\x00\x00\x78\x00\x10"
+	recordCNAME   = "\x00\x05\x00\x01\x00\x00\x00\x78\x00\x0f"
+	ipv6Global    = "\x20\x01\x0d\xb8\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x05" // 2001:db8::5
+	ipv6LinkLocal = "\xfe\x80\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01" // fe80::1
+)
+
+func TestDNSQuery(t *testing.T) {
+	type testDNSQuery struct {
+		name          string
+		qtypes        []uint16
+		expected      string
+		expectedError string
+	}
+
+	tests := map[string]testDNSQuery{
+		"will ask for each type": {
+			name:   "printer.local.",
+			qtypes: []uint16{dnsTypeA, dnsTypeAAAA},
+			expected: "\x12\x34\x00\x00\x00\x02\x00\x00\x00\x00\x00\x00" +
+				printerName + "\x00\x01\x00\x01" +
+				printerName + "\x00\x1c\x00\x01",
+		},
+		"will encode a name without a trailing dot": {
+			name:     "printer.local",
+			qtypes:   []uint16{dnsTypeA},
+			expected: "\x12\x34\x00\x00\x00\x01\x00\x00\x00\x00\x00\x00" + printerName + "\x00\x01\x00\x01",
+		},
+		"will encode the root": {
+			name:     ".",
+			qtypes:   []uint16{dnsTypeA},
+			expected: "\x12\x34\x00\x00\x00\x01\x00\x00\x00\x00\x00\x00\x00\x00\x01\x00\x01",
+		},
+		"will fail for an empty label": {
+			name:          "printer..local.",
+			qtypes:        []uint16{dnsTypeA},
+			expectedError: `invalid DNS name "printer..local"`,
+		},
+		"will fail for a label which is too long": {
+			name:          "0123456789012345678901234567890123456789012345678901234567890123.local.",
+			qtypes:        []uint16{dnsTypeA},
+			expectedError: `invalid DNS name "0123456789012345678901234567890123456789012345678901234567890123.local"`,
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			query, err := dnsQuery(0x1234, cfg.name, cfg.qtypes...)
+			if cfg.expectedError != "" {
+				if err == nil || err.Error() != cfg.expectedError {
+					t.Errorf("Unexpected error: got %v, want %q", err, cfg.expectedError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Error building query: %v", err)
+			}
+			if !bytes.Equal(query, []byte(cfg.expected)) {
+				t.Errorf("Unexpected query: got %q, want %q", query, cfg.expected)
+			}
+		})
+	}
+}
+
+func TestParseMDNSAnswer(t *testing.T) {
+	type testMDNSAnswer struct {
+		msg      string
+		expected []string
+	}
+
+	tests := map[string]testMDNSAnswer{
+		"will return IPv4 addresses first, without link-local IPv6 ones": {
+			msg: responseHeader + "\x00\x02\x00\x00\x00\x01" +
+				printerName + recordAAAA + ipv6Global +
+				printerName + recordA + "\xc0\xa8\x01\x14" +
+				printerName + recordAAAA + ipv6LinkLocal,
+			expected: []string{"192.168.1.20", "2001:db8::5"},
+		},
+		"will follow a compressed name to the question": {
+			msg: "\x00\x00\x84\x00\x00\x01\x00\x01\x00\x00\x00\x00" +
+				printerName + "\x00\x01\x00\x01" +
+				"\xc0\x0c" + recordA + "\x0a\x00\x00\x07",
+			expected: []string{"10.0.0.7"},
+		},
+		"will match the name regardless of case": {
+			msg: responseHeader + "\x00\x01\x00\x00\x00\x00" +
+				"\x07PRINTER\x05Local\x00" + recordA + "\x0a\x00\x00\x07",
+			expected: []string{"10.0.0.7"},
+		},
+		"will skip other names and types": {
+			msg: responseHeader + "\x00\x03\x00\x00\x00\x00" +
+				"\x07scanner\x05local\x00" + recordA + "\x0a\x00\x00\x08" +
+				printerName + recordCNAME + "\x07scanner\x05local\x00" +
+				printerName + recordA + "\x0a\x00\x00\x07",
+			expected: []string{"10.0.0.7"},
+		},
+		"will keep the records before a truncated one": {
+			msg: responseHeader + "\x00\x02\x00\x00\x00\x00" +
+				printerName + recordAAAA + ipv6Global +
+				printerName + recordA + "\xc0\xa8",
+			expected: []string{"2001:db8::5"},
+		},
+		"will ignore a query": {
+			msg: "\x00\x00\x00\x00\x00\x00\x00\x01\x00\x00\x00\x00" +
+				printerName + recordA + "\x0a\x00\x00\x07",
+		},
+		"will ignore a compressed name pointing at itself": {
+			msg: responseHeader + "\x00\x01\x00\x00\x00\x00" +
+				"\xc0\x0c" + recordA + "\x0a\x00\x00\x07",
+		},
+		"will ignore a message shorter than a header": {
+			msg: "\x00\x00\x84\x00",
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			addrs := parseMDNSAnswer([]byte(cfg.msg), "printer.local.")
+			got := []string{}
+			for _, a := range addrs {
+				got = append(got, a.String())
+			}
+			if len(got) != len(cfg.expected) {
+				t.Fatalf("Unexpected addresses: got %v, want %v", got, cfg.expected)
+			}
+			for i := range got {
+				if got[i] != cfg.expected[i] {
+					t.Errorf("Unexpected addresses: got %v, want %v", got, cfg.expected)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// nat64Prefix is an IPv6 prefix a NAT64 translator embeds IPv4 addresses in,
+// as described in RFC 6052.
+type nat64Prefix struct {
+	prefix net.IP
+	length int
+	dns64  bool // Learned from the AAAA records synthesized by DNS64
+}
+
+// nat64Layouts gives the bytes of an IPv6 address holding the embedded IPv4
+// address, for each prefix length. Byte 8 is always zero.
+var nat64Layouts = map[int][4]int{
+	32: {4, 5, 6, 7},
+	40: {5, 6, 7, 9},
+	48: {6, 7, 9, 10},
+	56: {7, 9, 10, 11},
+	64: {9, 10, 11, 12},
+	96: {12, 13, 14, 15},
+}
+
+// wellKnownNAT64 is the prefix reserved for NAT64, which is only ever used by
+// a translator.
+var wellKnownNAT64 = nat64Prefix{prefix: net.ParseIP("64:ff9b::"), length: 96}
+
+// ipv4OnlyArpa is the name which only has IPv4 addresses, so AAAA records
+// returned for it were synthesized by DNS64 (RFC 7050). Its addresses are
+// found in the synthesized ones to learn the NAT64 prefix.
+const ipv4OnlyArpa = "ipv4only.arpa"
+
+var ipv4OnlyAddrs = []net.IP{net.ParseIP("192.0.0.170"), net.ParseIP("192.0.0.171")}
+
+// extract returns the IPv4 address embedded in ip, if it is in the prefix.
+func (p nat64Prefix) extract(ip net.IP) (net.IP, bool) {
+	ip16 := ip.To16()
+	if ip16 == nil || ip.To4() != nil {
+		return nil, false
+	}
+	for i := 0; i < p.length/8; i++ {
+		if ip16[i] != p.prefix[i] {
+			return nil, false
+		}
+	}
+
+	layout := nat64Layouts[p.length]
+	return net.IPv4(ip16[layout[0]], ip16[layout[1]], ip16[layout[2]], ip16[layout[3]]), true
+}
+
+func (p nat64Prefix) String() string {
+	return fmt.Sprintf("%s/%d", p.prefix, p.length)
+}
+
+// nat64Detector recognises connections made through a NAT64 translator, so
+// the time spent in it isn't blamed on the server. The network is only
+// probed, once, when a request goes to an IPv6 address.
+type nat64Detector struct {
+	lookup func(ctx context.Context, host string) ([]net.IPAddr, error)
+	dial   func(network, addr string) (net.Conn, error)
+
+	once     sync.Once
+	prefixes []nat64Prefix
+	ipv6Only bool
+}
+
+func newNAT64Detector() *nat64Detector {
+	return &nat64Detector{
+		lookup: net.DefaultResolver.LookupIPAddr,
+		dial:   net.Dial,
+	}
+}
+
+// discover learns the NAT64 prefixes from the addresses DNS64 synthesizes for
+// ipv4only.arpa, and whether there is no IPv4 route at all.
+func (d *nat64Detector) discover() {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	addrs, _ := d.lookup(ctx, ipv4OnlyArpa)
+	for _, addr := range addrs {
+		for length := range nat64Layouts {
+			candidate := nat64Prefix{prefix: addr.IP.Mask(net.CIDRMask(length, 128)), length: length, dns64: true}
+			v4, ok := candidate.extract(addr.IP)
+			if ok && (v4.Equal(ipv4OnlyAddrs[0]) || v4.Equal(ipv4OnlyAddrs[1])) {
+				d.prefixes = appendPrefix(d.prefixes, candidate)
+			}
+		}
+	}
+	d.prefixes = appendPrefix(d.prefixes, wellKnownNAT64)
+
+	// Dialing UDP sends nothing, but fails without a route
+	conn, err := d.dial("udp4", "192.0.2.1:9")
+	if err != nil {
+		d.ipv6Only = true
+	} else {
+		conn.Close()
+	}
+}
+
+func appendPrefix(prefixes []nat64Prefix, p nat64Prefix) []nat64Prefix {
+	for _, existing := range prefixes {
+		if existing.length == p.length && existing.prefix.Equal(p.prefix) {
+			return prefixes
+		}
+	}
+	return append(prefixes, p)
+}
+
+// check describes how a connection to addr went through NAT64, or returns an
+// empty string if it didn't.
+func (d *nat64Detector) check(addr net.Addr) string {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok || tcpAddr.IP.To4() != nil {
+		return ""
+	}
+
+	d.once.Do(d.discover)
+	for _, p := range d.prefixes {
+		v4, ok := p.extract(tcpAddr.IP)
+		if !ok {
+			continue
+		}
+
+		warning := fmt.Sprintf("connected to %s through NAT64 prefix %s, translated to the IPv4 server %s", tcpAddr.IP, p, v4)
+		if p.dns64 {
+			warning += ", from an AAAA record synthesized by DNS64"
+		}
+		if d.ipv6Only {
+			warning += " on an IPv6-only network"
+		}
+		return warning + ", so the connect and response timings include the translator"
+	}
+
+	return ""
+}
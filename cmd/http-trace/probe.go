@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/berndhartzer/http-trace/report"
+	"github.com/berndhartzer/http-trace/trace"
+)
+
+// probeCommands are the subcommands probing a single phase of making a
+// connection, and the phase each goes up to.
+var probeCommands = map[string]string{
+	"dns": trace.ProbeDNS,
+	"tcp": trace.ProbeConnect,
+	"tls": trace.ProbeTLS,
+}
+
+// probeURL returns the URL of the host to probe, given as a host, host:port
+// or URL. Without a port, a TLS probe connects to 443 and a TCP probe to 80.
+func probeURL(phase, target string) (*url.URL, error) {
+	rawURL := target
+	if !strings.Contains(target, "://") {
+		scheme := "http"
+		if phase == trace.ProbeTLS {
+			scheme = "https"
+		}
+		rawURL = scheme + "://" + target
+	}
+	rawURL, err := asciiURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid host %q, expected a host, host:port or url", target)
+	}
+	return u, nil
+}
+
+// runProbes times the phases of making a connection to the host of target up
+// to phase, count times with delay between them, without sending a request,
+// and writes the timings of each probe to out in format. Connections are made
+// with the dialer and TLS config of transport, so -connect-to, -interface and
+// the like apply, and hosts resolved with resolver if it isn't nil. It
+// returns the code to exit with, that of the worst failed probe.
+func runProbes(transport *http.Transport, resolver *net.Resolver, timeout time.Duration, phase, target string, count int, delay time.Duration, format report.TimeFormat, out io.Writer) (int, error) {
+	u, err := probeURL(phase, target)
+	if err != nil {
+		return 0, err
+	}
+	cfg := trace.ProbeConfig{
+		Resolver:  resolver,
+		Dial:      transport.DialContext,
+		TLSConfig: transport.TLSClientConfig,
+	}
+
+	exit := 0
+	probes := []report.Probe{}
+	for i := 0; i < count; i++ {
+		if i > 0 && delay > 0 {
+			time.Sleep(delay)
+		}
+		req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+		if err != nil {
+			return 0, err
+		}
+		tracedRequest := trace.New(&http.Client{Timeout: timeout}, req, trace.WithProbe(phase, cfg))
+		err = tracedRequest.Execute()
+		if err != nil {
+			exit = worseExit(exit, exitCode(err))
+			// Shown without the request no probe sends
+			var urlErr *url.Error
+			if errors.As(err, &urlErr) {
+				err = urlErr.Err
+			}
+			probes = append(probes, report.Probe{Err: err})
+			continue
+		}
+		probes = append(probes, report.Probe{
+			Timings: tracedRequest.GetTimings(),
+			Detail:  probeDetail(phase, tracedRequest),
+		})
+	}
+
+	return exit, report.WriteProbes(out, phase, u.Host, probes, &report.Presentation{TimeFormat: format})
+}
+
+// probeDetail describes what a probe found: the addresses the host resolved
+// to, the address connected to, or the TLS version and cipher suite agreed.
+func probeDetail(phase string, tracedRequest *trace.Trace) string {
+	if phase == trace.ProbeDNS {
+		for _, e := range tracedRequest.GetEvents() {
+			if e.Name == "DNSDone" {
+				return e.Detail
+			}
+		}
+		return ""
+	}
+
+	detail := ""
+	if addr := tracedRequest.GetRemoteAddr(); addr != nil {
+		detail = addr.String()
+	}
+	if state := tracedRequest.GetResponse().TLS; phase == trace.ProbeTLS && state != nil {
+		detail = fmt.Sprintf("%s %s, %s", tlsVersionName(state.Version), tls.CipherSuiteName(state.CipherSuite), detail)
+	}
+	return detail
+}
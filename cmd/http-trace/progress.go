@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/berndhartzer/http-trace/report"
+	"github.com/berndhartzer/http-trace/trace"
+)
+
+// progressEvent is a line written by -progress-json. Offsets and the total
+// are in seconds from the start of the request.
+type progressEvent struct {
+	Time    string   `json:"time"`
+	Request int      `json:"request"`
+	Event   string   `json:"event"`
+	Phase   string   `json:"phase,omitempty"`
+	Offset  *float64 `json:"offset,omitempty"`
+	Method  string   `json:"method,omitempty"`
+	URL     string   `json:"url,omitempty"`
+	From    string   `json:"from,omitempty"`
+	Status  int      `json:"status,omitempty"`
+	Detail  string   `json:"detail,omitempty"`
+	Error   string   `json:"error,omitempty"`
+	Total   float64  `json:"total,omitempty"`
+}
+
+// progressSteps maps the trace events to the phases they start and complete.
+var progressSteps = map[string][][2]string{
+	"DNSStart":             {{"phase_started", "dns"}},
+	"DNSDone":              {{"phase_completed", "dns"}},
+	"ConnectStart":         {{"phase_started", "connect"}},
+	"ConnectDone":          {{"phase_completed", "connect"}},
+	"TLSHandshakeStart":    {{"phase_started", "tls"}},
+	"TLSHandshakeDone":     {{"phase_completed", "tls"}},
+	"GotConn":              {{"phase_started", "request_write"}},
+	"Wait100Continue":      {{"phase_started", "continue"}},
+	"Got100Continue":       {{"phase_completed", "continue"}},
+	"WroteRequest":         {{"phase_completed", "request_write"}, {"phase_started", "response_delay"}},
+	"GotFirstResponseByte": {{"phase_completed", "response_delay"}, {"phase_started", "response_read"}},
+	"BodyDone":             {{"phase_completed", "response_read"}},
+	"BodySkipped":          {{"phase_completed", "response_read"}},
+}
+
+// progressWriter writes structured progress events as JSON lines while
+// requests are in progress, for wrappers and UIs to follow them without
+// parsing the report. Each request is numbered, as with -c they interleave.
+type progressWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	redact *report.Redactor
+	last   int
+}
+
+func newProgressWriter(w io.Writer, redact *report.Redactor) *progressWriter {
+	return &progressWriter{w: w, redact: redact}
+}
+
+func (p *progressWriter) write(e progressEvent) {
+	e.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	e.URL, e.From, e.Error = p.redact.Redact(e.URL), p.redact.Redact(e.From), p.redact.Redact(e.Error)
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintf(p.w, "%s\n", line)
+}
+
+// start numbers a request, writing that it started.
+func (p *progressWriter) start(target request) int {
+	p.mu.Lock()
+	p.last++
+	id := p.last
+	p.mu.Unlock()
+
+	p.write(progressEvent{Request: id, Event: "request_started", Method: target.method, URL: target.url})
+	return id
+}
+
+// handler returns the trace event handler for request id.
+func (p *progressWriter) handler(id int) func(e trace.Event) {
+	return func(e trace.Event) {
+		offset := e.Offset.Seconds()
+		for _, step := range progressSteps[e.Name] {
+			p.write(progressEvent{Request: id, Event: step[0], Phase: step[1], Offset: &offset, Detail: e.Detail})
+		}
+	}
+}
+
+// client returns a copy of client which writes an event for each redirect
+// followed by request id, stopping after 10 as the default policy does.
+func (p *progressWriter) client(client *http.Client, id int) *http.Client {
+	c := *client
+	c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return fmt.Errorf("stopped after 10 redirects")
+		}
+		e := progressEvent{Request: id, Event: "redirect", Method: req.Method, URL: req.URL.String(), From: via[len(via)-1].URL.String()}
+		if req.Response != nil {
+			e.Status = req.Response.StatusCode
+		}
+		p.write(e)
+		return nil
+	}
+	return &c
+}
+
+// done writes that request id completed, with its result.
+func (p *progressWriter) done(id int, result *report.Result) {
+	p.write(progressEvent{Request: id, Event: "request_completed", Status: result.Status, Error: result.Error, Total: result.Timings["total"]})
+}
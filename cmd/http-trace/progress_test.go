@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/berndhartzer/http-trace/report"
+	"github.com/berndhartzer/http-trace/trace"
+)
+
+func readProgress(t *testing.T, out *bytes.Buffer) []progressEvent {
+	t.Helper()
+
+	events := []progressEvent{}
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		var e progressEvent
+		err := json.Unmarshal(scanner.Bytes(), &e)
+		if err != nil {
+			t.Fatalf("Error decoding progress line %q: %v", scanner.Text(), err)
+		}
+		_, err = time.Parse(time.RFC3339Nano, e.Time)
+		if err != nil {
+			t.Errorf("Unexpected time of %s: %v", scanner.Text(), err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestProgressWriter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/start" {
+			http.Redirect(w, r, "/done?token=secret", http.StatusFound)
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	out := &bytes.Buffer{}
+	progress := newProgressWriter(out, report.NewRedactor([]string{"token"}, nil))
+
+	target := request{method: http.MethodGet, url: server.URL + "/start?token=secret"}
+	id := progress.start(target)
+	req, err := http.NewRequest(target.method, target.url, nil)
+	if err != nil {
+		t.Fatalf("Error creating http request: %v", err)
+	}
+	tracedRequest := trace.New(progress.client(server.Client(), id), req)
+	tracedRequest.SetEventHandler(progress.handler(id))
+	err = tracedRequest.Execute()
+	if err != nil {
+		t.Fatalf("Error doing traced request: %v", err)
+	}
+	progress.done(id, &report.Result{Status: http.StatusOK, Timings: map[string]float64{"total": 0.25}})
+
+	failed := progress.start(request{method: http.MethodPost, url: "http://thing.invalid/?token=secret"})
+	progress.done(failed, &report.Result{Error: `Post "http://thing.invalid/?token=secret": no such host`})
+
+	expected := []struct {
+		request int
+		event   string
+		phase   string
+	}{
+		{1, "request_started", ""},
+		{1, "phase_started", "connect"},
+		{1, "phase_completed", "connect"},
+		{1, "phase_started", "request_write"},
+		{1, "phase_completed", "request_write"},
+		{1, "phase_started", "response_delay"},
+		{1, "phase_completed", "response_delay"},
+		{1, "phase_started", "response_read"},
+		{1, "redirect", ""},
+		{1, "phase_started", "request_write"},
+		{1, "phase_completed", "request_write"},
+		{1, "phase_started", "response_delay"},
+		{1, "phase_completed", "response_delay"},
+		{1, "phase_started", "response_read"},
+		{1, "phase_completed", "response_read"},
+		{1, "request_completed", ""},
+		{2, "request_started", ""},
+		{2, "request_completed", ""},
+	}
+
+	events := readProgress(t, out)
+	if len(events) != len(expected) {
+		t.Fatalf("Unexpected number of events: got %d, want %d:\n%s", len(events), len(expected), out.String())
+	}
+	last := 0.0
+	for i, e := range events {
+		if e.Request != expected[i].request || e.Event != expected[i].event || e.Phase != expected[i].phase {
+			t.Errorf("Unexpected event %d: got %d %s %s, want %d %s %s", i, e.Request, e.Event, e.Phase, expected[i].request, expected[i].event, expected[i].phase)
+		}
+		if strings.HasPrefix(e.Event, "phase_") {
+			if e.Offset == nil || *e.Offset < last {
+				t.Errorf("Unexpected offset of event %d: got %v, want at least %v", i, e.Offset, last)
+			} else {
+				last = *e.Offset
+			}
+		} else if e.Offset != nil {
+			t.Errorf("Unexpected offset of event %d: got %v, want none", i, *e.Offset)
+		}
+	}
+
+	started := events[0]
+	if started.Method != http.MethodGet || started.URL != server.URL+"/start?token=REDACTED" {
+		t.Errorf("Unexpected request_started: got %s %s, want GET %s/start?token=REDACTED", started.Method, started.URL, server.URL)
+	}
+	if events[1].Detail != "tcp "+strings.TrimPrefix(server.URL, "http://") {
+		t.Errorf("Unexpected connect detail: got %q", events[1].Detail)
+	}
+	redirect := events[8]
+	if redirect.Status != http.StatusFound || redirect.From != server.URL+"/start?token=REDACTED" || redirect.URL != server.URL+"/done?token=REDACTED" {
+		t.Errorf("Unexpected redirect: got %d from %s to %s", redirect.Status, redirect.From, redirect.URL)
+	}
+	completed := events[15]
+	if completed.Status != http.StatusOK || completed.Total != 0.25 || completed.Error != "" {
+		t.Errorf("Unexpected request_completed: got %d %v %q, want 200 0.25", completed.Status, completed.Total, completed.Error)
+	}
+	failedEvent := events[17]
+	if failedEvent.Error != `Post "http://thing.invalid/?token=REDACTED": no such host` || failedEvent.Status != 0 {
+		t.Errorf("Unexpected failed request_completed: got %d %q", failedEvent.Status, failedEvent.Error)
+	}
+	if strings.Contains(out.String(), "secret") {
+		t.Errorf("Unexpected secret in progress:\n%s", out.String())
+	}
+}
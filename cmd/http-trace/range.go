@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// byteRanges matches the ranges of a Range header, such as 0-1023, 1024- or
+// -512, separated by commas.
+var byteRanges = regexp.MustCompile(`^(\d+-\d*|-\d+)(\s*,\s*(\d+-\d*|-\d+))*$`)
+
+// rangeHeader builds the Range header asked for with -range, such as
+// bytes=0-1023 (the bytes= unit is optional), or with -continue-at, to fetch
+// the rest of the body from an offset. Only one of them can be set.
+func rangeHeader(spec string, continueAt int64) (string, error) {
+	if spec != "" && continueAt > 0 {
+		return "", fmt.Errorf("-range and -continue-at can not be used together")
+	}
+	if continueAt < 0 {
+		return "", fmt.Errorf("-continue-at can not be negative")
+	}
+	if continueAt > 0 {
+		return fmt.Sprintf("Range: bytes=%d-", continueAt), nil
+	}
+	if spec == "" {
+		return "", nil
+	}
+
+	ranges := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(spec), "bytes="))
+	if !byteRanges.MatchString(ranges) {
+		return "", fmt.Errorf("invalid -range %q, expected byte ranges such as bytes=0-1023, 1024- or -512", spec)
+	}
+	return "Range: bytes=" + ranges, nil
+}
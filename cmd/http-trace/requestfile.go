@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	// requestFileVariable matches a "@name = value" variable definition.
+	requestFileVariable = regexp.MustCompile(`^@([A-Za-z0-9_.-]+)\s*=\s*(.*)$`)
+	// requestFileReference matches a {{name}} reference to a variable.
+	requestFileReference = regexp.MustCompile(`{{\s*([A-Za-z0-9_.-]+)\s*}}`)
+)
+
+// loadRequestFile reads the raw HTTP requests in a .http file, as used by the
+// VS Code REST Client and IntelliJ HTTP client: a request line, header lines
+// and, after a blank line, the body. Requests are separated by lines starting
+// with ###, and lines starting with # or // outside the body are comments.
+// "@name = value" lines define variables used as {{name}}, and a body of
+// "< path" is read from that file.
+//
+// A request line can have an absolute URL, or just a path sent to the Host
+// header over plain HTTP. If target is set, its scheme and host replace those
+// of every request. headers are sent along with those in the file.
+func loadRequestFile(path, target string, headers []string) ([]request, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading request file: %w", err)
+	}
+
+	var targetURL *url.URL
+	if target != "" {
+		targetURL, err = url.Parse(target)
+		if err != nil || targetURL.Scheme == "" || targetURL.Host == "" {
+			return nil, fmt.Errorf("invalid target %q for request file, expected a URL such as https://example.com", target)
+		}
+	}
+
+	variables := map[string]string{}
+	substitute := func(s string, line int) (string, error) {
+		var missing string
+		s = requestFileReference.ReplaceAllStringFunc(s, func(ref string) string {
+			name := requestFileReference.FindStringSubmatch(ref)[1]
+			if _, ok := placeholders[name]; ok {
+				// Left for -expand-env to fill in for each request
+				return ref
+			}
+			value, ok := variables[name]
+			if !ok && missing == "" {
+				missing = name
+			}
+			return value
+		})
+		if missing != "" {
+			return "", fmt.Errorf("error in request file line %d: undefined variable %q", line, missing)
+		}
+		return s, nil
+	}
+
+	requests := []request{}
+	lines := strings.Split(strings.Replace(string(raw), "\r\n", "\n", -1), "\n")
+	for i := 0; i < len(lines); {
+		// Skip to the request line, picking up variables along the way
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") {
+			i++
+			continue
+		}
+		if m := requestFileVariable.FindStringSubmatch(line); m != nil {
+			value, err := substitute(strings.TrimSpace(m[2]), i+1)
+			if err != nil {
+				return nil, err
+			}
+			variables[m[1]] = value
+			i++
+			continue
+		}
+
+		requestLine, err := substitute(line, i+1)
+		if err != nil {
+			return nil, err
+		}
+		fields := strings.Fields(requestLine)
+		r := request{method: "GET", headers: append([]string{}, headers...)}
+		switch {
+		case len(fields) == 1:
+			r.url = fields[0]
+		case len(fields) == 2 && strings.HasPrefix(fields[1], "HTTP/"):
+			r.url = fields[0]
+		case len(fields) == 2 || (len(fields) == 3 && strings.HasPrefix(fields[2], "HTTP/")):
+			r.method, r.url = strings.ToUpper(fields[0]), fields[1]
+		default:
+			return nil, fmt.Errorf("error in request file line %d: expected a request line such as GET /path HTTP/1.1, got %q", i+1, line)
+		}
+		requestLineNumber := i + 1
+		i++
+
+		host := ""
+		for ; i < len(lines) && strings.TrimSpace(lines[i]) != "" && !strings.HasPrefix(lines[i], "###"); i++ {
+			line := strings.TrimSpace(lines[i])
+			if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") {
+				continue
+			}
+			header, err := substitute(line, i+1)
+			if err != nil {
+				return nil, err
+			}
+			split := strings.SplitN(header, ":", 2)
+			if len(split) != 2 {
+				return nil, fmt.Errorf("error in request file line %d: expected a header, got %q", i+1, line)
+			}
+			switch strings.ToLower(strings.TrimSpace(split[0])) {
+			case "host":
+				// Go sets the Host header from the URL
+				host = strings.TrimSpace(split[1])
+			case "content-length":
+				// and the Content-Length from the body
+			default:
+				r.headers = append(r.headers, header)
+			}
+		}
+
+		body := []string{}
+		for ; i < len(lines) && !strings.HasPrefix(lines[i], "###"); i++ {
+			body = append(body, lines[i])
+		}
+		r.body = strings.Trim(strings.Join(body, "\n"), "\n")
+		if strings.HasPrefix(r.body, "< ") && !strings.Contains(r.body, "\n") {
+			bodyPath := strings.TrimSpace(r.body[2:])
+			if !filepath.IsAbs(bodyPath) {
+				bodyPath = filepath.Join(filepath.Dir(path), bodyPath)
+			}
+			content, err := ioutil.ReadFile(bodyPath)
+			if err != nil {
+				return nil, fmt.Errorf("error reading body of request on line %d: %w", requestLineNumber, err)
+			}
+			r.body = string(content)
+		} else {
+			r.body, err = substitute(r.body, requestLineNumber)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		u, err := url.Parse(r.url)
+		if err != nil {
+			return nil, fmt.Errorf("error in request file line %d: %w", requestLineNumber, err)
+		}
+		switch {
+		case targetURL != nil:
+			u.Scheme, u.Host, u.User = targetURL.Scheme, targetURL.Host, targetURL.User
+		case u.Host == "" && host != "":
+			u.Scheme, u.Host = "http", host
+		case u.Host == "":
+			return nil, fmt.Errorf("error in request file line %d: %s has no host, add a Host header or give a target URL", requestLineNumber, r.url)
+		}
+		r.url = u.String()
+
+		requests = append(requests, r)
+	}
+
+	if len(requests) == 0 {
+		return nil, fmt.Errorf("no requests in request file %s", path)
+	}
+	return requests, nil
+}
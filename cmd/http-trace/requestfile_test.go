@@ -0,0 +1,154 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadRequestFile(t *testing.T) {
+	type testRequestFile struct {
+		raw           string
+		target        string
+		expected      []request
+		expectedError string
+	}
+
+	tests := map[string]testRequestFile{
+		"will load the request line forms": {
+			raw: `https://thing.com/one
+###
+https://thing.com/two HTTP/1.1
+
+###
+post https://thing.com/three
+
+###
+DELETE https://thing.com/four HTTP/2
+`,
+			expected: []request{
+				{method: "GET", url: "https://thing.com/one", headers: []string{"Accept: */*"}},
+				{method: "GET", url: "https://thing.com/two", headers: []string{"Accept: */*"}},
+				{method: "POST", url: "https://thing.com/three", headers: []string{"Accept: */*"}},
+				{method: "DELETE", url: "https://thing.com/four", headers: []string{"Accept: */*"}},
+			},
+		},
+		"will load headers and a body, skipping comments": {
+			raw: "# Create a thing\r\n" +
+				"POST https://thing.com/things HTTP/1.1\r\n" +
+				"Content-Type: application/json\r\n" +
+				"// not sent\r\n" +
+				"Content-Length: 99\r\n" +
+				"\r\n" +
+				"{\"name\": \"thing\"}\r\n" +
+				"\r\n" +
+				"### next\r\n",
+			expected: []request{
+				{method: "POST", url: "https://thing.com/things", headers: []string{"Accept: */*", "Content-Type: application/json"}, body: `{"name": "thing"}`},
+			},
+		},
+		"will send a path to the Host header over http": {
+			raw: `GET /things?page=2 HTTP/1.1
+Host: thing.com:8080
+`,
+			expected: []request{
+				{method: "GET", url: "http://thing.com:8080/things?page=2", headers: []string{"Accept: */*"}},
+			},
+		},
+		"will replace the scheme and host with the target": {
+			raw: `GET http://localhost/things
+Host: localhost
+`,
+			target: "https://user@thing.com",
+			expected: []request{
+				{method: "GET", url: "https://user@thing.com/things", headers: []string{"Accept: */*"}},
+			},
+		},
+		"will substitute variables": {
+			raw: `@host = https://thing.com
+@token = abc
+@auth = Bearer {{token}}
+
+GET {{host}}/things/{{ token }}
+Authorization: {{auth}}
+X-Request-Id: {{uuid}}
+
+{"token": "{{token}}"}
+`,
+			expected: []request{
+				{method: "GET", url: "https://thing.com/things/abc", headers: []string{"Accept: */*", "Authorization: Bearer abc", "X-Request-Id: {{uuid}}"}, body: `{"token": "abc"}`},
+			},
+		},
+		"will read a body from a file next to it": {
+			raw: `POST https://thing.com/upload
+
+< body.json
+`,
+			expected: []request{
+				{method: "POST", url: "https://thing.com/upload", headers: []string{"Accept: */*"}, body: `{"from": "file"}`},
+			},
+		},
+		"will fail for an undefined variable": {
+			raw: `GET https://thing.com/{{missing}}
+`,
+			expectedError: `error in request file line 1: undefined variable "missing"`,
+		},
+		"will fail for an invalid request line": {
+			raw: `GET https://thing.com/ HTTP/1.1 extra
+`,
+			expectedError: `error in request file line 1: expected a request line such as GET /path HTTP/1.1, got "GET https://thing.com/ HTTP/1.1 extra"`,
+		},
+		"will fail for an invalid header": {
+			raw: `GET https://thing.com/
+Broken
+`,
+			expectedError: `error in request file line 2: expected a header, got "Broken"`,
+		},
+		"will fail for a path without a host": {
+			raw: `GET /things
+`,
+			expectedError: "error in request file line 1: /things has no host, add a Host header or give a target URL",
+		},
+		"will fail for an invalid target": {
+			raw:           "GET /things\n",
+			target:        "thing.com",
+			expectedError: `invalid target "thing.com" for request file, expected a URL such as https://example.com`,
+		},
+		"will fail without requests": {
+			raw:           "# nothing\n@name = value\n",
+			expectedError: "no requests in request file",
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			err := ioutil.WriteFile(filepath.Join(dir, "body.json"), []byte(`{"from": "file"}`), 0644)
+			if err != nil {
+				t.Fatalf("Error writing body file: %v", err)
+			}
+			path := filepath.Join(dir, "requests.http")
+			err = ioutil.WriteFile(path, []byte(cfg.raw), 0644)
+			if err != nil {
+				t.Fatalf("Error writing request file: %v", err)
+			}
+
+			requests, err := loadRequestFile(path, cfg.target, []string{"Accept: */*"})
+			if cfg.expectedError != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), cfg.expectedError) {
+					t.Errorf("Unexpected error: got %v, want %q", err, cfg.expectedError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Error loading request file: %v", err)
+			}
+			if !reflect.DeepEqual(requests, cfg.expected) {
+				t.Errorf("Unexpected requests: got %+v, want %+v", requests, cfg.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/berndhartzer/http-trace/report"
+	"github.com/berndhartzer/http-trace/trace"
+)
+
+// probeResumption checks whether the server resumes TLS sessions, as a CDN or
+// load balancer should to save new connections a full handshake. It sends
+// target on a new connection with a full handshake, then on another new
+// connection offering the session ticket the first was given, and compares
+// the handshakes.
+func probeResumption(transport *http.Transport, timeout time.Duration, target request, redact *report.Redactor, format report.TimeFormat, out io.Writer) error {
+	displayURL := redact.Redact(target.url)
+	if !strings.HasPrefix(strings.ToLower(target.url), "https://") {
+		return fmt.Errorf("-probe-resumption needs an https url, not %s", displayURL)
+	}
+
+	// Each request gets a connection of its own, sharing a session cache
+	probeTransport := transport.Clone()
+	probeTransport.DisableKeepAlives = true
+	probeTransport.TLSClientConfig.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+	client := &http.Client{Timeout: timeout, Transport: probeTransport}
+	defer probeTransport.CloseIdleConnections()
+
+	send := func() (*trace.Trace, error) {
+		req, err := http.NewRequest(target.method, target.url, strings.NewReader(target.body))
+		if err != nil {
+			return nil, err
+		}
+		tracedRequest := trace.New(client, req)
+		err = tracedRequest.SetHeaders(target.headers)
+		if err != nil {
+			return nil, err
+		}
+		tracedRequest.SetMaxBodyCapture(0)
+		return tracedRequest, tracedRequest.Execute()
+	}
+	handshake := func(label string, tracedRequest *trace.Trace) *tls.ConnectionState {
+		state := tracedRequest.GetResponse().TLS
+		resumed := "full handshake"
+		if state.DidResume {
+			resumed = "resumed"
+		}
+		fmt.Fprintf(out, "  %-19s %*s %s, %s\n", label+":", format.Width(), format.Duration(tracedRequest.GetTimings().TLSDuration), tlsVersionName(state.Version), resumed)
+		return state
+	}
+
+	fmt.Fprintf(out, "Probing TLS session resumption with %s\n", displayURL)
+	first, err := send()
+	if err != nil {
+		return err
+	}
+	if first.GetResponse().TLS == nil {
+		return fmt.Errorf("the response to %s was not sent over TLS", displayURL)
+	}
+	handshake("First connection", first)
+
+	second, err := send()
+	if err != nil {
+		return err
+	}
+	if second.GetResponse().TLS == nil {
+		return fmt.Errorf("the response to %s was not sent over TLS", displayURL)
+	}
+	state := handshake("Second connection", second)
+
+	fmt.Fprintln(out)
+	if !state.DidResume {
+		fmt.Fprintf(out, "The session was not resumed, so every new connection needs a full handshake. The server may not issue session tickets, or not accept them back, as when connections are spread over servers which don't share ticket keys\n")
+		return nil
+	}
+	saved := first.GetTimings().TLSDuration - second.GetTimings().TLSDuration
+	fmt.Fprintf(out, "The session was resumed, the handshake taking %s less than a full one\n", format.Duration(saved))
+	return nil
+}
+
+// tlsVersionName returns the name of a TLS version, such as TLS 1.3.
+func tlsVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	}
+	return fmt.Sprintf("TLS version %#04x", version)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/berndhartzer/http-trace/ocsp"
+	"github.com/berndhartzer/http-trace/report"
+)
+
+// maxRevocationResponse is the most read of an OCSP response or CRL, which
+// for a large CA can be tens of megabytes.
+const maxRevocationResponse = 64 << 20
+
+// checkCertRevocation checks whether the certificate the server sent was
+// revoked, with the OCSP responder named in it, or else with the CRL of its
+// issuer. It is timed on its own, with client, separately from the request.
+func checkCertRevocation(client *http.Client, state *tls.ConnectionState) *report.RevocationCheck {
+	if len(state.PeerCertificates) == 0 {
+		return &report.RevocationCheck{Method: report.RevocationOCSP, Err: errors.New("the server sent no certificate")}
+	}
+	leaf := state.PeerCertificates[0]
+	issuer := certIssuer(state)
+
+	switch {
+	case len(leaf.OCSPServer) > 0 && issuer != nil:
+		check := &report.RevocationCheck{Method: report.RevocationOCSP, URL: leaf.OCSPServer[0]}
+		start := time.Now()
+		check.Status, check.Err = checkOCSP(client, check.URL, leaf, issuer)
+		check.Duration = time.Since(start)
+		return check
+	case len(leaf.CRLDistributionPoints) > 0:
+		check := &report.RevocationCheck{Method: report.RevocationCRL, URL: leaf.CRLDistributionPoints[0]}
+		start := time.Now()
+		check.Status, check.Err = checkCRL(client, check.URL, leaf)
+		check.Duration = time.Since(start)
+		return check
+	}
+	return &report.RevocationCheck{Method: report.RevocationOCSP, Err: errors.New("the certificate names no OCSP responder or CRL")}
+}
+
+// certIssuer returns the certificate which issued the leaf certificate of
+// state, or nil if the server didn't send it and it wasn't verified.
+func certIssuer(state *tls.ConnectionState) *x509.Certificate {
+	if len(state.VerifiedChains) > 0 && len(state.VerifiedChains[0]) > 1 {
+		return state.VerifiedChains[0][1]
+	}
+	if len(state.PeerCertificates) > 1 {
+		return state.PeerCertificates[1]
+	}
+	return nil
+}
+
+// checkOCSP asks the OCSP responder at url for the status of cert.
+func checkOCSP(client *http.Client, url string, cert, issuer *x509.Certificate) (string, error) {
+	req, err := ocsp.CreateRequest(cert, issuer)
+	if err != nil {
+		return "", err
+	}
+	body, err := fetchRevocation(client, http.MethodPost, url, req)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := ocsp.ParseResponse(body)
+	if err != nil {
+		return "", err
+	}
+	if resp.SerialNumber == nil || resp.SerialNumber.Cmp(cert.SerialNumber) != 0 {
+		return "", errors.New("the OCSP response is for another certificate")
+	}
+	return resp.Status, nil
+}
+
+// checkCRL looks for cert in the certificate revocation list at url.
+func checkCRL(client *http.Client, url string, cert *x509.Certificate) (string, error) {
+	body, err := fetchRevocation(client, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	crl, err := x509.ParseCRL(body)
+	if err != nil {
+		return "", fmt.Errorf("error parsing CRL: %w", err)
+	}
+	for _, revoked := range crl.TBSCertList.RevokedCertificates {
+		if revoked.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+			return ocsp.Revoked, nil
+		}
+	}
+	return ocsp.Good, nil
+}
+
+func fetchRevocation(client *http.Client, method, url string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/ocsp-request")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s answered %s", url, resp.Status)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxRevocationResponse))
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", url, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,523 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/berndhartzer/http-trace/cassette"
+	"github.com/berndhartzer/http-trace/explore"
+	"github.com/berndhartzer/http-trace/report"
+	"github.com/berndhartzer/http-trace/sink"
+	"github.com/berndhartzer/http-trace/trace"
+)
+
+// runner traces the request and reports on it. It is run once for each of
+// the -n repetitions, possibly concurrently, sharing the client so
+// connections can be reused.
+type runner struct {
+	client         *http.Client
+	mirror         string
+	mirrorClient   *http.Client
+	pipeTo         string
+	maxBodyDisplay int64
+	bodyFile       string
+	recorder       *cassette.Recorder
+	presentation   *report.Presentation
+	bodyBudget     int64
+	failOverBudget bool
+	failStatus     bool // Fail requests whose response status is 4xx or 5xx
+	sinks          []sink.Sink
+	hooks          *hookRunner
+	pushgateway    string
+	pushClient     *http.Client
+	csv            *report.CSVWriter
+	out            io.Writer
+	verbose        bool
+	events         bool
+	statusInterval time.Duration // Between the status lines of a request in progress
+	showDownload   bool          // Draw the progress of reading large bodies on stderr
+	stallTimeout   time.Duration // Without bytes of the body, after which reading it is aborted
+	wireDumpDir    string        // Where to save the bytes of each request on the wire
+	explore        bool
+	headOnly       bool     // Stop each request after the response headers
+	longPoll       bool     // Expect the server to hold the response open
+	expectContinue bool     // Wait for the server to approve request bodies with 100 Continue
+	trailers       []string // Trailers to send after each request body
+	showLocalAddr  bool     // Report the address requests were sent from, as it was chosen
+	ocspCheck      bool     // Check the revocation of the certificate of the server
+	progress       *progressWriter
+	expandEnv      bool // Expand environment variables and placeholders in each request
+	nat64          *nat64Detector
+	quiet          bool // Don't print the report for each request, such as when only a summary is wanted
+
+	mu      sync.Mutex
+	printed bool
+	dumped  int // Requests whose bytes were saved with -dump-wire, to number their files
+}
+
+// request is what to send for a traced request, which can differ between the
+// requests of a run.
+type request struct {
+	method  string
+	url     string
+	headers []string
+	body    string
+	query   []string        // -url-query parameters to add to the url once it has been expanded
+	binary  bool            // The body is sent as it is, without expanding it
+	file    string          // The -data-binary file the body was read from, - for stdin
+	proxied *proxiedRequest // Received by serve, and sent on instead of the method, url and body
+	client  *http.Client    // Sends the request instead of the client of the runner, such as to one address with -all-ips
+	// response is called with the response and its whole body once it has
+	// been reported, such as to capture values from it for the next request
+	response func(resp *http.Response, body string) error
+}
+
+// run traces a single request, prints its report and publishes the result,
+// which it also returns.
+func (r *runner) run(target request) (*report.Result, error) {
+	if r.expandEnv {
+		var err error
+		target, err = expandRequest(target)
+		if err != nil {
+			return nil, err
+		}
+	}
+	client := r.client
+	if target.client != nil {
+		client = target.client
+	}
+	var progressID int
+	if r.progress != nil {
+		progressID = r.progress.start(target)
+		if target.proxied == nil {
+			client = r.progress.client(client, progressID)
+		}
+	}
+	req, tracedRequest, err := r.newTrace(client, target)
+	if err != nil {
+		return nil, err
+	}
+	if r.progress != nil {
+		tracedRequest.SetEventHandler(r.progress.handler(progressID))
+	}
+	if r.wireDumpDir != "" {
+		closeDump, err := r.dumpWire(r.wireDumpDir, tracedRequest)
+		if err != nil {
+			return nil, err
+		}
+		defer closeDump()
+	}
+	if r.statusInterval > 0 {
+		tracedRequest.SetStatusHandler(r.statusInterval, func(s trace.Status) {
+			fmt.Fprintf(os.Stderr, "* %s\n", report.FormatStatus(s))
+		})
+	}
+	var download *downloadProgress
+	if r.showDownload {
+		download = &downloadProgress{f: os.Stderr}
+		tracedRequest.SetProgressHandler(downloadProgressInterval, download.update)
+	}
+	bodyWriters := []io.Writer{}
+	if r.bodyFile != "" {
+		f, err := os.Create(r.bodyFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		bodyWriters = append(bodyWriters, f)
+	}
+	var bodyHash hash.Hash
+	if r.presentation.KeepBody.Mode == report.KeepBodyHash {
+		// Hashed as it is read, as only part of the body may be kept
+		bodyHash = sha256.New()
+		bodyWriters = append(bodyWriters, bodyHash)
+	}
+	if target.proxied != nil {
+		bodyWriters = append(bodyWriters, target.proxied)
+	}
+	if len(bodyWriters) > 0 {
+		tracedRequest.SetBodyWriter(io.MultiWriter(bodyWriters...))
+	}
+	if r.recorder != nil {
+		tracedRequest.SetClock(r.recorder)
+	}
+	if r.pipeTo != "" {
+		// The whole body is sent on, however much of it is displayed.
+		tracedRequest.SetMaxBodyCapture(-1)
+	}
+
+	var mirrorReq *http.Request
+	var mirrorTrace *trace.Trace
+	var mirrorErr error
+	var mirrorDone sync.WaitGroup
+	if r.mirror != "" {
+		mirror := target
+		mirror.url = r.mirror
+		mirrorReq, mirrorTrace, err = r.newTrace(r.mirrorClient, mirror)
+		if err != nil {
+			return nil, err
+		}
+		mirrorDone.Add(1)
+		go func() {
+			defer mirrorDone.Done()
+			mirrorErr = mirrorTrace.Execute()
+		}()
+	}
+
+	err = tracedRequest.Execute()
+	if download != nil {
+		download.clear()
+	}
+	mirrorDone.Wait()
+	// The response is still reported when only reading its body failed
+	var bodyErr *trace.BodyReadError
+	if errors.As(err, &bodyErr) {
+		err = nil
+	}
+	if err != nil && target.proxied != nil {
+		target.proxied.fail(err)
+	}
+	if err != nil {
+		result := r.presentation.Redactor.RedactResult(report.ErrorResult(req, err))
+		if r.progress != nil {
+			r.progress.done(progressID, result)
+		}
+		printErr := r.print(nil, result)
+		if printErr != nil {
+			return result, printErr
+		}
+		sendResult(r.sinks, result)
+		r.hooks.Run(result, true)
+		return result, err
+	}
+
+	resp := tracedRequest.GetResponse()
+	body := tracedRequest.GetResponseBody()
+	if r.pipeTo != "" && r.maxBodyDisplay >= 0 && int64(len(body)) > r.maxBodyDisplay {
+		body = body[:r.maxBodyDisplay]
+	}
+	output := report.New(req, resp, body, tracedRequest.GetTimings(), r.presentation)
+	output.SetResponseBodySize(tracedRequest.GetResponseBodySize())
+	output.SetEvents(tracedRequest.GetEvents())
+	output.SetChunks(tracedRequest.GetChunks())
+	output.SetStatuses(tracedRequest.GetStatuses())
+	output.SetLongPoll(tracedRequest.GetLongPoll())
+	output.SetStall(tracedRequest.GetStall())
+	output.SetDNSQueries(tracedRequest.GetDNSQueries())
+	output.SetDialAttempts(tracedRequest.GetDialAttempts())
+	output.SetWireSizes(tracedRequest.GetWireSizes())
+	output.SetTCPInfo(tracedRequest.GetTCPInfo())
+	if bodyHash != nil {
+		output.SetBodySHA256(hex.EncodeToString(bodyHash.Sum(nil)))
+	}
+	if r.showLocalAddr {
+		output.SetLocalAddr(tracedRequest.GetLocalAddr())
+	}
+	output.SetConnectionReused(tracedRequest.GetConnectionReused())
+	output.SetConnectionIdleTime(tracedRequest.GetConnectionIdleTime())
+	if r.headOnly {
+		output.SetBodySkipped()
+	}
+	if mirrorErr != nil {
+		output.SetMirrorError(mirrorReq, mirrorErr)
+	} else if mirrorTrace != nil {
+		mirror := report.New(mirrorReq, mirrorTrace.GetResponse(), mirrorTrace.GetResponseBody(), mirrorTrace.GetTimings(), r.presentation)
+		mirror.SetResponseBodySize(mirrorTrace.GetResponseBodySize())
+		output.SetMirror(mirror)
+	}
+
+	var pipeErr error
+	if r.pipeTo != "" {
+		pipeErr = r.pipe(output, tracedRequest.GetResponseBody(), resp.Header.Get("Content-Type"))
+	}
+
+	if bodyErr != nil {
+		output.AddWarning(bodyErr.Error())
+	}
+	overBudget := checkBodyBudget(resp, tracedRequest.GetResponseBodySize(), r.bodyBudget)
+	if overBudget != "" {
+		output.AddWarning(overBudget)
+	}
+	if r.ocspCheck && resp.TLS != nil {
+		output.SetRevocationCheck(checkCertRevocation(&http.Client{Timeout: r.client.Timeout}, resp.TLS))
+	}
+	if host := req.URL.Hostname(); isIDN(host) {
+		unicodeHost := idnToUnicode(host)
+		output.SetUnicodeHost(unicodeHost)
+		if warning := homographWarning(unicodeHost); warning != "" {
+			output.AddWarning(warning)
+		}
+	}
+	if r.nat64 != nil {
+		if translated := r.nat64.check(tracedRequest.GetRemoteAddr()); translated != "" {
+			output.AddWarning(translated)
+		}
+	}
+	err = output.Build()
+	if err != nil {
+		return nil, err
+	}
+	result := output.Result()
+	if r.progress != nil {
+		r.progress.done(progressID, result)
+	}
+
+	if r.explore {
+		err = r.exploreBody(output, result, tracedRequest.GetResponseBody())
+	} else {
+		err = r.print(output, result)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	sendResult(r.sinks, result)
+	failedAssertions := result.FailedAssertions()
+	r.hooks.Run(result, resp.StatusCode >= 400 || bodyErr != nil || overBudget != "" || pipeErr != nil || len(failedAssertions) > 0)
+
+	if r.pushgateway != "" {
+		promReport := report.New(req, resp, tracedRequest.GetResponseBody(), tracedRequest.GetTimings(), &report.Presentation{Format: report.FormatPrometheus, Metrics: r.presentation.Metrics, Redactor: r.presentation.Redactor})
+		promReport.SetResponseBodySize(tracedRequest.GetResponseBodySize())
+		err = promReport.Build()
+		if err != nil {
+			return result, err
+		}
+
+		err = report.PushPrometheus(r.pushClient, r.pushgateway, "http_trace", promReport.String())
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if r.failStatus && resp.StatusCode >= 400 {
+		return result, &statusError{status: resp.Status, code: resp.StatusCode}
+	}
+	if len(failedAssertions) > 0 {
+		return result, fmt.Errorf("assertion failed: %s", strings.Join(failedAssertions, ", "))
+	}
+	if overBudget != "" && r.failOverBudget {
+		return result, fmt.Errorf("%s", overBudget)
+	}
+	if pipeErr != nil {
+		return result, fmt.Errorf("error piping response body to %s: %w", r.pipeTo, pipeErr)
+	}
+	if target.response != nil {
+		err = target.response(resp, tracedRequest.GetResponseBody())
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// pipe posts the response body of the first request to the -pipe-to URL and
+// adds the report for that second leg to output. The error of the second
+// request is returned after it has been recorded in output.
+func (r *runner) pipe(output *report.Report, body, contentType string) error {
+	req, err := http.NewRequest(http.MethodPost, r.pipeTo, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	tracedRequest := trace.New(r.client, req)
+	tracedRequest.SetMaxBodyCapture(r.maxBodyDisplay)
+	if r.verbose {
+		tracedRequest.SetWireWriter(r.presentation.Redactor.Writer(os.Stderr))
+	} else if r.events {
+		tracedRequest.SetEventHandler(r.printEvent)
+	}
+
+	err = tracedRequest.Execute()
+	if err != nil {
+		output.SetPipeError(req, err)
+		return err
+	}
+
+	next := report.New(req, tracedRequest.GetResponse(), tracedRequest.GetResponseBody(), tracedRequest.GetTimings(), r.presentation)
+	next.SetResponseBodySize(tracedRequest.GetResponseBodySize())
+	next.SetEvents(tracedRequest.GetEvents())
+	next.SetChunks(tracedRequest.GetChunks())
+	next.SetStatuses(tracedRequest.GetStatuses())
+	next.SetLongPoll(tracedRequest.GetLongPoll())
+	next.SetStall(tracedRequest.GetStall())
+	next.SetDNSQueries(tracedRequest.GetDNSQueries())
+	next.SetDialAttempts(tracedRequest.GetDialAttempts())
+	next.SetWireSizes(tracedRequest.GetWireSizes())
+	next.SetTCPInfo(tracedRequest.GetTCPInfo())
+	next.SetConnectionReused(tracedRequest.GetConnectionReused())
+	next.SetConnectionIdleTime(tracedRequest.GetConnectionIdleTime())
+	output.SetPipe(next)
+	return nil
+}
+
+// print writes the report for a request to out, or a row for its result in
+// CSV output. Failed requests have no report and are only included in CSV,
+// JSON Lines and -w output.
+func (r *runner) print(output *report.Report, result *report.Result) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.csv != nil {
+		err := r.csv.Write(result)
+		if err != nil {
+			return fmt.Errorf("error writing csv: %w", err)
+		}
+		return nil
+	}
+
+	format := r.presentation.Format
+	if output == nil {
+		switch {
+		case format == report.FormatJSONL:
+			return report.WriteJSONLine(r.out, result)
+		case r.presentation.WriteOut != nil && (format == "" || format == report.FormatText):
+			return r.presentation.WriteOut.Write(r.out, result, nil)
+		}
+		return nil
+	}
+
+	if r.quiet {
+		return nil
+	}
+
+	if r.printed && (format == "" || format == report.FormatText) && r.presentation.WriteOut == nil {
+		fmt.Fprintln(r.out)
+	}
+	r.printed = true
+
+	return output.Print(r.out)
+}
+
+// exploreBody pages through a JSON response body with the timings at the top,
+// reading commands from stdin. Other bodies are printed in the report as
+// usual.
+func (r *runner) exploreBody(output *report.Report, result *report.Result, body string) error {
+	e, err := explore.New([]byte(body), result.Summary(r.presentation.TimeFormat))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: not exploring the response body: %v\n", err)
+		return r.print(output, result)
+	}
+	e.Clear = isTerminal(os.Stdout)
+
+	return e.Run(os.Stdin, r.out)
+}
+
+// printSummary writes a summary after the reports, to out for text output and
+// otherwise to stderr to keep it apart from machine readable output.
+func (r *runner) printSummary(write func(w io.Writer) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	format := r.presentation.Format
+	if format != "" && format != report.FormatText {
+		return write(os.Stderr)
+	}
+
+	if r.printed {
+		fmt.Fprintln(r.out)
+	}
+	r.printed = true
+	return write(r.out)
+}
+
+// newTrace creates a traced request for target.
+func (r *runner) newTrace(client *http.Client, target request) (*http.Request, *trace.Trace, error) {
+	var req *http.Request
+	var opts []trace.Option
+	if target.proxied != nil {
+		req = target.proxied.outgoing()
+		opts = append(opts, trace.WithTransport(target.proxied.transport(client.Transport)))
+	} else {
+		var err error
+		req, err = http.NewRequest(target.method, target.url, strings.NewReader(target.body))
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if r.expectContinue && (target.body != "" || req.ContentLength != 0) {
+		req.Header.Set("Expect", "100-continue")
+	}
+
+	tracedRequest := trace.New(client, req, opts...)
+	err := tracedRequest.SetHeaders(target.headers)
+	if err != nil {
+		return nil, nil, err
+	}
+	tracedRequest.SetMaxBodyCapture(r.maxBodyDisplay)
+	tracedRequest.SetSkipBody(r.headOnly)
+	tracedRequest.SetLongPoll(r.longPoll)
+	tracedRequest.SetStallTimeout(r.stallTimeout)
+	err = tracedRequest.SetTrailers(r.trailers)
+	if err != nil {
+		return nil, nil, err
+	}
+	if r.verbose {
+		tracedRequest.SetWireWriter(r.presentation.Redactor.Writer(os.Stderr))
+	} else if r.events {
+		tracedRequest.SetEventHandler(r.printEvent)
+	}
+
+	return req, tracedRequest, nil
+}
+
+// printEvent writes a trace event to stderr as it happens, with the time of
+// day and its offset from the start of the request.
+func (r *runner) printEvent(e trace.Event) {
+	format := r.presentation.TimeFormat
+	fmt.Fprintf(os.Stderr, "%s %*s %s\n", time.Now().Format("15:04:05.000"), format.Width(), format.Duration(e.Offset), strings.TrimSpace(e.Name+" "+e.Detail))
+}
+
+// sendResult sends a result to each sink. Failing to send is reported but
+// does not stop the others.
+func sendResult(sinks []sink.Sink, result *report.Result) {
+	for _, s := range sinks {
+		err := s.Send(result)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+	}
+}
+
+// closeSinks closes the sinks which hold results back to send in batches,
+// sending the last of them.
+func closeSinks(sinks []sink.Sink) {
+	for _, s := range sinks {
+		if c, ok := s.(io.Closer); ok {
+			err := c.Close()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			}
+		}
+	}
+}
+
+// checkBodyBudget describes how the response body exceeds budget, checking
+// both the decoded size and, when it is known, the size on the wire.
+func checkBodyBudget(resp *http.Response, decodedSize, budget int64) string {
+	if budget <= 0 {
+		return ""
+	}
+
+	if decodedSize > budget {
+		return fmt.Sprintf("response body of %d bytes is over the budget of %s", decodedSize, formatByteSize(budget))
+	}
+	if !resp.Uncompressed && resp.ContentLength > budget {
+		return fmt.Sprintf("response Content-Length of %d bytes is over the budget of %s", resp.ContentLength, formatByteSize(budget))
+	}
+
+	return ""
+}
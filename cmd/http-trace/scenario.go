@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/berndhartzer/http-trace/report"
+	"github.com/berndhartzer/http-trace/scenario"
+)
+
+// runSteps traces the requests of the steps of s in order, stopping at the
+// first which fails or gets an error status as the steps after it likely
+// depend on it, and writes a summary of the steps. The values captured from
+// the response of a step are filled in to the requests of the steps after
+// it. It returns the code to exit with, 0 if every step succeeded.
+func runSteps(r *runner, s *scenario.Scenario, requests []request, redactor *report.Redactor) int {
+	steps := make([]report.ScenarioStep, len(requests))
+	variables := map[string]string{}
+	exit := 0
+	for i, target := range requests {
+		step := s.Steps[i]
+		steps[i].Name = step.Name
+		if exit != 0 {
+			continue
+		}
+
+		target = expandVariables(target, variables)
+		if len(step.Captures) > 0 {
+			target.response = func(resp *http.Response, body string) error {
+				return capture(step.Captures, resp, body, variables)
+			}
+		}
+		result, err := r.run(target)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", redactor.Error(err))
+			if result == nil {
+				result = &report.Result{URL: redactor.Redact(target.url), Method: target.method, Error: redactor.Error(err).Error()}
+			} else if result.Error == "" {
+				steps[i].Failure = redactor.Error(err).Error()
+			}
+		}
+		steps[i].Result = result
+		switch {
+		case err != nil:
+			exit = exitCode(err)
+		case result.Status >= 400:
+			exit = exitFailed
+		}
+	}
+
+	err := r.printSummary(func(w io.Writer) error {
+		return report.WriteScenario(w, s.Name, steps, r.presentation)
+	})
+	if err != nil {
+		exitWithError(err)
+	}
+	return exit
+}
+
+// expandVariables replaces the ${name} references to captured variables in
+// the url, headers and body of target.
+func expandVariables(target request, variables map[string]string) request {
+	if len(variables) == 0 {
+		return target
+	}
+	target.url = scenario.Expand(target.url, variables)
+	headers := make([]string, len(target.headers))
+	for i, h := range target.headers {
+		headers[i] = scenario.Expand(h, variables)
+	}
+	target.headers = headers
+	target.body = scenario.Expand(target.body, variables)
+	return target
+}
+
+// capture saves the values of captures from a response as variables. Their
+// values aren't printed, as they are often tokens.
+func capture(captures []scenario.Capture, resp *http.Response, body string, variables map[string]string) error {
+	for _, c := range captures {
+		value, err := c.Extract(resp, []byte(body))
+		if err != nil {
+			return err
+		}
+		variables[c.Name] = value
+		fmt.Fprintf(os.Stderr, "* Captured %s from %s\n", c.Name, c.Source)
+	}
+	return nil
+}
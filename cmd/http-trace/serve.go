@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/berndhartzer/http-trace/report"
+)
+
+// hopHeaders are the headers of a single connection, which a proxy doesn't
+// pass on.
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// removeHopHeaders removes the hop-by-hop headers from h, and those named by
+// its Connection header.
+func removeHopHeaders(h http.Header) {
+	for _, value := range h.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
+
+// proxiedRequest is a request received by serve, which is traced as it is
+// sent on and whose response is streamed back to the client as it is read.
+type proxiedRequest struct {
+	w           http.ResponseWriter
+	received    *http.Request
+	wroteHeader bool
+}
+
+// outgoing returns the request to send on for the client.
+func (p *proxiedRequest) outgoing() *http.Request {
+	req := p.received.Clone(p.received.Context())
+	req.RequestURI = ""
+	req.Close = false
+	removeHopHeaders(req.Header)
+	return req
+}
+
+// transport returns rt wrapped to write the head of the response to the
+// client as soon as it is received, before its body is read.
+func (p *proxiedRequest) transport(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		header := p.w.Header()
+		for name, values := range resp.Header {
+			header[name] = values
+		}
+		removeHopHeaders(header)
+		p.w.WriteHeader(resp.StatusCode)
+		p.wroteHeader = true
+		p.flush()
+		return resp, nil
+	})
+}
+
+// Write passes the response body on to the client as it is read.
+func (p *proxiedRequest) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.flush()
+	return n, err
+}
+
+// fail answers the client with a bad gateway error if the request failed
+// before there was a response to pass on.
+func (p *proxiedRequest) fail(err error) {
+	if !p.wroteHeader {
+		http.Error(p.w, err.Error(), http.StatusBadGateway)
+	}
+}
+
+func (p *proxiedRequest) flush() {
+	if f, ok := p.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// roundTripperFunc is a function used as a http.RoundTripper.
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// tracingProxy is a forward HTTP proxy which traces each request sent through
+// it, reporting and publishing it as http-trace does the requests it sends
+// itself, so the timings of real traffic, such as of a browser, can be
+// collected. HTTPS requests are tunnelled with CONNECT and can't be traced,
+// as they are encrypted end to end.
+type tracingProxy struct {
+	r        *runner
+	headers  []string // -H headers added to each request
+	redactor *report.Redactor
+	timeout  time.Duration // For connecting tunnels
+	mu       sync.Mutex
+	failed   bool
+}
+
+func (p *tracingProxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodConnect {
+		p.tunnel(w, req)
+		return
+	}
+	if !req.URL.IsAbs() {
+		http.Error(w, "http-trace serve is a forward proxy, send it requests for absolute http:// URLs", http.StatusBadRequest)
+		return
+	}
+
+	proxied := &proxiedRequest{w: w, received: req}
+	target := request{method: req.Method, url: req.URL.String(), headers: p.headers, proxied: proxied}
+	_, err := p.r.run(target)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", p.redactor.Error(err))
+		p.mu.Lock()
+		p.failed = true
+		p.mu.Unlock()
+	}
+}
+
+// tunnel connects the client to req.Host for a CONNECT request, passing the
+// bytes on in both directions without tracing them.
+func (p *tracingProxy) tunnel(w http.ResponseWriter, req *http.Request) {
+	fmt.Fprintf(os.Stderr, "* CONNECT %s tunnelled without tracing, as it is encrypted\n", req.Host)
+	server, err := net.DialTimeout("tcp", req.Host, p.timeout)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer server.Close()
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "tunnelling is not supported", http.StatusInternalServerError)
+		return
+	}
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer client.Close()
+
+	_, err = client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+	if err != nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		io.Copy(server, buffered)
+		closeWrite(server)
+		close(done)
+	}()
+	io.Copy(client, server)
+	closeWrite(client)
+	<-done
+}
+
+// closeWrite passes on the end of what one side of a tunnel sent to the
+// other, conn, so it finishes its side in turn rather than both waiting on
+// each other. Connections which can't be half closed are closed.
+func closeWrite(conn net.Conn) {
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.CloseWrite()
+		return
+	}
+	conn.Close()
+}
+
+// serveProxy runs the tracing proxy on addr until interrupted, returning
+// whether any request failed.
+func serveProxy(r *runner, addr string, headers []string, redactor *report.Redactor, timeout time.Duration) (bool, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return false, fmt.Errorf("error listening: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Tracing requests sent through the proxy at http://%s, until interrupted\n", listener.Addr())
+
+	proxy := &tracingProxy{r: r, headers: headers, redactor: redactor, timeout: timeout}
+	server := &http.Server{Handler: proxy}
+	stop := notifyInterrupt()
+	shutdown := make(chan struct{})
+	go func() {
+		<-stop
+		// Waits for the requests in progress, so their results are sent
+		server.Shutdown(context.Background())
+		close(shutdown)
+	}()
+
+	err = server.Serve(listener)
+	if err != http.ErrServerClosed {
+		return false, fmt.Errorf("error serving: %w", err)
+	}
+	<-shutdown
+	proxy.mu.Lock()
+	defer proxy.mu.Unlock()
+	return proxy.failed, nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/berndhartzer/http-trace/report"
+)
+
+func newTestProxy() *httptest.Server {
+	r := &runner{
+		client:       &http.Client{},
+		presentation: &report.Presentation{},
+		hooks:        &hookRunner{},
+		out:          &bytes.Buffer{},
+	}
+	return httptest.NewServer(&tracingProxy{r: r, headers: []string{"X-Added: yes"}, timeout: time.Second})
+}
+
+func TestServeProxy(t *testing.T) {
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		w.Header().Set("Connection", "X-Server-Hop")
+		w.Header().Set("X-Server-Hop", "secret")
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.Header().Set("X-Kept", "yes")
+		fmt.Fprint(w, "hello")
+	}))
+	defer server.Close()
+	proxy := newTestProxy()
+	defer proxy.Close()
+
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatalf("Error parsing proxy url: %v", err)
+	}
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	request, err := http.NewRequest(http.MethodGet, server.URL+"/things", nil)
+	if err != nil {
+		t.Fatalf("Error creating http request: %v", err)
+	}
+	request.Header.Set("X-Sent", "yes")
+	request.Header.Set("Proxy-Authorization", "Basic abc")
+	request.Header.Set("Connection", "X-Client-Hop")
+	request.Header.Set("X-Client-Hop", "secret")
+	resp, err := client.Do(request)
+	if err != nil {
+		t.Fatalf("Error sending request through the proxy: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Error reading response body: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK || string(body) != "hello" {
+		t.Errorf("Unexpected response: got %s %q, want 200 OK \"hello\"", resp.Status, body)
+	}
+	if received.Get("X-Sent") != "yes" || received.Get("X-Added") != "yes" {
+		t.Errorf("Expected the request and -H headers to be sent on: got %v", received)
+	}
+	for _, name := range []string{"Proxy-Authorization", "X-Client-Hop"} {
+		if received.Get(name) != "" {
+			t.Errorf("Expected the hop header %s not to be sent on: got %v", name, received)
+		}
+	}
+	if resp.Header.Get("X-Kept") != "yes" {
+		t.Errorf("Expected the response headers to be passed back: got %v", resp.Header)
+	}
+	for _, name := range []string{"X-Server-Hop", "Keep-Alive"} {
+		if resp.Header.Get(name) != "" {
+			t.Errorf("Expected the hop header %s not to be passed back: got %v", name, resp.Header)
+		}
+	}
+
+	resp, err = http.Get(proxy.URL + "/things")
+	if err != nil {
+		t.Fatalf("Error sending request to the proxy: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Unexpected status for a request which isn't for an absolute URL: got %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestServeProxyConnect(t *testing.T) {
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	defer echo.Close()
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	proxy := newTestProxy()
+	defer proxy.Close()
+
+	type testConnect struct {
+		addr           string
+		expectedStatus int
+	}
+
+	tests := map[string]testConnect{
+		"will tunnel to the server": {
+			addr:           echo.Addr().String(),
+			expectedStatus: http.StatusOK,
+		},
+		"will fail for a server which can't be connected to": {
+			addr:           closedAddr,
+			expectedStatus: http.StatusBadGateway,
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			conn, err := net.Dial("tcp", strings.TrimPrefix(proxy.URL, "http://"))
+			if err != nil {
+				t.Fatalf("Error connecting to the proxy: %v", err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", cfg.addr, cfg.addr)
+			reader := bufio.NewReader(conn)
+			resp, err := http.ReadResponse(reader, &http.Request{Method: http.MethodConnect})
+			if err != nil {
+				t.Fatalf("Error reading CONNECT response: %v", err)
+			}
+			if resp.StatusCode != cfg.expectedStatus {
+				t.Fatalf("Unexpected status: got %d, want %d", resp.StatusCode, cfg.expectedStatus)
+			}
+			if resp.StatusCode != http.StatusOK {
+				return
+			}
+
+			fmt.Fprint(conn, "ping\n")
+			line, err := reader.ReadString('\n')
+			if err != nil || line != "ping\n" {
+				t.Errorf("Unexpected bytes through the tunnel: got %q, %v, want \"ping\\n\"", line, err)
+			}
+
+			// The end of the request is passed on, so the server ends the
+			// tunnel in turn
+			conn.(*net.TCPConn).CloseWrite()
+			rest, err := ioutil.ReadAll(reader)
+			if err != nil || len(rest) != 0 {
+				t.Errorf("Unexpected end of the tunnel: got %q, %v, want EOF", rest, err)
+			}
+		})
+	}
+}
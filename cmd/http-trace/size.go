@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var byteSizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+	{"B", 1},
+}
+
+// byteSize is a flag value for a number of bytes, accepting B, KB, MB and GB
+// suffixes in powers of 1024.
+type byteSize int64
+
+func (b *byteSize) String() string {
+	return formatByteSize(int64(*b))
+}
+
+func (b *byteSize) Set(value string) error {
+	n, err := parseByteSize(value)
+	if err != nil {
+		return err
+	}
+	*b = byteSize(n)
+	return nil
+}
+
+func parseByteSize(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range byteSizeUnits {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			multiplier = unit.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+
+	return int64(n * float64(multiplier)), nil
+}
+
+func formatByteSize(n int64) string {
+	for _, unit := range byteSizeUnits[:3] {
+		if n >= unit.size && n%unit.size == 0 {
+			return fmt.Sprintf("%d%s", n/unit.size, unit.suffix)
+		}
+	}
+	return strconv.FormatInt(n, 10)
+}
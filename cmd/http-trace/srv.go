@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/berndhartzer/http-trace/report"
+)
+
+// lookupSRV resolves a DNS SRV name, such as _http._tcp.example.com, returning
+// the records in the order they should be tried: by priority, and randomly by
+// weight within a priority (RFC 2782).
+func lookupSRV(name string) ([]*net.SRV, error) {
+	_, addrs, err := net.LookupSRV("", "", name)
+	return addrs, err
+}
+
+// resolveSRV picks the target to send the request to from the SRV records of
+// name, describing the records considered to out. The scheme, path and query
+// are taken from rawURL if it is set, and its host and port are replaced by
+// those of the target. Otherwise the URL is the root of the target, over
+// HTTPS for port 443 and HTTP for any other. The time resolving took is
+// shown in format.
+func resolveSRV(name, rawURL string, format report.TimeFormat, out io.Writer) (string, error) {
+	start := time.Now()
+	addrs, err := lookupSRV(name)
+	if err != nil {
+		return "", fmt.Errorf("error looking up SRV records: %w", err)
+	}
+	if len(addrs) == 0 || (len(addrs) == 1 && addrs[0].Target == ".") {
+		return "", fmt.Errorf("no service available from the SRV records of %s", name)
+	}
+	elapsed := time.Since(start)
+
+	chosen := addrs[0]
+	fmt.Fprintf(out, "SRV records for %s, resolved in %s:\n", name, format.Duration(elapsed))
+	fmt.Fprintf(out, "  %8s %6s %5s  %s\n", "priority", "weight", "port", "target")
+	for _, a := range addrs {
+		marker := " "
+		if a == chosen {
+			marker = "*"
+		}
+		fmt.Fprintf(out, "%s %8d %6d %5d  %s\n", marker, a.Priority, a.Weight, a.Port, a.Target)
+	}
+
+	return instanceURL(rawURL, strings.TrimSuffix(chosen.Target, "."), int(chosen.Port))
+}
@@ -0,0 +1,14 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package main
+
+import (
+	"os"
+)
+
+// terminalWidth returns the number of columns of the terminal f is, which
+// isn't known on this platform, so 0 as if it isn't one.
+func terminalWidth(f *os.File) int {
+	return 0
+}
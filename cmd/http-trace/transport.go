@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/berndhartzer/http-trace/trace"
+)
+
+// transportConfig holds the options which control how connections to the
+// server are made.
+type transportConfig struct {
+	unixSocket      string
+	keyLogFile      string
+	maxIdleConns    int
+	noKeepAlive     bool // Close each connection after its request
+	maxConnsPerHost int
+	idleConnTimeout time.Duration
+	noMDNS          bool          // Leave .local names to the system resolver
+	connectTo       []connectRule // Connect to other addresses than those of the URL
+	localAddr       *net.TCPAddr  // Make connections from this address
+	dnsQueries      bool          // Record each DNS query sent to resolve the host
+	dot             string        // Resolve over TLS with the resolver at this address
+	doh             string        // Resolve over HTTPS with the resolver at this URL
+}
+
+func newTransport(cfg *transportConfig) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{}
+	dialer := &net.Dialer{}
+
+	encrypted := cfg.dot != "" || cfg.doh != ""
+	if cfg.localAddr != nil || cfg.dnsQueries || encrypted {
+		// As the dialer of http.DefaultTransport, but bound to the address or
+		// resolving with queryResolver
+		hostDialer := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}
+		if cfg.localAddr != nil {
+			hostDialer.LocalAddr = cfg.localAddr
+		}
+		hostDialer.Resolver = hostResolver(cfg)
+		transport.DialContext = hostDialer.DialContext
+	}
+
+	if cfg.unixSocket != "" {
+		// Proxies can't be reached through the socket, and the address from the
+		// URL is only used for the Host header
+		transport.Proxy = nil
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", cfg.unixSocket)
+		}
+	} else if !cfg.noMDNS {
+		// Go's resolver often can't resolve .local names itself
+		transport.DialContext = dialMDNS(transport.DialContext)
+	}
+	if len(cfg.connectTo) > 0 && cfg.unixSocket == "" {
+		transport.DialContext = dialConnectTo(cfg.connectTo, transport.DialContext)
+	}
+	// Counted last, as the bytes of the connection actually made
+	transport.DialContext = trace.CountWire(transport.DialContext)
+
+	// Every request goes to the same host, so the idle limit applies per host
+	transport.MaxIdleConnsPerHost = cfg.maxIdleConns
+	if cfg.maxIdleConns == 0 || cfg.noKeepAlive {
+		transport.DisableKeepAlives = true
+	}
+	if cfg.maxIdleConns > transport.MaxIdleConns {
+		transport.MaxIdleConns = cfg.maxIdleConns
+	}
+	transport.MaxConnsPerHost = cfg.maxConnsPerHost
+	transport.IdleConnTimeout = cfg.idleConnTimeout
+
+	keyLogFile := cfg.keyLogFile
+	if keyLogFile == "" {
+		keyLogFile = os.Getenv("SSLKEYLOGFILE")
+	}
+	if keyLogFile != "" {
+		// The file is left open until the process exits
+		f, err := os.OpenFile(keyLogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("error opening key log file: %w", err)
+		}
+		transport.TLSClientConfig.KeyLogWriter = f
+	}
+
+	return transport, nil
+}
+
+// hostResolver returns the resolver hosts are resolved with, or nil for the
+// default one.
+func hostResolver(cfg *transportConfig) *net.Resolver {
+	switch {
+	case cfg.dot != "":
+		return queryResolver(dialDoT(cfg.dot))
+	case cfg.doh != "":
+		// A client of its own, as the resolver's connection is not one of
+		// those traced
+		dohClient := &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone()}
+		return queryResolver(dialDoH(dohClient, cfg.doh))
+	case cfg.dnsQueries:
+		return queryResolver((&net.Dialer{}).DialContext)
+	}
+	return nil
+}
+
+// describePool describes the connection pool configuration of transport, as
+// it affects how many requests have to set up a new connection.
+func describePool(transport *http.Transport) string {
+	idle := fmt.Sprintf("%d idle connections kept per host", transport.MaxIdleConnsPerHost)
+	if transport.DisableKeepAlives {
+		idle = "no idle connections kept"
+	}
+
+	perHost := "no limit on connections per host"
+	if transport.MaxConnsPerHost > 0 {
+		perHost = fmt.Sprintf("at most %d connections per host", transport.MaxConnsPerHost)
+	}
+
+	timeout := "no idle timeout"
+	if transport.IdleConnTimeout > 0 {
+		timeout = fmt.Sprintf("idle timeout %s", transport.IdleConnTimeout)
+	}
+
+	return fmt.Sprintf("Connection pool: %s, %s, %s", idle, perHost, timeout)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// headerLine matches a "Name: value" header line in a URL file. A URL has no
+// space after its scheme's colon, so it doesn't match.
+var headerLine = regexp.MustCompile(`^[A-Za-z0-9!#$%&'*+.^_|~-]+:(\s|$)`)
+
+// loadURLFile reads the requests listed in a -url-file. Each request starts
+// with a line holding a URL, optionally preceded by a method, and can be
+// followed by header lines which are sent along with base headers. Blank
+// lines and lines starting with # are ignored.
+func loadURLFile(path, method string, headers []string) ([]request, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading url file: %w", err)
+	}
+
+	requests := []request{}
+	for i, line := range strings.Split(string(raw), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if headerLine.MatchString(line) {
+			if len(requests) == 0 {
+				return nil, fmt.Errorf("error in url file line %d: header %q before the first URL", i+1, line)
+			}
+			last := &requests[len(requests)-1]
+			last.headers = append(last.headers, line)
+			continue
+		}
+
+		fields := strings.Fields(line)
+		r := request{method: method, headers: append([]string{}, headers...)}
+		switch len(fields) {
+		case 1:
+			r.url = fields[0]
+		case 2:
+			r.method, r.url = strings.ToUpper(fields[0]), fields[1]
+		default:
+			return nil, fmt.Errorf("error in url file line %d: expected [method] url, got %q", i+1, line)
+		}
+		requests = append(requests, r)
+	}
+
+	if len(requests) == 0 {
+		return nil, fmt.Errorf("no urls in url file %s", path)
+	}
+	return requests, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// checkURLQuery checks each -url-query parameter is key=value, or a key on
+// its own.
+func checkURLQuery(params []string) error {
+	for _, p := range params {
+		if strings.HasPrefix(p, "=") || p == "" {
+			return fmt.Errorf("invalid -url-query %q, expected key=value", p)
+		}
+	}
+	return nil
+}
+
+// addURLQuery returns rawURL with the key=value params URL-encoded and added
+// to its query, after any parameters it already has and before its fragment.
+// The URL is otherwise left as it is.
+func addURLQuery(rawURL string, params []string) string {
+	if len(params) == 0 {
+		return rawURL
+	}
+
+	encoded := make([]string, 0, len(params))
+	for _, p := range params {
+		split := strings.SplitN(p, "=", 2)
+		if len(split) == 1 {
+			encoded = append(encoded, url.QueryEscape(split[0]))
+			continue
+		}
+		encoded = append(encoded, url.QueryEscape(split[0])+"="+url.QueryEscape(split[1]))
+	}
+
+	fragment := ""
+	if i := strings.Index(rawURL, "#"); i >= 0 {
+		rawURL, fragment = rawURL[:i], rawURL[i:]
+	}
+	separator := "?"
+	switch {
+	case strings.HasSuffix(rawURL, "?") || strings.HasSuffix(rawURL, "&"):
+		separator = ""
+	case strings.Contains(rawURL, "?"):
+		separator = "&"
+	}
+	return rawURL + separator + strings.Join(encoded, "&") + fragment
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// warmUp sends each of targets count times before the run, up to concurrency
+// at once, without reporting, publishing or recording them. The requests of
+// the run then find connections in the pool, TLS sessions to resume and the
+// caches along the way filled, so their statistics reflect the steady state.
+// It returns how many of the warm-up requests failed.
+func (r *runner) warmUp(targets []request, count, concurrency int) int {
+	work := make(chan request)
+	go func() {
+		defer close(work)
+		for _, target := range targets {
+			for i := 0; i < count; i++ {
+				work <- target
+			}
+		}
+	}()
+
+	var mu sync.Mutex
+	failed := 0
+	var workers sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for target := range work {
+				if err := r.warmUpOnce(target); err != nil {
+					mu.Lock()
+					failed++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	workers.Wait()
+	return failed
+}
+
+func (r *runner) warmUpOnce(target request) error {
+	if r.expandEnv {
+		var err error
+		target, err = expandRequest(target)
+		if err != nil {
+			return err
+		}
+	}
+	client := r.client
+	if target.client != nil {
+		client = target.client
+	}
+	_, tracedRequest, err := r.newTrace(client, target)
+	if err != nil {
+		return err
+	}
+	tracedRequest.SetMaxBodyCapture(0)
+	tracedRequest.SetWireWriter(nil)
+	tracedRequest.SetEventHandler(nil)
+	return tracedRequest.Execute()
+}
+
+// describeWarmUp writes how many warm-up requests were sent before the run.
+func describeWarmUp(sent, failed int) {
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "Warmed up with %d requests, %d of which failed\n", sent, failed)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Warmed up with %d requests\n", sent)
+}
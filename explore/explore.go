@@ -0,0 +1,362 @@
+// Package explore is an interactive pager for JSON response bodies, to expand,
+// collapse and search their values.
+package explore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// DefaultPageSize is the number of lines of the body shown at a time.
+const DefaultPageSize = 30
+
+const clearScreen = "\x1b[H\x1b[2J"
+
+// node is a value in a JSON document. Objects and arrays have children, which
+// are only shown when the node is expanded.
+type node struct {
+	Key      string // Quoted key within an object, empty for array elements and the root
+	Value    string // Scalar value as it appeared in the document
+	Open     string // "{" or "[" for objects and arrays
+	Children []*node
+	Expanded bool
+	parent   *node
+}
+
+func (n *node) container() bool {
+	return n.Open != ""
+}
+
+func (n *node) close() string {
+	if n.Open == "{" {
+		return "}"
+	}
+	return "]"
+}
+
+// parse reads a JSON document into a tree, keeping the order of object keys.
+// The top level is expanded and everything below it collapsed.
+func parse(body []byte) (*node, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	root, err := parseValue(dec, "", nil)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing JSON body: %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("error parsing JSON body: unexpected data after the document")
+	}
+
+	root.Expanded = true
+	return root, nil
+}
+
+func parseValue(dec *json.Decoder, key string, parent *node) (*node, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	n := &node{Key: key, parent: parent}
+	switch v := tok.(type) {
+	case json.Delim:
+		n.Open = v.String()
+		for dec.More() {
+			childKey := ""
+			if n.Open == "{" {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				childKey = strconv.Quote(keyTok.(string))
+			}
+			child, err := parseValue(dec, childKey, n)
+			if err != nil {
+				return nil, err
+			}
+			n.Children = append(n.Children, child)
+		}
+		// The closing delimiter
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+	case string:
+		n.Value = strconv.Quote(v)
+	case json.Number:
+		n.Value = v.String()
+	case bool:
+		n.Value = strconv.FormatBool(v)
+	case nil:
+		n.Value = "null"
+	}
+	return n, nil
+}
+
+// line is a line of the rendered tree. Containers can be toggled by their
+// number.
+type line struct {
+	Text   string
+	Number int
+	Node   *node
+	Match  bool
+}
+
+// render lays out the visible part of the tree, numbering the containers.
+func render(root *node, search string) []line {
+	lines := []line{}
+	number := 0
+
+	var walk func(n *node, depth int, last bool)
+	walk = func(n *node, depth int, last bool) {
+		indent := strings.Repeat("  ", depth)
+		key := ""
+		if n.Key != "" {
+			key = n.Key + ": "
+		}
+		comma := ","
+		if last {
+			comma = ""
+		}
+
+		if !n.container() {
+			lines = append(lines, line{Text: indent + key + n.Value + comma, Node: n, Match: matches(n, search)})
+			return
+		}
+
+		number++
+		l := line{Number: number, Node: n, Match: matches(n, search)}
+		if !n.Expanded || len(n.Children) == 0 {
+			l.Text = fmt.Sprintf("%s%s%s … %s%s (%d)", indent, key, n.Open, n.close(), comma, len(n.Children))
+			if len(n.Children) == 0 {
+				l.Text = indent + key + n.Open + n.close() + comma
+			}
+			lines = append(lines, l)
+			return
+		}
+
+		l.Text = indent + key + n.Open
+		lines = append(lines, l)
+		for i, child := range n.Children {
+			walk(child, depth+1, i == len(n.Children)-1)
+		}
+		lines = append(lines, line{Text: indent + n.close() + comma, Node: n})
+	}
+	walk(root, 0, true)
+
+	return lines
+}
+
+func matches(n *node, search string) bool {
+	if search == "" {
+		return false
+	}
+	search = strings.ToLower(search)
+	return strings.Contains(strings.ToLower(n.Key), search) || strings.Contains(strings.ToLower(n.Value), search)
+}
+
+// setExpanded expands or collapses n and everything below it.
+func setExpanded(n *node, expanded bool) {
+	n.Expanded = expanded
+	for _, child := range n.Children {
+		setExpanded(child, expanded)
+	}
+}
+
+// reveal expands the containers of every node matching search, so the matches
+// are visible, and returns how many there are.
+func reveal(n *node, search string) int {
+	count := 0
+	if matches(n, search) {
+		count++
+		for p := n.parent; p != nil; p = p.parent {
+			p.Expanded = true
+		}
+	}
+	for _, child := range n.Children {
+		count += reveal(child, search)
+	}
+	return count
+}
+
+// Explorer is a pager for a JSON response body, with a summary of the trace
+// kept at the top of every page. It reads commands a line at a time, so it
+// works in any terminal.
+type Explorer struct {
+	Summary  string
+	PageSize int
+	Clear    bool // Clear the screen before drawing each page
+
+	root   *node
+	search string
+	top    int
+	status string
+}
+
+// New creates an Explorer for a JSON body, or returns an error if the body
+// is not JSON.
+func New(body []byte, summary string) (*Explorer, error) {
+	root, err := parse(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Explorer{
+		Summary:  summary,
+		PageSize: DefaultPageSize,
+		root:     root,
+	}, nil
+}
+
+const help = "<number> toggle, e/c <number> expand/collapse all below, E/C everything, /text search, n next match, j/k page, g top, q quit"
+
+// Run shows pages and applies commands read from in until it is told to quit
+// or in ends.
+func (e *Explorer) Run(in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	for {
+		err := e.draw(out)
+		if err != nil {
+			return err
+		}
+		if !scanner.Scan() {
+			return scanner.Err()
+		}
+		if !e.Command(scanner.Text()) {
+			return nil
+		}
+	}
+}
+
+// Command applies a single command and reports whether to keep exploring.
+func (e *Explorer) Command(cmd string) bool {
+	cmd = strings.TrimSpace(cmd)
+	e.status = ""
+	lines := render(e.root, e.search)
+
+	switch {
+	case cmd == "q":
+		return false
+	case cmd == "h":
+		e.status = help
+	case cmd == "" || cmd == "j":
+		if e.top+e.PageSize < len(lines) {
+			e.top += e.PageSize
+		}
+	case cmd == "k":
+		e.top -= e.PageSize
+	case cmd == "g":
+		e.top = 0
+	case cmd == "E":
+		setExpanded(e.root, true)
+	case cmd == "C":
+		setExpanded(e.root, false)
+		e.root.Expanded = true
+		e.top = 0
+	case strings.HasPrefix(cmd, "/"):
+		e.search = cmd[1:]
+		if e.search == "" {
+			break
+		}
+		count := reveal(e.root, e.search)
+		e.status = fmt.Sprintf("%d matches for %q", count, e.search)
+		e.top = -1
+		e.nextMatch()
+	case cmd == "n":
+		e.nextMatch()
+	default:
+		all := false
+		expand := false
+		if strings.HasPrefix(cmd, "e ") || strings.HasPrefix(cmd, "c ") {
+			all, expand = true, cmd[0] == 'e'
+			cmd = strings.TrimSpace(cmd[2:])
+		}
+		number, err := strconv.Atoi(cmd)
+		if err != nil {
+			e.status = "unknown command " + strconv.Quote(cmd) + ": " + help
+			break
+		}
+		n := containerNumbered(lines, number)
+		if n == nil {
+			e.status = fmt.Sprintf("no object or array numbered %d", number)
+			break
+		}
+		if all {
+			setExpanded(n, expand)
+		} else {
+			n.Expanded = !n.Expanded
+		}
+	}
+
+	if e.top < 0 {
+		e.top = 0
+	}
+	return true
+}
+
+// nextMatch moves the page to start at the next match after the top line.
+func (e *Explorer) nextMatch() {
+	lines := render(e.root, e.search)
+	for i := e.top + 1; i < len(lines); i++ {
+		if lines[i].Match {
+			e.top = i
+			return
+		}
+	}
+	if e.status == "" {
+		e.status = "no more matches"
+	}
+	if e.top < 0 {
+		e.top = 0
+	}
+}
+
+func containerNumbered(lines []line, number int) *node {
+	for _, l := range lines {
+		if l.Number == number {
+			return l.Node
+		}
+	}
+	return nil
+}
+
+// draw writes the summary and the current page of the body.
+func (e *Explorer) draw(out io.Writer) error {
+	b := &bytes.Buffer{}
+	if e.Clear {
+		b.WriteString(clearScreen)
+	}
+	b.WriteString(strings.TrimRight(e.Summary, "\n") + "\n")
+	b.WriteString(strings.Repeat("─", 40) + "\n")
+
+	lines := render(e.root, e.search)
+	end := e.top + e.PageSize
+	if end > len(lines) {
+		end = len(lines)
+	}
+	for _, l := range lines[e.top:end] {
+		marker := " "
+		if l.Match {
+			marker = "*"
+		}
+		number := ""
+		if l.Number > 0 {
+			number = strconv.Itoa(l.Number)
+		}
+		fmt.Fprintf(b, "%s%4s  %s\n", marker, number, l.Text)
+	}
+
+	fmt.Fprintf(b, "lines %d-%d of %d", e.top+1, end, len(lines))
+	if e.status != "" {
+		fmt.Fprintf(b, " | %s", e.status)
+	}
+	fmt.Fprintf(b, "\n(h for help) > ")
+
+	_, err := out.Write(b.Bytes())
+	return err
+}
@@ -0,0 +1,96 @@
+package explore
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const testBody = `{"id": 7, "name": "thing", "tags": ["a", "b"], "owner": {"name": "someone", "teams": []}}`
+
+type testExplorer struct {
+	commands []string
+	expected []string
+}
+
+func TestExplorer(t *testing.T) {
+	tests := map[string]testExplorer{
+		"will show the top level with everything below collapsed": {
+			commands: nil,
+			expected: []string{
+				"    1  {",
+				`       "id": 7,`,
+				`    2    "tags": [ … ], (2)`,
+				`    3    "owner": { … } (2)`,
+				"       }",
+			},
+		},
+		"can expand an object by its number": {
+			commands: []string{"3"},
+			expected: []string{
+				`    3    "owner": {`,
+				`           "name": "someone",`,
+				`    4      "teams": []`,
+			},
+		},
+		"can collapse everything again": {
+			commands: []string{"E", "C"},
+			expected: []string{
+				`    2    "tags": [ … ], (2)`,
+			},
+		},
+		"will expand and mark matches when searching": {
+			commands: []string{"/someone"},
+			expected: []string{
+				`*          "name": "someone",`,
+				"1 matches for \"someone\"",
+			},
+		},
+		"will explain unknown commands": {
+			commands: []string{"x"},
+			expected: []string{
+				`unknown command "x"`,
+			},
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			e, err := New([]byte(testBody), "200 OK  total 12.00ms")
+			if err != nil {
+				t.Fatalf("Error creating explorer: %v", err)
+			}
+
+			in := strings.NewReader(strings.Join(append(cfg.commands, "q"), "\n") + "\n")
+			out := &bytes.Buffer{}
+			err = e.Run(in, out)
+			if err != nil {
+				t.Fatalf("Error running explorer: %v", err)
+			}
+
+			pages := strings.Split(out.String(), "(h for help) > ")
+			last := pages[len(pages)-2]
+			if !strings.HasPrefix(last, "200 OK  total 12.00ms\n") {
+				t.Errorf("Expected the summary at the top of the page: got\n%v", last)
+			}
+			for _, e := range cfg.expected {
+				if !strings.Contains(last, e) {
+					t.Errorf("Page incorrect: got\n%v\nwant it to contain\n%v", last, e)
+				}
+			}
+		})
+	}
+}
+
+func TestExplorerNotJSON(t *testing.T) {
+	_, err := New([]byte("<html></html>"), "")
+	if err == nil {
+		t.Errorf("Expected an error for a body which is not JSON")
+	}
+
+	_, err = New([]byte(`{"a": 1} trailing`), "")
+	if err == nil {
+		t.Errorf("Expected an error for data after the document")
+	}
+}
@@ -0,0 +1,417 @@
+// Package expr parses and evaluates the arithmetic expressions of derived
+// metrics, such as "backend_time = response_delay - rtt", and assertions on
+// them, such as "total < 500ms".
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Expr is a parsed arithmetic expression over named values. Durations are
+// represented in seconds.
+type Expr interface {
+	Eval(vars map[string]float64) (float64, error)
+	String() string
+}
+
+// Definition names the result of an expression, such as
+// "backend_time = response_delay - rtt".
+type Definition struct {
+	Name string
+	Expr Expr
+}
+
+// ParseDefinition parses a "name = expression" definition.
+func ParseDefinition(s string) (*Definition, error) {
+	i := strings.Index(s, "=")
+	if i < 0 {
+		return nil, fmt.Errorf("invalid definition %q, expected name = expression", s)
+	}
+
+	name := strings.TrimSpace(s[:i])
+	if !isIdent(name) {
+		return nil, fmt.Errorf("invalid name %q in definition %q", name, s)
+	}
+
+	e, err := Parse(s[i+1:])
+	if err != nil {
+		return nil, err
+	}
+
+	return &Definition{Name: name, Expr: e}, nil
+}
+
+// Comparisons an Assertion can make between its two expressions.
+var comparisons = []string{"<=", ">=", "==", "!=", "<", ">"}
+
+// Assertion compares the values of two expressions, such as
+// "tls < connect * 3".
+type Assertion struct {
+	Text  string // As it was given
+	Left  Expr
+	Op    string // One of < <= > >= == !=
+	Right Expr
+}
+
+// ParseAssertion parses an assertion comparing two expressions with one of
+// the operators < <= > >= == !=.
+func ParseAssertion(s string) (*Assertion, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+
+	text := strings.TrimSpace(s)
+	p := &parser{tokens: tokens}
+	left, err := p.parseSum()
+	if err != nil {
+		return nil, fmt.Errorf("invalid assertion %q: %w", text, err)
+	}
+	t := p.peek()
+	if t == nil || !isComparison(t.text) {
+		return nil, fmt.Errorf("invalid assertion %q, expected two expressions compared with one of %s", text, strings.Join(comparisons, " "))
+	}
+	p.pos++
+	right, err := p.parseSum()
+	if err != nil {
+		return nil, fmt.Errorf("invalid assertion %q: %w", text, err)
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("invalid assertion %q: unexpected %q", text, p.tokens[p.pos].text)
+	}
+
+	return &Assertion{Text: text, Left: left, Op: t.text, Right: right}, nil
+}
+
+// Check evaluates both sides of the assertion, returning whether it holds
+// along with their values.
+func (a *Assertion) Check(vars map[string]float64) (bool, float64, float64, error) {
+	left, err := a.Left.Eval(vars)
+	if err != nil {
+		return false, 0, 0, err
+	}
+	right, err := a.Right.Eval(vars)
+	if err != nil {
+		return false, 0, 0, err
+	}
+
+	switch a.Op {
+	case "<":
+		return left < right, left, right, nil
+	case "<=":
+		return left <= right, left, right, nil
+	case ">":
+		return left > right, left, right, nil
+	case ">=":
+		return left >= right, left, right, nil
+	case "==":
+		return left == right, left, right, nil
+	case "!=":
+		return left != right, left, right, nil
+	}
+	return false, left, right, fmt.Errorf("unknown comparison %q", a.Op)
+}
+
+func isComparison(s string) bool {
+	for _, c := range comparisons {
+		if s == c {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse parses an expression made of numbers, durations (such as 50ms),
+// variable names, parentheses and the operators + - * /.
+func Parse(s string) (Expr, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	e, err := p.parseSum()
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", strings.TrimSpace(s), err)
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("invalid expression %q: unexpected %q", strings.TrimSpace(s), p.tokens[p.pos].text)
+	}
+
+	return e, nil
+}
+
+type tokenKind int
+
+const (
+	tokenNumber tokenKind = iota
+	tokenIdent
+	tokenOperator
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value float64
+}
+
+func tokenize(s string) ([]token, error) {
+	tokens := []token{}
+	runes := []rune(s)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case strings.ContainsRune("+-*/()", r):
+			tokens = append(tokens, token{kind: tokenOperator, text: string(r)})
+			i++
+		case r == '−':
+			tokens = append(tokens, token{kind: tokenOperator, text: "-"})
+			i++
+		case strings.ContainsRune("<>=!", r):
+			op := string(r)
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				op += "="
+			}
+			if !isComparison(op) {
+				return nil, fmt.Errorf("unexpected character %q", r)
+			}
+			tokens = append(tokens, token{kind: tokenOperator, text: op})
+			i += len(op)
+		case unicode.IsDigit(r) || r == '.':
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			unitStart := i
+			for i < len(runes) && unicode.IsLetter(runes[i]) {
+				i++
+			}
+
+			text := string(runes[start:i])
+			var value float64
+			if unitStart == i {
+				n, err := strconv.ParseFloat(text, 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid number %q", text)
+				}
+				value = n
+			} else {
+				d, err := time.ParseDuration(text)
+				if err != nil {
+					return nil, fmt.Errorf("invalid duration %q", text)
+				}
+				value = d.Seconds()
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: text, value: value})
+		case isIdentRune(r, true):
+			start := i
+			for i < len(runes) && isIdentRune(runes[i], false) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: string(runes[start:i])})
+		default:
+			return nil, fmt.Errorf("unexpected character %q", r)
+		}
+	}
+
+	return tokens, nil
+}
+
+func isIdentRune(r rune, first bool) bool {
+	if r == '_' || unicode.IsLetter(r) {
+		return true
+	}
+	return !first && (unicode.IsDigit(r) || r == '.')
+}
+
+func isIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		if !isIdentRune(r, i == 0) {
+			return false
+		}
+	}
+	return true
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() *token {
+	if p.pos >= len(p.tokens) {
+		return nil
+	}
+	return &p.tokens[p.pos]
+}
+
+func (p *parser) peekOperator(ops string) string {
+	t := p.peek()
+	if t == nil || t.kind != tokenOperator || !strings.Contains(ops, t.text) {
+		return ""
+	}
+	return t.text
+}
+
+func (p *parser) parseSum() (Expr, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+
+	for op := p.peekOperator("+-"); op != ""; op = p.peekOperator("+-") {
+		p.pos++
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{op: op, left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseProduct() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for op := p.peekOperator("*/"); op != ""; op = p.peekOperator("*/") {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{op: op, left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	if p.peekOperator("-") != "" {
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &negate{operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	p.pos++
+
+	switch {
+	case t.kind == tokenNumber:
+		return &number{value: t.value, text: t.text}, nil
+	case t.kind == tokenIdent:
+		return &variable{name: t.text}, nil
+	case t.text == "(":
+		e, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.peekOperator(")") == "" {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return e, nil
+	}
+
+	return nil, fmt.Errorf("unexpected %q", t.text)
+}
+
+type number struct {
+	value float64
+	text  string
+}
+
+func (n *number) Eval(vars map[string]float64) (float64, error) {
+	return n.value, nil
+}
+
+func (n *number) String() string {
+	return n.text
+}
+
+type variable struct {
+	name string
+}
+
+func (v *variable) Eval(vars map[string]float64) (float64, error) {
+	value, ok := vars[v.name]
+	if !ok {
+		return 0, fmt.Errorf("unknown variable %q", v.name)
+	}
+	return value, nil
+}
+
+func (v *variable) String() string {
+	return v.name
+}
+
+type negate struct {
+	operand Expr
+}
+
+func (n *negate) Eval(vars map[string]float64) (float64, error) {
+	value, err := n.operand.Eval(vars)
+	return -value, err
+}
+
+func (n *negate) String() string {
+	return "-" + n.operand.String()
+}
+
+type binary struct {
+	op          string
+	left, right Expr
+}
+
+func (b *binary) Eval(vars map[string]float64) (float64, error) {
+	left, err := b.left.Eval(vars)
+	if err != nil {
+		return 0, err
+	}
+	right, err := b.right.Eval(vars)
+	if err != nil {
+		return 0, err
+	}
+
+	switch b.op {
+	case "+":
+		return left + right, nil
+	case "-":
+		return left - right, nil
+	case "*":
+		return left * right, nil
+	case "/":
+		if right == 0 {
+			return 0, fmt.Errorf("division by zero in %s", b)
+		}
+		return left / right, nil
+	}
+
+	return 0, fmt.Errorf("unknown operator %q", b.op)
+}
+
+func (b *binary) String() string {
+	return "(" + b.left.String() + " " + b.op + " " + b.right.String() + ")"
+}
@@ -0,0 +1,191 @@
+package expr
+
+import (
+	"strings"
+	"testing"
+)
+
+type testExpr struct {
+	expression    string
+	expected      float64
+	expectedError string
+}
+
+func TestExpr(t *testing.T) {
+	vars := map[string]float64{
+		"total":          0.5,
+		"response_delay": 0.3,
+		"rtt":            0.02,
+		"timing.tls":     0.04,
+	}
+
+	tests := map[string]testExpr{
+		"will subtract variables": {
+			expression: "response_delay - rtt",
+			expected:   0.28,
+		},
+		"will accept a unicode minus sign": {
+			expression: "total − response_delay",
+			expected:   0.2,
+		},
+		"will respect operator precedence": {
+			expression: "total - rtt * 2",
+			expected:   0.46,
+		},
+		"will respect parentheses": {
+			expression: "(total - rtt) * 2",
+			expected:   0.96,
+		},
+		"will parse durations as seconds": {
+			expression: "total - 250ms",
+			expected:   0.25,
+		},
+		"will negate values": {
+			expression: "-rtt + 1",
+			expected:   0.98,
+		},
+		"will accept dotted variable names": {
+			expression: "timing.tls / 2",
+			expected:   0.02,
+		},
+		"will fail on unknown variables": {
+			expression:    "backend - rtt",
+			expectedError: `unknown variable "backend"`,
+		},
+		"will fail on division by zero": {
+			expression:    "total / (rtt - rtt)",
+			expectedError: "division by zero",
+		},
+		"will fail on unbalanced parentheses": {
+			expression:    "(total - rtt",
+			expectedError: "missing closing parenthesis",
+		},
+		"will fail on trailing operators": {
+			expression:    "total -",
+			expectedError: "unexpected end of expression",
+		},
+		"will fail on invalid durations": {
+			expression:    "total - 5parsecs",
+			expectedError: `invalid duration "5parsecs"`,
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			e, err := Parse(cfg.expression)
+			var value float64
+			if err == nil {
+				value, err = e.Eval(vars)
+			}
+
+			if cfg.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), cfg.expectedError) {
+					t.Errorf("Unexpected error: got %v, want %v", err, cfg.expectedError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if diff := value - cfg.expected; diff > 1e-9 || diff < -1e-9 {
+				t.Errorf("Unexpected value: got %v, want %v", value, cfg.expected)
+			}
+		})
+	}
+}
+
+func TestParseDefinition(t *testing.T) {
+	d, err := ParseDefinition("backend_time = response_delay - rtt")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if d.Name != "backend_time" {
+		t.Errorf("Unexpected name: got %v, want backend_time", d.Name)
+	}
+
+	_, err = ParseDefinition("response_delay - rtt")
+	if err == nil {
+		t.Errorf("Expected an error for a definition without a name")
+	}
+
+	_, err = ParseDefinition("backend time = response_delay")
+	if err == nil {
+		t.Errorf("Expected an error for an invalid name")
+	}
+}
+
+type testAssertion struct {
+	assertion     string
+	expected      bool
+	expectedError string
+}
+
+func TestAssertion(t *testing.T) {
+	vars := map[string]float64{
+		"timing.tls":        0.04,
+		"timing.connect":    0.02,
+		"timing.ttfb":       0.12,
+		"server_timing.app": 0.09,
+	}
+
+	tests := map[string]testAssertion{
+		"will compare expressions": {
+			assertion: "timing.tls < timing.connect * 3",
+			expected:  true,
+		},
+		"will compare with durations": {
+			assertion: "timing.ttfb - server_timing.app < 20ms",
+			expected:  false,
+		},
+		"will compare with two character operators": {
+			assertion: "timing.tls >= timing.connect * 2",
+			expected:  true,
+		},
+		"will compare for inequality": {
+			assertion: "timing.tls != timing.connect",
+			expected:  true,
+		},
+		"will fail without a comparison": {
+			assertion:     "timing.tls - timing.connect",
+			expectedError: "expected two expressions compared",
+		},
+		"will fail on a single equals sign": {
+			assertion:     "timing.tls = timing.connect",
+			expectedError: `unexpected character '='`,
+		},
+		"will fail on a second comparison": {
+			assertion:     "timing.connect < timing.tls < timing.ttfb",
+			expectedError: `unexpected "<"`,
+		},
+		"will fail on unknown variables": {
+			assertion:     "server_timing.db < 10ms",
+			expectedError: `unknown variable "server_timing.db"`,
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			a, err := ParseAssertion(cfg.assertion)
+			var passed bool
+			if err == nil {
+				passed, _, _, err = a.Check(vars)
+			}
+
+			if cfg.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), cfg.expectedError) {
+					t.Errorf("Unexpected error: got %v, want %v", err, cfg.expectedError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if passed != cfg.expected {
+				t.Errorf("Unexpected outcome: got %v, want %v", passed, cfg.expected)
+			}
+		})
+	}
+}
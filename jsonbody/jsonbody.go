@@ -0,0 +1,107 @@
+// Package jsonbody builds JSON request bodies from assignments of fields,
+// such as user.name=bob or tags:=["a","b"].
+package jsonbody
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Apply sets fields in the JSON object base, which may be empty, and returns
+// the resulting JSON. Each assignment is "path=value" to set a string, or
+// "path:=value" to set raw JSON such as a number, boolean, array or object.
+// A path of dot separated keys sets a field in a nested object, creating it
+// if needed; a literal dot in a key is escaped as "\.".
+func Apply(base string, assignments []string) (string, error) {
+	body := map[string]interface{}{}
+	if strings.TrimSpace(base) != "" {
+		err := json.Unmarshal([]byte(base), &body)
+		if err != nil {
+			return "", fmt.Errorf("error parsing request body as a JSON object: %w", err)
+		}
+	}
+
+	for _, a := range assignments {
+		path, value, err := parseAssignment(a)
+		if err != nil {
+			return "", err
+		}
+
+		err = set(body, path, value)
+		if err != nil {
+			return "", fmt.Errorf("error setting %q: %w", a, err)
+		}
+	}
+
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return "", fmt.Errorf("error encoding JSON body: %w", err)
+	}
+	return string(raw), nil
+}
+
+// parseAssignment splits an assignment into its path and value.
+func parseAssignment(a string) ([]string, interface{}, error) {
+	i := strings.Index(a, "=")
+	if i < 0 {
+		return nil, nil, fmt.Errorf("invalid JSON field %q, expected path=value or path:=json", a)
+	}
+
+	rawPath, rawValue := a[:i], a[i+1:]
+	var value interface{} = rawValue
+	if strings.HasSuffix(rawPath, ":") {
+		rawPath = strings.TrimSuffix(rawPath, ":")
+		err := json.Unmarshal([]byte(rawValue), &value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid JSON value in %q: %w", a, err)
+		}
+	}
+
+	path := splitPath(rawPath)
+	for _, key := range path {
+		if key == "" {
+			return nil, nil, fmt.Errorf("invalid JSON field %q, the path has an empty key", a)
+		}
+	}
+
+	return path, value, nil
+}
+
+// splitPath splits a path on dots which are not escaped with a backslash.
+func splitPath(path string) []string {
+	keys := []string{}
+	key := &strings.Builder{}
+	for i := 0; i < len(path); i++ {
+		switch {
+		case path[i] == '\\' && i+1 < len(path) && path[i+1] == '.':
+			key.WriteByte('.')
+			i++
+		case path[i] == '.':
+			keys = append(keys, key.String())
+			key.Reset()
+		default:
+			key.WriteByte(path[i])
+		}
+	}
+	return append(keys, key.String())
+}
+
+func set(object map[string]interface{}, path []string, value interface{}) error {
+	for i, key := range path[:len(path)-1] {
+		next, ok := object[key]
+		if !ok {
+			next = map[string]interface{}{}
+			object[key] = next
+		}
+
+		nested, ok := next.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s is not an object", strings.Join(path[:i+1], "."))
+		}
+		object = nested
+	}
+
+	object[path[len(path)-1]] = value
+	return nil
+}
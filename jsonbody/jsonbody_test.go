@@ -0,0 +1,80 @@
+package jsonbody
+
+import (
+	"strings"
+	"testing"
+)
+
+type testApply struct {
+	base          string
+	assignments   []string
+	expected      string
+	expectedError string
+}
+
+func TestApply(t *testing.T) {
+	tests := map[string]testApply{
+		"will build an object of strings": {
+			assignments: []string{"name=thing", "colour=blue"},
+			expected:    `{"colour":"blue","name":"thing"}`,
+		},
+		"will set raw JSON values": {
+			assignments: []string{"count:=5", "enabled:=true", `tags:=["a","b"]`, "quoted=5"},
+			expected:    `{"count":5,"enabled":true,"quoted":"5","tags":["a","b"]}`,
+		},
+		"will create nested objects": {
+			assignments: []string{"user.name=thing", "user.address.city=Sydney"},
+			expected:    `{"user":{"address":{"city":"Sydney"},"name":"thing"}}`,
+		},
+		"will patch an existing body": {
+			base:        `{"user": {"name": "old", "id": 1}, "keep": true}`,
+			assignments: []string{"user.name=new"},
+			expected:    `{"keep":true,"user":{"id":1,"name":"new"}}`,
+		},
+		"will accept escaped dots in keys": {
+			assignments: []string{`labels.app\.kubernetes\.io/name=web`},
+			expected:    `{"labels":{"app.kubernetes.io/name":"web"}}`,
+		},
+		"will allow equals signs in values": {
+			assignments: []string{"query=a=b"},
+			expected:    `{"query":"a=b"}`,
+		},
+		"will fail on a body which is not an object": {
+			base:          `[1, 2]`,
+			assignments:   []string{"a=b"},
+			expectedError: "error parsing request body",
+		},
+		"will fail on invalid raw JSON": {
+			assignments:   []string{"count:=five"},
+			expectedError: `invalid JSON value in "count:=five"`,
+		},
+		"will fail on setting a field in a non-object": {
+			assignments:   []string{"user=thing", "user.name=thing"},
+			expectedError: "user is not an object",
+		},
+		"will fail without a value": {
+			assignments:   []string{"user"},
+			expectedError: "expected path=value",
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			got, err := Apply(cfg.base, cfg.assignments)
+			if cfg.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), cfg.expectedError) {
+					t.Errorf("Unexpected error: got %v, want %v", err, cfg.expectedError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if got != cfg.expected {
+				t.Errorf("Unexpected body: got %v, want %v", got, cfg.expected)
+			}
+		})
+	}
+}
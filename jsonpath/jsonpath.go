@@ -0,0 +1,139 @@
+// Package jsonpath selects a single value of a JSON document with the subset
+// of JSONPath made of member names and array indexes, such as
+// $.data.items[0].id, as used to capture values from responses and to assert
+// on them.
+package jsonpath
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Path is a parsed JSONPath.
+type Path struct {
+	text     string
+	elements []element
+}
+
+// element is a member name, or an array index if key is nil.
+type element struct {
+	key   *string
+	index int
+}
+
+// Parse parses $ followed by .name, ['name'] and [index] elements.
+func Parse(path string) (*Path, error) {
+	invalid := func() error {
+		return fmt.Errorf("invalid JSONPath %q, expected a path such as $.data.items[0].id", path)
+	}
+	if !strings.HasPrefix(path, "$") {
+		return nil, invalid()
+	}
+
+	p := &Path{text: path, elements: []element{}}
+	rest := path[1:]
+	for rest != "" {
+		switch {
+		case rest[0] == '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			key := rest[1 : end+1]
+			if key == "" {
+				return nil, invalid()
+			}
+			p.elements = append(p.elements, element{key: &key})
+			rest = rest[end+1:]
+		case strings.HasPrefix(rest, "['") || strings.HasPrefix(rest, `["`):
+			end := strings.Index(rest[2:], rest[1:2]+"]")
+			if end < 0 {
+				return nil, invalid()
+			}
+			key := rest[2 : end+2]
+			p.elements = append(p.elements, element{key: &key})
+			rest = rest[end+4:]
+		case rest[0] == '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, invalid()
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, invalid()
+			}
+			p.elements = append(p.elements, element{index: index})
+			rest = rest[end+1:]
+		default:
+			return nil, invalid()
+		}
+	}
+	return p, nil
+}
+
+// String returns the path as it was given.
+func (p *Path) String() string {
+	return p.text
+}
+
+// Decode decodes a JSON document, keeping its numbers as json.Number so they
+// aren't rounded.
+func Decode(body []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var value interface{}
+	err := dec.Decode(&value)
+	if err != nil {
+		return nil, fmt.Errorf("body is not JSON: %v", err)
+	}
+	return value, nil
+}
+
+// Lookup returns the value at the path in a document returned by Decode.
+func (p *Path) Lookup(doc interface{}) (interface{}, error) {
+	value := doc
+	at := "$"
+	for _, e := range p.elements {
+		if e.key != nil {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s is not an object", at)
+			}
+			value, ok = object[*e.key]
+			if !ok {
+				return nil, fmt.Errorf("%s has no member %q", at, *e.key)
+			}
+			at += "." + *e.key
+			continue
+		}
+		array, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s is not an array", at)
+		}
+		if e.index >= len(array) {
+			return nil, fmt.Errorf("%s has %d items, not %d", at, len(array), e.index+1)
+		}
+		value = array[e.index]
+		at += fmt.Sprintf("[%d]", e.index)
+	}
+	return value, nil
+}
+
+// Format returns a value as text: strings without their quotes, and other
+// values as JSON.
+func Format(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
@@ -0,0 +1,108 @@
+package jsonpath
+
+import (
+	"strings"
+	"testing"
+)
+
+type testLookup struct {
+	path          string
+	expected      string
+	expectedError string
+}
+
+func TestLookup(t *testing.T) {
+	doc, err := Decode([]byte(`{"status": "ok", "count": 12345678901234567890, "data": {"items": [{"id": "a"}, {"id": "b", "tags": ["x"]}]}, "a.b": true, "empty": null}`))
+	if err != nil {
+		t.Fatalf("Error decoding document: %v", err)
+	}
+
+	tests := map[string]testLookup{
+		"will select the document": {
+			path:     "$",
+			expected: `{"a.b":true,"count":12345678901234567890,"data":{"items":[{"id":"a"},{"id":"b","tags":["x"]}]},"empty":null,"status":"ok"}`,
+		},
+		"will select a string without its quotes": {
+			path:     "$.status",
+			expected: "ok",
+		},
+		"will keep large numbers as they were": {
+			path:     "$.count",
+			expected: "12345678901234567890",
+		},
+		"will select array items": {
+			path:     "$.data.items[1].tags[0]",
+			expected: "x",
+		},
+		"will select a bracketed member": {
+			path:     `$['a.b']`,
+			expected: "true",
+		},
+		"will select null": {
+			path:     `$["empty"]`,
+			expected: "null",
+		},
+		"will fail on a missing member": {
+			path:          "$.data.total",
+			expectedError: `$.data has no member "total"`,
+		},
+		"will fail on an index out of range": {
+			path:          "$.data.items[2]",
+			expectedError: "$.data.items has 2 items, not 3",
+		},
+		"will fail on a member of an array": {
+			path:          "$.data.items.id",
+			expectedError: "$.data.items is not an object",
+		},
+		"will fail on an index of an object": {
+			path:          "$.data[0]",
+			expectedError: "$.data is not an array",
+		},
+		"will fail without $": {
+			path:          "status",
+			expectedError: `invalid JSONPath "status"`,
+		},
+		"will fail on an empty member": {
+			path:          "$.data..items",
+			expectedError: "invalid JSONPath",
+		},
+		"will fail on an unterminated bracket": {
+			path:          "$['data",
+			expectedError: "invalid JSONPath",
+		},
+		"will fail on a wildcard": {
+			path:          "$.data.items[*]",
+			expectedError: "invalid JSONPath",
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			path, err := Parse(cfg.path)
+			var value interface{}
+			if err == nil {
+				value, err = path.Lookup(doc)
+			}
+			if cfg.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), cfg.expectedError) {
+					t.Fatalf("Unexpected error: got %v, want it to contain %q", err, cfg.expectedError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Error looking up %s: %v", cfg.path, err)
+			}
+			if got := Format(value); got != cfg.expected {
+				t.Errorf("Unexpected value: got %s, want %s", got, cfg.expected)
+			}
+		})
+	}
+}
+
+func TestDecodeNotJSON(t *testing.T) {
+	_, err := Decode([]byte("<html>"))
+	if err == nil || !strings.Contains(err.Error(), "body is not JSON") {
+		t.Errorf("Unexpected error: got %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+// Package ocsp parses OCSP responses (RFC 6960), such as those stapled to a
+// TLS handshake, and creates the requests to check a certificate with its
+// OCSP responder. Signatures are not verified.
+package ocsp
+
+import (
+	"crypto"
+	_ "crypto/sha1" // For the hashes of the certificate ID
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// Statuses of a certificate in a Response.
+const (
+	Good    = "good"
+	Revoked = "revoked"
+	Unknown = "unknown"
+)
+
+// Response is the status of a certificate given by an OCSP responder.
+type Response struct {
+	Status       string // One of the status constants
+	SerialNumber *big.Int
+	ProducedAt   time.Time
+	ThisUpdate   time.Time // When the status was known to be correct
+	NextUpdate   time.Time // When a newer status will be available, zero if always
+	RevokedAt    time.Time
+}
+
+var (
+	oidBasicResponse = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+	oidSHA1          = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+)
+
+// responseStatuses are the reasons an OCSP responder gives for not answering.
+var responseStatuses = map[asn1.Enumerated]string{
+	1: "malformed request",
+	2: "internal error",
+	3: "try later",
+	5: "signature required",
+	6: "unauthorized",
+}
+
+type responseASN1 struct {
+	Status   asn1.Enumerated
+	Response responseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type responseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type basicResponse struct {
+	TBSResponseData    responseData
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type responseData struct {
+	Raw            asn1.RawContent
+	Version        int `asn1:"optional,default:0,explicit,tag:0"`
+	RawResponderID asn1.RawValue
+	ProducedAt     time.Time `asn1:"generalized"`
+	Responses      []singleResponse
+}
+
+type singleResponse struct {
+	CertID           certID
+	Good             asn1.Flag        `asn1:"tag:0,optional"`
+	Revoked          revokedInfo      `asn1:"tag:1,optional"`
+	Unknown          asn1.Flag        `asn1:"tag:2,optional"`
+	ThisUpdate       time.Time        `asn1:"generalized"`
+	NextUpdate       time.Time        `asn1:"generalized,explicit,tag:0,optional"`
+	SingleExtensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type certID struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	NameHash      []byte
+	IssuerKeyHash []byte
+	SerialNumber  *big.Int
+}
+
+type revokedInfo struct {
+	RevocationTime time.Time       `asn1:"generalized"`
+	Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional"`
+}
+
+type request struct {
+	TBSRequest tbsRequest
+}
+
+type tbsRequest struct {
+	Version     int `asn1:"explicit,tag:0,default:0,optional"`
+	RequestList []requestEntry
+}
+
+type requestEntry struct {
+	Cert certID
+}
+
+// ParseResponse parses a DER encoded OCSP response with the status of a
+// single certificate.
+func ParseResponse(der []byte) (*Response, error) {
+	var resp responseASN1
+	rest, err := asn1.Unmarshal(der, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing OCSP response: %w", err)
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("error parsing OCSP response: trailing data")
+	}
+	if resp.Status != 0 {
+		reason, ok := responseStatuses[resp.Status]
+		if !ok {
+			reason = fmt.Sprintf("status %d", resp.Status)
+		}
+		return nil, fmt.Errorf("OCSP responder did not answer: %s", reason)
+	}
+	if !resp.Response.ResponseType.Equal(oidBasicResponse) {
+		return nil, fmt.Errorf("unsupported OCSP response type %v", resp.Response.ResponseType)
+	}
+
+	var basic basicResponse
+	_, err = asn1.Unmarshal(resp.Response.Response, &basic)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing OCSP response: %w", err)
+	}
+	if len(basic.TBSResponseData.Responses) != 1 {
+		return nil, fmt.Errorf("OCSP response has the status of %d certificates, expected 1", len(basic.TBSResponseData.Responses))
+	}
+
+	single := basic.TBSResponseData.Responses[0]
+	parsed := &Response{
+		SerialNumber: single.CertID.SerialNumber,
+		ProducedAt:   basic.TBSResponseData.ProducedAt,
+		ThisUpdate:   single.ThisUpdate,
+		NextUpdate:   single.NextUpdate,
+	}
+	switch {
+	case bool(single.Good):
+		parsed.Status = Good
+	case bool(single.Unknown):
+		parsed.Status = Unknown
+	default:
+		parsed.Status = Revoked
+		parsed.RevokedAt = single.Revoked.RevocationTime
+	}
+	return parsed, nil
+}
+
+// CreateRequest returns a DER encoded OCSP request for the status of cert,
+// which was issued by issuer.
+func CreateRequest(cert, issuer *x509.Certificate) ([]byte, error) {
+	var publicKey struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	_, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing issuer public key: %w", err)
+	}
+
+	nameHash := crypto.SHA1.New()
+	nameHash.Write(issuer.RawSubject)
+	keyHash := crypto.SHA1.New()
+	keyHash.Write(publicKey.PublicKey.RightAlign())
+
+	return asn1.Marshal(request{
+		TBSRequest: tbsRequest{
+			RequestList: []requestEntry{{
+				Cert: certID{
+					HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA1, Parameters: asn1.NullRawValue},
+					NameHash:      nameHash.Sum(nil),
+					IssuerKeyHash: keyHash.Sum(nil),
+					SerialNumber:  cert.SerialNumber,
+				},
+			}},
+		},
+	})
+}
@@ -0,0 +1,171 @@
+package ocsp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testResponse struct {
+	single         singleResponse
+	status         asn1.Enumerated
+	expected       *Response
+	expectedError  string
+	responseType   asn1.ObjectIdentifier
+	extraResponses int
+}
+
+func marshalResponse(t *testing.T, cfg testResponse) []byte {
+	responses := []singleResponse{cfg.single}
+	for i := 0; i < cfg.extraResponses; i++ {
+		responses = append(responses, cfg.single)
+	}
+	basic, err := asn1.Marshal(basicResponse{
+		TBSResponseData: responseData{
+			RawResponderID: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 2, IsCompound: true, Bytes: []byte{4, 1, 0}},
+			ProducedAt:     time.Date(2026, 10, 14, 8, 0, 0, 0, time.UTC),
+			Responses:      responses,
+		},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+		Signature:          asn1.BitString{Bytes: []byte{1}, BitLength: 8},
+	})
+	if err != nil {
+		t.Fatalf("Error marshalling basic response: %v", err)
+	}
+
+	resp := responseASN1{Status: cfg.status}
+	if cfg.status == 0 {
+		resp.Response = responseBytes{ResponseType: cfg.responseType, Response: basic}
+	}
+	der, err := asn1.Marshal(resp)
+	if err != nil {
+		t.Fatalf("Error marshalling response: %v", err)
+	}
+	return der
+}
+
+func TestParseResponse(t *testing.T) {
+	thisUpdate := time.Date(2026, 10, 14, 8, 0, 0, 0, time.UTC)
+	nextUpdate := time.Date(2026, 10, 21, 8, 0, 0, 0, time.UTC)
+	revokedAt := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	id := certID{
+		HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA1, Parameters: asn1.NullRawValue},
+		NameHash:      make([]byte, 20),
+		IssuerKeyHash: make([]byte, 20),
+		SerialNumber:  big.NewInt(4242),
+	}
+
+	tests := map[string]testResponse{
+		"will parse a good status": {
+			single:       singleResponse{CertID: id, Good: true, ThisUpdate: thisUpdate, NextUpdate: nextUpdate},
+			responseType: oidBasicResponse,
+			expected:     &Response{Status: Good, SerialNumber: big.NewInt(4242), ProducedAt: thisUpdate, ThisUpdate: thisUpdate, NextUpdate: nextUpdate},
+		},
+		"will parse a revoked status": {
+			single:       singleResponse{CertID: id, Revoked: revokedInfo{RevocationTime: revokedAt}, ThisUpdate: thisUpdate},
+			responseType: oidBasicResponse,
+			expected:     &Response{Status: Revoked, SerialNumber: big.NewInt(4242), ProducedAt: thisUpdate, ThisUpdate: thisUpdate, RevokedAt: revokedAt},
+		},
+		"will parse an unknown status": {
+			single:       singleResponse{CertID: id, Unknown: true, ThisUpdate: thisUpdate, NextUpdate: nextUpdate},
+			responseType: oidBasicResponse,
+			expected:     &Response{Status: Unknown, SerialNumber: big.NewInt(4242), ProducedAt: thisUpdate, ThisUpdate: thisUpdate, NextUpdate: nextUpdate},
+		},
+		"will return the reason a responder did not answer": {
+			single:        singleResponse{CertID: id, Good: true, ThisUpdate: thisUpdate},
+			status:        3,
+			expectedError: "OCSP responder did not answer: try later",
+		},
+		"will reject other response types": {
+			single:        singleResponse{CertID: id, Good: true, ThisUpdate: thisUpdate},
+			responseType:  asn1.ObjectIdentifier{1, 2, 3},
+			expectedError: "unsupported OCSP response type 1.2.3",
+		},
+		"will reject the statuses of several certificates": {
+			single:         singleResponse{CertID: id, Good: true, ThisUpdate: thisUpdate},
+			responseType:   oidBasicResponse,
+			extraResponses: 1,
+			expectedError:  "OCSP response has the status of 2 certificates, expected 1",
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			resp, err := ParseResponse(marshalResponse(t, cfg))
+			if cfg.expectedError != "" {
+				if err == nil || err.Error() != cfg.expectedError {
+					t.Fatalf("Unexpected error: got %v, want %v", err, cfg.expectedError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Error parsing response: %v", err)
+			}
+
+			if resp.Status != cfg.expected.Status || resp.SerialNumber.Cmp(cfg.expected.SerialNumber) != 0 {
+				t.Errorf("Unexpected status: got %v of %v, want %v of %v", resp.Status, resp.SerialNumber, cfg.expected.Status, cfg.expected.SerialNumber)
+			}
+			if !resp.ProducedAt.Equal(cfg.expected.ProducedAt) || !resp.ThisUpdate.Equal(cfg.expected.ThisUpdate) || !resp.NextUpdate.Equal(cfg.expected.NextUpdate) || !resp.RevokedAt.Equal(cfg.expected.RevokedAt) {
+				t.Errorf("Unexpected times: got %+v, want %+v", resp, cfg.expected)
+			}
+		})
+	}
+
+	_, err := ParseResponse([]byte("not der"))
+	if err == nil || !strings.HasPrefix(err.Error(), "error parsing OCSP response") {
+		t.Errorf("Unexpected error parsing invalid data: %v", err)
+	}
+}
+
+func TestCreateRequest(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Thing CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Error creating certificate: %v", err)
+	}
+	issuer, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Error parsing certificate: %v", err)
+	}
+	cert := &x509.Certificate{SerialNumber: big.NewInt(4242)}
+
+	der, err = CreateRequest(cert, issuer)
+	if err != nil {
+		t.Fatalf("Error creating request: %v", err)
+	}
+
+	var req request
+	_, err = asn1.Unmarshal(der, &req)
+	if err != nil {
+		t.Fatalf("Error parsing request: %v", err)
+	}
+	if len(req.TBSRequest.RequestList) != 1 {
+		t.Fatalf("Unexpected number of certificates in request: got %d, want 1", len(req.TBSRequest.RequestList))
+	}
+	id := req.TBSRequest.RequestList[0].Cert
+	if id.SerialNumber.Cmp(big.NewInt(4242)) != 0 {
+		t.Errorf("Unexpected serial number: got %v, want 4242", id.SerialNumber)
+	}
+	if !id.HashAlgorithm.Algorithm.Equal(oidSHA1) || len(id.NameHash) != 20 || len(id.IssuerKeyHash) != 20 {
+		t.Errorf("Unexpected certificate ID: %+v", id)
+	}
+}
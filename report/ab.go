@@ -0,0 +1,106 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/berndhartzer/http-trace/stats"
+)
+
+// significanceLevel is the p-value below which a difference between variants
+// is reported as significant.
+const significanceLevel = 0.05
+
+// Variant holds the results of the requests sent with one value of the header
+// under test in an A/B comparison.
+type Variant struct {
+	Value   string
+	Results []*Result
+}
+
+// timings returns the duration of a phase in seconds for each successful
+// request.
+func (v *Variant) timings(phase string) []float64 {
+	return successfulTimings(v.Results, phase)
+}
+
+func (v *Variant) failures() int {
+	return countFailures(v.Results)
+}
+
+// writeVerdict writes how much slower or faster b was than a in total, and
+// whether the difference is statistically significant.
+func writeVerdict(out *bytes.Buffer, a, b string, totalA, totalB []float64) {
+	if len(totalA) == 0 || len(totalB) == 0 {
+		fmt.Fprintf(out, "Not enough successful requests to compare %s and %s\n", a, b)
+		return
+	}
+
+	_, pValue := stats.MannWhitney(totalA, totalB)
+	diff := stats.Median(totalB) - stats.Median(totalA)
+	change := "slower"
+	if diff < 0 {
+		change = "faster"
+	}
+	relative := ""
+	if median := stats.Median(totalA); median > 0 {
+		relative = fmt.Sprintf(" (%.1f%%)", math.Abs(diff)/median*100)
+	}
+	verdict := "not significant"
+	if pValue < significanceLevel {
+		verdict = "significant"
+	}
+	fmt.Fprintf(out, "%s is %v%s %s than %s in total, p=%.3f (Mann-Whitney U): %s at the %g%% level\n",
+		b, time.Duration(math.Abs(diff)*float64(time.Second)).Round(time.Microsecond), relative, change, a, pValue, verdict, significanceLevel*100)
+}
+
+// successfulTimings returns the duration of a phase in seconds for each of
+// results which did not fail.
+func successfulTimings(results []*Result, phase string) []float64 {
+	values := []float64{}
+	for _, r := range results {
+		if r.Error == "" {
+			values = append(values, r.Timings[phase])
+		}
+	}
+	return values
+}
+
+func countFailures(results []*Result) int {
+	failed := 0
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+		}
+	}
+	return failed
+}
+
+// WriteABComparison writes a comparison of two variants of a request which
+// differ only in the value of header: the median duration of each phase, and
+// whether the difference in total duration is statistically significant.
+func WriteABComparison(w io.Writer, header string, a, b *Variant, pres *Presentation) error {
+	format := pres.timeFormat()
+	// The columns are one wider than the durations, to fit the header values
+	width := format.Width() + 1
+
+	out := &bytes.Buffer{}
+	fmt.Fprintf(out, "A/B %s (median)\n", header)
+	fmt.Fprintf(out, "  %-21s%*s %*s %*s\n", "", width, a.Value, width, b.Value, width, "diff")
+	fmt.Fprintf(out, "  %-21s%*d %*d\n", "requests:", width, len(a.Results), width, len(b.Results))
+	fmt.Fprintf(out, "  %-21s%*d %*d\n", "failed:", width, a.failures(), width, b.failures())
+	for _, p := range phases {
+		medianA := stats.Median(a.timings(p.Name))
+		medianB := stats.Median(b.timings(p.Name))
+		fmt.Fprintf(out, "  %-21s%*s %*s %*s\n", p.Name+":", width, format.seconds(medianA), width, format.seconds(medianB), width, format.signedSeconds(medianB-medianA))
+	}
+
+	fmt.Fprintln(out)
+	writeVerdict(out, a.Value, b.Value, a.timings("total"), b.timings("total"))
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
@@ -0,0 +1,311 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/berndhartzer/http-trace/stats"
+)
+
+// summaryPercentiles are the percentiles shown in an aggregate summary, each
+// with a confidence interval.
+var summaryPercentiles = []float64{50, 90, 99}
+
+// outlierFactor is how many times slower than the median total a request has
+// to be to be flagged as an outlier, and maxOutliers how many are shown.
+const (
+	outlierFactor = 3
+	maxOutliers   = 10
+)
+
+// breakdownPhases are the phases which make up the total duration of a
+// request, without overlapping.
+var breakdownPhases = []string{"dns", "connect", "tls", "request_write", "response_delay", "response_read"}
+
+// Aggregate collects the results of repeated requests and summarises the
+// distribution of their timings. Confidence is the confidence level of the
+// intervals given for the percentiles of the total duration, and Precision
+// the relative half width those intervals should have for the number of
+// samples to be considered enough.
+type Aggregate struct {
+	Confidence float64
+	Precision  float64
+
+	mu      sync.Mutex
+	results []*Result
+}
+
+// NewAggregate creates an Aggregate with the given confidence level and
+// precision, such as 0.95 and 0.05.
+func NewAggregate(confidence, precision float64) *Aggregate {
+	return &Aggregate{
+		Confidence: confidence,
+		Precision:  precision,
+	}
+}
+
+// Add adds the result of a request. Only the timings and events are kept,
+// not the body. It is safe for concurrent use.
+func (a *Aggregate) Add(result *Result) {
+	kept := *result
+	kept.Body = ""
+	kept.BodyEncoding = ""
+	kept.BodyTruncated = 0
+	kept.ResponseHeaders = nil
+	kept.Mirror = nil
+	kept.PipedTo = nil
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.results = append(a.results, &kept)
+}
+
+// Len returns the number of results added.
+func (a *Aggregate) Len() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.results)
+}
+
+// Successful returns the number of results for requests which did not fail.
+func (a *Aggregate) Successful() int {
+	return len(a.timings("total"))
+}
+
+// timings returns the duration of a phase in seconds for each successful
+// request.
+func (a *Aggregate) timings(phase string) []float64 {
+	return a.groupTimings(phase, func(r *Result) bool { return true })
+}
+
+// groupTimings returns the duration of a phase in seconds for each successful
+// request in a group.
+func (a *Aggregate) groupTimings(phase string, inGroup func(r *Result) bool) []float64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	values := []float64{}
+	for _, r := range a.results {
+		if r.Error == "" && inGroup(r) {
+			values = append(values, r.Timings[phase])
+		}
+	}
+	return values
+}
+
+// SamplesNeeded estimates how many successful requests are needed for the
+// confidence interval of every summary percentile of the total duration to
+// be within the precision, and which percentile needs the most.
+func (a *Aggregate) SamplesNeeded() (int, float64) {
+	totals := a.timings("total")
+
+	needed, percentile := 0, 0.0
+	for _, p := range summaryPercentiles {
+		n := stats.SamplesNeeded(totals, p, a.Confidence, a.Precision)
+		if n > needed {
+			needed, percentile = n, p
+		}
+	}
+	return needed, percentile
+}
+
+// Write writes the summary: the minimum, percentiles and maximum of each
+// phase, for all requests and separately for those on new and reused
+// connections, confidence intervals for the percentiles of the total duration
+// and whether there were enough requests for them to be meaningful.
+func (a *Aggregate) Write(w io.Writer, pres *Presentation) error {
+	format := pres.timeFormat()
+	out := &bytes.Buffer{}
+	totals := a.timings("total")
+	failed := a.Len() - len(totals)
+
+	fmt.Fprintf(out, "Summary of %d requests (%d failed)\n", a.Len(), failed)
+	if len(totals) == 0 {
+		_, err := w.Write(out.Bytes())
+		return err
+	}
+
+	writePhaseTable(out, format, a.timings)
+
+	// Requests which had to set up a connection and those which reused one
+	// are different populations, so they are also summarised separately.
+	cold := func(r *Result) bool { return !r.Reused }
+	warm := func(r *Result) bool { return r.Reused }
+	coldCount, warmCount := len(a.groupTimings("total", cold)), len(a.groupTimings("total", warm))
+	if coldCount > 0 && warmCount > 0 {
+		groups := []struct {
+			name    string
+			count   int
+			inGroup func(r *Result) bool
+		}{
+			{"Cold, new connection", coldCount, cold},
+			{"Warm, reused connection", warmCount, warm},
+		}
+		for _, g := range groups {
+			inGroup := g.inGroup
+			fmt.Fprintf(out, "\n%s (%d requests)\n", g.name, g.count)
+			writePhaseTable(out, format, func(phase string) []float64 {
+				return a.groupTimings(phase, inGroup)
+			})
+		}
+	}
+
+	a.writeCacheStatuses(out, format)
+
+	fmt.Fprintln(out)
+	for _, p := range summaryPercentiles {
+		label := fmt.Sprintf("total p%g:", p)
+		estimate := stats.Percentile(totals, p)
+		lower, upper, ok := stats.PercentileCI(totals, p, a.Confidence)
+		if !ok {
+			fmt.Fprintf(out, "  %-21s%s  %g%% CI unbounded with %d requests\n", label, format.column(format.seconds(estimate)), a.Confidence*100, len(totals))
+			continue
+		}
+
+		relative := ""
+		if estimate > 0 {
+			relative = fmt.Sprintf(" (±%.1f%%)", (upper-lower)/2/estimate*100)
+		}
+		fmt.Fprintf(out, "  %-21s%s  %g%% CI [%s, %s]%s\n", label, format.column(format.seconds(estimate)), a.Confidence*100, format.seconds(lower), format.seconds(upper), relative)
+	}
+
+	a.writeOutliers(out, format, stats.Median(totals))
+
+	fmt.Fprintln(out)
+	needed, percentile := a.SamplesNeeded()
+	if needed > len(totals) {
+		fmt.Fprintf(out, "! About %d requests are needed for total p%g to be within ±%g%% at %g%% confidence, use -n %d or -auto-n\n",
+			needed, percentile, a.Precision*100, a.Confidence*100, needed)
+	} else {
+		fmt.Fprintf(out, "Enough requests for the percentiles of total to be within ±%g%% at %g%% confidence\n", a.Precision*100, a.Confidence*100)
+	}
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// writeCacheStatuses writes the share of the requests which a CDN answered
+// with each cache status and their total durations, as hits and misses are
+// different populations too.
+func (a *Aggregate) writeCacheStatuses(out *bytes.Buffer, format TimeFormat) {
+	statusOf := func(r *Result) string {
+		if r.CDN == nil {
+			return ""
+		}
+		return r.CDN.CacheStatus
+	}
+
+	a.mu.Lock()
+	counts := map[string]int{}
+	reported := 0
+	for _, r := range a.results {
+		if status := statusOf(r); r.Error == "" && status != "" {
+			counts[status]++
+			reported++
+		}
+	}
+	a.mu.Unlock()
+	if reported == 0 {
+		return
+	}
+
+	statuses := make([]string, 0, len(counts))
+	for status := range counts {
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if counts[statuses[i]] != counts[statuses[j]] {
+			return counts[statuses[i]] > counts[statuses[j]]
+		}
+		return statuses[i] < statuses[j]
+	})
+
+	fmt.Fprintf(out, "\nCache status, %.1f%% hits (%d of %d requests)\n", float64(counts[CacheHit])/float64(reported)*100, counts[CacheHit], reported)
+	fmt.Fprintf(out, "  %-21s%11s", "", "requests")
+	for _, p := range summaryPercentiles {
+		fmt.Fprintf(out, " %s", format.column(fmt.Sprintf("p%g", p)))
+	}
+	fmt.Fprintf(out, " %s\n", format.column("max"))
+	for _, status := range statuses {
+		status := status
+		totals := a.groupTimings("total", func(r *Result) bool { return statusOf(r) == status })
+		fmt.Fprintf(out, "  %-21s%11s", status+":", fmt.Sprintf("%d (%.0f%%)", counts[status], float64(counts[status])/float64(reported)*100))
+		for _, p := range summaryPercentiles {
+			fmt.Fprintf(out, " %s", format.column(format.seconds(stats.Percentile(totals, p))))
+		}
+		fmt.Fprintf(out, " %s\n", format.column(format.seconds(stats.Percentile(totals, 100))))
+	}
+}
+
+// writePhaseTable writes the minimum, percentiles and maximum of each phase.
+func writePhaseTable(out *bytes.Buffer, format TimeFormat, timings func(phase string) []float64) {
+	names := make([]string, len(phases))
+	for i, phase := range phases {
+		names[i] = phase.Name
+	}
+	writeTimingTable(out, format, names, timings)
+}
+
+// writeTimingTable writes the minimum, percentiles and maximum of each of the
+// named phases.
+func writeTimingTable(out *bytes.Buffer, format TimeFormat, names []string, timings func(phase string) []float64) {
+	fmt.Fprintf(out, "  %-21s%s", "", format.column("min"))
+	for _, p := range summaryPercentiles {
+		fmt.Fprintf(out, " %s", format.column(fmt.Sprintf("p%g", p)))
+	}
+	fmt.Fprintf(out, " %s\n", format.column("max"))
+	for _, name := range names {
+		values := timings(name)
+		fmt.Fprintf(out, "  %-21s%s", name+":", format.column(format.seconds(stats.Percentile(values, 0))))
+		for _, p := range summaryPercentiles {
+			fmt.Fprintf(out, " %s", format.column(format.seconds(stats.Percentile(values, p))))
+		}
+		fmt.Fprintf(out, " %s\n", format.column(format.seconds(stats.Percentile(values, 100))))
+	}
+}
+
+// writeOutliers writes the phase breakdown and event timeline of each request
+// which took more than outlierFactor times the median total, so it can be
+// seen which phase made it slow.
+func (a *Aggregate) writeOutliers(out *bytes.Buffer, format TimeFormat, median float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	outliers := []int{}
+	for i, r := range a.results {
+		if r.Error == "" && median > 0 && r.Timings["total"] > outlierFactor*median {
+			outliers = append(outliers, i)
+		}
+	}
+	if len(outliers) == 0 {
+		return
+	}
+
+	fmt.Fprintf(out, "\nOutliers (total over %d× the median of %s)\n", outlierFactor, format.seconds(median))
+	for n, i := range outliers {
+		if n == maxOutliers {
+			fmt.Fprintf(out, "  ... and %d more\n", len(outliers)-maxOutliers)
+			break
+		}
+
+		r := a.results[i]
+		slowest := breakdownPhases[0]
+		breakdown := []string{}
+		for _, p := range breakdownPhases {
+			if r.Timings[p] > r.Timings[slowest] {
+				slowest = p
+			}
+			breakdown = append(breakdown, fmt.Sprintf("%s %s", p, format.seconds(r.Timings[p])))
+		}
+
+		fmt.Fprintf(out, "  #%d total %s, %.1f× the median, mostly %s\n", i+1, format.seconds(r.Timings["total"]), r.Timings["total"]/median, slowest)
+		fmt.Fprintf(out, "    %s\n", strings.Join(breakdown, ", "))
+		for _, e := range r.Events {
+			fmt.Fprintf(out, "    %s %s\n", format.column(format.seconds(e.Offset)), strings.TrimSpace(e.Name+" "+e.Detail))
+		}
+	}
+}
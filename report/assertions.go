@@ -0,0 +1,79 @@
+package report
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/berndhartzer/http-trace/expr"
+)
+
+// Assertion is the outcome of an assertion in a Result, with the values its
+// two sides had in seconds, or for an assertion on the content of the
+// response what was found.
+type Assertion struct {
+	Assertion string  `json:"assertion"`
+	Passed    bool    `json:"passed"`
+	Left      float64 `json:"left"`
+	Right     float64 `json:"right"`
+	Outcome   string  `json:"outcome,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// assertionLine is an assertion as shown in the report.
+type assertionLine struct {
+	Text    string
+	Passed  bool
+	Left    time.Duration
+	Right   time.Duration
+	Err     error
+	Outcome string // The values compared, or the error
+	Content bool   // An assertion on the content of the response rather than the timings
+}
+
+// checkAssertions checks each assertion with vars, showing the values
+// compared in format. An assertion which can't be evaluated, such as for a
+// Server-Timing metric the server didn't send, fails.
+func checkAssertions(assertions []*expr.Assertion, vars map[string]float64, format TimeFormat) []assertionLine {
+	lines := []assertionLine{}
+	for _, a := range assertions {
+		passed, left, right, err := a.Check(vars)
+		line := assertionLine{
+			Text:   a.Text,
+			Passed: passed,
+			Left:   time.Duration(left * float64(time.Second)),
+			Right:  time.Duration(right * float64(time.Second)),
+			Err:    err,
+		}
+		switch {
+		case err != nil:
+			line.Outcome = fmt.Sprintf("error: %v", err)
+		case passed:
+			line.Outcome = fmt.Sprintf("%s %s %s", format.seconds(left), a.Op, format.seconds(right))
+		default:
+			line.Outcome = fmt.Sprintf("%s is not %s %s", format.seconds(left), a.Op, format.seconds(right))
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func (l assertionLine) result() Assertion {
+	res := Assertion{Assertion: l.Text, Passed: l.Passed, Left: l.Left.Seconds(), Right: l.Right.Seconds()}
+	if l.Err != nil {
+		res.Error = l.Err.Error()
+	} else if l.Content {
+		res.Outcome = l.Outcome
+	}
+	return res
+}
+
+// FailedAssertions returns the assertions of the result which didn't hold.
+func (r *Result) FailedAssertions() []string {
+	failed := []string{}
+	for _, a := range r.Assertions {
+		if !a.Passed {
+			failed = append(failed, a.Assertion)
+		}
+	}
+	return failed
+}
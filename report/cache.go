@@ -0,0 +1,225 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/berndhartzer/http-trace/trace"
+)
+
+// CacheResponse is one of the responses of a cache check.
+type CacheResponse struct {
+	Response *http.Response
+	Timings  *trace.Timings
+	BodySize int64
+}
+
+// CacheCheck is a request and a conditional request revalidating its
+// response, sent with the validators it was given, to check whether the
+// server answers it with 304 Not Modified as caches rely on.
+type CacheCheck struct {
+	URL         string
+	Initial     *CacheResponse
+	Validators  []string       // Headers sent with the conditional request, such as If-None-Match: "abc"
+	Conditional *CacheResponse // nil if the initial response had no validators to send
+}
+
+// cacheDirectiveMeanings describes the Cache-Control directives of a
+// response. Those with a number of seconds take it as a duration.
+var cacheDirectiveMeanings = map[string]string{
+	"public":                 "may be stored by shared caches, such as CDNs and proxies",
+	"private":                "may only be stored by the client's own cache, not by shared ones",
+	"no-store":               "must not be stored by any cache",
+	"no-cache":               "may be stored, but must be revalidated before each use",
+	"must-revalidate":        "must be revalidated before use once stale",
+	"proxy-revalidate":       "must be revalidated by shared caches before use once stale",
+	"must-understand":        "may only be stored by caches which understand its status code",
+	"no-transform":           "must not be transformed by intermediaries",
+	"immutable":              "won't change while fresh, so isn't revalidated even on reload",
+	"max-age":                "fresh for %s",
+	"s-maxage":               "fresh in shared caches for %s",
+	"stale-while-revalidate": "may be used stale for %s while revalidated in the background",
+	"stale-if-error":         "may be used stale for %s when revalidating it fails",
+}
+
+// cacheDirective is a directive of a Cache-Control header, with its value if
+// it has one.
+type cacheDirective struct {
+	Name  string
+	Value string
+}
+
+// parseCacheControl returns the directives of the Cache-Control header.
+func parseCacheControl(header http.Header) []cacheDirective {
+	directives := []cacheDirective{}
+	for _, value := range header.Values("Cache-Control") {
+		for _, part := range splitQuoted(value, ',') {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			d := cacheDirective{Name: strings.ToLower(part)}
+			if i := strings.IndexByte(part, '='); i >= 0 {
+				d.Name = strings.ToLower(strings.TrimSpace(part[:i]))
+				d.Value = strings.Trim(strings.TrimSpace(part[i+1:]), `"`)
+			}
+			directives = append(directives, d)
+		}
+	}
+	return directives
+}
+
+// meaning describes what the directive tells caches.
+func (d cacheDirective) meaning() string {
+	meaning, ok := cacheDirectiveMeanings[d.Name]
+	if !ok {
+		return "unknown directive"
+	}
+	if !strings.Contains(meaning, "%s") {
+		return meaning
+	}
+	seconds, err := strconv.ParseInt(d.Value, 10, 64)
+	if err != nil || seconds < 0 {
+		return fmt.Sprintf("invalid number of seconds %q", d.Value)
+	}
+	return fmt.Sprintf(meaning, time.Duration(seconds)*time.Second)
+}
+
+// cacheFreshness summarises how long caches may use the response before
+// revalidating it: the freshness lifetime from s-maxage, max-age or Expires,
+// and how much of it is left given the Age of the response.
+func cacheFreshness(header http.Header) string {
+	directives := map[string]string{}
+	for _, d := range parseCacheControl(header) {
+		directives[d.Name] = d.Value
+	}
+	if _, ok := directives["no-store"]; ok {
+		return "not stored by caches (no-store)"
+	}
+
+	var lifetime time.Duration
+	source := ""
+	for _, name := range []string{"s-maxage", "max-age"} {
+		if value, ok := directives[name]; ok {
+			if seconds, err := strconv.ParseInt(value, 10, 64); err == nil && seconds >= 0 {
+				lifetime, source = time.Duration(seconds)*time.Second, name
+				break
+			}
+		}
+	}
+	if source == "" && header.Get("Expires") != "" {
+		expires, err := http.ParseTime(header.Get("Expires"))
+		date, dateErr := http.ParseTime(header.Get("Date"))
+		switch {
+		case err != nil:
+			// An invalid Expires, such as 0, means already expired
+			lifetime, source = 0, "Expires"
+		case dateErr == nil:
+			lifetime, source = expires.Sub(date), "Expires"
+		}
+	}
+	if source == "" {
+		if header.Get("Last-Modified") != "" {
+			return "no explicit lifetime, caches may pick one from Last-Modified"
+		}
+		return "no explicit lifetime"
+	}
+
+	var age time.Duration
+	if seconds, err := strconv.ParseInt(strings.TrimSpace(header.Get("Age")), 10, 64); err == nil && seconds > 0 {
+		age = time.Duration(seconds) * time.Second
+	}
+	summary := fmt.Sprintf("fresh for %s (%s)", lifetime, source)
+	if _, ok := directives["no-cache"]; ok {
+		summary += ", but revalidated before each use (no-cache)"
+	}
+	switch {
+	case lifetime <= 0:
+		return summary + ", so stale at once"
+	case age == 0:
+		return summary
+	case age >= lifetime:
+		return fmt.Sprintf("%s, %s old, so already stale", summary, age)
+	default:
+		return fmt.Sprintf("%s, %s old, so fresh for another %s", summary, age, lifetime-age)
+	}
+}
+
+// WriteCacheCheck writes how the server answered the conditional request of
+// check, and how much faster it was than the initial one from sending the
+// request to receiving the whole response, with a summary of the caching
+// headers of the initial response.
+func WriteCacheCheck(w io.Writer, check *CacheCheck, pres *Presentation) error {
+	format := pres.timeFormat()
+	out := &bytes.Buffer{}
+	// Only the second request may reuse the connection, so setting it up is
+	// left out of the comparison
+	exchange := func(c *CacheResponse) time.Duration {
+		return c.Timings.TotalRequestDuration - c.Timings.TotalConnectionDuration
+	}
+	line := func(label string, c *CacheResponse) {
+		fmt.Fprintf(out, "  %-21s%-20s %s %11d\n", label+":", c.Response.Status, format.column(format.Duration(exchange(c))), c.BodySize)
+	}
+
+	fmt.Fprintf(out, "Cache check %s\n", check.URL)
+	fmt.Fprintf(out, "  %-21s%-20s %s %11s\n", "", "status", format.column("exchange"), "body bytes")
+	line("Initial", check.Initial)
+	if check.Conditional != nil {
+		line("Conditional", check.Conditional)
+		for i, v := range check.Validators {
+			label := ""
+			if i == 0 {
+				label = "Sent:"
+			}
+			fmt.Fprintf(out, "  %-21s%s\n", label, v)
+		}
+	}
+
+	header := check.Initial.Response.Header
+	fmt.Fprintf(out, "\nCaching headers\n")
+	if cacheControl := header.Values("Cache-Control"); len(cacheControl) > 0 {
+		fmt.Fprintf(out, "  %-21s%s\n", "Cache-Control:", strings.Join(cacheControl, ", "))
+		for _, d := range parseCacheControl(header) {
+			name := d.Name
+			if d.Value != "" {
+				name += "=" + d.Value
+			}
+			fmt.Fprintf(out, "    %s: %s\n", name, d.meaning())
+		}
+	}
+	for _, name := range []string{"Age", "Expires", "ETag", "Last-Modified", "Vary"} {
+		if value := header.Get(name); value != "" {
+			fmt.Fprintf(out, "  %-21s%s\n", name+":", value)
+		}
+	}
+	fmt.Fprintf(out, "  %-21s%s\n", "Freshness:", cacheFreshness(header))
+
+	fmt.Fprintln(out)
+	conditional := check.Conditional
+	switch {
+	case conditional == nil:
+		fmt.Fprintln(out, "! the response has no ETag or Last-Modified, so caches can't revalidate it with a conditional request and have to download it again")
+	case conditional.Response.StatusCode == http.StatusNotModified:
+		initial, revalidated := exchange(check.Initial), exchange(conditional)
+		change := "faster"
+		diff := initial - revalidated
+		if diff < 0 {
+			change, diff = "slower", -diff
+		}
+		percent := 0.0
+		if initial > 0 {
+			percent = diff.Seconds() / initial.Seconds() * 100
+		}
+		fmt.Fprintf(out, "The conditional request was answered with 304 Not Modified, %s (%.1f%%) %s than the initial request, without sending the %d bytes of the body again\n", format.Duration(diff), percent, change, check.Initial.BodySize)
+	default:
+		fmt.Fprintf(out, "! the conditional request was answered with %s rather than 304 Not Modified, so the server ignores the validators, or the response changed in between\n", conditional.Response.Status)
+	}
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
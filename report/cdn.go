@@ -0,0 +1,254 @@
+package report
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cache statuses of a response, as reported by CDNs and caching proxies in
+// their own headers, normalized so they can be compared between providers.
+const (
+	CacheHit         = "hit"         // Served from the cache
+	CacheMiss        = "miss"        // Not in the cache, fetched from the origin
+	CacheExpired     = "expired"     // In the cache but expired, fetched again from the origin
+	CacheStale       = "stale"       // Served stale from the cache
+	CacheRevalidated = "revalidated" // In the cache, revalidated with the origin before being served
+	CacheBypass      = "bypass"      // Not cached at all, as the response is dynamic or the cache was bypassed
+)
+
+var cacheStatusMeanings = map[string]string{
+	CacheHit:         "served from the cache",
+	CacheMiss:        "not in the cache, fetched from the origin",
+	CacheExpired:     "in the cache but expired, fetched again from the origin",
+	CacheStale:       "served stale from the cache, while it is revalidated or the origin is unavailable",
+	CacheRevalidated: "in the cache, revalidated with the origin before being served",
+	CacheBypass:      "not cached, the response is dynamic or the cache was bypassed",
+}
+
+// cacheStatusHeaders are the headers CDNs and caching proxies report the
+// cache status in, in order of preference.
+var cacheStatusHeaders = []string{"Cf-Cache-Status", "Cache-Status", "X-Cache", "X-Cache-Status", "X-Vercel-Cache", "X-Proxy-Cache"}
+
+// cdnProviders recognize the CDN which served a response from its headers.
+var cdnProviders = []struct {
+	name  string
+	match func(header http.Header) bool
+}{
+	{"Cloudflare", func(h http.Header) bool {
+		return h.Get("Cf-Ray") != "" || h.Get("Cf-Cache-Status") != "" || strings.EqualFold(h.Get("Server"), "cloudflare")
+	}},
+	{"CloudFront", func(h http.Header) bool {
+		return h.Get("X-Amz-Cf-Id") != "" || strings.Contains(strings.ToLower(h.Get("X-Cache")), "cloudfront")
+	}},
+	{"Fastly", func(h http.Header) bool {
+		return h.Get("X-Fastly-Request-Id") != "" || strings.HasPrefix(h.Get("X-Served-By"), "cache-")
+	}},
+	{"Akamai", func(h http.Header) bool {
+		return strings.HasPrefix(h.Get("Server"), "AkamaiGHost") || h.Get("X-Akamai-Request-Id") != ""
+	}},
+	{"Azure Front Door", func(h http.Header) bool { return h.Get("X-Azure-Ref") != "" }},
+	{"Vercel", func(h http.Header) bool { return h.Get("X-Vercel-Id") != "" || h.Get("X-Vercel-Cache") != "" }},
+	{"Netlify", func(h http.Header) bool { return h.Get("X-Nf-Request-Id") != "" }},
+	{"Varnish", func(h http.Header) bool {
+		return h.Get("X-Varnish") != "" || strings.Contains(strings.ToLower(strings.Join(h.Values("Via"), ",")), "varnish")
+	}},
+}
+
+// cdnInfo is what the headers of a response tell of the CDNs and caches it
+// passed through.
+type cdnInfo struct {
+	Provider      string
+	Status        string // One of the Cache constants, or the status as sent if it isn't recognized
+	StatusHeader  string // The header the status was taken from, with its value
+	Age           time.Duration
+	HasAge        bool
+	Via           []string
+	ServerTimings []string
+	Causes        []string // Why the response may not have been cached
+}
+
+// CDN is what the headers of a response tell of the CDNs and caches it passed
+// through, in a Result. Age is in seconds.
+type CDN struct {
+	Provider     string   `json:"provider,omitempty"`
+	CacheStatus  string   `json:"cache_status,omitempty"`
+	StatusHeader string   `json:"status_header,omitempty"`
+	Age          *float64 `json:"age,omitempty"`
+	Via          []string `json:"via,omitempty"`
+	Causes       []string `json:"causes,omitempty"`
+}
+
+// Meaning explains the cache status.
+func (c *cdnInfo) Meaning() string {
+	return cacheStatusMeanings[c.Status]
+}
+
+// Cached reports whether the response was served from a cache.
+func (c *cdnInfo) Cached() bool {
+	return c.Status == CacheHit || c.Status == CacheStale || c.Status == CacheRevalidated
+}
+
+func (c *cdnInfo) result() *CDN {
+	res := &CDN{
+		Provider:     c.Provider,
+		CacheStatus:  c.Status,
+		StatusHeader: c.StatusHeader,
+		Via:          c.Via,
+		Causes:       c.Causes,
+	}
+	if c.HasAge {
+		age := c.Age.Seconds()
+		res.Age = &age
+	}
+	return res
+}
+
+// inspectCDN interprets the CDN headers of the response: which CDN served it,
+// its cache status, its Age and Via, and the Server-Timing metrics CDNs add.
+// The Server-Timing metrics are shown in format. It returns nil when there
+// are none.
+func inspectCDN(res *http.Response, format TimeFormat) *cdnInfo {
+	header := res.Header
+	info := &cdnInfo{Via: header.Values("Via")}
+	for _, p := range cdnProviders {
+		if p.match(header) {
+			info.Provider = p.name
+			break
+		}
+	}
+
+	for _, name := range cacheStatusHeaders {
+		if value := header.Get(name); value != "" {
+			info.StatusHeader = name + ": " + value
+			if name == "Cache-Status" {
+				info.Status = structuredCacheStatus(value)
+			} else {
+				info.Status = normalizeCacheStatus(lastListItem(value))
+			}
+			break
+		}
+	}
+
+	// Akamai and others send the status as the metric cdn-cache; desc=HIT
+	for _, value := range append(append([]string{}, header.Values("Server-Timing")...), res.Trailer.Values("Server-Timing")...) {
+		for _, metric := range splitQuoted(value, ',') {
+			params := splitQuoted(metric, ';')
+			if info.Status != "" || !strings.EqualFold(strings.TrimSpace(params[0]), "cdn-cache") {
+				continue
+			}
+			for _, param := range params[1:] {
+				if i := strings.Index(param, "="); i >= 0 && strings.EqualFold(strings.TrimSpace(param[:i]), "desc") {
+					info.StatusHeader = "Server-Timing: " + strings.TrimSpace(metric)
+					info.Status = normalizeCacheStatus(strings.Trim(strings.TrimSpace(param[i+1:]), `"`))
+				}
+			}
+		}
+	}
+	timings := serverTimings(res)
+	names := make([]string, 0, len(timings))
+	for name := range timings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		info.ServerTimings = append(info.ServerTimings, fmt.Sprintf("%s %s", name, format.seconds(timings[name])))
+	}
+
+	if seconds, err := strconv.ParseInt(strings.TrimSpace(header.Get("Age")), 10, 64); err == nil && seconds >= 0 {
+		info.Age, info.HasAge = time.Duration(seconds)*time.Second, true
+	}
+
+	if info.Provider == "" && info.Status == "" && !info.HasAge && len(info.Via) == 0 {
+		return nil
+	}
+	if info.Status != "" && !info.Cached() {
+		info.Causes = uncacheableCauses(header)
+	}
+	return info
+}
+
+// normalizeCacheStatus returns the Cache constant for a status as CDNs send
+// it, such as HIT, TCP_MISS or "RefreshHit from cloudfront", or the status
+// in lowercase if it isn't recognized.
+func normalizeCacheStatus(status string) string {
+	upper := strings.ToUpper(status)
+	switch {
+	case strings.Contains(upper, "REFRESH") || strings.Contains(upper, "REVALIDATED"):
+		return CacheRevalidated
+	case strings.Contains(upper, "STALE") || strings.Contains(upper, "UPDATING"):
+		return CacheStale
+	case strings.Contains(upper, "EXPIRED"):
+		return CacheExpired
+	case strings.Contains(upper, "MISS"):
+		return CacheMiss
+	case strings.Contains(upper, "HIT"):
+		return CacheHit
+	case strings.Contains(upper, "PASS") || strings.Contains(upper, "DYNAMIC") || strings.Contains(upper, "UNCACHEABLE"):
+		return CacheBypass
+	default:
+		return strings.ToLower(strings.TrimSpace(status))
+	}
+}
+
+// structuredCacheStatus returns the Cache constant for the standard
+// Cache-Status header, such as "Origin; fwd=miss, CDN; hit", from the cache
+// closest to the client, which is listed last.
+func structuredCacheStatus(value string) string {
+	params := splitQuoted(lastListItem(value), ';')
+	for _, param := range params[1:] {
+		param = strings.TrimSpace(param)
+		if strings.EqualFold(param, "hit") {
+			return CacheHit
+		}
+		if i := strings.Index(param, "="); i >= 0 && strings.EqualFold(param[:i], "fwd") {
+			switch fwd := strings.ToLower(strings.Trim(param[i+1:], `"`)); fwd {
+			case "stale":
+				return CacheRevalidated
+			case "bypass", "method", "request":
+				return CacheBypass
+			default:
+				return normalizeCacheStatus(fwd)
+			}
+		}
+	}
+	return ""
+}
+
+// lastListItem returns the last item of a comma separated list, which for
+// the cache status headers of several caches in a row is that of the cache
+// closest to the client.
+func lastListItem(value string) string {
+	items := splitQuoted(value, ',')
+	return strings.TrimSpace(items[len(items)-1])
+}
+
+// uncacheableCauses returns the headers of a response which commonly keep
+// CDNs from caching it.
+func uncacheableCauses(header http.Header) []string {
+	causes := []string{}
+	for _, d := range parseCacheControl(header) {
+		switch d.Name {
+		case "private", "no-store", "no-cache":
+			causes = append(causes, "Cache-Control "+d.Name)
+		case "max-age", "s-maxage":
+			if d.Value == "0" {
+				causes = append(causes, "Cache-Control "+d.Name+"=0")
+			}
+		}
+	}
+	if len(header.Values("Set-Cookie")) > 0 {
+		causes = append(causes, "Set-Cookie")
+	}
+	for _, vary := range header.Values("Vary") {
+		for _, v := range strings.Split(vary, ",") {
+			if v = strings.TrimSpace(v); v == "*" || strings.EqualFold(v, "Cookie") || strings.EqualFold(v, "Authorization") {
+				causes = append(causes, "Vary "+v)
+			}
+		}
+	}
+	return causes
+}
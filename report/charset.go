@@ -0,0 +1,74 @@
+package report
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// charsetSniffLength is how much of the body is searched for a charset
+// declaration, matching the limit browsers use for meta tags.
+const charsetSniffLength = 1024
+
+var (
+	metaCharsetRe = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?\s*([a-z0-9_:.\-]+)`)
+	xmlEncodingRe = regexp.MustCompile(`(?i)^<\?xml[^>]+encoding\s*=\s*["']([a-z0-9_:.\-]+)["']`)
+)
+
+// detectCharset finds the charset of a body from the Content-Type header,
+// falling back to HTML meta tags and XML declarations within the body.
+func detectCharset(header http.Header, body string) string {
+	if _, params, err := mime.ParseMediaType(header.Get("Content-Type")); err == nil {
+		if charset, ok := params["charset"]; ok {
+			return strings.ToLower(charset)
+		}
+	}
+
+	head := body
+	if len(head) > charsetSniffLength {
+		head = head[:charsetSniffLength]
+	}
+
+	if m := xmlEncodingRe.FindStringSubmatch(head); m != nil {
+		return strings.ToLower(m[1])
+	}
+	if m := metaCharsetRe.FindStringSubmatch(head); m != nil {
+		return strings.ToLower(m[1])
+	}
+
+	return ""
+}
+
+// transcodeBody decodes body from charset to UTF-8. It returns the charset
+// the body was decoded from, which is empty when decoding made no difference
+// or the charset is not known.
+func transcodeBody(charset, body string) (string, string, error) {
+	if charset == "" {
+		return body, "", nil
+	}
+
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return body, "", fmt.Errorf("unknown charset %q, body shown undecoded", charset)
+	}
+
+	name, err := htmlindex.Name(enc)
+	if err != nil || name == "utf-8" {
+		return body, "", nil
+	}
+
+	decoded, err := enc.NewDecoder().String(body)
+	if err != nil {
+		return body, "", fmt.Errorf("could not decode body from %s: %v", name, err)
+	}
+
+	if decoded == body {
+		return body, "", nil
+	}
+
+	return decoded, charset, nil
+}
@@ -0,0 +1,62 @@
+package report
+
+import (
+	"time"
+
+	"github.com/berndhartzer/http-trace/trace"
+)
+
+// chunkCadence is when the chunks of a chunked response body arrived, to see
+// whether the server streamed it steadily or stalled part way.
+type chunkCadence struct {
+	Count      int
+	First      time.Duration // When the first chunk arrived, from the start of the request
+	Last       time.Duration // When the last chunk arrived
+	LargestGap time.Duration // Longest time between two chunks
+	GapAfter   int64         // Bytes of the body received before the largest gap
+}
+
+// Chunks is when the chunks of a chunked response body arrived, in a Result.
+// Offsets are from the start of the request.
+type Chunks struct {
+	Count      int     `json:"count"`
+	First      float64 `json:"first"`
+	Last       float64 `json:"last"`
+	LargestGap float64 `json:"largest_gap"`
+	GapAfter   int64   `json:"largest_gap_after_bytes"`
+}
+
+// measureCadence summarises when chunks arrived, or returns nil if there were
+// none.
+func measureCadence(chunks []trace.Chunk) *chunkCadence {
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	cadence := &chunkCadence{
+		Count: len(chunks),
+		First: chunks[0].Offset,
+		Last:  chunks[len(chunks)-1].Offset,
+	}
+	var received int64
+	for i, chunk := range chunks {
+		if i > 0 {
+			if gap := chunk.Offset - chunks[i-1].Offset; gap > cadence.LargestGap {
+				cadence.LargestGap = gap
+				cadence.GapAfter = received
+			}
+		}
+		received += int64(chunk.Size)
+	}
+	return cadence
+}
+
+func (c *chunkCadence) result() *Chunks {
+	return &Chunks{
+		Count:      c.Count,
+		First:      c.First.Seconds(),
+		Last:       c.Last.Seconds(),
+		LargestGap: c.LargestGap.Seconds(),
+		GapAfter:   c.GapAfter,
+	}
+}
@@ -0,0 +1,74 @@
+package report
+
+import (
+	"text/template"
+	"time"
+)
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiDim    = "\x1b[2m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiCyan   = "\x1b[36m"
+)
+
+// Default thresholds above which timings are colored as slow and very slow.
+const (
+	DefaultSlowThreshold     = 100 * time.Millisecond
+	DefaultVerySlowThreshold = 500 * time.Millisecond
+)
+
+func colorize(color, s string) string {
+	if color == "" {
+		return s
+	}
+	return color + s + ansiReset
+}
+
+// colorFuncs returns template functions which replace the plain ones in
+// tmplFuncs to color the report: the status by its class, timings green,
+// yellow or red against the thresholds and header names dimmed.
+func colorFuncs(pres *Presentation) template.FuncMap {
+	slow, verySlow := pres.SlowThreshold, pres.VerySlowThreshold
+	if slow == 0 {
+		slow = DefaultSlowThreshold
+	}
+	if verySlow == 0 {
+		verySlow = DefaultVerySlowThreshold
+	}
+	durationMillis := timeFuncs(pres.TimeFormat)["durationMillis"].(func(time.Duration) string)
+
+	return template.FuncMap{
+		"durationMillis": func(duration time.Duration) string {
+			color := ansiGreen
+			switch {
+			case duration == 0:
+				color = ""
+			case duration >= verySlow:
+				color = ansiRed
+			case duration >= slow:
+				color = ansiYellow
+			}
+			return colorize(color, durationMillis(duration))
+		},
+		"colorStatus": func(code int, status string) string {
+			color := ""
+			switch {
+			case code >= 500:
+				color = ansiRed
+			case code >= 400:
+				color = ansiYellow
+			case code >= 300:
+				color = ansiCyan
+			case code >= 200:
+				color = ansiGreen
+			}
+			return colorize(color, status)
+		},
+		"dim": func(s string) string {
+			return colorize(ansiDim, s)
+		},
+	}
+}
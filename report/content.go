@@ -0,0 +1,246 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/berndhartzer/http-trace/jsonpath"
+)
+
+// ContentAssertion is a check of the content of the response which should
+// hold, such as that its body contains some text, checked along with the
+// assertions on the timings.
+type ContentAssertion struct {
+	Text  string // As shown in the report
+	check func(header http.Header, body string) (bool, string, error)
+}
+
+// BodyContains asserts the body, decoded to UTF-8, contains text.
+func BodyContains(text string) *ContentAssertion {
+	return &ContentAssertion{
+		Text: fmt.Sprintf("body contains %q", text),
+		check: func(header http.Header, body string) (bool, string, error) {
+			if strings.Contains(body, text) {
+				return true, "found", nil
+			}
+			return false, fmt.Sprintf("not found in the %d bytes of the body", len(body)), nil
+		},
+	}
+}
+
+// ParseHeaderAssertion parses a "Name: value" assertion that the response
+// has the header with the value, or a "Name" assertion that it has the header.
+func ParseHeaderAssertion(s string) (*ContentAssertion, error) {
+	name, value := s, ""
+	hasValue := false
+	if i := strings.Index(s, ":"); i >= 0 {
+		name, value = s[:i], strings.TrimSpace(s[i+1:])
+		hasValue = true
+	}
+	name = strings.TrimSpace(name)
+	if name == "" || strings.ContainsAny(name, " \t") {
+		return nil, fmt.Errorf("invalid header assertion %q, expected 'Name: value' or 'Name'", s)
+	}
+
+	text := "header " + name
+	if hasValue {
+		text += ": " + value
+	}
+	return &ContentAssertion{
+		Text: text,
+		check: func(header http.Header, body string) (bool, string, error) {
+			values, ok := header[http.CanonicalHeaderKey(name)]
+			if !ok {
+				return false, fmt.Sprintf("no %s header", name), nil
+			}
+			outcome := fmt.Sprintf("%s is %q", name, strings.Join(values, ", "))
+			if !hasValue {
+				return true, outcome, nil
+			}
+			for _, v := range values {
+				if v == value {
+					return true, outcome, nil
+				}
+			}
+			return false, outcome, nil
+		},
+	}, nil
+}
+
+// ParseJSONAssertion parses an assertion on a value of a JSON body, such as
+// '.status == "ok"' or '$.items[0].count > 3', which compares the value at a
+// JSONPath with a JSON value using one of == != < <= > >=, the last four
+// only for numbers. A path on its own asserts the body has the value.
+func ParseJSONAssertion(s string) (*ContentAssertion, error) {
+	text := strings.TrimSpace(s)
+	rawPath, op, rawExpected := splitComparison(text)
+	rawPath = strings.TrimSpace(rawPath)
+	if strings.HasPrefix(rawPath, ".") || strings.HasPrefix(rawPath, "[") {
+		rawPath = "$" + rawPath
+	}
+	path, err := jsonpath.Parse(rawPath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON assertion %q: %w", text, err)
+	}
+
+	var expected interface{}
+	if op != "" {
+		expected, err = jsonpath.Decode([]byte(rawExpected))
+		if err != nil || strings.TrimSpace(rawExpected) == "" {
+			return nil, fmt.Errorf("invalid JSON assertion %q, expected a JSON value such as \"ok\" or 3 after %s", text, op)
+		}
+		if op != "==" && op != "!=" {
+			if _, ok := expected.(json.Number); !ok {
+				return nil, fmt.Errorf("invalid JSON assertion %q, %s compares numbers", text, op)
+			}
+		}
+	}
+
+	return &ContentAssertion{
+		Text: "json " + text,
+		check: func(header http.Header, body string) (bool, string, error) {
+			doc, err := jsonpath.Decode([]byte(body))
+			if err != nil {
+				return false, "", err
+			}
+			value, err := path.Lookup(doc)
+			if err != nil {
+				return false, "", err
+			}
+			outcome := fmt.Sprintf("%s is %s", path, formatJSONValue(value))
+			if op == "" {
+				return true, outcome, nil
+			}
+			passed, err := compareJSON(value, op, expected)
+			if err != nil {
+				return false, "", err
+			}
+			if !passed {
+				outcome += fmt.Sprintf(", not %s %s", op, formatJSONValue(expected))
+			}
+			return passed, outcome, nil
+		},
+	}, nil
+}
+
+// splitComparison splits s at the first comparison outside of quotes and
+// brackets, returning s as the left side if there is none.
+func splitComparison(s string) (string, string, string) {
+	var quote byte
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case depth == 0:
+			for _, op := range comparisonOps {
+				if strings.HasPrefix(s[i:], op) {
+					return s[:i], op, s[i+len(op):]
+				}
+			}
+		}
+	}
+	return s, "", ""
+}
+
+// comparisonOps are the comparisons of a JSON assertion, the two character
+// ones first so they aren't read as < or >.
+var comparisonOps = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// compareJSON compares a value of the body with the expected value of an
+// assertion.
+func compareJSON(value interface{}, op string, expected interface{}) (bool, error) {
+	switch op {
+	case "==":
+		return reflect.DeepEqual(normalizeJSON(value), normalizeJSON(expected)), nil
+	case "!=":
+		return !reflect.DeepEqual(normalizeJSON(value), normalizeJSON(expected)), nil
+	}
+
+	number, ok := value.(json.Number)
+	if !ok {
+		return false, fmt.Errorf("%s is not a number", formatJSONValue(value))
+	}
+	left, err := strconv.ParseFloat(number.String(), 64)
+	if err != nil {
+		return false, err
+	}
+	right, err := strconv.ParseFloat(expected.(json.Number).String(), 64)
+	if err != nil {
+		return false, err
+	}
+	switch op {
+	case "<":
+		return left < right, nil
+	case "<=":
+		return left <= right, nil
+	case ">":
+		return left > right, nil
+	case ">=":
+		return left >= right, nil
+	}
+	return false, fmt.Errorf("unknown comparison %q", op)
+}
+
+// normalizeJSON converts the numbers of a decoded value to float64, so 1 and
+// 1.0 are equal.
+func normalizeJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		f, err := strconv.ParseFloat(v.String(), 64)
+		if err != nil {
+			return v
+		}
+		return f
+	case map[string]interface{}:
+		normalized := map[string]interface{}{}
+		for key, item := range v {
+			normalized[key] = normalizeJSON(item)
+		}
+		return normalized
+	case []interface{}:
+		normalized := make([]interface{}, len(v))
+		for i, item := range v {
+			normalized[i] = normalizeJSON(item)
+		}
+		return normalized
+	}
+	return value
+}
+
+// formatJSONValue returns a decoded value as JSON, with strings quoted.
+func formatJSONValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return strconv.Quote(s)
+	}
+	return jsonpath.Format(value)
+}
+
+// checkContentAssertions checks each content assertion with the response
+// headers and the decoded body. An assertion which can't be checked, such as
+// on a body which isn't JSON, fails.
+func checkContentAssertions(assertions []*ContentAssertion, header http.Header, body string) []assertionLine {
+	lines := []assertionLine{}
+	for _, a := range assertions {
+		passed, outcome, err := a.check(header, body)
+		line := assertionLine{Text: a.Text, Passed: passed, Err: err, Outcome: outcome, Content: true}
+		if err != nil {
+			line.Outcome = fmt.Sprintf("error: %v", err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,37 @@
+package report
+
+// checkContinue reports whether the request waited for the server to approve
+// its body with 100 Continue, and whether it did. Otherwise a warning says
+// whether the server answered without the body, which was then not sent, or
+// the transport stopped waiting and sent it without approval.
+func checkContinue(data *reportData) (approved bool, warning string) {
+	const notSent = "the server responded without asking for the body with 100 Continue, so it was not sent"
+	waited, answered := false, false
+	for _, e := range data.Events {
+		switch e.Name {
+		case "Wait100Continue":
+			waited = true
+		case "Got100Continue":
+			return true, ""
+		case "GotFirstResponseByte":
+			answered = true
+		case "WroteRequest":
+			if !waited {
+				return false, ""
+			}
+			if answered {
+				return false, notSent
+			}
+			return false, "the server did not answer Expect: 100-continue in time, so the body was sent without its approval"
+		}
+	}
+	if waited && answered {
+		// The request isn't reported written when the body is dropped
+		return false, notSent
+	}
+	return false, ""
+}
+
+// continueTiming is the name of the 100 Continue wait in the timings of a
+// Result, which is only there if the server approved the body.
+const continueTiming = "continue"
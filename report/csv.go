@@ -0,0 +1,96 @@
+package report
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+
+	"github.com/berndhartzer/http-trace/expr"
+)
+
+// csvPrecision is the number of decimals of durations in CSV for the zero
+// TimeFormat, finer than the text report as the values are for analysis.
+const csvPrecision = 3
+
+// CSVWriter writes results as CSV, one row per request, starting with a
+// header row. Durations are in the unit of its TimeFormat, in milliseconds
+// with csvPrecision decimals for the zero one, and the names of their
+// columns end in the unit, such as dns_ms.
+type CSVWriter struct {
+	w           *csv.Writer
+	derived     []string
+	unit        string
+	precision   int
+	wroteHeader bool
+}
+
+// NewCSVWriter creates a CSVWriter with a column for each phase and each of
+// the composite metrics, with durations in format.
+func NewCSVWriter(w io.Writer, metrics []*expr.Definition, format TimeFormat) *CSVWriter {
+	derived := []string{}
+	for _, m := range metrics {
+		derived = append(derived, m.Name)
+	}
+
+	unit, precision := format.resolve()
+	if format.Unit == "" {
+		precision = csvPrecision
+	}
+
+	return &CSVWriter{
+		w:         csv.NewWriter(w),
+		derived:   derived,
+		unit:      unit,
+		precision: precision,
+	}
+}
+
+// Write writes a row for result, preceded by the header row if this is the
+// first one.
+func (c *CSVWriter) Write(result *Result) error {
+	if !c.wroteHeader {
+		header := []string{"url", "method", "status", "error", "body_size"}
+		for _, p := range phases {
+			header = append(header, p.Name+"_"+c.unit)
+		}
+		for _, name := range c.derived {
+			header = append(header, name+"_"+c.unit)
+		}
+
+		err := c.w.Write(header)
+		if err != nil {
+			return err
+		}
+		c.wroteHeader = true
+	}
+
+	status := ""
+	if result.Status != 0 {
+		status = strconv.Itoa(result.Status)
+	}
+	row := []string{result.URL, result.Method, status, result.Error, strconv.FormatInt(result.BodySize, 10)}
+	for _, p := range phases {
+		row = append(row, c.formatDuration(result.Timings, p.Name))
+	}
+	for _, name := range c.derived {
+		row = append(row, c.formatDuration(result.Derived, name))
+	}
+
+	err := c.w.Write(row)
+	if err != nil {
+		return err
+	}
+
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// formatDuration formats a duration in seconds from values in the unit of
+// the columns, or returns an empty string when it is missing.
+func (c *CSVWriter) formatDuration(values map[string]float64, name string) string {
+	seconds, ok := values[name]
+	if !ok {
+		return ""
+	}
+	return strconv.FormatFloat(seconds*timeUnits[c.unit].perSecond, 'f', c.precision, 64)
+}
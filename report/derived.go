@@ -0,0 +1,59 @@
+package report
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/berndhartzer/http-trace/expr"
+	"github.com/berndhartzer/http-trace/trace"
+)
+
+// derivedMetric is the value of a user defined composite metric.
+type derivedMetric struct {
+	Name     string
+	Duration time.Duration
+}
+
+// timingVars returns the phase durations in seconds, keyed by phase name and
+// also as timing.<phase>, for use in expressions. rtt is estimated from the
+// duration of the TCP connect, and ttfb is the time to the first byte of the
+// response. The durations of the Server-Timing metrics of res are included
+// as server_timing.<name>.
+func timingVars(t *trace.Timings, res *http.Response) map[string]float64 {
+	vars := map[string]float64{}
+	for _, p := range phases {
+		vars[p.Name] = p.Duration(t).Seconds()
+	}
+	vars["rtt"] = t.ConnectionDialDuration.Seconds()
+	vars["ttfb"] = (t.TotalConnectionDuration + t.RequestWriteDuration + t.ResponseDelayDuration).Seconds()
+	for name, value := range vars {
+		vars["timing."+name] = value
+	}
+	for name, value := range serverTimings(res) {
+		vars["server_timing."+name] = value
+	}
+	return vars
+}
+
+// evaluateMetrics computes each definition in order, adding it to vars, so
+// later definitions and assertions can refer to earlier ones.
+func evaluateMetrics(defs []*expr.Definition, vars map[string]float64) ([]derivedMetric, []string) {
+	metrics := []derivedMetric{}
+	warnings := []string{}
+
+	for _, d := range defs {
+		seconds, err := d.Expr.Eval(vars)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("could not compute %s: %v", d.Name, err))
+			continue
+		}
+		vars[d.Name] = seconds
+		metrics = append(metrics, derivedMetric{
+			Name:     d.Name,
+			Duration: time.Duration(seconds * float64(time.Second)),
+		})
+	}
+
+	return metrics, warnings
+}
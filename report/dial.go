@@ -0,0 +1,89 @@
+package report
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/berndhartzer/http-trace/trace"
+)
+
+// DialAttempt is an attempt to connect to one of the addresses of the host, in
+// a Result. Start is the offset from the start of the request in seconds.
+type DialAttempt struct {
+	Network  string  `json:"network"`
+	Addr     string  `json:"addr"`
+	Start    float64 `json:"start"`
+	Duration float64 `json:"duration"`
+	Outcome  string  `json:"outcome"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// Outcomes of a dial attempt.
+const (
+	dialWon       = "won"
+	dialFailed    = "failed"
+	dialAbandoned = "abandoned" // Cancelled once another attempt connected
+	dialUnused    = "unused"    // Connected, but after another attempt
+)
+
+// dialLine is a dial attempt as shown in the report.
+type dialLine struct {
+	Network  string
+	Addr     string
+	Start    time.Duration // From the start of the request
+	Started  time.Duration // After the first attempt started
+	Duration time.Duration
+	Outcome  string
+	Error    string
+}
+
+// dialOutcome returns how an attempt ended.
+func dialOutcome(a trace.DialAttempt) string {
+	switch {
+	case a.Won:
+		return dialWon
+	case a.Err == nil:
+		return dialUnused
+	case errors.Is(a.Err, context.Canceled) || strings.Contains(a.Err.Error(), "operation was canceled"):
+		return dialAbandoned
+	}
+	return dialFailed
+}
+
+// dialLines returns the dial attempts to show, which is only when there was
+// more than one, as otherwise the connect timing says it all.
+func dialLines(attempts []trace.DialAttempt) []dialLine {
+	if len(attempts) < 2 {
+		return nil
+	}
+
+	lines := []dialLine{}
+	for _, a := range attempts {
+		line := dialLine{
+			Network:  a.Network,
+			Addr:     a.Addr,
+			Start:    a.Start,
+			Started:  a.Start - attempts[0].Start,
+			Duration: a.Duration,
+			Outcome:  dialOutcome(a),
+		}
+		if line.Outcome == dialFailed {
+			line.Error = a.Err.Error()
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func (l dialLine) result() DialAttempt {
+	return DialAttempt{
+		Network:  l.Network,
+		Addr:     l.Addr,
+		Start:    l.Start.Seconds(),
+		Duration: l.Duration.Seconds(),
+		Outcome:  l.Outcome,
+		Error:    l.Error,
+	}
+}
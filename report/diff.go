@@ -0,0 +1,124 @@
+package report
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/berndhartzer/http-trace/stats"
+)
+
+// DefaultRegressionThreshold is how much slower, relative to the first, a
+// phase has to be in the second of two compared targets to be flagged as a
+// regression.
+const DefaultRegressionThreshold = 0.1
+
+// minRegression is the smallest difference in seconds flagged as a
+// regression, so phases which take next to no time don't get flagged for
+// relatively large but meaningless changes.
+const minRegression = 0.001
+
+// WriteDiff writes the median duration of each phase of two targets, with
+// the difference and relative change, flagging phases which are more than
+// threshold (such as 0.1 for 10%) slower for b as regressions. It returns
+// whether there were any.
+func WriteDiff(w io.Writer, a, b *Target, threshold float64, pres *Presentation) (bool, error) {
+	format := pres.timeFormat()
+	width := format.Width()
+	out := &bytes.Buffer{}
+	highlight := func(color, s string) string {
+		if pres != nil && pres.Color {
+			return colorize(color, s)
+		}
+		return s
+	}
+
+	fmt.Fprintf(out, "Comparison (median)\n  A %s\n  B %s\n", a.URL, b.URL)
+	fmt.Fprintf(out, "  %-21s%*s %*s %*s %8s\n", "", width, "A", width, "B", width, "diff", "change")
+	fmt.Fprintf(out, "  %-21s%*d %*d\n", "requests:", width, len(a.Results), width, len(b.Results))
+	fmt.Fprintf(out, "  %-21s%*d %*d\n", "failed:", width, countFailures(a.Results), width, countFailures(b.Results))
+	if hasWireSizes(a, b) {
+		sizesA, sizesB := receivedSizes(a.Results), receivedSizes(b.Results)
+		if len(sizesA) == 0 || len(sizesB) == 0 {
+			fmt.Fprintf(out, "  %-21s%*s %*s\n", "received:", width, "-", width, "-")
+		} else {
+			medianA, medianB := stats.Median(sizesA), stats.Median(sizesB)
+			change := "-"
+			if medianA > 0 {
+				change = fmt.Sprintf("%+.1f%%", (medianB-medianA)/medianA*100)
+			}
+			fmt.Fprintf(out, "  %-21s%*s %*s %*s %8s\n", "received:", width, formatBytes(medianA), width, formatBytes(medianB), width, fmt.Sprintf("%+.0f B", medianB-medianA), change)
+		}
+	}
+
+	regressed := false
+	for _, p := range phases {
+		valuesA, valuesB := successfulTimings(a.Results, p.Name), successfulTimings(b.Results, p.Name)
+		if len(valuesA) == 0 || len(valuesB) == 0 {
+			fmt.Fprintf(out, "  %-21s%*s %*s\n", p.Name+":", width, "-", width, "-")
+			continue
+		}
+
+		medianA, medianB := stats.Median(valuesA), stats.Median(valuesB)
+		diff := medianB - medianA
+		change := "-"
+		if medianA > 0 {
+			change = fmt.Sprintf("%+.1f%%", diff/medianA*100)
+		}
+
+		line := fmt.Sprintf("  %-21s%*s %*s %*s %8s", p.Name+":", width, format.seconds(medianA), width, format.seconds(medianB), width, format.signedSeconds(diff), change)
+		if diff > minRegression && diff > medianA*threshold {
+			regressed = true
+			line = highlight(ansiRed, line+"  ! regression")
+		} else if -diff > minRegression && -diff > medianA*threshold {
+			line = highlight(ansiGreen, line)
+		}
+		fmt.Fprintln(out, line)
+	}
+
+	fmt.Fprintln(out)
+	writeVerdict(out, "A", "B", successfulTimings(a.Results, "total"), successfulTimings(b.Results, "total"))
+	if regressed {
+		fmt.Fprintf(out, "! B regressed by more than %g%% in at least one phase\n", threshold*100)
+	}
+
+	_, err := w.Write(out.Bytes())
+	return regressed, err
+}
+
+// ReadResults reads results written with -output json or jsonl, one or more
+// JSON objects one after the other. Lines starting with #, such as the
+// headers in a -report-file, are skipped.
+func ReadResults(r io.Reader) ([]*Result, error) {
+	filtered := &bytes.Buffer{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if !strings.HasPrefix(scanner.Text(), "#") {
+			filtered.Write(scanner.Bytes())
+			filtered.WriteByte('\n')
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading results: %w", err)
+	}
+
+	results := []*Result{}
+	dec := json.NewDecoder(filtered)
+	for {
+		result := &Result{}
+		err := dec.Decode(result)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading results: %w", err)
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,166 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/berndhartzer/http-trace/trace"
+)
+
+// DNSQuery is a query sent to a DNS server to resolve the host, in a Result.
+// Start is the offset from the start of the request in seconds.
+type DNSQuery struct {
+	Server   string  `json:"server"`
+	Name     string  `json:"name"`
+	Type     string  `json:"type"`
+	Start    float64 `json:"start"`
+	Duration float64 `json:"duration"`
+	Outcome  string  `json:"outcome"`
+	Answers  int     `json:"answers"`
+	CNAMEs   int     `json:"cnames,omitempty"`
+	// Of a connection to the server made for the query, such as to an
+	// encrypted resolver
+	Connect      float64 `json:"connect,omitempty"`
+	TLSHandshake float64 `json:"tls_handshake,omitempty"`
+}
+
+// DNSBreakdown splits the DNS resolution of a Result by the type of address
+// queried, in seconds.
+type DNSBreakdown struct {
+	A          float64 `json:"a,omitempty"`
+	AAAA       float64 `json:"aaaa,omitempty"`
+	CNAMEHops  int     `json:"cname_hops"`
+	AnsweredBy string  `json:"answered_by,omitempty"`
+}
+
+// dnsSkewThreshold is how much longer the queries for one type of address
+// can take than those for the other before it is warned about, as the lookup
+// waits for both.
+const dnsSkewThreshold = 100 * time.Millisecond
+
+// dnsBreakdown is the time taken to resolve each type of address, from the
+// first query for it, such as with a search domain, to the last answer.
+type dnsBreakdown struct {
+	A          time.Duration
+	AAAA       time.Duration
+	CNAMEHops  int    // CNAMEs followed to the addresses
+	AnsweredBy string // The server which answered with the addresses
+}
+
+// breakDownDNS returns the time taken by the queries for A and AAAA records,
+// or nil if there were none.
+func breakDownDNS(queries []trace.DNSQuery) *dnsBreakdown {
+	if len(queries) == 0 {
+		return nil
+	}
+
+	b := &dnsBreakdown{}
+	spans := map[string][2]time.Duration{}
+	var lastAnswer time.Duration
+	for _, q := range queries {
+		end := q.Start + q.Duration
+		if span, ok := spans[q.Type]; !ok {
+			spans[q.Type] = [2]time.Duration{q.Start, end}
+		} else {
+			if q.Start < span[0] {
+				span[0] = q.Start
+			}
+			if end > span[1] {
+				span[1] = end
+			}
+			spans[q.Type] = span
+		}
+
+		if q.Outcome == "NOERROR" && q.Answers > q.CNAMEs {
+			if q.CNAMEs > b.CNAMEHops {
+				b.CNAMEHops = q.CNAMEs
+			}
+			if end >= lastAnswer {
+				lastAnswer = end
+				b.AnsweredBy = q.Server
+			}
+		}
+	}
+	if span, ok := spans["A"]; ok {
+		b.A = span[1] - span[0]
+	}
+	if span, ok := spans["AAAA"]; ok {
+		b.AAAA = span[1] - span[0]
+	}
+	return b
+}
+
+// checkDNSBreakdown warns when resolving one type of address took much longer
+// than the other, which the lookup has to wait for, as when a server drops
+// AAAA queries on a network without IPv6. The durations are shown in format.
+func checkDNSBreakdown(b *dnsBreakdown, format TimeFormat) string {
+	if b == nil || b.A == 0 || b.AAAA == 0 {
+		return ""
+	}
+	slow, slowTime, fast, fastTime := "AAAA", b.AAAA, "A", b.A
+	if b.A > b.AAAA {
+		slow, slowTime, fast, fastTime = "A", b.A, "AAAA", b.AAAA
+	}
+	if slowTime-fastTime < dnsSkewThreshold || slowTime < 2*fastTime {
+		return ""
+	}
+	return fmt.Sprintf("resolving %s records took %s against %s for %s records, and the lookup waits for both", slow, format.Duration(slowTime), format.Duration(fastTime), fast)
+}
+
+func (b *dnsBreakdown) result() *DNSBreakdown {
+	return &DNSBreakdown{A: b.A.Seconds(), AAAA: b.AAAA.Seconds(), CNAMEHops: b.CNAMEHops, AnsweredBy: b.AnsweredBy}
+}
+
+// dnsLine is a DNS query as shown in the report.
+type dnsLine struct {
+	trace.DNSQuery
+	Started time.Duration // After the first query was sent
+	Setup   string        // The times of a connection made for the query
+}
+
+// dnsLines returns the DNS queries in the order they were sent, with the
+// connections made for them described in format.
+func dnsLines(queries []trace.DNSQuery, format TimeFormat) []dnsLine {
+	if len(queries) == 0 {
+		return nil
+	}
+	sort.SliceStable(queries, func(i, j int) bool {
+		return queries[i].Start < queries[j].Start
+	})
+
+	lines := []dnsLine{}
+	for _, q := range queries {
+		lines = append(lines, dnsLine{DNSQuery: q, Started: q.Start - queries[0].Start, Setup: dnsSetup(q, format)})
+	}
+	return lines
+}
+
+// dnsSetup describes the connection made to the server for q, if any, with
+// its durations in format.
+func dnsSetup(q trace.DNSQuery, format TimeFormat) string {
+	switch {
+	case q.Connect > 0 && q.TLSHandshake > 0:
+		return fmt.Sprintf("connecting %s and TLS handshake %s", format.Duration(q.Connect), format.Duration(q.TLSHandshake))
+	case q.Connect > 0:
+		return "connecting " + format.Duration(q.Connect)
+	case q.TLSHandshake > 0:
+		return "TLS handshake " + format.Duration(q.TLSHandshake)
+	}
+	return ""
+}
+
+func (l dnsLine) result() DNSQuery {
+	return DNSQuery{
+		Server:       l.Server,
+		Name:         l.Name,
+		Type:         l.Type,
+		Start:        l.Start.Seconds(),
+		Duration:     l.Duration.Seconds(),
+		Outcome:      l.Outcome,
+		Answers:      l.Answers,
+		CNAMEs:       l.CNAMEs,
+		Connect:      l.Connect.Seconds(),
+		TLSHandshake: l.TLSHandshake.Seconds(),
+	}
+}
@@ -0,0 +1,77 @@
+package report
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/berndhartzer/http-trace/trace"
+)
+
+// Options configure a request sent with Do.
+type Options struct {
+	Method         string        // Defaults to GET
+	URL            string        // Where to send the request
+	Header         http.Header   // Headers to send with the request
+	Body           io.Reader     // The request body, if any
+	Client         *http.Client  // Sends the request, defaults to http.DefaultClient
+	MaxBodyCapture int64         // How many bytes of the response body to keep, all of it if 0
+	Presentation   *Presentation // What the Result keeps, such as of the body, and the metrics and assertions to evaluate
+}
+
+// Do sends a request, times it and returns its Result, the same as the JSON
+// output of http-trace, for a single request from Go code. The request is
+// cancelled with ctx.
+//
+// If the request fails its Result is returned with the error, which is also
+// in the Error of the Result. If only reading the response body failed, the
+// error is a *trace.BodyReadError and the Result is that of the response,
+// with the part of the body which was read.
+func Do(ctx context.Context, opts Options) (*Result, error) {
+	method := opts.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequestWithContext(ctx, method, opts.URL, opts.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	for name, values := range opts.Header {
+		req.Header[name] = values
+	}
+
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	pres := opts.Presentation
+	if pres == nil {
+		pres = &Presentation{}
+	}
+
+	t := trace.New(client, req)
+	if opts.MaxBodyCapture > 0 {
+		t.SetMaxBodyCapture(opts.MaxBodyCapture)
+	}
+	err = t.Execute()
+	var bodyErr *trace.BodyReadError
+	if err != nil && !errors.As(err, &bodyErr) {
+		return pres.Redactor.RedactResult(ErrorResult(req, err)), err
+	}
+
+	r := New(req, t.GetResponse(), t.GetResponseBody(), t.GetTimings(), pres)
+	r.SetResponseBodySize(t.GetResponseBodySize())
+	r.SetEvents(t.GetEvents())
+	r.SetChunks(t.GetChunks())
+	r.SetDNSQueries(t.GetDNSQueries())
+	r.SetDialAttempts(t.GetDialAttempts())
+	r.SetConnectionReused(t.GetConnectionReused())
+	r.SetConnectionIdleTime(t.GetConnectionIdleTime())
+	if bodyErr != nil {
+		r.AddWarning(bodyErr.Error())
+	}
+	r.analyse()
+	return r.Result(), err
+}
@@ -0,0 +1,115 @@
+package report_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"github.com/berndhartzer/http-trace/report"
+	"github.com/berndhartzer/http-trace/trace"
+)
+
+func Example() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, "hello world")
+	}))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		panic(err)
+	}
+	t := trace.New(http.DefaultClient, req)
+	err = t.Execute()
+	if err != nil {
+		panic(err)
+	}
+
+	// Only the status and body are shown, as the timings and headers differ
+	// from run to run
+	pres := &report.Presentation{Sections: report.Sections{report.SectionStatus: true, report.SectionBody: true}}
+	r := report.New(req, t.GetResponse(), t.GetResponseBody(), t.GetTimings(), pres)
+	err = r.Build()
+	if err != nil {
+		panic(err)
+	}
+	err = r.Print(os.Stdout)
+	if err != nil {
+		panic(err)
+	}
+	// Output:
+	// < 200 OK
+	// hello world
+}
+
+func ExampleReport_Result() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		panic(err)
+	}
+	t := trace.New(http.DefaultClient, req)
+	err = t.Execute()
+	if err != nil {
+		panic(err)
+	}
+
+	r := report.New(req, t.GetResponse(), t.GetResponseBody(), t.GetTimings(), &report.Presentation{Format: report.FormatJSON})
+	err = r.Build()
+	if err != nil {
+		panic(err)
+	}
+	result := r.Result()
+	fmt.Println(result.Method, result.Status, result.Timings["total"] > 0)
+	// Output:
+	// GET 503 true
+}
+
+func ExampleRegisterFormatter() {
+	// Usually registered from an init function
+	report.RegisterFormatter("markdown", report.FormatterFunc(func(data *report.ReportData, w io.Writer) error {
+		result := data.Result()
+		_, err := fmt.Fprintf(w, "| %s | %s | %d |\n", result.Method, result.URL, result.Status)
+		return err
+	}))
+
+	req, err := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+	if err != nil {
+		panic(err)
+	}
+	resp := &http.Response{Status: "200 OK", StatusCode: http.StatusOK, Header: http.Header{}}
+	r := report.New(req, resp, "", &trace.Timings{}, &report.Presentation{Format: "markdown"})
+	err = r.Build()
+	if err != nil {
+		panic(err)
+	}
+	err = r.Print(os.Stdout)
+	if err != nil {
+		panic(err)
+	}
+	// Output:
+	// | GET | https://example.com/ | 200 |
+}
+
+func ExampleDo() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "hello world")
+	}))
+	defer server.Close()
+
+	result, err := report.Do(context.Background(), report.Options{URL: server.URL})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(result.Status, result.Body, result.Timings["total"] > 0)
+	// Output:
+	// 200 hello world true
+}
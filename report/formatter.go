@@ -0,0 +1,136 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+
+	"github.com/berndhartzer/http-trace/trace"
+)
+
+// Formatter writes a report in an output format. The built in formats are
+// Formatters too, and more can be added with RegisterFormatter.
+type Formatter interface {
+	Format(data *ReportData, w io.Writer) error
+}
+
+// FormatterFunc is a function used as a Formatter.
+type FormatterFunc func(data *ReportData, w io.Writer) error
+
+// Format calls f.
+func (f FormatterFunc) Format(data *ReportData, w io.Writer) error {
+	return f(data, w)
+}
+
+// ReportData is what a Formatter writes a report from, once the response has
+// been analysed.
+type ReportData struct {
+	Request      *http.Request
+	Response     *http.Response
+	Body         string // The response body, decoded to UTF-8 unless the presentation says otherwise
+	Timings      *trace.Timings
+	Presentation *Presentation
+	Warnings     []string
+
+	report *Report
+}
+
+// Result returns the structured result of the request, as written by the
+// JSON formats.
+func (d *ReportData) Result() *Result {
+	return d.report.Result()
+}
+
+// formatters are the output formats by name, those built in and those added
+// with RegisterFormatter.
+var formatters = map[string]Formatter{
+	FormatText:       FormatterFunc(formatText),
+	FormatJSON:       FormatterFunc(formatJSON),
+	FormatJSONL:      FormatterFunc(formatJSONL),
+	FormatPrometheus: FormatterFunc(formatPrometheus),
+	FormatCSV:        FormatterFunc(formatCSV),
+	FormatHTML:       FormatterFunc(formatHTML),
+}
+
+// RegisterFormatter adds the output format name, written by f, so it can be
+// chosen with the Format of a Presentation. It is meant to be called from an
+// init function, as formatters are not safe to register while reports are
+// built, and panics if name is empty or already registered or f is nil.
+func RegisterFormatter(name string, f Formatter) {
+	if f == nil {
+		panic("report: RegisterFormatter formatter is nil")
+	}
+	if name == "" {
+		panic("report: RegisterFormatter name is empty")
+	}
+	if _, exists := formatters[name]; exists {
+		panic(fmt.Sprintf("report: RegisterFormatter called twice for format %q", name))
+	}
+	formatters[name] = f
+}
+
+// LookupFormatter returns the Formatter of the output format name, and
+// whether there is one.
+func LookupFormatter(name string) (Formatter, bool) {
+	if name == "" {
+		name = FormatText
+	}
+	f, ok := formatters[name]
+	return f, ok
+}
+
+// Formatters returns the names of the output formats, in order.
+func Formatters() []string {
+	names := make([]string, 0, len(formatters))
+	for name := range formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func formatText(data *ReportData, w io.Writer) error {
+	r := data.report
+	if data.Presentation.WriteOut != nil {
+		return data.Presentation.WriteOut.Write(w, r.Result(), data.Response.Header)
+	}
+
+	b := &bytes.Buffer{}
+	err := r.buildText(b)
+	if err == nil && r.pipe != nil {
+		err = r.buildPipeText(b)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b.Bytes())
+	return err
+}
+
+func formatJSON(data *ReportData, w io.Writer) error {
+	return writeJSON(w, data.Result())
+}
+
+func formatJSONL(data *ReportData, w io.Writer) error {
+	return WriteJSONLine(w, data.Result())
+}
+
+func formatPrometheus(data *ReportData, w io.Writer) error {
+	return writePrometheus(w, data.report.data)
+}
+
+func formatCSV(data *ReportData, w io.Writer) error {
+	return NewCSVWriter(w, data.Presentation.Metrics, data.Presentation.TimeFormat).Write(data.Result())
+}
+
+func formatHTML(data *ReportData, w io.Writer) error {
+	b := &bytes.Buffer{}
+	err := data.report.buildHTML(b)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b.Bytes())
+	return err
+}
@@ -0,0 +1,145 @@
+package report
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// How the end of a response body was delimited.
+const (
+	FramingLength  = "content-length"   // By its Content-Length
+	FramingChunked = "chunked"          // By the last chunk of the chunked encoding
+	FramingClose   = "connection close" // By the server closing the connection
+	FramingNone    = "none"             // There was no body
+)
+
+// framingInfo is how an HTTP/1 response was framed, shown when the server
+// behaved in a legacy way which affects the timings: answering with
+// HTTP/1.0, delimiting the body by closing the connection, or not keeping the
+// connection for reuse.
+type framingInfo struct {
+	Proto     string        // Of the response, such as HTTP/1.0
+	Body      string        // One of the Framing constants
+	Close     bool          // Whether the connection was closed after the response
+	Reason    string        // Why it was closed
+	KeepAlive string        // The Keep-Alive header, such as timeout=5, max=100
+	EndWait   time.Duration // From the last byte of the body to the connection being closed
+}
+
+// Framing is how the response was framed, in a Result. The wait is in
+// seconds.
+type Framing struct {
+	Proto     string  `json:"proto"`
+	Body      string  `json:"body"`
+	Close     bool    `json:"connection_close"`
+	Reason    string  `json:"close_reason,omitempty"`
+	KeepAlive string  `json:"keep_alive,omitempty"`
+	EndWait   float64 `json:"end_wait,omitempty"`
+}
+
+// checkFraming returns how an HTTP/1 response was framed, with warnings
+// explaining how it affected the timings, or nil if it was framed as usual.
+func checkFraming(data *reportData) (*framingInfo, []string) {
+	resp := data.Response
+	if resp.ProtoMajor != 1 {
+		return nil, nil
+	}
+
+	info := &framingInfo{
+		Proto:     fmt.Sprintf("HTTP/%d.%d", resp.ProtoMajor, resp.ProtoMinor),
+		Body:      responseFraming(resp, data.BodySkipped),
+		Close:     resp.Close,
+		KeepAlive: resp.Header.Get("Keep-Alive"),
+	}
+	http10 := resp.ProtoMinor == 0
+	if info.Body == FramingClose && data.Timings != nil {
+		info.EndWait = data.Timings.BodyEndDuration
+	}
+	switch {
+	case !info.Close:
+	case hasToken(resp.Header, "Connection", "close"):
+		info.Reason = "Connection: close"
+	case http10 && !hasToken(resp.Header, "Connection", "keep-alive"):
+		info.Reason = "HTTP/1.0 without Connection: keep-alive"
+	case info.Body == FramingClose:
+		info.Reason = "the body ends with the connection"
+	}
+	if !http10 && info.Body != FramingClose && !info.Close {
+		return nil, nil
+	}
+
+	warnings := []string{}
+	if info.Body == FramingClose {
+		warnings = append(warnings, fmt.Sprintf("the response has neither a Content-Length nor chunked encoding, so its end was only known when the server closed the connection, %s after the last byte, which counts towards the response read", data.Presentation.TimeFormat.Duration(info.EndWait)))
+	}
+	switch {
+	case http10 && info.Close:
+		warnings = append(warnings, "the server answered with HTTP/1.0 and closed the connection, so every request has to set up a new one")
+	case info.Close && info.Reason == "Connection: close":
+		warnings = append(warnings, "the server sent Connection: close, so every request has to set up a new connection")
+	}
+	return info, warnings
+}
+
+// responseFraming returns how the end of the body of resp was delimited.
+func responseFraming(resp *http.Response, skipped bool) string {
+	chunked := false
+	for _, encoding := range resp.TransferEncoding {
+		chunked = chunked || encoding == "chunked"
+	}
+	switch {
+	case chunked:
+		return FramingChunked
+	case resp.ContentLength == 0 || !bodyAllowed(resp):
+		return FramingNone
+	case resp.ContentLength > 0:
+		return FramingLength
+	case resp.Uncompressed:
+		// The transport drops the Content-Length of a body it decompresses,
+		// but only a body delimited by the close makes it close an HTTP/1.1
+		// connection on its own
+		if resp.Close && resp.ProtoMinor > 0 && !hasToken(resp.Header, "Connection", "close") {
+			return FramingClose
+		}
+		return FramingLength
+	case skipped:
+		return FramingNone
+	default:
+		return FramingClose
+	}
+}
+
+// bodyAllowed reports whether the response can have a body at all.
+func bodyAllowed(resp *http.Response) bool {
+	if resp.Request != nil && resp.Request.Method == http.MethodHead {
+		return false
+	}
+	status := resp.StatusCode
+	return !(status >= 100 && status < 200) && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// hasToken reports whether the comma separated values of header name include
+// token, regardless of case.
+func hasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (f *framingInfo) result() *Framing {
+	return &Framing{
+		Proto:     f.Proto,
+		Body:      f.Body,
+		Close:     f.Close,
+		Reason:    f.Reason,
+		KeepAlive: f.KeepAlive,
+		EndWait:   f.EndWait.Seconds(),
+	}
+}
@@ -0,0 +1,98 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// graphQLResponse is the body of a response from a GraphQL endpoint. Both
+// data and errors can be set, as for a partial result.
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []graphQLError  `json:"errors"`
+}
+
+type graphQLError struct {
+	Message   string        `json:"message"`
+	Path      []interface{} `json:"path"`
+	Locations []struct {
+		Line   int `json:"line"`
+		Column int `json:"column"`
+	} `json:"locations"`
+}
+
+// String returns the message of the error with where in the result and the
+// query it applies to, such as
+// Cannot query field "x" (at user.x, line 3:5).
+func (e graphQLError) String() string {
+	where := []string{}
+	if len(e.Path) > 0 {
+		path := make([]string, len(e.Path))
+		for i, p := range e.Path {
+			path[i] = fmt.Sprint(p)
+		}
+		where = append(where, "at "+strings.Join(path, "."))
+	}
+	for _, l := range e.Locations {
+		where = append(where, fmt.Sprintf("line %d:%d", l.Line, l.Column))
+	}
+	if len(where) == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%s (%s)", e.Message, strings.Join(where, ", "))
+}
+
+// formatGraphQL returns the data of the GraphQL response body indented and
+// its errors listed one per line, with the errors. ok is false if body isn't
+// a GraphQL response.
+func formatGraphQL(body string) (formatted string, errs []string, ok bool) {
+	res := graphQLResponse{}
+	if err := json.Unmarshal([]byte(body), &res); err != nil || (res.Data == nil && res.Errors == nil) {
+		return "", nil, false
+	}
+
+	b := &strings.Builder{}
+	b.WriteString("data:")
+	data := &bytes.Buffer{}
+	if len(res.Data) > 0 && json.Indent(data, res.Data, "  ", "  ") == nil {
+		b.WriteString("\n  ")
+		b.Write(data.Bytes())
+	} else {
+		b.WriteString(" none")
+	}
+	for i, e := range res.Errors {
+		if i == 0 {
+			b.WriteString("\nerrors:")
+		}
+		errs = append(errs, e.String())
+		b.WriteString("\n  - " + e.String())
+	}
+	return b.String(), errs, true
+}
+
+// checkGraphQL shows the body as a GraphQL response, returning its errors and
+// a warning if there were any, as they are usually sent with a 200 status.
+func checkGraphQL(data *reportData) ([]string, string) {
+	if !data.Presentation.GraphQL || data.BodySkipped || data.BodySniff.Binary {
+		return nil, ""
+	}
+
+	if data.ResponseBodyTruncated > 0 {
+		return nil, "the response body was truncated, so it is not shown as a GraphQL response"
+	}
+	formatted, errs, ok := formatGraphQL(data.DisplayBody)
+	if !ok {
+		return nil, "the response body is not a GraphQL response, with data or errors, so it is shown as it is"
+	}
+	data.DisplayBody = formatted
+	switch len(errs) {
+	case 0:
+		return nil, ""
+	case 1:
+		return errs, fmt.Sprintf("the GraphQL response has an error: %s", errs[0])
+	default:
+		return errs, fmt.Sprintf("the GraphQL response has %d errors, the first: %s", len(errs), errs[0])
+	}
+}
@@ -0,0 +1,65 @@
+package report
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// grepBody returns the lines of body matching re, with contextLines lines of
+// context around each match, in the style of grep -n: matching lines are
+// numbered with a colon, context lines with a dash and non-adjacent groups
+// are separated by "--". It also returns a summary of how many lines matched.
+func grepBody(body string, re *regexp.Regexp, contextLines int) (string, string) {
+	lines := strings.Split(body, "\n")
+	width := len(strconv.Itoa(len(lines)))
+
+	show := make([]bool, len(lines))
+	matched := make([]bool, len(lines))
+	matches := 0
+	for i, line := range lines {
+		if !re.MatchString(line) {
+			continue
+		}
+		matches++
+		matched[i] = true
+		for j := i - contextLines; j <= i+contextLines; j++ {
+			if j >= 0 && j < len(lines) {
+				show[j] = true
+			}
+		}
+	}
+
+	out := []string{}
+	last := -1
+	for i, line := range lines {
+		if !show[i] {
+			continue
+		}
+		if last >= 0 && i > last+1 {
+			out = append(out, "--")
+		}
+		separator := "-"
+		if matched[i] {
+			separator = ":"
+		}
+		out = append(out, fmt.Sprintf("%*d%s %s", width, i+1, separator, line))
+		last = i
+	}
+
+	summary := fmt.Sprintf("/%s/ matched %d of %d lines", re, matches, len(lines))
+	return strings.Join(out, "\n"), summary
+}
+
+// numberLines prefixes every line of body with its line number.
+func numberLines(body string) string {
+	lines := strings.Split(body, "\n")
+	width := len(strconv.Itoa(len(lines)))
+
+	for i, line := range lines {
+		lines[i] = fmt.Sprintf("%*d: %s", width, i+1, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,72 @@
+package report
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Orders the response headers of the text report can be shown in.
+const (
+	HeaderOrderName = "name" // Alphabetically by name
+	HeaderOrderSize = "size" // Largest first, by the length of the name and value
+)
+
+// ParseHeaderOrder checks that order is one of the HeaderOrder constants,
+// returning the default of HeaderOrderName if it is empty.
+func ParseHeaderOrder(order string) (string, error) {
+	switch strings.ToLower(order) {
+	case "", HeaderOrderName:
+		return HeaderOrderName, nil
+	case HeaderOrderSize:
+		return HeaderOrderSize, nil
+	}
+	return "", fmt.Errorf("unknown header order %q, expected %s or %s", order, HeaderOrderName, HeaderOrderSize)
+}
+
+// headerLine is a header as shown in the text report, with its values joined.
+type headerLine struct {
+	Name   string
+	Value  string
+	Custom bool // Whether it is an X- header, rather than a standard one
+	First  bool // Whether it is the first of the custom headers, when grouped
+}
+
+// orderHeaders returns the lines of header in order, with the custom X-
+// headers after the standard ones if group is set, so large sets of headers
+// are easier to scan.
+func orderHeaders(header http.Header, order string, group bool) []headerLine {
+	lines := make([]headerLine, 0, len(header))
+	for name, values := range header {
+		lines = append(lines, headerLine{
+			Name:   name,
+			Value:  strings.Join(values, ""),
+			Custom: strings.HasPrefix(strings.ToLower(name), "x-"),
+		})
+	}
+
+	sort.Slice(lines, func(i, j int) bool {
+		a, b := lines[i], lines[j]
+		if group && a.Custom != b.Custom {
+			return !a.Custom
+		}
+		if order == HeaderOrderSize {
+			sizeA, sizeB := len(a.Name)+len(a.Value), len(b.Name)+len(b.Value)
+			if sizeA != sizeB {
+				return sizeA > sizeB
+			}
+		}
+		return a.Name < b.Name
+	})
+
+	if group {
+		for i := range lines {
+			if lines[i].Custom {
+				lines[i].First = true
+				break
+			}
+		}
+	}
+	return lines
+}
@@ -0,0 +1,28 @@
+package report
+
+import (
+	"encoding/hex"
+	"strings"
+)
+
+// maxHexDump is how much of a binary body is shown in a hex dump, enough to
+// recognize its format without filling the terminal.
+const maxHexDump = 256
+
+// hexDump is the start of a body shown as hex and ASCII, as hexdump -C does.
+type hexDump struct {
+	Lines   string
+	Omitted int64 // Bytes of the body after those shown
+}
+
+// dumpBody returns a hex dump of the first limit bytes of body, or of all of
+// it if limit is negative, size being the full size of the body.
+func dumpBody(body string, size int64, limit int) *hexDump {
+	if limit >= 0 && len(body) > limit {
+		body = body[:limit]
+	}
+	return &hexDump{
+		Lines:   strings.TrimSuffix(hex.Dump([]byte(body)), "\n"),
+		Omitted: size - int64(len(body)),
+	}
+}
@@ -0,0 +1,179 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"time"
+)
+
+var htmlTmpl = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>http-trace {{ .Request.Method }} {{ .Request.URL }}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.3em; word-break: break-all; }
+h2 { font-size: 1.1em; margin-top: 2em; }
+pre { background: #f6f8fa; padding: 1em; overflow-x: auto; }
+table { border-collapse: collapse; }
+td, th { padding: 0.2em 0.8em; text-align: left; }
+td.duration { text-align: right; font-family: monospace; }
+.status-2 { color: #1a7f37; } .status-3 { color: #0969da; } .status-4 { color: #9a6700; } .status-5 { color: #cf222e; }
+.warning { color: #9a6700; }
+.waterfall td.chart { width: 60vw; position: relative; }
+.bar { position: relative; height: 1.2em; min-width: 1px; border-radius: 2px; }
+.bar-dns { background: #54aeff; } .bar-connect { background: #f0883e; } .bar-tls { background: #a475f9; }
+.bar-request_write { background: #6e7781; } .bar-response_delay { background: #2da44e; } .bar-response_read { background: #0969da; }
+.waterfall tr:hover, .waterfall tr.selected { background: #eaeef2; }
+.waterfall tr { cursor: pointer; }
+#detail { font-family: monospace; min-height: 1.2em; }
+</style>
+</head>
+<body>
+<h1>{{ .Request.Method }} {{ .Request.URL }}</h1>
+<p class="status-{{ statusClass .Response.StatusCode }}">{{ .Response.Proto }} {{ .Response.Status }}</p>
+{{- range .Warnings }}
+<p class="warning">Warning: {{ . }}</p>
+{{- end }}
+
+<h2>Waterfall</h2>
+<table class="waterfall">
+{{- range .Waterfall }}
+<tr data-detail="{{ .Name }}: starts at {{ millis .Start }}, takes {{ millis .Duration }}">
+<td>{{ .Name }}</td>
+<td class="chart"><div class="bar bar-{{ .Name }}" style="left: {{ percent .Left }}%; width: {{ percent .Width }}%" title="{{ .Name }} {{ millis .Duration }}"></div></td>
+<td class="duration">{{ millis .Duration }}</td>
+</tr>
+{{- end }}
+<tr data-detail="total: {{ millis .Timings.TotalRequestDuration }}">
+<th>total</th><td></td><td class="duration">{{ millis .Timings.TotalRequestDuration }}</td>
+</tr>
+</table>
+<p id="detail"></p>
+{{- if .Derived }}
+
+<h2>Derived</h2>
+<table>
+{{- range .Derived }}
+<tr><td>{{ .Name }}</td><td class="duration">{{ millis .Duration }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- if .Events }}
+
+<h2>Events</h2>
+<table>
+{{- range .Events }}
+<tr><td class="duration">{{ millis .Offset }}</td><td>{{ .Name }}</td><td>{{ .Detail }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+
+<h2>Request</h2>
+<pre>{{ .Request.Method }} {{ .Request.URL.RequestURI }} {{ .Request.Proto }}
+Host: {{ .Request.URL.Host }}
+{{- range $key, $value := .Request.Header }}
+{{ $key }}: {{ stringsJoin $value "" }}
+{{- end }}</pre>
+
+<h2>Response</h2>
+<pre>{{ .Response.Proto }} {{ .Response.Status }}
+{{- if .Presentation.Sections.Shows "headers" }}
+{{- range $key, $value := .Response.Header }}
+{{ $key }}: {{ stringsJoin $value "" }}
+{{- end }}
+{{- end }}</pre>
+{{- if .Presentation.Sections.Shows "body" }}
+{{- if .HexDump }}
+<p>{{ if .BodySniff.Binary }}Binary body{{ else }}Body{{ end }}: {{ .ResponseBodySize }} bytes, sniffed as {{ .BodySniff.Sniffed }}</p>
+<pre>{{ .HexDump.Lines }}</pre>
+{{- if gt .HexDump.Omitted 0 }}
+<p>{{ .HexDump.Omitted }} bytes not shown</p>
+{{- end }}
+{{- else }}
+<pre>{{ .DisplayBody }}</pre>
+{{- with .DecodedFrom }}
+<p>Body decoded from {{ . }}</p>
+{{- end }}
+{{- if gt .ResponseBodyTruncated 0 }}
+<p>{{ .ResponseBodyTruncated }} bytes truncated</p>
+{{- end }}
+{{- end }}
+{{- end }}
+
+<script>
+document.querySelectorAll(".waterfall tr").forEach(function (row) {
+  row.addEventListener("click", function () {
+    document.querySelectorAll(".waterfall tr.selected").forEach(function (r) { r.classList.remove("selected"); });
+    row.classList.add("selected");
+    document.getElementById("detail").textContent = row.dataset.detail;
+  });
+});
+</script>
+</body>
+</html>
+`
+
+var htmlFuncs = template.FuncMap{
+	"percent": func(value float64) string {
+		return fmt.Sprintf("%.3f", value)
+	},
+	"statusClass": func(code int) int {
+		return code / 100
+	},
+	"stringsJoin": tmplFuncs["stringsJoin"],
+}
+
+// waterfallBar is a phase of the request drawn as a bar starting where the
+// previous phase ended, with its position and length as a percentage of the
+// total duration.
+type waterfallBar struct {
+	Name     string
+	Start    time.Duration
+	Duration time.Duration
+	Left     float64
+	Width    float64
+}
+
+// htmlData is the report data along with the waterfall drawn from it.
+type htmlData struct {
+	*reportData
+	Waterfall []waterfallBar
+}
+
+// waterfall lays the phases which make up the total duration of the request
+// out one after another.
+func waterfall(data *reportData) []waterfallBar {
+	durations := map[string]time.Duration{}
+	for _, p := range phases {
+		durations[p.Name] = p.Duration(data.Timings)
+	}
+	total := data.Timings.TotalRequestDuration
+
+	bars := []waterfallBar{}
+	var start time.Duration
+	for _, name := range breakdownPhases {
+		bar := waterfallBar{Name: name, Start: start, Duration: durations[name]}
+		if total > 0 {
+			bar.Left = float64(start) / float64(total) * 100
+			bar.Width = float64(bar.Duration) / float64(total) * 100
+		}
+		bars = append(bars, bar)
+		start += bar.Duration
+	}
+	return bars
+}
+
+// buildHTML writes a standalone HTML page with the request and response and a
+// waterfall of the timings, for sharing outside a terminal.
+func (r *Report) buildHTML(b *bytes.Buffer) error {
+	tmpl := template.Must(template.New("html").Funcs(htmlFuncs).Funcs(template.FuncMap{
+		"millis": r.data.Presentation.TimeFormat.Duration,
+	}).Parse(htmlTmpl))
+	return tmpl.Execute(b, &htmlData{
+		reportData: r.data,
+		Waterfall:  waterfall(r.data),
+	})
+}
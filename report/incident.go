@@ -0,0 +1,23 @@
+package report
+
+import "time"
+
+// States of an Incident, each notified once: when it is opened by a failure,
+// updated while failures continue, and resolved by a success.
+const (
+	IncidentOpen    = "open"
+	IncidentUpdate  = "update"
+	IncidentResolve = "resolve"
+)
+
+// Incident is a run of consecutive failures of the same kind of a request,
+// in the Result notified when the state of the incident changes. Duration is
+// in seconds since it was opened.
+type Incident struct {
+	ID       int       `json:"id"`
+	State    string    `json:"state"`
+	Kind     string    `json:"kind"`
+	Opened   time.Time `json:"opened"`
+	Failures int       `json:"failures"`
+	Duration float64   `json:"duration"`
+}
@@ -0,0 +1,247 @@
+package report
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// Result is a machine readable summary of a traced request. Durations are in
+// seconds.
+type Result struct {
+	URL             string             `json:"url"`
+	UnicodeHost     string             `json:"unicode_host,omitempty"`
+	Method          string             `json:"method"`
+	Error           string             `json:"error,omitempty"`
+	Status          int                `json:"status,omitempty"`
+	Proto           string             `json:"proto,omitempty"`
+	ResponseHeaders http.Header        `json:"response_headers,omitempty"`
+	Trailers        http.Header        `json:"trailers,omitempty"`
+	Body            string             `json:"body,omitempty"`
+	BodyEncoding    string             `json:"body_encoding,omitempty"`
+	BodyCharset     string             `json:"body_charset,omitempty"`
+	BodyTruncated   int64              `json:"body_truncated,omitempty"`
+	BodySHA256      string             `json:"body_sha256,omitempty"`
+	BodyPolicy      string             `json:"body_policy,omitempty"`
+	BodySize        int64              `json:"body_size"`
+	BodySkipped     bool               `json:"body_skipped,omitempty"`
+	GraphQLErrors   []string           `json:"graphql_errors,omitempty"`
+	Range           *RangeResult       `json:"range,omitempty"`
+	Chunks          *Chunks            `json:"chunks,omitempty"`
+	Progress        []Status           `json:"progress,omitempty"`
+	LongPoll        *LongPoll          `json:"long_poll,omitempty"`
+	Framing         *Framing           `json:"framing,omitempty"`
+	Stall           *Stall             `json:"stall,omitempty"`
+	CDN             *CDN               `json:"cdn,omitempty"`
+	Reused          bool               `json:"reused_connection,omitempty"`
+	IdleTime        float64            `json:"idle_time,omitempty"`
+	LocalAddr       string             `json:"local_addr,omitempty"`
+	Wire            *Wire              `json:"wire,omitempty"`
+	TCP             *TCP               `json:"tcp,omitempty"`
+	Revocation      *Revocation        `json:"revocation,omitempty"`
+	DNSQueries      []DNSQuery         `json:"dns_queries,omitempty"`
+	DNSBreakdown    *DNSBreakdown      `json:"dns_breakdown,omitempty"`
+	DialAttempts    []DialAttempt      `json:"dial_attempts,omitempty"`
+	Timings         map[string]float64 `json:"timings,omitempty"`
+	Derived         map[string]float64 `json:"derived,omitempty"`
+	Assertions      []Assertion        `json:"assertions,omitempty"`
+	Security        []SecurityCheck    `json:"security,omitempty"`
+	Warnings        []string           `json:"warnings,omitempty"`
+	Events          []Event            `json:"events,omitempty"`
+	Mirror          *Result            `json:"mirror,omitempty"`
+	Divergences     []string           `json:"divergences,omitempty"`
+	PipedTo         *Result            `json:"piped_to,omitempty"`
+	Incident        *Incident          `json:"incident,omitempty"`
+}
+
+// Event is an httptrace callback made while sending the request, with its
+// offset from the start of the request in seconds.
+type Event struct {
+	Name   string  `json:"name"`
+	Offset float64 `json:"offset"`
+	Detail string  `json:"detail,omitempty"`
+}
+
+// Encodings of the body of a Result.
+const (
+	BodyEncodingUTF8   = "utf-8"  // The body as text
+	BodyEncodingBase64 = "base64" // The bytes of a binary body, base64 encoded
+)
+
+// encodeBody returns at most limit bytes of the body for a Result, or all of
+// it if limit is negative, with its encoding and how many bytes were left
+// out. A binary body, or one which isn't valid UTF-8, is base64 encoded as it
+// was received, so it is kept intact rather than becoming an invalid or
+// mangled JSON string.
+func encodeBody(data *reportData, limit int64) (string, string, int64) {
+	if data.BodySniff.Binary || !utf8.ValidString(data.DisplayBody) {
+		raw := data.ResponseBody
+		if limit >= 0 && int64(len(raw)) > limit {
+			raw = raw[:limit]
+		}
+		return base64.StdEncoding.EncodeToString([]byte(raw)), BodyEncodingBase64, int64(len(data.ResponseBody) - len(raw))
+	}
+
+	text := truncateText(data.DisplayBody, limit)
+	return text, BodyEncodingUTF8, int64(len(data.DisplayBody) - len(text))
+}
+
+// Result summarises the report. The report must have been built.
+func (r *Report) Result() *Result {
+	res := &Result{
+		URL:         r.data.Request.URL.String(),
+		UnicodeHost: r.data.UnicodeHost,
+		Method:      r.data.Request.Method,
+		Status:      r.data.Response.StatusCode,
+		Proto:       r.data.Response.Proto,
+		BodySize:    r.data.ResponseBodySize,
+		BodySkipped: r.data.BodySkipped,
+		Range:       r.data.Range,
+		Reused:      r.data.ConnectionReused,
+		IdleTime:    r.data.ConnectionIdle.Seconds(),
+		LocalAddr:   r.data.LocalAddr,
+		Timings:     map[string]float64{},
+		Warnings:    r.data.Warnings,
+	}
+
+	if r.data.Presentation.Sections.Shows(SectionHeaders) {
+		res.ResponseHeaders = r.data.Response.Header
+		res.Trailers = r.data.Trailers
+	}
+	if r.data.Presentation.Sections.Shows(SectionTrace) && len(r.data.Statuses) > 0 {
+		res.Progress = statusResults(r.data.Statuses)
+	}
+	if r.data.LongPoll != nil {
+		res.LongPoll = r.data.LongPoll.result()
+	}
+	res.GraphQLErrors = r.data.GraphQLErrors
+	if r.data.Stall != nil {
+		res.Stall = stallResult(r.data.Stall)
+	}
+	if r.data.Framing != nil {
+		res.Framing = r.data.Framing.result()
+	}
+	if r.data.CDN != nil {
+		res.CDN = r.data.CDN.result()
+	}
+	if r.data.Presentation.Sections.Shows(SectionChunks) && r.data.Chunks != nil {
+		res.Chunks = r.data.Chunks.result()
+	}
+	if r.data.Presentation.Sections.Shows(SectionBody) && r.data.ResponseBody != "" {
+		var removed int64
+		res.Body, res.BodyEncoding, removed = encodeBody(r.data, r.data.Presentation.KeepBody.bodyLimit())
+		res.BodyTruncated = r.data.ResponseBodyTruncated + removed
+		if res.BodyEncoding == BodyEncodingUTF8 {
+			res.BodyCharset = r.data.DecodedFrom
+		}
+	}
+	applyBodyPolicy(res, r.data.Presentation.KeepBody, r.data.BodySHA256)
+
+	for _, p := range phases {
+		res.Timings[p.Name] = p.Duration(r.data.Timings).Seconds()
+	}
+	if r.data.Presentation.Sections.Shows(SectionTrace) {
+		res.Wire = wireResult(r.data.Wire)
+	}
+	if len(r.data.Trailers) > 0 {
+		res.Timings[trailerTiming] = r.data.Timings.TrailerDuration.Seconds()
+	}
+	if r.data.ContinueApproved {
+		res.Timings[continueTiming] = r.data.Timings.ContinueDuration.Seconds()
+	}
+
+	if len(r.data.Derived) > 0 {
+		res.Derived = map[string]float64{}
+		for _, d := range r.data.Derived {
+			res.Derived[d.Name] = d.Duration.Seconds()
+		}
+	}
+	for _, a := range r.data.Assertions {
+		res.Assertions = append(res.Assertions, a.result())
+	}
+	res.Security = r.data.Security
+
+	if r.data.Presentation.Sections.Shows(SectionConnection) {
+		res.TCP = tcpResult(r.data.TCP)
+		if r.data.Revocation != nil {
+			res.Revocation = r.data.Revocation.result()
+		}
+		for _, q := range r.data.DNSQueries {
+			res.DNSQueries = append(res.DNSQueries, q.result())
+		}
+		if r.data.DNSBreakdown != nil {
+			res.DNSBreakdown = r.data.DNSBreakdown.result()
+		}
+		for _, d := range r.data.Dials {
+			res.DialAttempts = append(res.DialAttempts, d.result())
+		}
+	}
+
+	for _, e := range r.data.Events {
+		res.Events = append(res.Events, Event{Name: e.Name, Offset: e.Offset.Seconds(), Detail: e.Detail})
+	}
+
+	if r.data.Mirror != nil {
+		if r.mirrorErr != nil {
+			res.Mirror = ErrorResult(r.mirror.data.Request, r.mirrorErr)
+		} else {
+			res.Mirror = r.mirror.Result()
+		}
+		res.Divergences = r.data.Mirror.Divergences
+	}
+
+	if r.pipe != nil {
+		if r.pipeErr != nil {
+			res.PipedTo = ErrorResult(r.pipe.data.Request, r.pipeErr)
+		} else {
+			res.PipedTo = r.pipe.Result()
+		}
+	}
+
+	return res
+}
+
+// ErrorResult summarises a request which failed before a response was
+// received.
+func ErrorResult(req *http.Request, err error) *Result {
+	return &Result{
+		URL:    req.URL.String(),
+		Method: req.Method,
+		Error:  err.Error(),
+	}
+}
+
+// Summary describes the result in two lines: the request and its status, and
+// the duration of each phase in format, for showing alongside something else
+// such as the body.
+func (r *Result) Summary(format TimeFormat) string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "%s %s", r.Method, r.URL)
+	if r.Error != "" {
+		fmt.Fprintf(b, "\n! Error: %s\n", r.Error)
+		return b.String()
+	}
+
+	fmt.Fprintf(b, " %s %d, %d bytes\n", r.Proto, r.Status, r.BodySize)
+	parts := []string{}
+	for _, p := range append(append([]string{}, breakdownPhases...), "total") {
+		parts = append(parts, fmt.Sprintf("%s %s", p, format.seconds(r.Timings[p])))
+	}
+	b.WriteString(strings.Join(parts, "  ") + "\n")
+	return b.String()
+}
+
+// WriteJSONLine writes result as JSON on a single line, for JSON Lines output.
+func WriteJSONLine(w io.Writer, result *Result) error {
+	return json.NewEncoder(w).Encode(result)
+}
+
+func writeJSON(w io.Writer, result *Result) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(result)
+}
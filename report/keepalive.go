@@ -0,0 +1,73 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/berndhartzer/http-trace/stats"
+)
+
+// WriteKeepAlive writes the timings of requests sent one after another on one
+// persistent connection: those of the first, cold, request which set it up
+// against the median of the warm requests which reused it, and how much of the
+// cold request setting up the connection took. Later requests which had to
+// set up a new connection, as the server closed the one before, are listed.
+func WriteKeepAlive(w io.Writer, results []*Result, pres *Presentation) error {
+	format := pres.timeFormat()
+	width := format.Width()
+	out := &bytes.Buffer{}
+	fmt.Fprintf(out, "Keep-alive (%d requests)\n", len(results))
+	if len(results) == 0 || results[0].Error != "" {
+		fmt.Fprintln(out, "The first request failed, so there is no cold request to compare")
+		_, err := w.Write(out.Bytes())
+		return err
+	}
+
+	cold := results[0]
+	warm := []*Result{}
+	newConns := []string{}
+	for i, r := range results[1:] {
+		switch {
+		case r.Error != "":
+		case r.Reused:
+			warm = append(warm, r)
+		default:
+			newConns = append(newConns, fmt.Sprintf("#%d", i+2))
+		}
+	}
+	if len(warm) == 0 {
+		fmt.Fprintln(out, "No request reused the connection, so there are no warm requests to compare")
+		_, err := w.Write(out.Bytes())
+		return err
+	}
+
+	fmt.Fprintf(out, "  %-21s%*s %*s %*s\n", "", width, "cold", width, "warm", width, "diff")
+	fmt.Fprintf(out, "  %-21s%*d %*d\n", "requests:", width, 1, width, len(warm))
+	for _, p := range phases {
+		warmMedian := stats.Median(successfulTimings(warm, p.Name))
+		fmt.Fprintf(out, "  %-21s%*s %*s %*s\n", p.Name+":", width, format.seconds(cold.Timings[p.Name]), width, format.seconds(warmMedian), width, format.signedSeconds(warmMedian-cold.Timings[p.Name]))
+	}
+
+	fmt.Fprintln(out)
+	coldTotal, warmTotal := cold.Timings["total"], stats.Median(successfulTimings(warm, "total"))
+	if coldTotal > 0 {
+		fmt.Fprintf(out, "Setting up the connection took %s, %.1f%% of the cold request\n", format.seconds(cold.Timings["connection"]), cold.Timings["connection"]/coldTotal*100)
+		change := "faster"
+		if warmTotal > coldTotal {
+			change = "slower"
+		}
+		diff := coldTotal - warmTotal
+		if diff < 0 {
+			diff = -diff
+		}
+		fmt.Fprintf(out, "Warm requests were %s (%.1f%%) %s than the cold one in total (median)\n", format.seconds(diff), diff/coldTotal*100, change)
+	}
+	if len(newConns) > 0 {
+		fmt.Fprintf(out, "! requests which set up a new connection instead of reusing it, as the server closed it: %s\n", strings.Join(newConns, ", "))
+	}
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
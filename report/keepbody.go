@@ -0,0 +1,90 @@
+package report
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Policies for what the structured outputs keep of the response body.
+const (
+	KeepBodyFull      = "full"      // The body as it was captured
+	KeepBodyTruncated = "truncated" // At most the first Limit bytes of the body
+	KeepBodyHash      = "hash-only" // Only the SHA-256 of the body
+	KeepBodyNone      = "none"      // Nothing of the body
+)
+
+// BodyPolicy is what the structured outputs, such as JSON and the sinks, keep
+// of the response body, to balance forensic completeness against the size of
+// the logs of long running monitoring. The text report is not affected. The
+// zero BodyPolicy keeps the body without recording a policy.
+type BodyPolicy struct {
+	Mode  string // One of the KeepBody constants
+	Limit int64  // Bytes kept with KeepBodyTruncated
+}
+
+// ParseBodyPolicy parses a policy such as full, truncated:1024, hash-only or
+// none.
+func ParseBodyPolicy(spec string) (BodyPolicy, error) {
+	split := strings.SplitN(spec, ":", 2)
+	mode := strings.ToLower(split[0])
+	switch {
+	case mode == KeepBodyTruncated && len(split) == 2:
+		limit, err := strconv.ParseInt(split[1], 10, 64)
+		if err != nil || limit < 0 {
+			return BodyPolicy{}, fmt.Errorf("invalid body policy %q, expected a number of bytes after truncated:", spec)
+		}
+		return BodyPolicy{Mode: mode, Limit: limit}, nil
+	case len(split) == 1 && (mode == KeepBodyFull || mode == KeepBodyHash || mode == KeepBodyNone):
+		return BodyPolicy{Mode: mode}, nil
+	}
+	return BodyPolicy{}, fmt.Errorf("unknown body policy %q, expected full, truncated:N, hash-only or none", spec)
+}
+
+func (p BodyPolicy) String() string {
+	if p.Mode == KeepBodyTruncated {
+		return fmt.Sprintf("%s:%d", p.Mode, p.Limit)
+	}
+	return p.Mode
+}
+
+// bodyLimit returns how many bytes of the body policy keeps, or -1 for all
+// of them.
+func (p BodyPolicy) bodyLimit() int64 {
+	if p.Mode == KeepBodyTruncated {
+		return p.Limit
+	}
+	return -1
+}
+
+// applyBodyPolicy records policy in res, and removes the body from it unless
+// the policy keeps it, with sha256 the hash of the whole body for
+// KeepBodyHash.
+func applyBodyPolicy(res *Result, policy BodyPolicy, sha256 string) {
+	if policy.Mode == "" {
+		return
+	}
+	res.BodyPolicy = policy.String()
+
+	switch policy.Mode {
+	case KeepBodyHash:
+		res.Body, res.BodyEncoding, res.BodyTruncated = "", "", 0
+		res.BodySHA256 = sha256
+	case KeepBodyNone:
+		res.Body, res.BodyEncoding, res.BodyTruncated = "", "", 0
+	}
+}
+
+// truncateText cuts s to at most limit bytes at the start of a character, so
+// it stays valid UTF-8.
+func truncateText(s string, limit int64) string {
+	if limit < 0 || int64(len(s)) <= limit {
+		return s
+	}
+	cut := int(limit)
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut]
+}
@@ -0,0 +1,65 @@
+package report
+
+import (
+	"time"
+
+	"github.com/berndhartzer/http-trace/stats"
+	"github.com/berndhartzer/http-trace/trace"
+)
+
+// longPollInfo is how a response held open by the server was received.
+type longPollInfo struct {
+	FirstByte  time.Duration // From the start of the request
+	Hold       time.Duration // From the first byte to the end of the response
+	HeldOpen   bool          // Until the request timed out, rather than being ended by the server
+	Reads      int
+	MedianGap  time.Duration // Between reads of the body, such as keep-alive bytes
+	LargestGap time.Duration
+}
+
+// LongPoll is how a held open response was received, in a Result. Durations
+// are in seconds.
+type LongPoll struct {
+	FirstByte  float64 `json:"first_byte"`
+	Hold       float64 `json:"hold"`
+	HeldOpen   bool    `json:"held_open_until_timeout"`
+	Reads      int     `json:"reads"`
+	MedianGap  float64 `json:"median_gap"`
+	LargestGap float64 `json:"largest_gap"`
+}
+
+// measureLongPoll returns how a long poll was received, or nil if it wasn't
+// one.
+func measureLongPoll(lp *trace.LongPoll, t *trace.Timings) *longPollInfo {
+	if lp == nil {
+		return nil
+	}
+
+	info := &longPollInfo{
+		FirstByte: t.TotalConnectionDuration + t.RequestWriteDuration + t.ResponseDelayDuration,
+		Hold:      t.ResponseReadDuration,
+		HeldOpen:  lp.HeldOpen,
+		Reads:     len(lp.Reads),
+	}
+	gaps := []float64{}
+	for i := 1; i < len(lp.Reads); i++ {
+		gap := lp.Reads[i].Offset - lp.Reads[i-1].Offset
+		gaps = append(gaps, gap.Seconds())
+		if gap > info.LargestGap {
+			info.LargestGap = gap
+		}
+	}
+	info.MedianGap = time.Duration(stats.Median(gaps) * float64(time.Second))
+	return info
+}
+
+func (l *longPollInfo) result() *LongPoll {
+	return &LongPoll{
+		FirstByte:  l.FirstByte.Seconds(),
+		Hold:       l.Hold.Seconds(),
+		HeldOpen:   l.HeldOpen,
+		Reads:      l.Reads,
+		MedianGap:  l.MedianGap.Seconds(),
+		LargestGap: l.LargestGap.Seconds(),
+	}
+}
@@ -0,0 +1,80 @@
+package report
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// mirrorComparison compares a response with the response to the same request
+// sent to a mirror target.
+type mirrorComparison struct {
+	URL         string
+	Status      string
+	Phases      []phaseComparison
+	Divergences []string
+}
+
+// phaseComparison is the duration of a phase for the primary and the mirror
+// request.
+type phaseComparison struct {
+	Name    string
+	Primary time.Duration
+	Mirror  time.Duration
+}
+
+// Diff is how much slower the mirror was than the primary.
+func (p phaseComparison) Diff() time.Duration {
+	return p.Mirror - p.Primary
+}
+
+// SetMirror compares the report with a report for the same request sent to a
+// mirror target.
+func (r *Report) SetMirror(mirror *Report) {
+	r.mirror = mirror
+	r.mirrorErr = nil
+}
+
+// SetMirrorError records that the request sent to a mirror target failed.
+func (r *Report) SetMirrorError(req *http.Request, err error) {
+	redact := r.data.Presentation.Redactor
+	r.mirror = &Report{data: &reportData{Request: redact.request(req)}}
+	r.mirrorErr = redact.Error(err)
+}
+
+// compareMirror lists the differences between the primary and mirror
+// responses, and puts their timings side by side.
+func compareMirror(primary, mirror *reportData, mirrorErr error) *mirrorComparison {
+	c := &mirrorComparison{
+		URL: mirror.Request.URL.String(),
+	}
+	if mirrorErr != nil {
+		c.Divergences = append(c.Divergences, fmt.Sprintf("mirror request failed: %v", mirrorErr))
+		return c
+	}
+
+	c.Status = mirror.Response.Status
+	if primary.Response.StatusCode != mirror.Response.StatusCode {
+		c.Divergences = append(c.Divergences, fmt.Sprintf("status %d != %d", primary.Response.StatusCode, mirror.Response.StatusCode))
+	}
+	for _, h := range []string{"Content-Type", "Content-Encoding"} {
+		if primary.Response.Header.Get(h) != mirror.Response.Header.Get(h) {
+			c.Divergences = append(c.Divergences, fmt.Sprintf("%s %q != %q", h, primary.Response.Header.Get(h), mirror.Response.Header.Get(h)))
+		}
+	}
+	if primary.ResponseBodySize != mirror.ResponseBodySize {
+		c.Divergences = append(c.Divergences, fmt.Sprintf("body size %d != %d bytes", primary.ResponseBodySize, mirror.ResponseBodySize))
+	} else if primary.ResponseBody != mirror.ResponseBody {
+		c.Divergences = append(c.Divergences, "body content differs")
+	}
+
+	for _, p := range phases {
+		c.Phases = append(c.Phases, phaseComparison{
+			Name:    p.Name,
+			Primary: p.Duration(primary.Timings),
+			Mirror:  p.Duration(mirror.Timings),
+		})
+	}
+
+	return c
+}
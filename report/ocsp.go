@@ -0,0 +1,193 @@
+package report
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"time"
+
+	"github.com/berndhartzer/http-trace/ocsp"
+)
+
+// Ways the revocation of the certificate of the server is checked.
+const (
+	RevocationOCSP = "ocsp" // With the OCSP responder of the certificate
+	RevocationCRL  = "crl"  // In the certificate revocation list of the issuer
+)
+
+// RevocationCheck is a check, made separately from the request, of whether
+// the certificate of the server was revoked.
+type RevocationCheck struct {
+	Method   string // One of the Revocation constants
+	URL      string
+	Status   string // One of the ocsp statuses
+	Duration time.Duration
+	Err      error
+}
+
+// Revocation is the OCSP staple of the TLS handshake and any check of the
+// certificate, in a Result. Times are RFC 3339 and the duration in seconds.
+type Revocation struct {
+	Stapled    bool         `json:"stapled"`
+	Staple     *OCSPStaple  `json:"staple,omitempty"`
+	StapleErr  string       `json:"staple_error,omitempty"`
+	Check      *CheckResult `json:"check,omitempty"`
+	MustStaple bool         `json:"must_staple,omitempty"`
+}
+
+// OCSPStaple is the status of the certificate stapled to the TLS handshake.
+type OCSPStaple struct {
+	Status     string `json:"status"`
+	ProducedAt string `json:"produced_at"`
+	ThisUpdate string `json:"this_update"`
+	NextUpdate string `json:"next_update,omitempty"`
+	RevokedAt  string `json:"revoked_at,omitempty"`
+}
+
+// CheckResult is a RevocationCheck in a Result.
+type CheckResult struct {
+	Method   string  `json:"method"`
+	URL      string  `json:"url"`
+	Status   string  `json:"status,omitempty"`
+	Duration float64 `json:"duration"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// oidMustStaple is the TLS feature extension of a certificate requiring an
+// OCSP staple (RFC 7633).
+var oidMustStaple = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+
+// revocationInfo is the OCSP staple and revocation check as shown in the
+// report.
+type revocationInfo struct {
+	Stapled      bool
+	Staple       *ocsp.Response
+	StapleErr    error
+	Check        *RevocationCheck
+	MustStaple   bool
+	StapleLine   string // The staple as shown
+	CheckLabel   string // Such as "OCSP check:"
+	CheckOutcome string // The result of Check as shown
+}
+
+// checkRevocation parses the OCSP staple of a TLS response, returning nil if
+// there is nothing to show, with warnings for a missing, stale or revoked
+// staple or certificate. A missing staple is only warned about if check was
+// made, or the certificate requires one.
+func checkRevocation(data *reportData, check *RevocationCheck, now time.Time) (*revocationInfo, []string) {
+	state := data.Response.TLS
+	if state == nil {
+		return nil, nil
+	}
+
+	info := &revocationInfo{Stapled: len(state.OCSPResponse) > 0, Check: check}
+	var leaf *x509.Certificate
+	if len(state.PeerCertificates) > 0 {
+		leaf = state.PeerCertificates[0]
+		for _, ext := range leaf.Extensions {
+			if ext.Id.Equal(oidMustStaple) {
+				info.MustStaple = true
+			}
+		}
+	}
+
+	warnings := []string{}
+	switch {
+	case info.Stapled:
+		info.Staple, info.StapleErr = ocsp.ParseResponse(state.OCSPResponse)
+		if info.StapleErr != nil {
+			warnings = append(warnings, fmt.Sprintf("the OCSP staple could not be parsed: %v", info.StapleErr))
+			break
+		}
+		warnings = append(warnings, stapleWarnings(info.Staple, leaf, now)...)
+	case info.MustStaple:
+		warnings = append(warnings, "no OCSP staple was sent, though the certificate requires one (OCSP Must-Staple), so clients enforcing it will refuse the connection")
+	case check != nil:
+		warnings = append(warnings, "no OCSP staple was sent, so clients have to check the revocation of the certificate themselves")
+	}
+
+	if check != nil && check.Err == nil && check.Status == ocsp.Revoked {
+		warnings = append(warnings, fmt.Sprintf("the certificate was revoked, according to %s", check.URL))
+	}
+	if !info.Stapled && check == nil {
+		return nil, warnings
+	}
+	info.describe()
+	return info, warnings
+}
+
+// describe sets the lines showing the staple and check.
+func (i *revocationInfo) describe() {
+	switch {
+	case !i.Stapled:
+		i.StapleLine = "none"
+	case i.StapleErr != nil:
+		i.StapleLine = "not parsable"
+	default:
+		i.StapleLine = fmt.Sprintf("%s, valid from %s", i.Staple.Status, formatStapleTime(i.Staple.ThisUpdate))
+		if !i.Staple.NextUpdate.IsZero() {
+			i.StapleLine += " to " + formatStapleTime(i.Staple.NextUpdate)
+		}
+	}
+
+	if c := i.Check; c != nil {
+		i.CheckLabel = "OCSP check:"
+		if c.Method == RevocationCRL {
+			i.CheckLabel = "CRL check:"
+		}
+		i.CheckOutcome = fmt.Sprintf("%s from %s", c.Status, c.URL)
+		if c.Err != nil {
+			i.CheckOutcome = fmt.Sprintf("error: %v", c.Err)
+		}
+	}
+}
+
+// stapleWarnings returns warnings for a staple which is stale, not yet valid,
+// revoked or for another certificate than leaf.
+func stapleWarnings(staple *ocsp.Response, leaf *x509.Certificate, now time.Time) []string {
+	warnings := []string{}
+	switch {
+	case !staple.NextUpdate.IsZero() && now.After(staple.NextUpdate):
+		warnings = append(warnings, fmt.Sprintf("the OCSP staple is stale, it expired %s ago at %s", now.Sub(staple.NextUpdate).Round(time.Second), formatStapleTime(staple.NextUpdate)))
+	case now.Before(staple.ThisUpdate):
+		warnings = append(warnings, fmt.Sprintf("the OCSP staple is not valid until %s", formatStapleTime(staple.ThisUpdate)))
+	}
+	if staple.Status == ocsp.Revoked {
+		warnings = append(warnings, fmt.Sprintf("the OCSP staple says the certificate was revoked at %s", formatStapleTime(staple.RevokedAt)))
+	}
+	if leaf != nil && staple.SerialNumber != nil && staple.SerialNumber.Cmp(leaf.SerialNumber) != 0 {
+		warnings = append(warnings, "the OCSP staple is for another certificate than the one sent")
+	}
+	return warnings
+}
+
+func formatStapleTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04 MST")
+}
+
+func (i *revocationInfo) result() *Revocation {
+	res := &Revocation{Stapled: i.Stapled, MustStaple: i.MustStaple}
+	if i.StapleErr != nil {
+		res.StapleErr = i.StapleErr.Error()
+	}
+	if s := i.Staple; s != nil {
+		res.Staple = &OCSPStaple{
+			Status:     s.Status,
+			ProducedAt: s.ProducedAt.Format(time.RFC3339),
+			ThisUpdate: s.ThisUpdate.Format(time.RFC3339),
+		}
+		if !s.NextUpdate.IsZero() {
+			res.Staple.NextUpdate = s.NextUpdate.Format(time.RFC3339)
+		}
+		if s.Status == ocsp.Revoked {
+			res.Staple.RevokedAt = s.RevokedAt.Format(time.RFC3339)
+		}
+	}
+	if c := i.Check; c != nil {
+		res.Check = &CheckResult{Method: c.Method, URL: c.URL, Status: c.Status, Duration: c.Duration.Seconds()}
+		if c.Err != nil {
+			res.Check.Error = c.Err.Error()
+		}
+	}
+	return res
+}
@@ -0,0 +1,61 @@
+package report
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// RangeResult describes how the server answered a request for part of the
+// body, with a Range header. Throughput is in bytes per second.
+type RangeResult struct {
+	Requested    string  `json:"requested"`
+	Honored      bool    `json:"honored"`
+	ContentRange string  `json:"content_range,omitempty"`
+	Bytes        int64   `json:"bytes"`
+	Throughput   float64 `json:"throughput"`
+}
+
+// checkRange reports on the Range request in data, if there was one, with a
+// warning if the server didn't send the range asked for.
+func checkRange(data *reportData) (*RangeResult, string) {
+	requested := data.Request.Header.Get("Range")
+	if requested == "" || data.Response == nil {
+		return nil, ""
+	}
+
+	c := &RangeResult{
+		Requested:    requested,
+		Honored:      data.Response.StatusCode == http.StatusPartialContent,
+		ContentRange: data.Response.Header.Get("Content-Range"),
+		Bytes:        data.ResponseBodySize,
+	}
+	if read := data.Timings.ResponseReadDuration.Seconds(); read > 0 {
+		c.Throughput = float64(c.Bytes) / read
+	}
+
+	switch {
+	case c.Honored:
+		return c, ""
+	case data.Response.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		return c, fmt.Sprintf("the range %s is not satisfiable, the server has %s", requested, c.ContentRange)
+	case data.Response.StatusCode == http.StatusOK:
+		return c, fmt.Sprintf("the server ignored the range %s and sent the whole body, %d bytes", requested, c.Bytes)
+	}
+	return c, ""
+}
+
+// formatThroughput formats bytes per second with a binary unit prefix.
+func formatThroughput(bytesPerSecond float64) string {
+	return formatBytes(bytesPerSecond) + "/s"
+}
+
+// formatBytes formats a number of bytes with a binary unit prefix.
+func formatBytes(bytes float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB"}
+	i := 0
+	for bytes >= 1024 && i < len(units)-1 {
+		bytes /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.2f %s", bytes, units[i])
+}
@@ -0,0 +1,26 @@
+package report
+
+import (
+	"time"
+
+	"github.com/berndhartzer/http-trace/trace"
+)
+
+// phase is a single duration from trace.Timings, named for use in machine
+// readable output formats.
+type phase struct {
+	Name        string
+	Description string
+	Duration    func(t *trace.Timings) time.Duration
+}
+
+var phases = []phase{
+	{"dns", "DNS lookup duration", func(t *trace.Timings) time.Duration { return t.DNSDuration }},
+	{"connect", "Duration of time it takes to establish connection to destination server, from the first address tried", func(t *trace.Timings) time.Duration { return t.ConnectionDialDuration }},
+	{"tls", "Duration of TLS handshake", func(t *trace.Timings) time.Duration { return t.TLSDuration }},
+	{"connection", "Total connection setup (DNS lookup, Dial up and TLS) duration", func(t *trace.Timings) time.Duration { return t.TotalConnectionDuration }},
+	{"request_write", "Request write duration, from successful connection to completing write", func(t *trace.Timings) time.Duration { return t.RequestWriteDuration }},
+	{"response_delay", "Delay duration between request being written and first byte of response being received", func(t *trace.Timings) time.Duration { return t.ResponseDelayDuration }},
+	{"response_read", "Response read duration, from receiving first byte of response to completing read", func(t *trace.Timings) time.Duration { return t.ResponseReadDuration }},
+	{"total", "Total duration of the request (sending request, receiving and parsing response)", func(t *trace.Timings) time.Duration { return t.TotalRequestDuration }},
+}
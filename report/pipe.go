@@ -0,0 +1,43 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+)
+
+// SetPipe adds the report for a second request which was sent the response
+// body of this one, so the two legs are reported together.
+func (r *Report) SetPipe(next *Report) {
+	r.pipe = next
+	r.pipeErr = nil
+}
+
+// SetPipeError records that the second request, sent the response body of
+// this one, failed.
+func (r *Report) SetPipeError(req *http.Request, err error) {
+	redact := r.data.Presentation.Redactor
+	r.pipe = &Report{data: &reportData{Request: redact.request(req)}}
+	r.pipeErr = redact.Error(err)
+}
+
+// buildPipeText appends the report for the second leg and the combined
+// duration of both legs.
+func (r *Report) buildPipeText(b *bytes.Buffer) error {
+	req := r.pipe.data.Request
+	fmt.Fprintf(b, "\nPiped response body to %s %s\n", req.Method, req.URL)
+	if r.pipeErr != nil {
+		fmt.Fprintf(b, "! Error: %v\n", r.pipeErr)
+		return nil
+	}
+
+	err := r.pipe.buildText(b)
+	if err != nil {
+		return err
+	}
+
+	first, second := r.data.Timings.TotalRequestDuration, r.pipe.data.Timings.TotalRequestDuration
+	format := r.data.Presentation.TimeFormat
+	fmt.Fprintf(b, "\n  %-21s%s (%s + %s)\n", "Combined total:", format.column(format.Duration(first+second)), format.Duration(first), format.Duration(second))
+	return nil
+}
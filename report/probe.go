@@ -0,0 +1,96 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/berndhartzer/http-trace/trace"
+)
+
+// Probe is a probe of a phase of making a connection, made with
+// trace.WithProbe: the timings of the phases up to it and what it found, such
+// as the addresses the host resolved to, or the error it failed with.
+type Probe struct {
+	Timings *trace.Timings
+	Detail  string
+	Err     error
+}
+
+// probePhases are the phases timed by a probe of each phase, and probeNames
+// what each probes.
+var (
+	probePhases = map[string][]string{
+		trace.ProbeDNS:     {"dns"},
+		trace.ProbeConnect: {"dns", "connect", "total"},
+		trace.ProbeTLS:     {"dns", "connect", "tls", "total"},
+	}
+	probeNames = map[string]string{
+		trace.ProbeDNS:     "DNS lookup",
+		trace.ProbeConnect: "TCP handshake",
+		trace.ProbeTLS:     "TLS handshake",
+	}
+)
+
+// WriteProbes writes a line for each probe of phase with the durations of the
+// phases up to it, followed by the minimum, percentiles and maximum of each
+// when there were several.
+func WriteProbes(w io.Writer, phase, target string, probes []Probe, pres *Presentation) error {
+	format := pres.timeFormat()
+	out := &bytes.Buffer{}
+	names := probePhases[phase]
+	if names == nil {
+		return fmt.Errorf("unknown probe phase %q", phase)
+	}
+
+	fmt.Fprintf(out, "%s of %s\n", probeNames[phase], target)
+	fmt.Fprintf(out, "  %4s", "#")
+	for _, name := range names {
+		fmt.Fprintf(out, " %s", format.column(name))
+	}
+	fmt.Fprintln(out)
+
+	timings := map[string][]float64{}
+	failed := 0
+	for i, p := range probes {
+		fmt.Fprintf(out, "  %4d", i+1)
+		if p.Err != nil {
+			failed++
+			fmt.Fprintf(out, "  failed: %v\n", p.Err)
+			continue
+		}
+		for _, name := range names {
+			seconds := phaseDuration(name, p.Timings).Seconds()
+			timings[name] = append(timings[name], seconds)
+			fmt.Fprintf(out, " %s", format.column(format.seconds(seconds)))
+		}
+		if p.Detail != "" {
+			fmt.Fprintf(out, "  %s", p.Detail)
+		}
+		fmt.Fprintln(out)
+	}
+
+	if len(probes)-failed > 1 {
+		fmt.Fprintln(out)
+		writeTimingTable(out, format, names, func(phase string) []float64 {
+			return timings[phase]
+		})
+	}
+	if failed > 0 {
+		fmt.Fprintf(out, "\n%d of %d probes failed\n", failed, len(probes))
+	}
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// phaseDuration returns the duration of the named phase of t.
+func phaseDuration(name string, t *trace.Timings) time.Duration {
+	for _, p := range phases {
+		if p.Name == name {
+			return p.Duration(t)
+		}
+	}
+	return 0
+}
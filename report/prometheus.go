@@ -0,0 +1,75 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const prometheusContentType = "text/plain; version=0.0.4"
+
+// writePrometheus writes the timings in the Prometheus text exposition format,
+// one gauge per phase labelled with the url, method and status.
+func writePrometheus(w io.Writer, data *reportData) error {
+	labels := fmt.Sprintf(
+		`{url="%s",method="%s",status="%d"}`,
+		escapeLabel(data.Request.URL.String()),
+		escapeLabel(data.Request.Method),
+		data.Response.StatusCode,
+	)
+
+	b := &bytes.Buffer{}
+	for _, p := range phases {
+		name := "http_trace_" + p.Name + "_duration_seconds"
+		fmt.Fprintf(b, "# HELP %s %s\n", name, p.Description)
+		fmt.Fprintf(b, "# TYPE %s gauge\n", name)
+		fmt.Fprintf(b, "%s%s %s\n", name, labels, strconv.FormatFloat(p.Duration(data.Timings).Seconds(), 'f', -1, 64))
+	}
+
+	if len(data.Derived) > 0 {
+		fmt.Fprintf(b, "# HELP http_trace_derived_duration_seconds User defined composite metric\n")
+		fmt.Fprintf(b, "# TYPE http_trace_derived_duration_seconds gauge\n")
+		for _, d := range data.Derived {
+			derivedLabels := strings.TrimSuffix(labels, "}") + fmt.Sprintf(`,metric="%s"}`, escapeLabel(d.Name))
+			fmt.Fprintf(b, "http_trace_derived_duration_seconds%s %s\n", derivedLabels, strconv.FormatFloat(d.Duration.Seconds(), 'f', -1, 64))
+		}
+	}
+
+	fmt.Fprintf(b, "# HELP http_trace_response_body_bytes Size of the response body\n")
+	fmt.Fprintf(b, "# TYPE http_trace_response_body_bytes gauge\n")
+	fmt.Fprintf(b, "http_trace_response_body_bytes%s %d\n", labels, data.ResponseBodySize)
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// PushPrometheus sends metrics in the Prometheus text format to a Pushgateway
+// under the given job name, replacing any metrics previously pushed for it.
+func PushPrometheus(client *http.Client, gatewayURL, job string, metrics string) error {
+	url := strings.TrimSuffix(gatewayURL, "/") + "/metrics/job/" + job
+
+	req, err := http.NewRequest(http.MethodPut, url, strings.NewReader(metrics))
+	if err != nil {
+		return fmt.Errorf("error creating pushgateway request: %w", err)
+	}
+	req.Header.Set("Content-Type", prometheusContentType)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error pushing metrics: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("error pushing metrics: pushgateway responded %s", resp.Status)
+	}
+
+	return nil
+}
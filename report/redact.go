@@ -0,0 +1,235 @@
+package report
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces the values of redacted query parameters and headers.
+const Redacted = "REDACTED"
+
+// SecretHeaders are the request and response headers which commonly carry
+// credentials, such as API keys and session cookies.
+var SecretHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Api-Key",
+	"X-Auth-Token",
+	"X-Csrf-Token",
+	"X-Amz-Security-Token",
+}
+
+// Redactor replaces the values of sensitive query parameters, such as the
+// signatures of signed URLs, wherever URLs are shown, and those of sensitive
+// headers, such as credentials, wherever headers are shown. A nil Redactor
+// redacts nothing.
+type Redactor struct {
+	pattern *regexp.Regexp
+	headers map[string]bool
+}
+
+// NewQueryRedactor returns a Redactor for the query parameters named in
+// params, matched regardless of case, or nil if there are none.
+func NewQueryRedactor(params []string) *Redactor {
+	return NewRedactor(params, nil)
+}
+
+// NewRedactor returns a Redactor for the query parameters named in params and
+// the headers named in headers, both matched regardless of case, or nil if
+// there are none.
+func NewRedactor(params, headers []string) *Redactor {
+	names := []string{}
+	for _, p := range params {
+		if p = strings.TrimSpace(p); p != "" {
+			names = append(names, regexp.QuoteMeta(p))
+		}
+	}
+	r := &Redactor{headers: map[string]bool{}}
+	for _, h := range headers {
+		if h = strings.TrimSpace(h); h != "" {
+			r.headers[http.CanonicalHeaderKey(h)] = true
+		}
+	}
+	if len(names) == 0 && len(r.headers) == 0 {
+		return nil
+	}
+	if len(names) > 0 {
+		r.pattern = regexp.MustCompile(`(?i)([?&;](?:` + strings.Join(names, "|") + `)=)[^&;#\s"'<>]+`)
+	}
+	return r
+}
+
+// Redact returns text with the values of the parameters replaced in every URL
+// it contains, so it can be a URL, a header value or an error message quoting
+// one.
+func (q *Redactor) Redact(text string) string {
+	if q == nil || q.pattern == nil {
+		return text
+	}
+	return q.pattern.ReplaceAllString(text, "${1}"+Redacted)
+}
+
+// Error returns err with the parameters redacted from its message.
+func (q *Redactor) Error(err error) error {
+	if q == nil || err == nil {
+		return err
+	}
+	if redacted := q.Redact(err.Error()); redacted != err.Error() {
+		return errors.New(redacted)
+	}
+	return err
+}
+
+// RedactResult redacts the URL and error of res, which is returned.
+func (q *Redactor) RedactResult(res *Result) *Result {
+	res.URL = q.Redact(res.URL)
+	res.Error = q.Redact(res.Error)
+	return res
+}
+
+// request returns a copy of req with the parameters redacted from its URL and
+// headers, and the redacted headers masked, to be shown instead of it.
+func (q *Redactor) request(req *http.Request) *http.Request {
+	if q == nil || req == nil {
+		return req
+	}
+	redacted := req.Clone(req.Context())
+	if redacted.URL.RawQuery != "" {
+		redacted.URL.RawQuery = strings.TrimPrefix(q.Redact("?"+redacted.URL.RawQuery), "?")
+	}
+	q.header(redacted.Header)
+	q.header(redacted.Trailer)
+	return redacted
+}
+
+// response returns a copy of res with the parameters redacted from its
+// headers and trailers, such as a Location to redirect to, and the redacted
+// ones masked, such as Set-Cookie.
+func (q *Redactor) response(res *http.Response) *http.Response {
+	if q == nil || res == nil {
+		return res
+	}
+	redacted := *res
+	redacted.Header = res.Header.Clone()
+	q.header(redacted.Header)
+	redacted.Trailer = res.Trailer.Clone()
+	q.header(redacted.Trailer)
+	return &redacted
+}
+
+func (q *Redactor) header(header http.Header) {
+	for name, values := range header {
+		for i, v := range values {
+			values[i] = q.HeaderValue(name, v)
+		}
+	}
+}
+
+// HeaderValue returns the value of the header name with the parameters
+// redacted from it, or masked if the header is redacted. The scheme of
+// credentials and the names and attributes of cookies are kept, so the
+// report still tells what was sent.
+func (q *Redactor) HeaderValue(name, value string) string {
+	if q == nil {
+		return value
+	}
+	name = http.CanonicalHeaderKey(name)
+	if !q.headers[name] {
+		return q.Redact(value)
+	}
+
+	switch name {
+	case "Authorization", "Proxy-Authorization":
+		if split := strings.SplitN(value, " ", 2); len(split) == 2 {
+			return split[0] + " " + Redacted
+		}
+	case "Cookie":
+		cookies := strings.Split(value, ";")
+		for i, c := range cookies {
+			cookies[i] = redactCookie(c)
+		}
+		return strings.Join(cookies, ";")
+	case "Set-Cookie":
+		split := strings.SplitN(value, ";", 2)
+		split[0] = redactCookie(split[0])
+		return strings.Join(split, ";")
+	}
+	return Redacted
+}
+
+// redactCookie masks the value of a name=value cookie pair, keeping its name
+// and the space before it.
+func redactCookie(pair string) string {
+	if i := strings.Index(pair, "="); i >= 0 {
+		return pair[:i+1] + Redacted
+	}
+	return Redacted
+}
+
+// Writer returns a writer which redacts the parameters from the URLs in the
+// lines written to it, such as a request line, and masks the values of the
+// redacted headers before writing them to w. It is meant for the wire dump of
+// a trace, whose lines may be prefixed to show their direction, as in
+// "> Authorization: Bearer abc". A nil Redactor returns w itself.
+func (q *Redactor) Writer(w io.Writer) io.Writer {
+	if q == nil {
+		return w
+	}
+	return &redactWriter{redactor: q, w: w}
+}
+
+// redactWriter redacts whole lines, keeping a partly written one until the
+// rest of it is written. It is safe for concurrent use, so the wire dumps of
+// concurrent requests can share it.
+type redactWriter struct {
+	redactor *Redactor
+	w        io.Writer
+
+	mu      sync.Mutex
+	partial []byte
+}
+
+func (r *redactWriter) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.partial = append(r.partial, p...)
+	i := bytes.LastIndexByte(r.partial, '\n')
+	if i < 0 {
+		return len(p), nil
+	}
+	lines := strings.SplitAfter(string(r.partial[:i+1]), "\n")
+	r.partial = append(r.partial[:0], r.partial[i+1:]...)
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(r.redactor.line(line))
+	}
+	if _, err := io.WriteString(r.w, b.String()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// line masks the value of a header line, which may be prefixed with "> " or
+// "< ", and redacts the parameters from any other line.
+func (q *Redactor) line(line string) string {
+	prefix := ""
+	rest := line
+	if strings.HasPrefix(rest, "> ") || strings.HasPrefix(rest, "< ") {
+		prefix, rest = rest[:2], rest[2:]
+	}
+	i := strings.Index(rest, ": ")
+	if i <= 0 || strings.ContainsAny(rest[:i], " \t") {
+		return q.Redact(line)
+	}
+	value := strings.TrimRight(rest[i+2:], "\r\n")
+	end := rest[i+2+len(value):]
+	return prefix + rest[:i+2] + q.HeaderValue(rest[:i], value) + end
+}
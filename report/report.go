@@ -1,80 +1,389 @@
+// Package report turns a traced request into the reports of http-trace: the
+// text report, its structured Result for JSON and the other output formats,
+// and summaries and comparisons of repeated requests.
 package report
 
 import (
 	"bytes"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"regexp"
 	"strings"
 	"text/template"
 	"time"
 
+	"github.com/berndhartzer/http-trace/expr"
 	"github.com/berndhartzer/http-trace/trace"
 )
 
-var outputTmpl = `> {{ .Request.Method }} {{ .Request.URL.Host }}{{ .Request.URL.Path }} {{ .Request.Proto }}
+var outputTmpl = `
+{{- if .Presentation.Sections.Shows "request" }}
+> {{ requestLine .Request }}
+{{- with .UnicodeHost }}
+> [{{ $.Request.URL.Hostname }} is {{ . }}]
+{{- end }}
 {{- range $key, $value := .Request.Header }}
-> {{ $key }}: {{stringsJoin $value "" }}
+> {{ dim $key }}: {{ fold ">" $key (stringsJoin $value "") }}
 {{- end }}
 >
-< {{ .Response.Status }}
-{{- if not .Presentation.SuppressHeaders }}
-{{- range $key, $value := .Response.Header }}
-< {{ $key }}: {{stringsJoin $value "" }}
+{{- end }}
+{{- if .Presentation.Sections.Shows "status" }}
+< {{ colorStatus .Response.StatusCode .Response.Status }}
+{{- end }}
+{{- if .Presentation.Sections.Shows "headers" }}
+{{- range .ResponseHeaders }}
+{{- if .First }}
+[custom headers]
+{{- end }}
+< {{ dim .Name }}: {{ fold "<" .Name .Value }}
+{{- end }}
+{{- end }}
+{{- if .Presentation.Sections.Shows "body" }}
+{{- if .BodySkipped }}
+[body not downloaded]
+{{- else if .HexDump }}
+[{{ if .BodySniff.Binary }}binary {{ end }}body: {{ .ResponseBodySize }} bytes, sniffed as {{ .BodySniff.Sniffed }}]
+{{- with .HexDump.Lines }}
+{{ . }}
+{{- end }}
+{{- if gt .HexDump.Omitted 0 }}
+... {{ .HexDump.Omitted }} bytes not shown
+{{- end }}
+{{- else }}
+{{ .DisplayBody }}
+{{- if gt .ResponseBodyTruncated 0 }}
+... {{ .ResponseBodyTruncated }} bytes truncated
+{{- end }}
+{{- with .DecodedFrom }}
+[body decoded from {{ . }}]
+{{- end }}
+{{- with .GrepSummary }}
+[{{ . }}]
 {{- end }}
 {{- end }}
-{{- if not .Presentation.SuppressBody }}
-{{ .ResponseBody }}
 {{- end }}
+{{- if and (.Presentation.Sections.Shows "headers") .Trailers }}
+[trailers]
+{{- range $key, $value := .Trailers }}
+< {{ dim $key }}: {{ fold "<" $key (stringsJoin $value "") }}
+{{- end }}
+{{- end }}
+{{- with .Range }}
+[range {{ .Requested }} {{ if .Honored }}honored, {{ .ContentRange }}{{ else }}not honored{{ end }}: {{ .Bytes }} bytes read at {{ throughput .Throughput }}]
+{{- end }}
+{{- range .Warnings }}
+! Warning: {{ . }}
+{{- end }}
+{{- if .Presentation.Sections.Shows "trace" }}
 
 Trace
   Request
+{{- if .Presentation.Sections.Shows "connection" }}
     Connection
+{{- if .ConnectionReused }}
+      Idle in pool:    {{ durationMillis .ConnectionIdle }}
+{{- end }}
+{{- with .LocalAddr }}
+      Local address:   {{ . }}
+{{- end }}
       DNS Resolution:  {{ durationMillis .Timings.DNSDuration }}
+{{- range .DNSQueries }}
+        {{ printf "%-32s" (print .Type " " .Name) }}{{ signedMillis .Started }} {{ durationMillis .Duration }} {{ .Outcome }}{{ if .Answers }}, {{ .Answers }} in answer{{ end }} from {{ .Server }}{{ with .Setup }}, {{ . }}{{ end }}
+{{- end }}
+{{- with .DNSBreakdown }}
+{{- if .A }}
+        A records:     {{ durationMillis .A }}
+{{- end }}
+{{- if .AAAA }}
+        AAAA records:  {{ durationMillis .AAAA }}
+{{- end }}
+{{- if .CNAMEHops }}
+        CNAME hops:    {{ printf "%9d" .CNAMEHops }}
+{{- end }}
+{{- with .AnsweredBy }}
+        Answered by:   {{ . }}
+{{- end }}
+{{- end }}
       Connecting:      {{ durationMillis .Timings.ConnectionDialDuration }}
+{{- range .Dials }}
+        {{ printf "%-24s" (print .Network " " .Addr) }}{{ signedMillis .Started }} {{ durationMillis .Duration }} {{ .Outcome }}{{ with .Error }}: {{ . }}{{ end }}
+{{- end }}
       TLS handshake:   {{ durationMillis .Timings.TLSDuration }}
+{{- with .Revocation }}
+        OCSP staple:   {{ .StapleLine }}
+{{- if .Check }}
+        {{ printf "%-15s" .CheckLabel }}{{ durationMillis .Check.Duration }} {{ .CheckOutcome }}
+{{- end }}
+{{- end }}
     Connection total:  {{ durationMillis .Timings.TotalConnectionDuration }}
-
+{{ end }}
     Request write:     {{ durationMillis .Timings.RequestWriteDuration }}
+{{- if .ContinueApproved }}
+      100 Continue:    {{ durationMillis .Timings.ContinueDuration }}
+{{- end }}
     Response delay:    {{ durationMillis .Timings.ResponseDelayDuration }}
     Response read:     {{ durationMillis .Timings.ResponseReadDuration }}
+{{- if .Trailers }}
+      Trailers:        {{ durationMillis .Timings.TrailerDuration }}
+{{- end }}
 
   Request total:       {{ durationMillis .Timings.TotalRequestDuration }}
+{{- if .Statuses }}
+
+Progress
+{{- range .Statuses }}
+  {{ status . }}
+{{- end }}
+{{- end }}
+{{- with .Wire }}
+
+Wire
+  Sent:                {{ printf "%9d" .Sent }} bytes
+{{- if or .RequestHead .RequestBody }}
+    Head:              {{ printf "%9d" .RequestHead }} bytes
+    Body:              {{ printf "%9d" .RequestBody }} bytes
+{{- end }}
+  Received:            {{ printf "%9d" .Received }} bytes
+{{- if or .ResponseHead .ResponseBody }}
+    Head:              {{ printf "%9d" .ResponseHead }} bytes
+    Body:              {{ printf "%9d" .ResponseBody }} bytes{{ if and (not $.BodySkipped) (ne .ResponseBody $.ResponseBodySize) }}, {{ $.ResponseBodySize }} decoded{{ end }}
+{{- else if not $.BodySkipped }}, {{ $.ResponseBodySize }} of the body
+{{- end }}
+{{- if gt .Setup 0 }}
+  Connection setup:    {{ printf "%9d" .Setup }} bytes
+{{- end }}
+{{- end }}
+{{- with .CDN }}
+
+CDN
+{{- with .Provider }}
+  Provider:            {{ . }}
+{{- end }}
+{{- with .Status }}
+  Cache status:        {{ . }}{{ with $.CDN.Meaning }}, {{ . }}{{ end }}
+{{- end }}
+{{- with .StatusHeader }}
+  Reported by:         {{ . }}
+{{- end }}
+{{- if .HasAge }}
+  Age:                 {{ .Age }}
+{{- end }}
+{{- range .Via }}
+  Via:                 {{ . }}
+{{- end }}
+{{- with .ServerTimings }}
+  Server-Timing:       {{ stringsJoin . ", " }}
+{{- end }}
+{{- with .Causes }}
+  Likely cause:        {{ stringsJoin . ", " }}
+{{- end }}
+{{- end }}
+{{- if .Presentation.Sections.Shows "connection" }}
+{{- with .TCP }}
+
+TCP
+  Round trip:          {{ durationMillis .RTT }}
+  Round trip var:      {{ durationMillis .RTTVar }}
+  Retransmits:         {{ printf "%9d" .Retransmits }}
+  Congestion window:   {{ printf "%9d" .CongestionWindow }} bytes
+{{- end }}
+{{- end }}
+{{- if .Derived }}
+
+Derived
+{{- range .Derived }}
+  {{ printf "%-21s" (print .Name ":") }}{{ durationMillis .Duration }}
+{{- end }}
+{{- end }}
+{{- end }}
+{{- if .Assertions }}
+
+Assertions
+{{- range .Assertions }}
+  {{ if .Passed }}pass{{ else }}FAIL{{ end }}  {{ .Text }}: {{ .Outcome }}
+{{- end }}
+{{- end }}
+{{- if .Security }}
+
+Security
+{{- range .Security }}
+  {{ .Mark }}  {{ .Header }}: {{ .Detail }}
+{{- end }}
+{{- end }}
+{{- if and (.Presentation.Sections.Shows "chunks") .Chunks }}
+{{- with .Chunks }}
+
+Chunks
+  Count:               {{ printf "%9d" .Count }}
+  First chunk:         {{ durationMillis .First }}
+  Last chunk:          {{ durationMillis .Last }}
+{{- if gt .Count 1 }}
+  Largest gap:         {{ durationMillis .LargestGap }} after {{ .GapAfter }} bytes
+{{- end }}
+{{- end }}
+{{- end }}
+{{- with .LongPoll }}
+
+Long poll
+  First byte:          {{ durationMillis .FirstByte }}
+  Held:                {{ durationMillis .Hold }} {{ if .HeldOpen }}open until the timeout{{ else }}until the server ended the response{{ end }}
+  Reads:               {{ printf "%9d" .Reads }}
+{{- if gt .Reads 1 }}
+  Median gap:          {{ durationMillis .MedianGap }}
+  Largest gap:         {{ durationMillis .LargestGap }}
+{{- end }}
+{{- end }}
+{{- with .Stall }}
+
+Stall
+  Timeout:             {{ durationMillis .Timeout }}
+  Largest gap:         {{ durationMillis .LargestGap }}
+  Outcome:             {{ if .Stalled }}stalled mid-body after {{ .BodyBytes }} bytes, reading was aborted{{ else }}no stall, the body kept arriving{{ end }}
+{{- end }}
+{{- with .Framing }}
+
+Framing
+  Protocol:            {{ .Proto }}
+  Body end:            {{ .Body }}
+{{- if eq .Body "connection close" }}
+  Close wait:          {{ durationMillis .EndWait }}
+{{- end }}
+  Connection:          {{ if .Close }}closed, {{ .Reason }}{{ else }}kept open{{ end }}
+{{- with .KeepAlive }}
+  Keep-Alive:          {{ . }}
+{{- end }}
+{{- end }}
+{{- with .Mirror }}
+
+Mirror {{ fitURL 7 .URL }}
+{{- with .Status }}
+  < {{ . }}
+{{- end }}
+{{- range .Divergences }}
+  ! Divergence: {{ . }}
+{{- end }}
+{{- if .Phases }}
+  {{ printf "%-21s" "" }}{{ column "primary" }} {{ column "mirror" }} {{ column "diff" }}
+{{- range .Phases }}
+  {{ printf "%-21s" (print .Name ":") }}{{ durationMillis .Primary }} {{ durationMillis .Mirror }} {{ signedMillis .Diff }}
+{{- end }}
+{{- end }}
+{{- end }}
 `
 
 var tmplFuncs = template.FuncMap{
-	"durationMillis": func(duration time.Duration) string {
-		millisFloat := duration.Seconds() * 1000
-		return fmt.Sprintf("%9.2fms", millisFloat)
-	},
+	"throughput":  formatThroughput,
+	"status":      FormatStatus,
 	"stringsJoin": strings.Join,
+	"colorStatus": func(code int, status string) string {
+		return status
+	},
+	"dim": func(s string) string {
+		return s
+	},
 }
 
+// Output formats built into Report, more can be added with
+// RegisterFormatter.
+const (
+	FormatText       = "text"
+	FormatJSON       = "json"
+	FormatJSONL      = "jsonl"
+	FormatPrometheus = "prom"
+	FormatCSV        = "csv"
+	FormatHTML       = "html"
+)
+
 type Presentation struct {
-	SuppressHeaders bool
-	SuppressBody    bool
+	Format            string              // One of the Format constants or a registered format, defaults to FormatText
+	Sections          Sections            // Sections of the report to show, all of them if nil
+	NoTranscode       bool                // Show the body in its original charset instead of decoding it to UTF-8
+	LineNumbers       bool                // Prefix each line of the body with its line number
+	BodyGrep          *regexp.Regexp      // Only show the lines of the body matching this pattern
+	BodyGrepContext   int                 // Number of lines of context to show around each BodyGrep match
+	Metrics           []*expr.Definition  // Composite metrics computed from the timings
+	Assertions        []*expr.Assertion   // Comparisons of the timings and metrics which should hold
+	ContentAssertions []*ContentAssertion // Checks of the headers and body which should hold
+	Color             bool                // Add ANSI colors to the text report
+	SlowThreshold     time.Duration       // Color timings from this duration yellow, defaults to DefaultSlowThreshold
+	VerySlowThreshold time.Duration       // Color timings from this duration red, defaults to DefaultVerySlowThreshold
+	WriteOut          *WriteOut           // Write this curl style format instead of the report
+	Width             int                 // Fit header values and URLs of the text report into this many columns, 0 for no limit
+	HeaderOrder       string              // One of the HeaderOrder constants, defaults to HeaderOrderName
+	GroupHeaders      bool                // Show the custom X- response headers after the standard ones
+	KeepBody          BodyPolicy          // What the structured outputs keep of the body, all of it if not set
+	Redactor          *Redactor           // Redact query parameters and sensitive headers from the URLs and headers shown
+	GraphQL           bool                // Show the data of a GraphQL response body indented and its errors listed
+	AuditSecurity     bool                // Grade the security headers of the response
+	HexDump           bool                // Show the body as a hex dump, as is done for the start of a binary body
+	TimeFormat        TimeFormat          // Unit and decimals of the durations of the text report, summaries and CSV
 }
 
 type reportData struct {
-	Request      *http.Request
-	Response     *http.Response
-	ResponseBody string
-	Timings      *trace.Timings
-	Presentation *Presentation
+	Request               *http.Request
+	Response              *http.Response
+	ResponseBody          string
+	ResponseBodySize      int64
+	ResponseBodyTruncated int64
+	BodySkipped           bool
+	Range                 *RangeResult
+	ContinueApproved      bool
+	ResponseHeaders       []headerLine
+	Trailers              http.Header
+	Chunks                *chunkCadence
+	Statuses              []trace.Status
+	LongPoll              *longPollInfo
+	Framing               *framingInfo
+	CDN                   *cdnInfo
+	Stall                 *trace.Stall
+	LocalAddr             string
+	UnicodeHost           string
+	RevocationCheck       *RevocationCheck
+	Revocation            *revocationInfo
+	Wire                  *trace.WireSizes
+	TCP                   *trace.TCPInfo
+	Dials                 []dialLine
+	DNSQueries            []dnsLine
+	DNSBreakdown          *dnsBreakdown
+	BodySHA256            string
+	DisplayBody           string
+	DecodedFrom           string
+	GrepSummary           string
+	BodySniff             *bodySniff
+	HexDump               *hexDump
+	GraphQLErrors         []string
+	Timings               *trace.Timings
+	Events                []trace.Event
+	ConnectionReused      bool
+	ConnectionIdle        time.Duration
+	Derived               []derivedMetric
+	Assertions            []assertionLine
+	Security              []SecurityCheck
+	Mirror                *mirrorComparison
+	Presentation          *Presentation
+	Warnings              []string
 }
 
 type Report struct {
-	data   *reportData
-	output string
+	data      *reportData
+	warnings  []string
+	mirror    *Report
+	mirrorErr error
+	pipe      *Report
+	pipeErr   error
+	output    string
 }
 
 func New(req *http.Request, res *http.Response, body string, result *trace.Timings, pres *Presentation) *Report {
 	data := &reportData{
-		Request:      req,
-		Response:     res,
-		ResponseBody: body,
-		Timings:      result,
-		Presentation: pres,
+		Request:          pres.Redactor.request(req),
+		Response:         pres.Redactor.response(res),
+		ResponseBody:     body,
+		ResponseBodySize: int64(len(body)),
+		Timings:          result,
+		Presentation:     pres,
 	}
 
 	return &Report{
@@ -82,11 +391,131 @@ func New(req *http.Request, res *http.Response, body string, result *trace.Timin
 	}
 }
 
+// SetResponseBodySize records the full size of the response body, so the
+// report can note how much of it was left out of body.
+func (r *Report) SetResponseBodySize(size int64) {
+	r.data.ResponseBodySize = size
+	r.data.ResponseBodyTruncated = size - int64(len(r.data.ResponseBody))
+}
+
+// SetBodySkipped records that the response body was not downloaded, as only
+// the headers were wanted.
+func (r *Report) SetBodySkipped() {
+	r.data.BodySkipped = true
+}
+
+// SetStall records how steadily the body arrived, when reading it was to be
+// aborted after a stall.
+func (r *Report) SetStall(stall *trace.Stall) {
+	r.data.Stall = stall
+}
+
+// SetEvents records the httptrace callbacks made while sending the request.
+func (r *Report) SetEvents(events []trace.Event) {
+	r.data.Events = events
+}
+
+// SetLongPoll records how a response the server held open was received.
+func (r *Report) SetLongPoll(longPoll *trace.LongPoll) {
+	r.data.LongPoll = measureLongPoll(longPoll, r.data.Timings)
+}
+
+// SetStatuses records the statuses taken while the request was in progress.
+func (r *Report) SetStatuses(statuses []trace.Status) {
+	r.data.Statuses = statuses
+}
+
+// SetChunks records when the chunks of a chunked response body arrived.
+func (r *Report) SetChunks(chunks []trace.Chunk) {
+	r.data.Chunks = measureCadence(chunks)
+}
+
+// SetDialAttempts records the attempts made to connect to the addresses of
+// the host, which are shown when there was more than one.
+func (r *Report) SetDialAttempts(attempts []trace.DialAttempt) {
+	r.data.Dials = dialLines(attempts)
+}
+
+// SetWireSizes records the bytes the request and response took on the wire.
+func (r *Report) SetWireSizes(sizes *trace.WireSizes) {
+	r.data.Wire = sizes
+}
+
+// SetTCPInfo records what the kernel measured of the TCP connection, shown
+// with the connection section.
+func (r *Report) SetTCPInfo(info *trace.TCPInfo) {
+	r.data.TCP = info
+}
+
+// SetDNSQueries records the queries sent to DNS servers to resolve the host,
+// which are shown under the DNS resolution time.
+func (r *Report) SetDNSQueries(queries []trace.DNSQuery) {
+	r.data.DNSQueries = dnsLines(queries, r.data.Presentation.TimeFormat)
+	r.data.DNSBreakdown = breakDownDNS(queries)
+}
+
+// SetUnicodeHost records the Unicode form of an internationalized host, which
+// is shown with the ASCII form the request was sent to.
+func (r *Report) SetUnicodeHost(host string) {
+	r.data.UnicodeHost = host
+}
+
+// SetRevocationCheck records a check of whether the certificate of the
+// server was revoked, shown with the OCSP staple of the handshake.
+func (r *Report) SetRevocationCheck(check *RevocationCheck) {
+	r.data.RevocationCheck = check
+}
+
+// SetLocalAddr records the address the request was sent from, to show in
+// the connection section when it was chosen.
+func (r *Report) SetLocalAddr(addr net.Addr) {
+	if addr != nil {
+		r.data.LocalAddr = addr.String()
+	}
+}
+
+// SetBodySHA256 records the hex encoded SHA-256 of the whole response body,
+// which the structured outputs keep with KeepBodyHash.
+func (r *Report) SetBodySHA256(sum string) {
+	r.data.BodySHA256 = sum
+}
+
+// SetConnectionReused records whether the request was sent on a connection
+// kept alive from an earlier request.
+func (r *Report) SetConnectionReused(reused bool) {
+	r.data.ConnectionReused = reused
+}
+
+// SetConnectionIdleTime records how long the reused connection had been idle
+// in the pool before the request was sent on it.
+func (r *Report) SetConnectionIdleTime(idle time.Duration) {
+	r.data.ConnectionIdle = idle
+}
+
+// AddWarning adds a line to the warnings shown after the response.
+func (r *Report) AddWarning(warning string) {
+	r.warnings = append(r.warnings, warning)
+}
+
 func (r *Report) Build() error {
 	b := &bytes.Buffer{}
 
-	tmpl := template.Must(template.New("output").Funcs(tmplFuncs).Parse(outputTmpl))
-	err := tmpl.Execute(b, r.data)
+	r.analyse()
+
+	formatter, ok := LookupFormatter(r.data.Presentation.Format)
+	if !ok {
+		return fmt.Errorf("Error building report: unknown output format %q", r.data.Presentation.Format)
+	}
+	data := &ReportData{
+		Request:      r.data.Request,
+		Response:     r.data.Response,
+		Body:         r.data.DisplayBody,
+		Timings:      r.data.Timings,
+		Presentation: r.data.Presentation,
+		Warnings:     r.data.Warnings,
+		report:       r,
+	}
+	err := formatter.Format(data, b)
 	if err != nil {
 		return fmt.Errorf("Error building report: %w", err)
 	}
@@ -95,6 +524,123 @@ func (r *Report) Build() error {
 	return nil
 }
 
+// String returns the built report.
+func (r *Report) String() string {
+	return r.output
+}
+
+// analyse decodes and inspects the response body and computes the derived
+// metrics, any mirror comparison and the piped request, collecting warnings along the way.
+func (r *Report) analyse() {
+	r.data.Warnings = append([]string{}, r.warnings...)
+
+	vars := timingVars(r.data.Timings, r.data.Response)
+	derived, derivedWarnings := evaluateMetrics(r.data.Presentation.Metrics, vars)
+	r.data.Derived = derived
+	r.data.Warnings = append(r.data.Warnings, derivedWarnings...)
+	r.data.Assertions = checkAssertions(r.data.Presentation.Assertions, vars, r.data.Presentation.TimeFormat)
+	r.data.Security = auditSecurity(r.data)
+
+	r.data.DisplayBody = r.data.ResponseBody
+	if !r.data.Presentation.NoTranscode {
+		charset := detectCharset(r.data.Response.Header, r.data.ResponseBody)
+		decoded, from, err := transcodeBody(charset, r.data.ResponseBody)
+		if err != nil {
+			r.data.Warnings = append(r.data.Warnings, err.Error())
+		}
+		r.data.DisplayBody = decoded
+		r.data.DecodedFrom = from
+	}
+	contentAssertions := checkContentAssertions(r.data.Presentation.ContentAssertions, r.data.Response.Header, r.data.DisplayBody)
+	r.data.Assertions = append(r.data.Assertions, contentAssertions...)
+
+	r.data.BodySniff = sniffBody(r.data.Response.Header, r.data.DisplayBody)
+	if r.data.BodySniff.Warning != "" {
+		r.data.Warnings = append(r.data.Warnings, r.data.BodySniff.Warning)
+	}
+	switch {
+	case r.data.Presentation.HexDump:
+		r.data.HexDump = dumpBody(r.data.ResponseBody, r.data.ResponseBodySize, -1)
+	case r.data.BodySniff.Binary:
+		r.data.HexDump = dumpBody(r.data.ResponseBody, r.data.ResponseBodySize, maxHexDump)
+	}
+
+	graphQLErrors, graphQLWarning := checkGraphQL(r.data)
+	r.data.GraphQLErrors = graphQLErrors
+	if graphQLWarning != "" {
+		r.data.Warnings = append(r.data.Warnings, graphQLWarning)
+	}
+
+	rangeResult, rangeWarning := checkRange(r.data)
+	r.data.Range = rangeResult
+	if rangeWarning != "" {
+		r.data.Warnings = append(r.data.Warnings, rangeWarning)
+	}
+
+	r.data.ResponseHeaders = orderHeaders(r.data.Response.Header, r.data.Presentation.HeaderOrder, r.data.Presentation.GroupHeaders)
+	r.data.Trailers = receivedTrailers(r.data.Response)
+	r.data.CDN = inspectCDN(r.data.Response, r.data.Presentation.TimeFormat)
+
+	revocation, revocationWarnings := checkRevocation(r.data, r.data.RevocationCheck, time.Now())
+	r.data.Revocation = revocation
+	r.data.Warnings = append(r.data.Warnings, revocationWarnings...)
+
+	if dnsWarning := checkDNSBreakdown(r.data.DNSBreakdown, r.data.Presentation.TimeFormat); dnsWarning != "" {
+		r.data.Warnings = append(r.data.Warnings, dnsWarning)
+	}
+
+	if stallWarning := checkStall(r.data.Stall, r.data.Presentation.TimeFormat); stallWarning != "" {
+		r.data.Warnings = append(r.data.Warnings, stallWarning)
+	}
+
+	framing, framingWarnings := checkFraming(r.data)
+	r.data.Framing = framing
+	r.data.Warnings = append(r.data.Warnings, framingWarnings...)
+
+	approved, continueWarning := checkContinue(r.data)
+	r.data.ContinueApproved = approved
+	if continueWarning != "" {
+		r.data.Warnings = append(r.data.Warnings, continueWarning)
+	}
+
+	if r.mirror != nil {
+		if r.mirrorErr == nil {
+			r.mirror.analyse()
+		}
+		r.data.Mirror = compareMirror(r.data, r.mirror.data, r.mirrorErr)
+	}
+
+	if r.pipe != nil && r.pipeErr == nil {
+		r.pipe.analyse()
+	}
+}
+
+func (r *Report) buildText(b *bytes.Buffer) error {
+	if !r.data.BodySniff.Binary {
+		pres := r.data.Presentation
+		if pres.BodyGrep != nil {
+			r.data.DisplayBody, r.data.GrepSummary = grepBody(r.data.DisplayBody, pres.BodyGrep, pres.BodyGrepContext)
+		} else if pres.LineNumbers {
+			r.data.DisplayBody = numberLines(r.data.DisplayBody)
+		}
+	}
+
+	tmpl := template.New("output").Funcs(tmplFuncs).Funcs(widthFuncs(r.data.Presentation.Width)).Funcs(timeFuncs(r.data.Presentation.TimeFormat))
+	if r.data.Presentation.Color {
+		tmpl = tmpl.Funcs(colorFuncs(r.data.Presentation))
+	}
+	tmpl = template.Must(tmpl.Parse(outputTmpl))
+	text := &bytes.Buffer{}
+	err := tmpl.Execute(text, r.data)
+	if err != nil {
+		return err
+	}
+
+	// Each section starts on a new line, whichever comes first
+	b.WriteString(strings.TrimLeft(text.String(), "\n"))
+	return nil
+}
+
 func (r *Report) Print(w io.Writer) error {
 	_, err := fmt.Fprint(w, r.output)
 	if err != nil {
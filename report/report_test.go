@@ -2,16 +2,34 @@ package report
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math/big"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
+	"unicode/utf8"
 
+	"github.com/berndhartzer/http-trace/expr"
 	"github.com/berndhartzer/http-trace/trace"
 )
 
 type testReport struct {
 	presentation *Presentation
+	bodySize     int64
 	expected     string
 }
 
@@ -80,8 +98,7 @@ func TestReport(t *testing.T) {
 	tests := map[string]testReport{
 		"will output a full request and response with trace timings": {
 			presentation: &Presentation{
-				SuppressHeaders: false,
-				SuppressBody:    false,
+				Sections: nil,
 			},
 			expected: fmt.Sprintf(
 				"%s%s%s%s%s%s",
@@ -93,10 +110,23 @@ func TestReport(t *testing.T) {
 				expectedTraceOutput,
 			),
 		},
+		"will note how much of the response body was truncated": {
+			presentation: &Presentation{
+				Sections: Sections(nil).Hide(SectionHeaders),
+			},
+			bodySize: int64(len(body)) + 1024,
+			expected: fmt.Sprintf(
+				"%s%s%s%s%s",
+				expectedRequestHeadersOutput,
+				expectedResponseStatusOutput,
+				body,
+				"\n... 1024 bytes truncated\n\n",
+				expectedTraceOutput,
+			),
+		},
 		"will not output response headers if suppressed": {
 			presentation: &Presentation{
-				SuppressHeaders: true,
-				SuppressBody:    false,
+				Sections: Sections(nil).Hide(SectionHeaders),
 			},
 			expected: fmt.Sprintf(
 				"%s%s%s%s%s",
@@ -109,8 +139,7 @@ func TestReport(t *testing.T) {
 		},
 		"will not output response body if suppressed": {
 			presentation: &Presentation{
-				SuppressHeaders: false,
-				SuppressBody:    true,
+				Sections: Sections(nil).Hide(SectionBody),
 			},
 			expected: fmt.Sprintf(
 				"%s%s%s%s%s",
@@ -123,8 +152,7 @@ func TestReport(t *testing.T) {
 		},
 		"will not output response headers and body if suppressed": {
 			presentation: &Presentation{
-				SuppressHeaders: true,
-				SuppressBody:    true,
+				Sections: Sections(nil).Hide(SectionHeaders, SectionBody),
 			},
 			expected: fmt.Sprintf(
 				"%s%s%s%s",
@@ -134,12 +162,38 @@ func TestReport(t *testing.T) {
 				expectedTraceOutput,
 			),
 		},
+		"will only output the sections shown": {
+			presentation: &Presentation{
+				Sections: Sections{SectionStatus: true, SectionTrace: true},
+			},
+			expected: fmt.Sprintf(
+				"%s%s%s",
+				expectedResponseStatusOutput,
+				"\n",
+				strings.Replace(expectedTraceOutput, `    Connection
+      DNS Resolution:       2.29ms
+      Connecting:          22.66ms
+      TLS handshake:      299.74ms
+    Connection total:     324.93ms
+
+`, "", 1),
+			),
+		},
+		"will start with the first section shown": {
+			presentation: &Presentation{
+				Sections: Sections{SectionTrace: true, SectionConnection: true},
+			},
+			expected: expectedTraceOutput,
+		},
 	}
 
 	for name, cfg := range tests {
 		cfg := cfg
 		t.Run(name, func(t *testing.T) {
 			report := New(request, response, body, timings, cfg.presentation)
+			if cfg.bodySize != 0 {
+				report.SetResponseBodySize(cfg.bodySize)
+			}
 
 			err = report.Build()
 			if err != nil {
@@ -156,3 +210,4021 @@ func TestReport(t *testing.T) {
 		})
 	}
 }
+
+type testParseSections struct {
+	spec          string
+	expected      Sections
+	expectedError bool
+}
+
+func TestParseSections(t *testing.T) {
+	tests := map[string]testParseSections{
+		"will parse a list of sections": {
+			spec:     "request, Trace",
+			expected: Sections{SectionRequest: true, SectionTrace: true},
+		},
+		"will reject an unknown section": {
+			spec:          "request,timings",
+			expectedError: true,
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			sections, err := ParseSections(cfg.spec)
+			if cfg.expectedError {
+				if err == nil {
+					t.Errorf("Expected an error, got sections %v", sections)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Error parsing sections: %v", err)
+			}
+			if !reflect.DeepEqual(sections, cfg.expected) {
+				t.Errorf("Unexpected sections: got %v, want %v", sections, cfg.expected)
+			}
+		})
+	}
+
+	hidden := Sections(nil).Hide(SectionBody)
+	if hidden.Shows(SectionBody) || !hidden.Shows(SectionHeaders) {
+		t.Errorf("Unexpected sections after hiding the body: got %v", hidden)
+	}
+}
+
+type testReportBodySniffing struct {
+	contentType      string
+	body             string
+	hexDump          bool
+	expectedBody     string
+	expectedWarning  string
+	unexpectedOutput string
+}
+
+func TestReportBodySniffing(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "https://thing.com", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	pngBody := "\x89PNG\x0d\x0a\x1a\x0a\x00\x00\x00\x0dIHDR\x00\x00\x00\x01"
+
+	tests := map[string]testReportBodySniffing{
+		"will show a text body matching its content type": {
+			contentType:  "text/html; charset=utf-8",
+			body:         "<html><body>hi</body></html>",
+			expectedBody: "<html><body>hi</body></html>\n",
+		},
+		"will dump a binary body declared as text and warn": {
+			contentType: "text/plain",
+			body:        pngBody,
+			expectedBody: "[binary body: 20 bytes, sniffed as image/png]\n" +
+				"00000000  89 50 4e 47 0d 0a 1a 0a  00 00 00 0d 49 48 44 52  |.PNG........IHDR|\n" +
+				"00000010  00 00 00 01                                       |....|\n",
+			expectedWarning:  "! Warning: Content-Type is text/plain but the body looks like binary data (sniffed as image/png)\n",
+			unexpectedOutput: "\x89",
+		},
+		"will dump a binary body without a warning when declared as binary": {
+			contentType: "image/png",
+			body:        pngBody,
+			expectedBody: "[binary body: 20 bytes, sniffed as image/png]\n" +
+				"00000000  89 50 4e 47 0d 0a 1a 0a  00 00 00 0d 49 48 44 52  |.PNG........IHDR|\n" +
+				"00000010  00 00 00 01                                       |....|\n",
+			unexpectedOutput: "Warning",
+		},
+		"will warn about a text body declared as binary": {
+			contentType:     "application/octet-stream",
+			body:            `{"hello": "there"}`,
+			expectedBody:    `{"hello": "there"}` + "\n",
+			expectedWarning: "! Warning: Content-Type is application/octet-stream but the body looks like text (sniffed as text/plain; charset=utf-8)\n",
+		},
+		"will dump a body containing terminal control characters": {
+			contentType:      "text/plain",
+			body:             "hello \x1b[2Jthere",
+			expectedBody:     "[binary body: 15 bytes, sniffed as text/plain; charset=utf-8]\n00000000  68 65 6c 6c 6f 20 1b 5b  32 4a 74 68 65 72 65     |hello .[2Jthere|\n",
+			expectedWarning:  "! Warning: Content-Type is text/plain but the body looks like binary data (sniffed as text/plain; charset=utf-8)\n",
+			unexpectedOutput: "\x1b",
+		},
+		"will dump a text body when asked to": {
+			contentType:  "text/plain",
+			body:         "hello",
+			hexDump:      true,
+			expectedBody: "[body: 5 bytes, sniffed as text/plain; charset=utf-8]\n00000000  68 65 6c 6c 6f                                    |hello|\n",
+		},
+		"will dump only the start of a long binary body": {
+			contentType: "application/octet-stream",
+			body:        strings.Repeat("\x00", 256) + "\x01\x02",
+			expectedBody: "[binary body: 258 bytes, sniffed as application/octet-stream]\n" +
+				hex.Dump(make([]byte, 256)) +
+				"... 2 bytes not shown\n",
+		},
+		"will tolerate a multi-byte character cut off by truncation": {
+			contentType:  "text/plain; charset=utf-8",
+			body:         "price: 5\xe2\x82",
+			expectedBody: "price: 5\xe2\x82\n",
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			response := &http.Response{
+				Status: "200 OK",
+				Header: http.Header{"Content-Type": {cfg.contentType}},
+			}
+
+			report := New(request, response, cfg.body, &trace.Timings{}, &Presentation{Sections: Sections(nil).Hide(SectionHeaders), HexDump: cfg.hexDump})
+
+			err = report.Build()
+			if err != nil {
+				t.Errorf("Error building report: %v", err)
+			}
+
+			output := &bytes.Buffer{}
+			report.Print(output)
+
+			expected := "< 200 OK\n" + cfg.expectedBody + cfg.expectedWarning + "\nTrace"
+			if !strings.Contains(output.String(), expected) {
+				t.Errorf("report output incorrect: got\n%v\n want it to contain\n%v\n", output.String(), expected)
+			}
+
+			if cfg.unexpectedOutput != "" && strings.Contains(output.String(), cfg.unexpectedOutput) {
+				t.Errorf("report output should not contain %q: got\n%v\n", cfg.unexpectedOutput, output.String())
+			}
+		})
+	}
+}
+
+type testReportCharset struct {
+	contentType     string
+	body            string
+	noTranscode     bool
+	expectedBody    string
+	expectedCharset string
+}
+
+func TestReportCharset(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "https://thing.com", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	tests := map[string]testReportCharset{
+		"will decode a charset declared in the content type": {
+			contentType:     "text/plain; charset=ISO-8859-1",
+			body:            "caf\xe9",
+			expectedBody:    "café\n[body decoded from iso-8859-1]\n",
+			expectedCharset: "iso-8859-1",
+		},
+		"will decode a multi-byte charset": {
+			contentType:     "text/plain; charset=Shift_JIS",
+			body:            "\x82\xb1\x82\xf1\x82\xc9\x82\xbf\x82\xcd",
+			expectedBody:    "こんにちは\n[body decoded from shift_jis]\n",
+			expectedCharset: "shift_jis",
+		},
+		"will decode a charset declared in a meta tag": {
+			contentType:     "text/html",
+			body:            `<html><head><meta charset="windows-1252"></head><body>caf` + "\xe9</body></html>",
+			expectedBody:    `<html><head><meta charset="windows-1252"></head><body>café</body></html>` + "\n[body decoded from windows-1252]\n",
+			expectedCharset: "windows-1252",
+		},
+		"will not note decoding which made no difference": {
+			contentType:  "text/plain; charset=us-ascii",
+			body:         "plain old text",
+			expectedBody: "plain old text\n",
+		},
+		"will warn about an unknown charset": {
+			contentType:  "text/plain; charset=made-up",
+			body:         "hello",
+			expectedBody: "hello\n! Warning: unknown charset \"made-up\", body shown undecoded\n",
+		},
+		"will not decode the body when transcoding is disabled": {
+			contentType:  "text/plain; charset=ISO-8859-1",
+			body:         "caf\xe9 au lait",
+			noTranscode:  true,
+			expectedBody: "[binary body: 12 bytes, sniffed as text/plain; charset=utf-8]\n00000000  63 61 66 e9 20 61 75 20  6c 61 69 74              |caf. au lait|\n! Warning: Content-Type is text/plain but the body looks like binary data (sniffed as text/plain; charset=utf-8)\n",
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			response := &http.Response{
+				Status: "200 OK",
+				Header: http.Header{"Content-Type": {cfg.contentType}},
+			}
+
+			report := New(request, response, cfg.body, &trace.Timings{}, &Presentation{Sections: Sections(nil).Hide(SectionHeaders), NoTranscode: cfg.noTranscode})
+
+			err = report.Build()
+			if err != nil {
+				t.Errorf("Error building report: %v", err)
+			}
+
+			output := &bytes.Buffer{}
+			report.Print(output)
+
+			expected := "< 200 OK\n" + cfg.expectedBody + "\nTrace"
+			if !strings.Contains(output.String(), expected) {
+				t.Errorf("report output incorrect: got\n%v\n want it to contain\n%v\n", output.String(), expected)
+			}
+
+			if charset := report.Result().BodyCharset; charset != cfg.expectedCharset {
+				t.Errorf("body charset incorrect: got %q, want %q", charset, cfg.expectedCharset)
+			}
+		})
+	}
+}
+
+type testReportBodyGrep struct {
+	presentation *Presentation
+	expectedBody string
+}
+
+func TestReportBodyGrep(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "https://thing.com", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	response := &http.Response{
+		Status: "200 OK",
+		Header: http.Header{"Content-Type": {"text/plain"}},
+	}
+
+	body := `INFO starting
+INFO loading config
+WARN config missing, using defaults
+INFO listening
+INFO request one
+INFO request two
+INFO request three
+ERROR request four failed
+INFO request five
+INFO shutting down
+INFO done`
+
+	tests := map[string]testReportBodyGrep{
+		"will only show matching lines": {
+			presentation: &Presentation{Sections: Sections(nil).Hide(SectionHeaders), BodyGrep: regexp.MustCompile(`WARN|ERROR`)},
+			expectedBody: ` 3: WARN config missing, using defaults
+--
+ 8: ERROR request four failed
+[/WARN|ERROR/ matched 2 of 11 lines]
+`,
+		},
+		"will show context around matching lines": {
+			presentation: &Presentation{Sections: Sections(nil).Hide(SectionHeaders), BodyGrep: regexp.MustCompile(`WARN|ERROR`), BodyGrepContext: 1},
+			expectedBody: ` 2- INFO loading config
+ 3: WARN config missing, using defaults
+ 4- INFO listening
+--
+ 7- INFO request three
+ 8: ERROR request four failed
+ 9- INFO request five
+[/WARN|ERROR/ matched 2 of 11 lines]
+`,
+		},
+		"will merge overlapping context": {
+			presentation: &Presentation{Sections: Sections(nil).Hide(SectionHeaders), BodyGrep: regexp.MustCompile(`request (one|two)`), BodyGrepContext: 1},
+			expectedBody: ` 4- INFO listening
+ 5: INFO request one
+ 6: INFO request two
+ 7- INFO request three
+[/request (one|two)/ matched 2 of 11 lines]
+`,
+		},
+		"will number every line": {
+			presentation: &Presentation{Sections: Sections(nil).Hide(SectionHeaders), LineNumbers: true},
+			expectedBody: ` 1: INFO starting
+ 2: INFO loading config
+ 3: WARN config missing, using defaults
+ 4: INFO listening
+ 5: INFO request one
+ 6: INFO request two
+ 7: INFO request three
+ 8: ERROR request four failed
+ 9: INFO request five
+10: INFO shutting down
+11: INFO done
+`,
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			report := New(request, response, body, &trace.Timings{}, cfg.presentation)
+
+			err = report.Build()
+			if err != nil {
+				t.Errorf("Error building report: %v", err)
+			}
+
+			output := &bytes.Buffer{}
+			report.Print(output)
+
+			expected := "< 200 OK\n" + cfg.expectedBody + "\nTrace"
+			if !strings.Contains(output.String(), expected) {
+				t.Errorf("report output incorrect: got\n%v\n want it to contain\n%v\n", output.String(), expected)
+			}
+		})
+	}
+}
+
+func TestReportPrometheus(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "https://thing.com/path?q=\"quoted\"", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	response := &http.Response{
+		Status:     "404 Not Found",
+		StatusCode: http.StatusNotFound,
+		Header:     http.Header{},
+	}
+
+	timings := &trace.Timings{
+		DNSDuration:             2293 * time.Microsecond,
+		ConnectionDialDuration:  22664 * time.Microsecond,
+		TLSDuration:             299741 * time.Microsecond,
+		TotalConnectionDuration: 324931 * time.Microsecond,
+		RequestWriteDuration:    48 * time.Microsecond,
+		ResponseDelayDuration:   480966 * time.Microsecond,
+		ResponseReadDuration:    22933 * time.Microsecond,
+		TotalRequestDuration:    828987 * time.Microsecond,
+	}
+
+	report := New(request, response, "not here", timings, &Presentation{Format: FormatPrometheus})
+	err = report.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+
+	labels := `{url="https://thing.com/path?q=\"quoted\"",method="GET",status="404"}`
+	expected := []string{
+		"# HELP http_trace_dns_duration_seconds DNS lookup duration\n# TYPE http_trace_dns_duration_seconds gauge\nhttp_trace_dns_duration_seconds" + labels + " 0.002293\n",
+		"http_trace_connect_duration_seconds" + labels + " 0.022664\n",
+		"http_trace_tls_duration_seconds" + labels + " 0.299741\n",
+		"http_trace_connection_duration_seconds" + labels + " 0.324931\n",
+		"http_trace_request_write_duration_seconds" + labels + " 0.000048\n",
+		"http_trace_response_delay_duration_seconds" + labels + " 0.480966\n",
+		"http_trace_response_read_duration_seconds" + labels + " 0.022933\n",
+		"http_trace_total_duration_seconds" + labels + " 0.828987\n",
+		"http_trace_response_body_bytes" + labels + " 8\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(report.String(), e) {
+			t.Errorf("prometheus output incorrect: got\n%v\n want it to contain\n%v\n", report.String(), e)
+		}
+	}
+
+	var pushed string
+	var pushedPath string
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		pushed = string(body)
+		pushedPath = r.URL.Path
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer gateway.Close()
+
+	err = PushPrometheus(gateway.Client(), gateway.URL, "http_trace", report.String())
+	if err != nil {
+		t.Errorf("Error pushing metrics: %v", err)
+	}
+	if pushedPath != "/metrics/job/http_trace" {
+		t.Errorf("Unexpected pushgateway path: got %v, want /metrics/job/http_trace", pushedPath)
+	}
+	if pushed != report.String() {
+		t.Errorf("Unexpected pushed metrics: got\n%v\n want\n%v\n", pushed, report.String())
+	}
+}
+
+func TestReportProgress(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "https://thing.com/big.iso", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	response := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+	}
+
+	statuses := []trace.Status{
+		{Elapsed: time.Second, Phase: "response_delay", PhaseElapsed: 900 * time.Millisecond},
+		{Elapsed: 2 * time.Second, Phase: "response_read", PhaseElapsed: 1100 * time.Millisecond, BodyBytes: 3 << 20, Throughput: 3 << 20},
+	}
+
+	report := New(request, response, "", &trace.Timings{TotalRequestDuration: 2500 * time.Millisecond}, &Presentation{Sections: Sections(nil).Hide(SectionHeaders, SectionBody)})
+	report.SetStatuses(statuses)
+	err = report.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+
+	expected := "  Request total:         2500.00ms\n\nProgress\n     1.0s response_delay for 0.9s\n     2.0s response_read for 1.1s, 3145728 bytes read at 3.00 MiB/s\n"
+	if !strings.Contains(report.String(), expected) {
+		t.Errorf("report output incorrect: got\n%v\n want it to contain\n%v\n", report.String(), expected)
+	}
+
+	result := report.Result()
+	if len(result.Progress) != 2 || result.Progress[1].Phase != "response_read" || result.Progress[1].BodyBytes != 3<<20 || result.Progress[1].Elapsed != 2 {
+		t.Errorf("Unexpected progress in result: got %+v", result.Progress)
+	}
+}
+
+func TestReportLongPoll(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "https://thing.com/events", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	response := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+	}
+
+	timings := &trace.Timings{
+		TotalConnectionDuration: 40 * time.Millisecond,
+		RequestWriteDuration:    5 * time.Millisecond,
+		ResponseDelayDuration:   55 * time.Millisecond,
+		ResponseReadDuration:    30 * time.Second,
+		TotalRequestDuration:    30100 * time.Millisecond,
+	}
+	longPoll := &trace.LongPoll{
+		HeldOpen: true,
+		Reads: []trace.Chunk{
+			{Offset: 100 * time.Millisecond, Size: 1},
+			{Offset: 10100 * time.Millisecond, Size: 1},
+			{Offset: 20200 * time.Millisecond, Size: 1},
+		},
+	}
+
+	report := New(request, response, "", timings, &Presentation{Sections: Sections(nil).Hide(SectionHeaders, SectionBody)})
+	report.SetLongPoll(longPoll)
+	err = report.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+
+	expected := "Long poll\n  First byte:             100.00ms\n  Held:                 30000.00ms open until the timeout\n  Reads:                       3\n  Median gap:           10050.00ms\n  Largest gap:          10100.00ms\n"
+	if !strings.Contains(report.String(), expected) {
+		t.Errorf("report output incorrect: got\n%v\n want it to contain\n%v\n", report.String(), expected)
+	}
+
+	result := report.Result()
+	if result.LongPoll == nil || !result.LongPoll.HeldOpen || result.LongPoll.Hold != 30 || result.LongPoll.Reads != 3 {
+		t.Errorf("Unexpected long poll in result: got %+v", result.LongPoll)
+	}
+
+	report = New(request, response, "", timings, &Presentation{})
+	err = report.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+	if strings.Contains(report.String(), "Long poll") || report.Result().LongPoll != nil {
+		t.Errorf("Expected no long poll without one: got\n%v", report.String())
+	}
+}
+
+func TestReportDerivedMetrics(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "https://thing.com", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	response := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+	}
+
+	timings := &trace.Timings{
+		ConnectionDialDuration: 20 * time.Millisecond,
+		ResponseDelayDuration:  300 * time.Millisecond,
+		TotalRequestDuration:   500 * time.Millisecond,
+	}
+
+	definitions := []string{
+		"backend_time = response_delay - rtt",
+		"network_time = total - backend_time",
+		"broken = nonsense * 2",
+	}
+	metrics := []*expr.Definition{}
+	for _, d := range definitions {
+		parsed, err := expr.ParseDefinition(d)
+		if err != nil {
+			t.Fatalf("Error parsing definition: %v", err)
+		}
+		metrics = append(metrics, parsed)
+	}
+
+	report := New(request, response, "", timings, &Presentation{Sections: Sections(nil).Hide(SectionHeaders, SectionBody), Metrics: metrics})
+	err = report.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+
+	expected := []string{
+		"! Warning: could not compute broken: unknown variable \"nonsense\"\n",
+		"  Request total:          500.00ms\n\nDerived\n  backend_time:           280.00ms\n  network_time:           220.00ms\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(report.String(), e) {
+			t.Errorf("report output incorrect: got\n%v\n want it to contain\n%v\n", report.String(), e)
+		}
+	}
+
+	prom := New(request, response, "", timings, &Presentation{Format: FormatPrometheus, Metrics: metrics})
+	err = prom.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+
+	expectedMetric := `http_trace_derived_duration_seconds{url="https://thing.com",method="GET",status="200",metric="backend_time"} 0.28` + "\n"
+	if !strings.Contains(prom.String(), expectedMetric) {
+		t.Errorf("prometheus output incorrect: got\n%v\n want it to contain\n%v\n", prom.String(), expectedMetric)
+	}
+}
+
+func TestReportJSON(t *testing.T) {
+	request, err := http.NewRequest(http.MethodPost, "https://thing.com/things", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	response := &http.Response{
+		Status:     "201 Created",
+		StatusCode: http.StatusCreated,
+		Proto:      "HTTP/1.1",
+		Header:     http.Header{"Content-Type": {"application/json"}},
+	}
+
+	timings := &trace.Timings{
+		DNSDuration:          2 * time.Millisecond,
+		TotalRequestDuration: 250 * time.Millisecond,
+	}
+
+	report := New(request, response, `{"id": 1}`, timings, &Presentation{Format: FormatJSON})
+	err = report.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+
+	result := &Result{}
+	err = json.Unmarshal([]byte(report.String()), result)
+	if err != nil {
+		t.Fatalf("Error decoding JSON output: %v\n%v", err, report.String())
+	}
+
+	if result.URL != "https://thing.com/things" || result.Method != http.MethodPost || result.Status != http.StatusCreated {
+		t.Errorf("Unexpected request summary: got %+v", result)
+	}
+	if result.Body != `{"id": 1}` || result.BodySize != 9 {
+		t.Errorf("Unexpected body: got %v (%d bytes)", result.Body, result.BodySize)
+	}
+	if result.ResponseHeaders.Get("Content-Type") != "application/json" {
+		t.Errorf("Unexpected response headers: got %v", result.ResponseHeaders)
+	}
+	if result.Timings["dns"] != 0.002 || result.Timings["total"] != 0.25 {
+		t.Errorf("Unexpected timings: got %v", result.Timings)
+	}
+
+	failed := ErrorResult(request, fmt.Errorf("connection refused"))
+	if failed.Error != "connection refused" || failed.Status != 0 {
+		t.Errorf("Unexpected error result: got %+v", failed)
+	}
+}
+
+func TestReportJSONBody(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "https://thing.com/thing", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	png := "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+
+	type testConfig struct {
+		contentType      string
+		body             string
+		size             int64
+		noTranscode      bool
+		expectedBody     string
+		expectedEncoding string
+		expectedTrunc    int64
+	}
+
+	tests := map[string]testConfig{
+		"text": {
+			contentType:      "application/json",
+			body:             `{"id": 1}`,
+			size:             9,
+			expectedBody:     `{"id": 1}`,
+			expectedEncoding: BodyEncodingUTF8,
+		},
+		"binary": {
+			contentType:      "image/png",
+			body:             png,
+			size:             int64(len(png)),
+			expectedBody:     base64.StdEncoding.EncodeToString([]byte(png)),
+			expectedEncoding: BodyEncodingBase64,
+		},
+		"invalid utf-8 text": {
+			contentType:      "text/plain; charset=iso-8859-1",
+			body:             "caf\xe9",
+			size:             4,
+			noTranscode:      true,
+			expectedBody:     base64.StdEncoding.EncodeToString([]byte("caf\xe9")),
+			expectedEncoding: BodyEncodingBase64,
+		},
+		"truncated binary": {
+			contentType:      "image/png",
+			body:             png,
+			size:             1000,
+			expectedBody:     base64.StdEncoding.EncodeToString([]byte(png)),
+			expectedEncoding: BodyEncodingBase64,
+			expectedTrunc:    1000 - int64(len(png)),
+		},
+		"empty": {
+			contentType: "text/plain",
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			response := &http.Response{
+				Status:     "200 OK",
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": {cfg.contentType}},
+			}
+			rep := New(request, response, cfg.body, &trace.Timings{}, &Presentation{Format: FormatJSON, NoTranscode: cfg.noTranscode})
+			rep.SetResponseBodySize(cfg.size)
+			err := rep.Build()
+			if err != nil {
+				t.Errorf("Error building report: %v", err)
+			}
+			if !utf8.ValidString(rep.String()) {
+				t.Errorf("JSON output is not valid UTF-8: %q", rep.String())
+			}
+
+			result := &Result{}
+			err = json.Unmarshal([]byte(rep.String()), result)
+			if err != nil {
+				t.Fatalf("Error decoding JSON output: %v\n%v", err, rep.String())
+			}
+			if result.Body != cfg.expectedBody || result.BodyEncoding != cfg.expectedEncoding || result.BodyTruncated != cfg.expectedTrunc {
+				t.Errorf("Unexpected body: got %q (%s, %d truncated), want %q (%s, %d truncated)", result.Body, result.BodyEncoding, result.BodyTruncated, cfg.expectedBody, cfg.expectedEncoding, cfg.expectedTrunc)
+			}
+		})
+	}
+}
+
+func TestReportKeepBody(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "https://thing.com/thing", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	type testConfig struct {
+		policy      string
+		contentType string
+		body        string
+		expected    Result
+	}
+
+	tests := map[string]testConfig{
+		"full": {
+			policy:      "full",
+			contentType: "text/plain",
+			body:        "hello world",
+			expected:    Result{Body: "hello world", BodyEncoding: BodyEncodingUTF8, BodyPolicy: "full"},
+		},
+		"truncated text": {
+			policy:      "truncated:4",
+			contentType: "text/plain",
+			body:        "caf\u00e9 au lait",
+			expected:    Result{Body: "caf", BodyEncoding: BodyEncodingUTF8, BodyTruncated: 10, BodyPolicy: "truncated:4"},
+		},
+		"truncated binary": {
+			policy:      "truncated:4",
+			contentType: "image/png",
+			body:        "\x89PNG\r\n\x1a\n",
+			expected:    Result{Body: base64.StdEncoding.EncodeToString([]byte("\x89PNG")), BodyEncoding: BodyEncodingBase64, BodyTruncated: 4, BodyPolicy: "truncated:4"},
+		},
+		"hash only": {
+			policy:      "hash-only",
+			contentType: "text/plain",
+			body:        "hello world",
+			expected:    Result{BodySHA256: "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", BodyPolicy: "hash-only"},
+		},
+		"none": {
+			policy:      "none",
+			contentType: "text/plain",
+			body:        "hello world",
+			expected:    Result{BodyPolicy: "none"},
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			policy, err := ParseBodyPolicy(cfg.policy)
+			if err != nil {
+				t.Fatalf("Error parsing body policy: %v", err)
+			}
+			response := &http.Response{
+				Status:     "200 OK",
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": {cfg.contentType}},
+			}
+			rep := New(request, response, cfg.body, &trace.Timings{}, &Presentation{Format: FormatJSON, KeepBody: policy})
+			rep.SetBodySHA256("b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9")
+			err = rep.Build()
+			if err != nil {
+				t.Errorf("Error building report: %v", err)
+			}
+
+			result := rep.Result()
+			got := Result{Body: result.Body, BodyEncoding: result.BodyEncoding, BodyTruncated: result.BodyTruncated, BodySHA256: result.BodySHA256, BodyPolicy: result.BodyPolicy}
+			if !reflect.DeepEqual(got, cfg.expected) {
+				t.Errorf("Unexpected body: got %+v, want %+v", got, cfg.expected)
+			}
+		})
+	}
+
+	for _, spec := range []string{"truncated", "truncated:-1", "hash-only:5", "all"} {
+		if _, err := ParseBodyPolicy(spec); err == nil {
+			t.Errorf("Expected an error parsing body policy %q", spec)
+		}
+	}
+}
+
+func TestReportBodySkipped(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "https://thing.com/large", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	response := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		Header:     http.Header{},
+	}
+
+	for _, format := range []string{FormatText, FormatJSON} {
+		report := New(request, response, "", &trace.Timings{}, &Presentation{Format: format})
+		report.SetBodySkipped()
+		err = report.Build()
+		if err != nil {
+			t.Errorf("Error building report: %v", err)
+		}
+
+		if format == FormatText && !strings.Contains(report.String(), "[body not downloaded]") {
+			t.Errorf("Text report does not note the body was skipped:\n%v", report.String())
+		}
+		if format == FormatJSON && !report.Result().BodySkipped {
+			t.Errorf("JSON result does not note the body was skipped: got %+v", report.Result())
+		}
+	}
+}
+
+type testReportRange struct {
+	status          int
+	contentRange    string
+	bodySize        int64
+	expectedText    string
+	expectedWarning string
+}
+
+func TestReportRange(t *testing.T) {
+	tests := map[string]testReportRange{
+		"will note a range the server honored": {
+			status:       http.StatusPartialContent,
+			contentRange: "bytes 0-1023/4096",
+			bodySize:     1024,
+			expectedText: "[range bytes=0-1023 honored, bytes 0-1023/4096: 1024 bytes read at 10.00 KiB/s]",
+		},
+		"will warn about a range the server ignored": {
+			status:          http.StatusOK,
+			bodySize:        4096,
+			expectedText:    "[range bytes=0-1023 not honored: 4096 bytes read at 40.00 KiB/s]",
+			expectedWarning: "the server ignored the range bytes=0-1023 and sent the whole body, 4096 bytes",
+		},
+		"will warn about a range which is not satisfiable": {
+			status:          http.StatusRequestedRangeNotSatisfiable,
+			contentRange:    "bytes */512",
+			expectedText:    "[range bytes=0-1023 not honored: 0 bytes read at 0.00 B/s]",
+			expectedWarning: "the range bytes=0-1023 is not satisfiable, the server has bytes */512",
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			request, err := http.NewRequest(http.MethodGet, "https://thing.com/file", nil)
+			if err != nil {
+				t.Errorf("Error creating http request: %v", err)
+			}
+			request.Header.Set("Range", "bytes=0-1023")
+
+			response := &http.Response{
+				Status:     http.StatusText(cfg.status),
+				StatusCode: cfg.status,
+				Proto:      "HTTP/1.1",
+				Header:     http.Header{},
+			}
+			if cfg.contentRange != "" {
+				response.Header.Set("Content-Range", cfg.contentRange)
+			}
+
+			report := New(request, response, "", &trace.Timings{ResponseReadDuration: 100 * time.Millisecond}, &Presentation{Sections: Sections(nil).Hide(SectionBody)})
+			report.SetResponseBodySize(cfg.bodySize)
+			err = report.Build()
+			if err != nil {
+				t.Errorf("Error building report: %v", err)
+			}
+
+			if !strings.Contains(report.String(), cfg.expectedText) {
+				t.Errorf("Report does not describe the range, want %q in:\n%v", cfg.expectedText, report.String())
+			}
+			warnings := report.Result().Warnings
+			if cfg.expectedWarning == "" && len(warnings) > 0 {
+				t.Errorf("Unexpected warnings: got %v", warnings)
+			}
+			if cfg.expectedWarning != "" && (len(warnings) != 1 || warnings[0] != cfg.expectedWarning) {
+				t.Errorf("Unexpected warnings: got %v, want %v", warnings, cfg.expectedWarning)
+			}
+		})
+	}
+}
+
+func TestReportExpectContinue(t *testing.T) {
+	request, err := http.NewRequest(http.MethodPut, "https://thing.com/upload", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	response := &http.Response{
+		Status:     "201 Created",
+		StatusCode: http.StatusCreated,
+		Proto:      "HTTP/1.1",
+		Header:     http.Header{},
+	}
+	timings := &trace.Timings{ContinueDuration: 40 * time.Millisecond}
+
+	approved := New(request, response, "", timings, &Presentation{})
+	approved.SetEvents([]trace.Event{{Name: "Wait100Continue"}, {Name: "Got100Continue"}})
+	err = approved.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+	if !strings.Contains(approved.String(), "      100 Continue:        40.00ms\n") {
+		t.Errorf("Report does not show the 100 Continue wait:\n%v", approved.String())
+	}
+	if approved.Result().Timings["continue"] != 0.04 || len(approved.Result().Warnings) > 0 {
+		t.Errorf("Unexpected result: got timings %v, warnings %v", approved.Result().Timings, approved.Result().Warnings)
+	}
+
+	unanswered := New(request, response, "", &trace.Timings{}, &Presentation{})
+	unanswered.SetEvents([]trace.Event{{Name: "Wait100Continue"}, {Name: "WroteRequest"}, {Name: "GotFirstResponseByte"}})
+	err = unanswered.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+	if strings.Contains(unanswered.String(), "100 Continue:") {
+		t.Errorf("Report shows a 100 Continue wait which wasn't answered:\n%v", unanswered.String())
+	}
+	if _, ok := unanswered.Result().Timings["continue"]; ok || len(unanswered.Result().Warnings) != 1 {
+		t.Errorf("Unexpected result: got timings %v, warnings %v", unanswered.Result().Timings, unanswered.Result().Warnings)
+	}
+
+	rejected := New(request, response, "", &trace.Timings{}, &Presentation{})
+	rejected.SetEvents([]trace.Event{{Name: "Wait100Continue"}, {Name: "GotFirstResponseByte"}})
+	err = rejected.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+	if warnings := rejected.Result().Warnings; len(warnings) != 1 || !strings.Contains(warnings[0], "so it was not sent") {
+		t.Errorf("Unexpected warnings: got %v", warnings)
+	}
+}
+
+func TestReportTrailers(t *testing.T) {
+	request, err := http.NewRequest(http.MethodPost, "https://thing.com/rpc", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	response := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		Header:     http.Header{"Trailer": {"Grpc-Status, Grpc-Message"}},
+		Trailer:    http.Header{"Grpc-Status": {"0"}, "Grpc-Message": nil},
+	}
+	timings := &trace.Timings{TrailerDuration: 5 * time.Millisecond}
+
+	rep := New(request, response, "{}", timings, &Presentation{})
+	err = rep.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+	if !strings.Contains(rep.String(), "[trailers]\n< Grpc-Status: 0\n") || strings.Contains(rep.String(), "Grpc-Message:") {
+		t.Errorf("Report does not show the received trailers:\n%v", rep.String())
+	}
+	if !strings.Contains(rep.String(), "      Trailers:             5.00ms\n") {
+		t.Errorf("Report does not show the trailer timing:\n%v", rep.String())
+	}
+	result := rep.Result()
+	if !reflect.DeepEqual(result.Trailers, http.Header{"Grpc-Status": {"0"}}) || result.Timings["trailers"] != 0.005 {
+		t.Errorf("Unexpected result: got trailers %v, timings %v", result.Trailers, result.Timings)
+	}
+
+	none := New(request, &http.Response{Status: "200 OK", StatusCode: http.StatusOK, Header: http.Header{}}, "", &trace.Timings{}, &Presentation{})
+	err = none.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+	if strings.Contains(none.String(), "Trailers:") || strings.Contains(none.String(), "[trailers]") {
+		t.Errorf("Report shows trailers which weren't received:\n%v", none.String())
+	}
+	if _, ok := none.Result().Timings["trailers"]; ok {
+		t.Errorf("Unexpected trailer timing: got %v", none.Result().Timings)
+	}
+}
+
+func TestReportWidth(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "https://thing.com/things/with/a/rather/long/path/to/them/all", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	response := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		Header: http.Header{
+			"Content-Security-Policy": {"default-src 'self'; img-src 'self' https://images.thing.com; script-src 'self'"},
+		},
+	}
+
+	type testConfig struct {
+		width    int
+		expected []string
+	}
+
+	tests := map[string]testConfig{
+		"no limit": {
+			width: 0,
+			expected: []string{
+				"> GET thing.com/things/with/a/rather/long/path/to/them/all HTTP/1.1\n",
+				"< Content-Security-Policy: default-src 'self'; img-src 'self' https://images.thing.com; script-src 'self'\n",
+			},
+		},
+		"narrow": {
+			width: 60,
+			expected: []string{
+				"> GET thing.com/things/with...long/path/to/them/all HTTP/1.1\n",
+				"< Content-Security-Policy: default-src 'self'; img-src\n",
+				"<                          'self' https://images.thing.com;\n",
+				"<                          script-src 'self'\n",
+			},
+		},
+		"too narrow to fit": {
+			width: 30,
+			expected: []string{
+				"< Content-Security-Policy: default-src 'self'; img-src 'self' https://images.thing.com; script-src 'self'\n",
+			},
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			rep := New(request, response, "", &trace.Timings{}, &Presentation{Width: cfg.width})
+			err := rep.Build()
+			if err != nil {
+				t.Errorf("Error building report: %v", err)
+			}
+			for _, line := range cfg.expected {
+				if !strings.Contains(rep.String(), line) {
+					t.Errorf("Report does not contain %q:\n%v", line, rep.String())
+				}
+			}
+			for _, line := range strings.Split(rep.String(), "\n") {
+				if cfg.width >= minFitWidth+len("< Content-Security-Policy: ") && len(line) > cfg.width {
+					t.Errorf("Line is longer than %d: %q", cfg.width, line)
+				}
+			}
+		})
+	}
+}
+
+func TestReportChunks(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "https://thing.com/stream", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	response := &http.Response{
+		Status:           "200 OK",
+		StatusCode:       http.StatusOK,
+		Proto:            "HTTP/1.1",
+		Header:           http.Header{},
+		TransferEncoding: []string{"chunked"},
+	}
+	chunks := []trace.Chunk{
+		{Offset: 100 * time.Millisecond, Size: 10},
+		{Offset: 120 * time.Millisecond, Size: 20},
+		{Offset: 1120 * time.Millisecond, Size: 30},
+		{Offset: 1130 * time.Millisecond, Size: 40},
+	}
+
+	rep := New(request, response, "", &trace.Timings{}, &Presentation{})
+	rep.SetChunks(chunks)
+	err = rep.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+	expected := `
+Chunks
+  Count:                       4
+  First chunk:            100.00ms
+  Last chunk:            1130.00ms
+  Largest gap:           1000.00ms after 30 bytes`
+	if !strings.HasSuffix(rep.String(), expected+"\n") {
+		t.Errorf("Report does not end with the chunk cadence:\n%v", rep.String())
+	}
+
+	result := rep.Result()
+	want := &Chunks{Count: 4, First: 0.1, Last: 1.13, LargestGap: 1, GapAfter: 30}
+	if !reflect.DeepEqual(result.Chunks, want) {
+		t.Errorf("Unexpected chunks: got %+v, want %+v", result.Chunks, want)
+	}
+
+	hidden := New(request, response, "", &trace.Timings{}, &Presentation{Sections: Sections(nil).Hide(SectionChunks)})
+	hidden.SetChunks(chunks)
+	err = hidden.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+	if strings.Contains(hidden.String(), "Chunks") || hidden.Result().Chunks != nil {
+		t.Errorf("Report shows hidden chunks:\n%v", hidden.String())
+	}
+}
+
+func TestReportHeaderOrder(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "https://thing.com/things", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	response := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		Header: http.Header{
+			"Age":                       {"12"},
+			"Content-Type":              {"application/json"},
+			"X-Cache":                   {"HIT"},
+			"X-Amz-Cf-Id":               {"f4lqRxCn7EMtJfVJU5sQbmqpuXy3Rk5e"},
+			"Strict-Transport-Security": {"max-age=31536000"},
+		},
+	}
+
+	type testConfig struct {
+		order    string
+		group    bool
+		expected string
+	}
+
+	tests := map[string]testConfig{
+		"by name": {
+			order: HeaderOrderName,
+			expected: `< Age: 12
+< Content-Type: application/json
+< Strict-Transport-Security: max-age=31536000
+< X-Amz-Cf-Id: f4lqRxCn7EMtJfVJU5sQbmqpuXy3Rk5e
+< X-Cache: HIT
+`,
+		},
+		"by size": {
+			order: HeaderOrderSize,
+			expected: `< X-Amz-Cf-Id: f4lqRxCn7EMtJfVJU5sQbmqpuXy3Rk5e
+< Strict-Transport-Security: max-age=31536000
+< Content-Type: application/json
+< X-Cache: HIT
+< Age: 12
+`,
+		},
+		"by name grouped": {
+			order: HeaderOrderName,
+			group: true,
+			expected: `< Age: 12
+< Content-Type: application/json
+< Strict-Transport-Security: max-age=31536000
+[custom headers]
+< X-Amz-Cf-Id: f4lqRxCn7EMtJfVJU5sQbmqpuXy3Rk5e
+< X-Cache: HIT
+`,
+		},
+		"by size grouped": {
+			order: HeaderOrderSize,
+			group: true,
+			expected: `< Strict-Transport-Security: max-age=31536000
+< Content-Type: application/json
+< Age: 12
+[custom headers]
+< X-Amz-Cf-Id: f4lqRxCn7EMtJfVJU5sQbmqpuXy3Rk5e
+< X-Cache: HIT
+`,
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			rep := New(request, response, "", &trace.Timings{}, &Presentation{
+				Sections:     Sections{SectionHeaders: true},
+				HeaderOrder:  cfg.order,
+				GroupHeaders: cfg.group,
+			})
+			err := rep.Build()
+			if err != nil {
+				t.Errorf("Error building report: %v", err)
+			}
+			if rep.String() != cfg.expected {
+				t.Errorf("Unexpected headers:\ngot:\n%v\nwant:\n%v", rep.String(), cfg.expected)
+			}
+		})
+	}
+}
+
+func TestReportLocalAddr(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "https://thing.com/things", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	response := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		Header:     http.Header{},
+	}
+
+	rep := New(request, response, "", &trace.Timings{}, &Presentation{Sections: Sections{SectionTrace: true, SectionConnection: true}})
+	rep.SetLocalAddr(&net.TCPAddr{IP: net.ParseIP("10.8.0.2"), Port: 53412})
+	err = rep.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+	if !strings.Contains(rep.String(), "    Connection\n      Local address:   10.8.0.2:53412\n      DNS Resolution:") {
+		t.Errorf("Report does not show the local address:\n%v", rep.String())
+	}
+	if rep.Result().LocalAddr != "10.8.0.2:53412" {
+		t.Errorf("Unexpected local address: got %v", rep.Result().LocalAddr)
+	}
+
+	unset := New(request, response, "", &trace.Timings{}, &Presentation{})
+	err = unset.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+	if strings.Contains(unset.String(), "Local address:") {
+		t.Errorf("Report shows a local address which wasn't set:\n%v", unset.String())
+	}
+}
+
+func TestReportConnectionIdle(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "https://thing.com/things", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	response := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		Header:     http.Header{},
+	}
+
+	rep := New(request, response, "", &trace.Timings{}, &Presentation{Sections: Sections{SectionTrace: true, SectionConnection: true}})
+	rep.SetConnectionReused(true)
+	rep.SetConnectionIdleTime(1500 * time.Millisecond)
+	err = rep.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+	if !strings.Contains(rep.String(), "    Connection\n      Idle in pool:      1500.00ms\n      DNS Resolution:") {
+		t.Errorf("Report does not show the idle time:\n%v", rep.String())
+	}
+	if res := rep.Result(); !res.Reused || res.IdleTime != 1.5 {
+		t.Errorf("Unexpected connection reuse: got %v, idle %v", res.Reused, res.IdleTime)
+	}
+
+	cold := New(request, response, "", &trace.Timings{}, &Presentation{})
+	err = cold.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+	if strings.Contains(cold.String(), "Idle in pool:") {
+		t.Errorf("Report shows an idle time for a new connection:\n%v", cold.String())
+	}
+}
+
+func TestReportDialAttempts(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "https://thing.com/things", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	response := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		Header:     http.Header{},
+	}
+	attempts := []trace.DialAttempt{
+		{Network: "tcp", Addr: "[2001:db8::1]:443", Start: 10 * time.Millisecond, Duration: 310 * time.Millisecond, Err: errors.New("dial tcp [2001:db8::1]:443: operation was canceled"), Done: true},
+		{Network: "tcp", Addr: "192.0.2.1:443", Start: 310 * time.Millisecond, Duration: 20 * time.Millisecond, Done: true, Won: true},
+		{Network: "tcp", Addr: "192.0.2.2:443", Start: 311 * time.Millisecond, Duration: 2 * time.Millisecond, Err: errors.New("connect: connection refused"), Done: true},
+	}
+
+	rep := New(request, response, "", &trace.Timings{ConnectionDialDuration: 320 * time.Millisecond}, &Presentation{Sections: Sections{SectionTrace: true, SectionConnection: true}})
+	rep.SetDialAttempts(attempts)
+	err = rep.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+	expected := `      Connecting:         320.00ms
+        tcp [2001:db8::1]:443       +0.00ms    310.00ms abandoned
+        tcp 192.0.2.1:443         +300.00ms     20.00ms won
+        tcp 192.0.2.2:443         +301.00ms      2.00ms failed: connect: connection refused
+`
+	if !strings.Contains(rep.String(), expected) {
+		t.Errorf("Report does not show the dial attempts:\n%v", rep.String())
+	}
+
+	result := rep.Result()
+	if len(result.DialAttempts) != 3 || result.DialAttempts[1].Outcome != "won" || result.DialAttempts[1].Start != 0.31 || result.DialAttempts[2].Error != "connect: connection refused" {
+		t.Errorf("Unexpected dial attempts: got %+v", result.DialAttempts)
+	}
+
+	single := New(request, response, "", &trace.Timings{}, &Presentation{})
+	single.SetDialAttempts(attempts[1:2])
+	err = single.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+	if strings.Contains(single.String(), "192.0.2.1") || single.Result().DialAttempts != nil {
+		t.Errorf("Report shows a single dial attempt:\n%v", single.String())
+	}
+}
+
+func TestReportCSV(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "https://thing.com/things", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	response := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+	}
+
+	timings := &trace.Timings{
+		DNSDuration:           2 * time.Millisecond,
+		ResponseDelayDuration: 300 * time.Millisecond,
+		TotalRequestDuration:  500 * time.Millisecond,
+	}
+
+	metrics := []*expr.Definition{}
+	parsed, err := expr.ParseDefinition("backend_time = response_delay - dns")
+	if err != nil {
+		t.Fatalf("Error parsing definition: %v", err)
+	}
+	metrics = append(metrics, parsed)
+
+	report := New(request, response, "hello", timings, &Presentation{Format: FormatCSV, Metrics: metrics})
+	err = report.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+
+	header := "url,method,status,error,body_size,dns_ms,connect_ms,tls_ms,connection_ms,request_write_ms,response_delay_ms,response_read_ms,total_ms,backend_time_ms\n"
+	row := "https://thing.com/things,GET,200,,5,2.000,0.000,0.000,0.000,0.000,300.000,0.000,500.000,298.000\n"
+	if report.String() != header+row {
+		t.Errorf("csv output incorrect: got\n%v\n want\n%v\n", report.String(), header+row)
+	}
+
+	b := &strings.Builder{}
+	w := NewCSVWriter(b, metrics, TimeFormat{})
+	err = w.Write(report.Result())
+	if err == nil {
+		err = w.Write(ErrorResult(request, fmt.Errorf("connection refused")))
+	}
+	if err != nil {
+		t.Fatalf("Error writing csv: %v", err)
+	}
+
+	failedRow := "https://thing.com/things,GET,,connection refused,0,,,,,,,,,\n"
+	if b.String() != header+row+failedRow {
+		t.Errorf("csv output incorrect: got\n%v\n want\n%v\n", b.String(), header+row+failedRow)
+	}
+}
+
+func TestReportMirror(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "https://thing.com/things", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+	mirrorRequest, err := http.NewRequest(http.MethodGet, "https://new.thing.com/things", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	response := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+	}
+	mirrorResponse := &http.Response{
+		Status:     "500 Internal Server Error",
+		StatusCode: http.StatusInternalServerError,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+	}
+
+	timings := &trace.Timings{TotalRequestDuration: 200 * time.Millisecond}
+	mirrorTimings := &trace.Timings{TotalRequestDuration: 350 * time.Millisecond}
+
+	presentation := &Presentation{Sections: Sections(nil).Hide(SectionHeaders, SectionBody)}
+	report := New(request, response, `{"id": 1}`, timings, presentation)
+	report.SetMirror(New(mirrorRequest, mirrorResponse, `{"id": 2}`, mirrorTimings, presentation))
+	err = report.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+
+	expected := []string{
+		"Mirror https://new.thing.com/things\n  < 500 Internal Server Error\n",
+		"  ! Divergence: status 200 != 500\n  ! Divergence: body content differs\n",
+		"  total:                  200.00ms    350.00ms   +150.00ms\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(report.String(), e) {
+			t.Errorf("report output incorrect: got\n%v\n want it to contain\n%v\n", report.String(), e)
+		}
+	}
+
+	result := report.Result()
+	if result.Mirror == nil || result.Mirror.Status != http.StatusInternalServerError {
+		t.Errorf("Unexpected mirror result: got %+v", result.Mirror)
+	}
+	if len(result.Divergences) != 2 {
+		t.Errorf("Unexpected divergences: got %v", result.Divergences)
+	}
+
+	report = New(request, response, `{"id": 1}`, timings, presentation)
+	report.SetMirrorError(mirrorRequest, fmt.Errorf("connection refused"))
+	err = report.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+
+	expectedFailure := "Mirror https://new.thing.com/things\n  ! Divergence: mirror request failed: connection refused\n"
+	if !strings.Contains(report.String(), expectedFailure) {
+		t.Errorf("report output incorrect: got\n%v\n want it to contain\n%v\n", report.String(), expectedFailure)
+	}
+	if report.Result().Mirror.Error != "connection refused" {
+		t.Errorf("Unexpected mirror result: got %+v", report.Result().Mirror)
+	}
+}
+
+func TestReportPipe(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "https://thing.com/things", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+	pipeRequest, err := http.NewRequest(http.MethodPost, "https://other.thing.com/import", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	response := &http.Response{Status: "200 OK", StatusCode: http.StatusOK}
+	pipeResponse := &http.Response{Status: "201 Created", StatusCode: http.StatusCreated}
+
+	timings := &trace.Timings{TotalRequestDuration: 200 * time.Millisecond}
+	pipeTimings := &trace.Timings{TotalRequestDuration: 150 * time.Millisecond}
+
+	presentation := &Presentation{Sections: Sections(nil).Hide(SectionHeaders, SectionBody)}
+	report := New(request, response, `{"id": 1}`, timings, presentation)
+	report.SetPipe(New(pipeRequest, pipeResponse, "", pipeTimings, presentation))
+	err = report.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+
+	expected := []string{
+		"Piped response body to POST https://other.thing.com/import\n",
+		"< 201 Created\n",
+		"  Combined total:         350.00ms (200.00ms + 150.00ms)\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(report.String(), e) {
+			t.Errorf("report output incorrect: got\n%v\n want it to contain\n%v\n", report.String(), e)
+		}
+	}
+
+	result := report.Result()
+	if result.PipedTo == nil || result.PipedTo.Status != http.StatusCreated || result.PipedTo.Method != http.MethodPost {
+		t.Errorf("Unexpected piped result: got %+v", result.PipedTo)
+	}
+
+	report = New(request, response, `{"id": 1}`, timings, presentation)
+	report.SetPipeError(pipeRequest, fmt.Errorf("connection refused"))
+	err = report.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+
+	expectedFailure := "Piped response body to POST https://other.thing.com/import\n! Error: connection refused\n"
+	if !strings.Contains(report.String(), expectedFailure) {
+		t.Errorf("report output incorrect: got\n%v\n want it to contain\n%v\n", report.String(), expectedFailure)
+	}
+	if report.Result().PipedTo.Error != "connection refused" {
+		t.Errorf("Unexpected piped result: got %+v", report.Result().PipedTo)
+	}
+}
+
+func TestReportHTML(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "https://thing.com/things", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+	response := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		Header:     http.Header{"Content-Type": {"text/html"}},
+	}
+	timings := &trace.Timings{
+		DNSDuration:            20 * time.Millisecond,
+		ConnectionDialDuration: 30 * time.Millisecond,
+		ResponseDelayDuration:  100 * time.Millisecond,
+		ResponseReadDuration:   50 * time.Millisecond,
+		TotalRequestDuration:   200 * time.Millisecond,
+	}
+
+	report := New(request, response, "<script>alert(1)</script>", timings, &Presentation{Format: FormatHTML})
+	err = report.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+
+	expected := []string{
+		"<title>http-trace GET https://thing.com/things</title>",
+		`<div class="bar bar-dns" style="left: 0.000%; width: 10.000%" title="dns 20.00ms">`,
+		`<div class="bar bar-connect" style="left: 10.000%; width: 15.000%" title="connect 30.00ms">`,
+		`<div class="bar bar-response_read" style="left: 75.000%; width: 25.000%" title="response_read 50.00ms">`,
+		"&lt;script&gt;alert(1)&lt;/script&gt;",
+	}
+	for _, e := range expected {
+		if !strings.Contains(report.String(), e) {
+			t.Errorf("report output incorrect: got\n%v\n want it to contain\n%v\n", report.String(), e)
+		}
+	}
+}
+
+func TestResultSummary(t *testing.T) {
+	result := &Result{
+		URL:      "https://thing.com/things",
+		Method:   http.MethodGet,
+		Status:   http.StatusOK,
+		Proto:    "HTTP/1.1",
+		BodySize: 120,
+		Timings:  map[string]float64{"dns": 0.002, "response_delay": 0.1, "total": 0.15},
+	}
+
+	expected := "GET https://thing.com/things HTTP/1.1 200, 120 bytes\n" +
+		"dns 2.00ms  connect 0.00ms  tls 0.00ms  request_write 0.00ms  response_delay 100.00ms  response_read 0.00ms  total 150.00ms\n"
+	if result.Summary(TimeFormat{}) != expected {
+		t.Errorf("Unexpected summary: got\n%v\nwant\n%v", result.Summary(TimeFormat{}), expected)
+	}
+
+	result = &Result{URL: "https://thing.com/things", Method: http.MethodGet, Error: "timeout"}
+	expected = "GET https://thing.com/things\n! Error: timeout\n"
+	if result.Summary(TimeFormat{}) != expected {
+		t.Errorf("Unexpected summary: got\n%v\nwant\n%v", result.Summary(TimeFormat{}), expected)
+	}
+}
+
+func TestABComparison(t *testing.T) {
+	variant := func(value string, totals ...float64) *Variant {
+		v := &Variant{Value: value}
+		for _, total := range totals {
+			v.Results = append(v.Results, &Result{Timings: map[string]float64{"total": total}})
+		}
+		return v
+	}
+
+	on := variant("on", 0.100, 0.110, 0.105, 0.102, 0.108)
+	off := variant("off", 0.150, 0.160, 0.155, 0.152, 0.158)
+	off.Results = append(off.Results, &Result{Error: "connection refused"})
+
+	b := &bytes.Buffer{}
+	err := WriteABComparison(b, "X-Feature", on, off, nil)
+	if err != nil {
+		t.Fatalf("Error writing comparison: %v", err)
+	}
+
+	expected := []string{
+		"A/B X-Feature (median)\n                                 on          off         diff\n",
+		"  requests:                       5            6\n  failed:                         0            1\n",
+		"  total:                   105.00ms     155.00ms     +50.00ms\n",
+		"off is 50ms (47.6%) slower than on in total, p=0.012 (Mann-Whitney U): significant at the 5% level\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(b.String(), e) {
+			t.Errorf("comparison output incorrect: got\n%v\n want it to contain\n%v\n", b.String(), e)
+		}
+	}
+
+	b.Reset()
+	err = WriteABComparison(b, "X-Feature", on, variant("off"), nil)
+	if err != nil {
+		t.Fatalf("Error writing comparison: %v", err)
+	}
+	if !strings.Contains(b.String(), "Not enough successful requests to compare on and off\n") {
+		t.Errorf("comparison output incorrect: got\n%v\n", b.String())
+	}
+}
+
+func TestURLComparison(t *testing.T) {
+	target := func(url string, totals ...float64) *Target {
+		t := &Target{URL: url}
+		for _, total := range totals {
+			t.Results = append(t.Results, &Result{Timings: map[string]float64{"total": total}})
+		}
+		return t
+	}
+	failed := target("https://down.thing.com")
+	failed.Results = append(failed.Results, &Result{Error: "connection refused"})
+
+	out := &bytes.Buffer{}
+	err := WriteURLComparison(out, []*Target{
+		target("https://eu.thing.com", 0.3, 0.2, 0.4),
+		target("https://us.thing.com", 0.1, 0.15),
+		failed,
+	}, nil)
+	if err != nil {
+		t.Errorf("Error writing comparison: %v", err)
+	}
+
+	expected := []string{
+		"Comparison of 3 URLs (median)\n  #1 https://eu.thing.com\n  #2 https://us.thing.com\n  #3 https://down.thing.com\n",
+		"  requests:                       3           2           1\n",
+		"  failed:                         0           0           1\n",
+		"  total:                   300.00ms    125.00ms           -\n",
+		"Fastest in total: #2 https://us.thing.com (125.00ms)\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(out.String(), e) {
+			t.Errorf("comparison output incorrect: got\n%v\n want it to contain\n%v\n", out.String(), e)
+		}
+	}
+}
+
+func TestAddressComparison(t *testing.T) {
+	target := func(addr string, totals ...float64) *Target {
+		t := &Target{URL: addr}
+		for _, total := range totals {
+			t.Results = append(t.Results, &Result{Timings: map[string]float64{"total": total}})
+		}
+		return t
+	}
+
+	out := &bytes.Buffer{}
+	err := WriteAddressComparison(out, "thing.com", []*Target{
+		target("10.0.0.1", 0.1, 0.12),
+		target("10.0.0.2", 0.35, 0.3),
+		target("2001:db8::1", 0.11),
+	}, nil)
+	if err != nil {
+		t.Errorf("Error writing comparison: %v", err)
+	}
+
+	expected := []string{
+		"Comparison of 3 addresses of thing.com (median)\n  #1 10.0.0.1\n  #2 10.0.0.2\n  #3 2001:db8::1\n",
+		"  total:                   110.00ms    325.00ms    110.00ms\n",
+		"Fastest in total: #1 10.0.0.1 (110.00ms)\n",
+		"Slowest in total: #2 10.0.0.2 (325.00ms, 3.0x the fastest)\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(out.String(), e) {
+			t.Errorf("comparison output incorrect: got\n%v\n want it to contain\n%v\n", out.String(), e)
+		}
+	}
+}
+
+func TestComparisonReceived(t *testing.T) {
+	target := func(url string, received ...int64) *Target {
+		t := &Target{URL: url}
+		for _, r := range received {
+			t.Results = append(t.Results, &Result{Timings: map[string]float64{"total": 0.1}, Wire: &Wire{Received: r}})
+		}
+		return t
+	}
+	a := target("https://a.thing.com", 1024, 2048, 3072)
+	b := target("https://b.thing.com", 512)
+
+	out := &bytes.Buffer{}
+	err := WriteURLComparison(out, []*Target{a, b, {URL: "https://c.thing.com", Results: []*Result{{Error: "timeout"}}}}, nil)
+	if err != nil {
+		t.Fatalf("Error writing comparison: %v", err)
+	}
+	if !strings.Contains(out.String(), "  received:                2.00 KiB    512.00 B           -\n") {
+		t.Errorf("comparison output incorrect: got\n%v", out.String())
+	}
+
+	out.Reset()
+	_, err = WriteDiff(out, a, b, DefaultRegressionThreshold, nil)
+	if err != nil {
+		t.Fatalf("Error writing diff: %v", err)
+	}
+	if !strings.Contains(out.String(), "  received:               2.00 KiB    512.00 B     -1536 B   -75.0%\n") {
+		t.Errorf("diff output incorrect: got\n%v", out.String())
+	}
+
+	out.Reset()
+	err = WriteURLComparison(out, []*Target{{URL: "https://old.thing.com", Results: []*Result{{Timings: map[string]float64{"total": 0.1}}}}}, nil)
+	if err != nil {
+		t.Fatalf("Error writing comparison: %v", err)
+	}
+	if strings.Contains(out.String(), "received:") {
+		t.Errorf("comparison shows bytes received without any wire sizes: got\n%v", out.String())
+	}
+}
+
+func TestURLSummary(t *testing.T) {
+	out := &bytes.Buffer{}
+	err := WriteURLSummary(out, []*Target{
+		{URL: "https://thing.com/a", Results: []*Result{
+			{Method: http.MethodGet, Status: http.StatusOK, Timings: map[string]float64{"connection": 0.05, "response_delay": 0.1, "total": 0.2}},
+		}},
+		{URL: "https://thing.com/b", Results: []*Result{
+			{Method: http.MethodPost, Status: http.StatusCreated, Timings: map[string]float64{"connection": 0.05, "response_delay": 0.3, "total": 0.4}},
+			{Method: http.MethodPost, Error: "timeout"},
+		}},
+	}, nil)
+	if err != nil {
+		t.Errorf("Error writing summary: %v", err)
+	}
+
+	expected := []string{
+		"     1        1      0    200     50.00ms        100.00ms    200.00ms  GET https://thing.com/a\n",
+		"     2        2      1    201     50.00ms        300.00ms    400.00ms  POST https://thing.com/b\n",
+		"Slowest in total: #2 https://thing.com/b (400.00ms)\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(out.String(), e) {
+			t.Errorf("summary output incorrect: got\n%v\n want it to contain\n%v\n", out.String(), e)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	target := func(url string, totals ...float64) *Target {
+		t := &Target{URL: url}
+		for _, total := range totals {
+			t.Results = append(t.Results, &Result{Timings: map[string]float64{"dns": 0.01, "total": total}})
+		}
+		return t
+	}
+
+	out := &bytes.Buffer{}
+	regressed, err := WriteDiff(out, target("https://old.thing.com", 0.2, 0.2, 0.2), target("https://new.thing.com", 0.25, 0.25, 0.25), 0.1, &Presentation{})
+	if err != nil {
+		t.Errorf("Error writing diff: %v", err)
+	}
+	if !regressed {
+		t.Errorf("Expected a regression to be found")
+	}
+
+	expected := []string{
+		"Comparison (median)\n  A https://old.thing.com\n  B https://new.thing.com\n",
+		"  dns:                     10.00ms     10.00ms     +0.00ms    +0.0%\n",
+		"  total:                  200.00ms    250.00ms    +50.00ms   +25.0%  ! regression\n",
+		"B is 50ms (25.0%) slower than A in total",
+	}
+	for _, e := range expected {
+		if !strings.Contains(out.String(), e) {
+			t.Errorf("diff output incorrect: got\n%v\n want it to contain\n%v\n", out.String(), e)
+		}
+	}
+
+	regressed, err = WriteDiff(&bytes.Buffer{}, target("https://old.thing.com", 0.2), target("https://new.thing.com", 0.21), 0.1, nil)
+	if err != nil {
+		t.Errorf("Error writing diff: %v", err)
+	}
+	if regressed {
+		t.Errorf("Expected a change within the threshold not to be a regression")
+	}
+}
+
+func TestRunComparison(t *testing.T) {
+	run := func(name string, base float64, n int) *Target {
+		t := &Target{URL: name}
+		for i := 0; i < n; i++ {
+			total := base + float64(i%5)/1000
+			t.Results = append(t.Results, &Result{Timings: map[string]float64{"dns": 0.01, "total": total}})
+		}
+		return t
+	}
+
+	out := &bytes.Buffer{}
+	regressed, err := WriteRunComparison(out, run("baseline.jsonl", 0.2, 20), run("current.jsonl", 0.25, 20), 0.1, &Presentation{})
+	if err != nil {
+		t.Errorf("Error writing run comparison: %v", err)
+	}
+	if !regressed {
+		t.Errorf("Expected a regression to be found")
+	}
+
+	expected := []string{
+		"Run comparison (median, Mann-Whitney U)\n  A baseline.jsonl\n  B current.jsonl\n",
+		"  dns:                     10.00ms     10.00ms     +0.00ms      [+0.00, +0.00]ms   1.000  +0.00 negligible\n",
+		"  total:                  202.00ms    252.00ms    +50.00ms    [+48.50, +51.50]ms   0.000  +1.00 large  ! regression\n",
+		"! B regressed significantly (p < 0.05) by more than 10% in total\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(out.String(), e) {
+			t.Errorf("run comparison output incorrect: got\n%v\n want it to contain\n%v\n", out.String(), e)
+		}
+	}
+
+	out = &bytes.Buffer{}
+	regressed, err = WriteRunComparison(out, run("baseline.jsonl", 0.2, 3), run("current.jsonl", 0.25, 3), 0.1, nil)
+	if err != nil {
+		t.Errorf("Error writing run comparison: %v", err)
+	}
+	if regressed {
+		t.Errorf("Expected a difference between too few requests not to be significant")
+	}
+	if !strings.Contains(out.String(), "! with fewer than 10 successful requests in each run") {
+		t.Errorf("Expected a warning about too few requests: got\n%v", out.String())
+	}
+}
+
+func TestKeepAlive(t *testing.T) {
+	result := func(reused bool, connection, total float64) *Result {
+		return &Result{Reused: reused, Timings: map[string]float64{"connection": connection, "total": total}}
+	}
+
+	out := &bytes.Buffer{}
+	err := WriteKeepAlive(out, []*Result{
+		result(false, 0.06, 0.1),
+		result(true, 0, 0.04),
+		result(true, 0, 0.05),
+		result(false, 0.06, 0.1),
+		{Error: "timeout"},
+	}, nil)
+	if err != nil {
+		t.Errorf("Error writing keep-alive comparison: %v", err)
+	}
+
+	expected := []string{
+		"Keep-alive (5 requests)\n                              cold        warm        diff\n  requests:                      1           2\n",
+		"  connection:              60.00ms      0.00ms    -60.00ms\n",
+		"  total:                  100.00ms     45.00ms    -55.00ms\n",
+		"Setting up the connection took 60.00ms, 60.0% of the cold request\n",
+		"Warm requests were 55.00ms (55.0%) faster than the cold one in total (median)\n",
+		"! requests which set up a new connection instead of reusing it, as the server closed it: #4\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(out.String(), e) {
+			t.Errorf("keep-alive output incorrect: got\n%v\n want it to contain\n%v\n", out.String(), e)
+		}
+	}
+
+	out = &bytes.Buffer{}
+	err = WriteKeepAlive(out, []*Result{result(false, 0.06, 0.1), result(false, 0.06, 0.1)}, nil)
+	if err != nil {
+		t.Errorf("Error writing keep-alive comparison: %v", err)
+	}
+	if !strings.Contains(out.String(), "No request reused the connection") {
+		t.Errorf("Expected no warm requests: got\n%v", out.String())
+	}
+}
+
+func TestReadResults(t *testing.T) {
+	saved := "# 2026-10-15T09:00:00Z GET https://thing.com\n" +
+		`{"url":"https://thing.com","method":"GET","status":200,"body_size":3,"timings":{"total":0.2}}` + "\n" +
+		"{\n  \"url\": \"https://thing.com\",\n  \"method\": \"GET\",\n  \"error\": \"timeout\",\n  \"body_size\": 0\n}\n"
+
+	results, err := ReadResults(strings.NewReader(saved))
+	if err != nil {
+		t.Fatalf("Error reading results: %v", err)
+	}
+	if len(results) != 2 || results[0].Timings["total"] != 0.2 || results[1].Error != "timeout" {
+		t.Errorf("Unexpected results: got %+v", results)
+	}
+
+	_, err = ReadResults(strings.NewReader("not json"))
+	if err == nil {
+		t.Errorf("Expected an error for invalid results")
+	}
+}
+
+func TestReportJSONLines(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "https://thing.com/things", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	response := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+	}
+
+	report := New(request, response, "line one\nline two", &trace.Timings{TotalRequestDuration: 250 * time.Millisecond}, &Presentation{Format: FormatJSONL, Sections: Sections(nil).Hide(SectionHeaders)})
+	err = report.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+
+	if strings.Count(report.String(), "\n") != 1 || !strings.HasSuffix(report.String(), "\n") {
+		t.Errorf("Expected a single line of JSON: got\n%v", report.String())
+	}
+
+	result := &Result{}
+	err = json.Unmarshal([]byte(report.String()), result)
+	if err != nil {
+		t.Fatalf("Error decoding JSON output: %v\n%v", err, report.String())
+	}
+	if result.Body != "line one\nline two" || result.Timings["total"] != 0.25 {
+		t.Errorf("Unexpected result: got %+v", result)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	aggregate := NewAggregate(0.95, 0.05)
+	for i := 1; i <= 100; i++ {
+		aggregate.Add(&Result{Timings: map[string]float64{"dns": 0.001, "total": float64(i) / 1000}})
+	}
+	aggregate.Add(&Result{Error: "connection refused"})
+
+	b := &bytes.Buffer{}
+	err := aggregate.Write(b, nil)
+	if err != nil {
+		t.Fatalf("Error writing summary: %v", err)
+	}
+
+	expected := []string{
+		"Summary of 101 requests (1 failed)\n",
+		"  dns:                      1.00ms      1.00ms      1.00ms      1.00ms      1.00ms\n",
+		"  total p50:               50.50ms  95% CI [40.00ms, 60.00ms] (±19.8%)\n",
+		"  total p99:               99.01ms  95% CI unbounded with 100 requests\n",
+		"! About 1569 requests are needed for total p50 to be within ±5% at 95% confidence, use -n 1569 or -auto-n\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(b.String(), e) {
+			t.Errorf("summary output incorrect: got\n%v\n want it to contain\n%v\n", b.String(), e)
+		}
+	}
+}
+
+func TestAggregateOutliers(t *testing.T) {
+	aggregate := NewAggregate(0.95, 0.05)
+	for i := 0; i < 9; i++ {
+		aggregate.Add(&Result{Timings: map[string]float64{"response_delay": 0.09, "total": 0.1}})
+	}
+	aggregate.Add(&Result{
+		Body:    "kept out of the aggregate",
+		Timings: map[string]float64{"connect": 0.3, "response_delay": 0.09, "total": 0.4},
+		Events: []Event{
+			{Name: "GetConn", Offset: 0, Detail: "thing.com:443"},
+			{Name: "ConnectDone", Offset: 0.3, Detail: "tcp 10.0.0.1:443"},
+			{Name: "GotFirstResponseByte", Offset: 0.39},
+		},
+	})
+
+	b := &bytes.Buffer{}
+	err := aggregate.Write(b, nil)
+	if err != nil {
+		t.Fatalf("Error writing summary: %v", err)
+	}
+
+	expected := `Outliers (total over 3× the median of 100.00ms)
+  #10 total 400.00ms, 4.0× the median, mostly connect
+    dns 0.00ms, connect 300.00ms, tls 0.00ms, request_write 0.00ms, response_delay 90.00ms, response_read 0.00ms
+         0.00ms GetConn thing.com:443
+       300.00ms ConnectDone tcp 10.0.0.1:443
+       390.00ms GotFirstResponseByte
+`
+	if !strings.Contains(b.String(), expected) {
+		t.Errorf("summary output incorrect: got\n%v\n want it to contain\n%v\n", b.String(), expected)
+	}
+	if strings.Contains(b.String(), "kept out") {
+		t.Errorf("Expected the body not to be kept")
+	}
+}
+
+type testWriteOut struct {
+	format        string
+	expected      string
+	expectedError string
+}
+
+func TestReportWriteOut(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "https://thing.com/things", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	response := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/2.0",
+		Header:     http.Header{"Content-Type": {"application/json"}},
+	}
+
+	timings := &trace.Timings{
+		DNSDuration:             10 * time.Millisecond,
+		ConnectionDialDuration:  20 * time.Millisecond,
+		TLSDuration:             30 * time.Millisecond,
+		TotalConnectionDuration: 60 * time.Millisecond,
+		RequestWriteDuration:    1 * time.Millisecond,
+		ResponseDelayDuration:   100 * time.Millisecond,
+		ResponseReadDuration:    39 * time.Millisecond,
+		TotalRequestDuration:    200 * time.Millisecond,
+	}
+
+	tests := map[string]testWriteOut{
+		"will write cumulative times like curl": {
+			format:   `%{time_namelookup} %{time_connect} %{time_appconnect} %{time_starttransfer} %{time_total}\n`,
+			expected: "0.010000 0.030000 0.060000 0.161000 0.200000\n",
+		},
+		"will write the response details": {
+			format:   `%{http_code} %{http_version} %{content_type} %{size_download} bytes, 100%%`,
+			expected: "200 2 application/json 9 bytes, 100%",
+		},
+		"will fail on unknown variables": {
+			format:        `%{time_nonsense}`,
+			expectedError: `unknown write-out variable "time_nonsense"`,
+		},
+		"will fail on unterminated variables": {
+			format:        `%{time_total`,
+			expectedError: "unterminated variable",
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			writeOut, err := ParseWriteOut(cfg.format)
+			if cfg.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), cfg.expectedError) {
+					t.Errorf("Unexpected error: got %v, want %v", err, cfg.expectedError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			report := New(request, response, `{"id": 1}`, timings, &Presentation{Sections: Sections(nil).Hide(SectionHeaders), WriteOut: writeOut})
+			err = report.Build()
+			if err != nil {
+				t.Errorf("Error building report: %v", err)
+			}
+
+			if report.String() != cfg.expected {
+				t.Errorf("write-out incorrect: got %q, want %q", report.String(), cfg.expected)
+			}
+		})
+	}
+
+	writeOut, err := ParseWriteOut(`%{http_code} %{errormsg}`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	b := &bytes.Buffer{}
+	err = writeOut.Write(b, ErrorResult(request, fmt.Errorf("connection refused")), nil)
+	if err != nil || b.String() != "000 connection refused" {
+		t.Errorf("write-out incorrect for a failed request: got %q (%v)", b.String(), err)
+	}
+}
+
+func TestReportColor(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "https://thing.com", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	response := &http.Response{
+		Status:     "503 Service Unavailable",
+		StatusCode: http.StatusServiceUnavailable,
+		Header:     http.Header{"Retry-After": {"10"}},
+	}
+
+	timings := &trace.Timings{
+		DNSDuration:           20 * time.Millisecond,
+		ResponseDelayDuration: 150 * time.Millisecond,
+		TotalRequestDuration:  600 * time.Millisecond,
+	}
+
+	report := New(request, response, "", timings, &Presentation{Sections: Sections(nil).Hide(SectionBody), Color: true})
+	err = report.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+
+	expected := []string{
+		"< \x1b[31m503 Service Unavailable\x1b[0m\n",
+		"< \x1b[2mRetry-After\x1b[0m: 10\n",
+		"DNS Resolution:  \x1b[32m    20.00ms\x1b[0m\n",
+		"TLS handshake:        0.00ms\n",
+		"Response delay:    \x1b[33m   150.00ms\x1b[0m\n",
+		"Request total:       \x1b[31m   600.00ms\x1b[0m\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(report.String(), e) {
+			t.Errorf("report output incorrect: got\n%q\n want it to contain\n%q\n", report.String(), e)
+		}
+	}
+
+	report = New(request, response, "", timings, &Presentation{Sections: Sections(nil).Hide(SectionBody), Color: true, SlowThreshold: time.Second, VerySlowThreshold: 2 * time.Second})
+	err = report.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+	if !strings.Contains(report.String(), "Request total:       \x1b[32m   600.00ms\x1b[0m\n") {
+		t.Errorf("Expected thresholds to be configurable: got\n%q", report.String())
+	}
+}
+
+func TestAggregateWarmAndCold(t *testing.T) {
+	aggregate := NewAggregate(0.95, 0.05)
+	aggregate.Add(&Result{Timings: map[string]float64{"dns": 0.05, "connection": 0.1, "total": 0.2}})
+	for i := 0; i < 4; i++ {
+		aggregate.Add(&Result{Reused: true, Timings: map[string]float64{"total": 0.1}})
+	}
+
+	b := &bytes.Buffer{}
+	err := aggregate.Write(b, nil)
+	if err != nil {
+		t.Fatalf("Error writing summary: %v", err)
+	}
+
+	expected := []string{
+		"\nCold, new connection (1 requests)\n",
+		"  dns:                     50.00ms     50.00ms     50.00ms     50.00ms     50.00ms\n",
+		"\nWarm, reused connection (4 requests)\n",
+		"  total:                  100.00ms    100.00ms    100.00ms    100.00ms    100.00ms\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(b.String(), e) {
+			t.Errorf("summary output incorrect: got\n%v\n want it to contain\n%v\n", b.String(), e)
+		}
+	}
+
+	aggregate = NewAggregate(0.95, 0.05)
+	aggregate.Add(&Result{Timings: map[string]float64{"total": 0.1}})
+	b.Reset()
+	err = aggregate.Write(b, nil)
+	if err != nil {
+		t.Fatalf("Error writing summary: %v", err)
+	}
+	if strings.Contains(b.String(), "Cold") {
+		t.Errorf("Expected no split when all connections are new: got\n%v", b.String())
+	}
+}
+
+func TestReportWireSizes(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "https://thing.com/things", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	response := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		Header:     http.Header{},
+	}
+
+	rep := New(request, response, "hello", &trace.Timings{}, &Presentation{Sections: Sections{SectionTrace: true}})
+	rep.SetWireSizes(&trace.WireSizes{Sent: 312, Received: 1256, Setup: 5211})
+	err = rep.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+	expected := `
+Wire
+  Sent:                      312 bytes
+  Received:                 1256 bytes, 5 of the body
+  Connection setup:         5211 bytes`
+	if !strings.Contains(rep.String(), expected) {
+		t.Errorf("Report does not show the wire sizes:\n%v", rep.String())
+	}
+	if wire := rep.Result().Wire; wire == nil || *wire != (Wire{Sent: 312, Received: 1256, Setup: 5211}) {
+		t.Errorf("Unexpected wire sizes: got %+v", wire)
+	}
+
+	reused := New(request, response, "hello", &trace.Timings{}, &Presentation{Sections: Sections{SectionTrace: true}})
+	reused.SetWireSizes(&trace.WireSizes{Sent: 80, Received: 120})
+	err = reused.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+	if strings.Contains(reused.String(), "Connection setup:") {
+		t.Errorf("Report shows connection setup for a reused connection:\n%v", reused.String())
+	}
+
+	split := New(request, response, "hello", &trace.Timings{}, &Presentation{Sections: Sections{SectionTrace: true}})
+	split.SetWireSizes(&trace.WireSizes{Sent: 312, Received: 1256, RequestHead: 212, RequestBody: 100, ResponseHead: 1253, ResponseBody: 3})
+	err = split.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+	expected = `
+Wire
+  Sent:                      312 bytes
+    Head:                    212 bytes
+    Body:                    100 bytes
+  Received:                 1256 bytes
+    Head:                   1253 bytes
+    Body:                      3 bytes, 5 decoded
+`
+	if !strings.Contains(split.String(), expected) {
+		t.Errorf("Report does not show the head and body sizes:\n%v", split.String())
+	}
+	if wire := split.Result().Wire; wire == nil || wire.RequestBody != 100 || wire.ResponseBody != 3 {
+		t.Errorf("Unexpected wire sizes: got %+v", wire)
+	}
+
+	hidden := New(request, response, "hello", &trace.Timings{}, &Presentation{Sections: Sections{SectionStatus: true}})
+	hidden.SetWireSizes(&trace.WireSizes{Sent: 80, Received: 120})
+	err = hidden.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+	if strings.Contains(hidden.String(), "Wire") || hidden.Result().Wire != nil {
+		t.Errorf("Wire sizes shown without the trace section:\n%v", hidden.String())
+	}
+}
+
+func TestReportTCPInfo(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "https://thing.com/things", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	response := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		Header:     http.Header{},
+	}
+	info := &trace.TCPInfo{RTT: 12310 * time.Microsecond, RTTVar: 3200 * time.Microsecond, Retransmits: 4, CongestionWindow: 14480}
+
+	rep := New(request, response, "", &trace.Timings{}, &Presentation{Sections: Sections{SectionTrace: true, SectionConnection: true}})
+	rep.SetTCPInfo(info)
+	err = rep.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+	expected := `
+TCP
+  Round trip:              12.31ms
+  Round trip var:           3.20ms
+  Retransmits:                 4
+  Congestion window:       14480 bytes`
+	if !strings.Contains(rep.String(), expected) {
+		t.Errorf("Report does not show the TCP statistics:\n%v", rep.String())
+	}
+	if tcp := rep.Result().TCP; tcp == nil || *tcp != (TCP{RTT: 0.01231, RTTVar: 0.0032, Retransmits: 4, CongestionWindow: 14480}) {
+		t.Errorf("Unexpected TCP statistics: got %+v", tcp)
+	}
+
+	hidden := New(request, response, "", &trace.Timings{}, &Presentation{Sections: Sections{SectionTrace: true}})
+	hidden.SetTCPInfo(info)
+	err = hidden.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+	if strings.Contains(hidden.String(), "TCP") || hidden.Result().TCP != nil {
+		t.Errorf("TCP statistics shown without the connection section:\n%v", hidden.String())
+	}
+}
+
+func TestReportDNSQueries(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "https://thing.com/things", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	response := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		Header:     http.Header{},
+	}
+	// Recorded as they were answered, the first after the server timed out
+	queries := []trace.DNSQuery{
+		{Server: "10.0.0.2:53", Name: "thing.com.corp.example.", Type: "A", Start: 2 * time.Millisecond, Duration: 40 * time.Millisecond, DNSAnswer: trace.DNSAnswer{Outcome: "NXDOMAIN"}},
+		{Server: "10.0.0.2:53", Name: "thing.com.", Type: "A", Start: 42 * time.Millisecond, Duration: 11 * time.Millisecond, DNSAnswer: trace.DNSAnswer{Outcome: "NOERROR", Answers: 2}},
+		{Server: "10.0.0.3:53", Name: "thing.com.corp.example.", Type: "A", Start: 1 * time.Millisecond, Duration: time.Millisecond, DNSAnswer: trace.DNSAnswer{Outcome: "timeout"}},
+	}
+
+	rep := New(request, response, "", &trace.Timings{}, &Presentation{Sections: Sections{SectionTrace: true, SectionConnection: true}})
+	rep.SetDNSQueries(queries)
+	err = rep.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+	expected := `
+      DNS Resolution:       0.00ms
+        A thing.com.corp.example.           +0.00ms      1.00ms timeout from 10.0.0.3:53
+        A thing.com.corp.example.           +1.00ms     40.00ms NXDOMAIN from 10.0.0.2:53
+        A thing.com.                       +41.00ms     11.00ms NOERROR, 2 in answer from 10.0.0.2:53
+        A records:         52.00ms
+        Answered by:   10.0.0.2:53
+      Connecting:`
+	if !strings.Contains(rep.String(), expected) {
+		t.Errorf("Report does not show the DNS queries:\n%v", rep.String())
+	}
+
+	res := rep.Result()
+	if len(res.DNSQueries) != 3 {
+		t.Fatalf("Unexpected DNS queries: got %+v", res.DNSQueries)
+	}
+	expectedQuery := DNSQuery{Server: "10.0.0.2:53", Name: "thing.com.", Type: "A", Start: 0.042, Duration: 0.011, Outcome: "NOERROR", Answers: 2}
+	if res.DNSQueries[2] != expectedQuery {
+		t.Errorf("Unexpected DNS query: got %+v, want %+v", res.DNSQueries[2], expectedQuery)
+	}
+
+	// Of an encrypted resolver, which had to be connected to for the query
+	encrypted := []trace.DNSQuery{
+		{Server: "https://1.1.1.1/dns-query", Name: "thing.com.", Type: "A", Duration: 30 * time.Millisecond, DNSAnswer: trace.DNSAnswer{Outcome: "NOERROR", Answers: 1, Connect: 8 * time.Millisecond, TLSHandshake: 15 * time.Millisecond}},
+		{Server: "https://1.1.1.1/dns-query", Name: "thing.com.", Type: "AAAA", Start: 31 * time.Millisecond, Duration: 6 * time.Millisecond, DNSAnswer: trace.DNSAnswer{Outcome: "NOERROR"}},
+	}
+	rep = New(request, response, "", &trace.Timings{}, &Presentation{Sections: Sections{SectionTrace: true, SectionConnection: true}})
+	rep.SetDNSQueries(encrypted)
+	err = rep.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+	expected = `
+        A thing.com.                        +0.00ms     30.00ms NOERROR, 1 in answer from https://1.1.1.1/dns-query, connecting 8.00ms and TLS handshake 15.00ms
+        AAAA thing.com.                    +31.00ms      6.00ms NOERROR from https://1.1.1.1/dns-query
+`
+	if !strings.Contains(rep.String(), expected) {
+		t.Errorf("Report does not show the connection to the resolver:\n%v", rep.String())
+	}
+	res = rep.Result()
+	if res.DNSQueries[0].Connect != 0.008 || res.DNSQueries[0].TLSHandshake != 0.015 || res.DNSQueries[1].Connect != 0 {
+		t.Errorf("Unexpected DNS query connection times: got %+v", res.DNSQueries)
+	}
+}
+
+func TestReportDNSBreakdown(t *testing.T) {
+	type testBreakdown struct {
+		queries         []trace.DNSQuery
+		expectedLines   string
+		expectedResult  DNSBreakdown
+		expectedWarning string
+	}
+
+	tests := map[string]testBreakdown{
+		"dual stack through CNAMEs": {
+			queries: []trace.DNSQuery{
+				{Server: "10.0.0.2:53", Name: "thing.com.", Type: "A", Duration: 12 * time.Millisecond, DNSAnswer: trace.DNSAnswer{Outcome: "NOERROR", Answers: 3, CNAMEs: 2}},
+				{Server: "10.0.0.2:53", Name: "thing.com.", Type: "AAAA", Duration: 15 * time.Millisecond, DNSAnswer: trace.DNSAnswer{Outcome: "NOERROR", Answers: 3, CNAMEs: 2}},
+			},
+			expectedLines: `
+        A records:         12.00ms
+        AAAA records:      15.00ms
+        CNAME hops:            2
+        Answered by:   10.0.0.2:53
+      Connecting:`,
+			expectedResult: DNSBreakdown{A: 0.012, AAAA: 0.015, CNAMEHops: 2, AnsweredBy: "10.0.0.2:53"},
+		},
+		"AAAA dropped": {
+			queries: []trace.DNSQuery{
+				{Server: "10.0.0.2:53", Name: "thing.com.", Type: "A", Duration: 10 * time.Millisecond, DNSAnswer: trace.DNSAnswer{Outcome: "NOERROR", Answers: 1}},
+				{Server: "10.0.0.2:53", Name: "thing.com.", Type: "AAAA", Duration: 5 * time.Second, DNSAnswer: trace.DNSAnswer{Outcome: "timeout"}},
+				{Server: "10.0.0.2:53", Name: "thing.com.", Type: "AAAA", Start: 5 * time.Second, Duration: 8 * time.Millisecond, DNSAnswer: trace.DNSAnswer{Outcome: "NOERROR"}},
+			},
+			expectedLines: `
+        A records:         10.00ms
+        AAAA records:    5008.00ms
+        Answered by:   10.0.0.2:53
+      Connecting:`,
+			expectedResult:  DNSBreakdown{A: 0.01, AAAA: 5.008, AnsweredBy: "10.0.0.2:53"},
+			expectedWarning: "resolving AAAA records took 5008.00ms against 10.00ms for A records",
+		},
+		"nothing found": {
+			queries: []trace.DNSQuery{
+				{Server: "10.0.0.2:53", Name: "thing.com.", Type: "A", Duration: 10 * time.Millisecond, DNSAnswer: trace.DNSAnswer{Outcome: "NXDOMAIN"}},
+			},
+			expectedLines: `
+        A records:         10.00ms
+      Connecting:`,
+			expectedResult: DNSBreakdown{A: 0.01},
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			request, err := http.NewRequest(http.MethodGet, "https://thing.com/things", nil)
+			if err != nil {
+				t.Errorf("Error creating http request: %v", err)
+			}
+			response := &http.Response{
+				Status:     "200 OK",
+				StatusCode: http.StatusOK,
+				Proto:      "HTTP/1.1",
+				Header:     http.Header{},
+			}
+
+			rep := New(request, response, "", &trace.Timings{}, &Presentation{Sections: Sections{SectionTrace: true, SectionConnection: true}})
+			rep.SetDNSQueries(cfg.queries)
+			err = rep.Build()
+			if err != nil {
+				t.Errorf("Error building report: %v", err)
+			}
+			if !strings.Contains(rep.String(), cfg.expectedLines) {
+				t.Errorf("Report does not show the expected breakdown:\n%v\nwant:\n%v", rep.String(), cfg.expectedLines)
+			}
+
+			res := rep.Result()
+			if res.DNSBreakdown == nil || *res.DNSBreakdown != cfg.expectedResult {
+				t.Errorf("Unexpected breakdown: got %+v, want %+v", res.DNSBreakdown, cfg.expectedResult)
+			}
+			warned := len(res.Warnings) > 0 && strings.HasPrefix(res.Warnings[0], cfg.expectedWarning)
+			if cfg.expectedWarning != "" && !warned || cfg.expectedWarning == "" && len(res.Warnings) > 0 {
+				t.Errorf("Unexpected warnings: got %q, want %q", res.Warnings, cfg.expectedWarning)
+			}
+		})
+	}
+}
+
+func TestReportUnicodeHost(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "https://xn--bcher-kva.example/things", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	response := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		Header:     http.Header{},
+	}
+
+	rep := New(request, response, "", &trace.Timings{}, &Presentation{Sections: Sections{SectionRequest: true}})
+	rep.SetUnicodeHost("bücher.example")
+	err = rep.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+	if !strings.Contains(rep.String(), "> GET xn--bcher-kva.example/things HTTP/1.1\n> [xn--bcher-kva.example is bücher.example]\n") {
+		t.Errorf("Report does not show both forms of the host:\n%v", rep.String())
+	}
+	if rep.Result().UnicodeHost != "bücher.example" {
+		t.Errorf("Unexpected unicode host: got %v", rep.Result().UnicodeHost)
+	}
+}
+
+// OCSP responses with a good status of certificate 4242, valid from
+// 2026-10-14 08:00 until 2099, and a stale one valid until 2020-01-08.
+const (
+	goodStapleHex  = "3081a90a0100a081a33081a006092b060105050730010104819230818f307da203040100180f32303236313031343038303030305a30653063303b300906052b0e03021a05000414000000000000000000000000000000000000000004140000000000000000000000000000000000000000020210928000180f32303236313031343038303030305aa011180f32303939303130313030303030305a300a06082a8648ce3d04030203020001"
+	staleStapleHex = "3081a90a0100a081a33081a006092b060105050730010104819230818f307da203040100180f32303236313031343038303030305a30653063303b300906052b0e03021a05000414000000000000000000000000000000000000000004140000000000000000000000000000000000000000020210928000180f32303230303130313030303030305aa011180f32303230303130383030303030305a300a06082a8648ce3d04030203020001"
+)
+
+type testRevocation struct {
+	staple           string
+	mustStaple       bool
+	check            *RevocationCheck
+	expectedLines    string
+	expectedWarnings []string
+}
+
+func TestReportRevocation(t *testing.T) {
+	tests := map[string]testRevocation{
+		"will show a good staple": {
+			staple:        goodStapleHex,
+			expectedLines: "        OCSP staple:   good, valid from 2026-10-14 08:00 UTC to 2099-01-01 00:00 UTC\n",
+		},
+		"will warn about a stale staple": {
+			staple:           staleStapleHex,
+			expectedLines:    "        OCSP staple:   good, valid from 2020-01-01 00:00 UTC to 2020-01-08 00:00 UTC\n",
+			expectedWarnings: []string{"the OCSP staple is stale, it expired"},
+		},
+		"will show nothing without a staple or check": {},
+		"will warn about a missing staple when checked": {
+			check:            &RevocationCheck{Method: RevocationOCSP, URL: "http://ocsp.thing.com", Status: "good", Duration: 45200 * time.Microsecond},
+			expectedLines:    "        OCSP staple:   none\n        OCSP check:        45.20ms good from http://ocsp.thing.com\n",
+			expectedWarnings: []string{"no OCSP staple was sent, so clients have to check"},
+		},
+		"will warn about a revoked certificate": {
+			staple:           goodStapleHex,
+			check:            &RevocationCheck{Method: RevocationCRL, URL: "http://crl.thing.com/ca.crl", Status: "revoked", Duration: 120 * time.Millisecond},
+			expectedLines:    "        CRL check:        120.00ms revoked from http://crl.thing.com/ca.crl\n",
+			expectedWarnings: []string{"the certificate was revoked, according to http://crl.thing.com/ca.crl"},
+		},
+		"will show a failed check": {
+			staple:        goodStapleHex,
+			check:         &RevocationCheck{Method: RevocationOCSP, URL: "http://ocsp.thing.com", Duration: 3 * time.Millisecond, Err: errors.New("http://ocsp.thing.com answered 503 Service Unavailable")},
+			expectedLines: "        OCSP check:         3.00ms error: http://ocsp.thing.com answered 503 Service Unavailable\n",
+		},
+		"will warn about a missing staple the certificate requires": {
+			mustStaple:       true,
+			expectedWarnings: []string{"no OCSP staple was sent, though the certificate requires one"},
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			request, err := http.NewRequest(http.MethodGet, "https://thing.com/things", nil)
+			if err != nil {
+				t.Errorf("Error creating http request: %v", err)
+			}
+
+			leaf := &x509.Certificate{SerialNumber: big.NewInt(4242)}
+			if cfg.mustStaple {
+				leaf.Extensions = []pkix.Extension{{Id: oidMustStaple, Value: []byte{0x30, 0x03, 0x02, 0x01, 0x05}}}
+			}
+			state := &tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}}
+			if cfg.staple != "" {
+				state.OCSPResponse, err = hex.DecodeString(cfg.staple)
+				if err != nil {
+					t.Fatalf("Error decoding staple: %v", err)
+				}
+			}
+			response := &http.Response{
+				Status:     "200 OK",
+				StatusCode: http.StatusOK,
+				Proto:      "HTTP/1.1",
+				Header:     http.Header{},
+				TLS:        state,
+			}
+
+			rep := New(request, response, "", &trace.Timings{}, &Presentation{Sections: Sections{SectionTrace: true, SectionConnection: true}})
+			if cfg.check != nil {
+				rep.SetRevocationCheck(cfg.check)
+			}
+			err = rep.Build()
+			if err != nil {
+				t.Errorf("Error building report: %v", err)
+			}
+
+			output := rep.String()
+			if cfg.expectedLines == "" && (strings.Contains(output, "OCSP staple:") || strings.Contains(output, "check:")) {
+				t.Errorf("Report shows revocation lines which weren't expected:\n%v", output)
+			}
+			if !strings.Contains(output, cfg.expectedLines) {
+				t.Errorf("Report does not show the expected revocation lines:\n%v\nwant:\n%v", output, cfg.expectedLines)
+			}
+
+			warnings := rep.Result().Warnings
+			if len(warnings) != len(cfg.expectedWarnings) {
+				t.Fatalf("Unexpected warnings: got %q, want %q", warnings, cfg.expectedWarnings)
+			}
+			for i, w := range cfg.expectedWarnings {
+				if !strings.HasPrefix(warnings[i], w) {
+					t.Errorf("Unexpected warning: got %q, want it to start with %q", warnings[i], w)
+				}
+			}
+		})
+	}
+}
+
+func TestReportRedactQuery(t *testing.T) {
+	type testRedact struct {
+		params   []string
+		text     string
+		expected string
+	}
+
+	tests := map[string]testRedact{
+		"url": {
+			params:   []string{"token", "sig"},
+			text:     "https://thing.com/things?token=abc&page=2&sig=def",
+			expected: "https://thing.com/things?token=REDACTED&page=2&sig=REDACTED",
+		},
+		"case of the name": {
+			params:   []string{"sig"},
+			text:     "https://thing.com/things?Sig=def",
+			expected: "https://thing.com/things?Sig=REDACTED",
+		},
+		"only whole names": {
+			params:   []string{"sig"},
+			text:     "https://thing.com/things?signature=def&xsig=ghi",
+			expected: "https://thing.com/things?signature=def&xsig=ghi",
+		},
+		"quoted in an error": {
+			params:   []string{"token"},
+			text:     `Get "https://thing.com/things?token=abc": connection refused`,
+			expected: `Get "https://thing.com/things?token=REDACTED": connection refused`,
+		},
+		"no params": {
+			params:   []string{""},
+			text:     "https://thing.com/things?token=abc",
+			expected: "https://thing.com/things?token=abc",
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			got := NewQueryRedactor(cfg.params).Redact(cfg.text)
+			if got != cfg.expected {
+				t.Errorf("Unexpected redaction: got %q, want %q", got, cfg.expected)
+			}
+		})
+	}
+
+	request, err := http.NewRequest(http.MethodGet, "https://thing.com/things?token=abc&page=2", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+	response := &http.Response{
+		Status:     "302 Found",
+		StatusCode: http.StatusFound,
+		Proto:      "HTTP/1.1",
+		Header:     http.Header{"Location": []string{"https://cdn.thing.com/things?token=abc"}},
+	}
+	mirrorRequest, err := http.NewRequest(http.MethodGet, "https://mirror.thing.com/things?token=abc", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	rep := New(request, response, "", &trace.Timings{}, &Presentation{Format: FormatJSON, Redactor: NewQueryRedactor([]string{"token"})})
+	rep.SetMirrorError(mirrorRequest, fmt.Errorf(`Get "https://mirror.thing.com/things?token=abc": connection refused`))
+	err = rep.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+	if strings.Contains(rep.String(), "token=abc") {
+		t.Errorf("Report shows the redacted parameter:\n%v", rep.String())
+	}
+	res := rep.Result()
+	if res.URL != "https://thing.com/things?token=REDACTED&page=2" {
+		t.Errorf("Unexpected url: got %v", res.URL)
+	}
+	if res.Mirror.URL != "https://mirror.thing.com/things?token=REDACTED" || strings.Contains(res.Mirror.Error, "token=abc") {
+		t.Errorf("Unexpected mirror result: got %+v", res.Mirror)
+	}
+	// The request and response themselves are left as they were
+	if request.URL.RawQuery != "token=abc&page=2" || response.Header.Get("Location") != "https://cdn.thing.com/things?token=abc" {
+		t.Errorf("Redaction changed the request or response: %v, %v", request.URL, response.Header)
+	}
+}
+
+func TestReportRedactHeaders(t *testing.T) {
+	type testRedact struct {
+		headers  []string
+		name     string
+		value    string
+		expected string
+	}
+
+	tests := map[string]testRedact{
+		"api key": {
+			headers:  []string{"X-Api-Key"},
+			name:     "X-Api-Key",
+			value:    "abc",
+			expected: "REDACTED",
+		},
+		"case of the name": {
+			headers:  []string{"x-api-key"},
+			name:     "X-API-KEY",
+			value:    "abc",
+			expected: "REDACTED",
+		},
+		"scheme of the credentials": {
+			headers:  []string{"Authorization"},
+			name:     "Authorization",
+			value:    "Bearer abc",
+			expected: "Bearer REDACTED",
+		},
+		"credentials without a scheme": {
+			headers:  []string{"Authorization"},
+			name:     "Authorization",
+			value:    "abc",
+			expected: "REDACTED",
+		},
+		"names of the cookies": {
+			headers:  []string{"Cookie"},
+			name:     "Cookie",
+			value:    "session=abc; theme=dark",
+			expected: "session=REDACTED; theme=REDACTED",
+		},
+		"attributes of a cookie set": {
+			headers:  []string{"Set-Cookie"},
+			name:     "Set-Cookie",
+			value:    "session=abc; Path=/; Secure; HttpOnly",
+			expected: "session=REDACTED; Path=/; Secure; HttpOnly",
+		},
+		"other headers": {
+			headers:  []string{"Authorization"},
+			name:     "Accept",
+			value:    "text/html",
+			expected: "text/html",
+		},
+		"secret headers": {
+			headers:  SecretHeaders,
+			name:     "Proxy-Authorization",
+			value:    "Basic abc",
+			expected: "Basic REDACTED",
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			got := NewRedactor(nil, cfg.headers).HeaderValue(cfg.name, cfg.value)
+			if got != cfg.expected {
+				t.Errorf("Unexpected redaction: got %q, want %q", got, cfg.expected)
+			}
+		})
+	}
+
+	if NewRedactor([]string{""}, []string{" "}) != nil {
+		t.Errorf("Expected no redactor without parameters or headers")
+	}
+
+	request, err := http.NewRequest(http.MethodGet, "https://thing.com/things", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+	request.Header.Set("Authorization", "Bearer abc")
+	response := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		Header:     http.Header{"Set-Cookie": []string{"session=abc; Secure"}},
+	}
+
+	for _, format := range []string{FormatText, FormatJSON, FormatHTML} {
+		rep := New(request, response, "", &trace.Timings{}, &Presentation{Format: format, Redactor: NewRedactor(nil, SecretHeaders)})
+		err = rep.Build()
+		if err != nil {
+			t.Errorf("Error building report: %v", err)
+		}
+		if strings.Contains(rep.String(), "abc") {
+			t.Errorf("The %s report shows a redacted header:\n%v", format, rep.String())
+		}
+	}
+	// The request and response themselves are left as they were
+	if request.Header.Get("Authorization") != "Bearer abc" || response.Header.Get("Set-Cookie") != "session=abc; Secure" {
+		t.Errorf("Redaction changed the request or response: %v, %v", request.Header, response.Header)
+	}
+}
+
+func TestRedactorWriter(t *testing.T) {
+	type testWriter struct {
+		writes   []string
+		expected string
+	}
+
+	tests := map[string]testWriter{
+		"request header": {
+			writes:   []string{"> Authorization: Bearer abc\n"},
+			expected: "> Authorization: Bearer REDACTED\n",
+		},
+		"response header": {
+			writes:   []string{"< Set-Cookie: session=abc; Secure\r\n"},
+			expected: "< Set-Cookie: session=REDACTED; Secure\r\n",
+		},
+		"header without a prefix": {
+			writes:   []string{"X-Api-Key: abc\n"},
+			expected: "X-Api-Key: REDACTED\n",
+		},
+		"other lines": {
+			writes:   []string{"> GET / HTTP/1.1\n> Accept: text/html\n*      1.00ms DNSStart: thing.com\n"},
+			expected: "> GET / HTTP/1.1\n> Accept: text/html\n*      1.00ms DNSStart: thing.com\n",
+		},
+		"request line": {
+			writes:   []string{"> GET /things?token=abc&page=2 HTTP/1.1\r\n"},
+			expected: "> GET /things?token=REDACTED&page=2 HTTP/1.1\r\n",
+		},
+		"url in a header": {
+			writes:   []string{"< Location: https://thing.com/?token=abc\n"},
+			expected: "< Location: https://thing.com/?token=REDACTED\n",
+		},
+		"url in an event": {
+			writes:   []string{"*      5.00ms Error: Get \"https://thing.com/?token=abc\": EOF\n"},
+			expected: "*      5.00ms Error: Get \"https://thing.com/?token=REDACTED\": EOF\n",
+		},
+		"line written in parts": {
+			writes:   []string{"> Cookie: ses", "sion=abc", "\n> Accept: */*\n"},
+			expected: "> Cookie: session=REDACTED\n> Accept: */*\n",
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			var b strings.Builder
+			w := NewRedactor([]string{"token"}, SecretHeaders).Writer(&b)
+			for _, s := range cfg.writes {
+				n, err := w.Write([]byte(s))
+				if err != nil || n != len(s) {
+					t.Errorf("Unexpected write: got %d, %v, want %d", n, err, len(s))
+				}
+			}
+			if b.String() != cfg.expected {
+				t.Errorf("Unexpected output: got %q, want %q", b.String(), cfg.expected)
+			}
+		})
+	}
+
+	var b strings.Builder
+	if (*Redactor)(nil).Writer(&b) != &b {
+		t.Errorf("Expected a nil redactor to return the writer itself")
+	}
+}
+
+func TestReportAssertions(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "https://thing.com", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	response := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Header: http.Header{
+			"Server-Timing": []string{`cache;desc="miss, edge", app;dur=47.5`, "db;dur=12"},
+		},
+	}
+
+	timings := &trace.Timings{
+		ConnectionDialDuration:  20 * time.Millisecond,
+		TLSDuration:             30 * time.Millisecond,
+		TotalConnectionDuration: 50 * time.Millisecond,
+		RequestWriteDuration:    5 * time.Millisecond,
+		ResponseDelayDuration:   75 * time.Millisecond,
+		TotalRequestDuration:    140 * time.Millisecond,
+	}
+
+	type testAssertion struct {
+		assertion string
+		passed    bool
+		line      string
+	}
+
+	tests := map[string]testAssertion{
+		"client timings": {
+			assertion: "timing.tls < timing.connect*3",
+			passed:    true,
+			line:      "  pass  timing.tls < timing.connect*3: 30.00ms < 60.00ms\n",
+		},
+		"edge overhead": {
+			assertion: "timing.ttfb - server_timing.app < 50ms",
+			passed:    false,
+			line:      "  FAIL  timing.ttfb - server_timing.app < 50ms: 82.50ms is not < 50.00ms\n",
+		},
+		"second header": {
+			assertion: "server_timing.db <= 12ms",
+			passed:    true,
+			line:      "  pass  server_timing.db <= 12ms: 12.00ms <= 12.00ms\n",
+		},
+		"metric not sent": {
+			assertion: "server_timing.cache < 1ms",
+			passed:    false,
+			line:      "  FAIL  server_timing.cache < 1ms: error: unknown variable \"server_timing.cache\"\n",
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			assertion, err := expr.ParseAssertion(cfg.assertion)
+			if err != nil {
+				t.Fatalf("Error parsing assertion: %v", err)
+			}
+
+			report := New(request, response, "", timings, &Presentation{Sections: Sections(nil).Hide(SectionHeaders, SectionBody), Assertions: []*expr.Assertion{assertion}})
+			err = report.Build()
+			if err != nil {
+				t.Errorf("Error building report: %v", err)
+			}
+
+			if !strings.Contains(report.String(), "\nAssertions\n"+cfg.line) {
+				t.Errorf("report output incorrect: got\n%v\n want it to contain\n%v\n", report.String(), cfg.line)
+			}
+
+			failed := report.Result().FailedAssertions()
+			if cfg.passed != (len(failed) == 0) {
+				t.Errorf("failed assertions incorrect: got %v, want passed %v", failed, cfg.passed)
+			}
+		})
+	}
+}
+
+func TestReportContentAssertions(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "https://thing.com", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	response := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Header: http.Header{
+			"Content-Type": []string{"application/json"},
+			"X-Cache":      []string{"MISS", "HIT"},
+		},
+	}
+	body := `{"status": "ok", "items": [{"count": 4}], "ratio": 1.0, "tags": ["a", "b"]}`
+
+	type testContentAssertion struct {
+		body          string
+		bodyContains  string
+		header        string
+		json          string
+		passed        bool
+		line          string
+		expectedError string
+	}
+
+	tests := map[string]testContentAssertion{
+		"body contains": {
+			bodyContains: `"status": "ok"`,
+			passed:       true,
+			line:         `  pass  body contains "\"status\": \"ok\"": found`,
+		},
+		"body doesn't contain": {
+			bodyContains: "error",
+			line:         `  FAIL  body contains "error": not found in the 75 bytes of the body`,
+		},
+		"header value": {
+			header: "x-cache: HIT",
+			passed: true,
+			line:   `  pass  header x-cache: HIT: x-cache is "MISS, HIT"`,
+		},
+		"header with another value": {
+			header: "X-Cache: STALE",
+			line:   `  FAIL  header X-Cache: STALE: X-Cache is "MISS, HIT"`,
+		},
+		"header sent": {
+			header: "Content-Type",
+			passed: true,
+			line:   `  pass  header Content-Type: Content-Type is "application/json"`,
+		},
+		"header not sent": {
+			header: "ETag",
+			line:   `  FAIL  header ETag: no ETag header`,
+		},
+		"json string": {
+			json:   `.status == "ok"`,
+			passed: true,
+			line:   `  pass  json .status == "ok": $.status is "ok"`,
+		},
+		"json string differs": {
+			json: `$.status != "ok"`,
+			line: `  FAIL  json $.status != "ok": $.status is "ok", not != "ok"`,
+		},
+		"json number": {
+			json:   ".items[0].count >= 4",
+			passed: true,
+			line:   `  pass  json .items[0].count >= 4: $.items[0].count is 4`,
+		},
+		"json number compared as a number": {
+			json:   ".ratio == 1",
+			passed: true,
+			line:   `  pass  json .ratio == 1: $.ratio is 1.0`,
+		},
+		"json array": {
+			json:   `.tags == ["a", "b"]`,
+			passed: true,
+			line:   `  pass  json .tags == ["a", "b"]: $.tags is ["a","b"]`,
+		},
+		"json value present": {
+			json:   ".items",
+			passed: true,
+			line:   `  pass  json .items: $.items is [{"count":4}]`,
+		},
+		"json value missing": {
+			json: ".error.code < 500",
+			line: `  FAIL  json .error.code < 500: error: $ has no member "error"`,
+		},
+		"json ordering of a string": {
+			json: ".status > 1",
+			line: `  FAIL  json .status > 1: error: "ok" is not a number`,
+		},
+		"json body which isn't JSON": {
+			body: "<html></html>",
+			json: ".status",
+			line: `  FAIL  json .status: error: body is not JSON: invalid character '<' looking for beginning of value`,
+		},
+		"invalid json value": {
+			json:          ".status == ok",
+			expectedError: `invalid JSON assertion ".status == ok", expected a JSON value such as "ok" or 3 after ==`,
+		},
+		"invalid json ordering": {
+			json:          `.status < "ok"`,
+			expectedError: `< compares numbers`,
+		},
+		"invalid json path": {
+			json:          "status == 1",
+			expectedError: `invalid JSONPath "status"`,
+		},
+		"invalid header": {
+			header:        "X Cache: HIT",
+			expectedError: `invalid header assertion "X Cache: HIT"`,
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			var assertion *ContentAssertion
+			var err error
+			switch {
+			case cfg.bodyContains != "":
+				assertion = BodyContains(cfg.bodyContains)
+			case cfg.header != "":
+				assertion, err = ParseHeaderAssertion(cfg.header)
+			default:
+				assertion, err = ParseJSONAssertion(cfg.json)
+			}
+			if cfg.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), cfg.expectedError) {
+					t.Fatalf("Unexpected error: got %v, want it to contain %q", err, cfg.expectedError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Error parsing assertion: %v", err)
+			}
+			if cfg.body == "" {
+				cfg.body = body
+			}
+
+			report := New(request, response, cfg.body, &trace.Timings{}, &Presentation{Sections: Sections(nil).Hide(SectionHeaders, SectionBody), ContentAssertions: []*ContentAssertion{assertion}})
+			err = report.Build()
+			if err != nil {
+				t.Errorf("Error building report: %v", err)
+			}
+
+			if !strings.Contains(report.String(), "\nAssertions\n"+cfg.line+"\n") {
+				t.Errorf("report output incorrect: got\n%v\n want it to contain\n%v\n", report.String(), cfg.line)
+			}
+
+			result := report.Result()
+			failed := result.FailedAssertions()
+			if cfg.passed != (len(failed) == 0) {
+				t.Errorf("failed assertions incorrect: got %v, want passed %v", failed, cfg.passed)
+			}
+			if len(result.Assertions) != 1 || (result.Assertions[0].Outcome == "") == (result.Assertions[0].Error == "") {
+				t.Errorf("Unexpected assertion result: got %+v", result.Assertions)
+			}
+		})
+	}
+}
+
+func TestReportFraming(t *testing.T) {
+	type testFraming struct {
+		proto         string
+		minor         int
+		header        http.Header
+		contentLength int64
+		encoding      []string
+		close         bool
+		expected      string
+		warnings      []string
+	}
+
+	tests := map[string]testFraming{
+		"http/1.1 with a content length": {
+			proto:         "HTTP/1.1",
+			minor:         1,
+			header:        http.Header{},
+			contentLength: 11,
+		},
+		"http/1.0 closing the connection": {
+			proto:         "HTTP/1.0",
+			minor:         0,
+			header:        http.Header{},
+			contentLength: 11,
+			close:         true,
+			expected:      "Framing\n  Protocol:            HTTP/1.0\n  Body end:            content-length\n  Connection:          closed, HTTP/1.0 without Connection: keep-alive\n",
+			warnings:      []string{"the server answered with HTTP/1.0 and closed the connection, so every request has to set up a new one"},
+		},
+		"http/1.0 with keep-alive": {
+			proto:         "HTTP/1.0",
+			minor:         0,
+			header:        http.Header{"Connection": {"keep-alive"}, "Keep-Alive": {"timeout=5, max=100"}},
+			contentLength: 11,
+			expected:      "Framing\n  Protocol:            HTTP/1.0\n  Body end:            content-length\n  Connection:          kept open\n  Keep-Alive:          timeout=5, max=100\n",
+		},
+		"body delimited by the close": {
+			proto:         "HTTP/1.1",
+			minor:         1,
+			header:        http.Header{},
+			contentLength: -1,
+			close:         true,
+			expected:      "Framing\n  Protocol:            HTTP/1.1\n  Body end:            connection close\n  Close wait:              12.50ms\n  Connection:          closed, the body ends with the connection\n",
+			warnings:      []string{"the response has neither a Content-Length nor chunked encoding, so its end was only known when the server closed the connection, 12.50ms after the last byte, which counts towards the response read"},
+		},
+		"connection close header": {
+			proto:    "HTTP/1.1",
+			minor:    1,
+			header:   http.Header{"Connection": {"close"}},
+			encoding: []string{"chunked"},
+			close:    true,
+			expected: "Framing\n  Protocol:            HTTP/1.1\n  Body end:            chunked\n  Connection:          closed, Connection: close\n",
+			warnings: []string{"the server sent Connection: close, so every request has to set up a new connection"},
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			request, err := http.NewRequest(http.MethodGet, "https://thing.com", nil)
+			if err != nil {
+				t.Errorf("Error creating http request: %v", err)
+			}
+
+			response := &http.Response{
+				Status:           "200 OK",
+				StatusCode:       http.StatusOK,
+				Proto:            cfg.proto,
+				ProtoMajor:       1,
+				ProtoMinor:       cfg.minor,
+				Header:           cfg.header,
+				ContentLength:    cfg.contentLength,
+				TransferEncoding: cfg.encoding,
+				Close:            cfg.close,
+				Request:          request,
+			}
+
+			timings := &trace.Timings{
+				ResponseReadDuration: 20 * time.Millisecond,
+				BodyEndDuration:      12500 * time.Microsecond,
+				TotalRequestDuration: 100 * time.Millisecond,
+			}
+
+			report := New(request, response, "hello world", timings, &Presentation{Sections: Sections(nil).Hide(SectionHeaders, SectionBody)})
+			err = report.Build()
+			if err != nil {
+				t.Errorf("Error building report: %v", err)
+			}
+
+			if cfg.expected == "" {
+				if strings.Contains(report.String(), "Framing") || report.Result().Framing != nil {
+					t.Errorf("Expected no framing section: got\n%v", report.String())
+				}
+				return
+			}
+			if !strings.Contains(report.String(), cfg.expected) {
+				t.Errorf("report output incorrect: got\n%v\n want it to contain\n%v\n", report.String(), cfg.expected)
+			}
+			for _, w := range cfg.warnings {
+				if !strings.Contains(report.String(), "! Warning: "+w+"\n") {
+					t.Errorf("Expected warning %q: got\n%v", w, report.String())
+				}
+			}
+
+			result := report.Result()
+			if result.Framing == nil || result.Framing.Proto != cfg.proto || result.Framing.Close != cfg.close {
+				t.Errorf("Unexpected framing in result: got %+v", result.Framing)
+			}
+		})
+	}
+}
+
+func TestReportStall(t *testing.T) {
+	request, err := http.NewRequest(http.MethodGet, "https://thing.com/big.iso", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	response := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+	}
+
+	timings := &trace.Timings{
+		ResponseReadDuration: 7 * time.Second,
+		TotalRequestDuration: 7100 * time.Millisecond,
+	}
+	stall := &trace.Stall{
+		Timeout:    5 * time.Second,
+		Stalled:    true,
+		LargestGap: 250 * time.Millisecond,
+		BodyBytes:  4096,
+		LastByte:   2100 * time.Millisecond,
+	}
+
+	report := New(request, response, "", timings, &Presentation{Sections: Sections(nil).Hide(SectionHeaders, SectionBody)})
+	report.SetStall(stall)
+	err = report.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+
+	expected := []string{
+		"! Warning: the server stalled mid-body, no bytes arrived for 5000.00ms after 4096 bytes of the body, so reading it was aborted\n",
+		"Stall\n  Timeout:               5000.00ms\n  Largest gap:            250.00ms\n  Outcome:             stalled mid-body after 4096 bytes, reading was aborted\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(report.String(), e) {
+			t.Errorf("report output incorrect: got\n%v\n want it to contain\n%v\n", report.String(), e)
+		}
+	}
+
+	result := report.Result()
+	if result.Stall == nil || !result.Stall.Stalled || result.Stall.Timeout != 5 || result.Stall.BodyBytes != 4096 {
+		t.Errorf("Unexpected stall in result: got %+v", result.Stall)
+	}
+
+	stall.Stalled = false
+	report = New(request, response, "", timings, &Presentation{Sections: Sections(nil).Hide(SectionHeaders, SectionBody)})
+	report.SetStall(stall)
+	err = report.Build()
+	if err != nil {
+		t.Errorf("Error building report: %v", err)
+	}
+	if strings.Contains(report.String(), "Warning") || !strings.Contains(report.String(), "  Outcome:             no stall, the body kept arriving\n") {
+		t.Errorf("Expected a body which kept arriving: got\n%v", report.String())
+	}
+}
+
+func TestReportGraphQL(t *testing.T) {
+	type testGraphQL struct {
+		body     string
+		expected string
+		warning  string
+		errors   []string
+	}
+
+	tests := map[string]testGraphQL{
+		"will indent the data": {
+			body:     `{"data":{"user":{"id":1}}}`,
+			expected: "data:\n  {\n    \"user\": {\n      \"id\": 1\n    }\n  }\n",
+		},
+		"will list the errors": {
+			body:     `{"data":{"user":null},"errors":[{"message":"Not found","path":["user"],"locations":[{"line":2,"column":3}]},{"message":"Too slow"}]}`,
+			expected: "data:\n  {\n    \"user\": null\n  }\nerrors:\n  - Not found (at user, line 2:3)\n  - Too slow\n",
+			warning:  "the GraphQL response has 2 errors, the first: Not found (at user, line 2:3)",
+			errors:   []string{"Not found (at user, line 2:3)", "Too slow"},
+		},
+		"will show errors without data": {
+			body:     `{"errors":[{"message":"Syntax Error","locations":[{"line":1,"column":1}]}]}`,
+			expected: "data: none\nerrors:\n  - Syntax Error (line 1:1)\n",
+			warning:  "the GraphQL response has an error: Syntax Error (line 1:1)",
+			errors:   []string{"Syntax Error (line 1:1)"},
+		},
+		"will leave other bodies as they are": {
+			body:     `{"user":{"id":1}}`,
+			expected: "{\"user\":{\"id\":1}}\n",
+			warning:  "the response body is not a GraphQL response, with data or errors, so it is shown as it is",
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			request, err := http.NewRequest(http.MethodPost, "https://thing.com/graphql", nil)
+			if err != nil {
+				t.Errorf("Error creating http request: %v", err)
+			}
+
+			response := &http.Response{
+				Status:     "200 OK",
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": {"application/json"}},
+			}
+
+			report := New(request, response, cfg.body, &trace.Timings{}, &Presentation{Sections: Sections(nil).Hide(SectionHeaders, SectionTrace), GraphQL: true})
+			report.SetResponseBodySize(int64(len(cfg.body)))
+			err = report.Build()
+			if err != nil {
+				t.Errorf("Error building report: %v", err)
+			}
+
+			if !strings.Contains(report.String(), "< 200 OK\n"+cfg.expected) {
+				t.Errorf("report output incorrect: got\n%v\n want it to contain\n%v\n", report.String(), cfg.expected)
+			}
+			if cfg.warning != "" && !strings.Contains(report.String(), "! Warning: "+cfg.warning+"\n") {
+				t.Errorf("Expected warning %q: got\n%v", cfg.warning, report.String())
+			}
+			if !reflect.DeepEqual(report.Result().GraphQLErrors, cfg.errors) {
+				t.Errorf("Unexpected GraphQL errors in result: got %v, want %v", report.Result().GraphQLErrors, cfg.errors)
+			}
+		})
+	}
+}
+
+func TestCacheCheck(t *testing.T) {
+	response := func(status int, header http.Header) *http.Response {
+		return &http.Response{Status: fmt.Sprintf("%d %s", status, http.StatusText(status)), StatusCode: status, Header: header}
+	}
+	header := http.Header{
+		"Cache-Control": {"public, max-age=600"},
+		"Age":           {"120"},
+		"Etag":          {`"v1"`},
+	}
+
+	out := &bytes.Buffer{}
+	err := WriteCacheCheck(out, &CacheCheck{
+		URL:         "https://thing.com",
+		Initial:     &CacheResponse{Response: response(http.StatusOK, header), Timings: &trace.Timings{TotalConnectionDuration: 50 * time.Millisecond, TotalRequestDuration: 150 * time.Millisecond}, BodySize: 5000},
+		Validators:  []string{`If-None-Match: "v1"`},
+		Conditional: &CacheResponse{Response: response(http.StatusNotModified, http.Header{}), Timings: &trace.Timings{TotalRequestDuration: 25 * time.Millisecond}},
+	}, nil)
+	if err != nil {
+		t.Errorf("Error writing cache check: %v", err)
+	}
+
+	expected := []string{
+		"  Initial:             200 OK                  100.00ms        5000\n",
+		"  Conditional:         304 Not Modified         25.00ms           0\n  Sent:                If-None-Match: \"v1\"\n",
+		"  Cache-Control:       public, max-age=600\n    public: may be stored by shared caches, such as CDNs and proxies\n    max-age=600: fresh for 10m0s\n",
+		"  Freshness:           fresh for 10m0s (max-age), 2m0s old, so fresh for another 8m0s\n",
+		"The conditional request was answered with 304 Not Modified, 75.00ms (75.0%) faster than the initial request, without sending the 5000 bytes of the body again\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(out.String(), e) {
+			t.Errorf("cache check output incorrect: got\n%v\n want it to contain\n%v\n", out.String(), e)
+		}
+	}
+
+	out = &bytes.Buffer{}
+	err = WriteCacheCheck(out, &CacheCheck{
+		URL:         "https://thing.com",
+		Initial:     &CacheResponse{Response: response(http.StatusOK, header), Timings: &trace.Timings{TotalRequestDuration: 100 * time.Millisecond}, BodySize: 5000},
+		Validators:  []string{`If-None-Match: "v1"`},
+		Conditional: &CacheResponse{Response: response(http.StatusOK, header), Timings: &trace.Timings{TotalRequestDuration: 100 * time.Millisecond}, BodySize: 5000},
+	}, nil)
+	if err != nil {
+		t.Errorf("Error writing cache check: %v", err)
+	}
+	if !strings.Contains(out.String(), "! the conditional request was answered with 200 OK rather than 304 Not Modified") {
+		t.Errorf("Expected the validators to be ignored: got\n%v", out.String())
+	}
+}
+
+func TestCacheFreshness(t *testing.T) {
+	type testFreshness struct {
+		header   http.Header
+		expected string
+	}
+
+	tests := map[string]testFreshness{
+		"will prefer s-maxage": {
+			header:   http.Header{"Cache-Control": {"max-age=60, s-maxage=3600"}},
+			expected: "fresh for 1h0m0s (s-maxage)",
+		},
+		"will take the age off the lifetime": {
+			header:   http.Header{"Cache-Control": {"max-age=60"}, "Age": {"90"}},
+			expected: "fresh for 1m0s (max-age), 1m30s old, so already stale",
+		},
+		"will use Expires relative to Date": {
+			header:   http.Header{"Date": {"Wed, 21 Oct 2015 07:28:00 GMT"}, "Expires": {"Wed, 21 Oct 2015 08:28:00 GMT"}},
+			expected: "fresh for 1h0m0s (Expires)",
+		},
+		"will treat an invalid Expires as expired": {
+			header:   http.Header{"Expires": {"0"}},
+			expected: "fresh for 0s (Expires), so stale at once",
+		},
+		"will note no-cache": {
+			header:   http.Header{"Cache-Control": {"no-cache, max-age=60"}},
+			expected: "fresh for 1m0s (max-age), but revalidated before each use (no-cache)",
+		},
+		"will not store no-store": {
+			header:   http.Header{"Cache-Control": {"no-store, max-age=60"}},
+			expected: "not stored by caches (no-store)",
+		},
+		"will note a heuristic lifetime": {
+			header:   http.Header{"Last-Modified": {"Wed, 21 Oct 2015 07:28:00 GMT"}},
+			expected: "no explicit lifetime, caches may pick one from Last-Modified",
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			if got := cacheFreshness(cfg.header); got != cfg.expected {
+				t.Errorf("Unexpected freshness: got %q, want %q", got, cfg.expected)
+			}
+		})
+	}
+}
+
+func TestReportSecurityAudit(t *testing.T) {
+	type testSecurity struct {
+		url      string
+		headers  http.Header
+		expected []string
+	}
+
+	tests := map[string]testSecurity{
+		"will pass hardened headers": {
+			url: "https://thing.com/",
+			headers: http.Header{
+				"Strict-Transport-Security": {"max-age=31536000; includeSubDomains"},
+				"Content-Security-Policy":   {"default-src 'self'"},
+				"X-Content-Type-Options":    {"nosniff"},
+				"X-Frame-Options":           {"DENY"},
+				"Referrer-Policy":           {"no-referrer"},
+				"Set-Cookie":                {"session=abc; Secure; HttpOnly; SameSite=Lax"},
+			},
+			expected: []string{
+				"  pass  Strict-Transport-Security: max-age=31536000; includeSubDomains\n",
+				"  pass  Content-Security-Policy: default-src 'self'\n",
+				"  pass  X-Content-Type-Options: nosniff\n",
+				"  pass  X-Frame-Options: DENY\n",
+				"  pass  Referrer-Policy: no-referrer\n",
+				"  pass  Set-Cookie session: Secure, HttpOnly, SameSite\n",
+			},
+		},
+		"will fail missing headers": {
+			url:     "https://thing.com/",
+			headers: http.Header{"Set-Cookie": {"session=abc; HttpOnly"}},
+			expected: []string{
+				"  FAIL  Strict-Transport-Security: missing\n",
+				"  FAIL  Content-Security-Policy: missing\n",
+				"  FAIL  X-Content-Type-Options: missing\n",
+				"  FAIL  X-Frame-Options: missing, so the page can be framed by any site\n",
+				"  warn  Referrer-Policy: missing, browsers default to strict-origin-when-cross-origin\n",
+				"  FAIL  Set-Cookie session: without Secure, SameSite, so it is also sent over plain http\n",
+			},
+		},
+		"will warn about weak headers": {
+			url: "https://thing.com/",
+			headers: http.Header{
+				"Strict-Transport-Security": {"max-age=3600"},
+				"Content-Security-Policy":   {"default-src 'self'; script-src 'self' 'unsafe-inline' 'unsafe-eval'; frame-ancestors 'none'"},
+				"Referrer-Policy":           {"no-referrer, unsafe-url"},
+				"Set-Cookie":                {"prefs=dark; Secure"},
+			},
+			expected: []string{
+				"  warn  Strict-Transport-Security: max-age=3600, max-age is shorter than 180 days\n",
+				"  warn  Content-Security-Policy: default-src 'self'; script-src 'self' 'unsafe-inline' 'unsafe-eval'; frame-ancestors 'none', scripts allow 'unsafe-inline' and 'unsafe-eval'\n",
+				"  pass  X-Frame-Options: covered by the frame-ancestors 'none' of the Content-Security-Policy\n",
+				"  FAIL  Referrer-Policy: no-referrer, unsafe-url, the full URL is sent to every site\n",
+				"  warn  Set-Cookie prefs: without HttpOnly, SameSite\n",
+			},
+		},
+		"will warn about hsts over plain http": {
+			url:     "http://thing.com/",
+			headers: http.Header{"Strict-Transport-Security": {"max-age=31536000"}, "Set-Cookie": {"id=1; SameSite=None"}},
+			expected: []string{
+				"  warn  Strict-Transport-Security: sent over plain http, where browsers ignore it\n",
+				"  FAIL  Set-Cookie id: SameSite=None without Secure, which browsers reject\n",
+			},
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			request, err := http.NewRequest(http.MethodGet, cfg.url, nil)
+			if err != nil {
+				t.Errorf("Error creating http request: %v", err)
+			}
+
+			response := &http.Response{
+				Status:     "200 OK",
+				StatusCode: http.StatusOK,
+				Header:     cfg.headers,
+			}
+
+			report := New(request, response, "", &trace.Timings{}, &Presentation{AuditSecurity: true})
+			err = report.Build()
+			if err != nil {
+				t.Errorf("Error building report: %v", err)
+			}
+
+			for _, e := range cfg.expected {
+				if !strings.Contains(report.String(), e) {
+					t.Errorf("report output incorrect: got\n%v\n want it to contain\n%v\n", report.String(), e)
+				}
+			}
+			if result := report.Result(); len(result.Security) != 5+len(response.Cookies()) {
+				t.Errorf("Unexpected security checks in result: got %+v", result.Security)
+			}
+		})
+	}
+}
+
+func TestReportCDN(t *testing.T) {
+	type testCDN struct {
+		headers  http.Header
+		provider string
+		status   string
+		expected []string
+	}
+
+	tests := map[string]testCDN{
+		"will interpret a cloudflare hit": {
+			headers:  http.Header{"Cf-Cache-Status": {"HIT"}, "Cf-Ray": {"8a1b2c3d4e5f-AMS"}, "Age": {"120"}},
+			provider: "Cloudflare",
+			status:   CacheHit,
+			expected: []string{
+				"\nCDN\n  Provider:            Cloudflare\n  Cache status:        hit, served from the cache\n  Reported by:         Cf-Cache-Status: HIT\n  Age:                 2m0s\n",
+			},
+		},
+		"will take the cache closest to the client": {
+			headers:  http.Header{"X-Cache": {"HIT, MISS"}, "X-Served-By": {"cache-lhr1, cache-ams2"}, "Via": {"1.1 varnish, 1.1 varnish"}},
+			provider: "Fastly",
+			status:   CacheMiss,
+			expected: []string{
+				"  Cache status:        miss, not in the cache, fetched from the origin\n",
+				"  Via:                 1.1 varnish, 1.1 varnish\n",
+			},
+		},
+		"will name the causes of a miss": {
+			headers:  http.Header{"X-Cache": {"Miss from cloudfront"}, "Cache-Control": {"private, max-age=0"}, "Set-Cookie": {"id=1"}, "Vary": {"Accept-Encoding, Cookie"}},
+			provider: "CloudFront",
+			status:   CacheMiss,
+			expected: []string{
+				"  Likely cause:        Cache-Control private, Cache-Control max-age=0, Set-Cookie, Vary Cookie\n",
+			},
+		},
+		"will read the standard cache status": {
+			headers: http.Header{"Cache-Status": {"Origin; fwd=miss, Edge; fwd=stale"}},
+			status:  CacheRevalidated,
+		},
+		"will read the status from server timing": {
+			headers:  http.Header{"Server": {"AkamaiGHost"}, "Server-Timing": {"cdn-cache; desc=REVALIDATE_STALE, edge; dur=12, origin; dur=80.5"}},
+			provider: "Akamai",
+			status:   CacheStale,
+			expected: []string{
+				"  Reported by:         Server-Timing: cdn-cache; desc=REVALIDATE_STALE\n",
+				"  Server-Timing:       edge 12.00ms, origin 80.50ms\n",
+			},
+		},
+		"will bypass dynamic responses": {
+			headers:  http.Header{"Cf-Cache-Status": {"DYNAMIC"}},
+			provider: "Cloudflare",
+			status:   CacheBypass,
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			request, err := http.NewRequest(http.MethodGet, "https://thing.com/things", nil)
+			if err != nil {
+				t.Errorf("Error creating http request: %v", err)
+			}
+
+			response := &http.Response{
+				Status:     "200 OK",
+				StatusCode: http.StatusOK,
+				Header:     cfg.headers,
+			}
+
+			rep := New(request, response, "", &trace.Timings{}, &Presentation{Sections: Sections{SectionTrace: true}})
+			err = rep.Build()
+			if err != nil {
+				t.Errorf("Error building report: %v", err)
+			}
+
+			for _, e := range cfg.expected {
+				if !strings.Contains(rep.String(), e) {
+					t.Errorf("report output incorrect: got\n%v\n want it to contain\n%v\n", rep.String(), e)
+				}
+			}
+			result := rep.Result()
+			if result.CDN == nil || result.CDN.Provider != cfg.provider || result.CDN.CacheStatus != cfg.status {
+				t.Errorf("Unexpected CDN in result: got %+v, want provider %q and status %q", result.CDN, cfg.provider, cfg.status)
+			}
+		})
+	}
+}
+
+func TestAggregateCacheStatus(t *testing.T) {
+	aggregate := NewAggregate(0.95, 0.05)
+	for i := 0; i < 3; i++ {
+		aggregate.Add(&Result{CDN: &CDN{CacheStatus: CacheHit}, Timings: map[string]float64{"total": 0.01}})
+	}
+	aggregate.Add(&Result{CDN: &CDN{CacheStatus: CacheMiss}, Timings: map[string]float64{"total": 0.2}})
+	aggregate.Add(&Result{Error: "timeout"})
+
+	b := &bytes.Buffer{}
+	err := aggregate.Write(b, nil)
+	if err != nil {
+		t.Fatalf("Error writing summary: %v", err)
+	}
+
+	expected := []string{
+		"\nCache status, 75.0% hits (3 of 4 requests)\n",
+		"  hit:                     3 (75%)     10.00ms     10.00ms     10.00ms     10.00ms\n",
+		"  miss:                    1 (25%)    200.00ms    200.00ms    200.00ms    200.00ms\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(b.String(), e) {
+			t.Errorf("summary output incorrect: got\n%v\n want it to contain\n%v\n", b.String(), e)
+		}
+	}
+}
+
+func TestResponseDiff(t *testing.T) {
+	type testResponseDiff struct {
+		a, b     *Result
+		differ   bool
+		expected []string
+	}
+
+	base := func() *Result {
+		return &Result{
+			URL:             "https://thing.com/things",
+			Status:          http.StatusOK,
+			Proto:           "HTTP/1.1",
+			ResponseHeaders: http.Header{"Content-Type": {"application/json"}, "Date": {"Thu, 15 Oct 2026 09:00:00 GMT"}, "X-Served-By": {"web-1"}},
+			Body:            `{"id":1,"name":"thing","tags":["a","b"]}`,
+			BodySize:        41,
+			Timings:         map[string]float64{"total": 0.1},
+		}
+	}
+	other := base()
+	other.ResponseHeaders = http.Header{"Content-Type": {"application/json"}, "Date": {"Thu, 15 Oct 2026 09:00:01 GMT"}, "X-Served-By": {"web-2"}, "X-Canary": {"true"}}
+	other.Body = `{"id":1,"name":"thing","tags":["a","c"]}`
+	other.Timings = map[string]float64{"total": 0.25}
+	failed := base()
+	failed.Status = http.StatusBadGateway
+	failed.Body = "upstream unavailable\n"
+
+	tests := map[string]testResponseDiff{
+		"will find no differences but the date": {
+			a: base(),
+			b: base(),
+			expected: []string{
+				"\nStatus\n  HTTP/1.1 200 OK\n",
+				"\nHeaders (Date and Age ignored)\n  same\n",
+				"\nBody\n  same, 41 bytes\n",
+				"\nThe responses are the same\n",
+			},
+		},
+		"will diff headers and indented json": {
+			a:      base(),
+			b:      other,
+			differ: true,
+			expected: []string{
+				"+ X-Canary: true\n- X-Served-By: web-1\n+ X-Served-By: web-2\n",
+				"    \"a\",\n-     \"b\"\n+     \"c\"\n    ]\n  }\n",
+				"  total:                  100.00ms    250.00ms   +150.00ms\n",
+				"\n! The responses differ\n",
+			},
+		},
+		"will diff the status and plain bodies": {
+			a:      base(),
+			b:      failed,
+			differ: true,
+			expected: []string{
+				"\nStatus\n- HTTP/1.1 200 OK\n+ HTTP/1.1 502 Bad Gateway\n",
+				"\nBody\n- {\"id\":1,\"name\":\"thing\",\"tags\":[\"a\",\"b\"]}\n+ upstream unavailable\n",
+			},
+		},
+		"will compare bodies which weren't kept by size": {
+			a:        &Result{Status: http.StatusOK, BodySize: 10, Timings: map[string]float64{}},
+			b:        &Result{Status: http.StatusOK, BodySize: 12, Timings: map[string]float64{}},
+			differ:   true,
+			expected: []string{"  bodies differ, 10 and 12 bytes, without the content of both to compare\n"},
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			b := &bytes.Buffer{}
+			differ, err := WriteResponseDiff(b, cfg.a, cfg.b, "first", "second", nil)
+			if err != nil {
+				t.Fatalf("Error writing diff: %v", err)
+			}
+			if differ != cfg.differ {
+				t.Errorf("Unexpected differ: got %v, want %v", differ, cfg.differ)
+			}
+			for _, e := range cfg.expected {
+				if !strings.Contains(b.String(), e) {
+					t.Errorf("diff output incorrect: got\n%v\n want it to contain\n%v\n", b.String(), e)
+				}
+			}
+		})
+	}
+}
+
+func TestRegisterFormatter(t *testing.T) {
+	RegisterFormatter("test-summary", FormatterFunc(func(data *ReportData, w io.Writer) error {
+		_, err := fmt.Fprintf(w, "%s %d %s %s\n", data.Request.Method, data.Result().Status, data.Body, data.Timings.TotalRequestDuration)
+		return err
+	}))
+
+	request, err := http.NewRequest(http.MethodGet, "http://thing.com/", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+	response := &http.Response{Status: "200 OK", StatusCode: http.StatusOK, Header: http.Header{}}
+
+	report := New(request, response, "hello", &trace.Timings{TotalRequestDuration: 5 * time.Millisecond}, &Presentation{Format: "test-summary"})
+	err = report.Build()
+	if err != nil {
+		t.Fatalf("Error building report: %v", err)
+	}
+	if expected := "GET 200 hello 5ms\n"; report.String() != expected {
+		t.Errorf("Unexpected output: got %q, want %q", report.String(), expected)
+	}
+
+	report = New(request, response, "hello", &trace.Timings{}, &Presentation{Format: "unregistered"})
+	if err := report.Build(); err == nil || !strings.Contains(err.Error(), `unknown output format "unregistered"`) {
+		t.Errorf("Unexpected error for an unknown format: got %v", err)
+	}
+
+	panics := map[string]string{
+		"test-summary": `report: RegisterFormatter called twice for format "test-summary"`,
+		FormatJSON:     `report: RegisterFormatter called twice for format "json"`,
+		"":             "report: RegisterFormatter name is empty",
+	}
+	for name, expected := range panics {
+		func() {
+			defer func() {
+				if got := recover(); got != expected {
+					t.Errorf("Unexpected panic registering %q: got %v, want %s", name, got, expected)
+				}
+			}()
+			RegisterFormatter(name, FormatterFunc(func(data *ReportData, w io.Writer) error { return nil }))
+		}()
+	}
+	func() {
+		defer func() {
+			if got := recover(); got != "report: RegisterFormatter formatter is nil" {
+				t.Errorf("Unexpected panic registering a nil formatter: got %v", got)
+			}
+		}()
+		RegisterFormatter("test-nil", nil)
+	}()
+}
+
+func TestDo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/truncated":
+			w.Header().Set("Content-Length", "10")
+			w.Write([]byte("hello"))
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		default:
+			body, _ := io.ReadAll(r.Body)
+			fmt.Fprintf(w, "%s %s %s", r.Method, r.Header.Get("X-Thing"), body)
+		}
+	}))
+	defer server.Close()
+
+	result, err := Do(context.Background(), Options{
+		Method: http.MethodPost,
+		URL:    server.URL,
+		Header: http.Header{"X-Thing": {"thing"}},
+		Body:   strings.NewReader("body"),
+	})
+	if err != nil {
+		t.Fatalf("Error doing request: %v", err)
+	}
+	if result.Status != http.StatusOK || result.Body != "POST thing body" || result.Timings["total"] <= 0 {
+		t.Errorf("Unexpected result: got %+v", result)
+	}
+
+	result, err = Do(context.Background(), Options{URL: server.URL + "/truncated"})
+	var bodyErr *trace.BodyReadError
+	if !errors.As(err, &bodyErr) {
+		t.Fatalf("Unexpected error: got %v, want a BodyReadError", err)
+	}
+	if result == nil || result.Status != http.StatusOK || result.Body != "hello" || len(result.Warnings) != 1 {
+		t.Errorf("Unexpected result of a truncated body: got %+v", result)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result, err = Do(ctx, Options{URL: server.URL})
+	if !errors.Is(err, context.Canceled) || result == nil || result.Error == "" {
+		t.Errorf("Unexpected result of a cancelled request: got %+v, %v", result, err)
+	}
+}
+
+func TestReportRequestLine(t *testing.T) {
+	type testRequestLine struct {
+		url          string
+		presentation *Presentation
+		expected     string
+	}
+
+	tests := map[string]testRequestLine{
+		"will show the host and path": {
+			url:          "https://thing.com/path",
+			presentation: &Presentation{},
+			expected:     "> GET thing.com/path HTTP/1.1\n",
+		},
+		"will show the query as it was sent": {
+			url:          "https://thing.com/search?q=a+b%26c&sort=-date",
+			presentation: &Presentation{},
+			expected:     "> GET thing.com/search?q=a+b%26c&sort=-date HTTP/1.1\n",
+		},
+		"will show the query redacted": {
+			url:          "https://thing.com/file?token=secret&v=2",
+			presentation: &Presentation{Redactor: NewQueryRedactor([]string{"token"})},
+			expected:     "> GET thing.com/file?token=REDACTED&v=2 HTTP/1.1\n",
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			request, err := http.NewRequest(http.MethodGet, cfg.url, nil)
+			if err != nil {
+				t.Errorf("Error creating http request: %v", err)
+			}
+			response := &http.Response{Status: "200 OK", StatusCode: http.StatusOK, Proto: "HTTP/1.1", Header: http.Header{}}
+
+			cfg.presentation.Sections = Sections{SectionRequest: true}
+			report := New(request, response, "", &trace.Timings{}, cfg.presentation)
+			err = report.Build()
+			if err != nil {
+				t.Fatalf("Error building report: %v", err)
+			}
+			if !strings.HasPrefix(report.String(), cfg.expected) {
+				t.Errorf("Unexpected request line: got\n%v\nwant it to start with\n%v", report.String(), cfg.expected)
+			}
+		})
+	}
+}
+
+type testFormatProgress struct {
+	progress trace.Progress
+	width    int
+	expected string
+}
+
+func TestFormatProgress(t *testing.T) {
+	tests := map[string]testFormatProgress{
+		"will draw a bar when the size of the body is known": {
+			progress: trace.Progress{BodyBytes: 512 * 1024, BodyTotal: 2 * 1024 * 1024, Elapsed: time.Second},
+			expected: "[==========>                             ]  25% 512.00 KiB of 2.00 MiB at 512.00 KiB/s",
+		},
+		"will fill the bar once the body is read": {
+			progress: trace.Progress{BodyBytes: 1024, BodyTotal: 1024, Elapsed: time.Second},
+			expected: "[========================================] 100% 1.00 KiB of 1.00 KiB at 1.00 KiB/s",
+		},
+		"will narrow the bar to fit the width": {
+			progress: trace.Progress{BodyBytes: 512, BodyTotal: 1024, Elapsed: time.Second},
+			width:    60,
+			expected: "[=========>        ]  50% 512.00 B of 1.00 KiB at 512.00 B/s",
+		},
+		"will leave out the bar when it doesn't fit": {
+			progress: trace.Progress{BodyBytes: 512, BodyTotal: 1024, Elapsed: time.Second},
+			width:    40,
+			expected: "50% 512.00 B of 1.00 KiB at 512.00 B/s",
+		},
+		"will count the bytes when the size of the body isn't known": {
+			progress: trace.Progress{BodyBytes: 3 * 1024 * 1024, BodyTotal: -1, Elapsed: 2 * time.Second},
+			expected: "3.00 MiB at 1.50 MiB/s",
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			line := FormatProgress(cfg.progress, cfg.width)
+			if line != cfg.expected {
+				t.Errorf("Unexpected progress: got\n%q\nwant\n%q", line, cfg.expected)
+			}
+			if cfg.width > 0 && len(line) > cfg.width {
+				t.Errorf("Progress is %d columns, wider than %d", len(line), cfg.width)
+			}
+		})
+	}
+}
+
+func TestWriteScenario(t *testing.T) {
+	steps := []ScenarioStep{
+		{Name: "login", Result: &Result{Status: 200, Timings: map[string]float64{"connection": 0.0452, "response_delay": 0.12011, "total": 0.17}}},
+		{Name: "GET /me", Result: &Result{Status: 401, Timings: map[string]float64{"connection": 0, "response_delay": 0.08, "total": 0.082}}},
+		{Name: "logout"},
+		{Name: "orders", Result: &Result{Status: 200, Timings: map[string]float64{"connection": 0, "response_delay": 0.01, "total": 0.011}}, Failure: "no id"},
+	}
+
+	out := &bytes.Buffer{}
+	err := WriteScenario(out, "checkout", steps, nil)
+	if err != nil {
+		t.Fatalf("Error writing scenario: %v", err)
+	}
+
+	expected := "Scenario checkout, 4 steps\n" +
+		"     # status  connection  response_delay       total  step\n" +
+		"     1    200     45.20ms        120.11ms    170.00ms  login\n" +
+		"     2    401      0.00ms         80.00ms     82.00ms  GET /me\n" +
+		"     3      -           -               -           -  logout (not run)\n" +
+		"     4    200      0.00ms         10.00ms     11.00ms  orders (failed: no id)\n" +
+		"\n" +
+		"Scenario total: 263.00ms for 3 of 4 steps, 2 failed\n"
+	if out.String() != expected {
+		t.Errorf("Unexpected scenario summary: got\n%s\nwant\n%s", out.String(), expected)
+	}
+}
+
+func TestWriteProbes(t *testing.T) {
+	probes := []Probe{
+		{Timings: &trace.Timings{DNSDuration: 2 * time.Millisecond, ConnectionDialDuration: 10 * time.Millisecond, TLSDuration: 30 * time.Millisecond, TotalRequestDuration: 42 * time.Millisecond}, Detail: "TLS 1.3"},
+		{Err: errors.New("connection refused")},
+		{Timings: &trace.Timings{DNSDuration: 4 * time.Millisecond, ConnectionDialDuration: 20 * time.Millisecond, TLSDuration: 50 * time.Millisecond, TotalRequestDuration: 74 * time.Millisecond}, Detail: "TLS 1.2"},
+	}
+
+	out := &bytes.Buffer{}
+	err := WriteProbes(out, trace.ProbeTLS, "example.com:443", probes, nil)
+	if err != nil {
+		t.Fatalf("Error writing probes: %v", err)
+	}
+
+	expected := "TLS handshake of example.com:443\n" +
+		"     #         dns     connect         tls       total\n" +
+		"     1      2.00ms     10.00ms     30.00ms     42.00ms  TLS 1.3\n" +
+		"     2  failed: connection refused\n" +
+		"     3      4.00ms     20.00ms     50.00ms     74.00ms  TLS 1.2\n" +
+		"\n" +
+		"                               min         p50         p90         p99         max\n" +
+		"  dns:                      2.00ms      3.00ms      3.80ms      3.98ms      4.00ms\n" +
+		"  connect:                 10.00ms     15.00ms     19.00ms     19.90ms     20.00ms\n" +
+		"  tls:                     30.00ms     40.00ms     48.00ms     49.80ms     50.00ms\n" +
+		"  total:                   42.00ms     58.00ms     70.80ms     73.68ms     74.00ms\n" +
+		"\n" +
+		"1 of 3 probes failed\n"
+	if out.String() != expected {
+		t.Errorf("Unexpected probes: got\n%s\nwant\n%s", out.String(), expected)
+	}
+
+	err = WriteProbes(out, "http", "example.com", probes, nil)
+	if err == nil {
+		t.Errorf("Expected an error for an unknown phase")
+	}
+}
+
+type testTimeFormat struct {
+	unit      string
+	precision int
+	duration  time.Duration
+	expected  string
+	signed    string
+	width     int
+	err       string
+}
+
+func TestTimeFormat(t *testing.T) {
+	tests := map[string]testTimeFormat{
+		"milliseconds by default": {
+			unit:      TimeUnitMillis,
+			precision: DefaultTimePrecision,
+			duration:  12345678 * time.Nanosecond,
+			expected:  "12.35ms",
+			signed:    "+12.35ms",
+			width:     11,
+		},
+		"microseconds without decimals": {
+			unit:      TimeUnitMicros,
+			precision: 0,
+			duration:  12345678 * time.Nanosecond,
+			expected:  "12346µs",
+			signed:    "+12346µs",
+			width:     11,
+		},
+		"microseconds with many decimals": {
+			unit:      TimeUnitMicros,
+			precision: 3,
+			duration:  12345678 * time.Nanosecond,
+			expected:  "12345.678µs",
+			signed:    "+12345.678µs",
+			width:     15,
+		},
+		"seconds with more decimals": {
+			unit:      TimeUnitSeconds,
+			precision: 4,
+			duration:  1234567890 * time.Nanosecond,
+			expected:  "1.2346s",
+			signed:    "+1.2346s",
+			width:     10,
+		},
+		"seconds without decimals in a column wide enough for headings": {
+			unit:      TimeUnitSeconds,
+			precision: 0,
+			duration:  1234567890 * time.Nanosecond,
+			expected:  "1s",
+			signed:    "+1s",
+			width:     10,
+		},
+		"unknown unit": {
+			unit:      "m",
+			precision: DefaultTimePrecision,
+			err:       `invalid time unit "m", expected us, ms or s`,
+		},
+		"negative precision": {
+			unit:      TimeUnitMillis,
+			precision: -1,
+			err:       "invalid precision -1, expected 0 to 9 decimals",
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			format, err := NewTimeFormat(cfg.unit, cfg.precision)
+			if cfg.err != "" {
+				if err == nil || err.Error() != cfg.err {
+					t.Errorf("Unexpected error: got %v, want %q", err, cfg.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Error creating the time format: %v", err)
+			}
+			if got := format.Duration(cfg.duration); got != cfg.expected {
+				t.Errorf("Unexpected duration: got %q, want %q", got, cfg.expected)
+			}
+			if got := format.signedSeconds(cfg.duration.Seconds()); got != cfg.signed {
+				t.Errorf("Unexpected signed duration: got %q, want %q", got, cfg.signed)
+			}
+			if got := format.Width(); got != cfg.width {
+				t.Errorf("Unexpected width: got %d, want %d", got, cfg.width)
+			}
+		})
+	}
+
+	var zero TimeFormat
+	if got := zero.Duration(12345678 * time.Nanosecond); got != "12.35ms" {
+		t.Errorf("Unexpected duration for the zero format: got %q, want %q", got, "12.35ms")
+	}
+}
+
+func TestReportTimeUnit(t *testing.T) {
+	format, err := NewTimeFormat(TimeUnitMicros, 1)
+	if err != nil {
+		t.Fatalf("Error creating the time format: %v", err)
+	}
+	pres := &Presentation{TimeFormat: format}
+
+	probes := []Probe{
+		{Timings: &trace.Timings{DNSDuration: 1500 * time.Microsecond}},
+		{Timings: &trace.Timings{DNSDuration: 1234567890 * time.Nanosecond}},
+	}
+	out := &bytes.Buffer{}
+	err = WriteProbes(out, trace.ProbeDNS, "example.com", probes[:1], pres)
+	if err != nil {
+		t.Fatalf("Error writing probes: %v", err)
+	}
+	expected := "DNS lookup of example.com\n" +
+		"     #           dns\n" +
+		"     1      1500.0µs\n"
+	if out.String() != expected {
+		t.Errorf("Unexpected probes: got\n%s\nwant\n%s", out.String(), expected)
+	}
+
+	// Every duration column is as wide as the durations of the unit
+	out.Reset()
+	err = WriteKeepAlive(out, []*Result{
+		{Timings: map[string]float64{"total": 1.2345678}},
+		{Reused: true, Timings: map[string]float64{"total": 0.0012}},
+	}, pres)
+	if err != nil {
+		t.Fatalf("Error writing keep-alive: %v", err)
+	}
+	lines := strings.Split(out.String(), "\n")
+	if lines[1] != "                                cold          warm          diff" {
+		t.Errorf("Unexpected heading: got %q", lines[1])
+	}
+	for _, line := range lines {
+		if strings.HasPrefix(line, "  total:") && line != "  total:                 1234567.8µs      1200.0µs  -1233367.8µs" {
+			t.Errorf("Unexpected total: got %q", line)
+		}
+	}
+
+	out.Reset()
+	w := NewCSVWriter(out, nil, format)
+	err = w.Write(&Result{URL: "https://example.com", Method: "GET", Status: 200, Timings: map[string]float64{"dns": 0.0015, "total": 0.02}})
+	if err != nil {
+		t.Fatalf("Error writing CSV: %v", err)
+	}
+	csvLines := strings.Split(out.String(), "\n")
+	if !strings.Contains(csvLines[0], ",dns_us,") || !strings.Contains(csvLines[1], ",1500.0,") || !strings.Contains(csvLines[1], ",20000.0") {
+		t.Errorf("Unexpected CSV in microseconds: got\n%s", out.String())
+	}
+}
@@ -0,0 +1,259 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// diffIgnoredHeaders change with every response, so differences in them are
+// not shown.
+var diffIgnoredHeaders = map[string]bool{"Date": true, "Age": true}
+
+// Limits of the body diff: bodies with more lines than maxDiffLines in total
+// are only compared as a whole, and at most maxDiffOutput lines of the diff
+// are shown, with diffContext unchanged lines around each change.
+const (
+	maxDiffLines  = 4000
+	maxDiffOutput = 60
+	diffContext   = 2
+)
+
+// WriteResponseDiff writes the differences between the responses of two
+// results, a and b described by labelA and labelB: their status, headers
+// other than Date and Age, and bodies line by line, indented first when
+// both are JSON, and the difference in the duration of each phase. It
+// returns whether the responses differ.
+func WriteResponseDiff(w io.Writer, a, b *Result, labelA, labelB string, pres *Presentation) (bool, error) {
+	format := pres.timeFormat()
+	out := &bytes.Buffer{}
+	differ := false
+
+	fmt.Fprintf(out, "Response diff\n  A %s\n  B %s\n", labelA, labelB)
+
+	fmt.Fprintf(out, "\nStatus\n")
+	statusA, statusB := diffStatus(a), diffStatus(b)
+	if statusA == statusB {
+		fmt.Fprintf(out, "  %s\n", statusA)
+	} else {
+		differ = true
+		fmt.Fprintf(out, "- %s\n+ %s\n", statusA, statusB)
+	}
+
+	headerLines := diffHeaders(a, b)
+	fmt.Fprintf(out, "\nHeaders (Date and Age ignored)\n")
+	if len(headerLines) == 0 {
+		fmt.Fprintf(out, "  same\n")
+	}
+	for _, line := range headerLines {
+		differ = true
+		fmt.Fprintln(out, line)
+	}
+
+	bodyLines := diffBodies(a, b)
+	fmt.Fprintf(out, "\nBody\n")
+	if len(bodyLines) == 0 {
+		fmt.Fprintf(out, "  same, %d bytes\n", a.BodySize)
+	}
+	for _, line := range bodyLines {
+		differ = true
+		fmt.Fprintln(out, line)
+	}
+
+	if a.Error == "" && b.Error == "" {
+		fmt.Fprintf(out, "\nTimings\n")
+		fmt.Fprintf(out, "  %-21s%s %s %s\n", "", format.column("A"), format.column("B"), format.column("diff"))
+		for _, p := range phases {
+			ta, tb := a.Timings[p.Name], b.Timings[p.Name]
+			fmt.Fprintf(out, "  %-21s%s %s %s\n", p.Name+":", format.column(format.seconds(ta)), format.column(format.seconds(tb)), format.column(format.signedSeconds(tb-ta)))
+		}
+	}
+
+	fmt.Fprintln(out)
+	if differ {
+		fmt.Fprintf(out, "! The responses differ\n")
+	} else {
+		fmt.Fprintf(out, "The responses are the same\n")
+	}
+
+	_, err := w.Write(out.Bytes())
+	return differ, err
+}
+
+// diffStatus describes how the request of result was answered.
+func diffStatus(result *Result) string {
+	if result.Error != "" {
+		return "error: " + result.Error
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s %d %s", result.Proto, result.Status, http.StatusText(result.Status)))
+}
+
+// diffHeaders returns the header lines of a missing from b, prefixed by -,
+// and those of b missing from a, prefixed by +, by header name.
+func diffHeaders(a, b *Result) []string {
+	names := map[string]bool{}
+	for name := range a.ResponseHeaders {
+		names[name] = true
+	}
+	for name := range b.ResponseHeaders {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		if !diffIgnoredHeaders[name] {
+			sorted = append(sorted, name)
+		}
+	}
+	sort.Strings(sorted)
+
+	lines := []string{}
+	for _, name := range sorted {
+		valueA, valueB := strings.Join(a.ResponseHeaders[name], ", "), strings.Join(b.ResponseHeaders[name], ", ")
+		_, inA := a.ResponseHeaders[name]
+		_, inB := b.ResponseHeaders[name]
+		if valueA == valueB && inA == inB {
+			continue
+		}
+		if inA {
+			lines = append(lines, fmt.Sprintf("- %s: %s", name, valueA))
+		}
+		if inB {
+			lines = append(lines, fmt.Sprintf("+ %s: %s", name, valueB))
+		}
+	}
+	return lines
+}
+
+// diffBodies returns the lines of the diff of the bodies of a and b, or a
+// summary of how they differ when they can't be compared line by line.
+func diffBodies(a, b *Result) []string {
+	if a.Error != "" || b.Error != "" {
+		return nil
+	}
+	if a.BodyEncoding == BodyEncodingBase64 || b.BodyEncoding == BodyEncodingBase64 {
+		if a.Body == b.Body && a.BodySize == b.BodySize {
+			return nil
+		}
+		return []string{fmt.Sprintf("  binary bodies differ, %d and %d bytes", a.BodySize, b.BodySize)}
+	}
+	if (a.Body == "" && a.BodySize > 0) || (b.Body == "" && b.BodySize > 0) {
+		if a.BodySize == b.BodySize && (a.BodySHA256 == "" || a.BodySHA256 == b.BodySHA256) {
+			return nil
+		}
+		return []string{fmt.Sprintf("  bodies differ, %d and %d bytes, without the content of both to compare", a.BodySize, b.BodySize)}
+	}
+	if a.Body == b.Body {
+		return nil
+	}
+
+	bodyA, bodyB := a.Body, b.Body
+	if json.Valid([]byte(bodyA)) && json.Valid([]byte(bodyB)) {
+		bodyA, bodyB = indentJSON(bodyA), indentJSON(bodyB)
+	}
+	linesA := strings.Split(strings.TrimSuffix(bodyA, "\n"), "\n")
+	linesB := strings.Split(strings.TrimSuffix(bodyB, "\n"), "\n")
+	if len(linesA)+len(linesB) > maxDiffLines {
+		return []string{fmt.Sprintf("  bodies differ, %d and %d bytes, too long to compare line by line", a.BodySize, b.BodySize)}
+	}
+	lines := formatLineDiff(diffLines(linesA, linesB))
+	if a.BodyTruncated > 0 || b.BodyTruncated > 0 {
+		lines = append(lines, "  (only the start of the bodies was kept, as they were truncated)")
+	}
+	return lines
+}
+
+// indentJSON returns a JSON body indented, so a change in a body on a single
+// line is shown on the lines of the values which changed.
+func indentJSON(body string) string {
+	indented := &bytes.Buffer{}
+	if json.Indent(indented, []byte(body), "", "  ") != nil {
+		return body
+	}
+	return indented.String()
+}
+
+// lineOp is a line of a diff: kept in both, or only in a (-) or b (+).
+type lineOp struct {
+	Op   byte // ' ', '-' or '+'
+	Line string
+}
+
+// diffLines returns the shortest edit turning the lines of a into those of
+// b, from their longest common subsequence.
+func diffLines(a, b []string) []lineOp {
+	// common[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:]
+	common := make([][]int, len(a)+1)
+	for i := range common {
+		common[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+
+	ops := []lineOp{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, lineOp{' ', a[i]})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && common[i+1][j] >= common[i][j+1]):
+			ops = append(ops, lineOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, lineOp{'+', b[j]})
+			j++
+		}
+	}
+	return ops
+}
+
+// formatLineDiff returns the changed lines of ops with diffContext unchanged
+// lines around them, a ... marking those left out, and at most
+// maxDiffOutput lines.
+func formatLineDiff(ops []lineOp) []string {
+	show := make([]bool, len(ops))
+	for i, op := range ops {
+		if op.Op == ' ' {
+			continue
+		}
+		for k := i - diffContext; k <= i+diffContext; k++ {
+			if k >= 0 && k < len(ops) {
+				show[k] = true
+			}
+		}
+	}
+
+	lines := []string{}
+	skipped := false
+	for i, op := range ops {
+		if !show[i] {
+			skipped = true
+			continue
+		}
+		if skipped && len(lines) > 0 {
+			lines = append(lines, "  ...")
+		}
+		skipped = false
+		lines = append(lines, string(op.Op)+" "+op.Line)
+	}
+	if len(lines) > maxDiffOutput {
+		more := len(lines) - maxDiffOutput
+		lines = append(lines[:maxDiffOutput], fmt.Sprintf("  ... and %d more lines", more))
+	}
+	return lines
+}
@@ -0,0 +1,90 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+
+	"github.com/berndhartzer/http-trace/stats"
+)
+
+const (
+	// bootstrapResamples is the number of resamples the confidence interval
+	// of the difference between two runs is taken from.
+	bootstrapResamples = 2000
+	// bootstrapSeed seeds the resampling, so comparing the same runs always
+	// gives the same intervals.
+	bootstrapSeed = 1
+	// minRunRequests is the number of successful requests in each run below
+	// which the test is unlikely to find even large regressions.
+	minRunRequests = 10
+)
+
+// WriteRunComparison compares the timings of two runs, such as of two
+// releases, phase by phase with the Mann-Whitney U test, showing the
+// difference between the medians with a bootstrapped confidence interval and
+// Cliff's delta as the effect size. Phases which are significantly slower in
+// b, by more than threshold (such as 0.1 for 10%), are flagged as
+// regressions. It returns whether there were any.
+func WriteRunComparison(w io.Writer, a, b *Target, threshold float64, pres *Presentation) (bool, error) {
+	format := pres.timeFormat()
+	width := format.Width()
+	out := &bytes.Buffer{}
+	highlight := func(color, s string) string {
+		if pres != nil && pres.Color {
+			return colorize(color, s)
+		}
+		return s
+	}
+	rng := rand.New(rand.NewSource(bootstrapSeed))
+	confidence := 1 - significanceLevel
+
+	fmt.Fprintf(out, "Run comparison (median, Mann-Whitney U)\n  A %s\n  B %s\n", a.URL, b.URL)
+	fmt.Fprintf(out, "  %-21s%*s %*s %*s %*s %7s  %s\n", "", width, "A", width, "B", width, "diff", 2*width-1, fmt.Sprintf("%g%% interval", confidence*100), "p", "effect")
+	fmt.Fprintf(out, "  %-21s%*d %*d\n", "requests:", width, len(a.Results), width, len(b.Results))
+	fmt.Fprintf(out, "  %-21s%*d %*d\n", "failed:", width, countFailures(a.Results), width, countFailures(b.Results))
+
+	regressions := []string{}
+	for _, p := range phases {
+		valuesA, valuesB := successfulTimings(a.Results, p.Name), successfulTimings(b.Results, p.Name)
+		if len(valuesA) == 0 || len(valuesB) == 0 {
+			fmt.Fprintf(out, "  %-21s%*s %*s\n", p.Name+":", width, "-", width, "-")
+			continue
+		}
+
+		medianA, medianB := stats.Median(valuesA), stats.Median(valuesB)
+		diff := medianB - medianA
+		lower, upper := stats.BootstrapMedianDiff(valuesA, valuesB, confidence, bootstrapResamples, rng)
+		_, pValue := stats.MannWhitney(valuesA, valuesB)
+		delta := stats.CliffsDelta(valuesA, valuesB)
+
+		line := fmt.Sprintf("  %-21s%*s %*s %*s %*s %7.3f  %+.2f %s", p.Name+":",
+			width, format.seconds(medianA), width, format.seconds(medianB), width, format.signedSeconds(diff),
+			2*width-1, format.secondsRange(lower, upper), pValue, delta, stats.EffectSize(delta))
+		changed := pValue < significanceLevel && (diff > minRegression && diff > medianA*threshold || -diff > minRegression && -diff > medianA*threshold)
+		switch {
+		case changed && diff > 0:
+			regressions = append(regressions, p.Name)
+			line = highlight(ansiRed, line+"  ! regression")
+		case changed:
+			line = highlight(ansiGreen, line)
+		}
+		fmt.Fprintln(out, line)
+	}
+
+	fmt.Fprintln(out)
+	totalA, totalB := successfulTimings(a.Results, "total"), successfulTimings(b.Results, "total")
+	if len(totalA) < minRunRequests || len(totalB) < minRunRequests {
+		fmt.Fprintf(out, "! with fewer than %d successful requests in each run the test is unlikely to find regressions\n", minRunRequests)
+	}
+	if len(regressions) > 0 {
+		fmt.Fprintf(out, "! B regressed significantly (p < %g) by more than %g%% in %s\n", significanceLevel, threshold*100, strings.Join(regressions, ", "))
+	} else {
+		fmt.Fprintf(out, "No significant regressions (p < %g) of more than %g%%\n", significanceLevel, threshold*100)
+	}
+
+	_, err := w.Write(out.Bytes())
+	return len(regressions) > 0, err
+}
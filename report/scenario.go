@@ -0,0 +1,67 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// ScenarioStep is a step of a scenario and its result, which is nil if the
+// step wasn't run because an earlier one failed.
+type ScenarioStep struct {
+	Name    string
+	Result  *Result
+	Failure string // Why the step failed although there was a response, such as a value it couldn't capture
+}
+
+// WriteScenario writes a line for each step of a scenario with its status and
+// the durations of its connection, response delay and total, followed by the
+// total of the steps which were run.
+func WriteScenario(w io.Writer, name string, steps []ScenarioStep, pres *Presentation) error {
+	format := pres.timeFormat()
+	width := format.Width()
+	out := &bytes.Buffer{}
+	title := "Scenario"
+	if name != "" {
+		title += " " + name
+	}
+	fmt.Fprintf(out, "%s, %d steps\n", title, len(steps))
+	fmt.Fprintf(out, "  %4s %6s %*s %*s %*s  %s\n", "#", "status", width, "connection", width+4, "response_delay", width, "total", "step")
+
+	var total float64
+	run, failed := 0, 0
+	for i, s := range steps {
+		r := s.Result
+		switch {
+		case r == nil:
+			fmt.Fprintf(out, "  %4d %6s %*s %*s %*s  %s (not run)\n", i+1, "-", width, "-", width+4, "-", width, "-", s.Name)
+			continue
+		case r.Error != "":
+			fmt.Fprintf(out, "  %4d %6s %*s %*s %*s  %s (failed: %s)\n", i+1, "-", width, "-", width+4, "-", width, "-", s.Name, r.Error)
+			run++
+			failed++
+			continue
+		}
+		run++
+		if r.Status >= 400 || s.Failure != "" {
+			failed++
+		}
+		total += r.Timings["total"]
+		fmt.Fprintf(out, "  %4d %6d %*s %*s %*s  %s", i+1, r.Status,
+			width, format.seconds(r.Timings["connection"]), width+4, format.seconds(r.Timings["response_delay"]), width, format.seconds(r.Timings["total"]), s.Name)
+		if s.Failure != "" {
+			fmt.Fprintf(out, " (failed: %s)", s.Failure)
+		}
+		fmt.Fprintln(out)
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "Scenario total: %s for %d of %d steps", format.seconds(total), run, len(steps))
+	if failed > 0 {
+		fmt.Fprintf(out, ", %d failed", failed)
+	}
+	fmt.Fprintln(out)
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
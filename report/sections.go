@@ -0,0 +1,67 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Sections of a report which can be shown or hidden.
+const (
+	SectionRequest    = "request"    // The request, echoed in > lines
+	SectionStatus     = "status"     // The response status line
+	SectionHeaders    = "headers"    // The response headers
+	SectionBody       = "body"       // The response body
+	SectionTrace      = "trace"      // The timings of each phase, and derived metrics
+	SectionConnection = "connection" // The connection setup timings within the trace
+	SectionChunks     = "chunks"     // When the chunks of a chunked response arrived
+)
+
+// AllSections lists every section, in the order they appear in a report.
+var AllSections = []string{SectionRequest, SectionStatus, SectionHeaders, SectionBody, SectionTrace, SectionConnection, SectionChunks}
+
+// Sections is the set of sections of a report to show. A nil Sections shows
+// all of them.
+type Sections map[string]bool
+
+// ParseSections parses a comma separated list of sections to show, such as
+// "request,trace".
+func ParseSections(spec string) (Sections, error) {
+	s := Sections{}
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !isSection(name) {
+			return nil, fmt.Errorf("unknown report section %q, expected some of %s", name, strings.Join(AllSections, ", "))
+		}
+		s[name] = true
+	}
+	return s, nil
+}
+
+func isSection(name string) bool {
+	for _, section := range AllSections {
+		if name == section {
+			return true
+		}
+	}
+	return false
+}
+
+// Shows reports whether section is shown.
+func (s Sections) Shows(section string) bool {
+	return s == nil || s[section]
+}
+
+// Hide returns a copy of s without sections.
+func (s Sections) Hide(sections ...string) Sections {
+	hidden := Sections{}
+	for _, section := range AllSections {
+		hidden[section] = s.Shows(section)
+	}
+	for _, section := range sections {
+		delete(hidden, section)
+	}
+	return hidden
+}
@@ -0,0 +1,222 @@
+package report
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Grades of a SecurityCheck.
+const (
+	GradePass = "pass" // The header is set as it should be
+	GradeWarn = "warn" // The header is missing or weak, but that is not always a problem
+	GradeFail = "fail" // The header is missing or set so it doesn't protect the response
+)
+
+// minHSTSMaxAge is the shortest max-age of Strict-Transport-Security which
+// passes, 180 days, below which visitors are soon unprotected again.
+const minHSTSMaxAge = 180 * 24 * 60 * 60
+
+// SecurityCheck is the grade of one of the security headers of a response, in
+// the audit of a Result.
+type SecurityCheck struct {
+	Header string `json:"header"`
+	Grade  string `json:"grade"`
+	Detail string `json:"detail"`
+}
+
+// Mark returns the marker the text report shows for the grade, with a failure
+// in capitals to stand out.
+func (c SecurityCheck) Mark() string {
+	if c.Grade == GradeFail {
+		return "FAIL"
+	}
+	return c.Grade
+}
+
+// auditSecurity grades the security headers of the response: HSTS, CSP,
+// X-Content-Type-Options, X-Frame-Options, Referrer-Policy and the flags of
+// each cookie it sets.
+func auditSecurity(data *reportData) []SecurityCheck {
+	if !data.Presentation.AuditSecurity {
+		return nil
+	}
+
+	header := data.Response.Header
+	https := data.Request.URL.Scheme == "https"
+	csp := header.Get("Content-Security-Policy")
+	checks := []SecurityCheck{
+		checkHSTS(header.Get("Strict-Transport-Security"), https),
+		checkCSP(csp, header.Get("Content-Security-Policy-Report-Only")),
+		checkContentTypeOptions(header.Get("X-Content-Type-Options")),
+		checkFrameOptions(header.Get("X-Frame-Options"), csp),
+		checkReferrerPolicy(header.Get("Referrer-Policy")),
+	}
+	for _, cookie := range data.Response.Cookies() {
+		checks = append(checks, checkCookie(cookie, https))
+	}
+	return checks
+}
+
+func checkHSTS(value string, https bool) SecurityCheck {
+	c := SecurityCheck{Header: "Strict-Transport-Security"}
+	switch {
+	case !https && value == "":
+		c.Grade, c.Detail = GradeWarn, "missing, it can only be set over https"
+	case !https:
+		c.Grade, c.Detail = GradeWarn, "sent over plain http, where browsers ignore it"
+	case value == "":
+		c.Grade, c.Detail = GradeFail, "missing"
+	default:
+		maxAge, ok := directiveValue(value, "max-age")
+		seconds, err := strconv.ParseInt(strings.Trim(maxAge, `"`), 10, 64)
+		switch {
+		case !ok || err != nil:
+			c.Grade, c.Detail = GradeFail, value+", without a valid max-age"
+		case seconds == 0:
+			c.Grade, c.Detail = GradeFail, value+", max-age=0 removes the policy"
+		case seconds < minHSTSMaxAge:
+			c.Grade, c.Detail = GradeWarn, value+", max-age is shorter than 180 days"
+		default:
+			c.Grade, c.Detail = GradePass, value
+		}
+	}
+	return c
+}
+
+func checkCSP(value, reportOnly string) SecurityCheck {
+	c := SecurityCheck{Header: "Content-Security-Policy"}
+	switch {
+	case value == "" && reportOnly != "":
+		c.Grade, c.Detail = GradeWarn, "only Content-Security-Policy-Report-Only, which reports violations without blocking them"
+	case value == "":
+		c.Grade, c.Detail = GradeFail, "missing"
+	default:
+		unsafe := []string{}
+		for _, source := range []string{"'unsafe-inline'", "'unsafe-eval'"} {
+			if scriptSourcesAllow(value, source) {
+				unsafe = append(unsafe, source)
+			}
+		}
+		if len(unsafe) > 0 {
+			c.Grade, c.Detail = GradeWarn, fmt.Sprintf("%s, scripts allow %s", value, strings.Join(unsafe, " and "))
+		} else {
+			c.Grade, c.Detail = GradePass, value
+		}
+	}
+	return c
+}
+
+// scriptSourcesAllow reports whether the scripts of the policy allow source,
+// as given by script-src or, without it, default-src.
+func scriptSourcesAllow(policy, source string) bool {
+	sources, ok := directiveValue(policy, "script-src")
+	if !ok {
+		sources, _ = directiveValue(policy, "default-src")
+	}
+	for _, s := range strings.Fields(sources) {
+		if strings.EqualFold(s, source) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkContentTypeOptions(value string) SecurityCheck {
+	c := SecurityCheck{Header: "X-Content-Type-Options"}
+	switch {
+	case value == "":
+		c.Grade, c.Detail = GradeFail, "missing"
+	case strings.EqualFold(strings.TrimSpace(value), "nosniff"):
+		c.Grade, c.Detail = GradePass, value
+	default:
+		c.Grade, c.Detail = GradeFail, value+", expected nosniff"
+	}
+	return c
+}
+
+func checkFrameOptions(value, csp string) SecurityCheck {
+	c := SecurityCheck{Header: "X-Frame-Options"}
+	ancestors, framed := directiveValue(csp, "frame-ancestors")
+	switch v := strings.ToUpper(strings.TrimSpace(value)); {
+	case v == "DENY" || v == "SAMEORIGIN":
+		c.Grade, c.Detail = GradePass, value
+	case framed:
+		c.Grade, c.Detail = GradePass, "covered by the frame-ancestors "+ancestors+" of the Content-Security-Policy"
+	case strings.HasPrefix(v, "ALLOW-FROM"):
+		c.Grade, c.Detail = GradeWarn, value+", ALLOW-FROM is ignored by current browsers, use frame-ancestors"
+	case v == "":
+		c.Grade, c.Detail = GradeFail, "missing, so the page can be framed by any site"
+	default:
+		c.Grade, c.Detail = GradeFail, value+", expected DENY or SAMEORIGIN"
+	}
+	return c
+}
+
+func checkReferrerPolicy(value string) SecurityCheck {
+	c := SecurityCheck{Header: "Referrer-Policy"}
+	if value == "" {
+		c.Grade, c.Detail = GradeWarn, "missing, browsers default to strict-origin-when-cross-origin"
+		return c
+	}
+
+	// Browsers use the last of a list of policies they support
+	policies := strings.Split(value, ",")
+	policy := strings.ToLower(strings.TrimSpace(policies[len(policies)-1]))
+	switch policy {
+	case "unsafe-url":
+		c.Grade, c.Detail = GradeFail, value+", the full URL is sent to every site"
+	case "no-referrer-when-downgrade", "origin-when-cross-origin":
+		c.Grade, c.Detail = GradeWarn, value+", the full URL is sent to other sites"
+	default:
+		c.Grade, c.Detail = GradePass, value
+	}
+	return c
+}
+
+func checkCookie(cookie *http.Cookie, https bool) SecurityCheck {
+	c := SecurityCheck{Header: "Set-Cookie " + cookie.Name}
+	missing := []string{}
+	if !cookie.Secure {
+		missing = append(missing, "Secure")
+	}
+	if !cookie.HttpOnly {
+		missing = append(missing, "HttpOnly")
+	}
+	if cookie.SameSite == 0 || cookie.SameSite == http.SameSiteDefaultMode {
+		missing = append(missing, "SameSite")
+	}
+
+	switch {
+	case cookie.SameSite == http.SameSiteNoneMode && !cookie.Secure:
+		c.Grade, c.Detail = GradeFail, "SameSite=None without Secure, which browsers reject"
+	case !cookie.Secure && https:
+		c.Grade, c.Detail = GradeFail, "without "+strings.Join(missing, ", ")+", so it is also sent over plain http"
+	case len(missing) > 0:
+		c.Grade, c.Detail = GradeWarn, "without "+strings.Join(missing, ", ")
+	default:
+		c.Grade, c.Detail = GradePass, "Secure, HttpOnly, SameSite"
+	}
+	return c
+}
+
+// directiveValue returns the value of the directive name of a header made of
+// directives separated by semicolons, such as max-age=300 or
+// script-src 'self', and whether there is one.
+func directiveValue(header, name string) (string, bool) {
+	for _, directive := range strings.Split(header, ";") {
+		directive = strings.TrimSpace(directive)
+		i := strings.IndexAny(directive, "= ")
+		if i < 0 {
+			if strings.EqualFold(directive, name) {
+				return "", true
+			}
+			continue
+		}
+		if strings.EqualFold(directive[:i], name) {
+			return strings.TrimSpace(directive[i+1:]), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,61 @@
+package report
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// serverTimings returns the durations of the metrics the server sent in
+// Server-Timing headers or trailers, such as "app;dur=47.2", in seconds keyed
+// by name. Metrics without a duration are left out, and of those sent more
+// than once the first is kept.
+func serverTimings(res *http.Response) map[string]float64 {
+	timings := map[string]float64{}
+	if res == nil {
+		return timings
+	}
+	values := append(append([]string{}, res.Header.Values("Server-Timing")...), res.Trailer.Values("Server-Timing")...)
+	for _, value := range values {
+		for _, metric := range splitQuoted(value, ',') {
+			params := splitQuoted(metric, ';')
+			name := strings.TrimSpace(params[0])
+			if name == "" {
+				continue
+			}
+			for _, param := range params[1:] {
+				i := strings.Index(param, "=")
+				if i < 0 || !strings.EqualFold(strings.TrimSpace(param[:i]), "dur") {
+					continue
+				}
+				millis, err := strconv.ParseFloat(strings.Trim(strings.TrimSpace(param[i+1:]), `"`), 64)
+				if err != nil {
+					continue
+				}
+				if _, ok := timings[name]; !ok {
+					timings[name] = millis / 1000
+				}
+			}
+		}
+	}
+	return timings
+}
+
+// splitQuoted splits s at each sep outside of a quoted string, such as the
+// description of a Server-Timing metric.
+func splitQuoted(s string, sep byte) []string {
+	parts := []string{}
+	quoted, start := false, 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
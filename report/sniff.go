@@ -0,0 +1,110 @@
+package report
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// bodySniff is the result of comparing a response body with its declared
+// Content-Type.
+type bodySniff struct {
+	Declared string // Media type from the Content-Type header, if any
+	Sniffed  string // Content type detected from the body itself
+	Binary   bool   // The body contains bytes that are unsafe to print to a terminal
+	Warning  string // Describes a mismatch between the declared and sniffed type
+}
+
+var textMediaTypes = []string{
+	"application/json",
+	"application/xml",
+	"application/javascript",
+	"application/x-www-form-urlencoded",
+	"application/x-ndjson",
+	"application/graphql",
+}
+
+var binaryMediaTypePrefixes = []string{
+	"image/",
+	"audio/",
+	"video/",
+	"font/",
+	"application/octet-stream",
+	"application/pdf",
+	"application/zip",
+	"application/gzip",
+	"application/x-protobuf",
+	"application/grpc",
+}
+
+func sniffBody(header http.Header, body string) *bodySniff {
+	s := &bodySniff{
+		Sniffed: http.DetectContentType([]byte(body)),
+		Binary:  !isPrintable(body),
+	}
+
+	contentType := header.Get("Content-Type")
+	if contentType == "" || body == "" {
+		return s
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		s.Warning = fmt.Sprintf("could not parse Content-Type %q: %v", contentType, err)
+		return s
+	}
+	s.Declared = mediaType
+
+	if isTextMediaType(mediaType) && s.Binary {
+		s.Warning = fmt.Sprintf("Content-Type is %s but the body looks like binary data (sniffed as %s)", mediaType, s.Sniffed)
+	} else if isBinaryMediaType(mediaType) && !s.Binary {
+		s.Warning = fmt.Sprintf("Content-Type is %s but the body looks like text (sniffed as %s)", mediaType, s.Sniffed)
+	}
+
+	return s
+}
+
+func isTextMediaType(mediaType string) bool {
+	if strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml") {
+		return true
+	}
+	for _, t := range textMediaTypes {
+		if mediaType == t {
+			return true
+		}
+	}
+	return false
+}
+
+func isBinaryMediaType(mediaType string) bool {
+	if strings.HasSuffix(mediaType, "+xml") {
+		// image/svg+xml and friends are text
+		return false
+	}
+	for _, prefix := range binaryMediaTypePrefixes {
+		if strings.HasPrefix(mediaType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPrintable reports whether body is valid UTF-8 without control characters
+// other than whitespace. A rune cut off at the end of a truncated body is
+// tolerated.
+func isPrintable(body string) bool {
+	for i := 0; i < len(body); {
+		r, size := utf8.DecodeRuneInString(body[i:])
+		if r == utf8.RuneError && size <= 1 {
+			return !utf8.FullRuneInString(body[i:])
+		}
+		if unicode.IsControl(r) && !unicode.IsSpace(r) {
+			return false
+		}
+		i += size
+	}
+	return true
+}
@@ -0,0 +1,36 @@
+package report
+
+import (
+	"fmt"
+
+	"github.com/berndhartzer/http-trace/trace"
+)
+
+// Stall is how steadily the response body arrived, in a Result, when reading
+// it was aborted after a stall. Durations are in seconds.
+type Stall struct {
+	Timeout    float64 `json:"timeout"`
+	Stalled    bool    `json:"stalled"`
+	LargestGap float64 `json:"largest_gap"`
+	BodyBytes  int64   `json:"body_bytes"`
+	LastByte   float64 `json:"last_byte,omitempty"`
+}
+
+// checkStall returns a warning if the server stalled mid-body, so reading it
+// was aborted, with the timeout in format.
+func checkStall(stall *trace.Stall, format TimeFormat) string {
+	if stall == nil || !stall.Stalled {
+		return ""
+	}
+	return fmt.Sprintf("the server stalled mid-body, no bytes arrived for %s after %d bytes of the body, so reading it was aborted", format.Duration(stall.Timeout), stall.BodyBytes)
+}
+
+func stallResult(stall *trace.Stall) *Stall {
+	return &Stall{
+		Timeout:    stall.Timeout.Seconds(),
+		Stalled:    stall.Stalled,
+		LargestGap: stall.LargestGap.Seconds(),
+		BodyBytes:  stall.BodyBytes,
+		LastByte:   stall.LastByte.Seconds(),
+	}
+}
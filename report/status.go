@@ -0,0 +1,79 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/berndhartzer/http-trace/trace"
+)
+
+// Status is a snapshot of the request in progress, in a Result. Durations are
+// in seconds and the throughput in bytes per second.
+type Status struct {
+	Elapsed      float64 `json:"elapsed"`
+	Phase        string  `json:"phase"`
+	PhaseElapsed float64 `json:"phase_elapsed"`
+	BodyBytes    int64   `json:"body_bytes"`
+	Throughput   float64 `json:"throughput"`
+}
+
+// FormatStatus describes a status of a request in progress on one line, such
+// as "10.0s response_read for 9.8s, 48203125 bytes read at 5.10 MiB/s".
+func FormatStatus(s trace.Status) string {
+	line := fmt.Sprintf("%6.1fs %s for %.1fs", s.Elapsed.Seconds(), s.Phase, s.PhaseElapsed.Seconds())
+	if s.BodyBytes > 0 || s.Phase == "response_read" {
+		line += fmt.Sprintf(", %d bytes read at %s", s.BodyBytes, formatThroughput(s.Throughput))
+	}
+	return line
+}
+
+// progressBarWidth is the most columns the bar of FormatProgress takes.
+const progressBarWidth = 40
+
+// FormatProgress describes how much of a response body has been read on one
+// line fitting in width columns, or any width if it is 0, such as
+// "[=========>          ]  45% 120.50 MiB of 267.00 MiB at 12.30 MiB/s". The
+// bar is left out when the size of the body isn't known.
+func FormatProgress(p trace.Progress, width int) string {
+	var throughput float64
+	if seconds := p.Elapsed.Seconds(); seconds > 0 {
+		throughput = float64(p.BodyBytes) / seconds
+	}
+	if p.BodyTotal <= 0 {
+		return fmt.Sprintf("%s at %s", formatBytes(float64(p.BodyBytes)), formatThroughput(throughput))
+	}
+
+	done := float64(p.BodyBytes) / float64(p.BodyTotal)
+	if done > 1 {
+		done = 1
+	}
+	line := fmt.Sprintf(" %3.0f%% %s of %s at %s", done*100, formatBytes(float64(p.BodyBytes)), formatBytes(float64(p.BodyTotal)), formatThroughput(throughput))
+	bar := progressBarWidth
+	if width > 0 && width-len(line)-2 < bar {
+		bar = width - len(line) - 2
+	}
+	if bar < 10 {
+		return strings.TrimLeft(line, " ")
+	}
+
+	filled := int(done * float64(bar))
+	arrow := ""
+	if filled < bar {
+		arrow = ">"
+	}
+	return "[" + strings.Repeat("=", filled) + arrow + strings.Repeat(" ", bar-filled-len(arrow)) + "]" + line
+}
+
+func statusResults(statuses []trace.Status) []Status {
+	results := []Status{}
+	for _, s := range statuses {
+		results = append(results, Status{
+			Elapsed:      s.Elapsed.Seconds(),
+			Phase:        s.Phase,
+			PhaseElapsed: s.PhaseElapsed.Seconds(),
+			BodyBytes:    s.BodyBytes,
+			Throughput:   s.Throughput,
+		})
+	}
+	return results
+}
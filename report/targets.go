@@ -0,0 +1,163 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/berndhartzer/http-trace/stats"
+)
+
+// Target holds the results of the requests sent to one of several URLs whose
+// timings are compared.
+type Target struct {
+	URL     string
+	Results []*Result
+}
+
+// WriteURLComparison writes the median duration of each phase for each
+// target side by side, with the URLs numbered to keep the columns narrow, and
+// which was fastest in total.
+func WriteURLComparison(w io.Writer, targets []*Target, pres *Presentation) error {
+	return writeComparison(w, fmt.Sprintf("Comparison of %d URLs (median)", len(targets)), targets, false, pres.timeFormat())
+}
+
+// WriteAddressComparison writes the comparison of WriteURLComparison for
+// targets which are the addresses of host, each given as its URL, followed by
+// which was slowest, as a slow server behind round-robin DNS.
+func WriteAddressComparison(w io.Writer, host string, targets []*Target, pres *Presentation) error {
+	return writeComparison(w, fmt.Sprintf("Comparison of %d addresses of %s (median)", len(targets), host), targets, true, pres.timeFormat())
+}
+
+// writeComparison writes the comparison of targets under title with the
+// durations in format, with the slowest in total as well as the fastest if
+// withSlowest is set.
+func writeComparison(w io.Writer, title string, targets []*Target, withSlowest bool, format TimeFormat) error {
+	width := format.Width()
+	out := &bytes.Buffer{}
+	fmt.Fprintln(out, title)
+	for i, t := range targets {
+		fmt.Fprintf(out, "  #%d %s\n", i+1, t.URL)
+	}
+
+	fmt.Fprintf(out, "  %-21s", "")
+	for i := range targets {
+		fmt.Fprintf(out, " %*s", width, fmt.Sprintf("#%d", i+1))
+	}
+	fmt.Fprintf(out, "\n  %-21s", "requests:")
+	for _, t := range targets {
+		fmt.Fprintf(out, " %*d", width, len(t.Results))
+	}
+	fmt.Fprintf(out, "\n  %-21s", "failed:")
+	for _, t := range targets {
+		fmt.Fprintf(out, " %*d", width, countFailures(t.Results))
+	}
+	fmt.Fprintln(out)
+	if hasWireSizes(targets...) {
+		// The bytes which crossed the network, rather than the decoded body
+		fmt.Fprintf(out, "  %-21s", "received:")
+		for _, t := range targets {
+			sizes := receivedSizes(t.Results)
+			if len(sizes) == 0 {
+				fmt.Fprintf(out, " %*s", width, "-")
+				continue
+			}
+			fmt.Fprintf(out, " %*s", width, formatBytes(stats.Median(sizes)))
+		}
+		fmt.Fprintln(out)
+	}
+	for _, p := range phases {
+		fmt.Fprintf(out, "  %-21s", p.Name+":")
+		for _, t := range targets {
+			values := successfulTimings(t.Results, p.Name)
+			if len(values) == 0 {
+				fmt.Fprintf(out, " %*s", width, "-")
+				continue
+			}
+			fmt.Fprintf(out, " %*s", width, format.seconds(stats.Median(values)))
+		}
+		fmt.Fprintln(out)
+	}
+
+	fastest, slowest := -1, -1
+	var fastestTotal, slowestTotal float64
+	for i, t := range targets {
+		totals := successfulTimings(t.Results, "total")
+		if len(totals) == 0 {
+			continue
+		}
+		median := stats.Median(totals)
+		if fastest < 0 || median < fastestTotal {
+			fastest, fastestTotal = i, median
+		}
+		if slowest < 0 || median > slowestTotal {
+			slowest, slowestTotal = i, median
+		}
+	}
+
+	fmt.Fprintln(out)
+	if fastest < 0 {
+		fmt.Fprintln(out, "No successful requests to compare")
+	} else {
+		fmt.Fprintf(out, "Fastest in total: #%d %s (%s)\n", fastest+1, targets[fastest].URL, format.seconds(fastestTotal))
+		if withSlowest && slowest != fastest && fastestTotal > 0 {
+			fmt.Fprintf(out, "Slowest in total: #%d %s (%s, %.1fx the fastest)\n", slowest+1, targets[slowest].URL, format.seconds(slowestTotal), slowestTotal/fastestTotal)
+		}
+	}
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// WriteURLSummary writes a line for each target with how many of its requests
+// failed, the status of the last response and the median durations of the
+// connection, response delay and total, followed by the slowest target. It
+// suits a longer list of URLs than WriteURLComparison.
+func WriteURLSummary(w io.Writer, targets []*Target, pres *Presentation) error {
+	format := pres.timeFormat()
+	width := format.Width()
+	out := &bytes.Buffer{}
+	millis := func(values []float64) string {
+		if len(values) == 0 {
+			return "-"
+		}
+		return format.seconds(stats.Median(values))
+	}
+
+	fmt.Fprintf(out, "Summary of %d URLs (median)\n", len(targets))
+	fmt.Fprintf(out, "  %4s %8s %6s %6s %*s %*s %*s  %s\n", "#", "requests", "failed", "status", width, "connection", width+4, "response_delay", width, "total", "url")
+
+	slowest := -1
+	var slowestTotal float64
+	for i, t := range targets {
+		status, method := "-", ""
+		for _, r := range t.Results {
+			method = r.Method
+			if r.Error == "" {
+				status = fmt.Sprintf("%d", r.Status)
+			}
+		}
+
+		totals := successfulTimings(t.Results, "total")
+		if len(totals) > 0 {
+			if median := stats.Median(totals); slowest < 0 || median > slowestTotal {
+				slowest, slowestTotal = i, median
+			}
+		}
+
+		fmt.Fprintf(out, "  %4d %8d %6d %6s %*s %*s %*s  %s\n", i+1, len(t.Results), countFailures(t.Results), status,
+			width, millis(successfulTimings(t.Results, "connection")), width+4, millis(successfulTimings(t.Results, "response_delay")), width, millis(totals),
+			strings.TrimSpace(method+" "+t.URL))
+	}
+
+	fmt.Fprintln(out)
+	if slowest < 0 {
+		fmt.Fprintln(out, "No successful requests")
+	} else {
+		fmt.Fprintf(out, "Slowest in total: #%d %s (%s)\n", slowest+1, targets[slowest].URL, format.seconds(slowestTotal))
+	}
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
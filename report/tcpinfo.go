@@ -0,0 +1,24 @@
+package report
+
+import "github.com/berndhartzer/http-trace/trace"
+
+// TCP is what the kernel measured of the TCP connection, in a Result, with
+// the round trip times in seconds.
+type TCP struct {
+	RTT              float64 `json:"rtt"`
+	RTTVar           float64 `json:"rtt_var"`
+	Retransmits      uint64  `json:"retransmits"`
+	CongestionWindow uint64  `json:"congestion_window"`
+}
+
+func tcpResult(info *trace.TCPInfo) *TCP {
+	if info == nil {
+		return nil
+	}
+	return &TCP{
+		RTT:              info.RTT.Seconds(),
+		RTTVar:           info.RTTVar.Seconds(),
+		Retransmits:      info.Retransmits,
+		CongestionWindow: info.CongestionWindow,
+	}
+}
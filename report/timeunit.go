@@ -0,0 +1,142 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Units durations can be shown in.
+const (
+	TimeUnitMicros  = "us"
+	TimeUnitMillis  = "ms"
+	TimeUnitSeconds = "s"
+)
+
+// DefaultTimePrecision is the number of decimals durations are shown with by
+// the zero TimeFormat.
+const DefaultTimePrecision = 2
+
+// maxTimePrecision is the most decimals durations can be shown with, finer
+// than the nanoseconds they are measured in for any of the units.
+const maxTimePrecision = 9
+
+// timeUnits are the symbols, the number of each unit in a second and the
+// digits before the decimal point of the durations usually shown in each
+// unit, up to a minute and a half in milliseconds, to align them in columns.
+var timeUnits = map[string]struct {
+	symbol    string
+	perSecond float64
+	digits    int
+}{
+	TimeUnitMicros:  {"µs", 1e6, 8},
+	TimeUnitMillis:  {"ms", 1e3, 5},
+	TimeUnitSeconds: {"s", 1, 3},
+}
+
+// TimeFormat is the unit and number of decimals durations are shown with,
+// such as microseconds for requests to a local server or seconds for long
+// batch runs. The zero TimeFormat shows milliseconds with
+// DefaultTimePrecision decimals.
+type TimeFormat struct {
+	Unit      string // One of the TimeUnit constants, the zero TimeFormat if empty
+	Precision int    // Number of decimals
+}
+
+// NewTimeFormat returns the TimeFormat for unit, one of the TimeUnit
+// constants, and precision decimals, or an error if either is invalid.
+func NewTimeFormat(unit string, precision int) (TimeFormat, error) {
+	if _, ok := timeUnits[unit]; !ok {
+		return TimeFormat{}, fmt.Errorf("invalid time unit %q, expected us, ms or s", unit)
+	}
+	if precision < 0 || precision > maxTimePrecision {
+		return TimeFormat{}, fmt.Errorf("invalid precision %d, expected 0 to %d decimals", precision, maxTimePrecision)
+	}
+	return TimeFormat{Unit: unit, Precision: precision}, nil
+}
+
+// resolve returns the unit and precision of f, filling in those of the zero
+// TimeFormat.
+func (f TimeFormat) resolve() (string, int) {
+	if f.Unit == "" {
+		return TimeUnitMillis, DefaultTimePrecision
+	}
+	return f.Unit, f.Precision
+}
+
+// Duration formats d, such as 12.35ms.
+func (f TimeFormat) Duration(d time.Duration) string {
+	return f.seconds(d.Seconds())
+}
+
+// seconds formats a duration in seconds as Duration does.
+func (f TimeFormat) seconds(seconds float64) string {
+	unit, precision := f.resolve()
+	return fmt.Sprintf("%.*f%s", precision, seconds*timeUnits[unit].perSecond, timeUnits[unit].symbol)
+}
+
+// signedSeconds formats a difference in seconds as Duration does, with its
+// sign.
+func (f TimeFormat) signedSeconds(seconds float64) string {
+	unit, precision := f.resolve()
+	return fmt.Sprintf("%+.*f%s", precision, seconds*timeUnits[unit].perSecond, timeUnits[unit].symbol)
+}
+
+// secondsRange formats an interval of differences in seconds, such as
+// [-1.20, +3.40]ms.
+func (f TimeFormat) secondsRange(lower, upper float64) string {
+	unit, precision := f.resolve()
+	bounds := []string{}
+	for _, seconds := range []float64{lower, upper} {
+		bounds = append(bounds, fmt.Sprintf("%+.*f", precision, seconds*timeUnits[unit].perSecond))
+	}
+	return "[" + strings.Join(bounds, ", ") + "]" + timeUnits[unit].symbol
+}
+
+// minTimeWidth is the narrowest column durations are aligned in, to fit
+// headings such as "connection".
+const minTimeWidth = 10
+
+// Width is the width of the columns durations are aligned in, 11 for the
+// zero TimeFormat.
+func (f TimeFormat) Width() int {
+	unit, precision := f.resolve()
+	width := 1 + timeUnits[unit].digits + len([]rune(timeUnits[unit].symbol))
+	if precision > 0 {
+		width += 1 + precision
+	}
+	if width < minTimeWidth {
+		return minTimeWidth
+	}
+	return width
+}
+
+// column right aligns s, such as a duration or its heading, in a column of
+// durations.
+func (f TimeFormat) column(s string) string {
+	return fmt.Sprintf("%*s", f.Width(), s)
+}
+
+// timeFormat returns the format durations are shown with, the zero
+// TimeFormat for a nil Presentation.
+func (p *Presentation) timeFormat() TimeFormat {
+	if p == nil {
+		return TimeFormat{}
+	}
+	return p.TimeFormat
+}
+
+// timeFuncs returns template functions which show durations of the text
+// report in format, aligned in columns.
+func timeFuncs(format TimeFormat) template.FuncMap {
+	return template.FuncMap{
+		"durationMillis": func(duration time.Duration) string {
+			return format.column(format.Duration(duration))
+		},
+		"signedMillis": func(duration time.Duration) string {
+			return format.column(format.signedSeconds(duration.Seconds()))
+		},
+		"column": format.column,
+	}
+}
@@ -0,0 +1,29 @@
+package report
+
+import (
+	"net/http"
+)
+
+// trailerTiming is the name of the time the trailers took after the body in
+// the timings of a Result, which is only there if trailers were received.
+const trailerTiming = "trailers"
+
+// receivedTrailers returns the trailers of resp which were received, leaving
+// out those announced in the Trailer header but not sent.
+func receivedTrailers(resp *http.Response) http.Header {
+	if resp == nil {
+		return nil
+	}
+
+	var trailers http.Header
+	for name, values := range resp.Trailer {
+		if len(values) == 0 {
+			continue
+		}
+		if trailers == nil {
+			trailers = http.Header{}
+		}
+		trailers[name] = values
+	}
+	return trailers
+}
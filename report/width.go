@@ -0,0 +1,79 @@
+package report
+
+import (
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+// minFitWidth is the fewest columns left for a header value or URL below
+// which it is left as it is rather than wrapped or shortened to fit.
+const minFitWidth = 20
+
+// widthFuncs returns template functions which fit header values and URLs of
+// the text report into width columns, by wrapping header values onto
+// continuation lines and shortening URLs in the middle. Nothing is changed
+// if width is 0.
+func widthFuncs(width int) template.FuncMap {
+	return template.FuncMap{
+		"fold": func(marker, name, value string) string {
+			return foldHeader(marker, name, value, width)
+		},
+		"requestLine": func(req *http.Request) string {
+			used := len("> ") + len(req.Method) + len(" ") + len(" ") + len(req.Proto)
+			target := req.URL.Host + req.URL.Path
+			if req.URL.RawQuery != "" {
+				target += "?" + req.URL.RawQuery
+			}
+			return req.Method + " " + fitURL(target, width-used) + " " + req.Proto
+		},
+		"fitURL": func(used int, u string) string {
+			return fitURL(u, width-used)
+		},
+	}
+}
+
+// foldHeader wraps the value of a header line, such as "< Name: value", so
+// the line fits in width columns. The continuation lines start with marker
+// and are indented to line up with the value.
+func foldHeader(marker, name, value string, width int) string {
+	prefix := len([]rune(marker)) + len(" ") + len([]rune(name)) + len(": ")
+	if width <= 0 || width-prefix < minFitWidth {
+		return value
+	}
+
+	lines := wrapText(value, width-prefix)
+	return strings.Join(lines, "\n"+marker+strings.Repeat(" ", prefix-len([]rune(marker))))
+}
+
+// wrapText splits s into lines of at most width runes, breaking after a space
+// or separator in the second half of a line if there is one.
+func wrapText(s string, width int) []string {
+	runes := []rune(s)
+	lines := []string{}
+	for len(runes) > width {
+		cut := width
+		for i := width; i > width/2; i-- {
+			if r := runes[i-1]; r == ' ' || r == ',' || r == ';' || r == '&' {
+				cut = i
+				break
+			}
+		}
+		lines = append(lines, strings.TrimRight(string(runes[:cut]), " "))
+		runes = []rune(strings.TrimLeft(string(runes[cut:]), " "))
+	}
+	return append(lines, string(runes))
+}
+
+// fitURL shortens u to width runes by replacing its middle with "...", which
+// keeps the host and the end of the path, as those tell URLs apart.
+func fitURL(u string, width int) string {
+	runes := []rune(u)
+	if width < minFitWidth || len(runes) <= width {
+		return u
+	}
+
+	tail := (width - len("...")) / 2
+	head := width - len("...") - tail
+	return string(runes[:head]) + "..." + string(runes[len(runes)-tail:])
+}
@@ -0,0 +1,56 @@
+package report
+
+import "github.com/berndhartzer/http-trace/trace"
+
+// Wire is how many bytes the request and response took on the wire, in a
+// Result, counting headers, framing and TLS records as well as the bodies.
+// Setup is the bytes of setting up a new connection, such as the TLS
+// handshake, and is 0 for a reused one. Sent and Received are split into the
+// bytes of the head and of the body, as trace.WireSizes describes.
+type Wire struct {
+	Sent         int64 `json:"sent"`
+	Received     int64 `json:"received"`
+	Setup        int64 `json:"setup,omitempty"`
+	RequestHead  int64 `json:"request_head,omitempty"`
+	RequestBody  int64 `json:"request_body,omitempty"`
+	ResponseHead int64 `json:"response_head,omitempty"`
+	ResponseBody int64 `json:"response_body,omitempty"`
+}
+
+func wireResult(sizes *trace.WireSizes) *Wire {
+	if sizes == nil {
+		return nil
+	}
+	return &Wire{
+		Sent:         sizes.Sent,
+		Received:     sizes.Received,
+		Setup:        sizes.Setup,
+		RequestHead:  sizes.RequestHead,
+		RequestBody:  sizes.RequestBody,
+		ResponseHead: sizes.ResponseHead,
+		ResponseBody: sizes.ResponseBody,
+	}
+}
+
+// receivedSizes returns the bytes received on the wire for each of results
+// which has them.
+func receivedSizes(results []*Result) []float64 {
+	sizes := []float64{}
+	for _, r := range results {
+		if r.Error == "" && r.Wire != nil {
+			sizes = append(sizes, float64(r.Wire.Received))
+		}
+	}
+	return sizes
+}
+
+// hasWireSizes reports whether any result of targets has its bytes on the
+// wire.
+func hasWireSizes(targets ...*Target) bool {
+	for _, t := range targets {
+		if len(receivedSizes(t.Results)) > 0 {
+			return true
+		}
+	}
+	return false
+}
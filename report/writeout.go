@@ -0,0 +1,156 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// writeOutVariables are the curl --write-out variables supported by WriteOut.
+// Times are in seconds from the start of the request, as curl reports them.
+var writeOutVariables = map[string]func(result *Result, header http.Header) string{
+	"content_type": func(result *Result, header http.Header) string {
+		return header.Get("Content-Type")
+	},
+	"errormsg": func(result *Result, header http.Header) string {
+		return result.Error
+	},
+	"http_code":     httpCode,
+	"response_code": httpCode,
+	"http_version": func(result *Result, header http.Header) string {
+		version := strings.TrimPrefix(result.Proto, "HTTP/")
+		if version == "2.0" {
+			return "2"
+		}
+		return version
+	},
+	"method": func(result *Result, header http.Header) string {
+		return result.Method
+	},
+	"size_download": func(result *Result, header http.Header) string {
+		return strconv.FormatInt(result.BodySize, 10)
+	},
+	"speed_download": func(result *Result, header http.Header) string {
+		total := result.Timings["total"]
+		if total == 0 {
+			return "0"
+		}
+		return strconv.FormatFloat(float64(result.BodySize)/total, 'f', 0, 64)
+	},
+	"time_namelookup": func(result *Result, header http.Header) string {
+		return writeOutTime(result.Timings["dns"])
+	},
+	"time_connect": func(result *Result, header http.Header) string {
+		return writeOutTime(result.Timings["dns"] + result.Timings["connect"])
+	},
+	"time_appconnect": func(result *Result, header http.Header) string {
+		if result.Timings["tls"] == 0 {
+			return writeOutTime(0)
+		}
+		return writeOutTime(result.Timings["dns"] + result.Timings["connect"] + result.Timings["tls"])
+	},
+	"time_pretransfer": func(result *Result, header http.Header) string {
+		return writeOutTime(result.Timings["connection"])
+	},
+	"time_redirect": func(result *Result, header http.Header) string {
+		return writeOutTime(0)
+	},
+	"time_starttransfer": func(result *Result, header http.Header) string {
+		return writeOutTime(result.Timings["connection"] + result.Timings["request_write"] + result.Timings["response_delay"])
+	},
+	"time_total": func(result *Result, header http.Header) string {
+		return writeOutTime(result.Timings["total"])
+	},
+	"url": func(result *Result, header http.Header) string {
+		return result.URL
+	},
+	"url_effective": func(result *Result, header http.Header) string {
+		return result.URL
+	},
+}
+
+func httpCode(result *Result, header http.Header) string {
+	return fmt.Sprintf("%03d", result.Status)
+}
+
+func writeOutTime(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', 6, 64)
+}
+
+// WriteOut is a parsed curl style --write-out format, such as
+// "%{http_code} %{time_total}\n".
+type WriteOut struct {
+	parts []writeOutPart
+}
+
+// writeOutPart is either literal text or a variable.
+type writeOutPart struct {
+	literal  string
+	variable string
+}
+
+// ParseWriteOut parses a curl --write-out format. Variables are written as
+// %{name}, %% is a literal percent sign and \n, \r and \t are interpreted.
+func ParseWriteOut(format string) (*WriteOut, error) {
+	format = strings.NewReplacer(`\n`, "\n", `\r`, "\r", `\t`, "\t", `\\`, `\`).Replace(format)
+
+	wo := &WriteOut{}
+	literal := &strings.Builder{}
+	for i := 0; i < len(format); i++ {
+		switch {
+		case strings.HasPrefix(format[i:], "%%"):
+			literal.WriteByte('%')
+			i++
+		case strings.HasPrefix(format[i:], "%{"):
+			end := strings.Index(format[i:], "}")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated variable in write-out format %q", format[i:])
+			}
+			name := format[i+2 : i+end]
+			if _, ok := writeOutVariables[name]; !ok {
+				return nil, fmt.Errorf("unknown write-out variable %q, expected one of %s", name, strings.Join(writeOutNames(), ", "))
+			}
+			if literal.Len() > 0 {
+				wo.parts = append(wo.parts, writeOutPart{literal: literal.String()})
+				literal.Reset()
+			}
+			wo.parts = append(wo.parts, writeOutPart{variable: name})
+			i += end
+		default:
+			literal.WriteByte(format[i])
+		}
+	}
+	if literal.Len() > 0 {
+		wo.parts = append(wo.parts, writeOutPart{literal: literal.String()})
+	}
+
+	return wo, nil
+}
+
+func writeOutNames() []string {
+	names := []string{}
+	for name := range writeOutVariables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Write writes the format for a result. header is the full set of response
+// headers, which may have been left out of result.
+func (wo *WriteOut) Write(w io.Writer, result *Result, header http.Header) error {
+	b := &strings.Builder{}
+	for _, part := range wo.parts {
+		if part.variable == "" {
+			b.WriteString(part.literal)
+			continue
+		}
+		b.WriteString(writeOutVariables[part.variable](result, header))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
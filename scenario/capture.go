@@ -0,0 +1,85 @@
+package scenario
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/berndhartzer/http-trace/jsonpath"
+)
+
+// Capture saves a value of the response of a step as a variable, which the
+// steps after it use as ${name} in their urls, headers and bodies.
+type Capture struct {
+	Name   string
+	Source string // A JSONPath of the body such as $.token, header.Name or cookie.Name
+}
+
+// variableName matches the name of a captured variable.
+var variableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// variableReference matches a ${name} reference to a variable.
+var variableReference = regexp.MustCompile(`\${([A-Za-z_][A-Za-z0-9_]*)}`)
+
+// checkSource checks a capture source is one Extract understands.
+func checkSource(source string) error {
+	switch {
+	case strings.HasPrefix(source, "$"):
+		_, err := jsonpath.Parse(source)
+		return err
+	case strings.HasPrefix(source, "header.") && len(source) > len("header."):
+		return nil
+	case strings.HasPrefix(source, "cookie.") && len(source) > len("cookie."):
+		return nil
+	}
+	return fmt.Errorf("invalid capture %q, expected a JSONPath of the body such as $.token, header.Name or cookie.Name", source)
+}
+
+// Extract returns the value of the capture from a response and its body.
+// Strings are captured without their quotes, and objects and arrays as JSON.
+func (c Capture) Extract(resp *http.Response, body []byte) (string, error) {
+	switch {
+	case strings.HasPrefix(c.Source, "header."):
+		name := strings.TrimPrefix(c.Source, "header.")
+		if _, ok := resp.Header[http.CanonicalHeaderKey(name)]; !ok {
+			return "", fmt.Errorf("error capturing %s: no %s header in the response", c.Name, name)
+		}
+		return resp.Header.Get(name), nil
+	case strings.HasPrefix(c.Source, "cookie."):
+		name := strings.TrimPrefix(c.Source, "cookie.")
+		for _, cookie := range resp.Cookies() {
+			if cookie.Name == name {
+				return cookie.Value, nil
+			}
+		}
+		return "", fmt.Errorf("error capturing %s: no %s cookie set by the response", c.Name, name)
+	}
+
+	path, err := jsonpath.Parse(c.Source)
+	if err != nil {
+		return "", err
+	}
+	doc, err := jsonpath.Decode(body)
+	if err != nil {
+		return "", fmt.Errorf("error capturing %s from %s: %w", c.Name, c.Source, err)
+	}
+	value, err := path.Lookup(doc)
+	if err != nil {
+		return "", fmt.Errorf("error capturing %s from %s: %w", c.Name, c.Source, err)
+	}
+	return jsonpath.Format(value), nil
+}
+
+// Expand replaces the ${name} references to the variables in s with their
+// values, leaving references to other names, such as environment variables,
+// as they are.
+func Expand(s string, variables map[string]string) string {
+	return variableReference.ReplaceAllStringFunc(s, func(ref string) string {
+		value, ok := variables[variableReference.FindStringSubmatch(ref)[1]]
+		if !ok {
+			return ref
+		}
+		return value
+	})
+}
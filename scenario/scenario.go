@@ -0,0 +1,258 @@
+// Package scenario reads scenario files: ordered steps of requests, such as
+// logging in, calling an API and logging out, to be traced one after another.
+//
+// A scenario file is written in a subset of YAML:
+//
+//	name: checkout
+//	base_url: https://api.example.com
+//	headers:
+//	  Accept: application/json
+//	steps:
+//	  - name: login
+//	    method: POST
+//	    url: /login
+//	    headers:
+//	      Content-Type: application/json
+//	    body: '{"user": "jane", "password": "${PASSWORD}"}'
+//	    capture:
+//	      token: $.access_token
+//	  - name: profile
+//	    url: /me
+//	    headers:
+//	      Authorization: Bearer ${token}
+//	  - name: logout
+//	    method: POST
+//	    url: /logout
+//
+// The headers of the scenario are sent with every step, and those of a step
+// replace them. A step's url is resolved against the base_url, if there is
+// one. The values a step captures from its response, from the JSON body, a
+// header or a cookie, are used as ${name} by the steps after it.
+package scenario
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Scenario is the steps of a scenario, in order.
+type Scenario struct {
+	Name  string
+	Steps []Step
+}
+
+// Step is a request of a scenario.
+type Step struct {
+	Name     string   // Defaults to the method and path of the request
+	Method   string   // Defaults to GET
+	URL      string   // Absolute, once resolved against the base URL
+	Headers  []string // "Name: value", those of the scenario followed by those of the step
+	Body     string
+	Captures []Capture // From the response, in the order they were given
+}
+
+var (
+	scenarioKeys = []string{"name", "base_url", "headers", "steps"}
+	stepKeys     = []string{"name", "method", "url", "headers", "body", "capture"}
+)
+
+// Load reads the scenario file at path.
+func Load(path string) (*Scenario, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading scenario file: %w", err)
+	}
+	return Parse(string(raw))
+}
+
+// Parse parses a scenario file.
+func Parse(raw string) (*Scenario, error) {
+	root, err := parseYAML(raw)
+	if err != nil {
+		return nil, err
+	}
+	if root.fields == nil {
+		return nil, fmt.Errorf("error in scenario file line %d: expected a mapping with the steps", root.line)
+	}
+	err = checkKeys(root, scenarioKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Scenario{}
+	s.Name, err = stringField(root, "name")
+	if err != nil {
+		return nil, err
+	}
+	baseURL, err := stringField(root, "base_url")
+	if err != nil {
+		return nil, err
+	}
+	var base *url.URL
+	if baseURL != "" {
+		base, err = url.Parse(baseURL)
+		if err != nil || base.Scheme == "" || base.Host == "" {
+			return nil, fmt.Errorf("error in scenario file line %d: invalid base_url %q, expected a URL such as https://example.com", root.fields["base_url"].line, baseURL)
+		}
+	}
+	headers, err := headerField(root)
+	if err != nil {
+		return nil, err
+	}
+
+	steps, ok := root.fields["steps"]
+	if !ok || len(steps.items) == 0 {
+		return nil, fmt.Errorf("error in scenario file: no steps")
+	}
+	if !steps.sequence {
+		return nil, fmt.Errorf("error in scenario file line %d: expected a sequence of steps", steps.line)
+	}
+	for _, item := range steps.items {
+		step, err := parseStep(item, base, headers)
+		if err != nil {
+			return nil, err
+		}
+		s.Steps = append(s.Steps, step)
+	}
+	return s, nil
+}
+
+func parseStep(n *node, base *url.URL, headers []string) (Step, error) {
+	if n.fields == nil {
+		return Step{}, fmt.Errorf("error in scenario file line %d: expected a step with a url", n.line)
+	}
+	err := checkKeys(n, stepKeys)
+	if err != nil {
+		return Step{}, err
+	}
+
+	step := Step{}
+	for key, value := range map[string]*string{"name": &step.Name, "method": &step.Method, "url": &step.URL, "body": &step.Body} {
+		*value, err = stringField(n, key)
+		if err != nil {
+			return Step{}, err
+		}
+	}
+	if step.Method == "" {
+		step.Method = http.MethodGet
+	}
+	step.Method = strings.ToUpper(step.Method)
+
+	if step.URL == "" {
+		return Step{}, fmt.Errorf("error in scenario file line %d: step has no url", n.line)
+	}
+	u, err := url.Parse(step.URL)
+	if err != nil {
+		return Step{}, fmt.Errorf("error in scenario file line %d: invalid url %q: %v", n.fields["url"].line, step.URL, err)
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+		step.URL = unescapeReferences(u.String())
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return Step{}, fmt.Errorf("error in scenario file line %d: url %q is not absolute, and there is no base_url", n.fields["url"].line, step.URL)
+	}
+	if step.Name == "" {
+		step.Name = step.Method + " " + unescapeReferences(u.EscapedPath())
+	}
+
+	own, err := headerField(n)
+	if err != nil {
+		return Step{}, err
+	}
+	step.Headers = append(append([]string{}, headers...), own...)
+
+	step.Captures, err = captureField(n)
+	if err != nil {
+		return Step{}, err
+	}
+	return step, nil
+}
+
+// captureField returns the capture mapping of the variables of a step to
+// their sources.
+func captureField(n *node) ([]Capture, error) {
+	value, ok := n.fields["capture"]
+	if !ok || (value.scalar != nil && *value.scalar == "") {
+		return nil, nil
+	}
+	if value.fields == nil {
+		return nil, fmt.Errorf("error in scenario file line %d: expected capture to be a mapping of variable names to what to capture", value.line)
+	}
+	captures := []Capture{}
+	for _, name := range value.keys {
+		if !variableName.MatchString(name) {
+			return nil, fmt.Errorf("error in scenario file line %d: invalid variable name %q, expected letters, digits and underscores", value.fields[name].line, name)
+		}
+		source, err := stringField(value, name)
+		if err != nil {
+			return nil, err
+		}
+		err = checkSource(source)
+		if err != nil {
+			return nil, fmt.Errorf("error in scenario file line %d: %w", value.fields[name].line, err)
+		}
+		captures = append(captures, Capture{Name: name, Source: source})
+	}
+	return captures, nil
+}
+
+// escapedReference matches a ${name} reference escaped in the path of a URL.
+var escapedReference = regexp.MustCompile(`\$%7B([A-Za-z_][A-Za-z0-9_]*)%7D`)
+
+// unescapeReferences restores the ${name} references in a URL which were
+// escaped when it was resolved, so they can be expanded.
+func unescapeReferences(s string) string {
+	return escapedReference.ReplaceAllString(s, "$${$1}")
+}
+
+// checkKeys fails on a key of n which isn't one of keys, such as a typo.
+func checkKeys(n *node, keys []string) error {
+	for _, key := range n.keys {
+		known := false
+		for _, k := range keys {
+			known = known || key == k
+		}
+		if !known {
+			return fmt.Errorf("error in scenario file line %d: unknown key %q, expected one of %s", n.fields[key].line, key, strings.Join(keys, ", "))
+		}
+	}
+	return nil
+}
+
+// stringField returns the string value of key in n, or "" if it isn't set.
+func stringField(n *node, key string) (string, error) {
+	value, ok := n.fields[key]
+	if !ok {
+		return "", nil
+	}
+	if value.scalar == nil {
+		return "", fmt.Errorf("error in scenario file line %d: expected %s to be a string", value.line, key)
+	}
+	return *value.scalar, nil
+}
+
+// headerField returns the headers mapping of n as "Name: value" headers, in
+// the order they were given.
+func headerField(n *node) ([]string, error) {
+	value, ok := n.fields["headers"]
+	if !ok || (value.scalar != nil && *value.scalar == "") {
+		return nil, nil
+	}
+	if value.fields == nil {
+		return nil, fmt.Errorf("error in scenario file line %d: expected headers to be a mapping of names to values", value.line)
+	}
+	headers := []string{}
+	for _, name := range value.keys {
+		v, err := stringField(value, name)
+		if err != nil {
+			return nil, err
+		}
+		headers = append(headers, name+": "+v)
+	}
+	return headers, nil
+}
@@ -0,0 +1,313 @@
+package scenario
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testParse struct {
+	raw           string
+	expected      *Scenario
+	expectedError string
+}
+
+func TestParse(t *testing.T) {
+	tests := map[string]testParse{
+		"will parse the steps of a scenario": {
+			raw: `# Log in, look at the profile and log out
+name: checkout
+base_url: https://api.example.com/v1/
+headers:
+  Accept: application/json
+steps:
+  - name: login
+    method: post
+    url: login
+    headers:
+      Content-Type: application/json # as the body is JSON
+    body: '{"user": "jane", "password": "${PASSWORD}"}'
+  - url: /me
+  - name: logout
+    method: POST
+    url: https://auth.example.com/logout
+    headers:
+      Accept: text/plain
+`,
+			expected: &Scenario{
+				Name: "checkout",
+				Steps: []Step{
+					{
+						Name:    "login",
+						Method:  "POST",
+						URL:     "https://api.example.com/v1/login",
+						Headers: []string{"Accept: application/json", "Content-Type: application/json"},
+						Body:    `{"user": "jane", "password": "${PASSWORD}"}`,
+					},
+					{
+						Name:    "GET /me",
+						Method:  "GET",
+						URL:     "https://api.example.com/me",
+						Headers: []string{"Accept: application/json"},
+					},
+					{
+						Name:    "logout",
+						Method:  "POST",
+						URL:     "https://auth.example.com/logout",
+						Headers: []string{"Accept: application/json", "Accept: text/plain"},
+					},
+				},
+			},
+		},
+		"will parse a sequence indented as far as its key": {
+			raw: `steps:
+- url: https://example.com/a
+- url: https://example.com/b
+name: flat
+`,
+			expected: &Scenario{
+				Name: "flat",
+				Steps: []Step{
+					{Name: "GET /a", Method: "GET", URL: "https://example.com/a", Headers: []string{}},
+					{Name: "GET /b", Method: "GET", URL: "https://example.com/b", Headers: []string{}},
+				},
+			},
+		},
+		"will parse quoted values and block bodies": {
+			raw: `steps:
+  -
+    name: "create \"thing\""
+    method: PUT
+    url: 'https://example.com/it''s'
+    body: |
+      {
+        "name": "thing" # not a comment
+      }
+
+    headers:
+  - url: https://example.com/plain
+    body: |-
+      a=1&b=2
+    name: {"flow": "kept as is"}
+`,
+			expected: &Scenario{
+				Steps: []Step{
+					{
+						Name:    `create "thing"`,
+						Method:  "PUT",
+						URL:     "https://example.com/it's",
+						Headers: []string{},
+						Body:    "{\n  \"name\": \"thing\" # not a comment\n}\n",
+					},
+					{
+						Name:    `{"flow": "kept as is"}`,
+						Method:  "GET",
+						URL:     "https://example.com/plain",
+						Headers: []string{},
+						Body:    "a=1&b=2",
+					},
+				},
+			},
+		},
+		"will parse captures and keep references in urls": {
+			raw: `base_url: https://api.example.com
+steps:
+  - method: POST
+    url: /login
+    capture:
+      token: $.access_token
+      request_id: header.X-Request-Id
+      session: cookie.session
+  - url: /items/${item}?from=${token}
+`,
+			expected: &Scenario{
+				Steps: []Step{
+					{
+						Name:    "POST /login",
+						Method:  "POST",
+						URL:     "https://api.example.com/login",
+						Headers: []string{},
+						Captures: []Capture{
+							{Name: "token", Source: "$.access_token"},
+							{Name: "request_id", Source: "header.X-Request-Id"},
+							{Name: "session", Source: "cookie.session"},
+						},
+					},
+					{Name: "GET /items/${item}", Method: "GET", URL: "https://api.example.com/items/${item}?from=${token}", Headers: []string{}},
+				},
+			},
+		},
+		"will fail on an invalid capture": {
+			raw:           "steps:\n  - url: https://example.com\n    capture:\n      token: body.token\n",
+			expectedError: `line 4: invalid capture "body.token"`,
+		},
+		"will fail on an invalid variable name": {
+			raw:           "steps:\n  - url: https://example.com\n    capture:\n      my-token: $.token\n",
+			expectedError: `line 4: invalid variable name "my-token"`,
+		},
+		"will fail without steps": {
+			raw:           "name: nothing\n",
+			expectedError: "no steps",
+		},
+		"will fail on an unknown key": {
+			raw:           "steps:\n  - url: https://example.com\n    boddy: typo\n",
+			expectedError: `line 3: unknown key "boddy", expected one of name, method, url, headers, body, capture`,
+		},
+		"will fail on a step without a url": {
+			raw:           "steps:\n  - name: lost\n",
+			expectedError: "line 2: step has no url",
+		},
+		"will fail on a relative url without a base url": {
+			raw:           "steps:\n  - url: /login\n",
+			expectedError: `line 2: url "/login" is not absolute, and there is no base_url`,
+		},
+		"will fail on headers which are not a mapping": {
+			raw:           "headers: Accept\nsteps:\n  - url: https://example.com\n",
+			expectedError: "line 1: expected headers to be a mapping",
+		},
+		"will fail on bad indentation": {
+			raw:           "steps:\n  - url: https://example.com\n      method: GET\n",
+			expectedError: "line 3: unexpected indentation",
+		},
+		"will fail on tabs": {
+			raw:           "steps:\n\t- url: https://example.com\n",
+			expectedError: "line 2: tabs can not be used for indentation",
+		},
+		"will fail on an unterminated string": {
+			raw:           "steps:\n  - url: 'https://example.com\n",
+			expectedError: "line 2: unterminated quoted string",
+		},
+		"will fail on unsupported YAML": {
+			raw:           "steps:\n  - url: https://example.com\n    body: >\n      folded\n",
+			expectedError: "line 3: folded scalars, anchors, aliases and tags are not supported",
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			s, err := Parse(cfg.raw)
+			if cfg.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), cfg.expectedError) {
+					t.Fatalf("Unexpected error: got %v, want it to contain %q", err, cfg.expectedError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Error parsing scenario: %v", err)
+			}
+			if !reflect.DeepEqual(s, cfg.expected) {
+				t.Errorf("Unexpected scenario: got\n%+v\nwant\n%+v", s, cfg.expected)
+			}
+		})
+	}
+}
+
+type testCapture struct {
+	source        string
+	header        http.Header
+	body          string
+	expected      string
+	expectedError string
+}
+
+func TestCapture(t *testing.T) {
+	body := `{"token": "abc", "user": {"id": 42, "admin": false, "roles": ["read", "write"]}, "next.page": null, "items": [{"id": "first"}, {"id": "second"}]}`
+	header := http.Header{
+		"X-Request-Id": {"req-1"},
+		"Set-Cookie":   {"session=s3cr3t; Path=/; HttpOnly", "theme=dark"},
+	}
+
+	tests := map[string]testCapture{
+		"will capture a string without its quotes": {
+			source:   "$.token",
+			expected: "abc",
+		},
+		"will capture a nested number": {
+			source:   "$.user.id",
+			expected: "42",
+		},
+		"will capture a boolean": {
+			source:   "$.user.admin",
+			expected: "false",
+		},
+		"will capture an array item": {
+			source:   "$.items[1].id",
+			expected: "second",
+		},
+		"will capture a quoted member name": {
+			source:   "$['next.page']",
+			expected: "null",
+		},
+		"will capture an array as JSON": {
+			source:   `$["user"].roles`,
+			expected: `["read","write"]`,
+		},
+		"will capture a header": {
+			source:   "header.x-request-id",
+			expected: "req-1",
+		},
+		"will capture a cookie": {
+			source:   "cookie.session",
+			expected: "s3cr3t",
+		},
+		"will fail on a missing member": {
+			source:        "$.user.name",
+			expectedError: `$.user has no member "name"`,
+		},
+		"will fail on an index out of range": {
+			source:        "$.items[2]",
+			expectedError: "$.items has 2 items, not 3",
+		},
+		"will fail on indexing an object": {
+			source:        "$.user[0]",
+			expectedError: "$.user is not an array",
+		},
+		"will fail on a body which isn't JSON": {
+			source:        "$.token",
+			body:          "<html>",
+			expectedError: "body is not JSON",
+		},
+		"will fail on a missing header": {
+			source:        "header.Location",
+			expectedError: "no Location header in the response",
+		},
+		"will fail on a missing cookie": {
+			source:        "cookie.id",
+			expectedError: "no id cookie set by the response",
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			if cfg.body == "" {
+				cfg.body = body
+			}
+			resp := &http.Response{Header: header}
+			value, err := Capture{Name: "v", Source: cfg.source}.Extract(resp, []byte(cfg.body))
+			if cfg.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), cfg.expectedError) {
+					t.Fatalf("Unexpected error: got %v, want it to contain %q", err, cfg.expectedError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Error capturing %s: %v", cfg.source, err)
+			}
+			if value != cfg.expected {
+				t.Errorf("Unexpected value: got %q, want %q", value, cfg.expected)
+			}
+		})
+	}
+}
+
+func TestExpand(t *testing.T) {
+	variables := map[string]string{"token": "abc", "id": "42"}
+	got := Expand("/items/${id}?token=${token}&home=${HOME}&id=${id}", variables)
+	expected := "/items/42?token=abc&home=${HOME}&id=42"
+	if got != expected {
+		t.Errorf("Unexpected expansion: got %q, want %q", got, expected)
+	}
+}
@@ -0,0 +1,306 @@
+package scenario
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// node is a value of the YAML subset scenario files are written in: a
+// scalar, a mapping of keys in the order they were given, or a sequence.
+type node struct {
+	line     int
+	scalar   *string
+	keys     []string
+	fields   map[string]*node
+	items    []*node
+	sequence bool
+}
+
+// yamlLine is a line of a file, without its indentation.
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+// parseYAML parses the block style subset of YAML scenarios are written in:
+// mappings of "key: value", sequences of "- " items, comments, quoted and
+// plain scalars, and literal "|" block scalars for bodies spanning several
+// lines. Flow collections such as {"a": 1} are read as plain strings, which
+// suits JSON bodies, and anchors, tags and folded scalars are not supported.
+func parseYAML(raw string) (*node, error) {
+	p := &yamlParser{}
+	for i, text := range strings.Split(strings.Replace(raw, "\r\n", "\n", -1), "\n") {
+		trimmed := strings.TrimLeft(text, " ")
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, p.errorf(i+1, "tabs can not be used for indentation")
+		}
+		p.lines = append(p.lines, yamlLine{number: i + 1, indent: len(text) - len(trimmed), text: strings.TrimRight(trimmed, " \t")})
+	}
+
+	p.skipBlank()
+	if p.done() {
+		return &node{line: 1, fields: map[string]*node{}}, nil
+	}
+	n, err := p.block(p.peek().indent)
+	if err != nil {
+		return nil, err
+	}
+	p.skipBlank()
+	if !p.done() {
+		return nil, p.errorf(p.peek().number, "unexpected indentation")
+	}
+	return n, nil
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	next  int
+}
+
+func (p *yamlParser) done() bool {
+	return p.next >= len(p.lines)
+}
+
+func (p *yamlParser) peek() yamlLine {
+	return p.lines[p.next]
+}
+
+func (p *yamlParser) errorf(line int, format string, args ...interface{}) error {
+	return fmt.Errorf("error in scenario file line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+// skipBlank skips blank lines and comments.
+func (p *yamlParser) skipBlank() {
+	for !p.done() {
+		text := p.peek().text
+		if text != "" && !strings.HasPrefix(text, "#") {
+			return
+		}
+		p.next++
+	}
+}
+
+// block parses the mapping or sequence whose lines are at indent.
+func (p *yamlParser) block(indent int) (*node, error) {
+	if isSequenceItem(p.peek().text) {
+		return p.sequence(indent)
+	}
+	return p.mapping(indent)
+}
+
+func isSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func (p *yamlParser) mapping(indent int) (*node, error) {
+	n := &node{line: p.peek().number, fields: map[string]*node{}}
+	for {
+		p.skipBlank()
+		if p.done() || p.peek().indent < indent {
+			return n, nil
+		}
+		line := p.peek()
+		if line.indent > indent {
+			return nil, p.errorf(line.number, "unexpected indentation")
+		}
+		if isSequenceItem(line.text) {
+			return nil, p.errorf(line.number, "expected a key, not a sequence item")
+		}
+
+		key, rest, err := p.splitKey(line)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := n.fields[key]; ok {
+			return nil, p.errorf(line.number, "duplicate key %q", key)
+		}
+		p.next++
+
+		value, err := p.value(line, indent, rest)
+		if err != nil {
+			return nil, err
+		}
+		n.keys = append(n.keys, key)
+		n.fields[key] = value
+	}
+}
+
+// splitKey splits a "key: value" line.
+func (p *yamlParser) splitKey(line yamlLine) (string, string, error) {
+	i := strings.Index(line.text+" ", ": ")
+	if i <= 0 {
+		return "", "", p.errorf(line.number, "expected 'key: value'")
+	}
+	key := strings.TrimSpace(line.text[:i])
+	if unquoted, ok, err := unquote(key); ok {
+		if err != nil {
+			return "", "", p.errorf(line.number, "%v", err)
+		}
+		key = unquoted
+	}
+	return key, strings.TrimSpace(line.text[i+1:]), nil
+}
+
+// value parses the value of a key on line, which is rest if it is on the same
+// line, and otherwise a block indented below it.
+func (p *yamlParser) value(line yamlLine, indent int, rest string) (*node, error) {
+	rest = stripComment(rest)
+	switch {
+	case rest == "|" || rest == "|-":
+		return p.literal(line, indent, rest == "|-")
+	case strings.HasPrefix(rest, ">") || strings.HasPrefix(rest, "&") || strings.HasPrefix(rest, "*") || strings.HasPrefix(rest, "!"):
+		return nil, p.errorf(line.number, "folded scalars, anchors, aliases and tags are not supported")
+	case rest != "":
+		s, err := scalar(rest)
+		if err != nil {
+			return nil, p.errorf(line.number, "%v", err)
+		}
+		return &node{line: line.number, scalar: &s}, nil
+	}
+
+	p.skipBlank()
+	if p.done() || p.peek().indent < indent || (p.peek().indent == indent && !isSequenceItem(p.peek().text)) {
+		empty := ""
+		return &node{line: line.number, scalar: &empty}, nil
+	}
+	// A sequence may be indented as far as its key
+	return p.block(p.peek().indent)
+}
+
+func (p *yamlParser) sequence(indent int) (*node, error) {
+	n := &node{line: p.peek().number, sequence: true}
+	for {
+		p.skipBlank()
+		if p.done() || p.peek().indent < indent {
+			return n, nil
+		}
+		line := p.peek()
+		if line.indent > indent || !isSequenceItem(line.text) {
+			if line.indent == indent {
+				// The end of a sequence indented as far as its key
+				return n, nil
+			}
+			return nil, p.errorf(line.number, "unexpected indentation")
+		}
+
+		// The item is read as if the dash were a space, so a mapping starting
+		// on its line continues at the indentation of its first key
+		content := strings.TrimLeft(line.text[1:], " ")
+		if content == "" {
+			p.next++
+			p.skipBlank()
+			if p.done() || p.peek().indent <= indent {
+				return nil, p.errorf(line.number, "empty sequence item")
+			}
+			item, err := p.block(p.peek().indent)
+			if err != nil {
+				return nil, err
+			}
+			n.items = append(n.items, item)
+			continue
+		}
+
+		itemIndent := indent + len(line.text) - len(content)
+		if !strings.Contains(content+" ", ": ") || strings.HasPrefix(content, "\"") || strings.HasPrefix(content, "'") {
+			p.next++
+			s, err := scalar(stripComment(content))
+			if err != nil {
+				return nil, p.errorf(line.number, "%v", err)
+			}
+			n.items = append(n.items, &node{line: line.number, scalar: &s})
+			continue
+		}
+		p.lines[p.next] = yamlLine{number: line.number, indent: itemIndent, text: content}
+		item, err := p.mapping(itemIndent)
+		if err != nil {
+			return nil, err
+		}
+		n.items = append(n.items, item)
+	}
+}
+
+// literal parses a "|" block scalar, keeping the lines indented below line as
+// they are apart from their indentation, and the final newline unless strip.
+func (p *yamlParser) literal(line yamlLine, indent int, strip bool) (*node, error) {
+	blockIndent := -1
+	text := []string{}
+	for !p.done() {
+		next := p.peek()
+		if next.text == "" {
+			text = append(text, "")
+			p.next++
+			continue
+		}
+		if next.indent <= indent {
+			break
+		}
+		if blockIndent < 0 {
+			blockIndent = next.indent
+		}
+		if next.indent < blockIndent {
+			return nil, p.errorf(next.number, "less indented than the first line of the block")
+		}
+		text = append(text, strings.Repeat(" ", next.indent-blockIndent)+next.text)
+		p.next++
+	}
+
+	// Trailing blank lines belong to whatever follows
+	for len(text) > 0 && text[len(text)-1] == "" {
+		text = text[:len(text)-1]
+	}
+	s := strings.Join(text, "\n")
+	if !strip && s != "" {
+		s += "\n"
+	}
+	return &node{line: line.number, scalar: &s}, nil
+}
+
+// scalar returns the string value of a plain or quoted scalar.
+func scalar(s string) (string, error) {
+	if unquoted, ok, err := unquote(s); ok {
+		return unquoted, err
+	}
+	return s, nil
+}
+
+// unquote returns the value of a single or double quoted string, and whether
+// s is quoted.
+func unquote(s string) (string, bool, error) {
+	switch {
+	case len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'':
+		return strings.Replace(s[1:len(s)-1], "''", "'", -1), true, nil
+	case len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"':
+		unquoted, err := strconv.Unquote(s)
+		if err != nil {
+			return "", true, fmt.Errorf("invalid double quoted string %s", s)
+		}
+		return unquoted, true, nil
+	case strings.HasPrefix(s, "'") || strings.HasPrefix(s, "\""):
+		return "", true, fmt.Errorf("unterminated quoted string %s", s)
+	}
+	return "", false, nil
+}
+
+// stripComment removes a " #" comment following a plain value. Quoted values
+// are left alone, as they may contain " #".
+func stripComment(s string) string {
+	if strings.HasPrefix(s, "'") || strings.HasPrefix(s, "\"") {
+		quote := s[:1]
+		if end := strings.LastIndex(s, quote); end > 0 {
+			rest := strings.TrimSpace(s[end+1:])
+			if rest == "" || strings.HasPrefix(rest, "#") {
+				return s[:end+1]
+			}
+		}
+		return s
+	}
+	if strings.HasPrefix(s, "#") {
+		return ""
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		return strings.TrimSpace(s[:i])
+	}
+	return s
+}
@@ -0,0 +1,180 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronMacros are the shorthands for common cron expressions.
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronField is the range of one of the fields of a cron expression, with the
+// names its values may be given by.
+type cronField struct {
+	name     string
+	min, max int
+	names    []string // For the values from min on
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// cronSearchLimit is how far ahead Next looks for a matching time, beyond
+// which the expression is taken to never match, such as for February 30.
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+// Cron is a schedule given by a standard five field cron expression: minute,
+// hour, day of month, month and day of week, in local time.
+type Cron struct {
+	expr                         string
+	minutes, hours, days, months [64]bool
+	weekdays                     [8]bool
+	anyDay, anyWeekday           bool
+}
+
+// ParseCron parses a cron expression such as "*/5 * * * *". Each field is *,
+// a value, a range such as 1-5, any of them with a step such as */15 or 0-30/10,
+// or a list of them separated by commas. Months and days of the week can be
+// given by their names, such as jan or mon, and Sunday is either 0 or 7. The
+// macros @hourly, @daily, @weekly, @monthly and @yearly are also accepted.
+func ParseCron(expr string) (*Cron, error) {
+	fields := strings.Fields(expr)
+	if macro, ok := cronMacros[strings.ToLower(strings.TrimSpace(expr))]; ok {
+		fields = strings.Fields(macro)
+	}
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("invalid cron expression %q, expected 5 fields: minute, hour, day of month, month and day of week", expr)
+	}
+
+	c := &Cron{expr: expr}
+	sets := [][]bool{c.minutes[:], c.hours[:], c.days[:], c.months[:], c.weekdays[:]}
+	for i, field := range fields {
+		err := parseCronField(field, cronFields[i], sets[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+		}
+	}
+	c.weekdays[0] = c.weekdays[0] || c.weekdays[7]
+	c.anyDay = strings.HasPrefix(fields[2], "*")
+	c.anyWeekday = strings.HasPrefix(fields[4], "*")
+	return c, nil
+}
+
+// parseCronField sets the values field matches in set.
+func parseCronField(field string, f cronField, set []bool) error {
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return fmt.Errorf("invalid step %q in the %s field", part[i+1:], f.name)
+			}
+			part = part[:i]
+		}
+
+		low, high := f.min, f.max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			i := strings.IndexByte(part, '-')
+			var err error
+			low, err = cronValue(part[:i], f)
+			if err != nil {
+				return err
+			}
+			high, err = cronValue(part[i+1:], f)
+			if err != nil {
+				return err
+			}
+			if low > high {
+				return fmt.Errorf("invalid range %q in the %s field", part, f.name)
+			}
+		default:
+			var err error
+			low, err = cronValue(part, f)
+			if err != nil {
+				return err
+			}
+			if step == 1 {
+				high = low
+			}
+		}
+
+		for v := low; v <= high; v += step {
+			set[v] = true
+		}
+	}
+	return nil
+}
+
+// cronValue parses a value of the field f, given as a number or a name.
+func cronValue(s string, f cronField) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s %q, expected %d-%d", f.name, s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Next returns the first time after t which the expression matches, or the
+// zero time if it never does.
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(cronSearchLimit)
+	for t.Before(limit) {
+		switch {
+		case !c.months[t.Month()]:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !c.hours[t.Hour()]:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !c.minutes[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches reports whether the day of t matches. When both the day of the
+// month and the day of the week are restricted, either matching is enough.
+func (c *Cron) dayMatches(t time.Time) bool {
+	day, weekday := c.days[t.Day()], c.weekdays[t.Weekday()]
+	switch {
+	case c.anyDay && c.anyWeekday:
+		return true
+	case c.anyDay:
+		return weekday
+	case c.anyWeekday:
+		return day
+	default:
+		return day || weekday
+	}
+}
+
+func (c *Cron) String() string {
+	return c.expr
+}
@@ -0,0 +1,87 @@
+// Package schedule decides when each of a series of repeated requests is sent:
+// at an interval, optionally aligned to the wall clock, or at the times of a
+// cron expression, each optionally delayed by random jitter so many probes
+// started together don't all send at once.
+package schedule
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Schedule is when repeated requests are due.
+type Schedule struct {
+	interval time.Duration
+	align    bool
+	cron     *Cron
+	jitter   time.Duration
+	rng      *rand.Rand
+}
+
+// Every creates a Schedule with requests interval apart, the first sent at
+// once.
+func Every(interval time.Duration) *Schedule {
+	return &Schedule{interval: interval}
+}
+
+// At creates a Schedule with requests at the times cron matches.
+func At(cron *Cron) *Schedule {
+	return &Schedule{cron: cron}
+}
+
+// SetAlign sends the requests of an interval at its multiples on the clock,
+// in UTC, so that with an interval of a minute they are sent at the start of
+// each minute, lining up with the buckets of dashboards. The first is then
+// sent at the next multiple rather than at once.
+func (s *Schedule) SetAlign(align bool) {
+	s.align = align
+}
+
+// SetJitter delays each request by a random duration of up to jitter from
+// when it is due, taken from rng, without moving when the next is due.
+func (s *Schedule) SetJitter(jitter time.Duration, rng *rand.Rand) {
+	s.jitter = jitter
+	s.rng = rng
+}
+
+// First returns when the first request is due, given the time now.
+func (s *Schedule) First(now time.Time) time.Time {
+	if s.cron == nil && !s.align {
+		return now
+	}
+	return s.next(now)
+}
+
+// Next returns when the request after one due at due is due, skipping those
+// which are already past at now, as when the previous requests took longer
+// than the interval. It returns the zero time if no more are due.
+func (s *Schedule) Next(due, now time.Time) time.Time {
+	next := s.next(due)
+	for !next.IsZero() && next.Before(now) {
+		next = s.next(next)
+	}
+	return next
+}
+
+// next returns when the request after one due at t is due.
+func (s *Schedule) next(t time.Time) time.Time {
+	switch {
+	case s.cron != nil:
+		return s.cron.Next(t)
+	case s.interval <= 0:
+		return time.Time{}
+	case s.align:
+		return t.Truncate(s.interval).Add(s.interval)
+	default:
+		return t.Add(s.interval)
+	}
+}
+
+// Jitter returns how long to delay the request due next, at random up to the
+// jitter.
+func (s *Schedule) Jitter() time.Duration {
+	if s.jitter <= 0 || s.rng == nil {
+		return 0
+	}
+	return time.Duration(s.rng.Int63n(int64(s.jitter)))
+}
@@ -0,0 +1,169 @@
+package schedule
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2026, time.October, 15, 9, 41, 30, 0, time.UTC)
+
+type testCron struct {
+	expr          string
+	from          time.Time
+	expected      []time.Time
+	expectedError string
+}
+
+func TestCronNext(t *testing.T) {
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := map[string]testCron{
+		"will match every five minutes": {
+			expr:     "*/5 * * * *",
+			from:     testNow,
+			expected: []time.Time{at(time.October, 15, 9, 45), at(time.October, 15, 9, 50), at(time.October, 15, 9, 55)},
+		},
+		"will match lists and ranges": {
+			expr:     "0,30 8-9 * * *",
+			from:     testNow,
+			expected: []time.Time{at(time.October, 16, 8, 0), at(time.October, 16, 8, 30), at(time.October, 16, 9, 0)},
+		},
+		"will match weekdays by name": {
+			expr:     "0 6 * * mon-fri",
+			from:     testNow,
+			expected: []time.Time{at(time.October, 16, 6, 0), at(time.October, 19, 6, 0)},
+		},
+		"will match either day when both are restricted": {
+			expr:     "0 0 1 * sun",
+			from:     testNow,
+			expected: []time.Time{at(time.October, 18, 0, 0), at(time.October, 25, 0, 0), at(time.November, 1, 0, 0), at(time.November, 8, 0, 0)},
+		},
+		"will expand macros": {
+			expr:     "@monthly",
+			from:     testNow,
+			expected: []time.Time{at(time.November, 1, 0, 0), at(time.December, 1, 0, 0)},
+		},
+		"will take 7 as sunday": {
+			expr:     "15 12 * * 7",
+			from:     testNow,
+			expected: []time.Time{at(time.October, 18, 12, 15)},
+		},
+		"will never match february 30": {
+			expr:     "0 0 30 feb *",
+			from:     testNow,
+			expected: []time.Time{{}},
+		},
+		"will reject the wrong number of fields": {
+			expr:          "* * * *",
+			expectedError: "expected 5 fields",
+		},
+		"will reject values out of range": {
+			expr:          "60 * * * *",
+			expectedError: `invalid minute "60", expected 0-59`,
+		},
+		"will reject a step of zero": {
+			expr:          "*/0 * * * *",
+			expectedError: `invalid step "0" in the minute field`,
+		},
+		"will reject backwards ranges": {
+			expr:          "* 5-1 * * *",
+			expectedError: `invalid range "5-1" in the hour field`,
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			cron, err := ParseCron(cfg.expr)
+			if cfg.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), cfg.expectedError) {
+					t.Fatalf("Unexpected error: got %v, want %q", err, cfg.expectedError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Error parsing cron expression: %v", err)
+			}
+
+			next := cfg.from
+			for _, e := range cfg.expected {
+				next = cron.Next(next)
+				if !next.Equal(e) {
+					t.Fatalf("Unexpected next time: got %v, want %v", next, e)
+				}
+			}
+		})
+	}
+}
+
+type testSchedule struct {
+	schedule *Schedule
+	first    time.Time
+	next     time.Time
+}
+
+func TestSchedule(t *testing.T) {
+	cron, err := ParseCron("0 * * * *")
+	if err != nil {
+		t.Fatalf("Error parsing cron expression: %v", err)
+	}
+	aligned := Every(5 * time.Minute)
+	aligned.SetAlign(true)
+
+	tests := map[string]testSchedule{
+		"will send the first at once": {
+			schedule: Every(time.Minute),
+			first:    testNow,
+			next:     testNow.Add(time.Minute),
+		},
+		"will align to the clock": {
+			schedule: aligned,
+			first:    time.Date(2026, time.October, 15, 9, 45, 0, 0, time.UTC),
+			next:     time.Date(2026, time.October, 15, 9, 50, 0, 0, time.UTC),
+		},
+		"will follow the cron expression": {
+			schedule: At(cron),
+			first:    time.Date(2026, time.October, 15, 10, 0, 0, 0, time.UTC),
+			next:     time.Date(2026, time.October, 15, 11, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			first := cfg.schedule.First(testNow)
+			if !first.Equal(cfg.first) {
+				t.Errorf("Unexpected first time: got %v, want %v", first, cfg.first)
+			}
+			if next := cfg.schedule.Next(first, first); !next.Equal(cfg.next) {
+				t.Errorf("Unexpected next time: got %v, want %v", next, cfg.next)
+			}
+		})
+	}
+}
+
+func TestScheduleSkipsMissed(t *testing.T) {
+	s := Every(time.Minute)
+	next := s.Next(testNow, testNow.Add(150*time.Second))
+	if expected := testNow.Add(3 * time.Minute); !next.Equal(expected) {
+		t.Errorf("Unexpected next time: got %v, want %v", next, expected)
+	}
+}
+
+func TestScheduleJitter(t *testing.T) {
+	s := Every(time.Minute)
+	if jitter := s.Jitter(); jitter != 0 {
+		t.Errorf("Unexpected jitter without SetJitter: got %v", jitter)
+	}
+
+	s.SetJitter(10*time.Second, rand.New(rand.NewSource(1)))
+	for i := 0; i < 100; i++ {
+		if jitter := s.Jitter(); jitter < 0 || jitter >= 10*time.Second {
+			t.Fatalf("Jitter out of range: got %v", jitter)
+		}
+	}
+}
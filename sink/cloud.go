@@ -0,0 +1,81 @@
+//go:build cloud || full
+// +build cloud full
+
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/berndhartzer/http-trace/report"
+)
+
+// cloudMetric is a value published to a cloud monitoring service. Timings are
+// in milliseconds.
+type cloudMetric struct {
+	Name  string
+	Value float64
+	Count bool // A count rather than a duration
+}
+
+// cloudMetrics returns the metrics published for a result: a duration for
+// each phase and derived metric, and an error count so failures can be
+// alerted on.
+func cloudMetrics(result *report.Result) []cloudMetric {
+	if result.Error != "" {
+		return []cloudMetric{{Name: "errors", Value: 1, Count: true}}
+	}
+
+	metrics := []cloudMetric{}
+	for _, name := range sortedKeys(result.Timings) {
+		metrics = append(metrics, cloudMetric{Name: name, Value: result.Timings[name] * 1000})
+	}
+	for _, name := range sortedKeys(result.Derived) {
+		metrics = append(metrics, cloudMetric{Name: "derived_" + name, Value: result.Derived[name] * 1000})
+	}
+	return append(metrics, cloudMetric{Name: "errors", Value: 0, Count: true})
+}
+
+// tokenCache holds a credential fetched from a metadata server until shortly
+// before it expires.
+type tokenCache struct {
+	mu      sync.Mutex
+	value   interface{}
+	expires time.Time
+}
+
+// get returns the cached credential, or fetches a new one. fetch returns the
+// credential and when it expires.
+func (c *tokenCache) get(now time.Time, fetch func() (interface{}, time.Time, error)) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.value != nil && now.Add(time.Minute).Before(c.expires) {
+		return c.value, nil
+	}
+
+	value, expires, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	c.value, c.expires = value, expires
+	return value, nil
+}
+
+// getMetadataJSON decodes the JSON document returned by a metadata server
+// request.
+func getMetadataJSON(client *http.Client, req *http.Request, v interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("metadata server responded %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,153 @@
+//go:build cloud || full
+// +build cloud full
+
+package sink
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// unsetEnv clears an environment variable for the rest of the test.
+func unsetEnv(t *testing.T, name string) {
+	t.Helper()
+
+	value, set := os.LookupEnv(name)
+	os.Unsetenv(name)
+	t.Cleanup(func() {
+		if set {
+			os.Setenv(name, value)
+		}
+	})
+}
+
+func TestSignV4(t *testing.T) {
+	// The get-vanilla case from the AWS Signature Version 4 test suite
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	creds := &awsCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signV4(req, nil, creds, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != expected {
+		t.Errorf("Unexpected Authorization header: got\n%v\n want\n%v\n", got, expected)
+	}
+}
+
+func TestCloudWatch(t *testing.T) {
+	unsetEnv(t, "AWS_ACCESS_KEY_ID")
+
+	var form url.Values
+	var auth, securityToken string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/latest/api/token":
+			io.WriteString(w, "session")
+		case "/latest/meta-data/iam/security-credentials/":
+			io.WriteString(w, "probe-role")
+		case "/latest/meta-data/iam/security-credentials/probe-role":
+			if r.Header.Get("X-aws-ec2-metadata-token") != "session" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			io.WriteString(w, `{"AccessKeyId":"AKID","SecretAccessKey":"secret","Token":"token","Expiration":"2100-01-01T00:00:00Z"}`)
+		default:
+			r.ParseForm()
+			form = r.PostForm
+			auth = r.Header.Get("Authorization")
+			securityToken = r.Header.Get("X-Amz-Security-Token")
+		}
+	}))
+	defer server.Close()
+
+	c := NewCloudWatch("eu-west-1", "HTTPTrace", [][2]string{{"probe", "sydney"}}, server.Client())
+	c.endpoint = server.URL + "/"
+	c.metadataURL = server.URL
+	c.now = func() time.Time { return time.Unix(1600000000, 0) }
+
+	err := c.Send(testResult)
+	if err != nil {
+		t.Fatalf("Error sending to cloudwatch: %v", err)
+	}
+
+	expected := map[string]string{
+		"Action":                                        "PutMetricData",
+		"Namespace":                                     "HTTPTrace",
+		"MetricData.member.1.MetricName":                "dns",
+		"MetricData.member.1.Unit":                      "Milliseconds",
+		"MetricData.member.1.Value":                     "2",
+		"MetricData.member.1.Timestamp":                 "2020-09-13T12:26:40Z",
+		"MetricData.member.1.Dimensions.member.1.Name":  "host",
+		"MetricData.member.1.Dimensions.member.1.Value": "thing.com",
+		"MetricData.member.1.Dimensions.member.4.Name":  "probe",
+		"MetricData.member.1.Dimensions.member.4.Value": "sydney",
+		"MetricData.member.3.MetricName":                "derived_backend",
+		"MetricData.member.3.Value":                     "200",
+		"MetricData.member.4.MetricName":                "errors",
+		"MetricData.member.4.Unit":                      "Count",
+		"MetricData.member.4.Value":                     "0",
+	}
+	for name, value := range expected {
+		if got := form.Get(name); got != value {
+			t.Errorf("Unexpected %s: got %q, want %q", name, got, value)
+		}
+	}
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/20200913/eu-west-1/monitoring/aws4_request, ") {
+		t.Errorf("Unexpected Authorization header: got %v", auth)
+	}
+	if securityToken != "token" {
+		t.Errorf("Unexpected X-Amz-Security-Token: got %v, want token", securityToken)
+	}
+}
+
+func TestGCM(t *testing.T) {
+	unsetEnv(t, "GOOGLE_OAUTH_ACCESS_TOKEN")
+
+	var body, auth, path string
+	tokenRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/computeMetadata/") {
+			tokenRequests++
+			if r.Header.Get("Metadata-Flavor") != "Google" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			io.WriteString(w, `{"access_token":"token","expires_in":3600,"token_type":"Bearer"}`)
+			return
+		}
+		raw, _ := io.ReadAll(r.Body)
+		body, auth, path = string(raw), r.Header.Get("Authorization"), r.URL.Path
+	}))
+	defer server.Close()
+
+	g := NewGCM("my-project", "http_trace", [][2]string{{"probe", "sydney"}}, server.Client())
+	g.endpoint = server.URL
+	g.metadataURL = server.URL
+	g.now = func() time.Time { return time.Unix(1600000000, 0) }
+
+	for i := 0; i < 2; i++ {
+		err := g.Send(testErrorResult)
+		if err != nil {
+			t.Fatalf("Error sending to cloud monitoring: %v", err)
+		}
+	}
+
+	expected := `{"timeSeries":[{"metric":{"type":"custom.googleapis.com/http_trace/errors","labels":{"host":"thing.com","method":"GET","probe":"sydney"}},"resource":{"type":"global","labels":{"project_id":"my-project"}},"points":[{"interval":{"endTime":"2020-09-13T12:26:40Z"},"value":{"int64Value":"1"}}]}]}`
+	if body != expected {
+		t.Errorf("Unexpected time series: got\n%v\n want\n%v\n", body, expected)
+	}
+	if path != "/v3/projects/my-project/timeSeries" {
+		t.Errorf("Unexpected path: got %v", path)
+	}
+	if auth != "Bearer token" {
+		t.Errorf("Unexpected Authorization header: got %v, want Bearer token", auth)
+	}
+	if tokenRequests != 1 {
+		t.Errorf("Expected the token to be cached: got %d token requests", tokenRequests)
+	}
+}
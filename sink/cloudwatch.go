@@ -0,0 +1,274 @@
+//go:build cloud || full
+// +build cloud full
+
+package sink
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/berndhartzer/http-trace/report"
+)
+
+// awsMetadataURL is the EC2 instance metadata service, used for credentials
+// when they aren't set in the environment.
+const awsMetadataURL = "http://169.254.169.254"
+
+// awsCredentials are the keys requests to AWS are signed with.
+type awsCredentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	Token           string `json:"Token"`
+	Expiration      time.Time
+}
+
+// CloudWatch publishes the timings of each result as custom metrics with
+// PutMetricData. Credentials are read from the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables, or
+// otherwise from the role of the EC2 instance.
+type CloudWatch struct {
+	region      string
+	namespace   string
+	labels      [][2]string
+	client      *http.Client
+	endpoint    string
+	metadataURL string
+	credentials tokenCache
+	now         func() time.Time
+}
+
+// NewCloudWatch creates a CloudWatch sink publishing to namespace in region.
+// Metrics have host, method and status dimensions, along with labels.
+func NewCloudWatch(region, namespace string, labels [][2]string, client *http.Client) *CloudWatch {
+	return &CloudWatch{
+		region:      region,
+		namespace:   namespace,
+		labels:      labels,
+		client:      client,
+		endpoint:    "https://monitoring." + region + ".amazonaws.com/",
+		metadataURL: awsMetadataURL,
+		now:         time.Now,
+	}
+}
+
+func (c *CloudWatch) Send(result *report.Result) error {
+	creds, err := c.getCredentials()
+	if err != nil {
+		return fmt.Errorf("error getting AWS credentials: %w", err)
+	}
+
+	body := c.format(result).Encode()
+	req, err := http.NewRequest(http.MethodPost, c.endpoint, strings.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating cloudwatch request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	signV4(req, []byte(body), creds, c.region, "monitoring", c.now())
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending to cloudwatch: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		detail, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("error sending to cloudwatch: server responded %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+
+	return nil
+}
+
+// format builds the PutMetricData query parameters for a result.
+func (c *CloudWatch) format(result *report.Result) url.Values {
+	values := url.Values{}
+	values.Set("Action", "PutMetricData")
+	values.Set("Version", "2010-08-01")
+	values.Set("Namespace", c.namespace)
+
+	dimensions := append(tags(result), c.labels...)
+	timestamp := c.now().UTC().Format(time.RFC3339)
+	for i, m := range cloudMetrics(result) {
+		prefix := "MetricData.member." + strconv.Itoa(i+1) + "."
+		unit := "Milliseconds"
+		if m.Count {
+			unit = "Count"
+		}
+		values.Set(prefix+"MetricName", m.Name)
+		values.Set(prefix+"Unit", unit)
+		values.Set(prefix+"Value", strconv.FormatFloat(m.Value, 'f', -1, 64))
+		values.Set(prefix+"Timestamp", timestamp)
+		for j, d := range dimensions {
+			dimension := prefix + "Dimensions.member." + strconv.Itoa(j+1) + "."
+			values.Set(dimension+"Name", d[0])
+			values.Set(dimension+"Value", d[1])
+		}
+	}
+
+	return values
+}
+
+func (c *CloudWatch) getCredentials() (*awsCredentials, error) {
+	if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		return &awsCredentials{
+			AccessKeyID:     id,
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			Token:           os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+
+	creds, err := c.credentials.get(c.now(), func() (interface{}, time.Time, error) {
+		creds, err := c.fetchInstanceCredentials()
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		return creds, creds.Expiration, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return creds.(*awsCredentials), nil
+}
+
+// fetchInstanceCredentials gets the credentials of the instance's role from
+// the instance metadata service, using a session token (IMDSv2).
+func (c *CloudWatch) fetchInstanceCredentials() (*awsCredentials, error) {
+	req, err := http.NewRequest(http.MethodPut, c.metadataURL+"/latest/api/token", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+	token, err := c.metadataText(req)
+	if err != nil {
+		return nil, fmt.Errorf("no credentials in the environment or from instance metadata: %w", err)
+	}
+
+	get := func(path string) (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodGet, c.metadataURL+"/latest/meta-data/iam/security-credentials/"+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-aws-ec2-metadata-token", token)
+		return req, nil
+	}
+
+	req, err = get("")
+	if err != nil {
+		return nil, err
+	}
+	role, err := c.metadataText(req)
+	if err != nil {
+		return nil, fmt.Errorf("error getting instance role: %w", err)
+	}
+	role = strings.TrimSpace(strings.SplitN(role, "\n", 2)[0])
+
+	req, err = get(role)
+	if err != nil {
+		return nil, err
+	}
+	creds := &awsCredentials{}
+	err = getMetadataJSON(c.client, req, creds)
+	if err != nil {
+		return nil, fmt.Errorf("error getting credentials for instance role %s: %w", role, err)
+	}
+	return creds, nil
+}
+
+func (c *CloudWatch) metadataText(req *http.Request) (string, error) {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("metadata server responded %s", resp.Status)
+	}
+	raw, err := ioutil.ReadAll(resp.Body)
+	return string(raw), err
+}
+
+// signV4 signs a request to an AWS service with Signature Version 4, setting
+// the X-Amz-Date and Authorization headers.
+func signV4(req *http.Request, body []byte, creds *awsCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.Token != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.Token)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	canonicalHeaders := &strings.Builder{}
+	for _, name := range names {
+		fmt.Fprintf(canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	bodyHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	scope := amzDate[:8] + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, part := range []string{amzDate[:8], region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// canonicalQuery encodes query parameters sorted by name and value, with
+// spaces as %20 rather than +.
+func canonicalQuery(query url.Values) string {
+	pairs := []string{}
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, awsEscape(name)+"="+awsEscape(value))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+func awsEscape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
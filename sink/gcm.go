@@ -0,0 +1,166 @@
+//go:build cloud || full
+// +build cloud full
+
+package sink
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/berndhartzer/http-trace/report"
+)
+
+// gcpMetadataURL is the Compute Engine metadata server, used for an access
+// token when one isn't set in the environment.
+const gcpMetadataURL = "http://metadata.google.internal"
+
+// GCM publishes the timings of each result as custom metrics to Google Cloud
+// Monitoring (formerly Stackdriver). The access token is read from the
+// GOOGLE_OAUTH_ACCESS_TOKEN environment variable, or otherwise from the
+// service account of the Compute Engine instance.
+type GCM struct {
+	project     string
+	prefix      string
+	labels      [][2]string
+	client      *http.Client
+	endpoint    string
+	metadataURL string
+	token       tokenCache
+	now         func() time.Time
+}
+
+// NewGCM creates a GCM sink writing time series to project. Metrics are named
+// custom.googleapis.com/<prefix>/<name> and labelled with the host, method
+// and status, along with labels.
+func NewGCM(project, prefix string, labels [][2]string, client *http.Client) *GCM {
+	return &GCM{
+		project:     project,
+		prefix:      prefix,
+		labels:      labels,
+		client:      client,
+		endpoint:    "https://monitoring.googleapis.com",
+		metadataURL: gcpMetadataURL,
+		now:         time.Now,
+	}
+}
+
+type gcmTimeSeries struct {
+	Metric struct {
+		Type   string            `json:"type"`
+		Labels map[string]string `json:"labels"`
+	} `json:"metric"`
+	Resource struct {
+		Type   string            `json:"type"`
+		Labels map[string]string `json:"labels"`
+	} `json:"resource"`
+	Points []gcmPoint `json:"points"`
+}
+
+type gcmPoint struct {
+	Interval struct {
+		EndTime string `json:"endTime"`
+	} `json:"interval"`
+	Value struct {
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+		Int64Value  *string  `json:"int64Value,omitempty"`
+	} `json:"value"`
+}
+
+func (g *GCM) Send(result *report.Result) error {
+	token, err := g.getToken()
+	if err != nil {
+		return fmt.Errorf("error getting Google Cloud access token: %w", err)
+	}
+
+	body, err := json.Marshal(map[string][]gcmTimeSeries{"timeSeries": g.format(result)})
+	if err != nil {
+		return fmt.Errorf("error encoding time series: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, g.endpoint+"/v3/projects/"+g.project+"/timeSeries", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating cloud monitoring request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending to cloud monitoring: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		detail, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("error sending to cloud monitoring: server responded %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+
+	return nil
+}
+
+// format builds a time series with a single point for each metric of a
+// result. Durations are doubles in milliseconds, counts are integers.
+func (g *GCM) format(result *report.Result) []gcmTimeSeries {
+	labels := map[string]string{}
+	for _, l := range append(tags(result), g.labels...) {
+		labels[l[0]] = l[1]
+	}
+	endTime := g.now().UTC().Format(time.RFC3339Nano)
+
+	series := []gcmTimeSeries{}
+	for _, m := range cloudMetrics(result) {
+		ts := gcmTimeSeries{}
+		ts.Metric.Type = "custom.googleapis.com/" + g.prefix + "/" + m.Name
+		ts.Metric.Labels = labels
+		ts.Resource.Type = "global"
+		ts.Resource.Labels = map[string]string{"project_id": g.project}
+
+		p := gcmPoint{}
+		p.Interval.EndTime = endTime
+		if m.Count {
+			value := fmt.Sprintf("%d", int64(m.Value))
+			p.Value.Int64Value = &value
+		} else {
+			value := m.Value
+			p.Value.DoubleValue = &value
+		}
+		ts.Points = []gcmPoint{p}
+		series = append(series, ts)
+	}
+
+	return series
+}
+
+func (g *GCM) getToken() (string, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	token, err := g.token.get(g.now(), func() (interface{}, time.Time, error) {
+		req, err := http.NewRequest(http.MethodGet, g.metadataURL+"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		req.Header.Set("Metadata-Flavor", "Google")
+
+		var resp struct {
+			AccessToken string `json:"access_token"`
+			ExpiresIn   int    `json:"expires_in"`
+		}
+		err = getMetadataJSON(g.client, req, &resp)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("no token in the environment or from instance metadata: %w", err)
+		}
+		return resp.AccessToken, g.now().Add(time.Duration(resp.ExpiresIn) * time.Second), nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return token.(string), nil
+}
@@ -0,0 +1,124 @@
+package sink
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/berndhartzer/http-trace/report"
+)
+
+// Incidents groups the consecutive failures of the same kind of each request
+// into incidents, so an alert is sent when one is opened, as a reminder while
+// it stays open and when it is resolved, rather than for every failure.
+type Incidents struct {
+	repeat time.Duration
+	log    io.Writer
+	now    func() time.Time
+
+	mu     sync.Mutex
+	lastID int
+	open   map[string]*openIncident // By method and URL of the request
+}
+
+type openIncident struct {
+	incident report.Incident
+	notified time.Time
+}
+
+// NewIncidents creates Incidents which notify an update of an open incident
+// every repeat, or never if repeat is 0.
+func NewIncidents(repeat time.Duration) *Incidents {
+	return &Incidents{
+		repeat: repeat,
+		now:    time.Now,
+		open:   map[string]*openIncident{},
+	}
+}
+
+// SetLog writes a line to w summarising each incident when it is opened,
+// updated and resolved.
+func (i *Incidents) SetLog(w io.Writer) {
+	i.log = w
+}
+
+// Track adds result to the incident of its request, returning the changes of
+// state to notify: none for a failure of an incident which was notified
+// recently or a success without one, and both the resolution of the
+// incident and the opening of a new one when the kind of failure changed.
+func (i *Incidents) Track(result *report.Result) []*report.Incident {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	key := result.Method + " " + result.URL
+	now := i.now()
+	open := i.open[key]
+	kind := ""
+	if failed(result) {
+		kind = failureKind(result)
+	}
+
+	changes := []*report.Incident{}
+	if open != nil && open.incident.Kind != kind {
+		delete(i.open, key)
+		changes = append(changes, i.notify(open, report.IncidentResolve, now, result))
+		open = nil
+	}
+	switch {
+	case kind == "":
+	case open == nil:
+		i.lastID++
+		open = &openIncident{incident: report.Incident{ID: i.lastID, Kind: kind, Opened: now, Failures: 1}}
+		i.open[key] = open
+		changes = append(changes, i.notify(open, report.IncidentOpen, now, result))
+	default:
+		open.incident.Failures++
+		if i.repeat > 0 && now.Sub(open.notified) >= i.repeat {
+			changes = append(changes, i.notify(open, report.IncidentUpdate, now, result))
+		}
+	}
+	return changes
+}
+
+// notify returns the incident in state as of now, logging it.
+func (i *Incidents) notify(open *openIncident, state string, now time.Time, result *report.Result) *report.Incident {
+	open.notified = now
+	incident := open.incident
+	incident.State = state
+	incident.Duration = now.Sub(incident.Opened).Seconds()
+	if i.log != nil {
+		fmt.Fprintf(i.log, "%s\n", incidentSummary(&incident, result))
+	}
+	return &incident
+}
+
+// failureKind returns what kind of failure a failed result is, so that
+// failures of the same kind are grouped into one incident: the error, the
+// response status, or the assertions which failed.
+func failureKind(result *report.Result) string {
+	switch {
+	case result.Error != "":
+		return "error: " + result.Error
+	case result.Status >= 400:
+		return fmt.Sprintf("status %d", result.Status)
+	default:
+		return "assertion failed: " + strings.Join(result.FailedAssertions(), ", ")
+	}
+}
+
+// incidentSummary describes the state of the incident in a line, such as
+// Incident #3 resolved after 5m0s and 12 failures: GET https://example.com: status 503.
+func incidentSummary(incident *report.Incident, result *report.Result) string {
+	request := fmt.Sprintf("%s %s", result.Method, result.URL)
+	duration := time.Duration(incident.Duration * float64(time.Second)).Round(time.Second)
+	switch incident.State {
+	case report.IncidentOpen:
+		return fmt.Sprintf("Incident #%d opened: %s: %s", incident.ID, request, incident.Kind)
+	case report.IncidentUpdate:
+		return fmt.Sprintf("Incident #%d still open after %s and %d failures: %s: %s", incident.ID, duration, incident.Failures, request, incident.Kind)
+	default:
+		return fmt.Sprintf("Incident #%d resolved after %s and %d failures: %s: %s", incident.ID, duration, incident.Failures, request, incident.Kind)
+	}
+}
@@ -0,0 +1,110 @@
+package sink
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/berndhartzer/http-trace/report"
+)
+
+// Influx writes results as InfluxDB line protocol, either to a HTTP write
+// endpoint (such as http://localhost:8086/write?db=probes or
+// /api/v2/write?org=o&bucket=b) or to a udp://host:port listener.
+type Influx struct {
+	url         string
+	token       string
+	measurement string
+	client      *http.Client
+	now         func() time.Time
+}
+
+// NewInflux creates an Influx sink. A non-empty token is sent as an
+// InfluxDB 2 API token.
+func NewInflux(writeURL, token, measurement string, client *http.Client) *Influx {
+	return &Influx{
+		url:         writeURL,
+		token:       token,
+		measurement: measurement,
+		client:      client,
+		now:         time.Now,
+	}
+}
+
+func (i *Influx) Send(result *report.Result) error {
+	line := i.format(result)
+
+	u, err := url.Parse(i.url)
+	if err != nil {
+		return fmt.Errorf("invalid influx url: %w", err)
+	}
+
+	if u.Scheme == "udp" {
+		conn, err := net.Dial("udp", u.Host)
+		if err != nil {
+			return fmt.Errorf("error connecting to influx: %w", err)
+		}
+		defer conn.Close()
+
+		_, err = conn.Write(line)
+		if err != nil {
+			return fmt.Errorf("error sending to influx: %w", err)
+		}
+		return nil
+	}
+
+	req, err := http.NewRequest(http.MethodPost, i.url, bytes.NewReader(line))
+	if err != nil {
+		return fmt.Errorf("error creating influx request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if i.token != "" {
+		req.Header.Set("Authorization", "Token "+i.token)
+	}
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending to influx: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("error sending to influx: server responded %s", resp.Status)
+	}
+
+	return nil
+}
+
+var (
+	influxTagEscaper    = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	influxStringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+)
+
+func (i *Influx) format(result *report.Result) []byte {
+	b := &bytes.Buffer{}
+	b.WriteString(influxTagEscaper.Replace(i.measurement))
+	for _, tag := range tags(result) {
+		fmt.Fprintf(b, ",%s=%s", tag[0], influxTagEscaper.Replace(tag[1]))
+	}
+
+	fields := []string{}
+	if result.Error != "" {
+		fields = append(fields, fmt.Sprintf(`error="%s"`, influxStringEscaper.Replace(result.Error)))
+	} else {
+		for _, name := range sortedKeys(result.Timings) {
+			fields = append(fields, name+"="+strconv.FormatFloat(result.Timings[name], 'f', -1, 64))
+		}
+		for _, name := range sortedKeys(result.Derived) {
+			fields = append(fields, "derived_"+name+"="+strconv.FormatFloat(result.Derived[name], 'f', -1, 64))
+		}
+		fields = append(fields, fmt.Sprintf("body_size=%di", result.BodySize))
+	}
+
+	fmt.Fprintf(b, " %s %d\n", strings.Join(fields, ","), i.now().UnixNano())
+	return b.Bytes()
+}
@@ -0,0 +1,370 @@
+//go:build publish || full
+// +build publish full
+
+package sink
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Kafka API keys and the versions used, which are supported by brokers from
+// Kafka 1.0 onwards.
+const (
+	kafkaProduce         = 0
+	kafkaProduceVersion  = 3
+	kafkaMetadata        = 3
+	kafkaMetadataVersion = 4
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// kafkaProducer is a minimal Kafka producer, writing batches of messages to a
+// topic. Each batch goes to the leader of the next partition in turn.
+type kafkaProducer struct {
+	brokers []string
+	topic   string
+	timeout time.Duration
+
+	leaders       map[int32]string // Address of the leader of each partition
+	partitions    []int32
+	next          int
+	conns         map[string]net.Conn
+	correlationID int32
+}
+
+func newKafkaProducer(brokers []string, topic string, timeout time.Duration) *kafkaProducer {
+	return &kafkaProducer{
+		brokers: brokers,
+		topic:   topic,
+		timeout: timeout,
+		conns:   map[string]net.Conn{},
+	}
+}
+
+func (k *kafkaProducer) publish(messages [][]byte, now time.Time) error {
+	if k.leaders == nil {
+		err := k.refreshMetadata()
+		if err != nil {
+			return err
+		}
+	}
+
+	partition := k.partitions[k.next%len(k.partitions)]
+	k.next++
+
+	req := &kafkaEncoder{}
+	req.int16(-1) // Null transactional ID
+	req.int16(1)  // acks from the leader
+	req.int32(int32(k.timeout / time.Millisecond))
+	req.int32(1)
+	req.string(k.topic)
+	req.int32(1)
+	req.int32(partition)
+	batch := recordBatch(messages, now)
+	req.int32(int32(len(batch)))
+	req.buf.Write(batch)
+
+	resp, err := k.roundTrip(k.leaders[partition], kafkaProduce, kafkaProduceVersion, req.buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	for topics := resp.int32(); topics > 0 && resp.err == nil; topics-- {
+		resp.string()
+		for partitions := resp.int32(); partitions > 0 && resp.err == nil; partitions-- {
+			resp.int32()
+			code := resp.int16()
+			resp.int64()
+			resp.int64()
+			if code != 0 {
+				// The partition may have moved, so look the leaders up again
+				k.leaders = nil
+				return fmt.Errorf("kafka produce to %s partition %d failed with error code %d", k.topic, partition, code)
+			}
+		}
+	}
+	return resp.err
+}
+
+// refreshMetadata looks up the partitions of the topic and their leaders,
+// asking each broker in turn until one answers.
+func (k *kafkaProducer) refreshMetadata() error {
+	req := &kafkaEncoder{}
+	req.int32(1)
+	req.string(k.topic)
+	req.int8(1) // Allow the topic to be created automatically
+
+	var lastErr error
+	for _, broker := range k.brokers {
+		resp, err := k.roundTrip(broker, kafkaMetadata, kafkaMetadataVersion, req.buf.Bytes())
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		resp.int32() // Throttle time
+		addrs := map[int32]string{}
+		for brokers := resp.int32(); brokers > 0 && resp.err == nil; brokers-- {
+			node := resp.int32()
+			host := resp.string()
+			port := resp.int32()
+			resp.string() // Rack
+			addrs[node] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+		}
+		resp.string() // Cluster ID
+		resp.int32()  // Controller ID
+
+		leaders := map[int32]string{}
+		partitions := []int32{}
+		for topics := resp.int32(); topics > 0 && resp.err == nil; topics-- {
+			code := resp.int16()
+			name := resp.string()
+			resp.int8()
+			if name == k.topic && code != 0 {
+				lastErr = fmt.Errorf("kafka metadata for %s failed with error code %d", k.topic, code)
+			}
+			for n := resp.int32(); n > 0 && resp.err == nil; n-- {
+				resp.int16()
+				partition := resp.int32()
+				leader := resp.int32()
+				resp.int32Array()
+				resp.int32Array()
+				if addr, ok := addrs[leader]; ok && name == k.topic {
+					leaders[partition] = addr
+					partitions = append(partitions, partition)
+				}
+			}
+		}
+		if resp.err != nil {
+			lastErr = resp.err
+			continue
+		}
+
+		if len(partitions) == 0 {
+			if lastErr == nil {
+				lastErr = fmt.Errorf("no kafka partitions with a leader for %s", k.topic)
+			}
+			return lastErr
+		}
+		k.leaders, k.partitions = leaders, partitions
+		return nil
+	}
+
+	return fmt.Errorf("error getting kafka metadata: %w", lastErr)
+}
+
+// roundTrip sends a request to a broker and returns a decoder for the body of
+// its response.
+func (k *kafkaProducer) roundTrip(addr string, apiKey, version int16, body []byte) (*kafkaDecoder, error) {
+	conn, ok := k.conns[addr]
+	if !ok {
+		var err error
+		conn, err = net.DialTimeout("tcp", addr, k.timeout)
+		if err != nil {
+			return nil, err
+		}
+		k.conns[addr] = conn
+	}
+
+	k.correlationID++
+	req := &kafkaEncoder{}
+	req.int32(0) // Size, set below
+	req.int16(apiKey)
+	req.int16(version)
+	req.int32(k.correlationID)
+	req.string("http-trace")
+	req.buf.Write(body)
+	raw := req.buf.Bytes()
+	binary.BigEndian.PutUint32(raw, uint32(len(raw)-4))
+
+	conn.SetDeadline(time.Now().Add(k.timeout))
+	resp, err := k.exchange(conn, raw)
+	if err != nil {
+		// The connection is in an unknown state, so start again with a new one
+		conn.Close()
+		delete(k.conns, addr)
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (k *kafkaProducer) exchange(conn net.Conn, raw []byte) (*kafkaDecoder, error) {
+	_, err := conn.Write(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var size int32
+	err = binary.Read(conn, binary.BigEndian, &size)
+	if err != nil {
+		return nil, err
+	}
+	if size < 4 {
+		return nil, errors.New("invalid kafka response")
+	}
+	body := make([]byte, size)
+	_, err = io.ReadFull(conn, body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &kafkaDecoder{buf: body}
+	if id := resp.int32(); id != k.correlationID {
+		return nil, fmt.Errorf("kafka response for request %d, expected %d", id, k.correlationID)
+	}
+	return resp, nil
+}
+
+func (k *kafkaProducer) close() {
+	for addr, conn := range k.conns {
+		conn.Close()
+		delete(k.conns, addr)
+	}
+}
+
+// recordBatch encodes messages as a version 2 record batch, without keys or
+// headers.
+func recordBatch(messages [][]byte, now time.Time) []byte {
+	timestamp := now.UnixNano() / int64(time.Millisecond)
+
+	records := &kafkaEncoder{}
+	for i, m := range messages {
+		record := &kafkaEncoder{}
+		record.int8(0)          // Attributes
+		record.varint(0)        // Timestamp delta
+		record.varint(int64(i)) // Offset delta
+		record.varint(-1)       // Null key
+		record.varint(int64(len(m)))
+		record.buf.Write(m)
+		record.varint(0) // Headers
+
+		records.varint(int64(record.buf.Len()))
+		records.buf.Write(record.buf.Bytes())
+	}
+
+	// The part of the batch covered by the CRC
+	checked := &kafkaEncoder{}
+	checked.int16(0) // Attributes, no compression
+	checked.int32(int32(len(messages) - 1))
+	checked.int64(timestamp)
+	checked.int64(timestamp)
+	checked.int64(-1) // No producer ID
+	checked.int16(-1)
+	checked.int32(-1)
+	checked.int32(int32(len(messages)))
+	checked.buf.Write(records.buf.Bytes())
+
+	batch := &kafkaEncoder{}
+	batch.int64(0) // Base offset
+	batch.int32(int32(4 + 1 + 4 + checked.buf.Len()))
+	batch.int32(-1) // Partition leader epoch
+	batch.int8(2)   // Magic
+	batch.int32(int32(crc32.Checksum(checked.buf.Bytes(), crc32c)))
+	batch.buf.Write(checked.buf.Bytes())
+	return batch.buf.Bytes()
+}
+
+// kafkaEncoder writes the big endian primitives of the Kafka protocol.
+type kafkaEncoder struct {
+	buf bytes.Buffer
+}
+
+func (e *kafkaEncoder) int8(v int8) {
+	e.buf.WriteByte(byte(v))
+}
+
+func (e *kafkaEncoder) int16(v int16) {
+	binary.Write(&e.buf, binary.BigEndian, v)
+}
+
+func (e *kafkaEncoder) int32(v int32) {
+	binary.Write(&e.buf, binary.BigEndian, v)
+}
+
+func (e *kafkaEncoder) int64(v int64) {
+	binary.Write(&e.buf, binary.BigEndian, v)
+}
+
+func (e *kafkaEncoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.buf.WriteString(s)
+}
+
+// varint writes a zigzag encoded variable length integer, as used in records.
+func (e *kafkaEncoder) varint(v int64) {
+	b := make([]byte, binary.MaxVarintLen64)
+	e.buf.Write(b[:binary.PutVarint(b, v)])
+}
+
+// kafkaDecoder reads the big endian primitives of the Kafka protocol. After
+// running out of data it returns zero values, and err is set.
+type kafkaDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *kafkaDecoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.buf) {
+		d.err = errors.New("truncated kafka response")
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *kafkaDecoder) int8() int8 {
+	if b := d.take(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int16() int16 {
+	if b := d.take(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int32() int32 {
+	if b := d.take(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int64() int64 {
+	if b := d.take(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+// string reads a string, which is empty if it is null.
+func (d *kafkaDecoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.take(int(n)))
+}
+
+func (d *kafkaDecoder) int32Array() []int32 {
+	values := []int32{}
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		values = append(values, d.int32())
+	}
+	return values
+}
@@ -0,0 +1,143 @@
+//go:build publish || full
+// +build publish full
+
+package sink
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// natsPublisher publishes messages to a NATS subject using the text
+// protocol, waiting for the server to confirm each batch with a PONG.
+type natsPublisher struct {
+	addr    string
+	user    *url.Userinfo
+	subject string
+	timeout time.Duration
+
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newNATSPublisher(addr string, user *url.Userinfo, subject string, timeout time.Duration) *natsPublisher {
+	return &natsPublisher{
+		addr:    addr,
+		user:    user,
+		subject: subject,
+		timeout: timeout,
+	}
+}
+
+func (n *natsPublisher) publish(messages [][]byte, now time.Time) error {
+	if n.conn == nil {
+		err := n.connect()
+		if err != nil {
+			return err
+		}
+	}
+
+	n.conn.SetDeadline(time.Now().Add(n.timeout))
+	w := bufio.NewWriter(n.conn)
+	for _, m := range messages {
+		fmt.Fprintf(w, "PUB %s %d\r\n", n.subject, len(m))
+		w.Write(m)
+		w.WriteString("\r\n")
+	}
+	w.WriteString("PING\r\n")
+	err := w.Flush()
+	if err == nil {
+		err = n.awaitPong()
+	}
+	if err != nil {
+		n.close()
+		return err
+	}
+	return nil
+}
+
+// connect opens a connection and introduces the client, with the user and
+// password or token from the URL.
+func (n *natsPublisher) connect() error {
+	conn, err := net.DialTimeout("tcp", n.addr, n.timeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(n.timeout))
+	n.conn, n.reader = conn, bufio.NewReader(conn)
+
+	line, err := n.reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "INFO ") {
+		n.close()
+		return fmt.Errorf("unexpected greeting from NATS server %s: %q", n.addr, strings.TrimSpace(line))
+	}
+	var info struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	json.Unmarshal([]byte(line[len("INFO "):]), &info)
+	if info.TLSRequired {
+		n.close()
+		return errors.New("NATS server requires TLS, which is not supported")
+	}
+
+	options := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     "http-trace",
+		"lang":     "go",
+		"version":  "1",
+	}
+	if n.user != nil {
+		if password, ok := n.user.Password(); ok {
+			options["user"], options["pass"] = n.user.Username(), password
+		} else {
+			options["auth_token"] = n.user.Username()
+		}
+	}
+	connect, _ := json.Marshal(options)
+	_, err = fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", connect)
+	if err == nil {
+		err = n.awaitPong()
+	}
+	if err != nil {
+		n.close()
+		return err
+	}
+	return nil
+}
+
+// awaitPong reads until the server answers a PING, answering its own and
+// failing on an error.
+func (n *natsPublisher) awaitPong() error {
+	for {
+		line, err := n.reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			_, err = n.conn.Write([]byte("PONG\r\n"))
+			if err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("NATS server error: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+func (n *natsPublisher) close() {
+	if n.conn != nil {
+		n.conn.Close()
+		n.conn, n.reader = nil, nil
+	}
+}
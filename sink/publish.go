@@ -0,0 +1,221 @@
+//go:build publish || full
+// +build publish full
+
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/berndhartzer/http-trace/report"
+)
+
+// Defaults for batching published results.
+const (
+	DefaultPublishBatch    = 100
+	DefaultPublishInterval = time.Second
+)
+
+// publishRetries is how many more times a batch is sent after failing, with
+// the wait between attempts doubling from publishBackoff.
+const (
+	publishRetries = 3
+	publishBackoff = 250 * time.Millisecond
+)
+
+// producer sends a batch of messages to a message broker.
+type producer interface {
+	publish(messages [][]byte, now time.Time) error
+	close()
+}
+
+// Publisher streams each result as a JSON message to a Kafka topic or NATS
+// subject. Results are sent in batches, when a batch is full or at an
+// interval, and a batch which fails to send is retried before being dropped.
+type Publisher struct {
+	url      string
+	producer producer
+	batch    int
+	interval time.Duration
+	backoff  time.Duration
+	onError  func(error)
+	now      func() time.Time
+
+	mu      sync.Mutex
+	pending [][]byte
+	full    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	started bool
+
+	sendMu sync.Mutex
+}
+
+// NewPublisher creates a Publisher for a kafka://broker[,broker...]/topic or
+// nats://[user:password@]host/subject URL. timeout applies to each attempt to
+// send a batch.
+func NewPublisher(rawURL string, timeout time.Duration) (*Publisher, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid publish url: %w", err)
+	}
+	destination := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || destination == "" {
+		return nil, fmt.Errorf("invalid publish url %q, expected kafka://broker/topic or nats://host/subject", rawURL)
+	}
+
+	p := &Publisher{
+		url:      u.Redacted(),
+		batch:    DefaultPublishBatch,
+		interval: DefaultPublishInterval,
+		backoff:  publishBackoff,
+		now:      time.Now,
+		full:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	switch u.Scheme {
+	case "kafka":
+		brokers := []string{}
+		for _, broker := range strings.Split(u.Host, ",") {
+			brokers = append(brokers, withDefaultPort(broker, "9092"))
+		}
+		p.producer = newKafkaProducer(brokers, destination, timeout)
+	case "nats":
+		p.producer = newNATSPublisher(withDefaultPort(u.Host, "4222"), u.User, destination, timeout)
+	default:
+		return nil, fmt.Errorf("unsupported publish url %q, expected kafka:// or nats://", rawURL)
+	}
+
+	return p, nil
+}
+
+func withDefaultPort(host, port string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// SetBatch sets the number of results sent together, and the longest a result
+// waits before being sent in a partial batch.
+func (p *Publisher) SetBatch(size int, interval time.Duration) {
+	p.batch = size
+	p.interval = interval
+}
+
+// SetErrorHandler sets a function called when a batch sent in the background
+// can't be published.
+func (p *Publisher) SetErrorHandler(handler func(error)) {
+	p.onError = handler
+}
+
+// Send queues a result to be published with the next batch.
+func (p *Publisher) Send(result *report.Result) error {
+	message, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("error encoding result: %w", err)
+	}
+
+	p.mu.Lock()
+	if !p.started {
+		p.started = true
+		go p.run()
+	}
+	p.pending = append(p.pending, message)
+	full := len(p.pending) >= p.batch
+	p.mu.Unlock()
+
+	if full {
+		select {
+		case p.full <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// run sends the pending results whenever a batch is full or the interval
+// passes, until the publisher is closed.
+func (p *Publisher) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-p.full:
+		case <-p.stop:
+			return
+		}
+
+		err := p.flush()
+		if err != nil && p.onError != nil {
+			p.onError(err)
+		}
+	}
+}
+
+// flush sends the pending results in batches, retrying each batch which
+// fails. A batch which still fails is dropped so they don't build up while
+// the broker is unavailable.
+func (p *Publisher) flush() error {
+	p.sendMu.Lock()
+	defer p.sendMu.Unlock()
+
+	p.mu.Lock()
+	pending := p.pending
+	p.pending = nil
+	p.mu.Unlock()
+
+	var failed error
+	for len(pending) > 0 {
+		n := p.batch
+		if n > len(pending) {
+			n = len(pending)
+		}
+		batch := pending[:n]
+		pending = pending[n:]
+
+		var err error
+		wait := p.backoff
+		for attempt := 0; attempt <= publishRetries; attempt++ {
+			if attempt > 0 {
+				time.Sleep(wait)
+				wait *= 2
+			}
+			err = p.producer.publish(batch, p.now())
+			if err == nil {
+				break
+			}
+		}
+		if err != nil {
+			failed = fmt.Errorf("error publishing %d results to %s: %w", len(batch), p.url, err)
+		}
+	}
+
+	return failed
+}
+
+// Close sends any pending results and closes the connection to the broker.
+func (p *Publisher) Close() error {
+	p.mu.Lock()
+	started := p.started
+	p.mu.Unlock()
+	if started {
+		close(p.stop)
+		<-p.done
+	}
+
+	err := p.flush()
+	p.producer.close()
+	return err
+}
@@ -0,0 +1,230 @@
+//go:build publish || full
+// +build publish full
+
+package sink
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/berndhartzer/http-trace/report"
+)
+
+func TestPublishNATS(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening for TCP: %v", err)
+	}
+	defer listener.Close()
+
+	received := make(chan string, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		io.WriteString(conn, "INFO {\"server_id\":\"test\"}\r\n")
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch {
+			case line == "PING\r\n":
+				io.WriteString(conn, "PONG\r\n")
+			case strings.HasPrefix(line, "PUB "):
+				fields := strings.Fields(line)
+				size, _ := strconv.Atoi(fields[2])
+				payload := make([]byte, size+2)
+				io.ReadFull(reader, payload)
+				received <- fields[1] + " " + string(payload[:size])
+			case strings.HasPrefix(line, "CONNECT "):
+				received <- strings.TrimSpace(line)
+			}
+		}
+	}()
+
+	p, err := NewPublisher("nats://probe:secret@"+listener.Addr().String()+"/probes.results", time.Second)
+	if err != nil {
+		t.Fatalf("Error creating publisher: %v", err)
+	}
+	p.Send(testResult)
+	p.Send(testErrorResult)
+	err = p.Close()
+	if err != nil {
+		t.Fatalf("Error publishing to NATS: %v", err)
+	}
+
+	connect := <-received
+	if !strings.Contains(connect, `"user":"probe"`) || !strings.Contains(connect, `"pass":"secret"`) {
+		t.Errorf("Expected the credentials in CONNECT: got %v", connect)
+	}
+	for _, result := range []*report.Result{testResult, testErrorResult} {
+		expected, _ := json.Marshal(result)
+		if got := <-received; got != "probes.results "+string(expected) {
+			t.Errorf("Unexpected message: got\n%v\n want\n%v\n", got, "probes.results "+string(expected))
+		}
+	}
+}
+
+// fakeKafka is a single Kafka broker answering metadata and produce requests,
+// keeping the record values it is sent.
+func fakeKafka(t *testing.T, listener net.Listener, produceError int16, values chan<- string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	for {
+		var size int32
+		if binary.Read(conn, binary.BigEndian, &size) != nil {
+			return
+		}
+		raw := make([]byte, size)
+		io.ReadFull(conn, raw)
+		req := &kafkaDecoder{buf: raw}
+		apiKey, _, correlationID := req.int16(), req.int16(), req.int32()
+		req.string()
+
+		resp := &kafkaEncoder{}
+		resp.int32(correlationID)
+		switch apiKey {
+		case kafkaMetadata:
+			resp.int32(0)
+			resp.int32(1)
+			resp.int32(7)
+			resp.string(host)
+			resp.int32(int32(portNumber))
+			resp.int16(-1)
+			resp.int16(-1)
+			resp.int32(7)
+			resp.int32(1)
+			resp.int16(0)
+			resp.string("probes")
+			resp.int8(0)
+			resp.int32(1)
+			resp.int16(0)
+			resp.int32(0)
+			resp.int32(7)
+			resp.int32(0)
+			resp.int32(0)
+		case kafkaProduce:
+			req.int16()
+			req.int16()
+			req.int32()
+			req.int32()
+			topic := req.string()
+			req.int32()
+			req.int32()
+			batch := &kafkaDecoder{buf: req.take(int(req.int32()))}
+			batch.int64()
+			batch.int32()
+			batch.int32()
+			if batch.int8() != 2 {
+				t.Errorf("Expected a version 2 record batch")
+			}
+			crc := uint32(batch.int32())
+			if crc != crc32.Checksum(batch.buf, crc32c) {
+				t.Errorf("Record batch CRC doesn't match")
+			}
+			batch.take(2 + 4 + 8 + 8 + 8 + 2 + 4)
+			records := bytes.NewReader(batch.buf[4:])
+			for n := batch.int32(); n > 0; n-- {
+				binary.ReadVarint(records)
+				records.ReadByte()
+				binary.ReadVarint(records)
+				binary.ReadVarint(records)
+				binary.ReadVarint(records)
+				length, _ := binary.ReadVarint(records)
+				value := make([]byte, length)
+				records.Read(value)
+				binary.ReadVarint(records)
+				values <- topic + " " + string(value)
+			}
+
+			resp.int32(1)
+			resp.string(topic)
+			resp.int32(1)
+			resp.int32(0)
+			resp.int16(produceError)
+			resp.int64(0)
+			resp.int64(-1)
+			resp.int32(0)
+		}
+
+		out := &kafkaEncoder{}
+		out.int32(int32(resp.buf.Len()))
+		out.buf.Write(resp.buf.Bytes())
+		conn.Write(out.buf.Bytes())
+	}
+}
+
+func TestPublishKafka(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening for TCP: %v", err)
+	}
+	defer listener.Close()
+
+	values := make(chan string, 10)
+	go fakeKafka(t, listener, 0, values)
+
+	p, err := NewPublisher("kafka://"+listener.Addr().String()+"/probes", time.Second)
+	if err != nil {
+		t.Fatalf("Error creating publisher: %v", err)
+	}
+	p.Send(testResult)
+	p.Send(testErrorResult)
+	err = p.Close()
+	if err != nil {
+		t.Fatalf("Error publishing to Kafka: %v", err)
+	}
+
+	for _, result := range []*report.Result{testResult, testErrorResult} {
+		expected, _ := json.Marshal(result)
+		if got := <-values; got != "probes "+string(expected) {
+			t.Errorf("Unexpected record: got\n%v\n want\n%v\n", got, "probes "+string(expected))
+		}
+	}
+}
+
+func TestPublishRetries(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening for TCP: %v", err)
+	}
+	defer listener.Close()
+
+	values := make(chan string, 10)
+	// Not a leader for the partition
+	go fakeKafka(t, listener, 6, values)
+
+	p, err := NewPublisher("kafka://"+listener.Addr().String()+"/probes", time.Second)
+	if err != nil {
+		t.Fatalf("Error creating publisher: %v", err)
+	}
+	p.backoff = time.Millisecond
+	p.Send(testResult)
+	err = p.Close()
+	if err == nil || !strings.Contains(err.Error(), "error code 6") {
+		t.Errorf("Unexpected error: got %v, want a produce error", err)
+	}
+	if len(values) != publishRetries+1 {
+		t.Errorf("Expected the batch to be sent %d times: got %d", publishRetries+1, len(values))
+	}
+}
@@ -0,0 +1,46 @@
+// Package sink sends the result of each traced request elsewhere: to metrics
+// pipelines such as Prometheus, StatsD, InfluxDB and CloudWatch, to syslog,
+// to message queues, and to webhooks, optionally grouping failures into
+// incidents.
+package sink
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/berndhartzer/http-trace/report"
+)
+
+// Sink receives the result of each traced request, for example to forward it
+// to a metrics pipeline.
+type Sink interface {
+	Send(result *report.Result) error
+}
+
+// tags returns the dimensions of a result which metrics are tagged with.
+func tags(result *report.Result) [][2]string {
+	host := result.URL
+	if u, err := url.Parse(result.URL); err == nil {
+		host = u.Host
+	}
+
+	t := [][2]string{
+		{"host", host},
+		{"method", result.Method},
+	}
+	if result.Status != 0 {
+		t = append(t, [2]string{"status", strconv.Itoa(result.Status)})
+	}
+	return t
+}
+
+// sortedKeys returns the keys of m in a stable order.
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,385 @@
+package sink
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/berndhartzer/http-trace/report"
+)
+
+var testResult = &report.Result{
+	URL:      "https://thing.com/path",
+	Method:   http.MethodGet,
+	Status:   http.StatusOK,
+	BodySize: 512,
+	Timings: map[string]float64{
+		"dns":   0.002,
+		"total": 0.25,
+	},
+	Derived: map[string]float64{
+		"backend": 0.2,
+	},
+}
+
+var testErrorResult = &report.Result{
+	URL:    "https://thing.com/path",
+	Method: http.MethodGet,
+	Error:  `dial tcp: "refused"`,
+}
+
+func listenUDP(t *testing.T) (net.PacketConn, func() string) {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening for UDP: %v", err)
+	}
+
+	receive := func() string {
+		buf := make([]byte, 4096)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("Error receiving UDP packet: %v", err)
+		}
+		return string(buf[:n])
+	}
+
+	return conn, receive
+}
+
+type testStatsD struct {
+	result   *report.Result
+	tags     bool
+	expected string
+}
+
+func TestStatsD(t *testing.T) {
+	tests := map[string]testStatsD{
+		"will send timers for each phase": {
+			result:   testResult,
+			expected: "http_trace.dns:2|ms\nhttp_trace.total:250|ms\nhttp_trace.derived.backend:200|ms\nhttp_trace.body_size:512|g\n",
+		},
+		"will tag metrics": {
+			result:   testResult,
+			tags:     true,
+			expected: "http_trace.dns:2|ms|#host:thing.com,method:GET,status:200\nhttp_trace.total:250|ms|#host:thing.com,method:GET,status:200\nhttp_trace.derived.backend:200|ms|#host:thing.com,method:GET,status:200\nhttp_trace.body_size:512|g|#host:thing.com,method:GET,status:200\n",
+		},
+		"will count errors": {
+			result:   testErrorResult,
+			expected: "http_trace.errors:1|c\n",
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			conn, receive := listenUDP(t)
+			defer conn.Close()
+
+			s := NewStatsD(conn.LocalAddr().String(), "http_trace", cfg.tags)
+			err := s.Send(cfg.result)
+			if err != nil {
+				t.Fatalf("Error sending to statsd: %v", err)
+			}
+
+			got := receive()
+			if got != cfg.expected {
+				t.Errorf("Unexpected statsd packet: got\n%v\n want\n%v\n", got, cfg.expected)
+			}
+		})
+	}
+}
+
+type testInflux struct {
+	result   *report.Result
+	expected string
+}
+
+func TestInflux(t *testing.T) {
+	tests := map[string]testInflux{
+		"will write a line with a field for each phase": {
+			result:   testResult,
+			expected: "http_trace,host=thing.com,method=GET,status=200 dns=0.002,total=0.25,derived_backend=0.2,body_size=512i 1600000000000000000\n",
+		},
+		"will write errors as a string field": {
+			result:   testErrorResult,
+			expected: "http_trace,host=thing.com,method=GET error=\"dial tcp: \\\"refused\\\"\" 1600000000000000000\n",
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			var received, auth string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				received = string(body)
+				auth = r.Header.Get("Authorization")
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer server.Close()
+
+			i := NewInflux(server.URL+"/api/v2/write?bucket=probes", "secret", "http_trace", server.Client())
+			i.now = func() time.Time { return time.Unix(1600000000, 0) }
+
+			err := i.Send(cfg.result)
+			if err != nil {
+				t.Fatalf("Error sending to influx: %v", err)
+			}
+
+			if received != cfg.expected {
+				t.Errorf("Unexpected line protocol: got\n%v\n want\n%v\n", received, cfg.expected)
+			}
+			if auth != "Token secret" {
+				t.Errorf("Unexpected Authorization header: got %v, want Token secret", auth)
+			}
+
+			conn, receive := listenUDP(t)
+			defer conn.Close()
+
+			udp := NewInflux("udp://"+conn.LocalAddr().String(), "", "http_trace", nil)
+			udp.now = i.now
+			err = udp.Send(cfg.result)
+			if err != nil {
+				t.Fatalf("Error sending to influx over UDP: %v", err)
+			}
+
+			if got := receive(); got != cfg.expected {
+				t.Errorf("Unexpected line protocol over UDP: got\n%v\n want\n%v\n", got, cfg.expected)
+			}
+		})
+	}
+}
+
+func TestInfluxServerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	err := NewInflux(server.URL, "", "http_trace", server.Client()).Send(testResult)
+	if err == nil || !strings.Contains(err.Error(), "401 Unauthorized") {
+		t.Errorf("Unexpected error: got %v, want a 401 error", err)
+	}
+}
+
+type testSyslog struct {
+	result   *report.Result
+	expected string
+}
+
+func TestSyslog(t *testing.T) {
+	tests := map[string]testSyslog{
+		"will send the timings as structured data": {
+			result:   testResult,
+			expected: `<14>1 2020-09-13T12:26:40Z probe http-trace 42 - [http_trace@32473 url="https://thing.com/path" host="thing.com" method="GET" status="200" body_size="512" dns_ms="2.000" total_ms="250.000" derived_backend_ms="200.000"] GET https://thing.com/path 200 in 250.00ms`,
+		},
+		"will send errors with a higher severity": {
+			result:   testErrorResult,
+			expected: `<11>1 2020-09-13T12:26:40Z probe http-trace 42 - [http_trace@32473 url="https://thing.com/path" host="thing.com" method="GET" error="dial tcp: \"refused\""] GET https://thing.com/path failed: dial tcp: "refused"`,
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			conn, receive := listenUDP(t)
+			defer conn.Close()
+
+			s := NewSyslog("udp://"+conn.LocalAddr().String(), "http-trace")
+			s.hostname = "probe"
+			s.pid = 42
+			s.now = func() time.Time { return time.Unix(1600000000, 0).UTC() }
+
+			err := s.Send(cfg.result)
+			if err != nil {
+				t.Fatalf("Error sending to syslog: %v", err)
+			}
+
+			if got := receive(); got != cfg.expected {
+				t.Errorf("Unexpected syslog message: got\n%v\n want\n%v\n", got, cfg.expected)
+			}
+		})
+	}
+}
+
+func TestSyslogTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening for TCP: %v", err)
+	}
+	defer listener.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		body, _ := io.ReadAll(conn)
+		received <- string(body)
+	}()
+
+	s := NewSyslog("tcp://"+listener.Addr().String(), "http-trace")
+	err = s.Send(testResult)
+	if err != nil {
+		t.Fatalf("Error sending to syslog: %v", err)
+	}
+
+	got := <-received
+	length := strings.SplitN(got, " ", 2)[0]
+	if length != strconv.Itoa(len(got)-len(length)-1) {
+		t.Errorf("Expected the message to be framed with its length: got %q", got)
+	}
+}
+
+type testWebhook struct {
+	template     string
+	result       *report.Result
+	failuresOnly bool
+	expected     string
+}
+
+func TestWebhook(t *testing.T) {
+	os.Setenv("PAGERDUTY_ROUTING_KEY", "key")
+	defer os.Unsetenv("PAGERDUTY_ROUTING_KEY")
+
+	tests := map[string]testWebhook{
+		"will post a slack message": {
+			template: "slack",
+			result:   testResult,
+			expected: `{"text":"GET https://thing.com/path: 200 OK in 250.00ms"}`,
+		},
+		"will post errors to teams": {
+			template: "teams",
+			result:   testErrorResult,
+			expected: `{"@type":"MessageCard","@context":"https://schema.org/extensions","themeColor":"D93025","summary":"GET https://thing.com/path: error: dial tcp: \"refused\"","title":"http-trace","text":"GET https://thing.com/path: error: dial tcp: \"refused\""}`,
+		},
+		"will trigger a pagerduty alert": {
+			template: "pagerduty",
+			result:   testErrorResult,
+			expected: `{"routing_key":"key","event_action":"trigger","dedup_key":"http-trace GET https://thing.com/path","payload":{"summary":"GET https://thing.com/path: error: dial tcp: \"refused\"","source":"thing.com","severity":"error","custom_details":{"url":"https://thing.com/path","method":"GET","error":"dial tcp: \"refused\"","body_size":0}}}`,
+		},
+		"will render a custom template": {
+			template: `{"status":{{ .Status }},"total":"{{ ms (index .Timings "total") }}"}`,
+			result:   testResult,
+			expected: `{"status":200,"total":"250.00ms"}`,
+		},
+		"will skip successes when only posting failures": {
+			template:     "json",
+			result:       testResult,
+			failuresOnly: true,
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			var received, contentType string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				received = string(body)
+				contentType = r.Header.Get("Content-Type")
+			}))
+			defer server.Close()
+
+			tmpl, err := ParseWebhookTemplate(cfg.template)
+			if err != nil {
+				t.Fatalf("Error parsing webhook template: %v", err)
+			}
+			err = NewWebhook(server.URL, tmpl, cfg.failuresOnly, server.Client()).Send(cfg.result)
+			if err != nil {
+				t.Fatalf("Error sending webhook: %v", err)
+			}
+
+			if received != cfg.expected {
+				t.Errorf("Unexpected payload: got\n%v\n want\n%v\n", received, cfg.expected)
+			}
+			if cfg.expected != "" && contentType != "application/json" {
+				t.Errorf("Unexpected Content-Type: got %v, want application/json", contentType)
+			}
+		})
+	}
+}
+
+func TestIncidents(t *testing.T) {
+	now := time.Date(2026, time.October, 15, 9, 0, 0, 0, time.UTC)
+	log := &bytes.Buffer{}
+	incidents := NewIncidents(time.Hour)
+	incidents.now = func() time.Time { return now }
+	incidents.SetLog(log)
+
+	unavailable := &report.Result{URL: "https://thing.com/path", Method: http.MethodGet, Status: http.StatusServiceUnavailable}
+	steps := []struct {
+		after  time.Duration
+		result *report.Result
+		states []string
+	}{
+		{0, testResult, nil},
+		{time.Minute, unavailable, []string{report.IncidentOpen}},
+		{time.Minute, unavailable, nil},
+		{time.Hour, unavailable, []string{report.IncidentUpdate}},
+		{time.Minute, testErrorResult, []string{report.IncidentResolve, report.IncidentOpen}},
+		{time.Minute, testResult, []string{report.IncidentResolve}},
+		{time.Minute, testResult, nil},
+	}
+	for i, s := range steps {
+		now = now.Add(s.after)
+		states := []string{}
+		for _, incident := range incidents.Track(s.result) {
+			states = append(states, incident.State)
+		}
+		if strings.Join(states, ",") != strings.Join(s.states, ",") {
+			t.Errorf("Unexpected incident changes at step %d: got %v, want %v", i, states, s.states)
+		}
+	}
+
+	expected := `Incident #1 opened: GET https://thing.com/path: status 503
+Incident #1 still open after 1h1m0s and 3 failures: GET https://thing.com/path: status 503
+Incident #1 resolved after 1h2m0s and 3 failures: GET https://thing.com/path: status 503
+Incident #2 opened: GET https://thing.com/path: error: dial tcp: "refused"
+Incident #2 resolved after 1m0s and 1 failures: GET https://thing.com/path: error: dial tcp: "refused"
+`
+	if log.String() != expected {
+		t.Errorf("Unexpected incident log: got\n%v\n want\n%v\n", log.String(), expected)
+	}
+}
+
+func TestWebhookIncidents(t *testing.T) {
+	os.Setenv("PAGERDUTY_ROUTING_KEY", "key")
+	defer os.Unsetenv("PAGERDUTY_ROUTING_KEY")
+
+	received := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, string(body))
+	}))
+	defer server.Close()
+
+	tmpl, err := ParseWebhookTemplate(`{{ if firing . }}trigger{{ else }}resolve{{ end }} #{{ .Incident.ID }}: {{ summary . }}`)
+	if err != nil {
+		t.Fatalf("Error parsing webhook template: %v", err)
+	}
+	webhook := NewWebhook(server.URL, tmpl, false, server.Client())
+	webhook.SetIncidents(NewIncidents(0))
+	for _, result := range []*report.Result{testErrorResult, testErrorResult, testErrorResult, testResult} {
+		err = webhook.Send(result)
+		if err != nil {
+			t.Fatalf("Error sending webhook: %v", err)
+		}
+	}
+
+	if len(received) != 2 || !strings.HasPrefix(received[0], "trigger #1: Incident #1 opened: ") || !strings.HasPrefix(received[1], "resolve #1: Incident #1 resolved after 0s and 3 failures: ") {
+		t.Errorf("Unexpected payloads: got %q", received)
+	}
+}
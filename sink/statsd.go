@@ -0,0 +1,74 @@
+package sink
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/berndhartzer/http-trace/report"
+)
+
+// StatsD sends the timing of each phase as a StatsD timer over UDP, along with
+// a counter of failed requests.
+type StatsD struct {
+	addr   string
+	prefix string
+	tags   bool
+}
+
+// NewStatsD creates a StatsD sink sending to addr (host:port). Metric names are
+// prefixed with prefix. When tags is true the host, method and status are
+// added as DogStatsD style tags.
+func NewStatsD(addr, prefix string, tags bool) *StatsD {
+	return &StatsD{
+		addr:   addr,
+		prefix: prefix,
+		tags:   tags,
+	}
+}
+
+func (s *StatsD) Send(result *report.Result) error {
+	conn, err := net.Dial("udp", s.addr)
+	if err != nil {
+		return fmt.Errorf("error connecting to statsd: %w", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Write(s.format(result))
+	if err != nil {
+		return fmt.Errorf("error sending to statsd: %w", err)
+	}
+
+	return nil
+}
+
+func (s *StatsD) format(result *report.Result) []byte {
+	suffix := ""
+	if s.tags {
+		t := []string{}
+		for _, tag := range tags(result) {
+			t = append(t, tag[0]+":"+strings.ReplaceAll(tag[1], ",", "_"))
+		}
+		suffix = "|#" + strings.Join(t, ",")
+	}
+
+	b := &bytes.Buffer{}
+	if result.Error != "" {
+		fmt.Fprintf(b, "%s.errors:1|c%s\n", s.prefix, suffix)
+		return b.Bytes()
+	}
+
+	for _, name := range sortedKeys(result.Timings) {
+		millis := result.Timings[name] * 1000
+		fmt.Fprintf(b, "%s.%s:%s|ms%s\n", s.prefix, name, strconv.FormatFloat(millis, 'f', -1, 64), suffix)
+	}
+	for _, name := range sortedKeys(result.Derived) {
+		millis := result.Derived[name] * 1000
+		fmt.Fprintf(b, "%s.derived.%s:%s|ms%s\n", s.prefix, name, strconv.FormatFloat(millis, 'f', -1, 64), suffix)
+	}
+	fmt.Fprintf(b, "%s.body_size:%d|g%s\n", s.prefix, result.BodySize, suffix)
+
+	return b.Bytes()
+}
@@ -0,0 +1,152 @@
+package sink
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/berndhartzer/http-trace/report"
+)
+
+// Syslog facility and severities, from RFC 5424.
+const (
+	syslogFacilityUser = 1
+	syslogError        = 3
+	syslogWarning      = 4
+	syslogInfo         = 6
+)
+
+// syslogSDID identifies the structured data element holding the result. 32473
+// is the private enterprise number reserved for documentation and examples.
+const syslogSDID = "http_trace@32473"
+
+// localSyslogSockets are where the local syslog daemon listens on common
+// systems.
+var localSyslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// Syslog sends each result as an RFC 5424 syslog message, with the timings in
+// structured data, to the local syslog daemon or a remote server.
+type Syslog struct {
+	addr     string
+	appName  string
+	hostname string
+	pid      int
+	now      func() time.Time
+}
+
+// NewSyslog creates a Syslog sink. addr is "local" for the local syslog
+// daemon, or udp://host:port, tcp://host:port or host:port (UDP) for a remote
+// server. Messages are tagged with appName.
+func NewSyslog(addr, appName string) *Syslog {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	return &Syslog{
+		addr:     addr,
+		appName:  appName,
+		hostname: hostname,
+		pid:      os.Getpid(),
+		now:      time.Now,
+	}
+}
+
+func (s *Syslog) Send(result *report.Result) error {
+	conn, framed, err := s.dial()
+	if err != nil {
+		return fmt.Errorf("error connecting to syslog: %w", err)
+	}
+	defer conn.Close()
+
+	msg := s.format(result)
+	if framed {
+		// Octet counting framing for streams, from RFC 6587
+		msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	}
+
+	_, err = conn.Write(msg)
+	if err != nil {
+		return fmt.Errorf("error sending to syslog: %w", err)
+	}
+
+	return nil
+}
+
+// dial connects to the syslog server, reporting whether it is a stream which
+// needs each message to be framed.
+func (s *Syslog) dial() (net.Conn, bool, error) {
+	if s.addr == "local" {
+		for _, path := range localSyslogSockets {
+			conn, err := net.Dial("unixgram", path)
+			if err == nil {
+				return conn, false, nil
+			}
+		}
+		return nil, false, fmt.Errorf("no local syslog daemon listening on %s", strings.Join(localSyslogSockets, ", "))
+	}
+
+	network, host := "udp", s.addr
+	if strings.Contains(s.addr, "://") {
+		u, err := url.Parse(s.addr)
+		if err != nil {
+			return nil, false, err
+		}
+		if u.Scheme != "udp" && u.Scheme != "tcp" {
+			return nil, false, fmt.Errorf("unsupported syslog address %q, expected udp:// or tcp://", s.addr)
+		}
+		network, host = u.Scheme, u.Host
+	}
+
+	conn, err := net.Dial(network, host)
+	return conn, network == "tcp", err
+}
+
+func (s *Syslog) format(result *report.Result) []byte {
+	severity := syslogInfo
+	msg := fmt.Sprintf("%s %s %d in %.2fms", result.Method, result.URL, result.Status, result.Timings["total"]*1000)
+	switch {
+	case result.Error != "":
+		severity = syslogError
+		msg = fmt.Sprintf("%s %s failed: %s", result.Method, result.URL, result.Error)
+	case result.Status >= 400 || len(result.Warnings) > 0:
+		severity = syslogWarning
+	}
+	for _, w := range result.Warnings {
+		msg += "; warning: " + w
+	}
+
+	params := [][2]string{{"url", result.URL}}
+	params = append(params, tags(result)...)
+	if result.Error != "" {
+		params = append(params, [2]string{"error", result.Error})
+	} else {
+		params = append(params, [2]string{"body_size", strconv.FormatInt(result.BodySize, 10)})
+		for _, name := range sortedKeys(result.Timings) {
+			params = append(params, [2]string{name + "_ms", strconv.FormatFloat(result.Timings[name]*1000, 'f', 3, 64)})
+		}
+		for _, name := range sortedKeys(result.Derived) {
+			params = append(params, [2]string{"derived_" + name + "_ms", strconv.FormatFloat(result.Derived[name]*1000, 'f', 3, 64)})
+		}
+	}
+
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "<%d>1 %s %s %s %d - [%s", syslogFacilityUser*8+severity, s.now().Format(time.RFC3339Nano), s.hostname, s.appName, s.pid, syslogSDID)
+	for _, p := range params {
+		fmt.Fprintf(b, ` %s="%s"`, p[0], escapeSDParam(p[1]))
+	}
+	fmt.Fprintf(b, "] %s", msg)
+
+	return b.Bytes()
+}
+
+// escapeSDParam escapes the characters which are special in a structured data
+// parameter value.
+func escapeSDParam(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
@@ -0,0 +1,170 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/berndhartzer/http-trace/report"
+)
+
+// webhookTemplates are the built in payloads of a Webhook, for the incoming
+// webhooks of chat services and for alerting.
+var webhookTemplates = map[string]string{
+	"json":  `{{ json . }}`,
+	"slack": `{"text":{{ json (summary .) }}}`,
+	"teams": `{"@type":"MessageCard","@context":"https://schema.org/extensions","themeColor":"{{ if firing . }}D93025{{ else }}1E8E3E{{ end }}",` +
+		`"summary":{{ json (summary .) }},"title":"http-trace","text":{{ json (summary .) }}}`,
+	// Events API v2: a failure triggers an alert, which the next success
+	// resolves as they share the dedup key, or an incident is triggered when
+	// opened and resolved when resolved
+	"pagerduty": `{"routing_key":{{ json (env "PAGERDUTY_ROUTING_KEY") }},"event_action":"{{ if firing . }}trigger{{ else }}resolve{{ end }}",` +
+		`"dedup_key":{{ json (print "http-trace " .Method " " .URL) }},` +
+		`"payload":{"summary":{{ json (summary .) }},"source":{{ json (host .) }},"severity":"error","custom_details":{{ json . }}}}`,
+}
+
+// webhookFuncs are the functions available to payload templates.
+var webhookFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		raw, err := json.Marshal(v)
+		return string(raw), err
+	},
+	"summary": summary,
+	"failed":  failed,
+	"firing":  firing,
+	"host": func(result *report.Result) string {
+		if u, err := url.Parse(result.URL); err == nil {
+			return u.Host
+		}
+		return result.URL
+	},
+	"ms": func(seconds float64) string {
+		return fmt.Sprintf("%.2fms", seconds*1000)
+	},
+	"env": os.Getenv,
+}
+
+// Webhook posts results to a URL, such as the incoming webhook of a chat
+// service, as the payload its template renders.
+type Webhook struct {
+	url          string
+	payload      *template.Template
+	failuresOnly bool
+	incidents    *Incidents
+	client       *http.Client
+}
+
+// NewWebhook creates a Webhook sink posting to webhookURL. With failuresOnly
+// set only failed results are posted.
+func NewWebhook(webhookURL string, payload *template.Template, failuresOnly bool, client *http.Client) *Webhook {
+	return &Webhook{
+		url:          webhookURL,
+		payload:      payload,
+		failuresOnly: failuresOnly,
+		client:       client,
+	}
+}
+
+// ParseWebhookTemplate returns the payload template named name, one of json,
+// slack, teams and pagerduty, or otherwise parses name as a template over the
+// Result.
+func ParseWebhookTemplate(name string) (*template.Template, error) {
+	text, ok := webhookTemplates[name]
+	if !ok {
+		text = name
+	}
+	tmpl, err := template.New("payload").Funcs(webhookFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing webhook template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// SetIncidents groups failures into incidents, posting a result only when
+// an incident is opened, updated or resolved, with the incident set in it.
+func (w *Webhook) SetIncidents(incidents *Incidents) {
+	w.incidents = incidents
+}
+
+func (w *Webhook) Send(result *report.Result) error {
+	if w.incidents != nil {
+		for _, incident := range w.incidents.Track(result) {
+			notified := *result
+			notified.Incident = incident
+			err := w.post(&notified)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if w.failuresOnly && !failed(result) {
+		return nil
+	}
+	return w.post(result)
+}
+
+// post posts the payload of result.
+func (w *Webhook) post(result *report.Result) error {
+	body := &bytes.Buffer{}
+	err := w.payload.Execute(body, result)
+	if err != nil {
+		return fmt.Errorf("error rendering webhook payload: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.url, body)
+	if err != nil {
+		return fmt.Errorf("error creating webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("error sending webhook: server responded %s", resp.Status)
+	}
+
+	return nil
+}
+
+// failed reports whether the request of result failed: it couldn't be sent,
+// the server answered with an error status, or an assertion failed.
+func failed(result *report.Result) bool {
+	return result.Error != "" || result.Status >= 400 || len(result.FailedAssertions()) > 0
+}
+
+// firing reports whether an alert for result should be raised rather than
+// resolved: its incident is open, or without incidents the request failed.
+func firing(result *report.Result) bool {
+	if result.Incident != nil {
+		return result.Incident.State != report.IncidentResolve
+	}
+	return failed(result)
+}
+
+// summary describes result in a line, such as
+// GET https://example.com: 503 Service Unavailable in 120.50ms, or its
+// incident when it has one.
+func summary(result *report.Result) string {
+	if result.Incident != nil {
+		return incidentSummary(result.Incident, result)
+	}
+	prefix := fmt.Sprintf("%s %s: ", result.Method, result.URL)
+	if result.Error != "" {
+		return prefix + "error: " + result.Error
+	}
+	s := fmt.Sprintf("%s%d %s in %.2fms", prefix, result.Status, http.StatusText(result.Status), result.Timings["total"]*1000)
+	if assertions := result.FailedAssertions(); len(assertions) > 0 {
+		s += ", assertion failed: " + strings.Join(assertions, ", ")
+	}
+	return s
+}
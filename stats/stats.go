@@ -0,0 +1,225 @@
+// Package stats has the statistics http-trace summarises and compares
+// repeated requests with: means, percentiles and their confidence intervals,
+// and the Mann-Whitney U test and effect sizes to compare two samples.
+package stats
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Mean returns the arithmetic mean of xs, or 0 if it is empty.
+func Mean(xs []float64) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+
+	sum := 0.0
+	for _, x := range xs {
+		sum += x
+	}
+	return sum / float64(len(xs))
+}
+
+// Percentile returns the p-th percentile (0 to 100) of xs, interpolating
+// linearly between the closest ranks. It returns 0 if xs is empty.
+func Percentile(xs []float64, p float64) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+
+	sorted := append([]float64{}, xs...)
+	sort.Float64s(sorted)
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower < 0 {
+		return sorted[0]
+	}
+	if upper >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[lower] + (rank-float64(lower))*(sorted[upper]-sorted[lower])
+}
+
+// Median returns the 50th percentile of xs.
+func Median(xs []float64) float64 {
+	return Percentile(xs, 50)
+}
+
+// MannWhitney compares two independent samples with the Mann-Whitney U test,
+// which makes no assumption about the shape of the distributions and so suits
+// latencies. It returns U for a and the two sided p-value of the samples
+// coming from the same distribution, using the normal approximation with a
+// correction for ties.
+func MannWhitney(a, b []float64) (float64, float64) {
+	n1, n2 := float64(len(a)), float64(len(b))
+	if n1 == 0 || n2 == 0 {
+		return 0, 1
+	}
+
+	type value struct {
+		x     float64
+		fromA bool
+	}
+	values := []value{}
+	for _, x := range a {
+		values = append(values, value{x, true})
+	}
+	for _, x := range b {
+		values = append(values, value{x, false})
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].x < values[j].x })
+
+	// Tied values share the mean of their ranks.
+	rankSumA := 0.0
+	tieCorrection := 0.0
+	for i := 0; i < len(values); {
+		j := i
+		for j < len(values) && values[j].x == values[i].x {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if values[k].fromA {
+				rankSumA += rank
+			}
+		}
+		ties := float64(j - i)
+		tieCorrection += ties*ties*ties - ties
+		i = j
+	}
+
+	u := rankSumA - n1*(n1+1)/2
+	n := n1 + n2
+	mean := n1 * n2 / 2
+	variance := n1 * n2 / 12 * ((n + 1) - tieCorrection/(n*(n-1)))
+	if variance <= 0 {
+		return u, 1
+	}
+
+	z := (math.Abs(u-mean) - 0.5) / math.Sqrt(variance)
+	if z < 0 {
+		z = 0
+	}
+	return u, math.Erfc(z / math.Sqrt2)
+}
+
+// CliffsDelta returns the effect size of b against a as Cliff's delta: the
+// probability of a value of b being larger than one of a, less that of it
+// being smaller, from -1 (b always smaller) to 1 (b always larger).
+func CliffsDelta(a, b []float64) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	sorted := append([]float64{}, a...)
+	sort.Float64s(sorted)
+	dominance := 0
+	for _, x := range b {
+		smaller := sort.SearchFloat64s(sorted, x)
+		larger := len(sorted) - sort.Search(len(sorted), func(i int) bool { return sorted[i] > x })
+		dominance += smaller - larger
+	}
+	return float64(dominance) / float64(len(a)*len(b))
+}
+
+// EffectSize describes the magnitude of a Cliff's delta with the thresholds
+// of Romano et al.: negligible, small, medium or large.
+func EffectSize(delta float64) string {
+	switch d := math.Abs(delta); {
+	case d < 0.147:
+		return "negligible"
+	case d < 0.33:
+		return "small"
+	case d < 0.474:
+		return "medium"
+	default:
+		return "large"
+	}
+}
+
+// BootstrapMedianDiff returns a confidence interval at the given level (such
+// as 0.95) for the difference between the medians of b and a, from the
+// percentiles of the differences between resamples of them drawn with rng.
+func BootstrapMedianDiff(a, b []float64, confidence float64, resamples int, rng *rand.Rand) (lower, upper float64) {
+	if len(a) == 0 || len(b) == 0 || resamples < 1 {
+		return 0, 0
+	}
+
+	resample := func(xs, into []float64) []float64 {
+		for i := range into {
+			into[i] = xs[rng.Intn(len(xs))]
+		}
+		return into
+	}
+	sampleA, sampleB := make([]float64, len(a)), make([]float64, len(b))
+	diffs := make([]float64, resamples)
+	for i := range diffs {
+		diffs[i] = Median(resample(b, sampleB)) - Median(resample(a, sampleA))
+	}
+	tail := (1 - confidence) / 2 * 100
+	return Percentile(diffs, tail), Percentile(diffs, 100-tail)
+}
+
+// PercentileCI returns a distribution free confidence interval for the p-th
+// percentile of xs at the given confidence level (such as 0.95), taken
+// between two of the sorted values. ok is false when xs is too small for the
+// interval to be bounded by the values seen.
+func PercentileCI(xs []float64, p, confidence float64) (lower, upper float64, ok bool) {
+	n := len(xs)
+	l, u := percentileCIRanks(n, p, confidence)
+	if l < 1 || u > n {
+		return 0, 0, false
+	}
+
+	sorted := append([]float64{}, xs...)
+	sort.Float64s(sorted)
+	return sorted[l-1], sorted[u-1], true
+}
+
+// percentileCIRanks returns the 1-based ranks of the sorted values bounding
+// the confidence interval for the p-th percentile of n values, using the
+// normal approximation to the binomial distribution.
+func percentileCIRanks(n int, p, confidence float64) (int, int) {
+	q := p / 100
+	z := math.Sqrt2 * math.Erfinv(confidence)
+	spread := z * math.Sqrt(float64(n)*q*(1-q))
+	return int(math.Floor(float64(n)*q - spread)), int(math.Ceil(float64(n)*q + spread))
+}
+
+// maxSamples caps the number of samples SamplesNeeded will suggest.
+const maxSamples = 1000000
+
+// SamplesNeeded estimates how many samples are needed for the confidence
+// interval of the p-th percentile to be within ±precision (such as 0.05) of
+// the estimate, extrapolating from xs on the basis that the width of the
+// interval shrinks with the square root of the number of samples. It is at
+// least the number needed for the interval to be bounded at all.
+func SamplesNeeded(xs []float64, p, confidence, precision float64) int {
+	bounded := 1
+	for ; bounded < maxSamples; bounded++ {
+		l, u := percentileCIRanks(bounded, p, confidence)
+		if l >= 1 && u <= bounded {
+			break
+		}
+	}
+
+	lower, upper, ok := PercentileCI(xs, p, confidence)
+	estimate := Percentile(xs, p)
+	if !ok || estimate <= 0 {
+		return bounded
+	}
+
+	relative := (upper - lower) / 2 / estimate
+	needed := int(math.Ceil(float64(len(xs)) * (relative / precision) * (relative / precision)))
+	if needed < bounded {
+		needed = bounded
+	}
+	if needed > maxSamples {
+		needed = maxSamples
+	}
+	return needed
+}
@@ -0,0 +1,175 @@
+package stats
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+type testPercentile struct {
+	values   []float64
+	p        float64
+	expected float64
+}
+
+func TestPercentile(t *testing.T) {
+	tests := map[string]testPercentile{
+		"will return the median of an odd number of values": {
+			values:   []float64{5, 1, 3},
+			p:        50,
+			expected: 3,
+		},
+		"will interpolate between values": {
+			values:   []float64{1, 2, 3, 4},
+			p:        50,
+			expected: 2.5,
+		},
+		"will return the largest value for p100": {
+			values:   []float64{1, 9, 3},
+			p:        100,
+			expected: 9,
+		},
+		"will return zero for no values": {
+			values:   []float64{},
+			p:        90,
+			expected: 0,
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			got := Percentile(cfg.values, cfg.p)
+			if got != cfg.expected {
+				t.Errorf("Unexpected percentile: got %v, want %v", got, cfg.expected)
+			}
+		})
+	}
+}
+
+func TestMannWhitney(t *testing.T) {
+	u, p := MannWhitney([]float64{1, 2, 3, 4, 5}, []float64{6, 7, 8, 9, 10})
+	if u != 0 {
+		t.Errorf("Unexpected U: got %v, want 0", u)
+	}
+	if math.Abs(p-0.01219) > 0.0001 {
+		t.Errorf("Unexpected p-value: got %v, want 0.01219", p)
+	}
+
+	_, p = MannWhitney([]float64{1, 2, 3}, []float64{1, 2, 3})
+	if p != 1 {
+		t.Errorf("Unexpected p-value for identical samples: got %v, want 1", p)
+	}
+
+	_, p = MannWhitney([]float64{1}, []float64{})
+	if p != 1 {
+		t.Errorf("Unexpected p-value for an empty sample: got %v, want 1", p)
+	}
+}
+
+func TestPercentileCI(t *testing.T) {
+	xs := []float64{}
+	for i := 1; i <= 100; i++ {
+		xs = append(xs, float64(i))
+	}
+
+	lower, upper, ok := PercentileCI(xs, 50, 0.95)
+	if !ok || lower != 40 || upper != 60 {
+		t.Errorf("Unexpected median interval: got [%v, %v] (%v), want [40, 60]", lower, upper, ok)
+	}
+
+	_, _, ok = PercentileCI(xs[:10], 99, 0.95)
+	if ok {
+		t.Errorf("Expected the p99 interval of 10 values to be unbounded")
+	}
+}
+
+func TestSamplesNeeded(t *testing.T) {
+	xs := []float64{}
+	for i := 1; i <= 100; i++ {
+		xs = append(xs, 100+float64(i%10))
+	}
+
+	needed := SamplesNeeded(xs, 50, 0.95, 0.05)
+	if needed > len(xs) {
+		t.Errorf("Expected a tight distribution to need no more samples: got %v", needed)
+	}
+
+	needed = SamplesNeeded(xs[:10], 99, 0.95, 0.05)
+	if needed < 100 {
+		t.Errorf("Expected p99 to need at least 100 samples: got %v", needed)
+	}
+
+	spread := []float64{}
+	for i := 1; i <= 20; i++ {
+		spread = append(spread, float64(i*i))
+	}
+	needed = SamplesNeeded(spread, 50, 0.95, 0.05)
+	if needed <= len(spread) {
+		t.Errorf("Expected a wide distribution to need more samples: got %v", needed)
+	}
+}
+
+func TestCliffsDelta(t *testing.T) {
+	tests := map[string]struct {
+		a, b     []float64
+		expected float64
+		size     string
+	}{
+		"will be 1 when b is always larger": {
+			a:        []float64{1, 2, 3},
+			b:        []float64{4, 5},
+			expected: 1,
+			size:     "large",
+		},
+		"will be -1 when b is always smaller": {
+			a:        []float64{4, 5},
+			b:        []float64{1, 2, 3},
+			expected: -1,
+			size:     "large",
+		},
+		"will count ties as neither": {
+			a:        []float64{1, 2, 3},
+			b:        []float64{1, 2, 3},
+			expected: 0,
+			size:     "negligible",
+		},
+		"will be the balance of larger and smaller pairs": {
+			a:        []float64{1, 2, 3, 4},
+			b:        []float64{2, 3, 4, 5},
+			expected: 0.4375,
+			size:     "medium",
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			got := CliffsDelta(cfg.a, cfg.b)
+			if got != cfg.expected {
+				t.Errorf("Unexpected delta: got %v, want %v", got, cfg.expected)
+			}
+			if size := EffectSize(got); size != cfg.size {
+				t.Errorf("Unexpected effect size: got %v, want %v", size, cfg.size)
+			}
+		})
+	}
+}
+
+func TestBootstrapMedianDiff(t *testing.T) {
+	a, b := []float64{}, []float64{}
+	for i := 0; i < 50; i++ {
+		a = append(a, 100+float64(i%10))
+		b = append(b, 120+float64(i%10))
+	}
+
+	lower, upper := BootstrapMedianDiff(a, b, 0.95, 1000, rand.New(rand.NewSource(1)))
+	if lower > 20 || upper < 20 || lower < 15 || upper > 25 {
+		t.Errorf("Unexpected interval: got [%v, %v], want it around 20", lower, upper)
+	}
+
+	lower, upper = BootstrapMedianDiff(a, []float64{}, 0.95, 1000, rand.New(rand.NewSource(1)))
+	if lower != 0 || upper != 0 {
+		t.Errorf("Unexpected interval for an empty sample: got [%v, %v]", lower, upper)
+	}
+}
@@ -0,0 +1,66 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DNSQuery is a query sent to a DNS server while resolving the host of the
+// request. A lookup can take several, such as for A and AAAA records, for
+// the names with each search domain appended, or when a server doesn't
+// answer, so they show why resolving took as long as it did.
+type DNSQuery struct {
+	Server   string
+	Name     string        // Name queried, including any search domain
+	Type     string        // Type of records queried, such as A or AAAA
+	Start    time.Duration // Offset from the start of the request
+	Duration time.Duration
+	DNSAnswer
+}
+
+// DNSAnswer is the outcome of a DNSQuery, given once it was answered or given
+// up on.
+type DNSAnswer struct {
+	Outcome      string        // Response code, such as NOERROR or NXDOMAIN, or timeout if none came
+	Answers      int           // Records in the answer
+	CNAMEs       int           // CNAME records in the answer, followed from the name queried to its records
+	Connect      time.Duration // Of a connection to the server made for the query, such as to an encrypted resolver
+	TLSHandshake time.Duration // Of the connection made for the query, with DNS over TLS or HTTPS
+}
+
+type dnsQueriesKey struct{}
+
+// dnsQueries records the DNS queries made for a trace.
+type dnsQueries struct {
+	now func() time.Duration
+	add func(q DNSQuery)
+}
+
+// StartDNSQuery records that a query for the qtype records of name was sent
+// to server for the request of ctx, returning the function to call with the
+// answer once it was answered or given up on. Nothing is recorded if ctx
+// isn't that of a traced request. It is for resolvers which send the queries
+// themselves, as the httptrace hooks only cover the whole lookup.
+func StartDNSQuery(ctx context.Context, server, name, qtype string) func(answer DNSAnswer) {
+	queries, ok := ctx.Value(dnsQueriesKey{}).(*dnsQueries)
+	if !ok {
+		return func(DNSAnswer) {}
+	}
+
+	start := queries.now()
+	return func(answer DNSAnswer) {
+		queries.add(DNSQuery{
+			Server:    server,
+			Name:      name,
+			Type:      qtype,
+			Start:     start,
+			Duration:  queries.now() - start,
+			DNSAnswer: answer,
+		})
+	}
+}
+
+func dnsQueryDetail(q DNSQuery) string {
+	return fmt.Sprintf("%s %s %s from %s, %d in answer", q.Type, q.Name, q.Outcome, q.Server, q.Answers)
+}
@@ -0,0 +1,121 @@
+package trace_test
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/berndhartzer/http-trace/trace"
+)
+
+func Example() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "hello world")
+	}))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		panic(err)
+	}
+	t := trace.New(http.DefaultClient, req)
+	err = t.Execute()
+	if err != nil {
+		panic(err)
+	}
+
+	timings := t.GetTimings()
+	fmt.Println(t.GetResponse().Status, t.GetResponseBody())
+	fmt.Println(timings.TotalRequestDuration > 0, timings.TotalRequestDuration >= timings.ResponseDelayDuration)
+	// Output:
+	// 200 OK hello world
+	// true true
+}
+
+func ExampleTrace_SetMaxBodyCapture() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "a long response body")
+	}))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		panic(err)
+	}
+	t := trace.New(http.DefaultClient, req)
+	t.SetMaxBodyCapture(6)
+	err = t.Execute()
+	if err != nil {
+		panic(err)
+	}
+
+	// The whole body is read and timed, but only the start of it is kept
+	fmt.Printf("%q of %d bytes\n", t.GetResponseBody(), t.GetResponseBodySize())
+	// Output:
+	// "a long" of 20 bytes
+}
+
+func ExampleTrace_GetResponseBodyReader() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "line one\nline two\n")
+	}))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		panic(err)
+	}
+	t := trace.New(http.DefaultClient, req)
+	t.SetStreamBody(true)
+	err = t.Execute()
+	if err != nil {
+		panic(err)
+	}
+
+	// The body is read as it arrives, and the request finished when it is
+	// closed
+	body := t.GetResponseBodyReader()
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		fmt.Println(scanner.Text())
+	}
+	err = body.Close()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(t.GetResponseBodySize(), t.GetTimings().TotalRequestDuration > 0)
+	// Output:
+	// line one
+	// line two
+	// 18 true
+}
+
+func ExampleTrace_GetTimeline() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "hello world")
+	}))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		panic(err)
+	}
+	t := trace.New(http.DefaultClient, req)
+	err = t.Execute()
+	if err != nil {
+		panic(err)
+	}
+
+	// The offsets differ from run to run, so only the phases are printed,
+	// such as a waterfall would draw as bars from Start to End
+	for _, span := range t.GetTimeline().Spans {
+		fmt.Println(span.Phase)
+	}
+	// Output:
+	// connection
+	// connect
+	// request_write
+	// response_delay
+	// response_read
+}
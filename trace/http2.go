@@ -0,0 +1,48 @@
+package trace
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// http2Errors match the messages of the errors the HTTP/2 transport of
+// net/http fails with, whose types aren't exported, and the events they are
+// reported as: a stream reset with RST_STREAM, a GOAWAY closing the
+// connection, or the connection failing with an HTTP/2 error code. They are
+// anchored to the whole format of each message, so an error which merely
+// mentions a stream isn't taken for one.
+var http2Errors = []struct {
+	pattern *regexp.Regexp
+	event   string
+}{
+	{regexp.MustCompile(`^stream error: stream ID \d+; ([A-Z_]+|unknown error code 0x[0-9a-f]+)(; .*)?$`), "HTTP2StreamReset"},
+	{regexp.MustCompile(`^http2: server sent GOAWAY and closed the connection; LastStreamID=\d+, ErrCode=`), "HTTP2GoAway"},
+	{regexp.MustCompile(`^http2: Transport received Server's graceful shutdown GOAWAY$`), "HTTP2GoAway"},
+	{regexp.MustCompile(`^connection error: ([A-Z_]+|unknown error code 0x[0-9a-f]+)$`), "HTTP2ConnectionError"},
+}
+
+// http2Event returns the event an HTTP/2 failure is reported as, and its
+// detail, such as "stream ID 1; INTERNAL_ERROR; received from peer" for a
+// stream reset by the server. ok is false if err isn't an HTTP/2 failure.
+func http2Event(err error) (name, detail string, ok bool) {
+	// The error may be wrapped, such as in a url.Error
+	for ; err != nil; err = errors.Unwrap(err) {
+		msg := err.Error()
+		for _, e := range http2Errors {
+			if e.pattern.MatchString(msg) {
+				return e.event, strings.TrimPrefix(strings.TrimPrefix(msg, "http2: "), "stream error: "), true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// tlsDetail describes a TLS handshake: the version and the protocol agreed
+// with ALPN, such as "TLS 1.3, h2" when HTTP/2 was negotiated.
+func tlsDetail(version uint16, protocol string) string {
+	if protocol == "" {
+		return tlsVersion(version)
+	}
+	return tlsVersion(version) + ", " + protocol
+}
@@ -0,0 +1,31 @@
+package trace
+
+import (
+	"errors"
+	"net"
+)
+
+// LongPoll is how a response the server held open was received, as for a
+// long poll or hanging GET.
+type LongPoll struct {
+	HeldOpen bool    // Whether the response was still open when the request timed out
+	Reads    []Chunk // Each read of the body, such as of the keep-alive bytes sent while holding it
+}
+
+// SetLongPoll expects the server to hold the response open, as for a long poll
+// or hanging GET. Timing out while reading the body then ends the response
+// rather than being an error, and each read of the body is recorded.
+func (t *Trace) SetLongPoll(longPoll bool) {
+	t.longPoll = longPoll
+}
+
+// GetLongPoll returns how the held open response was received, or nil if
+// SetLongPoll wasn't called or there was no response.
+func (t *Trace) GetLongPoll() *LongPoll {
+	return t.longPollResult
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
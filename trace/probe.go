@@ -0,0 +1,146 @@
+package trace
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+)
+
+// The phases a probe made with WithProbe goes up to.
+const (
+	ProbeDNS     = "dns"
+	ProbeConnect = "connect"
+	ProbeTLS     = "tls"
+)
+
+// ProbeConfig is how a probe resolves and connects to the host. The zero
+// value resolves with net.DefaultResolver and dials with a net.Dialer.
+type ProbeConfig struct {
+	Resolver  *net.Resolver
+	Dial      func(ctx context.Context, network, addr string) (net.Conn, error)
+	TLSConfig *tls.Config // For ProbeTLS, its ServerName defaults to the host
+}
+
+// WithProbe makes Execute only time the phases of making a connection to
+// the host of the request, up to and including phase, without sending the
+// request: resolving the host for ProbeDNS, then connecting to it for
+// ProbeConnect, then the TLS handshake for ProbeTLS. The phases are timed by
+// the same hooks as for a request, so the timings, events, dial attempts and
+// DNS queries are kept as they are for one, and the connection is closed once
+// made. GetResponse returns a response without a status or body, with the
+// connection state of a TLS probe.
+func WithProbe(phase string, cfg ProbeConfig) Option {
+	return func(t *Trace) {
+		t.probe = phase
+		WithTransport(&probeTransport{phase: phase, cfg: cfg})(t)
+	}
+}
+
+// probeTransport makes the connection for a request, calling the hooks of
+// its trace as an http.Transport would, and answers it without sending it.
+type probeTransport struct {
+	phase string
+	cfg   ProbeConfig
+}
+
+func (p *probeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	hooks := httptrace.ContextClientTrace(ctx)
+	if hooks == nil {
+		hooks = &httptrace.ClientTrace{}
+	}
+	host := req.URL.Hostname()
+	port := req.URL.Port()
+	if port == "" {
+		port = "80"
+		if req.URL.Scheme == "https" {
+			port = "443"
+		}
+	}
+	addr := net.JoinHostPort(host, port)
+	resp := &http.Response{Proto: "probe", Header: http.Header{}, Body: http.NoBody, Request: req}
+
+	if hooks.GetConn != nil {
+		hooks.GetConn(addr)
+	}
+	if p.phase == ProbeDNS {
+		// The resolver calls the DNS hooks carried by the context, but also
+		// the connect hooks for its connections to the DNS servers, which
+		// a net.Dialer leaves out as this does
+		resolver := p.cfg.Resolver
+		if resolver == nil {
+			resolver = net.DefaultResolver
+		}
+		lookupCtx := lookupContext{
+			Context: ctx,
+			hooks:   httptrace.WithClientTrace(context.Background(), &httptrace.ClientTrace{DNSStart: hooks.DNSStart, DNSDone: hooks.DNSDone}),
+		}
+		_, err := resolver.LookupIPAddr(lookupCtx, host)
+		if err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+
+	// As does the dialer, with the connect hooks
+	dial := p.cfg.Dial
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	conn, err := dial(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if p.phase == ProbeTLS {
+		config := &tls.Config{}
+		if p.cfg.TLSConfig != nil {
+			config = p.cfg.TLSConfig.Clone()
+		}
+		if config.ServerName == "" {
+			config.ServerName = host
+		}
+		tlsConn := tls.Client(conn, config)
+		if deadline, ok := ctx.Deadline(); ok {
+			tlsConn.SetDeadline(deadline)
+		}
+		if hooks.TLSHandshakeStart != nil {
+			hooks.TLSHandshakeStart()
+		}
+		err = tlsConn.Handshake()
+		state := tlsConn.ConnectionState()
+		if hooks.TLSHandshakeDone != nil {
+			hooks.TLSHandshakeDone(state, err)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error in TLS handshake: %w", err)
+		}
+		tlsConn.SetDeadline(time.Time{})
+		resp.TLS = &state
+		conn = tlsConn
+	}
+
+	if hooks.GotConn != nil {
+		hooks.GotConn(httptrace.GotConnInfo{Conn: conn})
+	}
+	return resp, nil
+}
+
+// lookupContext is the context of a request with the hooks of hooks in
+// place of its own, for a lookup which should only call the DNS hooks.
+type lookupContext struct {
+	context.Context
+	hooks context.Context
+}
+
+func (c lookupContext) Value(key interface{}) interface{} {
+	if v := c.hooks.Value(key); v != nil {
+		return v
+	}
+	return c.Context.Value(key)
+}
@@ -0,0 +1,56 @@
+package trace
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Progress is how much of the response body has been read, while it is read.
+type Progress struct {
+	BodyBytes int64         // Read so far
+	BodyTotal int64         // The Content-Length of the body, or -1 if it isn't known
+	Elapsed   time.Duration // Since the first byte of the response
+}
+
+// SetProgressHandler calls handler every interval while the response body is
+// read, with how much of it has been read, such as to draw a progress bar so
+// a large download doesn't look hung. Unlike statuses, the progress isn't
+// kept, and handler isn't called once Execute has returned.
+func (t *Trace) SetProgressHandler(interval time.Duration, handler func(p Progress)) {
+	t.progressInterval = interval
+	t.progressHandler = handler
+}
+
+// startProgress calls the progress handler every interval with how much of
+// body has been read, until the returned function is called.
+func (t *Trace) startProgress(body *countingReader, total int64, now func() time.Duration) func() {
+	if t.progressInterval <= 0 || t.progressHandler == nil {
+		return func() {}
+	}
+
+	ticker := time.NewTicker(t.progressInterval)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				ticker.Stop()
+				return
+			case <-ticker.C:
+			}
+
+			t.progressHandler(Progress{
+				BodyBytes: atomic.LoadInt64(&body.n),
+				BodyTotal: total,
+				Elapsed:   now() - t.timings.responseStart,
+			})
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+	}
+}
@@ -0,0 +1,80 @@
+package trace
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// Stall is how steadily the response body arrived, when reading it is aborted
+// after a stall: whether the server stalled mid-body, or the body was just
+// large and kept arriving.
+type Stall struct {
+	Timeout    time.Duration // Without any bytes of the body, after which reading it was aborted
+	Stalled    bool          // Whether reading the body was aborted
+	LargestGap time.Duration // Between the first byte of the response and the reads of the body
+	BodyBytes  int64         // Of the body read, before the stall if there was one
+	LastByte   time.Duration // When the last byte of the body was read, relative to the start of the request
+}
+
+// SetStallTimeout aborts reading the response body if no bytes of it arrive
+// for timeout, however long reading it takes overall, so a server which stalls
+// mid-body is told apart from a body which is just large. How the body
+// arrived is returned by GetStall.
+func (t *Trace) SetStallTimeout(timeout time.Duration) {
+	t.stallTimeout = timeout
+}
+
+// GetStall returns how steadily the body arrived, or nil if SetStallTimeout
+// wasn't called or the body wasn't read.
+func (t *Trace) GetStall() *Stall {
+	return t.stall
+}
+
+// stallReader calls abort when no bytes have been read through it for
+// timeout, restarting the deadline with each read, and keeps the largest gap
+// between reads.
+type stallReader struct {
+	reader     io.Reader
+	timeout    time.Duration
+	timer      *time.Timer
+	stalled    int32
+	now        func() time.Duration
+	lastData   time.Duration
+	largestGap time.Duration
+}
+
+func newStallReader(r io.Reader, timeout time.Duration, now func() time.Duration, start time.Duration, abort func()) *stallReader {
+	s := &stallReader{reader: r, timeout: timeout, now: now, lastData: start}
+	s.timer = time.AfterFunc(timeout, func() {
+		atomic.StoreInt32(&s.stalled, 1)
+		abort()
+	})
+	return s
+}
+
+func (s *stallReader) Read(p []byte) (int, error) {
+	n, err := s.reader.Read(p)
+	if n > 0 && !s.isStalled() {
+		s.timer.Reset(s.timeout)
+		now := s.now()
+		if gap := now - s.lastData; gap > s.largestGap {
+			s.largestGap = gap
+		}
+		s.lastData = now
+	}
+	if err != nil && s.isStalled() {
+		err = fmt.Errorf("stalled, no bytes of the body for %s", s.timeout)
+	}
+	return n, err
+}
+
+// stop stops the deadline once the body has been read.
+func (s *stallReader) stop() {
+	s.timer.Stop()
+}
+
+func (s *stallReader) isStalled() bool {
+	return atomic.LoadInt32(&s.stalled) == 1
+}
@@ -0,0 +1,93 @@
+package trace
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Status is a snapshot of a request in progress, taken periodically to follow
+// long requests such as large downloads and long polls.
+type Status struct {
+	Elapsed      time.Duration // Since the start of the request
+	Phase        string        // The phase in progress, named as in the report
+	PhaseElapsed time.Duration // Since the phase started
+	BodyBytes    int64         // Of the response body read so far
+	Throughput   float64       // Bytes of the body read per second since the previous status
+}
+
+// statusPhases maps the trace events to the phases they start.
+var statusPhases = map[string]string{
+	"GetConn":              "connection",
+	"DNSStart":             "dns",
+	"ConnectStart":         "connect",
+	"TLSHandshakeStart":    "tls",
+	"GotConn":              "request_write",
+	"Wait100Continue":      "continue",
+	"WroteRequest":         "response_delay",
+	"GotFirstResponseByte": "response_read",
+}
+
+// SetStatusHandler calls handler with the status of the request every
+// interval while it is in progress, so a long request isn't silent until it
+// completes. The statuses are kept, and returned by GetStatuses.
+func (t *Trace) SetStatusHandler(interval time.Duration, handler func(s Status)) {
+	t.statusInterval = interval
+	t.statusHandler = handler
+}
+
+// GetStatuses returns the statuses taken while the request was in progress,
+// if SetStatusHandler was called.
+func (t *Trace) GetStatuses() []Status {
+	t.statusMu.Lock()
+	defer t.statusMu.Unlock()
+	return t.statuses
+}
+
+// startStatus takes a status every interval until the returned function is
+// called.
+func (t *Trace) startStatus(now func() time.Duration) func() {
+	if t.statusInterval <= 0 {
+		return func() {}
+	}
+
+	ticker := time.NewTicker(t.statusInterval)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var lastBytes int64
+		last := now()
+		for {
+			select {
+			case <-stop:
+				ticker.Stop()
+				return
+			case <-ticker.C:
+			}
+
+			elapsed := now()
+			t.eventsMu.Lock()
+			s := Status{Elapsed: elapsed, Phase: t.phase, PhaseElapsed: elapsed - t.phaseStart}
+			t.eventsMu.Unlock()
+			t.statusMu.Lock()
+			if t.body != nil {
+				s.BodyBytes = atomic.LoadInt64(&t.body.n)
+			}
+			if seconds := (elapsed - last).Seconds(); seconds > 0 {
+				s.Throughput = float64(s.BodyBytes-lastBytes) / seconds
+			}
+			t.statuses = append(t.statuses, s)
+			t.statusMu.Unlock()
+			lastBytes, last = s.BodyBytes, elapsed
+
+			if t.statusHandler != nil {
+				t.statusHandler(s)
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+	}
+}
@@ -0,0 +1,41 @@
+package trace
+
+import (
+	"net"
+	"syscall"
+	"time"
+)
+
+// TCPInfo is what the kernel measured of the TCP connection a request was
+// sent on, read once the response has been read. Unlike the timings these
+// cover the network alone, so a slow request with retransmits points at
+// packet loss rather than a slow server. The counts are over the life of the
+// connection, including earlier requests on it if it was reused.
+type TCPInfo struct {
+	RTT              time.Duration // Smoothed round trip time
+	RTTVar           time.Duration // Variation of the round trip time
+	Retransmits      uint64        // Segments sent again
+	CongestionWindow uint64        // Bytes which may be in flight unacknowledged
+}
+
+// readTCPInfo returns the TCP statistics of conn, or nil if they can't be
+// read on this platform or conn isn't a socket.
+func readTCPInfo(conn net.Conn) *TCPInfo {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return nil
+	}
+
+	var info *TCPInfo
+	err = raw.Control(func(fd uintptr) {
+		info = socketTCPInfo(fd)
+	})
+	if err != nil {
+		return nil
+	}
+	return info
+}
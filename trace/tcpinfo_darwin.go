@@ -0,0 +1,55 @@
+package trace
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// tcpConnectionInfo is struct tcp_connection_info of netinet/tcp.h.
+type tcpConnectionInfo struct {
+	State               uint8
+	SndWscale           uint8
+	RcvWscale           uint8
+	_                   uint8
+	Options             uint32
+	Flags               uint32
+	Rto                 uint32
+	Maxseg              uint32
+	SndSsthresh         uint32
+	SndCwnd             uint32 // Bytes
+	SndWnd              uint32
+	SndSbbytes          uint32
+	RcvWnd              uint32
+	Rttcur              uint32 // Milliseconds, as are the others
+	Srtt                uint32
+	Rttvar              uint32
+	TFO                 uint32
+	TxPackets           uint64
+	TxBytes             uint64
+	TxRetransmitBytes   uint64
+	RxPackets           uint64
+	RxBytes             uint64
+	RxOutOfOrderBytes   uint64
+	TxRetransmitPackets uint64
+}
+
+// tcpConnectionInfoOpt is TCP_CONNECTION_INFO, which macOS has in place of
+// TCP_INFO.
+const tcpConnectionInfoOpt = 0x106
+
+// socketTCPInfo reads TCP_CONNECTION_INFO from the socket fd.
+func socketTCPInfo(fd uintptr) *TCPInfo {
+	var info tcpConnectionInfo
+	size := uint32(unsafe.Sizeof(info))
+	_, _, errno := syscall.Syscall6(syscall.SYS_GETSOCKOPT, fd, syscall.IPPROTO_TCP, tcpConnectionInfoOpt, uintptr(unsafe.Pointer(&info)), uintptr(unsafe.Pointer(&size)), 0)
+	if errno != 0 {
+		return nil
+	}
+	return &TCPInfo{
+		RTT:              time.Duration(info.Srtt) * time.Millisecond,
+		RTTVar:           time.Duration(info.Rttvar) * time.Millisecond,
+		Retransmits:      info.TxRetransmitPackets,
+		CongestionWindow: uint64(info.SndCwnd),
+	}
+}
@@ -0,0 +1,23 @@
+package trace
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// socketTCPInfo reads TCP_INFO from the socket fd.
+func socketTCPInfo(fd uintptr) *TCPInfo {
+	var info syscall.TCPInfo
+	size := uint32(unsafe.Sizeof(info))
+	_, _, errno := syscall.Syscall6(syscall.SYS_GETSOCKOPT, fd, syscall.IPPROTO_TCP, syscall.TCP_INFO, uintptr(unsafe.Pointer(&info)), uintptr(unsafe.Pointer(&size)), 0)
+	if errno != 0 {
+		return nil
+	}
+	return &TCPInfo{
+		RTT:              time.Duration(info.Rtt) * time.Microsecond,
+		RTTVar:           time.Duration(info.Rttvar) * time.Microsecond,
+		Retransmits:      uint64(info.Total_retrans),
+		CongestionWindow: uint64(info.Snd_cwnd) * uint64(info.Snd_mss),
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !darwin && !linux
+// +build !darwin,!linux
+
+package trace
+
+// socketTCPInfo returns nil, as the TCP statistics of a socket aren't read on
+// this platform.
+func socketTCPInfo(fd uintptr) *TCPInfo {
+	return nil
+}
@@ -0,0 +1,68 @@
+package trace
+
+import (
+	"sort"
+	"time"
+)
+
+// Span is a phase of a request laid out on its timeline, from when it started
+// to when it ended relative to the start of the request.
+type Span struct {
+	Phase string // Named as in the report, such as dns or response_delay
+	Start time.Duration
+	End   time.Duration
+}
+
+// Duration returns how long the phase took.
+func (s Span) Duration() time.Duration {
+	return s.End - s.Start
+}
+
+// Timeline lays a request out in time, for waterfalls and formats such as HAR
+// and OpenTelemetry spans which need when each phase happened, not only how
+// long it took.
+type Timeline struct {
+	Start  time.Time     // When the request started, by the clock of the Trace
+	End    time.Duration // When the request ended, relative to its start
+	Spans  []Span        // The phases of the request, in the order they started
+	Events []Event       // The httptrace callbacks, in the order they happened
+}
+
+// Spans returns the phases of the request which took any time, in the order
+// they started. The connection span covers those of the DNS lookup, connect
+// and TLS handshake, which follow each other within it.
+func (t *Timings) Spans() []Span {
+	responseDelayStart := t.responseStart - t.ResponseDelayDuration
+	candidates := []Span{
+		{"connection", t.getConnStart, t.getConnStart + t.TotalConnectionDuration},
+		{"dns", t.dnsStart, t.dnsStart + t.DNSDuration},
+		{"connect", t.connectStart, t.connectStart + t.ConnectionDialDuration},
+		{"tls", t.tlsStart, t.tlsStart + t.TLSDuration},
+		{"request_write", t.requestStart, t.requestStart + t.RequestWriteDuration},
+		{"continue", t.continueStart, t.continueStart + t.ContinueDuration},
+		{"response_delay", responseDelayStart, t.responseStart},
+		{"response_read", t.responseStart, t.responseStart + t.ResponseReadDuration},
+	}
+
+	spans := []Span{}
+	for _, s := range candidates {
+		if s.Duration() > 0 {
+			spans = append(spans, s)
+		}
+	}
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].Start < spans[j].Start
+	})
+	return spans
+}
+
+// GetTimeline returns the phases and events of the request with when they
+// happened, once it has been executed.
+func (t *Trace) GetTimeline() *Timeline {
+	return &Timeline{
+		Start:  t.startTime,
+		End:    t.timings.requestEnd,
+		Spans:  t.timings.Spans(),
+		Events: t.GetEvents(),
+	}
+}
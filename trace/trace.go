@@ -1,13 +1,24 @@
+// Package trace times the phases of an HTTP request, from resolving the host
+// and connecting to reading the last byte of the response body, with
+// net/http/httptrace. It is what http-trace is built on, and can be used on
+// its own to time requests from Go code.
 package trace
 
 import (
+	"bytes"
+	"context"
 	"crypto/tls"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptrace"
-	"os"
+	"net/http/httputil"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -17,114 +28,630 @@ type Timings struct {
 	dnsStart      time.Duration
 	tlsStart      time.Duration
 	requestStart  time.Duration
+	continueStart time.Duration
 	delayStart    time.Duration
 	responseStart time.Duration
+	requestEnd    time.Duration
 
 	DNSDuration             time.Duration // DNS lookup duration
-	ConnectionDialDuration  time.Duration // Duration of time it takes to establish connection to destination server
+	ConnectionDialDuration  time.Duration // Duration of time it takes to establish connection to destination server, from the first address tried
 	TLSDuration             time.Duration // Duration of TLS handshake
-	TotalConnectionDuration time.Duration // Total connection setup (DNS lookup, Dial up and TLS) duration
+	TotalConnectionDuration time.Duration // Total connection setup (DNS lookup, Dial up and TLS) duration, or the time to get a reused connection from the idle pool
 	RequestWriteDuration    time.Duration // Request write duration, from successful connection to completing write
+	ContinueDuration        time.Duration // Time the server took to approve the request body with 100 Continue, from writing the headers
 	ResponseDelayDuration   time.Duration // Delay duration between request being written and first byte of response being received
 	ResponseReadDuration    time.Duration // Response read duration, from receiving first byte of response to completing read
+	TrailerDuration         time.Duration // Time from the last byte of the response body to receiving the trailers, if there were any
+	BodyEndDuration         time.Duration // Time from the last byte of the response body to learning it had ended, such as by the server closing the connection
 	TotalRequestDuration    time.Duration // Total duration of the request (sending request, receiving and parsing response)
 }
 
+// Event is one of the httptrace callbacks made while sending a request, with
+// when it happened relative to the start of the request.
+type Event struct {
+	Name   string
+	Offset time.Duration
+	Detail string
+}
+
+// DialAttempt is a connection attempt to one of the addresses of the host.
+// With Happy Eyeballs (RFC 6555) the addresses of each IP version are dialed
+// in parallel, the first to connect is used and the others are abandoned.
+type DialAttempt struct {
+	Network  string
+	Addr     string
+	Start    time.Duration // When the attempt started, relative to the start of the request
+	Duration time.Duration // How long it took to connect or fail, 0 if it never finished
+	Err      error
+	Done     bool
+	Won      bool // Whether the request was sent on its connection
+}
+
+// Chunk is a piece of a chunked response body, with when it was read
+// relative to the start of the request. The transport decodes the chunked
+// encoding, so a Chunk is what one read of the body returned: chunks which
+// arrived together are read as one, and a chunk which arrived in several
+// packets may be read in pieces.
+type Chunk struct {
+	Offset time.Duration
+	Size   int
+}
+
+// BodyReadError is returned by Execute when the response was received but
+// reading its body failed, such as when the connection was closed early. The
+// response, the part of the body which was read and the timings up to the
+// failure are kept, and returned as for a complete response.
+type BodyReadError struct {
+	Err       error
+	BytesRead int64
+}
+
+func (e *BodyReadError) Error() string {
+	return fmt.Sprintf("error reading response body after %d bytes: %v", e.BytesRead, e.Err)
+}
+
+func (e *BodyReadError) Unwrap() error {
+	return e.Err
+}
+
+// SendError is returned by Execute when the request failed before a response
+// was received, such as when the host couldn't be resolved or the connection
+// was refused, with the phase which was in progress, named as in the report.
+type SendError struct {
+	Phase string // Such as dns, connect, tls or response_delay
+	Err   error
+}
+
+func (e *SendError) Error() string {
+	return fmt.Sprintf("error sending request: %v", e.Err)
+}
+
+func (e *SendError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout reports whether the request failed because it timed out.
+func (e *SendError) Timeout() bool {
+	return isTimeout(e.Err)
+}
+
+// Clock provides the current time to a Trace. It allows timings to be derived
+// from something other than the wall clock, such as a replayed recording.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
 type Trace struct {
-	timings      *Timings
-	client       *http.Client
-	request      *http.Request
-	response     *http.Response
-	responseBody string
+	timings          *Timings
+	clock            Clock
+	startTime        time.Time
+	client           *http.Client
+	request          *http.Request
+	response         *http.Response
+	responseBody     string
+	responseBodySize int64
+	maxBodyCapture   int64
+	skipBody         bool
+	streamBody       bool
+	streamed         *streamedBody // The body being read by the caller
+	bodyWriter       io.Writer
+	wireWriter       io.Writer
+	eventHandler     func(e Event)
+	clientTraces     []*httptrace.ClientTrace
+	connReused       bool
+	connIdle         time.Duration
+	remoteAddr       net.Addr
+	localAddr        net.Addr
+	dialAttempts     []DialAttempt
+	dialMu           sync.Mutex
+	dnsQueries       []DNSQuery
+	dnsMu            sync.Mutex
+	wire             *wireConn
+	wireStart        [2]int64
+	sentBody         *sentBody // The request body, counting the bytes sent
+	wireSizes        *WireSizes
+	wireDump         *wireTap
+	tcpInfo          *TCPInfo
+	chunks           []Chunk
+	events           []Event
+	eventsMu         sync.Mutex
+	phase            string        // In progress, for the statuses
+	phaseStart       time.Duration // When phase started
+	statusInterval   time.Duration
+	statusHandler    func(s Status)
+	statuses         []Status
+	body             *countingReader // Being read, for the statuses
+	longPoll         bool
+	longPollResult   *LongPoll
+	stallTimeout     time.Duration
+	stall            *Stall
+	statusMu         sync.Mutex
+	progressInterval time.Duration
+	progressHandler  func(p Progress)
+	probe            string // The last phase of a probe, which sends no request
+}
+
+// Option configures a Trace when it is created with New.
+type Option func(t *Trace)
+
+// WithTransport sends the request with rt instead of the client's own
+// transport, such as an instrumented or mocked http.RoundTripper. The client
+// passed to New is left untouched, its other settings are kept. The trace
+// hooks travel with the request context, so they are called by any transport
+// which hands the request on to an http.Transport. If rt answers the request
+// itself the response is timed from when rt returns it.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(t *Trace) {
+		client := http.Client{}
+		if t.client != nil {
+			client = *t.client
+		}
+		client.Transport = rt
+		t.client = &client
+	}
 }
 
-func New(client *http.Client, request *http.Request) *Trace {
+// WithClientTrace calls the hooks of ct as well as those of the Trace, so
+// callers can follow the request with callbacks of their own. The hooks of
+// the Trace are called first, and the timings are taken from them, so ct
+// doesn't change what is measured. It can be given more than once, the hooks
+// are then called in the order they were given.
+func WithClientTrace(ct *httptrace.ClientTrace) Option {
+	return func(t *Trace) {
+		t.clientTraces = append(t.clientTraces, ct)
+	}
+}
+
+func New(client *http.Client, request *http.Request, opts ...Option) *Trace {
 	timings := &Timings{}
-	return &Trace{
-		timings: timings,
-		client:  client,
-		request: request,
+	t := &Trace{
+		timings:        timings,
+		clock:          systemClock{},
+		client:         client,
+		request:        request,
+		maxBodyCapture: -1,
 	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// SetClock replaces the wall clock used to measure the request.
+func (t *Trace) SetClock(clock Clock) {
+	t.clock = clock
+}
+
+// SetMaxBodyCapture limits how many bytes of the response body are kept in
+// memory and returned by GetResponseBody. The full body is always read and
+// timed. A negative limit keeps the whole body.
+func (t *Trace) SetMaxBodyCapture(limit int64) {
+	t.maxBodyCapture = limit
+}
+
+// SetSkipBody stops the request once the response headers have been
+// received, closing the body without reading it. The request total is then
+// the time to the first byte. As the body is left unread, the connection is
+// not reused.
+func (t *Trace) SetSkipBody(skip bool) {
+	t.skipBody = skip
+}
+
+// SetStreamBody makes Execute return once the response headers have been
+// received, leaving the body to be read from GetResponseBodyReader as it
+// arrives, such as a large download or a stream of events which is never
+// held in memory. The read and the request total are timed, and the events,
+// chunks and wire sizes of the body recorded, when the reader is closed.
+// GetResponseBody is then empty, as the body isn't kept.
+func (t *Trace) SetStreamBody(stream bool) {
+	t.streamBody = stream
+}
+
+// SetBodyWriter streams the full response body to w as it is read, for
+// example to save a large download to disk.
+func (t *Trace) SetBodyWriter(w io.Writer) {
+	t.bodyWriter = w
+}
+
+// SetWireWriter writes a verbose log of the request to w as it happens: each
+// event, the request exactly as it was serialized (with headers added by the
+// transport, such as Host and User-Agent) once it has been written, and the
+// response head as it was received.
+func (t *Trace) SetWireWriter(w io.Writer) {
+	t.wireWriter = w
 }
 
-func (t *Trace) SetHeaders(raw []string) {
+// SetEventHandler calls handler with each event as it happens, to follow a
+// request while it is in progress. Events are passed one at a time, in order.
+func (t *Trace) SetEventHandler(handler func(e Event)) {
+	t.eventHandler = handler
+}
+
+// SetTrailers sends raw "Name: value" trailers after the request body, which
+// is then sent chunked as trailers can only follow a body of unknown length.
+// It returns an error, without setting any of them, if one has no colon or no
+// name.
+func (t *Trace) SetTrailers(raw []string) error {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	trailer := http.Header{}
+	for _, full := range raw {
+		split := strings.SplitN(full, ":", 2)
+		if len(split) != 2 || strings.TrimSpace(split[0]) == "" {
+			return fmt.Errorf("invalid trailer %q, expected 'Name: value'", full)
+		}
+		trailer.Set(strings.TrimSpace(split[0]), strings.TrimSpace(split[1]))
+	}
+	t.request.Trailer = trailer
+	if t.request.Body == nil || t.request.Body == http.NoBody {
+		t.request.Body = ioutil.NopCloser(strings.NewReader(""))
+	}
+	t.request.ContentLength = -1
+	return nil
+}
+
+// SetHeaders sets raw "Name: value" headers on the request. It returns an
+// error, without setting any of them, if one has no colon or no name.
+func (t *Trace) SetHeaders(raw []string) error {
+	header := http.Header{}
 	for _, full := range raw {
 		split := strings.SplitN(full, ":", 2)
-		headerTrim := strings.TrimSpace(split[0])
-		valueTrim := strings.TrimSpace(split[1])
-		t.request.Header.Set(headerTrim, valueTrim)
+		if len(split) != 2 || strings.TrimSpace(split[0]) == "" {
+			return fmt.Errorf("invalid header %q, expected 'Name: value'", full)
+		}
+		header.Set(strings.TrimSpace(split[0]), strings.TrimSpace(split[1]))
 	}
+	for name, values := range header {
+		t.request.Header[name] = values
+	}
+	return nil
 }
 
 func (t *Trace) Execute() error {
-	var startTime = time.Now()
+	var requestDump []byte
+	if t.wireWriter != nil {
+		// Dumped before the clock starts, as it reads and replaces the body
+		var err error
+		requestDump, err = httputil.DumpRequestOut(t.request, true)
+		if err != nil {
+			return fmt.Errorf("error dumping request: %w", err)
+		}
+	}
+
+	var startTime = t.clock.Now()
+	t.startTime = startTime
 	timeSinceStart := func() time.Duration {
-		return time.Since(startTime)
+		return t.clock.Now().Sub(startTime)
+	}
+	addEvent := func(name, detail string) {
+		t.eventsMu.Lock()
+		defer t.eventsMu.Unlock()
+		e := Event{Name: name, Offset: timeSinceStart(), Detail: detail}
+		t.events = append(t.events, e)
+		if phase, ok := statusPhases[name]; ok {
+			t.phase, t.phaseStart = phase, e.Offset
+		}
+		if t.eventHandler != nil {
+			t.eventHandler(e)
+		}
+		if t.wireWriter != nil {
+			fmt.Fprintf(t.wireWriter, "* %9.2fms %s\n", e.Offset.Seconds()*1000, strings.TrimSpace(e.Name+" "+e.Detail))
+			if name == "WroteRequest" {
+				writeWire(t.wireWriter, "> ", requestDump)
+			}
+		}
 	}
 
 	requestStartTime := timeSinceStart()
+	gotFirstByte := false
+	gotContinue := false
+	connected := false
 
 	trace := &httptrace.ClientTrace{
 		GetConn: func(h string) {
 			t.timings.getConnStart = timeSinceStart()
+			addEvent("GetConn", h)
+			// Each redirect gets a connection of its own
+			t.dialMu.Lock()
+			t.dialAttempts = nil
+			connected = false
+			t.dialMu.Unlock()
+			t.dnsMu.Lock()
+			t.dnsQueries = nil
+			t.dnsMu.Unlock()
 		},
 		GotConn: func(connInfo httptrace.GotConnInfo) {
-			if !connInfo.Reused {
-				t.timings.TotalConnectionDuration = timeSinceStart() - t.timings.getConnStart
+			t.connReused = connInfo.Reused
+			t.connIdle = connInfo.IdleTime
+			if connInfo.Conn != nil {
+				t.remoteAddr = connInfo.Conn.RemoteAddr()
+				t.localAddr = connInfo.Conn.LocalAddr()
+				t.startWire(connInfo.Conn, connInfo.Reused)
+				if !connInfo.Reused {
+					t.markDialWinner(connInfo.Conn.RemoteAddr().String())
+				}
 			}
+			detail := "new connection"
+			if connInfo.Reused {
+				detail = "reused connection"
+			}
+			addEvent("GotConn", detail)
+			// A reused connection is timed too, as the wait for it to be
+			// taken from the idle pool, so the phases still add up
+			t.timings.TotalConnectionDuration = timeSinceStart() - t.timings.getConnStart
 			t.timings.requestStart = timeSinceStart()
 		},
 		GotFirstResponseByte: func() {
+			gotFirstByte = true
+			addEvent("GotFirstResponseByte", "")
 			t.timings.ResponseDelayDuration = timeSinceStart() - t.timings.delayStart
 			t.timings.responseStart = timeSinceStart()
 		},
 		DNSStart: func(info httptrace.DNSStartInfo) {
 			t.timings.dnsStart = timeSinceStart()
+			addEvent("DNSStart", info.Host)
 		},
 		DNSDone: func(dnsInfo httptrace.DNSDoneInfo) {
 			t.timings.DNSDuration = timeSinceStart() - t.timings.dnsStart
+			addEvent("DNSDone", dnsDetail(dnsInfo))
 		},
 		ConnectStart: func(network, addr string) {
-			t.timings.connectStart = timeSinceStart()
+			// With Happy Eyeballs attempts to several addresses overlap, and
+			// the connect phase is from the first starting to one connecting
+			t.dialMu.Lock()
+			now := timeSinceStart()
+			if len(t.dialAttempts) == 0 {
+				t.timings.connectStart = now
+			}
+			t.dialAttempts = append(t.dialAttempts, DialAttempt{Network: network, Addr: addr, Start: now})
+			t.dialMu.Unlock()
+			addEvent("ConnectStart", network+" "+addr)
 		},
 		ConnectDone: func(network, addr string, err error) {
-			t.timings.ConnectionDialDuration = timeSinceStart() - t.timings.connectStart
+			t.dialMu.Lock()
+			now := timeSinceStart()
+			for i := range t.dialAttempts {
+				a := &t.dialAttempts[i]
+				if !a.Done && a.Network == network && a.Addr == addr {
+					a.Duration, a.Err, a.Done = now-a.Start, err, true
+					break
+				}
+			}
+			if !connected {
+				t.timings.ConnectionDialDuration = now - t.timings.connectStart
+				connected = err == nil
+			}
+			t.dialMu.Unlock()
+			addEvent("ConnectDone", errorDetail(network+" "+addr, err))
 		},
 		TLSHandshakeStart: func() {
 			t.timings.tlsStart = timeSinceStart()
+			addEvent("TLSHandshakeStart", "")
 		},
 		TLSHandshakeDone: func(tlsConnState tls.ConnectionState, err error) {
 			t.timings.TLSDuration = timeSinceStart() - t.timings.tlsStart
+			addEvent("TLSHandshakeDone", errorDetail(tlsDetail(tlsConnState.Version, tlsConnState.NegotiatedProtocol), err))
+		},
+		WroteHeaders: func() {
+			addEvent("WroteHeaders", "")
+		},
+		Wait100Continue: func() {
+			t.timings.continueStart = timeSinceStart()
+			addEvent("Wait100Continue", "")
+		},
+		Got100Continue: func() {
+			// The first response byte was that of the interim response, the
+			// final one is timed from when it has been read
+			gotFirstByte = false
+			gotContinue = true
+			addEvent("Got100Continue", "")
+			t.timings.ContinueDuration = timeSinceStart() - t.timings.continueStart
 		},
 		WroteRequest: func(w httptrace.WroteRequestInfo) {
+			addEvent("WroteRequest", errorDetail("", w.Err))
 			t.timings.RequestWriteDuration = timeSinceStart() - t.timings.requestStart
 			t.timings.delayStart = timeSinceStart()
 		},
 	}
 
-	t.request = t.request.WithContext(httptrace.WithClientTrace(t.request.Context(), trace))
+	queries := &dnsQueries{
+		now: timeSinceStart,
+		add: func(q DNSQuery) {
+			t.dnsMu.Lock()
+			t.dnsQueries = append(t.dnsQueries, q)
+			t.dnsMu.Unlock()
+			addEvent("DNSQuery", dnsQueryDetail(q))
+		},
+	}
+	stopStatus := t.startStatus(timeSinceStart)
+
+	// Hooks added later are called first, so the caller's are added in
+	// reverse and those of the Trace last
+	ctx := t.request.Context()
+	for i := len(t.clientTraces) - 1; i >= 0; i-- {
+		ctx = httptrace.WithClientTrace(ctx, t.clientTraces[i])
+	}
+	ctx = context.WithValue(httptrace.WithClientTrace(ctx, trace), dnsQueriesKey{}, queries)
+	// Cancelling the request is what aborts reading a stalled body
+	ctx, cancel := context.WithCancel(ctx)
+	t.request = t.request.WithContext(ctx)
+	// The connection is untapped when the request completes, and also if it
+	// fails. A streamed body is still being read when Execute returns, so is
+	// released when it is closed.
+	release := func() {
+		t.untapWire()
+		cancel()
+		stopStatus()
+	}
+	streaming := false
+	defer func() {
+		if !streaming {
+			release()
+		}
+	}()
+	if t.request.Body != nil && t.request.Body != http.NoBody {
+		t.sentBody = &sentBody{ReadCloser: t.request.Body}
+		t.request.Body = t.sentBody
+	}
 	resp, err := t.client.Do(t.request)
 	if err != nil {
-		return fmt.Errorf("error sending request: %w", err)
+		t.eventsMu.Lock()
+		phase := t.phase
+		t.eventsMu.Unlock()
+		if phase == "" {
+			phase = "connection"
+		}
+		if name, detail, ok := http2Event(err); ok {
+			addEvent(name, detail)
+		}
+		return &SendError{Phase: phase, Err: err}
+	}
+	if t.probe != "" {
+		finishTime := timeSinceStart()
+		resp.Body.Close()
+		t.response = resp
+		addEvent("ProbeDone", t.probe)
+		t.finishWire()
+		t.timings.TotalRequestDuration = finishTime - requestStartTime
+		t.timings.requestEnd = finishTime
+		return nil
+	}
+	if t.wireWriter != nil {
+		responseDump, err := httputil.DumpResponse(resp, false)
+		if err == nil {
+			writeWire(t.wireWriter, "< ", responseDump)
+		}
+	}
+	switch {
+	case gotContinue && !gotFirstByte:
+		t.timings.ResponseDelayDuration = timeSinceStart() - t.timings.delayStart
+		t.timings.responseStart = timeSinceStart()
+	case !gotFirstByte:
+		// The transport didn't call the hooks, so the response delay is all
+		// the time until it returned the response.
+		t.timings.ResponseDelayDuration = timeSinceStart() - requestStartTime
+		t.timings.responseStart = timeSinceStart()
 	}
 
-	responseBodyBytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		readingBodyError := fmt.Sprintf("Error reading response body: %v", err.Error())
-		_, _ = fmt.Fprint(os.Stderr, readingBodyError+"\n")
-		responseBodyBytes = []byte(readingBodyError)
+	if t.skipBody {
+		finishTime := timeSinceStart()
+		resp.Body.Close()
+		t.response = resp
+		addEvent("BodySkipped", "")
+		t.finishWire()
+		t.timings.ResponseReadDuration = finishTime - t.timings.responseStart
+		t.timings.TotalRequestDuration = finishTime - requestStartTime
+		t.timings.requestEnd = finishTime
+		return t.wireDumpError()
 	}
-	responseBody := string(responseBodyBytes)
-	resp.Body.Close()
 
-	t.response = resp
-	t.responseBody = responseBody
+	body := &countingReader{reader: resp.Body, now: timeSinceStart, lastData: t.timings.responseStart, record: isChunked(resp) || t.longPoll}
+	t.statusMu.Lock()
+	t.body = body
+	t.statusMu.Unlock()
+	captured := &limitedBuffer{limit: t.maxBodyCapture}
+	var dst io.Writer = captured
+	var sink *errorWriter
+	if t.bodyWriter != nil {
+		sink = &errorWriter{writer: t.bodyWriter}
+		dst = io.MultiWriter(captured, sink)
+	}
 
-	finishTime := timeSinceStart()
-	t.timings.ResponseReadDuration = finishTime - t.timings.responseStart
-	t.timings.TotalRequestDuration = finishTime - requestStartTime
+	var src io.Reader = body
+	var stall *stallReader
+	if t.stallTimeout > 0 {
+		stall = newStallReader(body, t.stallTimeout, timeSinceStart, t.timings.responseStart, cancel)
+		src = stall
+	}
+	stopProgress := t.startProgress(body, resp.ContentLength, timeSinceStart)
+	// Finishes the trace once the body has been read, or reading it failed
+	// with err, returning the error of the request
+	finish := func(err error) error {
+		stopProgress()
+		resp.Body.Close()
+		if stall != nil {
+			stall.stop()
+			t.stall = &Stall{
+				Timeout:    t.stallTimeout,
+				Stalled:    stall.isStalled(),
+				LargestGap: stall.largestGap,
+				BodyBytes:  body.n,
+				LastByte:   body.lastData,
+			}
+			if t.stall.Stalled {
+				// Reading was aborted, which GetStall reports rather than an error
+				addEvent("Stalled", fmt.Sprintf("%d bytes", body.n))
+				err = nil
+			}
+		}
+		if sink != nil && sink.err != nil {
+			return fmt.Errorf("error writing response body: %w", sink.err)
+		}
 
-	return nil
+		if t.longPoll {
+			t.longPollResult = &LongPoll{Reads: body.reads}
+			if isTimeout(err) {
+				t.longPollResult.HeldOpen = true
+				err = nil
+			}
+		}
+		bodyErr := err
+
+		t.response = resp
+		t.responseBody = captured.String()
+		t.responseBodySize = body.n
+		if isChunked(resp) {
+			t.chunks = body.reads
+		}
+
+		finishTime := timeSinceStart()
+		if body.end > 0 {
+			t.timings.BodyEndDuration = body.end - body.lastData
+		}
+		if name, detail, ok := http2Event(bodyErr); ok {
+			addEvent(name, detail)
+		}
+		addEvent("BodyDone", errorDetail(fmt.Sprintf("%d bytes", body.n), bodyErr))
+		t.finishWire()
+		if trailers := receivedTrailers(resp); len(trailers) > 0 {
+			// Trailers follow the last chunk of the body, and are parsed before
+			// the end of the body is reported
+			addEvent("Trailers", strings.Join(trailers, ", "))
+			t.timings.TrailerDuration = body.end - body.lastData
+		}
+		t.timings.ResponseReadDuration = finishTime - t.timings.responseStart
+		t.timings.TotalRequestDuration = finishTime - requestStartTime
+		t.timings.requestEnd = finishTime
+
+		if bodyErr != nil {
+			return &BodyReadError{Err: bodyErr, BytesRead: body.n}
+		}
+		return t.wireDumpError()
+	}
+
+	if t.streamBody {
+		// The caller reads the body, which isn't kept
+		if sink != nil {
+			src = io.TeeReader(src, sink)
+		}
+		streaming = true
+		t.response = resp
+		t.streamed = &streamedBody{reader: src, finish: func(err error) error {
+			defer release()
+			return finish(err)
+		}}
+		return nil
+	}
+	_, err = io.Copy(dst, src)
+	return finish(err)
 }
 
 func (t *Trace) GetResponse() *http.Response {
@@ -135,6 +662,316 @@ func (t *Trace) GetResponseBody() string {
 	return t.responseBody
 }
 
+// GetResponseBodyReader returns the response body to read. With
+// SetStreamBody it reads the body as it arrives, and closing it finishes the
+// trace, returning the error Execute would have, such as a BodyReadError;
+// closing it before the end abandons the rest of the body. Otherwise it
+// reads the body kept by Execute. It returns nil if there was no response.
+func (t *Trace) GetResponseBodyReader() io.ReadCloser {
+	if t.streamed != nil {
+		return t.streamed
+	}
+	if t.response == nil {
+		return nil
+	}
+	return ioutil.NopCloser(strings.NewReader(t.responseBody))
+}
+
+// GetResponseBodySize returns the number of response body bytes read, which
+// may be more than were kept by GetResponseBody.
+func (t *Trace) GetResponseBodySize() int64 {
+	return t.responseBodySize
+}
+
 func (t *Trace) GetTimings() *Timings {
 	return t.timings
 }
+
+// GetConnectionReused reports whether the request was sent on a connection
+// kept alive from an earlier request, so no DNS lookup, connect or TLS
+// handshake was needed.
+func (t *Trace) GetConnectionReused() bool {
+	return t.connReused
+}
+
+// GetConnectionIdleTime returns how long the reused connection the request
+// was sent on had been idle in the pool, or 0 for a new connection.
+func (t *Trace) GetConnectionIdleTime() time.Duration {
+	return t.connIdle
+}
+
+// GetRemoteAddr returns the address of the server the request was sent to,
+// or nil if no connection was made.
+func (t *Trace) GetRemoteAddr() net.Addr {
+	return t.remoteAddr
+}
+
+// GetChunks returns the pieces of the response body as they were read, if it
+// was sent with chunked encoding, to see how a streamed response arrived.
+func (t *Trace) GetChunks() []Chunk {
+	return t.chunks
+}
+
+// GetLocalAddr returns the address the request was sent from, or nil if no
+// connection was made.
+func (t *Trace) GetLocalAddr() net.Addr {
+	return t.localAddr
+}
+
+// GetWireSizes returns the bytes the request and response took on the wire,
+// or nil if the connection wasn't made with CountWire.
+func (t *Trace) GetWireSizes() *WireSizes {
+	return t.wireSizes
+}
+
+// GetTCPInfo returns what the kernel measured of the TCP connection the
+// request was sent on, or nil if it couldn't be read, such as when the
+// connection wasn't made with CountWire or on platforms other than Linux and
+// macOS.
+func (t *Trace) GetTCPInfo() *TCPInfo {
+	return t.tcpInfo
+}
+
+// startWire notes the counts of conn as the request is sent on it, with the
+// bytes already on a new connection being those of setting it up.
+func (t *Trace) startWire(conn net.Conn, reused bool) {
+	// A redirect is sent on another connection, which is dumped in turn
+	t.untapWire()
+	t.wire = findWireConn(conn)
+	t.wireSizes = nil
+	t.tcpInfo = nil
+	if t.wire == nil {
+		return
+	}
+	if t.wireDump != nil {
+		t.wire.setTap(t.wireDump)
+	}
+	written, read := t.wire.counts()
+	t.wireStart = [2]int64{written, read}
+	t.wireSizes = &WireSizes{}
+	if !reused {
+		t.wireSizes.Setup = written + read
+	}
+}
+
+// finishWire records the bytes written and read on the connection since the
+// request was sent on it, and the TCP statistics of the connection.
+func (t *Trace) finishWire() {
+	if t.wire == nil {
+		return
+	}
+	t.untapWire()
+	written, read := t.wire.counts()
+	t.wireSizes.Sent = written - t.wireStart[0]
+	t.wireSizes.Received = read - t.wireStart[1]
+	if t.sentBody != nil {
+		t.wireSizes.RequestBody = atomic.LoadInt64(&t.sentBody.n)
+		if t.wireSizes.RequestBody > t.wireSizes.Sent {
+			t.wireSizes.RequestBody = t.wireSizes.Sent
+		}
+	}
+	t.wireSizes.RequestHead = t.wireSizes.Sent - t.wireSizes.RequestBody
+	if t.response != nil && t.probe == "" {
+		t.wireSizes.ResponseHead = responseHeadSize(t.response)
+		if t.wireSizes.ResponseHead > t.wireSizes.Received {
+			t.wireSizes.ResponseHead = t.wireSizes.Received
+		}
+		t.wireSizes.ResponseBody = t.wireSizes.Received - t.wireSizes.ResponseHead
+	}
+	t.tcpInfo = readTCPInfo(t.wire.Conn)
+}
+
+// GetDNSQueries returns the queries sent to DNS servers to resolve the host,
+// if the resolver reported them with StartDNSQuery.
+func (t *Trace) GetDNSQueries() []DNSQuery {
+	t.dnsMu.Lock()
+	defer t.dnsMu.Unlock()
+	return append([]DNSQuery{}, t.dnsQueries...)
+}
+
+// GetDialAttempts returns the attempts made to connect to the addresses of
+// the host, more than one if an address failed or with Happy Eyeballs.
+func (t *Trace) GetDialAttempts() []DialAttempt {
+	t.dialMu.Lock()
+	defer t.dialMu.Unlock()
+	return append([]DialAttempt{}, t.dialAttempts...)
+}
+
+func (t *Trace) markDialWinner(remoteAddr string) {
+	t.dialMu.Lock()
+	defer t.dialMu.Unlock()
+	for i := range t.dialAttempts {
+		if t.dialAttempts[i].Addr == remoteAddr && t.dialAttempts[i].Err == nil {
+			t.dialAttempts[i].Won = true
+			return
+		}
+	}
+}
+
+// GetEvents returns the httptrace callbacks made while sending the request,
+// in the order they happened.
+func (t *Trace) GetEvents() []Event {
+	t.eventsMu.Lock()
+	defer t.eventsMu.Unlock()
+	return append([]Event{}, t.events...)
+}
+
+func dnsDetail(info httptrace.DNSDoneInfo) string {
+	addrs := []string{}
+	for _, a := range info.Addrs {
+		addrs = append(addrs, a.String())
+	}
+	return errorDetail(strings.Join(addrs, " "), info.Err)
+}
+
+func tlsVersion(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	}
+	return ""
+}
+
+// errorDetail appends err, if there is one, to the detail of an event.
+func errorDetail(detail string, err error) string {
+	if err == nil {
+		return detail
+	}
+	if detail == "" {
+		return "error: " + err.Error()
+	}
+	return detail + ", error: " + err.Error()
+}
+
+// writeWire writes each line of a dumped request or response prefixed to show
+// its direction.
+func writeWire(w io.Writer, prefix string, dump []byte) {
+	lines := strings.Split(strings.TrimRight(string(dump), "\r\n"), "\n")
+	for _, line := range lines {
+		fmt.Fprintln(w, strings.TrimRight(prefix+line, " \r"))
+	}
+}
+
+// receivedTrailers returns the names of the trailers of resp which were
+// received. Trailers announced in the Trailer header but not sent are left out.
+func receivedTrailers(resp *http.Response) []string {
+	names := []string{}
+	for name, values := range resp.Trailer {
+		if len(values) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func isChunked(resp *http.Response) bool {
+	for _, encoding := range resp.TransferEncoding {
+		if encoding == "chunked" {
+			return true
+		}
+	}
+	return false
+}
+
+// countingReader counts the bytes read through it, and notes when the last
+// of them was read and when the end was reached. If chunked is set each read
+// is also kept as a Chunk.
+type countingReader struct {
+	reader   io.Reader
+	n        int64
+	now      func() time.Duration
+	lastData time.Duration
+	end      time.Duration
+	record   bool // Whether to record each read, as a chunk of a chunked body
+	reads    []Chunk
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	// Counted atomically, as statuses are taken while the body is read
+	atomic.AddInt64(&c.n, int64(n))
+	if n > 0 {
+		c.lastData = c.now()
+		if c.record {
+			c.reads = append(c.reads, Chunk{Offset: c.lastData, Size: n})
+		}
+	}
+	if err == io.EOF {
+		c.end = c.now()
+	}
+	return n, err
+}
+
+// streamedBody is the response body read by the caller with SetStreamBody,
+// which finishes the trace when it is closed.
+type streamedBody struct {
+	reader   io.Reader
+	finish   func(err error) error
+	err      error // The first error reading the body, other than its end
+	once     sync.Once
+	closeErr error
+}
+
+func (s *streamedBody) Read(p []byte) (int, error) {
+	n, err := s.reader.Read(p)
+	if err != nil && err != io.EOF && s.err == nil {
+		s.err = err
+	}
+	return n, err
+}
+
+func (s *streamedBody) Close() error {
+	s.once.Do(func() {
+		s.closeErr = s.finish(s.err)
+	})
+	return s.closeErr
+}
+
+// limitedBuffer keeps up to limit bytes written to it and silently discards
+// the rest. A negative limit keeps everything.
+type limitedBuffer struct {
+	buf   bytes.Buffer
+	limit int64
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.limit < 0 {
+		return b.buf.Write(p)
+	}
+
+	remaining := b.limit - int64(b.buf.Len())
+	if remaining > 0 {
+		if int64(len(p)) > remaining {
+			b.buf.Write(p[:remaining])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
+
+// errorWriter records a write error so it can be told apart from an error
+// reading the response body.
+type errorWriter struct {
+	writer io.Writer
+	err    error
+}
+
+func (w *errorWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
@@ -2,13 +2,22 @@ package trace
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/http/httptrace"
+	"reflect"
+	"runtime"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -142,7 +151,10 @@ func TestTrace(t *testing.T) {
 			}
 
 			tracedRequest := New(httpClient, request)
-			tracedRequest.SetHeaders(rawRequestHeaders)
+			err = tracedRequest.SetHeaders(rawRequestHeaders)
+			if err != nil {
+				t.Fatalf("Error setting headers: %v", err)
+			}
 			err = tracedRequest.Execute()
 			if err != nil {
 				t.Errorf("Error doing traced request: %v", err)
@@ -267,8 +279,12 @@ func TestTraceTimeout(t *testing.T) {
 			err = tracedRequest.Execute()
 
 			if cfg.expectedRequestError {
-				if err == nil {
-					t.Error("Expected http request error")
+				var sendErr *SendError
+				if !errors.As(err, &sendErr) {
+					t.Fatalf("Expected a send error: got %v", err)
+				}
+				if sendErr.Phase != "response_delay" || !sendErr.Timeout() {
+					t.Errorf("Unexpected send error: got phase %s, timeout %v, want a timeout in response_delay", sendErr.Phase, sendErr.Timeout())
 				}
 			} else {
 				if err != nil {
@@ -278,3 +294,1563 @@ func TestTraceTimeout(t *testing.T) {
 		})
 	}
 }
+
+func TestTraceSendError(t *testing.T) {
+	// A port nothing is listening on, so the connection is refused
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	request, err := http.NewRequest(http.MethodGet, "http://"+addr, nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	tracedRequest := New(&http.Client{}, request)
+	err = tracedRequest.Execute()
+	var sendErr *SendError
+	if !errors.As(err, &sendErr) {
+		t.Fatalf("Expected a send error: got %v", err)
+	}
+	if sendErr.Phase != "connect" || sendErr.Timeout() {
+		t.Errorf("Unexpected send error: got phase %s, timeout %v, want connect", sendErr.Phase, sendErr.Timeout())
+	}
+	if !strings.HasPrefix(err.Error(), "error sending request: ") {
+		t.Errorf("Unexpected error message: %v", err)
+	}
+}
+
+type testTraceBodyCapture struct {
+	maxBodyCapture int64
+	bodyWriter     bool
+	expectedBody   string
+}
+
+func TestTraceBodyCapture(t *testing.T) {
+	responseBody := strings.Repeat("0123456789", 1000)
+
+	tests := map[string]testTraceBodyCapture{
+		"will keep the whole body by default": {
+			maxBodyCapture: -1,
+			bodyWriter:     true,
+			expectedBody:   responseBody,
+		},
+		"will keep only the start of the body when limited": {
+			maxBodyCapture: 15,
+			expectedBody:   "012345678901234",
+		},
+		"will keep only the start of the body when limited and streaming to a writer": {
+			maxBodyCapture: 15,
+			bodyWriter:     true,
+			expectedBody:   "012345678901234",
+		},
+		"will keep none of the body when limited to zero": {
+			maxBodyCapture: 0,
+			expectedBody:   "",
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(responseBody))
+			}))
+			defer server.Close()
+
+			request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			if err != nil {
+				t.Errorf("Error creating http request: %v", err)
+			}
+
+			streamed := &bytes.Buffer{}
+
+			tracedRequest := New(&http.Client{}, request)
+			tracedRequest.SetMaxBodyCapture(cfg.maxBodyCapture)
+			if cfg.bodyWriter {
+				tracedRequest.SetBodyWriter(streamed)
+			}
+			err = tracedRequest.Execute()
+			if err != nil {
+				t.Errorf("Error doing traced request: %v", err)
+			}
+
+			if tracedRequest.GetResponseBody() != cfg.expectedBody {
+				t.Errorf("Unexpected http response body: got %v, want %v", tracedRequest.GetResponseBody(), cfg.expectedBody)
+			}
+
+			if tracedRequest.GetResponseBodySize() != int64(len(responseBody)) {
+				t.Errorf("Unexpected http response body size: got %v, want %v", tracedRequest.GetResponseBodySize(), len(responseBody))
+			}
+
+			if cfg.bodyWriter && streamed.String() != responseBody {
+				t.Errorf("Body writer did not receive the full response body: got %v bytes, want %v", streamed.Len(), len(responseBody))
+			}
+		})
+	}
+}
+
+func TestTraceEvents(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	certpool := x509.NewCertPool()
+	certpool.AddCert(server.Certificate())
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: certpool},
+		},
+	}
+
+	expected := []string{
+		"GetConn",
+		"ConnectStart",
+		"ConnectDone",
+		"TLSHandshakeStart",
+		"TLSHandshakeDone",
+		"GotConn",
+		"WroteHeaders",
+		"WroteRequest",
+		"GotFirstResponseByte",
+		"BodyDone",
+	}
+
+	for i, reused := range []bool{false, true} {
+		request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		if err != nil {
+			t.Errorf("Error creating http request: %v", err)
+		}
+
+		tracedRequest := New(client, request)
+		err = tracedRequest.Execute()
+		if err != nil {
+			t.Fatalf("Error doing traced request: %v", err)
+		}
+
+		names := []string{}
+		var last time.Duration
+		for _, e := range tracedRequest.GetEvents() {
+			names = append(names, e.Name)
+			if e.Offset < last {
+				t.Errorf("Event %v is out of order at %v", e.Name, e.Offset)
+			}
+			last = e.Offset
+		}
+
+		want := expected
+		if reused {
+			want = []string{"GetConn", "GotConn", "WroteHeaders", "WroteRequest", "GotFirstResponseByte", "BodyDone"}
+		}
+		if strings.Join(names, " ") != strings.Join(want, " ") {
+			t.Errorf("Unexpected events for request %d: got %v, want %v", i+1, names, want)
+		}
+		if tracedRequest.GetConnectionReused() != reused {
+			t.Errorf("Unexpected connection reuse for request %d: got %v, want %v", i+1, tracedRequest.GetConnectionReused(), reused)
+		}
+		if idle := tracedRequest.GetConnectionIdleTime(); (idle > 0) != reused {
+			t.Errorf("Unexpected idle time for request %d: got %v", i+1, idle)
+		}
+
+		timings := tracedRequest.GetTimings()
+		if reused && (timings.DNSDuration != 0 || timings.ConnectionDialDuration != 0 || timings.TLSDuration != 0) {
+			t.Errorf("Unexpected connection setup for a reused connection: got %+v", timings)
+		}
+		if timings.TotalConnectionDuration <= 0 {
+			t.Errorf("Expected the time to get the connection for request %d: got %v", i+1, timings.TotalConnectionDuration)
+		}
+		phases := timings.TotalConnectionDuration + timings.RequestWriteDuration + timings.ResponseDelayDuration + timings.ResponseReadDuration
+		if phases > timings.TotalRequestDuration {
+			t.Errorf("Phases of request %d add up to more than the total: got %v, total %v", i+1, phases, timings.TotalRequestDuration)
+		}
+	}
+}
+
+type countingTransport struct {
+	next  http.RoundTripper
+	calls int
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.calls++
+	return c.next.RoundTrip(req)
+}
+
+type stubTransport struct {
+	delay time.Duration
+	body  string
+}
+
+func (s *stubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	time.Sleep(s.delay)
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(s.body)),
+		Request:    req,
+	}, nil
+}
+
+func TestTraceWithTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	wrapping := &countingTransport{next: &http.Transport{}}
+
+	request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+	tracedRequest := New(client, request, WithTransport(wrapping))
+	err = tracedRequest.Execute()
+	if err != nil {
+		t.Fatalf("Error doing traced request: %v", err)
+	}
+
+	if wrapping.calls != 1 {
+		t.Errorf("Expected the transport to be used once: got %d", wrapping.calls)
+	}
+	if client.Transport != nil {
+		t.Errorf("Expected the client to be left untouched: got transport %v", client.Transport)
+	}
+	if tracedRequest.GetTimings().ConnectionDialDuration == 0 {
+		t.Errorf("Expected the trace hooks to be called through a wrapping transport")
+	}
+
+	request, err = http.NewRequest(http.MethodGet, "http://stubbed.example", nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+	tracedRequest = New(nil, request, WithTransport(&stubTransport{delay: 50 * time.Millisecond, body: "stubbed"}))
+	err = tracedRequest.Execute()
+	if err != nil {
+		t.Fatalf("Error doing traced request: %v", err)
+	}
+
+	if tracedRequest.GetResponseBody() != "stubbed" {
+		t.Errorf("Unexpected response body: got %q, want %q", tracedRequest.GetResponseBody(), "stubbed")
+	}
+	timings := tracedRequest.GetTimings()
+	if timings.ResponseDelayDuration < 50*time.Millisecond {
+		t.Errorf("Expected the response delay to cover the stubbed transport: got %v", timings.ResponseDelayDuration)
+	}
+	if timings.ResponseReadDuration > timings.TotalRequestDuration-timings.ResponseDelayDuration {
+		t.Errorf("Unexpected response read duration: got %v of %v", timings.ResponseReadDuration, timings.TotalRequestDuration)
+	}
+}
+
+func TestTraceWithClientTrace(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	calls := []string{}
+	first := &httptrace.ClientTrace{
+		GotConn:              func(httptrace.GotConnInfo) { calls = append(calls, "first GotConn") },
+		GotFirstResponseByte: func() { calls = append(calls, "first GotFirstResponseByte") },
+	}
+	second := &httptrace.ClientTrace{
+		GotConn: func(httptrace.GotConnInfo) { calls = append(calls, "second GotConn") },
+	}
+	tracedRequest := New(&http.Client{}, request, WithClientTrace(first), WithClientTrace(second))
+	tracedRequest.SetEventHandler(func(e Event) {
+		if e.Name == "GotConn" {
+			calls = append(calls, "trace GotConn")
+		}
+	})
+	err = tracedRequest.Execute()
+	if err != nil {
+		t.Fatalf("Error doing traced request: %v", err)
+	}
+
+	expected := []string{"trace GotConn", "first GotConn", "second GotConn", "first GotFirstResponseByte"}
+	if strings.Join(calls, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("Unexpected hook calls: got %v, want %v", calls, expected)
+	}
+	timings := tracedRequest.GetTimings()
+	if timings.ConnectionDialDuration == 0 || timings.ResponseDelayDuration == 0 {
+		t.Errorf("Expected the timings to be taken alongside the added hooks: got %+v", timings)
+	}
+}
+
+func TestTraceWireWriter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Echo", string(body))
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodPost, server.URL+"/things", strings.NewReader("hello"))
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	wire := &bytes.Buffer{}
+	tracedRequest := New(&http.Client{}, request)
+	tracedRequest.SetWireWriter(wire)
+	err = tracedRequest.Execute()
+	if err != nil {
+		t.Fatalf("Error doing traced request: %v", err)
+	}
+
+	if got := tracedRequest.GetResponse().Header.Get("X-Echo"); got != "hello" {
+		t.Errorf("Expected the request body to still be sent: got %q", got)
+	}
+
+	expected := []string{
+		"WroteRequest\n> POST /things HTTP/1.1\n> Host: " + strings.TrimPrefix(server.URL, "http://") + "\n",
+		"> Content-Length: 5\n",
+		">\n> hello\n",
+		"GotFirstResponseByte\n< HTTP/1.1 200 OK\n",
+		"< X-Echo: hello\n",
+		"BodyDone 2 bytes\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(wire.String(), e) {
+			t.Errorf("Wire log incorrect: got\n%v\nwant it to contain\n%v", wire.String(), e)
+		}
+	}
+}
+
+func TestTraceEventHandler(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	handled := []Event{}
+	tracedRequest := New(&http.Client{}, request)
+	tracedRequest.SetEventHandler(func(e Event) {
+		handled = append(handled, e)
+	})
+	err = tracedRequest.Execute()
+	if err != nil {
+		t.Fatalf("Error doing traced request: %v", err)
+	}
+
+	events := tracedRequest.GetEvents()
+	if len(handled) != len(events) {
+		t.Fatalf("Unexpected number of handled events: got %d, want %d", len(handled), len(events))
+	}
+	for i := range events {
+		if handled[i] != events[i] {
+			t.Errorf("Unexpected event %d: got %+v, want %+v", i, handled[i], events[i])
+		}
+	}
+}
+
+func TestTraceTimeline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	before := time.Now()
+	tracedRequest := New(&http.Client{}, request)
+	err = tracedRequest.Execute()
+	if err != nil {
+		t.Fatalf("Error doing traced request: %v", err)
+	}
+
+	timeline := tracedRequest.GetTimeline()
+	if timeline.Start.Before(before) || timeline.Start.After(time.Now()) {
+		t.Errorf("Unexpected start: got %v, want after %v", timeline.Start, before)
+	}
+	if total := tracedRequest.GetTimings().TotalRequestDuration; timeline.End < total {
+		t.Errorf("Unexpected end: got %v, want at least the total %v", timeline.End, total)
+	}
+	if len(timeline.Events) != len(tracedRequest.GetEvents()) {
+		t.Errorf("Unexpected number of events: got %d, want %d", len(timeline.Events), len(tracedRequest.GetEvents()))
+	}
+
+	// The server is addressed by IP, so there is no DNS lookup, and over
+	// plain http there is no TLS handshake
+	phases := []string{}
+	for i, s := range timeline.Spans {
+		phases = append(phases, s.Phase)
+		if s.Start < 0 || s.End > timeline.End || s.Duration() <= 0 {
+			t.Errorf("Span %s out of the request: %v to %v of %v", s.Phase, s.Start, s.End, timeline.End)
+		}
+		if i > 0 && s.Start < timeline.Spans[i-1].Start {
+			t.Errorf("Span %s starts before %s", s.Phase, timeline.Spans[i-1].Phase)
+		}
+	}
+	expected := []string{"connection", "connect", "request_write", "response_delay", "response_read"}
+	if strings.Join(phases, " ") != strings.Join(expected, " ") {
+		t.Fatalf("Unexpected spans: got %v, want %v", phases, expected)
+	}
+	spans := timeline.Spans
+	if spans[2].Start < spans[0].End || spans[3].Start < spans[2].End || spans[4].Start != spans[3].End {
+		t.Errorf("Spans overlap: %+v", spans)
+	}
+}
+
+func TestTraceBodyReadError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "10")
+		w.Write([]byte("hello"))
+		w.(http.Flusher).Flush()
+		// Closes the connection with the body half sent
+		panic(http.ErrAbortHandler)
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	tracedRequest := New(&http.Client{}, request)
+	err = tracedRequest.Execute()
+
+	var bodyErr *BodyReadError
+	if !errors.As(err, &bodyErr) {
+		t.Fatalf("Unexpected error: got %v, want a BodyReadError", err)
+	}
+	if bodyErr.BytesRead != 5 || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Unexpected body error: got %+v", bodyErr)
+	}
+	if tracedRequest.GetResponse() == nil || tracedRequest.GetResponse().StatusCode != http.StatusOK {
+		t.Fatalf("Expected the response to be kept: got %+v", tracedRequest.GetResponse())
+	}
+	if tracedRequest.GetResponseBody() != "hello" {
+		t.Errorf("Unexpected response body: got %q, want %q", tracedRequest.GetResponseBody(), "hello")
+	}
+	if tracedRequest.GetTimings().TotalRequestDuration == 0 {
+		t.Errorf("Expected the request to be timed up to the failure")
+	}
+}
+
+func TestTraceSetHeaders(t *testing.T) {
+	type testSetHeaders struct {
+		raw           []string
+		expected      http.Header
+		expectedError string
+	}
+
+	tests := map[string]testSetHeaders{
+		"will set headers with or without a space": {
+			raw:      []string{"X-Thing: one", "x-other:two", "X-Empty:"},
+			expected: http.Header{"X-Thing": {"one"}, "X-Other": {"two"}, "X-Empty": {""}, "Accept": {"*/*"}},
+		},
+		"will keep the last of a repeated header": {
+			raw:      []string{"Accept: text/html", "Accept: application/json"},
+			expected: http.Header{"Accept": {"application/json"}},
+		},
+		"will reject a header without a colon": {
+			raw:           []string{"X-Thing: one", "X-Broken"},
+			expectedError: `invalid header "X-Broken", expected 'Name: value'`,
+		},
+		"will reject a header without a name": {
+			raw:           []string{": value"},
+			expectedError: `invalid header ": value", expected 'Name: value'`,
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			request, err := http.NewRequest(http.MethodGet, "http://thing.com", nil)
+			if err != nil {
+				t.Fatalf("Error creating http request: %v", err)
+			}
+			request.Header.Set("Accept", "*/*")
+
+			err = New(&http.Client{}, request).SetHeaders(cfg.raw)
+			if cfg.expectedError != "" {
+				if err == nil || err.Error() != cfg.expectedError {
+					t.Errorf("Unexpected error: got %v, want %q", err, cfg.expectedError)
+				}
+				if len(request.Header) != 1 {
+					t.Errorf("Expected no headers to be set: got %v", request.Header)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Error setting headers: %v", err)
+			}
+			if !reflect.DeepEqual(request.Header, cfg.expected) {
+				t.Errorf("Unexpected headers: got %v, want %v", request.Header, cfg.expected)
+			}
+		})
+	}
+}
+
+func TestTraceSetTrailers(t *testing.T) {
+	type testSetTrailers struct {
+		raw           []string
+		expected      http.Header
+		expectedError string
+	}
+
+	tests := map[string]testSetTrailers{
+		"will set trailers with or without a space": {
+			raw:      []string{"X-Checksum: abc123", "x-other:two"},
+			expected: http.Header{"X-Checksum": {"abc123"}, "X-Other": {"two"}},
+		},
+		"will reject a trailer without a colon": {
+			raw:           []string{"X-Checksum: abc123", "X-Broken"},
+			expectedError: `invalid trailer "X-Broken", expected 'Name: value'`,
+		},
+		"will reject a trailer without a name": {
+			raw:           []string{": value"},
+			expectedError: `invalid trailer ": value", expected 'Name: value'`,
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			request, err := http.NewRequest(http.MethodPost, "http://thing.com", strings.NewReader("upload"))
+			if err != nil {
+				t.Fatalf("Error creating http request: %v", err)
+			}
+
+			err = New(&http.Client{}, request).SetTrailers(cfg.raw)
+			if cfg.expectedError != "" {
+				if err == nil || err.Error() != cfg.expectedError {
+					t.Errorf("Unexpected error: got %v, want %q", err, cfg.expectedError)
+				}
+				if request.Trailer != nil || request.ContentLength != int64(len("upload")) {
+					t.Errorf("Expected no trailers to be set: got %v, length %d", request.Trailer, request.ContentLength)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Error setting trailers: %v", err)
+			}
+			if !reflect.DeepEqual(request.Trailer, cfg.expected) {
+				t.Errorf("Unexpected trailers: got %v, want %v", request.Trailer, cfg.expected)
+			}
+			if request.ContentLength != -1 {
+				t.Errorf("Unexpected content length: got %d, want -1", request.ContentLength)
+			}
+		})
+	}
+}
+
+func TestTraceRemoteAddr(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	tracedRequest := New(&http.Client{}, request)
+	err = tracedRequest.Execute()
+	if err != nil {
+		t.Fatalf("Error doing traced request: %v", err)
+	}
+
+	addr := tracedRequest.GetRemoteAddr()
+	if addr == nil || addr.String() != server.Listener.Addr().String() {
+		t.Errorf("Unexpected remote address: got %v, want %v", addr, server.Listener.Addr())
+	}
+}
+
+func TestTraceLocalAddr(t *testing.T) {
+	clientAddr := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientAddr <- r.RemoteAddr
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	tracedRequest := New(&http.Client{}, request)
+	err = tracedRequest.Execute()
+	if err != nil {
+		t.Fatalf("Error doing traced request: %v", err)
+	}
+
+	addr := tracedRequest.GetLocalAddr()
+	if want := <-clientAddr; addr == nil || addr.String() != want {
+		t.Errorf("Unexpected local address: got %v, want %v", addr, want)
+	}
+}
+
+func TestTraceDialAttempts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	// Reports a failed attempt to an IPv6 address before the dialer connects
+	// to the server, as when the first address of a host is unreachable
+	dialer := &net.Dialer{}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			clientTrace := httptrace.ContextClientTrace(ctx)
+			clientTrace.ConnectStart("tcp", "[2001:db8::1]:80")
+			time.Sleep(50 * time.Millisecond)
+			clientTrace.ConnectDone("tcp", "[2001:db8::1]:80", errors.New("connect: network is unreachable"))
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+
+	request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	tracedRequest := New(&http.Client{Transport: transport}, request)
+	err = tracedRequest.Execute()
+	if err != nil {
+		t.Fatalf("Error doing traced request: %v", err)
+	}
+
+	attempts := tracedRequest.GetDialAttempts()
+	if len(attempts) != 2 {
+		t.Fatalf("Unexpected dial attempts: got %+v, want 2", attempts)
+	}
+	failed, won := attempts[0], attempts[1]
+	if failed.Addr != "[2001:db8::1]:80" || failed.Err == nil || failed.Won || failed.Duration < 50*time.Millisecond {
+		t.Errorf("Unexpected failed attempt: got %+v", failed)
+	}
+	if won.Addr != server.Listener.Addr().String() || won.Err != nil || !won.Won || won.Start < failed.Start+failed.Duration {
+		t.Errorf("Unexpected winning attempt: got %+v", won)
+	}
+
+	// The connect phase includes the failed attempt
+	connect := tracedRequest.GetTimings().ConnectionDialDuration
+	if connect < failed.Duration+won.Duration {
+		t.Errorf("Unexpected connect duration: got %v, want at least %v", connect, failed.Duration+won.Duration)
+	}
+}
+
+func TestTraceSkipBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		time.Sleep(300 * time.Millisecond)
+		w.Write([]byte("slow body"))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodPost, server.URL, nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	tracedRequest := New(&http.Client{}, request)
+	tracedRequest.SetSkipBody(true)
+	err = tracedRequest.Execute()
+	if err != nil {
+		t.Fatalf("Error doing traced request: %v", err)
+	}
+
+	if tracedRequest.GetResponse().StatusCode != http.StatusOK {
+		t.Errorf("Unexpected http response status code: got %v, want %v", tracedRequest.GetResponse().StatusCode, http.StatusOK)
+	}
+	if tracedRequest.GetResponseBody() != "" || tracedRequest.GetResponseBodySize() != 0 {
+		t.Errorf("Unexpected http response body: got %q, %v bytes, want none", tracedRequest.GetResponseBody(), tracedRequest.GetResponseBodySize())
+	}
+	if total := tracedRequest.GetTimings().TotalRequestDuration; total >= 300*time.Millisecond {
+		t.Errorf("Request waited for the body: total %v", total)
+	}
+
+	events := tracedRequest.GetEvents()
+	if last := events[len(events)-1].Name; last != "BodySkipped" {
+		t.Errorf("Unexpected last event: got %v, want BodySkipped", last)
+	}
+}
+
+func TestTraceExpectContinue(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The server sends 100 Continue when the body is first read
+		time.Sleep(200 * time.Millisecond)
+		io.ReadAll(r.Body)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("upload"))
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+	request.Header.Set("Expect", "100-continue")
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ExpectContinueTimeout = 5 * time.Second
+	tracedRequest := New(&http.Client{Transport: transport}, request)
+	err = tracedRequest.Execute()
+	if err != nil {
+		t.Fatalf("Error doing traced request: %v", err)
+	}
+
+	timings := tracedRequest.GetTimings()
+	if timings.ContinueDuration < 200*time.Millisecond || timings.ContinueDuration >= 300*time.Millisecond {
+		t.Errorf("Unexpected continue duration: got %v, want about 200ms", timings.ContinueDuration)
+	}
+	if timings.ResponseDelayDuration < 100*time.Millisecond || timings.ResponseDelayDuration >= 200*time.Millisecond {
+		t.Errorf("Unexpected response delay: got %v, want about 100ms", timings.ResponseDelayDuration)
+	}
+
+	names := []string{}
+	for _, e := range tracedRequest.GetEvents() {
+		names = append(names, e.Name)
+	}
+	if !strings.Contains(strings.Join(names, " "), "WroteHeaders Wait100Continue GotFirstResponseByte Got100Continue WroteRequest") {
+		t.Errorf("Unexpected events: got %v", names)
+	}
+}
+
+func TestTraceTrailers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		w.Write([]byte("streamed"))
+		w.(http.Flusher).Flush()
+		time.Sleep(100 * time.Millisecond)
+		w.Header().Set("Grpc-Status", "0")
+		w.Header().Set(http.TrailerPrefix+"X-Echo", r.Trailer.Get("X-Checksum"))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("upload"))
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	tracedRequest := New(&http.Client{}, request)
+	err = tracedRequest.SetTrailers([]string{"X-Checksum: abc123"})
+	if err != nil {
+		t.Fatalf("Error setting trailers: %v", err)
+	}
+	err = tracedRequest.Execute()
+	if err != nil {
+		t.Fatalf("Error doing traced request: %v", err)
+	}
+
+	trailer := tracedRequest.GetResponse().Trailer
+	if trailer.Get("Grpc-Status") != "0" || trailer.Get("X-Echo") != "abc123" {
+		t.Errorf("Unexpected trailers: got %v", trailer)
+	}
+	if tracedRequest.GetResponseBody() != "streamed" {
+		t.Errorf("Unexpected http response body: got %v, want streamed", tracedRequest.GetResponseBody())
+	}
+
+	timings := tracedRequest.GetTimings()
+	if timings.TrailerDuration < 100*time.Millisecond || timings.TrailerDuration >= 200*time.Millisecond {
+		t.Errorf("Unexpected trailer duration: got %v, want about 100ms", timings.TrailerDuration)
+	}
+
+	events := tracedRequest.GetEvents()
+	if last := events[len(events)-1]; last.Name != "Trailers" || last.Detail != "Grpc-Status, X-Echo" {
+		t.Errorf("Unexpected last event: got %v", last)
+	}
+}
+
+func TestTraceChunks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 3; i++ {
+			w.Write([]byte("chunk"))
+			w.(http.Flusher).Flush()
+			time.Sleep(50 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	tracedRequest := New(&http.Client{}, request)
+	err = tracedRequest.Execute()
+	if err != nil {
+		t.Fatalf("Error doing traced request: %v", err)
+	}
+
+	chunks := tracedRequest.GetChunks()
+	if len(chunks) != 3 {
+		t.Fatalf("Unexpected chunks: got %v, want 3", chunks)
+	}
+	for i, chunk := range chunks {
+		if chunk.Size != 5 {
+			t.Errorf("Unexpected size of chunk %d: got %d, want 5", i, chunk.Size)
+		}
+		if i > 0 && chunk.Offset-chunks[i-1].Offset < 50*time.Millisecond {
+			t.Errorf("Chunk %d arrived too soon after the one before: got %v", i, chunk.Offset-chunks[i-1].Offset)
+		}
+	}
+
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not chunked"))
+	})
+	tracedRequest = New(&http.Client{}, request)
+	err = tracedRequest.Execute()
+	if err != nil {
+		t.Fatalf("Error doing traced request: %v", err)
+	}
+	if chunks := tracedRequest.GetChunks(); chunks != nil {
+		t.Errorf("Unexpected chunks of a response with a content length: got %v", chunks)
+	}
+}
+
+func TestTraceWireSizes(t *testing.T) {
+	body := strings.Repeat("a", 1000)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	client := server.Client()
+	client.Transport.(*http.Transport).DialContext = CountWire((&net.Dialer{}).DialContext)
+
+	var sizes []*WireSizes
+	for i := 0; i < 2; i++ {
+		request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		if err != nil {
+			t.Errorf("Error creating http request: %v", err)
+		}
+
+		tracedRequest := New(client, request)
+		err = tracedRequest.Execute()
+		if err != nil {
+			t.Fatalf("Error doing traced request: %v", err)
+		}
+		sizes = append(sizes, tracedRequest.GetWireSizes())
+	}
+
+	for i, s := range sizes {
+		if s == nil {
+			t.Fatalf("No wire sizes for request %d", i)
+		}
+		if s.Sent == 0 {
+			t.Errorf("No bytes sent for request %d", i)
+		}
+		// The headers and TLS records come on top of the body
+		if s.Received <= int64(len(body)) {
+			t.Errorf("Unexpected bytes received for request %d: got %d, want more than %d", i, s.Received, len(body))
+		}
+	}
+	if sizes[0].Setup == 0 {
+		t.Errorf("No setup bytes for the TLS handshake of a new connection")
+	}
+	if sizes[1].Setup != 0 {
+		t.Errorf("Unexpected setup bytes for a reused connection: got %d", sizes[1].Setup)
+	}
+
+	request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+	plain := &http.Transport{TLSClientConfig: client.Transport.(*http.Transport).TLSClientConfig}
+	uncounted := New(&http.Client{Transport: plain}, request)
+	err = uncounted.Execute()
+	if err != nil {
+		t.Fatalf("Error doing traced request: %v", err)
+	}
+	if uncounted.GetWireSizes() != nil {
+		t.Errorf("Unexpected wire sizes for a connection which wasn't counted: %+v", uncounted.GetWireSizes())
+	}
+}
+
+func TestTraceWireHeadAndBody(t *testing.T) {
+	decoded := strings.Repeat("a", 10000)
+	compressed := &bytes.Buffer{}
+	zw := gzip.NewWriter(compressed)
+	zw.Write([]byte(decoded))
+	zw.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(compressed.Bytes())
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &http.Transport{DialContext: CountWire((&net.Dialer{}).DialContext)}}
+	request, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader(strings.Repeat("b", 500)))
+	if err != nil {
+		t.Fatalf("Error creating http request: %v", err)
+	}
+	tracedRequest := New(client, request)
+	err = tracedRequest.Execute()
+	if err != nil {
+		t.Fatalf("Error doing traced request: %v", err)
+	}
+	if got := tracedRequest.GetResponseBody(); got != decoded {
+		t.Fatalf("Unexpected body: got %d bytes, want the %d decoded", len(got), len(decoded))
+	}
+
+	s := tracedRequest.GetWireSizes()
+	if s == nil {
+		t.Fatalf("No wire sizes")
+	}
+	if s.RequestBody != 500 || s.RequestHead != s.Sent-500 || s.RequestHead == 0 {
+		t.Errorf("Unexpected request head and body: got %d and %d of %d bytes sent, want the body to be 500", s.RequestHead, s.RequestBody, s.Sent)
+	}
+	if s.ResponseHead+s.ResponseBody != s.Received || s.ResponseHead == 0 {
+		t.Errorf("Unexpected response head and body: got %d and %d of %d bytes received", s.ResponseHead, s.ResponseBody, s.Received)
+	}
+	// The body is counted as it was sent, compressed, give or take the
+	// Content-Length header the transport removes as it decodes it
+	want := int64(compressed.Len())
+	if s.ResponseBody < want || s.ResponseBody > want+30 {
+		t.Errorf("Unexpected response body on the wire: got %d bytes, want about the %d compressed", s.ResponseBody, want)
+	}
+}
+
+func TestTraceWireDump(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", "Mon, 02 Jan 2006 15:04:05 GMT")
+		w.Write([]byte("hello " + r.URL.Path[1:]))
+	}))
+	defer server.Close()
+
+	transport := &http.Transport{DialContext: CountWire((&net.Dialer{}).DialContext)}
+	client := &http.Client{Transport: transport}
+
+	// Both requests are sent on the same connection, and each dump only has
+	// the bytes of its own request
+	for _, name := range []string{"first", "second"} {
+		request, err := http.NewRequest(http.MethodGet, server.URL+"/"+name, nil)
+		if err != nil {
+			t.Errorf("Error creating http request: %v", err)
+		}
+
+		sent, received := &bytes.Buffer{}, &bytes.Buffer{}
+		tracedRequest := New(client, request)
+		tracedRequest.SetWireDump(sent, received)
+		err = tracedRequest.Execute()
+		if err != nil {
+			t.Fatalf("Error doing traced request: %v", err)
+		}
+
+		if !strings.HasPrefix(sent.String(), "GET /"+name+" HTTP/1.1\r\nHost: ") || !strings.HasSuffix(sent.String(), "\r\n\r\n") {
+			t.Errorf("Unexpected bytes sent: got %q", sent.String())
+		}
+		expectedReceived := "HTTP/1.1 200 OK\r\nDate: Mon, 02 Jan 2006 15:04:05 GMT\r\nContent-Length: " + fmt.Sprint(len(name)+6) + "\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nhello " + name
+		if received.String() != expectedReceived {
+			t.Errorf("Unexpected bytes received: got %q, want %q", received.String(), expectedReceived)
+		}
+		sizes := tracedRequest.GetWireSizes()
+		if int64(sent.Len()) != sizes.Sent || int64(received.Len()) != sizes.Received {
+			t.Errorf("Dump doesn't match the wire sizes: got %d and %d bytes, want %+v", sent.Len(), received.Len(), sizes)
+		}
+	}
+}
+
+func TestTraceTCPInfo(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("TCP statistics are only read on Linux and macOS")
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	transport := &http.Transport{DialContext: CountWire((&net.Dialer{}).DialContext)}
+	tracedRequest := New(&http.Client{Transport: transport}, request)
+	err = tracedRequest.Execute()
+	if err != nil {
+		t.Fatalf("Error doing traced request: %v", err)
+	}
+
+	info := tracedRequest.GetTCPInfo()
+	if info == nil {
+		t.Fatalf("No TCP statistics read")
+	}
+	if info.RTT <= 0 {
+		t.Errorf("Unexpected round trip time: got %v", info.RTT)
+	}
+	if info.CongestionWindow == 0 {
+		t.Errorf("Unexpected congestion window: got %d", info.CongestionWindow)
+	}
+}
+
+func TestTraceDNSQueries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	// Reports the queries a resolver would send, with the name with a search
+	// domain not existing
+	dialer := &net.Dialer{}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			done := StartDNSQuery(ctx, "10.0.0.2:53", "thing.corp.example.", "A")
+			time.Sleep(20 * time.Millisecond)
+			done(DNSAnswer{Outcome: "NXDOMAIN"})
+			done = StartDNSQuery(ctx, "10.0.0.2:53", "thing.", "A")
+			done(DNSAnswer{Outcome: "NOERROR", Answers: 1})
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+
+	request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	tracedRequest := New(&http.Client{Transport: transport}, request)
+	err = tracedRequest.Execute()
+	if err != nil {
+		t.Fatalf("Error doing traced request: %v", err)
+	}
+
+	queries := tracedRequest.GetDNSQueries()
+	if len(queries) != 2 {
+		t.Fatalf("Unexpected number of DNS queries: got %d, want 2", len(queries))
+	}
+	if q := queries[0]; q.Name != "thing.corp.example." || q.Outcome != "NXDOMAIN" || q.Duration < 20*time.Millisecond {
+		t.Errorf("Unexpected first DNS query: %+v", q)
+	}
+	if q := queries[1]; q.Name != "thing." || q.Outcome != "NOERROR" || q.Answers != 1 || q.Start < queries[0].Start+queries[0].Duration {
+		t.Errorf("Unexpected second DNS query: %+v", q)
+	}
+
+	found := false
+	for _, e := range tracedRequest.GetEvents() {
+		if e.Name == "DNSQuery" && e.Detail == "A thing. NOERROR from 10.0.0.2:53, 1 in answer" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("No event for the DNS query: %+v", tracedRequest.GetEvents())
+	}
+
+	// Outside a traced request nothing is recorded
+	StartDNSQuery(context.Background(), "10.0.0.2:53", "thing.", "A")(DNSAnswer{Outcome: "NOERROR", Answers: 1})
+}
+
+func TestTraceStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		for i := 0; i < 4; i++ {
+			w.Write([]byte(strings.Repeat("x", 1000)))
+			w.(http.Flusher).Flush()
+			time.Sleep(100 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	handled := 0
+	tracedRequest := New(&http.Client{}, request)
+	tracedRequest.SetStatusHandler(50*time.Millisecond, func(s Status) { handled++ })
+	err = tracedRequest.Execute()
+	if err != nil {
+		t.Fatalf("Error doing traced request: %v", err)
+	}
+
+	statuses := tracedRequest.GetStatuses()
+	if len(statuses) < 6 || handled != len(statuses) {
+		t.Fatalf("Unexpected statuses: got %d, handled %d, want about 10", len(statuses), handled)
+	}
+	if first := statuses[0]; first.Phase != "response_delay" || first.BodyBytes != 0 {
+		t.Errorf("Unexpected first status: got %+v, want response_delay with no body", first)
+	}
+	last := statuses[len(statuses)-1]
+	if last.Phase != "response_read" || last.BodyBytes < 3000 || last.PhaseElapsed >= last.Elapsed {
+		t.Errorf("Unexpected last status: got %+v, want response_read with most of the body", last)
+	}
+	for i := 1; i < len(statuses); i++ {
+		if statuses[i].Elapsed <= statuses[i-1].Elapsed || statuses[i].BodyBytes < statuses[i-1].BodyBytes {
+			t.Errorf("Statuses out of order: %+v after %+v", statuses[i], statuses[i-1])
+		}
+	}
+}
+
+func TestTraceProgressHandler(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "4000")
+		time.Sleep(100 * time.Millisecond)
+		for i := 0; i < 4; i++ {
+			w.Write([]byte(strings.Repeat("x", 1000)))
+			w.(http.Flusher).Flush()
+			time.Sleep(100 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	progress := []Progress{}
+	tracedRequest := New(&http.Client{}, request)
+	tracedRequest.SetProgressHandler(50*time.Millisecond, func(p Progress) { progress = append(progress, p) })
+	err = tracedRequest.Execute()
+	if err != nil {
+		t.Fatalf("Error doing traced request: %v", err)
+	}
+	handled := len(progress)
+
+	// Only the body is followed, not the 100ms before the response
+	if handled < 4 || handled > 9 {
+		t.Fatalf("Unexpected progress: got %d calls, want about 8", handled)
+	}
+	for i, p := range progress {
+		if p.BodyTotal != 4000 {
+			t.Errorf("Unexpected total: got %d, want 4000", p.BodyTotal)
+		}
+		if i > 0 && (p.Elapsed <= progress[i-1].Elapsed || p.BodyBytes < progress[i-1].BodyBytes) {
+			t.Errorf("Progress out of order: %+v after %+v", p, progress[i-1])
+		}
+	}
+	if last := progress[handled-1]; last.BodyBytes < 3000 {
+		t.Errorf("Unexpected last progress: got %+v, want most of the body", last)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if len(progress) != handled {
+		t.Errorf("Progress handler called after Execute returned")
+	}
+}
+
+func TestTraceLongPoll(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		for {
+			w.Write([]byte("\n"))
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	tracedRequest := New(&http.Client{Timeout: 300 * time.Millisecond}, request)
+	tracedRequest.SetLongPoll(true)
+	err = tracedRequest.Execute()
+	if err != nil {
+		t.Fatalf("Error doing traced request: %v", err)
+	}
+
+	longPoll := tracedRequest.GetLongPoll()
+	if longPoll == nil || !longPoll.HeldOpen {
+		t.Fatalf("Expected the response to be held open: got %+v", longPoll)
+	}
+	if len(longPoll.Reads) < 3 || int64(len(longPoll.Reads)) != tracedRequest.GetResponseBodySize() {
+		t.Errorf("Unexpected reads: got %d for %d bytes", len(longPoll.Reads), tracedRequest.GetResponseBodySize())
+	}
+	if body := tracedRequest.GetResponseBody(); strings.Trim(body, "\n") != "" {
+		t.Errorf("Unexpected http response body: got %q, want the keep-alive bytes", body)
+	}
+	if total := tracedRequest.GetTimings().TotalRequestDuration; total < 300*time.Millisecond {
+		t.Errorf("Unexpected total: got %v, want at least the timeout", total)
+	}
+}
+
+func TestTraceStallTimeout(t *testing.T) {
+	type testStall struct {
+		pause    time.Duration
+		stalled  bool
+		expected string
+	}
+
+	tests := map[string]testStall{
+		"server stalls mid-body": {
+			pause:   500 * time.Millisecond,
+			stalled: true,
+		},
+		"body keeps arriving": {
+			pause:    20 * time.Millisecond,
+			expected: "hello world",
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				for _, part := range []string{"hello", " ", "world"} {
+					w.Write([]byte(part))
+					w.(http.Flusher).Flush()
+					select {
+					case <-r.Context().Done():
+						return
+					case <-time.After(cfg.pause):
+					}
+				}
+			}))
+			defer server.Close()
+
+			request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			if err != nil {
+				t.Errorf("Error creating http request: %v", err)
+			}
+
+			tracedRequest := New(&http.Client{Timeout: 5 * time.Second}, request)
+			tracedRequest.SetStallTimeout(100 * time.Millisecond)
+			err = tracedRequest.Execute()
+			if err != nil {
+				t.Fatalf("Error doing traced request: %v", err)
+			}
+
+			stall := tracedRequest.GetStall()
+			if stall == nil || stall.Stalled != cfg.stalled || stall.Timeout != 100*time.Millisecond {
+				t.Fatalf("Unexpected stall: got %+v", stall)
+			}
+			if cfg.stalled {
+				if stall.BodyBytes != 5 {
+					t.Errorf("Unexpected bytes before the stall: got %d, want 5", stall.BodyBytes)
+				}
+				if total := tracedRequest.GetTimings().TotalRequestDuration; total >= 500*time.Millisecond {
+					t.Errorf("Unexpected total: got %v, want the read aborted before the server resumed", total)
+				}
+				return
+			}
+			if stall.LargestGap < 20*time.Millisecond || stall.LargestGap >= 100*time.Millisecond {
+				t.Errorf("Unexpected largest gap: got %v", stall.LargestGap)
+			}
+			if body := tracedRequest.GetResponseBody(); body != cfg.expected {
+				t.Errorf("Unexpected http response body: got %q, want %q", body, cfg.expected)
+			}
+		})
+	}
+}
+
+type testTraceProbe struct {
+	phase         string
+	url           string
+	expectedTLS   bool
+	expectedError string
+}
+
+func TestTraceProbe(t *testing.T) {
+	requests := int32(0)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	}))
+	// The connect probe closes its connection without a handshake
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+	plainServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer plainServer.Close()
+	tlsConfig := server.Client().Transport.(*http.Transport).TLSClientConfig
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+
+	tests := map[string]testTraceProbe{
+		"will resolve the host": {
+			phase: ProbeDNS,
+			url:   fmt.Sprintf("https://localhost:%d", port),
+		},
+		"will connect to the host": {
+			phase: ProbeConnect,
+			url:   server.URL,
+		},
+		"will complete the TLS handshake": {
+			phase:       ProbeTLS,
+			url:         server.URL,
+			expectedTLS: true,
+		},
+		"will fail the TLS handshake with a server which doesn't speak TLS": {
+			phase:         ProbeTLS,
+			url:           strings.Replace(plainServer.URL, "http://", "https://", 1),
+			expectedError: "error in TLS handshake",
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			request, err := http.NewRequest(http.MethodGet, cfg.url, nil)
+			if err != nil {
+				t.Errorf("Error creating http request: %v", err)
+			}
+
+			tracedRequest := New(&http.Client{Timeout: 2 * time.Second}, request, WithProbe(cfg.phase, ProbeConfig{TLSConfig: tlsConfig}))
+			err = tracedRequest.Execute()
+			if cfg.expectedError != "" {
+				var sendErr *SendError
+				if !errors.As(err, &sendErr) || !strings.Contains(err.Error(), cfg.expectedError) {
+					t.Fatalf("Unexpected error: got %v, want a send error containing %q", err, cfg.expectedError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Error probing: %v", err)
+			}
+
+			timings := tracedRequest.GetTimings()
+			if cfg.phase != ProbeDNS && (timings.ConnectionDialDuration <= 0 || tracedRequest.GetRemoteAddr() == nil) {
+				t.Errorf("Expected the connection to be timed: got %+v", timings)
+			}
+			if (timings.TLSDuration > 0) != cfg.expectedTLS || (tracedRequest.GetResponse().TLS != nil) != cfg.expectedTLS {
+				t.Errorf("Unexpected TLS handshake: got %v, want %v", timings.TLSDuration, cfg.expectedTLS)
+			}
+			if timings.TotalRequestDuration <= 0 || timings.RequestWriteDuration != 0 || timings.ResponseDelayDuration != 0 {
+				t.Errorf("Unexpected timings: got %+v", timings)
+			}
+			events := tracedRequest.GetEvents()
+			if last := events[len(events)-1]; last.Name != "ProbeDone" || last.Detail != cfg.phase {
+				t.Errorf("Unexpected last event: got %+v", last)
+			}
+		})
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 0 {
+		t.Errorf("Unexpected requests sent by the probes: got %d, want 0", n)
+	}
+}
+
+func TestTraceHTTP2StreamReset(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+		w.(http.Flusher).Flush()
+		// Resets the stream with the body half sent
+		panic(http.ErrAbortHandler)
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	tracedRequest := New(server.Client(), request)
+	err = tracedRequest.Execute()
+	var bodyErr *BodyReadError
+	if !errors.As(err, &bodyErr) {
+		t.Fatalf("Unexpected error: got %v, want a BodyReadError", err)
+	}
+
+	details := map[string]string{}
+	for _, e := range tracedRequest.GetEvents() {
+		details[e.Name] = e.Detail
+	}
+	if !strings.HasSuffix(details["TLSHandshakeDone"], ", h2") {
+		t.Errorf("Expected HTTP/2 to be negotiated: got %q", details["TLSHandshakeDone"])
+	}
+	if details["HTTP2StreamReset"] != "stream ID 1; INTERNAL_ERROR; received from peer" {
+		t.Errorf("Unexpected stream reset: got %q in %v", details["HTTP2StreamReset"], tracedRequest.GetEvents())
+	}
+}
+
+func TestHTTP2Event(t *testing.T) {
+	type testHTTP2Event struct {
+		err    error
+		name   string
+		detail string
+	}
+
+	tests := map[string]testHTTP2Event{
+		"stream reset": {
+			err:    errors.New("stream error: stream ID 3; REFUSED_STREAM; received from peer"),
+			name:   "HTTP2StreamReset",
+			detail: "stream ID 3; REFUSED_STREAM; received from peer",
+		},
+		"goaway": {
+			err:    fmt.Errorf(`Get "https://thing.com": %w`, errors.New(`http2: server sent GOAWAY and closed the connection; LastStreamID=1, ErrCode=NO_ERROR, debug=""`)),
+			name:   "HTTP2GoAway",
+			detail: `server sent GOAWAY and closed the connection; LastStreamID=1, ErrCode=NO_ERROR, debug=""`,
+		},
+		"graceful goaway": {
+			err:    errors.New("http2: Transport received Server's graceful shutdown GOAWAY"),
+			name:   "HTTP2GoAway",
+			detail: "Transport received Server's graceful shutdown GOAWAY",
+		},
+		"connection error": {
+			err:    errors.New("connection error: PROTOCOL_ERROR"),
+			name:   "HTTP2ConnectionError",
+			detail: "connection error: PROTOCOL_ERROR",
+		},
+		"wrapped stream reset": {
+			err:    fmt.Errorf("reading body: %w", errors.New("stream error: stream ID 1; INTERNAL_ERROR")),
+			name:   "HTTP2StreamReset",
+			detail: "stream ID 1; INTERNAL_ERROR",
+		},
+		"other error": {
+			err: io.ErrUnexpectedEOF,
+		},
+		"other error mentioning a stream": {
+			err: errors.New("upstream error: stream error: connection error: refused"),
+		},
+		"other connection error": {
+			err: errors.New("connection error: the server went away"),
+		},
+	}
+
+	for name, cfg := range tests {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			name, detail, ok := http2Event(cfg.err)
+			if ok != (cfg.name != "") || name != cfg.name || detail != cfg.detail {
+				t.Errorf("Unexpected event: got %q %q %v, want %q %q", name, detail, ok, cfg.name, cfg.detail)
+			}
+		})
+	}
+}
+
+func TestTraceStreamBody(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte(" world"))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	tracedRequest := New(&http.Client{}, request)
+	tracedRequest.SetStreamBody(true)
+	// Returns while the server is still holding back the rest of the body
+	err = tracedRequest.Execute()
+	if err != nil {
+		t.Fatalf("Error doing traced request: %v", err)
+	}
+	if tracedRequest.GetResponse() == nil || tracedRequest.GetResponse().StatusCode != http.StatusOK {
+		t.Fatalf("Expected the response: got %+v", tracedRequest.GetResponse())
+	}
+	if tracedRequest.GetTimings().TotalRequestDuration != 0 {
+		t.Errorf("Expected the request not to be timed before the body is read: got %v", tracedRequest.GetTimings().TotalRequestDuration)
+	}
+
+	body := tracedRequest.GetResponseBodyReader()
+	start := make([]byte, 5)
+	_, err = io.ReadFull(body, start)
+	if err != nil || string(start) != "hello" {
+		t.Fatalf("Unexpected start of the body: got %q, %v", start, err)
+	}
+	close(release)
+	rest, err := io.ReadAll(body)
+	if err != nil || string(rest) != " world" {
+		t.Errorf("Unexpected rest of the body: got %q, %v", rest, err)
+	}
+	err = body.Close()
+	if err != nil {
+		t.Errorf("Error closing the body: %v", err)
+	}
+
+	timings := tracedRequest.GetTimings()
+	if timings.TotalRequestDuration == 0 || timings.ResponseReadDuration == 0 {
+		t.Errorf("Expected the request to be timed once the body was closed: got %+v", timings)
+	}
+	if tracedRequest.GetResponseBodySize() != 11 || tracedRequest.GetResponseBody() != "" {
+		t.Errorf("Unexpected body kept: got %q of %d bytes", tracedRequest.GetResponseBody(), tracedRequest.GetResponseBodySize())
+	}
+	events := tracedRequest.GetEvents()
+	if last := events[len(events)-1]; last.Name != "BodyDone" || last.Detail != "11 bytes" {
+		t.Errorf("Unexpected last event: got %+v", last)
+	}
+}
+
+func TestTraceStreamBodyError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "10")
+		w.Write([]byte("hello"))
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	tracedRequest := New(&http.Client{}, request)
+	tracedRequest.SetStreamBody(true)
+	err = tracedRequest.Execute()
+	if err != nil {
+		t.Fatalf("Error doing traced request: %v", err)
+	}
+
+	body := tracedRequest.GetResponseBodyReader()
+	_, err = io.ReadAll(body)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Unexpected error reading the body: got %v", err)
+	}
+	// Closing it returns the error Execute would have
+	var bodyErr *BodyReadError
+	err = body.Close()
+	if !errors.As(err, &bodyErr) || bodyErr.BytesRead != 5 {
+		t.Errorf("Unexpected error closing the body: got %v", err)
+	}
+	if !errors.Is(body.Close(), io.ErrUnexpectedEOF) {
+		t.Errorf("Expected closing the body again to return the same error")
+	}
+}
+
+func TestTraceResponseBodyReader(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello world"))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Errorf("Error creating http request: %v", err)
+	}
+
+	tracedRequest := New(&http.Client{}, request)
+	if tracedRequest.GetResponseBodyReader() != nil {
+		t.Errorf("Expected no body before the request was sent")
+	}
+	err = tracedRequest.Execute()
+	if err != nil {
+		t.Fatalf("Error doing traced request: %v", err)
+	}
+
+	// Without streaming, the body kept is read
+	body, err := io.ReadAll(tracedRequest.GetResponseBodyReader())
+	if err != nil || string(body) != "hello world" {
+		t.Errorf("Unexpected body: got %q, %v", body, err)
+	}
+}
@@ -0,0 +1,191 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// WireSizes is how many bytes a request took on the wire, including the
+// headers, any HTTP/2 framing and HPACK compression, and TLS records, rather
+// than just the length of the bodies.
+//
+// The response head is counted as HTTP/1 sends it, so over HTTP/2, whose
+// headers are compressed, it is an estimate.
+type WireSizes struct {
+	Sent         int64 // Bytes written for the request
+	Received     int64 // Bytes read for the response
+	Setup        int64 // Bytes written and read setting up a new connection, such as for the TLS handshake
+	RequestHead  int64 // Bytes of Sent which weren't the request body: the request line, headers, framing and TLS records
+	RequestBody  int64 // Bytes of the request body sent
+	ResponseHead int64 // Bytes of Received which were the status line and headers
+	ResponseBody int64 // The rest of Received: the body as it was sent, before any Content-Encoding is decoded, with its framing
+}
+
+// sentBody counts the bytes of the request body the transport reads to send.
+type sentBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *sentBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	atomic.AddInt64(&b.n, int64(n))
+	return n, err
+}
+
+// responseHeadSize returns the bytes of the status line and headers of resp
+// as HTTP/1 sends them, including the Content-Encoding the transport removes
+// as it decodes the body.
+func responseHeadSize(resp *http.Response) int64 {
+	size := len(resp.Proto) + 1 + len(resp.Status) + 2
+	for name, values := range resp.Header {
+		for _, v := range values {
+			size += len(name) + 2 + len(v) + 2
+		}
+	}
+	if resp.Uncompressed {
+		size += len("Content-Encoding: gzip\r\n")
+	}
+	return int64(size + 2)
+}
+
+// wireConns are the connections made with CountWire, by their addresses, so
+// a trace can find the counts of the connection its request was sent on even
+// if it is wrapped, as a TLS connection is.
+var wireConns sync.Map
+
+// wireConn counts the bytes written to and read from a connection.
+type wireConn struct {
+	net.Conn
+	key      string
+	written  int64
+	read     int64
+	closeOne sync.Once
+	tap      *wireTap
+	tapMu    sync.Mutex
+}
+
+// wireTap is where the bytes of a connection are copied to, for SetWireDump.
+type wireTap struct {
+	sent     *errorWriter
+	received *errorWriter
+}
+
+func (c *wireConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	atomic.AddInt64(&c.read, int64(n))
+	c.copyToTap(p[:n], true)
+	return n, err
+}
+
+func (c *wireConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	atomic.AddInt64(&c.written, int64(n))
+	c.copyToTap(p[:n], false)
+	return n, err
+}
+
+// setTap copies the bytes written to and read from the connection to tap from
+// now on, or stops copying them if tap is nil.
+func (c *wireConn) setTap(tap *wireTap) {
+	c.tapMu.Lock()
+	defer c.tapMu.Unlock()
+	c.tap = tap
+}
+
+// copyToTap copies bytes read or written to the tap, if there is one. Failing
+// to is recorded by the tap, rather than failing the connection.
+func (c *wireConn) copyToTap(p []byte, received bool) {
+	if len(p) == 0 {
+		return
+	}
+	c.tapMu.Lock()
+	defer c.tapMu.Unlock()
+	switch {
+	case c.tap == nil:
+	case received:
+		c.tap.received.Write(p)
+	default:
+		c.tap.sent.Write(p)
+	}
+}
+
+func (c *wireConn) Close() error {
+	c.closeOne.Do(func() {
+		wireConns.Delete(c.key)
+	})
+	return c.Conn.Close()
+}
+
+func (c *wireConn) counts() (int64, int64) {
+	return atomic.LoadInt64(&c.written), atomic.LoadInt64(&c.read)
+}
+
+// CountWire wraps dial so the bytes sent and received on the TCP connections
+// it makes are counted, for the WireSizes of the requests sent on them. It is
+// used as the DialContext of an http.Transport.
+func CountWire(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		// Only TCP connections have addresses unique enough to find them by
+		if err != nil || !strings.HasPrefix(conn.RemoteAddr().Network(), "tcp") {
+			return conn, err
+		}
+
+		counted := &wireConn{Conn: conn, key: wireKey(conn)}
+		wireConns.Store(counted.key, counted)
+		return counted, nil
+	}
+}
+
+func wireKey(conn net.Conn) string {
+	return conn.LocalAddr().String() + " " + conn.RemoteAddr().String()
+}
+
+// findWireConn returns the counted connection conn is, or wraps, if any.
+func findWireConn(conn net.Conn) *wireConn {
+	if conn == nil || conn.LocalAddr() == nil || conn.RemoteAddr() == nil {
+		return nil
+	}
+	found, ok := wireConns.Load(wireKey(conn))
+	if !ok {
+		return nil
+	}
+	return found.(*wireConn)
+}
+
+// SetWireDump copies the exact bytes written to and read from the connection
+// while the request is sent and its response read to sent and received, such
+// as to archive them. Only connections made with CountWire are tapped, from
+// when the request gets its connection, so the bytes setting up a new
+// connection are left out. For HTTPS they are the encrypted TLS records.
+func (t *Trace) SetWireDump(sent, received io.Writer) {
+	t.wireDump = &wireTap{sent: &errorWriter{writer: sent}, received: &errorWriter{writer: received}}
+}
+
+// untapWire stops copying the bytes of the connection of the request to the
+// wire dump.
+func (t *Trace) untapWire() {
+	if t.wire != nil && t.wireDump != nil {
+		t.wire.setTap(nil)
+	}
+}
+
+// wireDumpError returns the error writing the wire dump, if there was one.
+func (t *Trace) wireDumpError() error {
+	if t.wireDump == nil {
+		return nil
+	}
+	for _, w := range []*errorWriter{t.wireDump.sent, t.wireDump.received} {
+		if w.err != nil {
+			return fmt.Errorf("error writing wire dump: %w", w.err)
+		}
+	}
+	return nil
+}